@@ -88,3 +88,94 @@ func TestAutoIncrementAlternativeSimple(t *testing.T) {
 		t.Fatalf("Last insterted id should be 2, not %d", lastID)
 	}
 }
+
+func TestAutoIncrementTruncate(t *testing.T) {
+
+	db, err := sql.Open("ramsql", "TestAutoIncrementTruncate")
+	if err != nil {
+		t.Fatalf("sql.Open : Error : %s\n", err)
+	}
+	defer db.Close()
+
+	_, err = db.Exec("CREATE TABLE account (id INT AUTOINCREMENT, email TEXT)")
+	if err != nil {
+		t.Fatalf("sql.Exec: Error: %s\n", err)
+	}
+
+	insert := func(expected int64) {
+		res, err := db.Exec("INSERT INTO account ('email') VALUES ('foo@bar.com')")
+		if err != nil {
+			t.Fatalf("Cannot insert into table account: %s", err)
+		}
+
+		lastID, err := res.LastInsertId()
+		if err != nil {
+			t.Fatalf("Cannot fetch last inserted id: %s\n", err)
+		}
+
+		if lastID != expected {
+			t.Fatalf("Last inserted id should be %d, not %d", expected, lastID)
+		}
+	}
+
+	insert(1)
+	insert(2)
+
+	// DELETE without WHERE clause keeps the counter
+	_, err = db.Exec("DELETE FROM account")
+	if err != nil {
+		t.Fatalf("Cannot delete from table account: %s", err)
+	}
+	insert(3)
+
+	// CONTINUE IDENTITY keeps the counter
+	_, err = db.Exec("TRUNCATE account CONTINUE IDENTITY")
+	if err != nil {
+		t.Fatalf("Cannot truncate table account: %s", err)
+	}
+	insert(4)
+
+	// TRUNCATE restarts the counter
+	res, err := db.Exec("TRUNCATE TABLE account")
+	if err != nil {
+		t.Fatalf("Cannot truncate table account: %s", err)
+	}
+	affectedRows, err := res.RowsAffected()
+	if err != nil {
+		t.Fatalf("Cannot fetch affected rows: %s", err)
+	}
+	if affectedRows != 1 {
+		t.Fatalf("Expected 1 row affected, got %d", affectedRows)
+	}
+	insert(1)
+
+	_, err = db.Exec("TRUNCATE account RESTART IDENTITY")
+	if err != nil {
+		t.Fatalf("Cannot truncate table account: %s", err)
+	}
+	insert(1)
+	insert(2)
+
+	// counter restarts from its START WITH value
+	_, err = db.Exec("CREATE TABLE s (id INT AUTOINCREMENT START WITH 100, email TEXT)")
+	if err != nil {
+		t.Fatalf("sql.Exec: Error: %s\n", err)
+	}
+	for _, q := range []string{
+		"INSERT INTO s (email) VALUES ('foo@bar.com')",
+		"INSERT INTO s (email) VALUES ('foo@bar.com')",
+		"TRUNCATE s RESTART IDENTITY",
+		"INSERT INTO s (email) VALUES ('foo@bar.com')",
+	} {
+		if _, err = db.Exec(q); err != nil {
+			t.Fatalf("sql.Exec: Error: %s\n", err)
+		}
+	}
+	var id int64
+	if err = db.QueryRow("SELECT id FROM s").Scan(&id); err != nil {
+		t.Fatalf("cannot query: %s", err)
+	}
+	if id != 100 {
+		t.Fatalf("expected id 100 after restart, got %d", id)
+	}
+}
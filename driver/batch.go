@@ -0,0 +1,88 @@
+package ramsql
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+
+	"github.com/proullon/ramsql/engine/executor"
+)
+
+// ExecBatch executes query once for each argument set of batch, on conn, and
+// returns the number of rows affected:
+//
+//	conn, err := db.Conn(ctx)
+//	...
+//	n, err := ramsql.ExecBatch(ctx, conn, `INSERT INTO t (a, b) VALUES ($1, $2)`, [][]any{{1, "a"}, {2, "b"}})
+//
+// Query is parsed once, and the batch runs as a single statement, in the
+// transaction of conn if any. If an execution fails, changes of the whole
+// batch are reverted.
+func ExecBatch(ctx context.Context, conn *sql.Conn, query string, batch [][]any) (int64, error) {
+	var n int64
+	err := conn.Raw(func(driverConn any) error {
+		c, ok := driverConn.(*Conn)
+		if !ok {
+			return fmt.Errorf("ExecBatch requires a ramsql connection, got %T", driverConn)
+		}
+
+		var err error
+		n, err = c.execBatch(ctx, query, batch)
+		return err
+	})
+
+	return n, err
+}
+
+// execBatch executes query for each argument set of batch, in a transaction
+// committed after the last one unless connection has one open
+func (c *Conn) execBatch(ctx context.Context, query string, batch [][]any) (int64, error) {
+	stmt, err := executor.Prepare(query)
+	if err != nil {
+		return 0, err
+	}
+
+	args := make([][]executor.NamedValue, len(batch))
+	for i, set := range batch {
+		args[i] = make([]executor.NamedValue, len(set))
+		for j, v := range set {
+			nv := driver.NamedValue{Ordinal: j + 1, Value: v}
+			if n, ok := v.(sql.NamedArg); ok {
+				nv.Name, nv.Value = n.Name, n.Value
+			}
+			if err := c.CheckNamedValue(&nv); err == driver.ErrSkip {
+				if nv.Value, err = driver.DefaultParameterConverter.ConvertValue(nv.Value); err != nil {
+					return 0, fmt.Errorf("batch[%d]: argument %d: %w", i, j+1, err)
+				}
+			} else if err != nil {
+				return 0, fmt.Errorf("batch[%d]: argument %d: %w", i, j+1, err)
+			}
+			args[i][j] = executor.NamedValue{Name: nv.Name, Ordinal: nv.Ordinal, Value: nv.Value}
+		}
+	}
+
+	tx := c.tx
+	autocommit := tx == nil
+	if autocommit {
+		tx, err = c.e.Begin()
+		if err != nil {
+			return 0, err
+		}
+		defer tx.Rollback()
+		tx.SetSession(c.session)
+	}
+
+	n, err := tx.ExecBatch(ctx, stmt, args)
+	if err != nil {
+		return 0, err
+	}
+
+	if autocommit {
+		if err := tx.Commit(); err != nil {
+			return 0, err
+		}
+	}
+
+	return n, nil
+}
@@ -4,7 +4,10 @@ import (
 	"context"
 	"database/sql"
 	"database/sql/driver"
+	"reflect"
+	"strings"
 
+	"github.com/proullon/ramsql/engine/agnostic"
 	"github.com/proullon/ramsql/engine/executor"
 	"github.com/proullon/ramsql/engine/log"
 )
@@ -32,27 +35,37 @@ import (
 type Conn struct {
 	e  *executor.Engine
 	tx *executor.Tx
+	// variables changed with SET, kept across transactions
+	session *executor.Session
 }
 
 func newConn(e *executor.Engine) *Conn {
-	return &Conn{e: e}
+	return &Conn{e: e, session: executor.NewSession()}
 }
 
-// Ping
+// Ping returns an error if the database engine was stopped or failed to
+// write its write-ahead log, or if ctx is done.
 //
 // If Conn.Ping returns ErrBadConn, DB.Ping and DB.PingContext will remove the Conn from pool.
 //
 // Implemented for Pinger interface
 func (c *Conn) Ping(ctx context.Context) error {
-	return nil
+	return c.e.Ping(ctx)
 }
 
 // ResetSession is called prior to executing a query on the connection
 // if the connection has been used before. If the driver returns ErrBadConn
 // the connection is discarded.
 //
+// A transaction left open on the connection is rolled back, so that its
+// changes, locks or error never leak into the next user of the connection.
+//
 // Implemented for SessionResetter interface
 func (c *Conn) ResetSession(ctx context.Context) error {
+	if c.tx != nil {
+		_ = c.tx.Rollback()
+		c.tx = nil
+	}
 	return nil
 }
 
@@ -64,14 +77,29 @@ func (c *Conn) IsValid() bool {
 	return true
 }
 
+// CheckNamedValue accepts Go slices, other than []byte, as array arguments,
+// like []string{"a", "b"} for a TEXT[] column. Other values are converted by
+// the default converter.
+//
+// Implemented for NamedValueChecker interface
+func (c *Conn) CheckNamedValue(nv *driver.NamedValue) error {
+	if _, ok := nv.Value.(agnostic.Array); ok {
+		return nil
+	}
+	if _, ok := nv.Value.(driver.Valuer); ok {
+		return driver.ErrSkip
+	}
+	if k := reflect.TypeOf(nv.Value); k != nil && k.Kind() == reflect.Slice && k.Elem().Kind() != reflect.Uint8 {
+		return nil
+	}
+	return driver.ErrSkip
+}
+
 // Prepare returns a prepared statement, bound to this connection.
 //
 // Implemented for Conn interface
 func (c *Conn) Prepare(query string) (driver.Stmt, error) {
-
-	stmt := prepareStatement(c, query)
-
-	return stmt, nil
+	return prepareStatement(c, query)
 }
 
 // Close invalidates and potentially stops any current
@@ -103,6 +131,7 @@ func (c *Conn) Begin() (driver.Tx, error) {
 	if err != nil {
 		return nil, err
 	}
+	tx.SetSession(c.session)
 	c.tx = tx
 	log.Debug("%p BEGIN", c.tx)
 	return c, nil
@@ -120,6 +149,7 @@ func (c *Conn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, e
 	if err != nil {
 		return nil, err
 	}
+	tx.SetSession(c.session)
 	c.tx = tx
 	log.Debug("%p BEGIN", c.tx)
 	return c, nil
@@ -149,6 +179,11 @@ func (c *Conn) Commit() error {
 //
 // Implemented for QueryerContext interface
 func (c *Conn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	return c.queryContext(ctx, query, nil, args)
+}
+
+// queryContext runs query, parsed in stmt if prepared
+func (c *Conn) queryContext(ctx context.Context, query string, stmt *executor.Statement, args []driver.NamedValue) (driver.Rows, error) {
 	var err error
 	autocommit := false
 
@@ -156,6 +191,14 @@ func (c *Conn) QueryContext(ctx context.Context, query string, args []driver.Nam
 
 	tx := c.tx
 
+	// liveness checks of connection pools skip transaction and planning
+	if tx == nil && len(args) == 0 && isSelectOne(query) {
+		if err := c.e.Ping(ctx); err != nil {
+			return nil, err
+		}
+		return newRows([]string{"?column?"}, nil, []*agnostic.Tuple{agnostic.NewTuple(int64(1))}, nil), nil
+	}
+
 	if tx == nil {
 		autocommit = true
 		tx, err = c.e.Begin()
@@ -163,6 +206,7 @@ func (c *Conn) QueryContext(ctx context.Context, query string, args []driver.Nam
 			return nil, err
 		}
 		defer tx.Rollback()
+		tx.SetSession(c.session)
 	}
 
 	a := make([]executor.NamedValue, len(args))
@@ -172,7 +216,13 @@ func (c *Conn) QueryContext(ctx context.Context, query string, args []driver.Nam
 		a[i].Value = arg.Value
 	}
 
-	cols, tuples, err := tx.QueryContext(ctx, query, a)
+	var cols []string
+	var tuples []*agnostic.Tuple
+	if stmt != nil {
+		cols, tuples, err = tx.QueryStatement(ctx, stmt, a)
+	} else {
+		cols, tuples, err = tx.QueryContext(ctx, query, a)
+	}
 	if err != nil {
 		return nil, err
 	}
@@ -184,19 +234,31 @@ func (c *Conn) QueryContext(ctx context.Context, query string, args []driver.Nam
 		}
 	}
 
-	return newRows(cols, tuples), nil
+	return newRows(cols, tx.ColumnAttributes(), tuples, c.session.Location()), nil
 }
 
 // ExecContext is the sql package prefered way to run Exec
 //
 // Implemented for ExecerContext interface
 func (c *Conn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	return c.execContext(ctx, query, nil, args)
+}
+
+// execContext runs query, parsed in stmt if prepared
+func (c *Conn) execContext(ctx context.Context, query string, stmt *executor.Statement, args []driver.NamedValue) (driver.Result, error) {
 	var err error
 	autocommit := false
 	log.Info("Conn.ExecContext: %s", query)
 
 	tx := c.tx
 
+	if tx == nil && len(args) == 0 && isSelectOne(query) {
+		if err := c.e.Ping(ctx); err != nil {
+			return nil, err
+		}
+		return &Result{}, nil
+	}
+
 	if tx == nil {
 		autocommit = true
 		tx, err = c.e.Begin()
@@ -204,6 +266,7 @@ func (c *Conn) ExecContext(ctx context.Context, query string, args []driver.Name
 			return nil, err
 		}
 		defer tx.Rollback()
+		tx.SetSession(c.session)
 	}
 
 	a := make([]executor.NamedValue, len(args))
@@ -214,7 +277,11 @@ func (c *Conn) ExecContext(ctx context.Context, query string, args []driver.Name
 	}
 
 	r := &Result{}
-	r.lastInsertedID, r.rowsAffected, r.err = tx.ExecContext(ctx, query, a)
+	if stmt != nil {
+		r.lastInsertedID, r.rowsAffected, r.err = tx.ExecStatement(ctx, stmt, a)
+	} else {
+		r.lastInsertedID, r.rowsAffected, r.err = tx.ExecContext(ctx, query, a)
+	}
 	if r.err != nil {
 		return r, r.err
 	}
@@ -228,3 +295,11 @@ func (c *Conn) ExecContext(ctx context.Context, query string, args []driver.Name
 
 	return r, r.err
 }
+
+// isSelectOne returns true if query is SELECT 1, as issued by connection
+// pools to check a connection is alive
+func isSelectOne(query string) bool {
+	q := strings.TrimSuffix(strings.TrimSpace(query), ";")
+	fields := strings.Fields(q)
+	return len(fields) == 2 && strings.EqualFold(fields[0], "select") && fields[1] == "1"
+}
@@ -0,0 +1,243 @@
+package ramsql
+
+import (
+	"database/sql"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/proullon/ramsql/engine/agnostic"
+)
+
+// CSVOptions configures CSV export of a result set and CSV import into a relation
+type CSVOptions struct {
+	// Null is written for NULL values. Default is the empty string.
+	Null string
+	// Comma is the field delimiter. Default is ','.
+	Comma rune
+	// NoHeader is set if first record is data instead of column names.
+	// Default is to write and expect a header.
+	NoHeader bool
+	// SkipMalformed makes import skip records which cannot be converted
+	// to relation attributes, instead of failing.
+	SkipMalformed bool
+}
+
+// WithCSVNull sets the string written for NULL values
+func WithCSVNull(null string) func(*CSVOptions) {
+	return func(o *CSVOptions) {
+		o.Null = null
+	}
+}
+
+// WithCSVComma sets the field delimiter
+func WithCSVComma(comma rune) func(*CSVOptions) {
+	return func(o *CSVOptions) {
+		o.Comma = comma
+	}
+}
+
+// WithCSVNoHeader disables the header record
+func WithCSVNoHeader() func(*CSVOptions) {
+	return func(o *CSVOptions) {
+		o.NoHeader = true
+	}
+}
+
+// WithCSVSkipMalformed makes import skip malformed records
+func WithCSVSkipMalformed() func(*CSVOptions) {
+	return func(o *CSVOptions) {
+		o.SkipMalformed = true
+	}
+}
+
+// WriteCSV writes all remaining rows to w as CSV, as described in RFC 4180.
+// First record is the header, made of column names, unless configured with
+// WithCSVNoHeader.
+//
+// Timestamps are formatted as RFC 3339 and NULL values as empty fields,
+// unless configured with WithCSVNull.
+func WriteCSV(w io.Writer, rows *sql.Rows, options ...func(*CSVOptions)) error {
+	opts := CSVOptions{Comma: ','}
+	for _, f := range options {
+		f(&opts)
+	}
+
+	cols, err := rows.Columns()
+	if err != nil {
+		return err
+	}
+
+	cw := csv.NewWriter(w)
+	cw.Comma = opts.Comma
+	if !opts.NoHeader {
+		if err := cw.Write(cols); err != nil {
+			return err
+		}
+	}
+
+	values := make([]any, len(cols))
+	dest := make([]any, len(cols))
+	for i := range values {
+		dest[i] = &values[i]
+	}
+	record := make([]string, len(cols))
+
+	for rows.Next() {
+		if err := rows.Scan(dest...); err != nil {
+			return err
+		}
+		for i, v := range values {
+			record[i] = csvField(v, opts.Null)
+		}
+		if err := cw.Write(record); err != nil {
+			return err
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	cw.Flush()
+	return cw.Error()
+}
+
+func csvField(v any, null string) string {
+	switch v := v.(type) {
+	case nil:
+		return null
+	case []byte:
+		return string(v)
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case time.Time:
+		return v.Format(time.RFC3339Nano)
+	default:
+		return fmt.Sprintf("%v", v)
+	}
+}
+
+// ImportCSV inserts into relation the records read from r as CSV, as described
+// in RFC 4180, and returns the number of inserted rows.
+//
+// Header record names the columns of each field. Without header, records must
+// list a value for every relation attribute, in declaration order.
+// Fields are converted to the type of their attribute, empty fields being NULL
+// unless configured with WithCSVNull.
+//
+// A record which cannot be read or converted aborts the import with an error
+// reporting its line, unless configured with WithCSVSkipMalformed. Rows are
+// inserted within tx, so a failing import can be rolled back as a whole.
+func ImportCSV(tx *sql.Tx, relation string, r io.Reader, options ...func(*CSVOptions)) (int64, error) {
+	opts := CSVOptions{Comma: ','}
+	for _, f := range options {
+		f(&opts)
+	}
+
+	rows, err := tx.Query(fmt.Sprintf("SELECT * FROM %s LIMIT 0", relation))
+	if err != nil {
+		return 0, err
+	}
+	types, err := rows.ColumnTypes()
+	rows.Close()
+	if err != nil {
+		return 0, err
+	}
+	attrs := make(map[string]*sql.ColumnType)
+	for _, t := range types {
+		attrs[strings.ToLower(t.Name())] = t
+	}
+
+	cr := csv.NewReader(r)
+	cr.Comma = opts.Comma
+	cr.ReuseRecord = true
+	cr.FieldsPerRecord = -1
+
+	var cols []*sql.ColumnType
+	if opts.NoHeader {
+		cols = types
+	} else {
+		header, err := cr.Read()
+		if err != nil {
+			return 0, fmt.Errorf("cannot read CSV header: %w", err)
+		}
+		for _, name := range header {
+			t, ok := attrs[strings.ToLower(strings.TrimSpace(name))]
+			if !ok {
+				return 0, fmt.Errorf("attribute %s does not exist in relation %s", name, relation)
+			}
+			cols = append(cols, t)
+		}
+	}
+
+	names := make([]string, len(cols))
+	placeholders := make([]string, len(cols))
+	for i, c := range cols {
+		names[i] = c.Name()
+		placeholders[i] = fmt.Sprintf("$%d", i+1)
+	}
+	query := fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s)", relation, strings.Join(names, ", "), strings.Join(placeholders, ", "))
+
+	var n int64
+	args := make([]any, len(cols))
+	for {
+		record, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		var line int
+		var perr *csv.ParseError
+		if errors.As(err, &perr) {
+			line = perr.StartLine
+		} else {
+			line, _ = cr.FieldPos(0)
+		}
+		if err == nil && len(record) != len(cols) {
+			err = fmt.Errorf("expected %d fields, got %d", len(cols), len(record))
+		}
+		if err == nil {
+			err = csvValues(args, cols, record, opts.Null)
+		}
+		if err != nil {
+			if opts.SkipMalformed {
+				continue
+			}
+			return n, fmt.Errorf("line %d: %w", line, err)
+		}
+
+		if _, err := tx.Exec(query, args...); err != nil {
+			return n, fmt.Errorf("line %d: %w", line, err)
+		}
+		n++
+	}
+
+	return n, nil
+}
+
+// csvValues converts record fields to the type of their column
+func csvValues(args []any, cols []*sql.ColumnType, record []string, null string) error {
+	for i, field := range record {
+		if field == null {
+			args[i] = nil
+			continue
+		}
+		if cols[i].ScanType().Kind() == reflect.String {
+			args[i] = field
+			continue
+		}
+		v, err := agnostic.ToInstance(field, strings.ToLower(cols[i].DatabaseTypeName()))
+		if err != nil {
+			return fmt.Errorf("cannot convert '%s' for attribute %s: %w", field, cols[i].Name(), err)
+		}
+		args[i] = v
+	}
+
+	return nil
+}
@@ -4,6 +4,8 @@ import (
 	"database/sql"
 	"database/sql/driver"
 	"errors"
+	"fmt"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -12,8 +14,11 @@ import (
 	"github.com/proullon/ramsql/engine/log"
 )
 
+// drv is the driver registered as "ramsql"
+var drv = NewDriver()
+
 func init() {
-	sql.Register("ramsql", NewDriver())
+	sql.Register("ramsql", drv)
 	log.SetLevel(log.WarningLevel)
 }
 
@@ -45,6 +50,10 @@ type connConf struct {
 	Password string
 	User     string
 	Timeout  time.Duration
+	// path of write-ahead log, if any
+	WAL string
+	// maximum number of rows of a relation, 0 if unlimited
+	MaxRows int64
 }
 
 // Open return an active connection so RamSQL engine
@@ -54,7 +63,7 @@ func (rs *Driver) Open(dsn string) (conn driver.Conn, err error) {
 	rs.Lock()
 	defer rs.Unlock()
 
-	_, err = parseConnectionURI(dsn)
+	conf, err := parseConnectionURI(dsn)
 	if err != nil {
 		return nil, err
 	}
@@ -66,6 +75,13 @@ func (rs *Driver) Open(dsn string) (conn driver.Conn, err error) {
 			return nil, err
 		}
 
+		if conf.WAL != "" {
+			if err := e.OpenWAL(conf.WAL); err != nil {
+				return nil, err
+			}
+		}
+		e.SetMaxRows(conf.MaxRows)
+
 		rs.engines[dsn] = e
 
 		return newConn(e), nil
@@ -74,6 +90,145 @@ func (rs *Driver) Open(dsn string) (conn driver.Conn, err error) {
 	return newConn(dsnengine), err
 }
 
+// ResetDB drops every schema, relation and sequence of the database opened
+// with data source name dsn, as if it was just created. Connections to it
+// stay valid. Resetting a database never opened is a no-op.
+func ResetDB(dsn string) error {
+	return drv.ResetDB(dsn)
+}
+
+// ResetDB drops every schema, relation and sequence of the database opened
+// with data source name dsn.
+func (rs *Driver) ResetDB(dsn string) error {
+	rs.Lock()
+	e, ok := rs.engines[dsn]
+	rs.Unlock()
+	if !ok {
+		return nil
+	}
+
+	return e.Reset()
+}
+
+// SetClock makes the database opened with data source name dsn read current
+// time from clock, for NOW(), CURRENT_TIMESTAMP, CURRENT_DATE and default
+// timestamps, so tests can assert on them. A nil clock restores the real
+// clock.
+func SetClock(dsn string, clock func() time.Time) error {
+	drv.Lock()
+	e, ok := drv.engines[dsn]
+	drv.Unlock()
+	if !ok {
+		return fmt.Errorf("database %s does not exist", dsn)
+	}
+
+	e.SetClock(clock)
+	return nil
+}
+
+// SetMaxRows limits the number of rows of each relation of the database
+// opened with data source name dsn to n, so a runaway test fails instead of
+// exhausting memory. 0 removes the limit, as does the default.
+func SetMaxRows(dsn string, n int64) error {
+	drv.Lock()
+	e, ok := drv.engines[dsn]
+	drv.Unlock()
+	if !ok {
+		return fmt.Errorf("database %s does not exist", dsn)
+	}
+
+	e.SetMaxRows(n)
+	return nil
+}
+
+// Snapshot is a copy of a database taken by SnapshotDB, from which
+// independent databases can be restored.
+type Snapshot struct {
+	e *executor.Engine
+}
+
+// SnapshotDB copies every schema, sequence, relation, row and index of the
+// database opened with data source name dsn. Changes made to the database
+// afterwards are not seen by the snapshot.
+func SnapshotDB(dsn string) (*Snapshot, error) {
+	return drv.SnapshotDB(dsn)
+}
+
+// SnapshotDB copies the database opened with data source name dsn
+func (rs *Driver) SnapshotDB(dsn string) (*Snapshot, error) {
+	rs.Lock()
+	e, ok := rs.engines[dsn]
+	rs.Unlock()
+	if !ok {
+		return nil, fmt.Errorf("database %s does not exist", dsn)
+	}
+
+	c, err := e.Clone()
+	if err != nil {
+		return nil, err
+	}
+
+	return &Snapshot{e: c}, nil
+}
+
+// Restore creates a database with data source name dsn from a copy of the
+// snapshot. If dsn is already opened, its content is replaced and its
+// connections stay valid. A snapshot can be restored any number of times,
+// restored databases are independent from each other.
+func (s *Snapshot) Restore(dsn string) error {
+	return drv.restore(s, dsn)
+}
+
+func (rs *Driver) restore(s *Snapshot, dsn string) error {
+	rs.Lock()
+	defer rs.Unlock()
+
+	if e, ok := rs.engines[dsn]; ok {
+		return e.Replace(s.e)
+	}
+
+	e, err := s.e.Clone()
+	if err != nil {
+		return err
+	}
+	rs.engines[dsn] = e
+	return nil
+}
+
+// SaveDB writes the database opened with data source name dsn to file at
+// path, to be loaded back with LoadDB. Unlike a SQL dump, the exact state of
+// the database is saved, and loading it does not replay any statement.
+func SaveDB(dsn, path string) error {
+	drv.Lock()
+	e, ok := drv.engines[dsn]
+	drv.Unlock()
+	if !ok {
+		return fmt.Errorf("database %s does not exist", dsn)
+	}
+
+	return e.SaveTo(path)
+}
+
+// LoadDB loads the database saved at path by SaveDB under data source name
+// dsn. If dsn is already opened, its content is replaced and its connections
+// stay valid.
+func LoadDB(dsn, path string) error {
+	l, err := executor.LoadEngine(path)
+	if err != nil {
+		return err
+	}
+
+	drv.Lock()
+	defer drv.Unlock()
+
+	if e, ok := drv.engines[dsn]; ok {
+		return e.Replace(l)
+	}
+
+	drv.engines[dsn] = l
+	return nil
+}
+
 // The uri need to have the following syntax:
 //
 //	[PROTOCOL_SPECFIIC*]DBNAME/USER/PASSWD
@@ -96,6 +251,15 @@ func (rs *Driver) Open(dsn string) (conn driver.Conn, err error) {
 //
 //	laddr   - local address/port (eg. 1.2.3.4:0)
 //	timeout - connect timeout in format accepted by time.ParseDuration
+//
+// Engine options can follow, after a question mark, in form:
+//
+//	DBNAME?opt1=VAL1&opt2=VAL2
+//
+// Currently implemented engine options:
+//
+//	wal - path of write-ahead log file. Log is replayed when the database is
+//	      first opened, then every committed transaction is appended to it.
 func parseConnectionURI(uri string) (*connConf, error) {
 	c := &connConf{}
 
@@ -104,6 +268,25 @@ func parseConnectionURI(uri string) (*connConf, error) {
 		uri = "default"
 	}
 
+	if i := strings.LastIndex(uri, "?"); i >= 0 {
+		for _, o := range strings.Split(uri[i+1:], "&") {
+			kv := strings.SplitN(o, "=", 2)
+			switch {
+			case len(kv) == 2 && kv[0] == "wal" && kv[1] != "":
+				c.WAL = kv[1]
+			case len(kv) == 2 && kv[0] == "max_rows":
+				n, err := strconv.ParseInt(kv[1], 10, 64)
+				if err != nil || n < 0 {
+					return nil, errors.New("Invalid value for option max_rows: " + kv[1])
+				}
+				c.MaxRows = n
+			default:
+				return nil, errors.New("Unknown option: " + o)
+			}
+		}
+		uri = uri[:i]
+	}
+
 	pd := strings.SplitN(uri, "*", 2)
 	if len(pd) == 2 {
 		// Parse protocol part of URI
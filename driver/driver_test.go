@@ -3,9 +3,16 @@ package ramsql
 import (
 	"context"
 	"database/sql"
+	"database/sql/driver"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"os"
+	"path/filepath"
 	"reflect"
+	"sort"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -202,7 +209,9 @@ func TestSelectCamelCase(t *testing.T) {
 	if err == nil {
 		t.Fatalf("expected attribute not found error")
 	}
-	ee := "attribute not defined: account.nope"
+	ee := "attribute not defined: account.nope\n" +
+		"LINE 1: SELECT TestCamelCase, nope, email_snake FROM account WHERE 1\n" +
+		"                              ^"
 	if err.Error() != ee {
 		t.Fatalf("expected error to be '%s', got '%s'", ee, err.Error())
 	}
@@ -1757,951 +1766,8483 @@ func TestInsertMultipleReturning(t *testing.T) {
 	}
 }
 
+func TestPlaceholders(t *testing.T) {
+
+	db, err := sql.Open("ramsql", "TestPlaceholders")
+	if err != nil {
+		t.Fatalf("sql.Open : Error : %s\n", err)
+	}
+	defer db.Close()
+
+	_, err = db.Exec("CREATE TABLE account (id INT, email TEXT)")
+	if err != nil {
+		t.Fatalf("sql.Exec: Error: %s\n", err)
+	}
+
+	_, err = db.Exec("INSERT INTO account (id, email) VALUES (?, ?), (?, ?), ($5, $6)", 1, "a@b.c", 2, "d@e.f", 3, "g@h.i")
+	if err != nil {
+		t.Fatalf("cannot insert with placeholders: %s", err)
+	}
+
+	var email string
+	err = db.QueryRow("SELECT email FROM account WHERE id = ? AND email = ?", 2, "d@e.f").Scan(&email)
+	if err != nil {
+		t.Fatalf("cannot select with ? placeholders: %s", err)
+	}
+	if email != "d@e.f" {
+		t.Fatalf("expected d@e.f, got %s", email)
+	}
+
+	err = db.QueryRow("SELECT email FROM account WHERE id = $2 OR id = $1 ORDER BY id DESC LIMIT 1", 1, 3).Scan(&email)
+	if err != nil {
+		t.Fatalf("cannot select with $ placeholders: %s", err)
+	}
+	if email != "g@h.i" {
+		t.Fatalf("expected g@h.i, got %s", email)
+	}
+
+	var count int
+	err = db.QueryRow("SELECT COUNT(*) FROM account WHERE id IN (?, ?)", 1, 3).Scan(&count)
+	if err != nil {
+		t.Fatalf("cannot select with IN placeholders: %s", err)
+	}
+	if count != 2 {
+		t.Fatalf("expected 2 rows, got %d", count)
+	}
+
+	rows, err := db.Query("SELECT id FROM account ORDER BY id ASC LIMIT ? OFFSET ?", 1, 1)
+	if err != nil {
+		t.Fatalf("cannot select with LIMIT and OFFSET placeholders: %s", err)
+	}
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err = rows.Scan(&id); err != nil {
+			t.Fatalf("rows.Scan: %s", err)
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if len(ids) != 1 || ids[0] != 2 {
+		t.Fatalf("expected [2], got %v", ids)
+	}
+
+	// a value containing a placeholder marker is not interpreted
+	_, err = db.Exec("UPDATE account SET email = $1 WHERE id = $2", "x' OR '1'='1", 1)
+	if err != nil {
+		t.Fatalf("cannot update with placeholders: %s", err)
+	}
+	err = db.QueryRow("SELECT COUNT(*) FROM account WHERE email = $1", "x' OR '1'='1").Scan(&count)
+	if err != nil {
+		t.Fatalf("cannot select: %s", err)
+	}
+	if count != 1 {
+		t.Fatalf("expected 1 row, got %d", count)
+	}
+
+	// argument count is validated
+	_, err = db.Query("SELECT email FROM account WHERE id = ?")
+	if err == nil {
+		t.Fatalf("expected error with missing argument")
+	}
+	_, err = db.Query("SELECT email FROM account WHERE id = $2", 1)
+	if err == nil {
+		t.Fatalf("expected error with missing argument")
+	}
+	_, err = db.Query("SELECT email FROM account WHERE id = $1", 1, 2)
+	if err == nil {
+		t.Fatalf("expected error with unused argument")
+	}
+}
+
+func TestNamedPlaceholders(t *testing.T) {
+
+	db, err := sql.Open("ramsql", "TestNamedPlaceholders")
+	if err != nil {
+		t.Fatalf("sql.Open : Error : %s\n", err)
+	}
+	defer db.Close()
+
+	_, err = db.Exec("CREATE TABLE account (id INT, email TEXT)")
+	if err != nil {
+		t.Fatalf("sql.Exec: Error: %s\n", err)
+	}
+
+	_, err = db.Exec("INSERT INTO account (id, email) VALUES (:id, @email)", sql.Named("id", 1), sql.Named("email", "a@b.c"))
+	if err != nil {
+		t.Fatalf("cannot insert with named placeholders: %s", err)
+	}
+
+	_, err = db.Exec("UPDATE account SET email = $email WHERE id = $id", sql.Named("id", 1), sql.Named("email", "d@e.f"))
+	if err != nil {
+		t.Fatalf("cannot update with named placeholders: %s", err)
+	}
+
+	var email string
+	err = db.QueryRow("SELECT email FROM account WHERE id = @id", sql.Named("id", 1)).Scan(&email)
+	if err != nil {
+		t.Fatalf("cannot select with named placeholders: %s", err)
+	}
+	if email != "d@e.f" {
+		t.Fatalf("expected d@e.f, got %s", email)
+	}
+
+	stmt, err := db.Prepare("SELECT email FROM account WHERE id = :id AND email = :email")
+	if err != nil {
+		t.Fatalf("cannot prepare statement: %s", err)
+	}
+	defer stmt.Close()
+	err = stmt.QueryRow(sql.Named("email", "d@e.f"), sql.Named("id", 1)).Scan(&email)
+	if err != nil {
+		t.Fatalf("cannot query prepared statement with named placeholders: %s", err)
+	}
+
+	queries := []struct {
+		query string
+		args  []any
+	}{
+		{"SELECT email FROM account WHERE id = @id AND email = $1", []any{sql.Named("id", 1), "d@e.f"}},
+		{"SELECT email FROM account WHERE id = @id", []any{sql.Named("user_id", 1)}},
+		{"SELECT email FROM account WHERE id = @id", []any{1}},
+		{"SELECT email FROM account WHERE id = @id", []any{sql.Named("id", 1), sql.Named("email", "d@e.f")}},
+	}
+	for _, q := range queries {
+		if _, err = db.Query(q.query, q.args...); err == nil {
+			t.Fatalf("expected error with query %s and args %v", q.query, q.args)
+		}
+	}
+}
+
+func TestQueryContextCancel(t *testing.T) {
+
+	db, err := sql.Open("ramsql", "TestQueryContextCancel")
+	if err != nil {
+		t.Fatalf("sql.Open : Error : %s\n", err)
+	}
+	defer db.Close()
+
+	batch := []string{
+		`CREATE TABLE account (id BIGSERIAL PRIMARY KEY, group_id INT)`,
+		`CREATE TABLE grp (id BIGSERIAL PRIMARY KEY, group_id INT)`,
+	}
+	for _, b := range batch {
+		if _, err = db.Exec(b); err != nil {
+			t.Fatalf("sql.Exec: Error: %s\n", err)
+		}
+	}
+
+	// large tables, so a join without usable index takes a while
+	for _, table := range []string{"account", "grp"} {
+		for i := 0; i < 30; i++ {
+			var values []string
+			for j := 0; j < 100; j++ {
+				values = append(values, fmt.Sprintf("(%d)", j))
+			}
+			q := "INSERT INTO " + table + " (group_id) VALUES " + strings.Join(values, ", ")
+			if _, err = db.Exec(q); err != nil {
+				t.Fatalf("sql.Exec: Error: %s\n", err)
+			}
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, err = db.QueryContext(ctx, `SELECT account.id, grp.id FROM account JOIN grp ON account.group_id = grp.group_id`)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected context.DeadlineExceeded, got %v", err)
+	}
+	if d := time.Since(start); d > time.Second {
+		t.Fatalf("query took %s after context deadline", d)
+	}
+
+	// locks are released, tables are still usable
+	var count int
+	if err = db.QueryRow(`SELECT COUNT(*) FROM account`).Scan(&count); err != nil {
+		t.Fatalf("cannot count accounts: %s", err)
+	}
+	if count != 3000 {
+		t.Fatalf("expected 3000 accounts, got %d", count)
+	}
+}
+
+func TestInsertMultipleAtomic(t *testing.T) {
+
+	db, err := sql.Open("ramsql", "TestInsertMultipleAtomic")
+	if err != nil {
+		t.Fatalf("sql.Open : Error : %s\n", err)
+	}
+	defer db.Close()
+
+	_, err = db.Exec("CREATE TABLE champion (id BIGINT PRIMARY KEY, user_id INT, name TEXT)")
+	if err != nil {
+		t.Fatalf("sql.Exec: Error: %s\n", err)
+	}
+
+	res, err := db.Exec("INSERT INTO champion (id, user_id, name) VALUES (1, 1, 'a'), (2, 2, 'b'), (3, 3, 'c')")
+	if err != nil {
+		t.Fatalf("cannot insert rows: %s", err)
+	}
+	if n, _ := res.RowsAffected(); n != 3 {
+		t.Fatalf("expected 3 rows affected, got %d", n)
+	}
+
+	queries := []string{
+		// primary key violation on last row
+		"INSERT INTO champion (id, user_id, name) VALUES (4, 4, 'd'), (5, 5, 'e'), (1, 6, 'f')",
+		// primary key violation between rows of the statement
+		"INSERT INTO champion (id, user_id, name) VALUES (4, 4, 'd'), (4, 5, 'e')",
+		// invalid last row
+		"INSERT INTO champion (id, user_id, name) VALUES (4, 4, 'd'), (5, 5)",
+	}
+	for _, q := range queries {
+		if _, err = db.Exec(q); err == nil {
+			t.Fatalf("expected error with query %s", q)
+		}
+
+		var count int
+		if err = db.QueryRow("SELECT COUNT(*) FROM champion").Scan(&count); err != nil {
+			t.Fatalf("cannot count champions: %s", err)
+		}
+		if count != 3 {
+			t.Fatalf("expected 3 champions after failed query %s, got %d", q, count)
+		}
+	}
+}
+
+func TestInsertSelect(t *testing.T) {
+
+	db, err := sql.Open("ramsql", "TestInsertSelect")
+	if err != nil {
+		t.Fatalf("sql.Open : Error : %s\n", err)
+	}
+	defer db.Close()
+
+	batch := []string{
+		`CREATE TABLE champion (id BIGSERIAL PRIMARY KEY, user_id INT, name TEXT)`,
+		`CREATE TABLE archive (id BIGINT PRIMARY KEY, user_id INT, name TEXT)`,
+		`CREATE TABLE names (name TEXT UNIQUE)`,
+		`INSERT INTO champion (user_id, name) VALUES (1, 'Ahri'), (1, 'Nami'), (2, 'Jinx')`,
+	}
+	for _, b := range batch {
+		if _, err = db.Exec(b); err != nil {
+			t.Fatalf("sql.Exec: Error: %s\n", err)
+		}
+	}
+
+	res, err := db.Exec(`INSERT INTO archive SELECT * FROM champion WHERE user_id = 1`)
+	if err != nil {
+		t.Fatalf("cannot insert from select: %s", err)
+	}
+	if n, _ := res.RowsAffected(); n != 2 {
+		t.Fatalf("expected 2 inserted rows, got %d", n)
+	}
+
+	var count int
+	if err = db.QueryRow(`SELECT COUNT(*) FROM archive WHERE user_id = 1`).Scan(&count); err != nil {
+		t.Fatalf("cannot count archive: %s", err)
+	}
+	if count != 2 {
+		t.Fatalf("expected 2 archived rows, got %d", count)
+	}
+
+	if _, err = db.Exec(`INSERT INTO names (name) SELECT name FROM champion`); err != nil {
+		t.Fatalf("cannot insert from select with column list: %s", err)
+	}
+
+	// column count mismatch
+	if _, err = db.Exec(`INSERT INTO names (name) SELECT id, name FROM champion`); err == nil {
+		t.Fatalf("expected error on column count mismatch")
+	}
+
+	// constraint violation aborts the whole statement
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatalf("cannot begin: %s", err)
+	}
+	if _, err = tx.Exec(`INSERT INTO archive SELECT * FROM champion`); err == nil {
+		t.Fatalf("expected primary key violation")
+	}
+	tx.Rollback()
+
+	if err = db.QueryRow(`SELECT COUNT(*) FROM archive`).Scan(&count); err != nil {
+		t.Fatalf("cannot count archive: %s", err)
+	}
+	if count != 2 {
+		t.Fatalf("expected 2 archived rows after rollback, got %d", count)
+	}
+}
+
+func TestInsertOnConflict(t *testing.T) {
+
+	db, err := sql.Open("ramsql", "TestInsertOnConflict")
+	if err != nil {
+		t.Fatalf("sql.Open : Error : %s\n", err)
+	}
+	defer db.Close()
+
+	batch := []string{
+		`CREATE TABLE account (id BIGINT PRIMARY KEY, email TEXT UNIQUE, age INT)`,
+		`INSERT INTO account (id, email, age) VALUES (1, 'x@y.z', 21)`,
+	}
+	for _, b := range batch {
+		if _, err = db.Exec(b); err != nil {
+			t.Fatalf("sql.Exec: Error: %s\n", err)
+		}
+	}
+
+	res, err := db.Exec(`INSERT INTO account (id, email, age) VALUES (1, 'new@y.z', 22), (2, 'a@b.c', 30) ON CONFLICT (id) DO UPDATE SET email = excluded.email, age = 40`)
+	if err != nil {
+		t.Fatalf("cannot upsert: %s", err)
+	}
+	if n, _ := res.RowsAffected(); n != 2 {
+		t.Fatalf("expected 2 rows affected, got %d", n)
+	}
+
+	var email string
+	var age int
+	if err = db.QueryRow(`SELECT email, age FROM account WHERE id = 1`).Scan(&email, &age); err != nil {
+		t.Fatalf("cannot select account: %s", err)
+	}
+	if email != "new@y.z" || age != 40 {
+		t.Fatalf("expected (new@y.z, 40), got (%s, %d)", email, age)
+	}
+
+	res, err = db.Exec(`INSERT INTO account (id, email, age) VALUES (3, 'a@b.c', 50), (4, 'd@e.f', 60) ON CONFLICT DO NOTHING`)
+	if err != nil {
+		t.Fatalf("cannot insert with DO NOTHING: %s", err)
+	}
+	if n, _ := res.RowsAffected(); n != 1 {
+		t.Fatalf("expected 1 row affected, got %d", n)
+	}
+
+	var count int
+	if err = db.QueryRow(`SELECT COUNT(*) FROM account`).Scan(&count); err != nil {
+		t.Fatalf("cannot count accounts: %s", err)
+	}
+	if count != 3 {
+		t.Fatalf("expected 3 accounts, got %d", count)
+	}
+
+	// conflict on a constraint other than the target still fails
+	if _, err = db.Exec(`INSERT INTO account (id, email) VALUES (5, 'a@b.c') ON CONFLICT (id) DO NOTHING`); err == nil {
+		t.Fatalf("expected unicity violation on email")
+	}
+
+	if _, err = db.Exec(`INSERT INTO account (id, email) VALUES (6, 'g@h.i') ON CONFLICT (age) DO NOTHING`); err == nil {
+		t.Fatalf("expected error on conflict target without unique constraint")
+	}
+}
+
+func TestReturningColumns(t *testing.T) {
+
+	db, err := sql.Open("ramsql", "TestReturningColumns")
+	if err != nil {
+		t.Fatalf("sql.Open : Error : %s\n", err)
+	}
+	defer db.Close()
+
+	_, err = db.Exec("CREATE TABLE account (id BIGSERIAL PRIMARY KEY, email TEXT, age INT)")
+	if err != nil {
+		t.Fatalf("sql.Exec: Error: %s\n", err)
+	}
+
+	var id int64
+	var email string
+	var age int64
+	err = db.QueryRow("INSERT INTO account (email, age) VALUES ('x@y.z', 21) RETURNING id, email").Scan(&id, &email)
+	if err != nil {
+		t.Fatalf("Cannot insert into table account: %s", err)
+	}
+	if id != 1 || email != "x@y.z" {
+		t.Fatalf("Expected (1, x@y.z), got (%d, %s)", id, email)
+	}
+
+	err = db.QueryRow("INSERT INTO account (email, age) VALUES ('a@b.c', 42) RETURNING *").Scan(&id, &email, &age)
+	if err != nil {
+		t.Fatalf("Cannot insert into table account: %s", err)
+	}
+	if id != 2 || email != "a@b.c" || age != 42 {
+		t.Fatalf("Expected (2, a@b.c, 42), got (%d, %s, %d)", id, email, age)
+	}
+
+	rows, err := db.Query("UPDATE account SET age = 22 WHERE email = 'x@y.z' RETURNING age, id")
+	if err != nil {
+		t.Fatalf("Cannot update table account: %s", err)
+	}
+	cols, err := rows.Columns()
+	if err != nil {
+		t.Fatalf("rows.Columns: %s", err)
+	}
+	if len(cols) != 2 || cols[0] != "age" || cols[1] != "id" {
+		t.Fatalf("Expected columns [age id], got %v", cols)
+	}
+	n := 0
+	for rows.Next() {
+		if err = rows.Scan(&age, &id); err != nil {
+			t.Fatalf("rows.Scan: %s", err)
+		}
+		if age != 22 || id != 1 {
+			t.Fatalf("Expected (22, 1), got (%d, %d)", age, id)
+		}
+		n++
+	}
+	rows.Close()
+	if n != 1 {
+		t.Fatalf("Expected 1 updated row, got %d", n)
+	}
+
+	rows, err = db.Query("DELETE FROM account WHERE age > 30 RETURNING email")
+	if err != nil {
+		t.Fatalf("Cannot delete from table account: %s", err)
+	}
+	n = 0
+	for rows.Next() {
+		if err = rows.Scan(&email); err != nil {
+			t.Fatalf("rows.Scan: %s", err)
+		}
+		if email != "a@b.c" {
+			t.Fatalf("Expected a@b.c, got %s", email)
+		}
+		n++
+	}
+	rows.Close()
+	if n != 1 {
+		t.Fatalf("Expected 1 deleted row, got %d", n)
+	}
+
+	_, err = db.Query("DELETE FROM account RETURNING nope")
+	if err == nil {
+		t.Fatalf("Expected error returning unknown column")
+	}
+
+	res, err := db.Exec("UPDATE account SET age = 23 RETURNING id")
+	if err != nil {
+		t.Fatalf("Cannot update table account: %s", err)
+	}
+	if ra, _ := res.RowsAffected(); ra != 1 {
+		t.Fatalf("Expected 1 row affected, got %d", ra)
+	}
+}
+
 func TestJoinOrderBy(t *testing.T) {
 
-	db, err := sql.Open("ramsql", "TestJoinOrderBy")
+	db, err := sql.Open("ramsql", "TestJoinOrderBy")
+	if err != nil {
+		t.Fatalf("sql.Open: %s", err)
+	}
+	defer db.Close()
+
+	init := []string{
+		`CREATE TABLE user (id BIGSERIAL, name TEXT)`,
+		`CREATE TABLE address (id BIGSERIAL, user_id INT, value TEXT)`,
+		`INSERT INTO user (name) VALUES ($$riri$$)`,
+		`INSERT INTO user (name) VALUES ($$fifi$$)`,
+		`INSERT INTO user (name) VALUES ($$loulou$$)`,
+		`INSERT INTO address (user_id, value) VALUES (1, 'rue du puit')`,
+		`INSERT INTO address (user_id, value) VALUES (1, 'rue du désert')`,
+		`INSERT INTO address (user_id, value) VALUES (3, 'rue du chemin')`,
+		`INSERT INTO address (user_id, value) VALUES (2, 'boulevard du con')`,
+	}
+	for _, q := range init {
+		_, err := db.Exec(q)
+		if err != nil {
+			t.Fatalf("Cannot initialize test: %s", err)
+		}
+	}
+
+	query := `SELECT user.name, address.value
+			FROM user
+			JOIN address ON address.user_id = user.id
+			WHERE user.id = $1
+			ORDER BY address.value ASC`
+	rows, err := db.Query(query, 1)
+	if err != nil {
+		t.Fatalf("Cannot select with joined order by: %s", err)
+	}
+	defer rows.Close()
+
+	n := 0
+	for rows.Next() {
+		n++
+	}
+	if n != 2 {
+		t.Fatalf("Expected 2 rows, got %d", n)
+	}
+}
+
+func TestMultipleJoin(t *testing.T) {
+
+	db, err := sql.Open("ramsql", "TestMultipleJoin")
+	if err != nil {
+		t.Fatalf("sql.Open: %s", err)
+	}
+	defer db.Close()
+
+	init := []string{
+		`CREATE TABLE user (id BIGSERIAL, name TEXT)`,
+		`CREATE TABLE address (id BIGSERIAL, user_id INT, value TEXT)`,
+		`CREATE TABLE user_group (id BIGSERIAL, user_id INT, name TEXT)`,
+		`INSERT INTO user (name) VALUES ($$riri$$)`,
+		`INSERT INTO user (name) VALUES ($$fifi$$)`,
+		`INSERT INTO user (name) VALUES ($$loulou$$)`,
+		`INSERT INTO user (name) VALUES ("foo")`,
+		`INSERT INTO user (name) VALUES ("bar")`,
+		`INSERT INTO user (name) VALUES ("baz")`,
+		`INSERT INTO address (user_id, value) VALUES (1, 'rue du puit')`,
+		`INSERT INTO address (user_id, value) VALUES (1, 'rue du désert')`,
+		`INSERT INTO address (user_id, value) VALUES (3, 'rue du chemin')`,
+		`INSERT INTO address (user_id, value) VALUES (2, 'boulevard du con')`,
+		`INSERT INTO address (user_id, value) VALUES (2, 'boulevard du fion')`,
+		`INSERT INTO address (user_id, value) VALUES (2, 'boulevard du rond')`,
+		`INSERT INTO address (user_id, value) VALUES (3, 'boulevard du don')`,
+		`INSERT INTO address (user_id, value) VALUES (4, 'boulevard du son')`,
+		`INSERT INTO address (user_id, value) VALUES (5, 'boulevard du mont')`,
+		`INSERT INTO address (user_id, value) VALUES (6, 'boulevard du non')`,
+		`INSERT INTO user_group (user_id, name) VALUES (1, 'toto')`,
+		`INSERT INTO user_group (user_id, name) VALUES (2, 'toto')`,
+		`INSERT INTO user_group (user_id, name) VALUES (3, 'lonely')`,
+		`INSERT INTO user_group (user_id, name) VALUES (1, 'cowboy')`,
+	}
+	for _, q := range init {
+		_, err := db.Exec(q)
+		if err != nil {
+			t.Fatalf("Cannot initialize test: %s", err)
+		}
+	}
+
+	query := `SELECT user.name, address.value
+			FROM user
+			JOIN address ON address.user_id = user.id
+			JOIN user_group ON user_group.user_id = address.user_id
+			WHERE user_group.name = $1
+			ORDER BY address.value ASC`
+	rows, err := db.Query(query, "toto")
+	if err != nil {
+		t.Fatalf("Cannot select with 3 tables joined: %s", err)
+	}
+	defer rows.Close()
+
+	n := 0
+	for rows.Next() {
+		n++
+	}
+	if n != 5 {
+		t.Fatalf("Expected 5 rows, got %d", n)
+	}
+
+}
+
+func TestJoinGroup(t *testing.T) {
+
+	db, err := sql.Open("ramsql", "TestJoinGroup")
+	if err != nil {
+		t.Fatalf("sql.Open: %s", err)
+	}
+	defer db.Close()
+
+	init := []string{
+		`CREATE TABLE user (id BIGSERIAL, name TEXT)`,
+		`CREATE TABLE group (id BIGSERIAL, name TEXT)`,
+		`CREATE TABLE user_group (id BIGSERIAL, user_id INT, group_id INT)`,
+		`INSERT INTO user (name) VALUES ($$riri$$)`,
+		`INSERT INTO user (name) VALUES ($$fifi$$)`,
+		`INSERT INTO user (name) VALUES ($$loulou$$)`,
+		`INSERT INTO group (name) VALUES ('cowboys')`,
+		`INSERT INTO group (name) VALUES ('troopers')`,
+		`INSERT INTO group (name) VALUES ('toys')`,
+		`INSERT INTO user_group (user_id, group_id) VALUES (1, 1)`,
+		`INSERT INTO user_group (user_id, group_id) VALUES (2, 1)`,
+	}
+	for _, q := range init {
+		_, err := db.Exec(q)
+		if err != nil {
+			t.Fatalf("Cannot initialize test: %s", err)
+		}
+	}
+
+	query := `SELECT user.name FROM user
+			JOIN user_group ON user.id = user_group.user_id
+			WHERE user_group.group_id = $1
+			ORDER BY user.name ASC`
+	rows, err := db.Query(query, 1)
+	if err != nil {
+		t.Fatalf("Cannot select joined: %s", err)
+	}
+	defer rows.Close()
+
+	n := 0
+	for rows.Next() {
+		n++
+	}
+	if n != 2 {
+		t.Fatalf("Expected 2 rows, got %d", n)
+	}
+
+}
+
+func TestOrderByInt(t *testing.T) {
+
+	db, err := sql.Open("ramsql", "TestOrderByInt")
+	if err != nil {
+		t.Fatalf("sql.Open : Error : %s\n", err)
+	}
+	defer db.Close()
+
+	batch := []string{
+		`CREATE TABLE user (name TEXT, surname TEXT, age INT);`,
+		`INSERT INTO user (name, surname, age) VALUES (Foo, Bar, 20);`,
+		`INSERT INTO user (name, surname, age) VALUES (John, Doe, 32);`,
+		`INSERT INTO user (name, surname, age) VALUES (Jane, Doe, 33);`,
+		`INSERT INTO user (name, surname, age) VALUES (Joe, Doe, 10);`,
+		`INSERT INTO user (name, surname, age) VALUES (Homer, Simpson, 40);`,
+		`INSERT INTO user (name, surname, age) VALUES (Marge, Simpson, 40);`,
+		`INSERT INTO user (name, surname, age) VALUES (Bruce, Wayne, 3333);`,
+	}
+
+	for _, b := range batch {
+		_, err = db.Exec(b)
+		if err != nil {
+			t.Fatalf("sql.Exec: Error: %s", err)
+		}
+	}
+
+	query := `SELECT age FROM user WHERE surname = Wayne OR surname = Doe ORDER BY age DESC`
+	rows, err := db.Query(query)
+	if err != nil {
+		t.Fatalf("Cannot select and order by age: %s", err)
+	}
+	defer rows.Close()
+
+	var age, last, size int64
+	last = 4000
+	// Now every time 'age' should be less than 'last'
+	for rows.Next() {
+		err = rows.Scan(&age)
+		if err != nil {
+			t.Fatalf("Cannot scan age: %s", err)
+		}
+		if age > last {
+			t.Fatalf("Got %d previously and now %d", last, age)
+		}
+		last = age
+		size++
+	}
+
+	if size != 4 {
+		t.Fatalf("Expecting 4 rows here, got %d", size)
+	}
+
+	query = `SELECT age FROM user ORDER BY age ASC`
+	rows, err = db.Query(query)
+	if err != nil {
+		t.Fatalf("cannot order by age: %s\n", err)
+	}
+
+	size = 0
+	last = 0
+	// Now 'last' should be less than current 'age'
+	for rows.Next() {
+		err = rows.Scan(&age)
+		if err != nil {
+			t.Fatalf("Cannot scan age: %s", err)
+		}
+		if last > age {
+			t.Fatalf("Got %d previously and now %d", last, age)
+		}
+		last = age
+		size++
+	}
+
+	if size != 7 {
+		t.Fatalf("Expecting 7 rows, got %d", size)
+	}
+}
+
+func TestOrderByString(t *testing.T) {
+
+	db, err := sql.Open("ramsql", "TestOrderByString")
+	if err != nil {
+		t.Fatalf("sql.Open : Error : %s\n", err)
+	}
+	defer db.Close()
+
+	batch := []string{
+		`CREATE TABLE user (name TEXT, surname TEXT, age INT);`,
+		`INSERT INTO user (name, surname, age) VALUES (Foo, Bar, 20);`,
+		`INSERT INTO user (name, surname, age) VALUES (John, Doe, 32);`,
+		`INSERT INTO user (name, surname, age) VALUES (Jane, Doe, 33);`,
+		`INSERT INTO user (name, surname, age) VALUES (Joe, Doe, 10);`,
+		`INSERT INTO user (name, surname, age) VALUES (Homer, Simpson, 40);`,
+		`INSERT INTO user (name, surname, age) VALUES (Marge, Simpson, 40);`,
+		`INSERT INTO user (name, surname, age) VALUES (Bruce, Wayne, 3333);`,
+	}
+
+	for _, b := range batch {
+		_, err = db.Exec(b)
+		if err != nil {
+			t.Fatalf("sql.Exec: Error: %s", err)
+		}
+	}
+
+	query := `SELECT name, surname FROM user WHERE surname = $1 ORDER BY name ASC`
+	rows, err := db.Query(query, "Doe")
+	if err != nil {
+		t.Fatalf("Cannot select and order by age: %s", err)
+	}
+
+	var names []string
+	var name, surname string
+	for rows.Next() {
+		err = rows.Scan(&name, &surname)
+		if err != nil {
+			t.Fatalf("Cannot scan row: %s\n", err)
+		}
+		if surname != "Doe" {
+			t.Fatalf("Didn't expect surname being %s", surname)
+		}
+		names = append(names, name)
+	}
+
+	if len(names) != 3 {
+		t.Fatalf("Expected 3 rows, not %d", len(names))
+	}
+
+	if names[0] != "Jane" {
+		t.Fatalf("Wanted Jane, got %s", names[0])
+	}
+
+	if names[1] != "Joe" {
+		t.Fatalf("Wanted Joe, got %s", names[1])
+	}
+
+	if names[2] != "John" {
+		t.Fatalf("Wanted John, got %s", names[2])
+	}
+
+}
+
+func TestOrderByLimit(t *testing.T) {
+
+	db, err := sql.Open("ramsql", "TestOrderByLimit")
+	if err != nil {
+		t.Fatalf("sql.Open : Error : %s\n", err)
+	}
+	defer db.Close()
+
+	batch := []string{
+		`CREATE TABLE user (name TEXT, surname TEXT, age INT);`,
+		`INSERT INTO user (name, surname, age) VALUES (Foo, Bar, 20);`,
+		`INSERT INTO user (name, surname, age) VALUES (John, Doe, 32);`,
+		`INSERT INTO user (name, surname, age) VALUES (Jane, Doe, 33);`,
+		`INSERT INTO user (name, surname, age) VALUES (Joe, Doe, 10);`,
+		`INSERT INTO user (name, surname, age) VALUES (Homer, Simpson, 40);`,
+		`INSERT INTO user (name, surname, age) VALUES (Marge, Simpson, 40);`,
+		`INSERT INTO user (name, surname, age) VALUES (Bruce, Wayne, 3333);`,
+	}
+
+	for _, b := range batch {
+		_, err = db.Exec(b)
+		if err != nil {
+			t.Fatalf("sql.Exec: Error: %s", err)
+		}
+	}
+
+	query := `SELECT age FROM user WHERE 1=1 ORDER BY age DESC LIMIT 2`
+	rows, err := db.Query(query)
+	if err != nil {
+		t.Fatalf("Cannot limit select: %s", err)
+	}
+
+	var age, last, size int64
+	last = 4000
+	// Now every time 'age' should be less than 'last'
+	for rows.Next() {
+		err = rows.Scan(&age)
+		if err != nil {
+			t.Fatalf("Cannot scan age: %s", err)
+		}
+		if age > last {
+			t.Fatalf("Got %d previously and now %d", last, age)
+		}
+		last = age
+		size++
+	}
+
+	if size != 2 {
+		t.Fatalf("Expecting 2 rows here, got %d", size)
+	}
+}
+
+func TestOrderByIntEmpty(t *testing.T) {
+
+	db, err := sql.Open("ramsql", "TestOrderByIntEmpty")
+	if err != nil {
+		t.Fatalf("sql.Open : Error : %s\n", err)
+	}
+	defer db.Close()
+
+	batch := []string{
+		`CREATE TABLE user (name TEXT, surname TEXT, age INT);`,
+	}
+
+	for _, b := range batch {
+		_, err = db.Exec(b)
+		if err != nil {
+			t.Fatalf("sql.Exec: Error: %s", err)
+		}
+	}
+
+	query := `SELECT age FROM user WHERE surname = Wayne OR surname = Doe ORDER BY age DESC`
+	rows, err := db.Query(query)
+	if err != nil {
+		t.Fatalf("Cannot select and order by age: %s", err)
+	}
+	defer rows.Close()
+
+}
+
+func TestOrderByMultipleStrings(t *testing.T) {
+
+	db, err := sql.Open("ramsql", "TestOrderByMultipleStrings")
+	if err != nil {
+		t.Fatalf("sql.Open : Error : %s\n", err)
+	}
+
+	defer func() {
+		if err := db.Close(); err != nil {
+			t.Error(err)
+		}
+	}()
+
+	batch := []string{
+		`CREATE TABLE user (name TEXT, surname TEXT, age BIGINT, savings DECIMAL);`,
+		`INSERT INTO user (name, surname, age, savings) VALUES (Joe, Angel, 11, 125.215);`,
+		`INSERT INTO user (name, surname, age, savings) VALUES (Joe, Angel, 11, 1.1);`,
+		`INSERT INTO user (name, surname, age, savings) VALUES (Joe, Zebra, 32, 0.921);`,
+		`INSERT INTO user (name, surname, age, savings) VALUES (Anna, Angel, 33, 0);`,
+		`INSERT INTO user (name, surname, age, savings) VALUES (Anna, Zebra, 9, 25);`,
+	}
+
+	for _, b := range batch {
+		_, err = db.Exec(b)
+		if err != nil {
+			t.Fatalf("sql.Exec: Error: %s", err)
+		}
+	}
+
+	query := `SELECT name, surname, age, savings FROM user ORDER BY name ASC, age DESC, savings ASC`
+	rows, err := db.Query(query)
+	if err != nil {
+		t.Fatalf("Cannot select and order by age: %s", err)
+	}
+
+	exp := [][]string{
+		{"Anna", "33", "0"},
+		{"Anna", "9", "25"},
+		{"Joe", "32", "0.921"},
+		{"Joe", "11", "1.1"},
+		{"Joe", "11", "125.215"},
+	}
+	var (
+		got           [][]string
+		name, surname string
+		age           int64
+		savings       float64
+	)
+	for rows.Next() {
+		err = rows.Scan(&name, &surname, &age, &savings)
+		if err != nil {
+			t.Fatalf("Cannot scan row: %s\n", err)
+		}
+		got = append(got, []string{name, fmt.Sprint(age), fmt.Sprint(savings)})
+	}
+
+	if len(exp) != len(got) {
+		t.Fatalf("length mismatch, expected %d but got %d", len(exp), len(got))
+	}
+	for i := 0; i < len(exp); i++ {
+		for j := 0; j < len(exp[i]); j++ {
+			if exp[i][j] != got[i][j] {
+				t.Fatalf("data mismatch at %d/%d, expected %v but got %v", i, j, exp[i][j], got[i][j])
+			}
+		}
+	}
+}
+
+func TestSelectNoOp(t *testing.T) {
+	log.SetLevel(log.WarningLevel)
+
+	db, err := sql.Open("ramsql", "TestSelectNoOp")
+	if err != nil {
+		t.Fatalf("sql.Open : Error : %s\n", err)
+	}
+	defer db.Close()
+
+	batch := []string{
+		`CREATE TABLE account (id BIGSERIAL, email TEXT)`,
+		`INSERT INTO account (email) VALUES ("foo@bar.com")`,
+		`INSERT INTO account (email) VALUES ("bar@bar.com")`,
+		`INSERT INTO account (email) VALUES ("foobar@bar.com")`,
+		`INSERT INTO account (email) VALUES ("babar@bar.com")`,
+	}
+
+	for _, b := range batch {
+		_, err = db.Exec(b)
+		if err != nil {
+			t.Fatalf("sql.Exec: Error: %s\n", err)
+		}
+	}
+
+	query := `SELECT * from account WHERE 1 = 1`
+	rows, err := db.Query(query)
+	if err != nil {
+		t.Fatalf("cannot create table: %s", err)
+	}
+
+	nb := 0
+	for rows.Next() {
+		nb++
+	}
+
+	if nb != 4 {
+		t.Fatalf("Expected 4 rows, got %d", nb)
+	}
+
+}
+
+func TestSelect(t *testing.T) {
+	db, err := sql.Open("ramsql", "TestSelect")
+	if err != nil {
+		t.Fatalf("sql.Open : Error : %s\n", err)
+	}
+	defer db.Close()
+
+	_, err = db.Exec("CREATE TABLE account (id INT, email TEXT)")
+	if err != nil {
+		t.Fatalf("sql.Exec: Error: %s\n", err)
+	}
+
+	_, err = db.Exec("INSERT INTO account ('id', 'email') VALUES (2, 'bar@bar.com')")
+	if err != nil {
+		t.Fatalf("Cannot insert into table account: %s", err)
+	}
+
+	_, err = db.Exec("INSERT INTO account ('id', 'email') VALUES (1, 'foo@bar.com')")
+	if err != nil {
+		t.Fatalf("Cannot insert into table account: %s", err)
+	}
+
+	rows, err := db.Query("SELECT * FROM account WHERE email = $1", "foo@bar.com")
+	if err != nil {
+		t.Fatalf("sql.Query error : %s", err)
+	}
+
+	columns, err := rows.Columns()
+	if err != nil {
+		t.Fatalf("rows.Column : %s", err)
+		return
+	}
+
+	if len(columns) != 2 {
+		t.Fatalf("Expected 2 columns, got %d", len(columns))
+	}
+
+	row := db.QueryRow("SELECT * FROM account WHERE email = $1", "foo@bar.com")
+	if row == nil {
+		t.Fatalf("sql.QueryRow error")
+	}
+
+	var email string
+	var id int
+	err = row.Scan(&id, &email)
+	if err != nil {
+		t.Fatalf("row.Scan: %s", err)
+	}
+
+	if id != 1 {
+		t.Fatalf("Expected id = 1, got %d", id)
+	}
+
+	if email != "foo@bar.com" {
+		t.Fatalf("Expected email = <foo@bar.com>, got <%s>", email)
+	}
+
+	err = db.Close()
+	if err != nil {
+		t.Fatalf("sql.Close : Error : %s\n", err)
+	}
+
+}
+
+func TestCount(t *testing.T) {
+	db, err := sql.Open("ramsql", "TestCount")
+	if err != nil {
+		t.Fatalf("sql.Open : Error : %s\n", err)
+	}
+	defer db.Close()
+
+	batch := []string{
+		`CREATE TABLE account (id BIGSERIAL, email TEXT)`,
+		`INSERT INTO account (email) VALUES ("foo@bar.com")`,
+		`INSERT INTO account (email) VALUES ("bar@bar.com")`,
+		`INSERT INTO account (email) VALUES ("foobar@bar.com")`,
+		`INSERT INTO account (email) VALUES ("babar@bar.com")`,
+	}
+
+	for _, b := range batch {
+		_, err = db.Exec(b)
+		if err != nil {
+			t.Fatalf("sql.Exec: Error: %s\n", err)
+		}
+	}
+
+	var count int64
+	err = db.QueryRow(`SELECT COUNT(*) FROM account WHERE 1=1`).Scan(&count)
+	if err != nil {
+		t.Fatalf("cannot select COUNT of account: %s\n", err)
+	}
+
+	if count != 4 {
+		t.Fatalf("Expected count to be 4, not %d", count)
+	}
+
+	err = db.QueryRow(`SELECT COUNT(i_dont_exist_lol) FROM account WHERE 1=1`).Scan(&count)
+	if err == nil {
+		t.Fatalf("Expected an error from a non existing attribute")
+	}
+
+}
+
+func TestUpdateSimple(t *testing.T) {
+
+	db, err := sql.Open("ramsql", "TestUpdateSimple")
+	if err != nil {
+		t.Fatalf("sql.Open : Error : %s\n", err)
+	}
+	defer db.Close()
+
+	_, err = db.Exec("CREATE TABLE account (id INT AUTOINCREMENT, email TEXT)")
+	if err != nil {
+		t.Fatalf("sql.Exec: Error: %s\n", err)
+	}
+
+	_, err = db.Exec("INSERT INTO account ('email') VALUES ('foo@bar.com')")
+	if err != nil {
+		t.Fatalf("Cannot insert into table account: %s", err)
+	}
+
+	_, err = db.Exec("INSERT INTO account ('email') VALUES ('leon@bar.com')")
+	if err != nil {
+		t.Fatalf("Cannot insert into table account: %s", err)
+	}
+
+	_, err = db.Exec("UPDATE account SET email = 'roger@gmail.com' WHERE id = 2")
+	if err != nil {
+		t.Fatalf("Cannot update table account: %s", err)
+	}
+
+	row := db.QueryRow("SELECT * FROM account WHERE id = 2")
+	if row == nil {
+		t.Fatalf("sql.Query failed")
+	}
+
+	var email string
+	var id int
+	err = row.Scan(&id, &email)
+	if err != nil {
+		t.Fatalf("row.Scan: %s", err)
+	}
+
+	if email != "roger@gmail.com" {
+		t.Fatalf("Expected email 'roger@gmail.com', got '%s'", email)
+	}
+}
+
+func TestUpdateIsNull(t *testing.T) {
+
+	db, err := sql.Open("ramsql", "TestUpdateIsNull")
+	if err != nil {
+		t.Fatalf("sql.Open : Error : %s\n", err)
+	}
+	defer db.Close()
+
+	_, err = db.Exec("CREATE TABLE account (id INT AUTOINCREMENT, email TEXT, creation_date TIMESTAMP WITH TIME ZONE DEFAULT NULL)")
+	if err != nil {
+		t.Fatalf("sql.Exec: Error: %s\n", err)
+	}
+
+	_, err = db.Exec("INSERT INTO account ('email') VALUES ('foo@bar.com')")
+	if err != nil {
+		t.Fatalf("Cannot insert into table account: %s", err)
+	}
+
+	_, err = db.Exec("INSERT INTO account ('email') VALUES ('leon@bar.com')")
+	if err != nil {
+		t.Fatalf("Cannot insert into table account: %s", err)
+	}
+
+	res, err := db.Exec("UPDATE account SET email = 'roger@gmail.com', creation_date = $1 WHERE id = 2 AND creation_date IS NULL", time.Now())
+	if err != nil {
+		t.Fatalf("Cannot update table account: %s", err)
+	}
+
+	ra, err := res.RowsAffected()
+	if err != nil {
+		t.Fatalf("Cannot check number of rows affected: %s", err)
+	}
+	if ra != 1 {
+		t.Fatalf("Expected 1 row, affected. Got %d", ra)
+	}
+
+	rows, err := db.Query(`SELECT id FROM account WHERE creation_date IS NULL`)
+	if err != nil {
+		t.Fatalf("cannot select null columns: %s", err)
+	}
+
+	var n, id int64
+	for rows.Next() {
+		n++
+		err = rows.Scan(&id)
+		if err != nil {
+			t.Fatalf("cannot scan null columns: %s", err)
+		}
+	}
+	rows.Close()
+	if n != 1 {
+		t.Fatalf("Expected 1 rows, got %d", n)
+	}
+
+	rows, err = db.Query(`SELECT id FROM account WHERE creation_date IS NOT NULL`)
+	if err != nil {
+		t.Fatalf("cannot select not null columns: %s", err)
+	}
+
+	n = 0
+	for rows.Next() {
+		n++
+		err = rows.Scan(&id)
+		if err != nil {
+			t.Fatalf("cannot scan null columns: %s", err)
+		}
+	}
+	rows.Close()
+	if n != 1 {
+		t.Fatalf("Expected 1 rows, got %d", n)
+	}
+
+}
+
+func TestUpdateNotNull(t *testing.T) {
+
+	db, err := sql.Open("ramsql", "TestUpdateNotNull")
+	if err != nil {
+		t.Fatalf("sql.Open : Error : %s\n", err)
+	}
+	defer db.Close()
+
+	_, err = db.Exec("CREATE TABLE account (id INT AUTOINCREMENT, email TEXT, creation_date TIMESTAMP WITH TIME ZONE DEFAULT NOW())")
+	if err != nil {
+		t.Fatalf("sql.Exec: Error: %s\n", err)
+	}
+
+	_, err = db.Exec("INSERT INTO account ('email') VALUES ('foo@bar.com')")
+	if err != nil {
+		t.Fatalf("Cannot insert into table account: %s", err)
+	}
+
+	_, err = db.Exec("INSERT INTO account ('email') VALUES ('leon@bar.com')")
+	if err != nil {
+		t.Fatalf("Cannot insert into table account: %s", err)
+	}
+
+	_, err = db.Exec("UPDATE account SET email = 'roger@gmail.com' WHERE id = 2 AND creation_date IS NOT NULL")
+	if err != nil {
+		t.Fatalf("Cannot update table account: %s", err)
+	}
+
+}
+
+func TestUpdateToNull(t *testing.T) {
+
+	db, err := sql.Open("ramsql", "TestUpdateToNull")
+	if err != nil {
+		t.Fatalf("sql.Open : Error : %s\n", err)
+	}
+	defer db.Close()
+
+	_, err = db.Exec("CREATE TABLE account (id INT AUTOINCREMENT, email TEXT, creation_date TIMESTAMP WITH TIME ZONE DEFAULT NOW())")
+	if err != nil {
+		t.Fatalf("sql.Exec: Error: %s\n", err)
+	}
+
+	_, err = db.Exec("INSERT INTO account ('email') VALUES ('foo@bar.com')")
+	if err != nil {
+		t.Fatalf("Cannot insert into table account: %s", err)
+	}
+
+	row1 := db.QueryRow("SELECT email FROM account WHERE id = 1")
+	if row1 == nil {
+		t.Fatalf("sql.Query failed")
+	}
+
+	var email1 *string
+	err = row1.Scan(&email1)
+	if err != nil {
+		t.Fatalf("row.Scan: %s", err)
+	}
+	if email1 == nil {
+		t.Fatalf("expected 'foo@bar.com' email, but got NULL")
+	}
+
+	_, err = db.Exec("UPDATE account SET email = NULL WHERE id = 1")
+	if err != nil {
+		t.Fatalf("Cannot update table account: %s", err)
+	}
+
+	row2 := db.QueryRow("SELECT email FROM account WHERE id = 1")
+	if row2 == nil {
+		t.Fatalf("sql.Query failed")
+	}
+
+	var email2 sql.NullString
+	err = row2.Scan(&email2)
+	if err != nil {
+		t.Fatalf("row.Scan: %s", err)
+	}
+	if email2.Valid == true {
+		t.Fatalf("expected NULL email, but got '%v'", email2.String)
+	}
+
+}
+
+func TestUpdateWhere(t *testing.T) {
+
+	db, err := sql.Open("ramsql", "TestUpdateWhere")
+	if err != nil {
+		t.Fatalf("sql.Open : Error : %s\n", err)
+	}
+	defer db.Close()
+
+	batch := []string{
+		`CREATE TABLE champion (id BIGSERIAL PRIMARY KEY, user_id INT, name TEXT UNIQUE)`,
+		`CREATE INDEX champion_user_id_idx ON champion (user_id)`,
+		`INSERT INTO champion (user_id, name) VALUES (1, 'zed')`,
+		`INSERT INTO champion (user_id, name) VALUES (1, 'lulu')`,
+		`INSERT INTO champion (user_id, name) VALUES (2, 'thresh')`,
+	}
+	for _, b := range batch {
+		_, err = db.Exec(b)
+		if err != nil {
+			t.Fatalf("sql.Exec: Error: %s\n", err)
+		}
+	}
+
+	res, err := db.Exec(`UPDATE champion SET user_id = 3 WHERE user_id = 1`)
+	if err != nil {
+		t.Fatalf("cannot update champion: %s", err)
+	}
+	aff, err := res.RowsAffected()
+	if err != nil {
+		t.Fatalf("cannot fetch rows affected: %s", err)
+	}
+	if aff != 2 {
+		t.Fatalf("expected 2 rows affected, got %d", aff)
+	}
+
+	var n int
+	err = db.QueryRow(`SELECT COUNT(*) FROM champion WHERE user_id = 3`).Scan(&n)
+	if err != nil {
+		t.Fatalf("sql.Query: %s", err)
+	}
+	if n != 2 {
+		t.Fatalf("expected 2 rows with user_id 3, got %d", n)
+	}
+
+	// rollback restores previous values
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatalf("cannot begin transaction: %s", err)
+	}
+	_, err = tx.Exec(`UPDATE champion SET name = 'janna' WHERE user_id = 2`)
+	if err != nil {
+		t.Fatalf("cannot update champion: %s", err)
+	}
+	err = tx.Rollback()
+	if err != nil {
+		t.Fatalf("cannot rollback: %s", err)
+	}
+	err = db.QueryRow(`SELECT COUNT(*) FROM champion WHERE name = 'thresh'`).Scan(&n)
+	if err != nil {
+		t.Fatalf("sql.Query: %s", err)
+	}
+	if n != 1 {
+		t.Fatalf("expected name to be restored after rollback, got %d rows", n)
+	}
+
+	// unique and primary key collisions are rejected
+	_, err = db.Exec(`UPDATE champion SET name = 'zed' WHERE user_id = 2`)
+	if err == nil {
+		t.Fatalf("expected unique violation")
+	}
+	_, err = db.Exec(`UPDATE champion SET id = 1 WHERE id = 2`)
+	if err == nil {
+		t.Fatalf("expected primary key violation")
+	}
+	err = db.QueryRow(`SELECT COUNT(*) FROM champion WHERE id = 2`).Scan(&n)
+	if err != nil {
+		t.Fatalf("sql.Query: %s", err)
+	}
+	if n != 1 {
+		t.Fatalf("expected row 2 to be kept, got %d rows", n)
+	}
+}
+
+func TestDeleteRollback(t *testing.T) {
+
+	db, err := sql.Open("ramsql", "TestDeleteRollback")
+	if err != nil {
+		t.Fatalf("sql.Open : Error : %s\n", err)
+	}
+	defer db.Close()
+
+	batch := []string{
+		`CREATE TABLE champion (id BIGSERIAL PRIMARY KEY, user_id INT, name TEXT)`,
+		`INSERT INTO champion (user_id, name) VALUES (1, 'zed')`,
+		`INSERT INTO champion (user_id, name) VALUES (2, 'lulu')`,
+		`INSERT INTO champion (user_id, name) VALUES (2, 'thresh')`,
+	}
+	for _, b := range batch {
+		_, err = db.Exec(b)
+		if err != nil {
+			t.Fatalf("sql.Exec: Error: %s\n", err)
+		}
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatalf("cannot begin transaction: %s", err)
+	}
+	res, err := tx.Exec(`DELETE FROM champion WHERE user_id = 2`)
+	if err != nil {
+		t.Fatalf("cannot delete: %s", err)
+	}
+	aff, err := res.RowsAffected()
+	if err != nil {
+		t.Fatalf("cannot fetch rows affected: %s", err)
+	}
+	if aff != 2 {
+		t.Fatalf("expected 2 rows affected, got %d", aff)
+	}
+	res, err = tx.Exec(`DELETE FROM champion`)
+	if err != nil {
+		t.Fatalf("cannot delete: %s", err)
+	}
+	aff, err = res.RowsAffected()
+	if err != nil {
+		t.Fatalf("cannot fetch rows affected: %s", err)
+	}
+	if aff != 1 {
+		t.Fatalf("expected 1 row affected, got %d", aff)
+	}
+	err = tx.Rollback()
+	if err != nil {
+		t.Fatalf("cannot rollback: %s", err)
+	}
+
+	var n int
+	err = db.QueryRow(`SELECT COUNT(*) FROM champion WHERE user_id = 2`).Scan(&n)
+	if err != nil {
+		t.Fatalf("sql.Query: %s", err)
+	}
+	if n != 2 {
+		t.Fatalf("expected 2 rows restored, got %d", n)
+	}
+
+	var name string
+	err = db.QueryRow(`SELECT name FROM champion WHERE id = 1`).Scan(&name)
+	if err != nil {
+		t.Fatalf("sql.Query: %s", err)
+	}
+	if name != "zed" {
+		t.Fatalf("expected zed, got %s", name)
+	}
+}
+
+func TestDeadlock(t *testing.T) {
+	db, err := sql.Open("ramsql", "TestDeadlock")
+	if err != nil {
+		t.Fatalf("cannot open db: %s", err)
+	}
+	defer db.Close()
+	if err := db.Ping(); err != nil {
+		t.Fatalf("cannot ping db: %s", err)
+	}
+	if _, err := db.Exec("CREATE TABLE address (id int, street text)"); err != nil {
+		t.Fatalf("cannot create table: %s", err)
+	}
+
+	stmt, err := db.Prepare("insert into address (id,street) values (?,?)")
+	if err != nil {
+		t.Fatalf("cannot prepare statement: %s", err)
+	}
+
+	for i := 0; i < 10; i++ {
+		if _, err := stmt.Exec(i, fmt.Sprintf("%d park ave", 100+i)); err != nil { // ERROR
+			t.Fatalf("cannot exec %dnt statement: %s", i, err)
+		}
+	}
+}
+
+func TestNamedArg(t *testing.T) {
+
+	db, err := sql.Open("ramsql", "TestNamedArg2")
+	if err != nil {
+		t.Fatalf("cannot open db: %s", err)
+	}
+	defer db.Close()
+
+	var name string
+
+	_, err = db.Exec(`CREATE TABLE people (id BIGSERIAL PRIMARY KEY, name TEXT, surname TEXT, age INT)`)
+	if err != nil {
+		t.Fatalf("cannot create table: %s", err)
+	}
+
+	_, err = db.ExecContext(context.TODO(), "INSERT INTO people (id,name,surname,age) VALUES (?,?,?,?)", 1234, "Ramone", "Juz", 12)
+	if err != nil {
+		t.Fatalf("cannot exec context: %s", err)
+	}
+
+	err = db.QueryRowContext(context.TODO(), "select p.name from people as p where p.id = :id;", sql.Named("id", 1234)).Scan(&name)
+	if err != nil {
+		t.Fatalf("cannot query context: %s", err)
+	}
+
+}
+
+func TestScanTimestamp(t *testing.T) {
+	db, err := sql.Open("ramsql", "TestScanTimestamp")
+	if err != nil {
+		t.Fatalf("cannot open db: %s", err)
+	}
+	defer db.Close()
+
+	query := `
+	  CREATE TABLE IF NOT EXISTS properties (
+			id         VARCHAR(36)  PRIMARY KEY,
+			street     VARCHAR(255),
+			city       VARCHAR(32),
+			state      VARCHAR(32),
+			zip        VARCHAR(10),
+			created_at TIMESTAMPTZ
+		)
+	`
+	_, err = db.Exec(query)
+	if err != nil {
+		t.Fatalf("cannot create table: %s", err)
+	}
+
+	id := "OIJOIJ"
+	query = `INSERT INTO properties (id, street, city, state, zip, created_at) VALUES ($1, $2, $3, $4, $5, NOW())`
+	_, err = db.Exec(query, id, "5th", "NY", "NY", "NY")
+	if err != nil {
+		t.Fatalf("cannot insert into table: %s", err)
+	}
+
+	p := struct {
+		ID        string
+		Street    string
+		City      string
+		StateCode string
+		Zip       string
+		CreatedAt time.Time
+	}{}
+
+	query = `
+		SELECT id, street, city, state, zip, created_at
+		FROM properties WHERE id = $1
+	`
+
+	ctx := context.Background()
+	err = db.QueryRowContext(ctx, query, id).Scan(
+		&p.ID, &p.Street, &p.City,
+		&p.StateCode, &p.Zip, &p.CreatedAt,
+	)
+	if err != nil {
+		t.Fatalf("cannot scan in struct: %s", err)
+	}
+	if p.CreatedAt.IsZero() {
+		t.Fatalf("CreatedAt should not be 0")
+	}
+}
+
+func TestPrimaryKeyConstraint(t *testing.T) {
+
+	db, err := sql.Open("ramsql", "TestPrimaryKeyConstraint")
+	if err != nil {
+		t.Fatalf("sql.Open: %s", err)
+	}
+	defer db.Close()
+
+	_, err = db.Exec(`CREATE TABLE test (a INT, b TEXT, PRIMARY KEY(a, b))`)
+	if err != nil {
+		t.Fatalf("Create table: %s", err)
+	}
+	_, err = db.Exec(`INSERT INTO test (a,b) VALUES (1, "1")`)
+	if err != nil {
+		t.Fatalf("Insert : %s", err)
+	}
+	_, err = db.Exec(`INSERT INTO test (a,b) VALUES (2, "2")`)
+	if err != nil {
+		t.Fatalf("Insert : %s", err)
+	}
+	_, err = db.Exec(`INSERT INTO test (a,b) VALUES (2, "1")`)
+	if err != nil {
+		t.Fatalf("Insert : %s", err)
+	}
+	_, err = db.Exec(`INSERT INTO test (a,b) VALUES (2, "1")`)
+	if err == nil {
+		t.Fatalf("expected error on primary key violation")
+	}
+}
+
+func TestLimitEmptyTable(t *testing.T) {
+
+	db, err := sql.Open("ramsql", "TestLimitEmptyTable")
+	if err != nil {
+		t.Fatalf("cannot open db: %s", err)
+	}
+
+	q := `CREATE TABLE event_db_entries (test_id BIGINT, result TEXT)`
+	_, err = db.Exec(q)
+	if err != nil {
+		t.Fatalf("cannot create table: %s", err)
+	}
+
+	q = `SELECT * FROM "event_db_entries" WHERE 1 LIMIT 1`
+	_, err = db.Query(q)
+	if err != nil {
+		t.Fatalf("cannot select: %s", err)
+	}
+}
+
+func TestDefaultExpression(t *testing.T) {
+
+	db, err := sql.Open("ramsql", "TestDefaultExpression")
+	if err != nil {
+		t.Fatalf("sql.Open : Error : %s\n", err)
+	}
+	defer db.Close()
+
+	_, err = db.Exec("CREATE TABLE account (id INT AUTOINCREMENT, created_at TIMESTAMP DEFAULT now(), updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP, day DATE DEFAULT CURRENT_DATE, seed FLOAT DEFAULT random())")
+	if err != nil {
+		t.Fatalf("sql.Exec: Error: %s\n", err)
+	}
+
+	_, err = db.Exec("INSERT INTO account ('id') VALUES (1)")
+	if err != nil {
+		t.Fatalf("Cannot insert into table account: %s", err)
+	}
+
+	time.Sleep(10 * time.Millisecond)
+
+	_, err = db.Exec("INSERT INTO account ('id') VALUES (2)")
+	if err != nil {
+		t.Fatalf("Cannot insert into table account: %s", err)
+	}
+
+	rows, err := db.Query("SELECT created_at, updated_at, day, seed FROM account ORDER BY id")
+	if err != nil {
+		t.Fatalf("sql.Query: %s", err)
+	}
+	defer rows.Close()
+
+	var created, updated []time.Time
+	for rows.Next() {
+		var c, u, d time.Time
+		var s float64
+		if err := rows.Scan(&c, &u, &d, &s); err != nil {
+			t.Fatalf("rows.Scan: %s", err)
+		}
+		if d.Hour() != 0 || d.Minute() != 0 || d.Second() != 0 || d.Nanosecond() != 0 {
+			t.Fatalf("expected CURRENT_DATE to be truncated to day, got %s", d)
+		}
+		if s < 0 || s >= 1 {
+			t.Fatalf("expected random() in [0,1), got %f", s)
+		}
+		created = append(created, c)
+		updated = append(updated, u)
+	}
+
+	if len(created) != 2 {
+		t.Fatalf("expected 2 rows, got %d", len(created))
+	}
+	if !created[1].After(created[0]) {
+		t.Fatalf("expected second insert to get a later now() default: %s vs %s", created[0], created[1])
+	}
+	if !updated[1].After(updated[0]) {
+		t.Fatalf("expected second insert to get a later CURRENT_TIMESTAMP default: %s vs %s", updated[0], updated[1])
+	}
+}
+
+func TestCreateIndex(t *testing.T) {
+
+	db, err := sql.Open("ramsql", "TestCreateIndex")
+	if err != nil {
+		t.Fatalf("sql.Open : Error : %s\n", err)
+	}
+	defer db.Close()
+
+	batch := []string{
+		`CREATE TABLE champion (id BIGSERIAL PRIMARY KEY, user_id INT, name TEXT)`,
+		`INSERT INTO champion (user_id, name) VALUES (1, 'zed')`,
+		`INSERT INTO champion (user_id, name) VALUES (1, 'lulu')`,
+		`INSERT INTO champion (user_id, name) VALUES (2, 'thresh')`,
+		`CREATE INDEX champion_user_id_idx ON champion (user_id)`,
+		`INSERT INTO champion (user_id, name) VALUES (1, 'janna')`,
+	}
+	for _, b := range batch {
+		_, err = db.Exec(b)
+		if err != nil {
+			t.Fatalf("sql.Exec: Error: %s\n", err)
+		}
+	}
+
+	rows, err := db.Query(`SELECT name FROM champion WHERE user_id = 1`)
+	if err != nil {
+		t.Fatalf("sql.Query: %s", err)
+	}
+	defer rows.Close()
+
+	var n int
+	for rows.Next() {
+		n++
+	}
+	if n != 3 {
+		t.Fatalf("expected 3 rows, got %d", n)
+	}
+
+	_, err = db.Exec(`CREATE INDEX champion_user_id_idx ON champion (user_id)`)
+	if err == nil {
+		t.Fatalf("expected error creating an existing index")
+	}
+	_, err = db.Exec(`CREATE INDEX IF NOT EXISTS champion_user_id_idx ON champion (user_id)`)
+	if err != nil {
+		t.Fatalf("unexpected error with IF NOT EXISTS: %s", err)
+	}
+
+	_, err = db.Exec(`CREATE UNIQUE INDEX champion_user_id_uidx ON champion (user_id)`)
+	if err == nil {
+		t.Fatalf("expected error creating unique index on duplicate values")
+	}
+
+	_, err = db.Exec(`CREATE UNIQUE INDEX champion_name_idx ON champion (name)`)
+	if err != nil {
+		t.Fatalf("cannot create unique index: %s", err)
+	}
+
+	_, err = db.Exec(`INSERT INTO champion (user_id, name) VALUES (3, 'zed')`)
+	if err == nil {
+		t.Fatalf("expected unicity violation inserting duplicate name")
+	}
+
+	// only the primary key index itself is left to CheckPrimaryKey
+	for _, b := range []string{
+		`CREATE TABLE account (id BIGSERIAL PRIMARY KEY, email TEXT)`,
+		`CREATE UNIQUE INDEX pkg_email ON account (email)`,
+		`INSERT INTO account (email) VALUES ('foo@bar.com')`,
+	} {
+		if _, err = db.Exec(b); err != nil {
+			t.Fatalf("sql.Exec: Error: %s\n", err)
+		}
+	}
+	_, err = db.Exec(`INSERT INTO account (email) VALUES ('foo@bar.com')`)
+	if err == nil {
+		t.Fatalf("expected unicity violation on index named like the primary key index")
+	}
+
+	// composite keys are compared value by value
+	for _, b := range []string{
+		`CREATE TABLE d (a TEXT, b TEXT)`,
+		`CREATE UNIQUE INDEX d_ab ON d (a, b)`,
+		`INSERT INTO d (a, b) VALUES ('ab', 'c')`,
+		`INSERT INTO d (a, b) VALUES ('a', 'bc')`,
+	} {
+		if _, err = db.Exec(b); err != nil {
+			t.Fatalf("sql.Exec: Error: %s\n", err)
+		}
+	}
+	_, err = db.Exec(`INSERT INTO d (a, b) VALUES ('a', 'bc')`)
+	if err == nil {
+		t.Fatalf("expected unicity violation on composite index")
+	}
+	var b string
+	err = db.QueryRow(`SELECT b FROM d WHERE a = 'a' AND b = 'bc'`).Scan(&b)
+	if err != nil || b != "bc" {
+		t.Fatalf("expected bc from composite index, got %s (%v)", b, err)
+	}
+}
+
+func TestDropIndex(t *testing.T) {
+
+	db, err := sql.Open("ramsql", "TestDropIndex")
+	if err != nil {
+		t.Fatalf("sql.Open : Error : %s\n", err)
+	}
+	defer db.Close()
+
+	batch := []string{
+		`CREATE TABLE champion (id BIGSERIAL PRIMARY KEY, user_id INT, name TEXT UNIQUE)`,
+		`INSERT INTO champion (user_id, name) VALUES (1, 'zed')`,
+		`INSERT INTO champion (user_id, name) VALUES (1, 'lulu')`,
+		`CREATE INDEX champion_user_id_idx ON champion (user_id)`,
+	}
+	for _, b := range batch {
+		_, err = db.Exec(b)
+		if err != nil {
+			t.Fatalf("sql.Exec: Error: %s\n", err)
+		}
+	}
+
+	_, err = db.Exec(`DROP INDEX champion_user_id_idx`)
+	if err != nil {
+		t.Fatalf("cannot drop index: %s", err)
+	}
+
+	_, err = db.Exec(`DROP INDEX champion_user_id_idx`)
+	if err == nil {
+		t.Fatalf("expected error dropping non existing index")
+	}
+
+	_, err = db.Exec(`DROP INDEX pk_public_champion`)
+	if err == nil {
+		t.Fatalf("expected error dropping primary key index")
+	}
+
+	_, err = db.Exec(`DROP INDEX unique_public_champion_name`)
+	if err == nil {
+		t.Fatalf("expected error dropping unique constraint index")
+	}
+
+	var n int
+	err = db.QueryRow(`SELECT COUNT(*) FROM champion WHERE user_id = 1`).Scan(&n)
+	if err != nil {
+		t.Fatalf("cannot query champion: %s", err)
+	}
+	if n != 2 {
+		t.Fatalf("expected 2 rows, got %d", n)
+	}
+}
+
+func TestBTreeIndex(t *testing.T) {
+
+	db, err := sql.Open("ramsql", "TestBTreeIndex")
+	if err != nil {
+		t.Fatalf("sql.Open : Error : %s\n", err)
+	}
+	defer db.Close()
+
+	_, err = db.Exec(`CREATE TABLE champion (id BIGSERIAL PRIMARY KEY, user_id INT, name TEXT)`)
+	if err != nil {
+		t.Fatalf("sql.Exec: Error: %s\n", err)
+	}
+	for i := 0; i < 200; i++ {
+		_, err = db.Exec(`INSERT INTO champion (user_id, name) VALUES ($1, 'foo')`, (i*37)%200)
+		if err != nil {
+			t.Fatalf("sql.Exec: Error: %s\n", err)
+		}
+	}
+	_, err = db.Exec(`CREATE INDEX champion_user_id_idx ON champion USING BTREE (user_id)`)
+	if err != nil {
+		t.Fatalf("cannot create btree index: %s", err)
+	}
+	_, err = db.Exec(`INSERT INTO champion (user_id, name) VALUES (50, 'bar')`)
+	if err != nil {
+		t.Fatalf("sql.Exec: Error: %s\n", err)
+	}
+
+	var n int
+	err = db.QueryRow(`SELECT COUNT(*) FROM champion WHERE user_id > 5 AND user_id < 100`).Scan(&n)
+	if err != nil {
+		t.Fatalf("sql.Query: %s", err)
+	}
+	if n != 95 {
+		t.Fatalf("expected 95 rows, got %d", n)
+	}
+
+	err = db.QueryRow(`SELECT COUNT(*) FROM champion WHERE user_id >= 50 AND user_id <= 50`).Scan(&n)
+	if err != nil {
+		t.Fatalf("sql.Query: %s", err)
+	}
+	if n != 2 {
+		t.Fatalf("expected 2 rows, got %d", n)
+	}
+
+	rows, err := db.Query(`SELECT user_id FROM champion WHERE user_id < 10 ORDER BY user_id DESC`)
+	if err != nil {
+		t.Fatalf("sql.Query: %s", err)
+	}
+	defer rows.Close()
+
+	var userIDs []int
+	for rows.Next() {
+		var id int
+		if err = rows.Scan(&id); err != nil {
+			t.Fatalf("cannot scan row: %s", err)
+		}
+		userIDs = append(userIDs, id)
+	}
+	if len(userIDs) != 10 {
+		t.Fatalf("expected 10 rows, got %d", len(userIDs))
+	}
+	for i, id := range userIDs {
+		if id != 9-i {
+			t.Fatalf("expected user_id %d at row %d, got %d", 9-i, i, id)
+		}
+	}
+
+	_, err = db.Exec(`CREATE INDEX champion_name_idx ON champion USING GIST (name)`)
+	if err == nil {
+		t.Fatalf("expected error with unknown index method")
+	}
+}
+
+func TestExplain(t *testing.T) {
+
+	db, err := sql.Open("ramsql", "TestExplain")
+	if err != nil {
+		t.Fatalf("sql.Open : Error : %s\n", err)
+	}
+	defer db.Close()
+
+	batch := []string{
+		`CREATE TABLE champion (id BIGSERIAL PRIMARY KEY, user_id INT, name TEXT)`,
+		`CREATE INDEX champion_user_id_idx ON champion (user_id)`,
+		`INSERT INTO champion (user_id, name) VALUES (1, 'zed')`,
+		`INSERT INTO champion (user_id, name) VALUES (2, 'lulu')`,
+	}
+	for _, b := range batch {
+		_, err = db.Exec(b)
+		if err != nil {
+			t.Fatalf("sql.Exec: Error: %s\n", err)
+		}
+	}
+
+	rows, err := db.Query(`EXPLAIN SELECT name FROM champion WHERE user_id = 1 ORDER BY name`)
+	if err != nil {
+		t.Fatalf("sql.Query: %s", err)
+	}
+	defer rows.Close()
+
+	cols, err := rows.Columns()
+	if err != nil {
+		t.Fatalf("cannot get columns: %s", err)
+	}
+	if len(cols) != 3 {
+		t.Fatalf("expected 3 columns, got %v", cols)
+	}
+
+	var nodes []string
+	var lastDepth int64 = -1
+	for rows.Next() {
+		var depth, cardinal int64
+		var node string
+		if err = rows.Scan(&depth, &node, &cardinal); err != nil {
+			t.Fatalf("cannot scan plan row: %s", err)
+		}
+		if depth != lastDepth+1 {
+			t.Fatalf("expected depth %d, got %d", lastDepth+1, depth)
+		}
+		lastDepth = depth
+		nodes = append(nodes, node)
+	}
+	if len(nodes) != 3 {
+		t.Fatalf("expected 3 plan nodes, got %v", nodes)
+	}
+	if !strings.HasPrefix(nodes[0], "Select") || !strings.HasPrefix(nodes[1], "OrderBy") {
+		t.Fatalf("unexpected plan: %v", nodes)
+	}
+	if !strings.Contains(nodes[2], "IndexScan") {
+		t.Fatalf("expected index scan, got %s", nodes[2])
+	}
+
+	// EXPLAIN does not execute statement
+	_, err = db.Exec(`EXPLAIN DELETE FROM champion`)
+	if err == nil {
+		t.Fatalf("expected error explaining DELETE")
+	}
+	var n int
+	err = db.QueryRow(`SELECT COUNT(*) FROM champion`).Scan(&n)
+	if err != nil {
+		t.Fatalf("sql.Query: %s", err)
+	}
+	if n != 2 {
+		t.Fatalf("expected 2 rows, got %d", n)
+	}
+}
+
+func TestExplainAnalyze(t *testing.T) {
+
+	db, err := sql.Open("ramsql", "TestExplainAnalyze")
+	if err != nil {
+		t.Fatalf("sql.Open : Error : %s\n", err)
+	}
+	defer db.Close()
+
+	_, err = db.Exec(`CREATE TABLE champion (id BIGSERIAL PRIMARY KEY, user_id INT, name TEXT)`)
+	if err != nil {
+		t.Fatalf("sql.Exec: Error: %s\n", err)
+	}
+	for i := 0; i < 20; i++ {
+		_, err = db.Exec(`INSERT INTO champion (user_id, name) VALUES ($1, 'foo')`, i%4)
+		if err != nil {
+			t.Fatalf("sql.Exec: Error: %s\n", err)
+		}
+	}
+
+	rows, err := db.Query(`EXPLAIN ANALYZE SELECT name FROM champion WHERE user_id = 1`)
+	if err != nil {
+		t.Fatalf("sql.Query: %s", err)
+	}
+	defer rows.Close()
+
+	cols, err := rows.Columns()
+	if err != nil {
+		t.Fatalf("cannot get columns: %s", err)
+	}
+	if len(cols) != 6 {
+		t.Fatalf("expected 6 columns, got %v", cols)
+	}
+
+	var n int
+	for rows.Next() {
+		var depth, estimated, actual int64
+		var node string
+		var ms, misestimate float64
+		if err = rows.Scan(&depth, &node, &estimated, &actual, &ms, &misestimate); err != nil {
+			t.Fatalf("cannot scan plan row: %s", err)
+		}
+		if actual != 5 {
+			t.Fatalf("expected node %s to produce 5 rows, got %d", node, actual)
+		}
+		if ms < 0 {
+			t.Fatalf("expected positive duration, got %f", ms)
+		}
+		if misestimate < 1 {
+			t.Fatalf("expected misestimate factor >= 1, got %f", misestimate)
+		}
+		n++
+	}
+	if n != 2 {
+		t.Fatalf("expected 2 plan nodes, got %d", n)
+	}
+}
+
+func TestColumnTypes(t *testing.T) {
+
+	db, err := sql.Open("ramsql", "TestColumnTypes")
+	if err != nil {
+		t.Fatalf("sql.Open : Error : %s\n", err)
+	}
+	defer db.Close()
+
+	_, err = db.Exec(`CREATE TABLE account (id BIGSERIAL PRIMARY KEY, email VARCHAR(255) NOT NULL, age INT, score FLOAT, active BOOLEAN, created_at TIMESTAMP)`)
+	if err != nil {
+		t.Fatalf("sql.Exec: Error: %s\n", err)
+	}
+
+	_, err = db.Exec(`INSERT INTO account (email, age, score, active, created_at) VALUES ('foo@bar.com', 42, 1.5, true, now())`)
+	if err != nil {
+		t.Fatalf("sql.Exec: Error: %s\n", err)
+	}
+
+	check := func(query string, expected []string, scanTypes []reflect.Type, nullables []bool) {
+		rows, err := db.Query(query)
+		if err != nil {
+			t.Fatalf("sql.Query: %s", err)
+		}
+		defer rows.Close()
+
+		types, err := rows.ColumnTypes()
+		if err != nil {
+			t.Fatalf("cannot get column types: %s", err)
+		}
+		if len(types) != len(expected) {
+			t.Fatalf("expected %d column types, got %d", len(expected), len(types))
+		}
+		for i, ct := range types {
+			if ct.DatabaseTypeName() != expected[i] {
+				t.Fatalf("expected column %s to be %s, got %s", ct.Name(), expected[i], ct.DatabaseTypeName())
+			}
+			if ct.ScanType() != scanTypes[i] {
+				t.Fatalf("expected column %s to scan into %s, got %s", ct.Name(), scanTypes[i], ct.ScanType())
+			}
+			nullable, ok := ct.Nullable()
+			if !ok {
+				t.Fatalf("expected nullability of column %s to be known", ct.Name())
+			}
+			if nullable != nullables[i] {
+				t.Fatalf("expected column %s nullable to be %v, got %v", ct.Name(), nullables[i], nullable)
+			}
+		}
+	}
+
+	int64Type := reflect.TypeOf(int64(0))
+	stringType := reflect.TypeOf("")
+	floatType := reflect.TypeOf(float64(0))
+	boolType := reflect.TypeOf(true)
+	timeType := reflect.TypeOf(time.Time{})
+
+	check(`SELECT * FROM account`,
+		[]string{"BIGSERIAL", "VARCHAR", "INT", "FLOAT", "BOOLEAN", "TIMESTAMP"},
+		[]reflect.Type{int64Type, stringType, int64Type, floatType, boolType, timeType},
+		[]bool{false, false, true, true, true, true},
+	)
+	check(`SELECT account.email, age FROM account WHERE id = 1`,
+		[]string{"VARCHAR", "INT"},
+		[]reflect.Type{stringType, int64Type},
+		[]bool{false, true},
+	)
+	check(`UPDATE account SET age = 43 RETURNING score, active`,
+		[]string{"FLOAT", "BOOLEAN"},
+		[]reflect.Type{floatType, boolType},
+		[]bool{true, true},
+	)
+
+	rows, err := db.Query(`SELECT COUNT(*) FROM account`)
+	if err != nil {
+		t.Fatalf("sql.Query: %s", err)
+	}
+	defer rows.Close()
+
+	types, err := rows.ColumnTypes()
+	if err != nil {
+		t.Fatalf("cannot get column types: %s", err)
+	}
+	if len(types) != 1 {
+		t.Fatalf("expected 1 column type, got %d", len(types))
+	}
+	if types[0].DatabaseTypeName() != "" {
+		t.Fatalf("expected no database type for COUNT, got %s", types[0].DatabaseTypeName())
+	}
+	if types[0].ScanType() != int64Type {
+		t.Fatalf("expected COUNT to scan into int64, got %s", types[0].ScanType())
+	}
+	if _, ok := types[0].Nullable(); ok {
+		t.Fatalf("expected COUNT nullability to be unknown")
+	}
+}
+
+func TestResult(t *testing.T) {
+
+	db, err := sql.Open("ramsql", "TestResult")
+	if err != nil {
+		t.Fatalf("sql.Open : Error : %s\n", err)
+	}
+	defer db.Close()
+
+	_, err = db.Exec(`CREATE TABLE account (id BIGSERIAL PRIMARY KEY, email TEXT UNIQUE)`)
+	if err != nil {
+		t.Fatalf("sql.Exec: Error: %s\n", err)
+	}
+	_, err = db.Exec(`CREATE TABLE tag (name TEXT)`)
+	if err != nil {
+		t.Fatalf("sql.Exec: Error: %s\n", err)
+	}
+
+	check := func(query string, expectedID, expectedRows int64) {
+		res, err := db.Exec(query)
+		if err != nil {
+			t.Fatalf("sql.Exec: Error: %s\n", err)
+		}
+		id, err := res.LastInsertId()
+		if err != nil {
+			t.Fatalf("cannot get last insert id of '%s': %s", query, err)
+		}
+		if id != expectedID {
+			t.Fatalf("expected last insert id of '%s' to be %d, got %d", query, expectedID, id)
+		}
+		n, err := res.RowsAffected()
+		if err != nil {
+			t.Fatalf("cannot get rows affected by '%s': %s", query, err)
+		}
+		if n != expectedRows {
+			t.Fatalf("expected '%s' to affect %d rows, got %d", query, expectedRows, n)
+		}
+	}
+
+	check(`INSERT INTO account (email) VALUES ('foo@bar.com')`, 1, 1)
+	check(`INSERT INTO account (email) VALUES ('a@bar.com'), ('b@bar.com'), ('c@bar.com')`, 4, 3)
+	check(`INSERT INTO account (id, email) VALUES (42, 'd@bar.com')`, 0, 1)
+	check(`INSERT INTO account (email) VALUES ('foo@bar.com') ON CONFLICT DO NOTHING`, 0, 0)
+	check(`INSERT INTO tag (name) VALUES ('foo'), ('bar')`, 0, 2)
+	check(`UPDATE account SET email = 'x@bar.com' WHERE id = 42`, 0, 1)
+	check(`UPDATE account SET email = 'y@bar.com' WHERE id = 1000`, 0, 0)
+	check(`DELETE FROM account WHERE id > 2`, 0, 3)
+	check(`INSERT INTO account (email) VALUES ('e@bar.com'); UPDATE tag SET name = 'baz'`, 6, 3)
+}
+
+func TestDump(t *testing.T) {
+
+	db, err := sql.Open("ramsql", "TestDump")
+	if err != nil {
+		t.Fatalf("sql.Open : Error : %s\n", err)
+	}
+	defer db.Close()
+
+	batch := []string{
+		`CREATE SCHEMA app`,
+		`CREATE SEQUENCE app.invoice_seq START WITH 100 INCREMENT BY 5`,
+		`CREATE TABLE account (id BIGSERIAL PRIMARY KEY, email TEXT NOT NULL UNIQUE, age INT DEFAULT 18, score FLOAT DEFAULT 0.5, active BOOLEAN DEFAULT true, created_at TIMESTAMP DEFAULT NOW())`,
+		`CREATE TABLE app.membership (account_id INT, team TEXT DEFAULT 'it''s', PRIMARY KEY (account_id, team))`,
+		`CREATE TABLE app.team (name TEXT PRIMARY KEY, "Label" TEXT)`,
+		`CREATE TABLE post (id INT PRIMARY KEY, account_id INT REFERENCES account(id), team TEXT REFERENCES app.team(name))`,
+		`CREATE INDEX account_age_idx ON account USING BTREE (age)`,
+		`CREATE UNIQUE INDEX membership_team_idx ON app.membership (team)`,
+		`INSERT INTO account (email, age, score, active) VALUES ('foo@bar.com', 42, 1.25, false)`,
+		`INSERT INTO account (email, age) VALUES ('o''reilly@bar.com', NULL)`,
+		`INSERT INTO account (email) VALUES ('deleted@bar.com')`,
+		`INSERT INTO account (email, created_at) VALUES ('42', '2020-01-02 10:00:00.5 +0000 UTC')`,
+		`INSERT INTO account (email) VALUES ('true')`,
+		`DELETE FROM account WHERE email = 'deleted@bar.com'`,
+		`INSERT INTO app.membership (account_id, team) VALUES (1, 'core')`,
+		`INSERT INTO app.membership (account_id) VALUES (2)`,
+		`INSERT INTO app.membership (account_id, team) VALUES (nextval('app.invoice_seq'), 'billing')`,
+		`INSERT INTO app.team (name, "Label") VALUES ('core', 'Core')`,
+		`INSERT INTO post (id, account_id, team) VALUES (1, 1, 'core')`,
+	}
+	for _, b := range batch {
+		_, err = db.Exec(b)
+		if err != nil {
+			t.Fatalf("sql.Exec: Error: %s\n", err)
+		}
+	}
+
+	dump := func(db *sql.DB) string {
+		conn, err := db.Conn(context.Background())
+		if err != nil {
+			t.Fatalf("cannot get connection: %s", err)
+		}
+		defer conn.Close()
+
+		var sb strings.Builder
+		err = conn.Raw(func(driverConn any) error {
+			return driverConn.(*Conn).e.Dump(&sb)
+		})
+		if err != nil {
+			t.Fatalf("cannot dump database: %s", err)
+		}
+		return sb.String()
+	}
+
+	first := dump(db)
+
+	restored, err := sql.Open("ramsql", "TestDumpRestored")
+	if err != nil {
+		t.Fatalf("sql.Open : Error : %s\n", err)
+	}
+	defer restored.Close()
+
+	_, err = restored.Exec(first)
+	if err != nil {
+		t.Fatalf("cannot replay dump: %s\n%s", err, first)
+	}
+
+	second := dump(restored)
+	if first != second {
+		t.Fatalf("expected identical dumps, got:\n%s\nand:\n%s", first, second)
+	}
+
+	var id int64
+	err = restored.QueryRow(`INSERT INTO account (email) VALUES ('new@bar.com') RETURNING id`).Scan(&id)
+	if err != nil {
+		t.Fatalf("cannot insert into restored database: %s", err)
+	}
+	if id != 6 {
+		t.Fatalf("expected auto-increment to continue at 6, got %d", id)
+	}
+
+	var email string
+	var age sql.NullInt64
+	err = restored.QueryRow(`SELECT email, age FROM account WHERE id = 2`).Scan(&email, &age)
+	if err != nil {
+		t.Fatalf("cannot query restored database: %s", err)
+	}
+	if email != "o'reilly@bar.com" || age.Valid {
+		t.Fatalf("unexpected restored row: %s, %v", email, age)
+	}
+
+	_, err = restored.Exec(`INSERT INTO account (email) VALUES ('foo@bar.com')`)
+	if err == nil {
+		t.Fatalf("expected unique constraint to be restored")
+	}
+
+	var next int64
+	err = restored.QueryRow(`INSERT INTO app.membership (account_id, team) VALUES (nextval('app.invoice_seq'), 'sales') RETURNING account_id`).Scan(&next)
+	if err != nil {
+		t.Fatalf("cannot query restored sequence: %s", err)
+	}
+	if next != 105 {
+		t.Fatalf("expected sequence to continue at 105, got %d", next)
+	}
+
+	// post is created after the app.team relation it references
+	if !strings.Contains(first, "team TEXT REFERENCES app.team (name)") {
+		t.Fatalf("expected foreign key in dump, got:\n%s", first)
+	}
+	for _, table := range []string{"account", "app.team"} {
+		_, err = restored.Exec(`DROP TABLE ` + table)
+		if err == nil {
+			t.Fatalf("expected foreign key referencing %s to be restored", table)
+		}
+	}
+}
+
+func TestLoadFile(t *testing.T) {
+
+	db, err := sql.Open("ramsql", "TestLoadFile")
+	if err != nil {
+		t.Fatalf("sql.Open : Error : %s\n", err)
+	}
+	defer db.Close()
+
+	script := `-- fixtures for account
+CREATE TABLE account (id BIGSERIAL PRIMARY KEY, email TEXT, bio TEXT);
+
+/* two accounts,
+   the second one with a tricky bio */
+INSERT INTO account (email, bio) VALUES ('foo@bar.com', 'hello');
+INSERT INTO account (email, bio)
+	VALUES ('bar@bar.com', 'semicolon; -- not a comment');
+
+`
+	path := filepath.Join(t.TempDir(), "fixtures.sql")
+	if err := os.WriteFile(path, []byte(script), 0644); err != nil {
+		t.Fatalf("cannot write fixtures: %s", err)
+	}
+
+	if err := LoadFile(db, path); err != nil {
+		t.Fatalf("cannot load file: %s", err)
+	}
+
+	var bio string
+	err = db.QueryRow(`SELECT bio FROM account WHERE email = 'bar@bar.com'`).Scan(&bio)
+	if err != nil {
+		t.Fatalf("sql.QueryRow: %s", err)
+	}
+	if bio != "semicolon; -- not a comment" {
+		t.Fatalf("unexpected bio: %s", bio)
+	}
+
+	script = `INSERT INTO account (email, bio) VALUES ('baz@bar.com', NULL);
+
+-- unknown relation
+INSERT INTO nope (email) VALUES ('baz@bar.com');
+`
+	if err := os.WriteFile(path, []byte(script), 0644); err != nil {
+		t.Fatalf("cannot write fixtures: %s", err)
+	}
+
+	err = LoadFile(db, path)
+	if err == nil {
+		t.Fatalf("expected error loading invalid statement")
+	}
+	if !strings.Contains(err.Error(), "fixtures.sql:4: INSERT INTO nope") {
+		t.Fatalf("expected error to report statement and line, got: %s", err)
+	}
+}
+
+func TestWriteCSV(t *testing.T) {
+
+	db, err := sql.Open("ramsql", "TestWriteCSV")
+	if err != nil {
+		t.Fatalf("sql.Open : Error : %s\n", err)
+	}
+	defer db.Close()
+
+	batch := []string{
+		`CREATE TABLE account (id BIGSERIAL PRIMARY KEY, email TEXT, bio TEXT, score FLOAT, created_at TIMESTAMP)`,
+		`INSERT INTO account (email, bio, score, created_at) VALUES ('foo@bar.com', 'says "hi", then leaves', 1.5, '2020-01-02 10:00:00 +0000 UTC')`,
+		`INSERT INTO account (email, bio, score, created_at) VALUES ('bar@bar.com', NULL, 2, '2021-06-07 08:09:10.5 +0000 UTC')`,
+	}
+	for _, b := range batch {
+		_, err = db.Exec(b)
+		if err != nil {
+			t.Fatalf("sql.Exec: Error: %s\n", err)
+		}
+	}
+
+	rows, err := db.Query(`SELECT * FROM account ORDER BY id`)
+	if err != nil {
+		t.Fatalf("sql.Query: %s", err)
+	}
+
+	var sb strings.Builder
+	err = WriteCSV(&sb, rows)
+	rows.Close()
+	if err != nil {
+		t.Fatalf("cannot write CSV: %s", err)
+	}
+
+	expected := `id,email,bio,score,created_at
+1,foo@bar.com,"says ""hi"", then leaves",1.5,2020-01-02T10:00:00Z
+2,bar@bar.com,,2,2021-06-07T08:09:10.5Z
+`
+	if sb.String() != expected {
+		t.Fatalf("expected:\n%s\ngot:\n%s", expected, sb.String())
+	}
+
+	rows, err = db.Query(`SELECT email, bio FROM account WHERE id = 2`)
+	if err != nil {
+		t.Fatalf("sql.Query: %s", err)
+	}
+	defer rows.Close()
+
+	sb.Reset()
+	err = WriteCSV(&sb, rows, WithCSVNull(`\N`), WithCSVComma(';'))
+	if err != nil {
+		t.Fatalf("cannot write CSV: %s", err)
+	}
+	if sb.String() != "email;bio\nbar@bar.com;\\N\n" {
+		t.Fatalf("unexpected CSV with options:\n%s", sb.String())
+	}
+}
+
+func TestImportCSV(t *testing.T) {
+
+	db, err := sql.Open("ramsql", "TestImportCSV")
+	if err != nil {
+		t.Fatalf("sql.Open : Error : %s\n", err)
+	}
+	defer db.Close()
+
+	_, err = db.Exec(`CREATE TABLE account (id BIGSERIAL PRIMARY KEY, email TEXT, bio TEXT, score FLOAT, active BOOLEAN, created_at TIMESTAMP)`)
+	if err != nil {
+		t.Fatalf("sql.Exec: Error: %s\n", err)
+	}
+
+	data := `id,email,bio,score,active,created_at
+1,foo@bar.com,"says ""hi"", then leaves",1.5,true,2020-01-02T10:00:00Z
+2,42,,2,false,2021-06-07T08:09:10.5Z
+`
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatalf("cannot begin transaction: %s", err)
+	}
+	n, err := ImportCSV(tx, "account", strings.NewReader(data))
+	if err != nil {
+		t.Fatalf("cannot import CSV: %s", err)
+	}
+	if n != 2 {
+		t.Fatalf("expected 2 imported rows, got %d", n)
+	}
+	if err = tx.Commit(); err != nil {
+		t.Fatalf("cannot commit: %s", err)
+	}
+
+	// export and compare
+	rows, err := db.Query(`SELECT * FROM account ORDER BY id`)
+	if err != nil {
+		t.Fatalf("sql.Query: %s", err)
+	}
+	var sb strings.Builder
+	err = WriteCSV(&sb, rows)
+	rows.Close()
+	if err != nil {
+		t.Fatalf("cannot write CSV: %s", err)
+	}
+	if sb.String() != data {
+		t.Fatalf("expected round trip, got:\n%s", sb.String())
+	}
+
+	// malformed record aborts import
+	data = `id,email,bio,score,active,created_at
+3,bar@bar.com,,3,true,
+4,baz@bar.com,,not a number,true,
+`
+	tx, err = db.Begin()
+	if err != nil {
+		t.Fatalf("cannot begin transaction: %s", err)
+	}
+	_, err = ImportCSV(tx, "account", strings.NewReader(data))
+	tx.Rollback()
+	if err == nil || !strings.Contains(err.Error(), "line 3") {
+		t.Fatalf("expected import to fail on line 3, got %v", err)
+	}
+
+	// unless skipped
+	data = `account@bar.com;\N;\N;\N;\N;\N
+1;too;few
+x@bar.com;bio;seven;true;\N;note
+y@bar.com;bio;7;true;\N;note
+`
+	tx, err = db.Begin()
+	if err != nil {
+		t.Fatalf("cannot begin transaction: %s", err)
+	}
+	_, err = tx.Exec(`CREATE TABLE guest (email TEXT, bio TEXT, score INT, active BOOLEAN, created_at TIMESTAMP, note TEXT)`)
+	if err != nil {
+		t.Fatalf("sql.Exec: Error: %s\n", err)
+	}
+	n, err = ImportCSV(tx, "guest", strings.NewReader(data), WithCSVNoHeader(), WithCSVComma(';'), WithCSVNull(`\N`), WithCSVSkipMalformed())
+	if err != nil {
+		t.Fatalf("cannot import CSV: %s", err)
+	}
+	if n != 2 {
+		t.Fatalf("expected 2 imported rows, got %d", n)
+	}
+	if err = tx.Commit(); err != nil {
+		t.Fatalf("cannot commit: %s", err)
+	}
+}
+
+func TestInformationSchema(t *testing.T) {
+
+	db, err := sql.Open("ramsql", "TestInformationSchema")
+	if err != nil {
+		t.Fatalf("sql.Open : Error : %s\n", err)
+	}
+	defer db.Close()
+
+	batch := []string{
+		`CREATE SCHEMA app`,
+		`CREATE TABLE account (id BIGSERIAL PRIMARY KEY, email TEXT NOT NULL, age INT DEFAULT 18)`,
+		`CREATE TABLE app.team (name TEXT)`,
+	}
+	for _, b := range batch {
+		_, err = db.Exec(b)
+		if err != nil {
+			t.Fatalf("sql.Exec: Error: %s\n", err)
+		}
+	}
+
+	rows, err := db.Query(`SELECT table_schema, table_name, table_type FROM information_schema.tables ORDER BY table_name`)
+	if err != nil {
+		t.Fatalf("sql.Query: %s", err)
+	}
+	var tables []string
+	for rows.Next() {
+		var schema, name, typ string
+		if err := rows.Scan(&schema, &name, &typ); err != nil {
+			t.Fatalf("cannot scan table: %s", err)
+		}
+		tables = append(tables, schema+"."+name+":"+typ)
+	}
+	rows.Close()
+	if strings.Join(tables, ",") != "public.account:BASE TABLE,app.team:BASE TABLE" {
+		t.Fatalf("unexpected tables: %v", tables)
+	}
+
+	rows, err = db.Query(`SELECT column_name, ordinal_position, data_type, is_nullable, column_default FROM information_schema.columns WHERE table_name = $1 ORDER BY ordinal_position`, "account")
+	if err != nil {
+		t.Fatalf("sql.Query: %s", err)
+	}
+	defer rows.Close()
+
+	var columns []string
+	for rows.Next() {
+		var name, typ, nullable string
+		var pos int64
+		var def sql.NullString
+		if err := rows.Scan(&name, &pos, &typ, &nullable, &def); err != nil {
+			t.Fatalf("cannot scan column: %s", err)
+		}
+		columns = append(columns, fmt.Sprintf("%d:%s:%s:%s:%s", pos, name, typ, nullable, def.String))
+	}
+	expected := "1:id:bigserial:NO:,2:email:text:NO:,3:age:int:YES:18"
+	if strings.Join(columns, ",") != expected {
+		t.Fatalf("expected columns %s, got %v", expected, columns)
+	}
+
+	var n int64
+	err = db.QueryRow(`SELECT COUNT(*) FROM information_schema.tables WHERE table_schema = CURRENT_SCHEMA() AND table_name = 'account'`).Scan(&n)
+	if err != nil {
+		t.Fatalf("sql.QueryRow: %s", err)
+	}
+	if n != 1 {
+		t.Fatalf("expected account in current schema, got %d", n)
+	}
+
+	_, err = db.Exec(`CREATE TABLE information_schema.foo (id INT)`)
+	if err == nil {
+		t.Fatalf("expected information_schema to be read-only")
+	}
+}
+
+func TestShowTablesDescribe(t *testing.T) {
+
+	db, err := sql.Open("ramsql", "TestShowTablesDescribe")
+	if err != nil {
+		t.Fatalf("sql.Open : Error : %s\n", err)
+	}
+	defer db.Close()
+
+	batch := []string{
+		`CREATE SCHEMA app`,
+		`CREATE TABLE champion (id BIGSERIAL PRIMARY KEY, name TEXT NOT NULL UNIQUE, level INT DEFAULT 1)`,
+		`CREATE TABLE arena (name TEXT)`,
+		`CREATE TABLE app.team (name TEXT)`,
+	}
+	for _, b := range batch {
+		_, err = db.Exec(b)
+		if err != nil {
+			t.Fatalf("sql.Exec: Error: %s\n", err)
+		}
+	}
+
+	showTables := func(query string) []string {
+		rows, err := db.Query(query)
+		if err != nil {
+			t.Fatalf("sql.Query: %s", err)
+		}
+		defer rows.Close()
+
+		cols, err := rows.Columns()
+		if err != nil {
+			t.Fatalf("cannot get columns: %s", err)
+		}
+		if len(cols) != 1 || cols[0] != "table_name" {
+			t.Fatalf("unexpected columns: %v", cols)
+		}
+
+		var tables []string
+		for rows.Next() {
+			var name string
+			if err := rows.Scan(&name); err != nil {
+				t.Fatalf("cannot scan table: %s", err)
+			}
+			tables = append(tables, name)
+		}
+		return tables
+	}
+
+	if tables := showTables(`SHOW TABLES`); strings.Join(tables, ",") != "arena,champion" {
+		t.Fatalf("unexpected tables: %v", tables)
+	}
+	if tables := showTables(`show tables from app`); strings.Join(tables, ",") != "team" {
+		t.Fatalf("unexpected tables in app: %v", tables)
+	}
+
+	rows, err := db.Query(`DESCRIBE champion`)
+	if err != nil {
+		t.Fatalf("sql.Query: %s", err)
+	}
+	defer rows.Close()
+
+	cols, err := rows.Columns()
+	if err != nil {
+		t.Fatalf("cannot get columns: %s", err)
+	}
+	if strings.Join(cols, ",") != "field,type,null,key,default,extra" {
+		t.Fatalf("unexpected columns: %v", cols)
+	}
+
+	var fields []string
+	for rows.Next() {
+		var field, typ, null, key, extra string
+		var def sql.NullString
+		if err := rows.Scan(&field, &typ, &null, &key, &def, &extra); err != nil {
+			t.Fatalf("cannot scan field: %s", err)
+		}
+		fields = append(fields, strings.Join([]string{field, typ, null, key, def.String, extra}, ":"))
+	}
+	expected := "id:BIGSERIAL:NO:PRI::auto_increment,name:TEXT:NO:UNI::,level:INT:YES::1:"
+	if strings.Join(fields, ",") != expected {
+		t.Fatalf("expected fields %s, got %v", expected, fields)
+	}
+
+	_, err = db.Query(`DESCRIBE unknown`)
+	if err == nil {
+		t.Fatalf("expected error describing unknown relation")
+	}
+}
+
+func TestAlterTableAddColumn(t *testing.T) {
+
+	db, err := sql.Open("ramsql", "TestAlterTableAddColumn")
+	if err != nil {
+		t.Fatalf("sql.Open : Error : %s\n", err)
+	}
+	defer db.Close()
+
+	batch := []string{
+		`CREATE TABLE account (id BIGSERIAL PRIMARY KEY, email TEXT)`,
+		`INSERT INTO account (email) VALUES ('foo@bar.com')`,
+		`INSERT INTO account (email) VALUES ('bar@foo.com')`,
+		`ALTER TABLE account ADD COLUMN active BOOLEAN DEFAULT FALSE`,
+		`ALTER TABLE account ADD nickname TEXT`,
+	}
+	for _, b := range batch {
+		_, err = db.Exec(b)
+		if err != nil {
+			t.Fatalf("sql.Exec: Error: %s\n", err)
+		}
+	}
+
+	var active bool
+	var nickname sql.NullString
+	err = db.QueryRow(`SELECT active, nickname FROM account WHERE id = 2`).Scan(&active, &nickname)
+	if err != nil {
+		t.Fatalf("cannot select added columns: %s", err)
+	}
+	if active || nickname.Valid {
+		t.Fatalf("expected backfilled false and NULL, got %v and %v", active, nickname)
+	}
+
+	_, err = db.Exec(`INSERT INTO account (email, active, nickname) VALUES ('baz@foo.com', true, 'baz')`)
+	if err != nil {
+		t.Fatalf("cannot insert with added columns: %s", err)
+	}
+
+	_, err = db.Exec(`ALTER TABLE account ADD COLUMN age INT NOT NULL`)
+	if err == nil {
+		t.Fatalf("expected error adding NOT NULL column without default to non-empty relation")
+	}
+	_, err = db.Exec(`ALTER TABLE account ADD COLUMN email TEXT`)
+	if err == nil {
+		t.Fatalf("expected error adding existing column")
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatalf("cannot begin transaction: %s", err)
+	}
+	_, err = tx.Exec(`ALTER TABLE account ADD COLUMN score INT DEFAULT 10`)
+	if err != nil {
+		t.Fatalf("cannot add column in transaction: %s", err)
+	}
+	_, err = tx.Exec(`UPDATE account SET score = 20 WHERE id = 1`)
+	if err != nil {
+		t.Fatalf("cannot update added column: %s", err)
+	}
+	if err = tx.Rollback(); err != nil {
+		t.Fatalf("cannot rollback: %s", err)
+	}
+
+	rows, err := db.Query(`SELECT * FROM account WHERE id = 1`)
+	if err != nil {
+		t.Fatalf("sql.Query: %s", err)
+	}
+	cols, err := rows.Columns()
+	rows.Close()
+	if err != nil {
+		t.Fatalf("cannot get columns: %s", err)
+	}
+	if strings.Join(cols, ",") != "id,email,active,nickname" {
+		t.Fatalf("expected rolled back column to be removed, got %v", cols)
+	}
+
+	var email string
+	err = db.QueryRow(`SELECT email FROM account WHERE id = 1`).Scan(&email)
+	if err != nil || email != "foo@bar.com" {
+		t.Fatalf("expected rows to be restored, got %s (%v)", email, err)
+	}
+}
+
+func TestAlterTableDropColumn(t *testing.T) {
+
+	db, err := sql.Open("ramsql", "TestAlterTableDropColumn")
+	if err != nil {
+		t.Fatalf("sql.Open : Error : %s\n", err)
+	}
+	defer db.Close()
+
+	batch := []string{
+		`CREATE TABLE account (id BIGSERIAL PRIMARY KEY, email TEXT UNIQUE, name TEXT, age INT)`,
+		`CREATE INDEX account_name_idx ON account (name)`,
+		`INSERT INTO account (email, name, age) VALUES ('foo@bar.com', 'foo', 20)`,
+		`INSERT INTO account (email, name, age) VALUES ('bar@foo.com', 'bar', 30)`,
+	}
+	for _, b := range batch {
+		_, err = db.Exec(b)
+		if err != nil {
+			t.Fatalf("sql.Exec: Error: %s\n", err)
+		}
+	}
+
+	columns := func() string {
+		rows, err := db.Query(`SELECT * FROM account`)
+		if err != nil {
+			t.Fatalf("sql.Query: %s", err)
+		}
+		defer rows.Close()
+		cols, err := rows.Columns()
+		if err != nil {
+			t.Fatalf("cannot get columns: %s", err)
+		}
+		return strings.Join(cols, ",")
+	}
+
+	_, err = db.Exec(`ALTER TABLE account DROP COLUMN id`)
+	if err == nil {
+		t.Fatalf("expected error dropping primary key column")
+	}
+	_, err = db.Exec(`ALTER TABLE account DROP COLUMN unknown`)
+	if err == nil {
+		t.Fatalf("expected error dropping unknown column")
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatalf("cannot begin transaction: %s", err)
+	}
+	_, err = tx.Exec(`ALTER TABLE account DROP COLUMN email`)
+	if err != nil {
+		t.Fatalf("cannot drop column in transaction: %s", err)
+	}
+	_, err = tx.Exec(`DELETE FROM account WHERE name = 'foo'`)
+	if err != nil {
+		t.Fatalf("cannot delete after drop: %s", err)
+	}
+	if err = tx.Rollback(); err != nil {
+		t.Fatalf("cannot rollback: %s", err)
+	}
+
+	if cols := columns(); cols != "id,email,name,age" {
+		t.Fatalf("expected dropped column to be restored, got %s", cols)
+	}
+	var name string
+	var age int
+	err = db.QueryRow(`SELECT name FROM account WHERE email = 'foo@bar.com'`).Scan(&name)
+	if err != nil || name != "foo" {
+		t.Fatalf("expected row to be restored, got %s (%v)", name, err)
+	}
+	_, err = db.Exec(`INSERT INTO account (email, name, age) VALUES ('foo@bar.com', 'baz', 40)`)
+	if err == nil {
+		t.Fatalf("expected unique constraint to be restored")
+	}
+
+	// adding the column back replaces every row tuple before rollback
+	tx, err = db.Begin()
+	if err != nil {
+		t.Fatalf("cannot begin transaction: %s", err)
+	}
+	_, err = tx.Exec(`ALTER TABLE account DROP COLUMN email`)
+	if err != nil {
+		t.Fatalf("cannot drop column in transaction: %s", err)
+	}
+	_, err = tx.Exec(`ALTER TABLE account ADD COLUMN email TEXT`)
+	if err != nil {
+		t.Fatalf("cannot add column back in transaction: %s", err)
+	}
+	if err = tx.Rollback(); err != nil {
+		t.Fatalf("cannot rollback: %s", err)
+	}
+	if cols := columns(); cols != "id,email,name,age" {
+		t.Fatalf("expected dropped column to be restored, got %s", cols)
+	}
+	var email string
+	err = db.QueryRow(`SELECT email, name, age FROM account WHERE id = 2`).Scan(&email, &name, &age)
+	if err != nil || email != "bar@foo.com" || name != "bar" || age != 30 {
+		t.Fatalf("expected row values to be restored, got %s %s %d (%v)", email, name, age, err)
+	}
+
+	_, err = db.Exec(`ALTER TABLE account DROP name`)
+	if err != nil {
+		t.Fatalf("cannot drop column: %s", err)
+	}
+	if cols := columns(); cols != "id,email,age" {
+		t.Fatalf("expected name column to be dropped, got %s", cols)
+	}
+
+	err = db.QueryRow(`SELECT age FROM account WHERE email = 'bar@foo.com'`).Scan(&age)
+	if err != nil || age != 30 {
+		t.Fatalf("expected remaining values to be kept, got %d (%v)", age, err)
+	}
+
+	_, err = db.Exec(`DROP INDEX account_name_idx`)
+	if err == nil {
+		t.Fatalf("expected index over dropped column to be dropped")
+	}
+}
+
+func TestAlterTableRename(t *testing.T) {
+
+	db, err := sql.Open("ramsql", "TestAlterTableRename")
+	if err != nil {
+		t.Fatalf("sql.Open : Error : %s\n", err)
+	}
+	defer db.Close()
+
+	batch := []string{
+		`CREATE TABLE account (id BIGSERIAL PRIMARY KEY, email TEXT UNIQUE)`,
+		`CREATE TABLE team (name TEXT)`,
+		`CREATE INDEX account_email_idx ON account (email)`,
+		`INSERT INTO account (email) VALUES ('foo@bar.com')`,
+		`ALTER TABLE account RENAME TO users`,
+		`ALTER TABLE users RENAME COLUMN email TO mail`,
+	}
+	for _, b := range batch {
+		_, err = db.Exec(b)
+		if err != nil {
+			t.Fatalf("sql.Exec: Error: %s\n", err)
+		}
+	}
+
+	var mail string
+	err = db.QueryRow(`SELECT mail FROM users WHERE mail = 'foo@bar.com'`).Scan(&mail)
+	if err != nil {
+		t.Fatalf("cannot select renamed column: %s", err)
+	}
+	_, err = db.Query(`SELECT * FROM account`)
+	if err == nil {
+		t.Fatalf("expected old relation name to be unknown")
+	}
+
+	_, err = db.Exec(`INSERT INTO users (mail) VALUES ('foo@bar.com')`)
+	if err == nil {
+		t.Fatalf("expected unique constraint to follow renamed column")
+	}
+	_, err = db.Exec(`INSERT INTO users (mail) VALUES ('bar@foo.com')`)
+	if err != nil {
+		t.Fatalf("cannot insert into renamed relation: %s", err)
+	}
+
+	_, err = db.Exec(`ALTER TABLE users RENAME TO team`)
+	if err == nil {
+		t.Fatalf("expected error renaming relation to existing name")
+	}
+	_, err = db.Exec(`ALTER TABLE users RENAME id TO mail`)
+	if err == nil {
+		t.Fatalf("expected error renaming column to existing name")
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatalf("cannot begin transaction: %s", err)
+	}
+	_, err = tx.Exec(`ALTER TABLE users RENAME COLUMN mail TO email`)
+	if err != nil {
+		t.Fatalf("cannot rename column in transaction: %s", err)
+	}
+	_, err = tx.Exec(`ALTER TABLE users RENAME TO account`)
+	if err != nil {
+		t.Fatalf("cannot rename relation in transaction: %s", err)
+	}
+	_, err = tx.Exec(`INSERT INTO account (email) VALUES ('baz@foo.com')`)
+	if err != nil {
+		t.Fatalf("cannot insert into renamed relation in transaction: %s", err)
+	}
+	if err = tx.Rollback(); err != nil {
+		t.Fatalf("cannot rollback: %s", err)
+	}
+
+	var n int
+	err = db.QueryRow(`SELECT COUNT(*) FROM users WHERE mail <> 'nobody'`).Scan(&n)
+	if err != nil {
+		t.Fatalf("expected rename to be rolled back: %s", err)
+	}
+	if n != 2 {
+		t.Fatalf("expected 2 rows, got %d", n)
+	}
+
+	_, err = db.Exec(`DROP INDEX account_email_idx`)
+	if err != nil {
+		t.Fatalf("cannot drop index of renamed relation: %s", err)
+	}
+}
+
+func TestTruncateRollback(t *testing.T) {
+
+	db, err := sql.Open("ramsql", "TestTruncateRollback")
+	if err != nil {
+		t.Fatalf("sql.Open : Error : %s\n", err)
+	}
+	defer db.Close()
+
+	batch := []string{
+		`CREATE TABLE champion (id BIGSERIAL PRIMARY KEY, name TEXT UNIQUE)`,
+		`INSERT INTO champion (name) VALUES ('foo')`,
+		`INSERT INTO champion (name) VALUES ('bar')`,
+	}
+	for _, b := range batch {
+		_, err = db.Exec(b)
+		if err != nil {
+			t.Fatalf("sql.Exec: Error: %s\n", err)
+		}
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatalf("cannot begin transaction: %s", err)
+	}
+	_, err = tx.Exec(`INSERT INTO champion (name) VALUES ('baz')`)
+	if err != nil {
+		t.Fatalf("cannot insert: %s", err)
+	}
+	res, err := tx.Exec(`TRUNCATE TABLE champion RESTART IDENTITY`)
+	if err != nil {
+		t.Fatalf("cannot truncate: %s", err)
+	}
+	if n, _ := res.RowsAffected(); n != 3 {
+		t.Fatalf("expected 3 truncated rows, got %d", n)
+	}
+	var n int
+	err = tx.QueryRow(`SELECT COUNT(*) FROM champion WHERE name <> 'nobody'`).Scan(&n)
+	if err != nil || n != 0 {
+		t.Fatalf("expected no rows in transaction, got %d (%v)", n, err)
+	}
+	_, err = tx.Exec(`INSERT INTO champion (name) VALUES ('foo')`)
+	if err != nil {
+		t.Fatalf("cannot insert after truncate: %s", err)
+	}
+	if err = tx.Rollback(); err != nil {
+		t.Fatalf("cannot rollback: %s", err)
+	}
+
+	err = db.QueryRow(`SELECT COUNT(*) FROM champion WHERE name <> 'nobody'`).Scan(&n)
+	if err != nil || n != 2 {
+		t.Fatalf("expected 2 rows restored, got %d (%v)", n, err)
+	}
+
+	var name string
+	err = db.QueryRow(`SELECT name FROM champion WHERE id = 2`).Scan(&name)
+	if err != nil || name != "bar" {
+		t.Fatalf("expected primary key index to be restored, got %s (%v)", name, err)
+	}
+	var id int64
+	err = db.QueryRow(`INSERT INTO champion (name) VALUES ('qux') RETURNING id`).Scan(&id)
+	if err != nil {
+		t.Fatalf("cannot insert: %s", err)
+	}
+	if id != 4 {
+		t.Fatalf("expected identity to be restored, got id %d", id)
+	}
+
+	_, err = db.Exec(`INSERT INTO champion (name) VALUES ('foo')`)
+	if err == nil {
+		t.Fatalf("expected unique index to be restored")
+	}
+}
+
+func TestIfExists(t *testing.T) {
+
+	db, err := sql.Open("ramsql", "TestIfExists")
+	if err != nil {
+		t.Fatalf("sql.Open : Error : %s\n", err)
+	}
+	defer db.Close()
+
+	batch := []string{
+		`CREATE SCHEMA app`,
+		`CREATE TABLE team (id INT)`,
+		`CREATE TABLE app.team (name TEXT)`,
+		`CREATE TABLE IF NOT EXISTS team (id INT, unknown UNKNOWNTYPE)`,
+		`INSERT INTO team (id) VALUES (1)`,
+		`DROP TABLE IF EXISTS champion`,
+		`DROP TABLE IF EXISTS app.champion`,
+		`DROP SCHEMA IF EXISTS foo`,
+		`DROP INDEX IF EXISTS champion_idx`,
+		`DROP SEQUENCE IF EXISTS champion_seq`,
+		`DROP TABLE app.team`,
+		`DROP TABLE IF EXISTS app.team`,
+	}
+	for _, b := range batch {
+		_, err = db.Exec(b)
+		if err != nil {
+			t.Fatalf("sql.Exec: %s: Error: %s\n", b, err)
+		}
+	}
+
+	var id int
+	err = db.QueryRow(`SELECT id FROM team`).Scan(&id)
+	if err != nil || id != 1 {
+		t.Fatalf("expected public.team to be kept, got %d (%v)", id, err)
+	}
+
+	_, err = db.Exec(`DROP TABLE champion`)
+	if err == nil {
+		t.Fatalf("expected error dropping unknown relation without IF EXISTS")
+	}
+}
+
+func TestCreateTableAsSelect(t *testing.T) {
+
+	db, err := sql.Open("ramsql", "TestCreateTableAsSelect")
+	if err != nil {
+		t.Fatalf("sql.Open : Error : %s\n", err)
+	}
+	defer db.Close()
+
+	batch := []string{
+		`CREATE TABLE champion (id BIGSERIAL PRIMARY KEY, user_id INT NOT NULL, name TEXT UNIQUE, power FLOAT)`,
+		`INSERT INTO champion (user_id, name, power) VALUES (1, 'foo', 1.5)`,
+		`INSERT INTO champion (user_id, name, power) VALUES (1, 'bar', 2.5)`,
+		`INSERT INTO champion (user_id, name, power) VALUES (2, 'baz', 3.5)`,
+	}
+	for _, b := range batch {
+		_, err = db.Exec(b)
+		if err != nil {
+			t.Fatalf("sql.Exec: Error: %s\n", err)
+		}
+	}
+
+	res, err := db.Exec(`CREATE TABLE top_users (user_id, champion) AS SELECT user_id, name FROM champion WHERE power > 2.0`)
+	if err != nil {
+		t.Fatalf("cannot create table as select: %s", err)
+	}
+	if n, _ := res.RowsAffected(); n != 2 {
+		t.Fatalf("expected 2 inserted rows, got %d", n)
+	}
+	_, err = db.Exec(`CREATE TABLE stats AS SELECT COUNT(*) FROM champion WHERE user_id = 1`)
+	if err != nil {
+		t.Fatalf("cannot create table as select: %s", err)
+	}
+
+	describe := func(relation string) string {
+		rows, err := db.Query(`DESCRIBE ` + relation)
+		if err != nil {
+			t.Fatalf("sql.Query: %s", err)
+		}
+		defer rows.Close()
+
+		var fields []string
+		for rows.Next() {
+			var field, typ, null, key, extra string
+			var def sql.NullString
+			if err := rows.Scan(&field, &typ, &null, &key, &def, &extra); err != nil {
+				t.Fatalf("cannot scan field: %s", err)
+			}
+			fields = append(fields, strings.Join([]string{field, typ, null, key}, ":"))
+		}
+		return strings.Join(fields, ",")
+	}
+
+	if fields := describe("top_users"); fields != "user_id:INT:YES:,champion:TEXT:YES:" {
+		t.Fatalf("unexpected top_users fields: %s", fields)
+	}
+	if fields := describe("stats"); fields != "count:BIGINT:YES:" {
+		t.Fatalf("unexpected stats fields: %s", fields)
+	}
+
+	var n int64
+	err = db.QueryRow(`SELECT * FROM stats`).Scan(&n)
+	if err != nil || n != 2 {
+		t.Fatalf("expected 2 champions for user 1, got %d (%v)", n, err)
+	}
+	var name string
+	err = db.QueryRow(`SELECT champion FROM top_users WHERE user_id = 2`).Scan(&name)
+	if err != nil || name != "baz" {
+		t.Fatalf("expected baz for user 2, got %s (%v)", name, err)
+	}
+
+	_, err = db.Exec(`CREATE TABLE champion_copy AS SELECT * FROM champion WHERE power > 2.0`)
+	if err != nil {
+		t.Fatalf("cannot create table as select: %s", err)
+	}
+	// constraints are not copied
+	_, err = db.Exec(`INSERT INTO champion_copy (id, user_id, name, power) VALUES (2, NULL, 'bar', NULL)`)
+	if err != nil {
+		t.Fatalf("expected champion_copy to have no constraint: %s", err)
+	}
+	err = db.QueryRow(`SELECT COUNT(*) FROM champion_copy WHERE name = 'bar'`).Scan(&n)
+	if err != nil || n != 2 {
+		t.Fatalf("expected 2 rows named bar, got %d (%v)", n, err)
+	}
+
+	// computed columns are named after their alias and typed after their result
+	_, err = db.Exec(`CREATE TABLE totals AS SELECT COUNT(*) AS n, SUM(power) AS total, MAX(name) AS last FROM champion`)
+	if err != nil {
+		t.Fatalf("cannot create table as select: %s", err)
+	}
+	if fields := describe("totals"); fields != "n:BIGINT:YES:,total:FLOAT:YES:,last:TEXT:YES:" {
+		t.Fatalf("unexpected totals fields: %s", fields)
+	}
+	var total float64
+	err = db.QueryRow(`SELECT n, total, last FROM totals`).Scan(&n, &total, &name)
+	if err != nil || n != 3 || total != 7.5 || name != "foo" {
+		t.Fatalf("expected 3, 7.5, foo, got %d, %f, %s (%v)", n, total, name, err)
+	}
+
+	// GROUP BY is not supported yet
+	_, err = db.Exec(`CREATE TABLE per_user AS SELECT user_id, COUNT(*) AS n FROM champion GROUP BY user_id`)
+	if err == nil {
+		t.Fatalf("expected error creating table from a grouped query")
+	}
+
+	_, err = db.Exec(`CREATE TABLE top_users AS SELECT * FROM champion`)
+	if err == nil {
+		t.Fatalf("expected error creating existing relation")
+	}
+}
+
+func TestScalarSubquery(t *testing.T) {
+	db, err := sql.Open("ramsql", "TestScalarSubquery")
+	if err != nil {
+		t.Fatalf("sql.Open : Error : %s\n", err)
+	}
+	defer db.Close()
+
+	batch := []string{
+		`CREATE TABLE account (id BIGSERIAL PRIMARY KEY, email TEXT)`,
+		`CREATE TABLE champion (id BIGSERIAL PRIMARY KEY, user_id BIGINT, name TEXT)`,
+		`INSERT INTO account (email) VALUES ('foo@bar.com')`,
+		`INSERT INTO account (email) VALUES ('bar@baz.com')`,
+		`INSERT INTO champion (user_id, name) VALUES (1, 'foo')`,
+		`INSERT INTO champion (user_id, name) VALUES (1, 'bar')`,
+		`INSERT INTO champion (user_id, name) VALUES (2, 'baz')`,
+	}
+	for _, b := range batch {
+		_, err = db.Exec(b)
+		if err != nil {
+			t.Fatalf("sql.Exec: Error: %s\n", err)
+		}
+	}
+
+	rows, err := db.Query(`SELECT name FROM champion WHERE user_id = (SELECT id FROM account WHERE email = 'foo@bar.com') ORDER BY name`)
+	if err != nil {
+		t.Fatalf("cannot query with scalar subquery: %s", err)
+	}
+	var names []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			t.Fatalf("cannot scan: %s", err)
+		}
+		names = append(names, name)
+	}
+	rows.Close()
+	if strings.Join(names, ",") != "bar,foo" {
+		t.Fatalf("expected bar,foo, got %v", names)
+	}
+
+	// subquery returning no row yields NULL, which matches nothing
+	var n int64
+	err = db.QueryRow(`SELECT COUNT(*) FROM champion WHERE user_id = (SELECT id FROM account WHERE email = 'nobody')`).Scan(&n)
+	if err != nil || n != 0 {
+		t.Fatalf("expected no champion, got %d (%v)", n, err)
+	}
+
+	_, err = db.Query(`SELECT name FROM champion WHERE user_id = (SELECT id FROM account)`)
+	if err == nil {
+		t.Fatalf("expected error with subquery returning more than one row")
+	}
+
+	_, err = db.Exec(`DELETE FROM champion WHERE user_id = (SELECT id FROM account WHERE email = 'bar@baz.com')`)
+	if err != nil {
+		t.Fatalf("cannot delete with scalar subquery: %s", err)
+	}
+
+	var name string
+	var total int64
+	err = db.QueryRow(`SELECT name, (SELECT COUNT(*) FROM account) FROM champion WHERE name = 'foo'`).Scan(&name, &total)
+	if err != nil {
+		t.Fatalf("cannot select scalar subquery: %s", err)
+	}
+	if name != "foo" || total != 2 {
+		t.Fatalf("expected foo and 2, got %s and %d", name, total)
+	}
+}
+
+func TestInExistsSubquery(t *testing.T) {
+	db, err := sql.Open("ramsql", "TestInExistsSubquery")
+	if err != nil {
+		t.Fatalf("sql.Open : Error : %s\n", err)
+	}
+	defer db.Close()
+
+	batch := []string{
+		`CREATE TABLE account (id BIGSERIAL PRIMARY KEY, email TEXT)`,
+		`CREATE TABLE champion (id BIGSERIAL PRIMARY KEY, user_id BIGINT, name TEXT)`,
+		`CREATE INDEX champion_user_id_idx ON champion (user_id)`,
+		`INSERT INTO account (email) VALUES ('foo@bar.com')`,
+		`INSERT INTO account (email) VALUES ('bar@baz.com')`,
+		`INSERT INTO account (email) VALUES ('baz@qux.com')`,
+		`INSERT INTO champion (user_id, name) VALUES (1, 'foo')`,
+		`INSERT INTO champion (user_id, name) VALUES (1, 'bar')`,
+		`INSERT INTO champion (user_id, name) VALUES (2, 'baz')`,
+	}
+	for _, b := range batch {
+		_, err = db.Exec(b)
+		if err != nil {
+			t.Fatalf("sql.Exec: Error: %s\n", err)
+		}
+	}
+
+	query := func(q string) string {
+		rows, err := db.Query(q)
+		if err != nil {
+			t.Fatalf("cannot query '%s': %s", q, err)
+		}
+		defer rows.Close()
+
+		var res []string
+		for rows.Next() {
+			var s string
+			if err := rows.Scan(&s); err != nil {
+				t.Fatalf("cannot scan: %s", err)
+			}
+			res = append(res, s)
+		}
+		return strings.Join(res, ",")
+	}
+
+	if res := query(`SELECT name FROM champion WHERE user_id IN (SELECT id FROM account WHERE email <> 'foo@bar.com') ORDER BY name`); res != "baz" {
+		t.Fatalf("expected baz, got %s", res)
+	}
+	if res := query(`SELECT name FROM champion WHERE user_id NOT IN (SELECT id FROM account WHERE email <> 'foo@bar.com') ORDER BY name`); res != "bar,foo" {
+		t.Fatalf("expected bar,foo, got %s", res)
+	}
+	if res := query(`SELECT email FROM account WHERE EXISTS (SELECT 1 FROM champion WHERE champion.user_id = account.id) ORDER BY email`); res != "bar@baz.com,foo@bar.com" {
+		t.Fatalf("expected accounts with champions, got %s", res)
+	}
+	if res := query(`SELECT email FROM account AS a WHERE NOT EXISTS (SELECT 1 FROM champion AS c WHERE a.id = c.user_id)`); res != "baz@qux.com" {
+		t.Fatalf("expected account without champion, got %s", res)
+	}
+	if res := query(`SELECT email FROM account WHERE EXISTS (SELECT 1 FROM champion WHERE name = 'nobody')`); res != "" {
+		t.Fatalf("expected no account, got %s", res)
+	}
+
+	// NULL in subquery result: nothing is NOT IN the set
+	_, err = db.Exec(`INSERT INTO champion (user_id, name) VALUES (NULL, 'qux')`)
+	if err != nil {
+		t.Fatalf("cannot insert: %s", err)
+	}
+	if res := query(`SELECT email FROM account WHERE id NOT IN (SELECT user_id FROM champion)`); res != "" {
+		t.Fatalf("expected no account, got %s", res)
+	}
+	if res := query(`SELECT email FROM account WHERE id IN (SELECT user_id FROM champion) ORDER BY email`); res != "bar@baz.com,foo@bar.com" {
+		t.Fatalf("expected accounts with champions, got %s", res)
+	}
+	// NULL is not NOT IN a non empty set
+	if res := query(`SELECT name FROM champion WHERE user_id NOT IN (SELECT id FROM account WHERE id = 3)`); res != "bar,baz,foo" && res != "foo,bar,baz" {
+		t.Fatalf("expected champions with a user, got %s", res)
+	}
+	// everything is NOT IN an empty set
+	if res := query(`SELECT COUNT(*) FROM champion WHERE user_id NOT IN (SELECT id FROM account WHERE id = 42)`); res != "4" {
+		t.Fatalf("expected 4 champions, got %s", res)
+	}
+
+	_, err = db.Exec(`DELETE FROM account WHERE NOT EXISTS (SELECT 1 FROM champion WHERE champion.user_id = account.id)`)
+	if err != nil {
+		t.Fatalf("cannot delete with correlated subquery: %s", err)
+	}
+	if res := query(`SELECT COUNT(*) FROM account`); res != "2" {
+		t.Fatalf("expected 2 accounts, got %s", res)
+	}
+}
+
+func TestUnion(t *testing.T) {
+	db, err := sql.Open("ramsql", "TestUnion")
+	if err != nil {
+		t.Fatalf("sql.Open : Error : %s\n", err)
+	}
+	defer db.Close()
+
+	batch := []string{
+		`CREATE TABLE account (id BIGSERIAL PRIMARY KEY, email TEXT)`,
+		`CREATE TABLE champion (id BIGSERIAL PRIMARY KEY, user_id BIGINT, name TEXT)`,
+		`INSERT INTO account (email) VALUES ('foo@bar.com')`,
+		`INSERT INTO account (email) VALUES ('bar@baz.com')`,
+		`INSERT INTO champion (user_id, name) VALUES (1, 'foo')`,
+		`INSERT INTO champion (user_id, name) VALUES (1, 'bar')`,
+		`INSERT INTO champion (user_id, name) VALUES (3, 'baz')`,
+	}
+	for _, b := range batch {
+		_, err = db.Exec(b)
+		if err != nil {
+			t.Fatalf("sql.Exec: Error: %s\n", err)
+		}
+	}
+
+	query := func(q string) string {
+		rows, err := db.Query(q)
+		if err != nil {
+			t.Fatalf("cannot query '%s': %s", q, err)
+		}
+		defer rows.Close()
+
+		cols, err := rows.Columns()
+		if err != nil {
+			t.Fatalf("cannot get columns: %s", err)
+		}
+		res := []string{strings.Join(cols, ",")}
+		for rows.Next() {
+			var s string
+			if err := rows.Scan(&s); err != nil {
+				t.Fatalf("cannot scan: %s", err)
+			}
+			res = append(res, s)
+		}
+		return strings.Join(res, " ")
+	}
+
+	if res := query(`SELECT id FROM account UNION SELECT user_id FROM champion ORDER BY id`); res != "id 1 2 3" {
+		t.Fatalf("unexpected UNION result: %s", res)
+	}
+	if res := query(`SELECT id FROM account UNION ALL SELECT user_id FROM champion ORDER BY id DESC`); res != "id 3 2 1 1 1" {
+		t.Fatalf("unexpected UNION ALL result: %s", res)
+	}
+	if res := query(`SELECT user_id FROM champion UNION SELECT id FROM account UNION ALL SELECT user_id FROM champion WHERE name = 'baz' ORDER BY user_id LIMIT 3 OFFSET 1`); res != "user_id 2 3 3" {
+		t.Fatalf("unexpected chained UNION result: %s", res)
+	}
+	if res := query(`SELECT name FROM champion WHERE user_id IN (SELECT id FROM account WHERE id = 1 UNION SELECT id FROM account WHERE id = 3) ORDER BY name`); res != "name bar foo" {
+		t.Fatalf("unexpected UNION in subquery result: %s", res)
+	}
+
+	_, err = db.Query(`SELECT id, email FROM account UNION SELECT user_id FROM champion`)
+	if err == nil {
+		t.Fatalf("expected error with different number of columns")
+	}
+	_, err = db.Query(`SELECT id FROM account UNION SELECT name FROM champion`)
+	if err == nil {
+		t.Fatalf("expected error with incompatible column types")
+	}
+	_, err = db.Query(`SELECT id FROM account ORDER BY id UNION SELECT user_id FROM champion`)
+	if err == nil {
+		t.Fatalf("expected error with ORDER BY before UNION")
+	}
+}
+
+func TestIntersectExcept(t *testing.T) {
+	db, err := sql.Open("ramsql", "TestIntersectExcept")
+	if err != nil {
+		t.Fatalf("sql.Open : Error : %s\n", err)
+	}
+	defer db.Close()
+
+	batch := []string{
+		`CREATE TABLE a (id BIGSERIAL PRIMARY KEY, v BIGINT)`,
+		`CREATE TABLE b (id BIGSERIAL PRIMARY KEY, v BIGINT)`,
+		`INSERT INTO a (v) VALUES (1)`,
+		`INSERT INTO a (v) VALUES (1)`,
+		`INSERT INTO a (v) VALUES (1)`,
+		`INSERT INTO a (v) VALUES (2)`,
+		`INSERT INTO a (v) VALUES (3)`,
+		`INSERT INTO a (v) VALUES (NULL)`,
+		`INSERT INTO b (v) VALUES (1)`,
+		`INSERT INTO b (v) VALUES (1)`,
+		`INSERT INTO b (v) VALUES (3)`,
+		`INSERT INTO b (v) VALUES (4)`,
+		`INSERT INTO b (v) VALUES (NULL)`,
+	}
+	for _, b := range batch {
+		_, err = db.Exec(b)
+		if err != nil {
+			t.Fatalf("sql.Exec: Error: %s\n", err)
+		}
+	}
+
+	query := func(q string) string {
+		rows, err := db.Query(q)
+		if err != nil {
+			t.Fatalf("cannot query '%s': %s", q, err)
+		}
+		defer rows.Close()
+
+		var res []string
+		for rows.Next() {
+			var v sql.NullInt64
+			if err := rows.Scan(&v); err != nil {
+				t.Fatalf("cannot scan: %s", err)
+			}
+			if !v.Valid {
+				res = append(res, "NULL")
+				continue
+			}
+			res = append(res, fmt.Sprint(v.Int64))
+		}
+		return strings.Join(res, ",")
+	}
+
+	tests := []struct {
+		query    string
+		expected string
+	}{
+		// NULL values are equal for set operations
+		{`SELECT v FROM a INTERSECT SELECT v FROM b ORDER BY v`, "NULL,1,3"},
+		{`SELECT v FROM a INTERSECT ALL SELECT v FROM b ORDER BY v`, "NULL,1,1,3"},
+		{`SELECT v FROM a EXCEPT SELECT v FROM b ORDER BY v`, "2"},
+		{`SELECT v FROM a EXCEPT ALL SELECT v FROM b ORDER BY v`, "1,2"},
+		{`SELECT v FROM b EXCEPT SELECT v FROM a`, "4"},
+		// empty result
+		{`SELECT v FROM a WHERE v = 2 INTERSECT SELECT v FROM b`, ""},
+		{`SELECT v FROM a WHERE v = 42 EXCEPT SELECT v FROM b`, ""},
+		{`SELECT v FROM a EXCEPT SELECT v FROM a`, ""},
+		// fully overlapping
+		{`SELECT v FROM a INTERSECT SELECT v FROM a ORDER BY v`, "NULL,1,2,3"},
+		{`SELECT v FROM a INTERSECT ALL SELECT v FROM a ORDER BY v`, "NULL,1,1,1,2,3"},
+		{`SELECT v FROM a EXCEPT SELECT v FROM b WHERE v = 42 ORDER BY v`, "NULL,1,2,3"},
+		// INTERSECT binds tighter than UNION and EXCEPT
+		{`SELECT v FROM b WHERE v = 4 UNION SELECT v FROM a INTERSECT SELECT v FROM b WHERE v = 3`, "4,3"},
+		{`SELECT v FROM a EXCEPT SELECT v FROM a WHERE v = 1 EXCEPT SELECT v FROM b ORDER BY v`, "2"},
+	}
+
+	for _, test := range tests {
+		if res := query(test.query); res != test.expected {
+			t.Fatalf("%s: expected %s, got %s", test.query, test.expected, res)
+		}
+	}
+
+	_, err = db.Query(`SELECT id, v FROM a INTERSECT SELECT v FROM b`)
+	if err == nil {
+		t.Fatalf("expected error with different number of columns")
+	}
+}
+
+func TestWith(t *testing.T) {
+	db, err := sql.Open("ramsql", "TestWith")
+	if err != nil {
+		t.Fatalf("sql.Open : Error : %s\n", err)
+	}
+	defer db.Close()
+
+	batch := []string{
+		`CREATE TABLE account (id BIGSERIAL PRIMARY KEY, email TEXT)`,
+		`CREATE TABLE champion (id BIGSERIAL PRIMARY KEY, user_id BIGINT, name TEXT)`,
+		`INSERT INTO account (email) VALUES ('foo@bar.com')`,
+		`INSERT INTO account (email) VALUES ('bar@baz.com')`,
+		`INSERT INTO account (email) VALUES ('baz@qux.com')`,
+		`INSERT INTO champion (user_id, name) VALUES (1, 'foo')`,
+		`INSERT INTO champion (user_id, name) VALUES (1, 'bar')`,
+		`INSERT INTO champion (user_id, name) VALUES (2, 'baz')`,
+	}
+	for _, b := range batch {
+		_, err = db.Exec(b)
+		if err != nil {
+			t.Fatalf("sql.Exec: Error: %s\n", err)
+		}
+	}
+
+	query := func(q string) string {
+		rows, err := db.Query(q)
+		if err != nil {
+			t.Fatalf("cannot query '%s': %s", q, err)
+		}
+		defer rows.Close()
+
+		var res []string
+		for rows.Next() {
+			var s string
+			if err := rows.Scan(&s); err != nil {
+				t.Fatalf("cannot scan: %s", err)
+			}
+			res = append(res, s)
+		}
+		return strings.Join(res, ",")
+	}
+
+	if res := query(`WITH active AS (SELECT * FROM account WHERE id > 1) SELECT email FROM active ORDER BY email`); res != "bar@baz.com,baz@qux.com" {
+		t.Fatalf("unexpected result: %s", res)
+	}
+
+	// later expressions can reference previous ones, and shadow relations
+	res := query(`WITH owners (uid) AS (SELECT user_id FROM champion), account AS (SELECT * FROM account WHERE id IN (SELECT uid FROM owners))
+		SELECT email FROM account WHERE id NOT IN (SELECT uid FROM owners WHERE uid = 2) ORDER BY email`)
+	if res != "foo@bar.com" {
+		t.Fatalf("unexpected result with several expressions: %s", res)
+	}
+
+	// expression can be joined with relations
+	res = query(`WITH named AS (SELECT user_id, name FROM champion WHERE name <> 'bar')
+		SELECT named.name FROM account JOIN named ON account.id = named.user_id WHERE account.email = 'foo@bar.com'`)
+	if res != "foo" {
+		t.Fatalf("unexpected result with join: %s", res)
+	}
+
+	// materialized relations do not outlive the statement
+	if res := query(`SELECT COUNT(*) FROM account`); res != "3" {
+		t.Fatalf("expected 3 accounts, got %s", res)
+	}
+	_, err = db.Query(`SELECT * FROM owners`)
+	if err == nil {
+		t.Fatalf("expected error selecting from expression of previous statement")
+	}
+
+	_, err = db.Exec(`WITH gone AS (SELECT id FROM account WHERE email = 'baz@qux.com') DELETE FROM account WHERE id IN (SELECT id FROM gone)`)
+	if err != nil {
+		t.Fatalf("cannot delete with common table expression: %s", err)
+	}
+	if res := query(`SELECT COUNT(*) FROM account`); res != "2" {
+		t.Fatalf("expected 2 accounts, got %s", res)
+	}
+
+	_, err = db.Query(`WITH a AS (SELECT id FROM account), a AS (SELECT id FROM champion) SELECT * FROM a`)
+	if err == nil {
+		t.Fatalf("expected error with expression specified twice")
+	}
+}
+
+func TestWithRecursive(t *testing.T) {
+	db, err := sql.Open("ramsql", "TestWithRecursive")
+	if err != nil {
+		t.Fatalf("sql.Open : Error : %s\n", err)
+	}
+	defer db.Close()
+
+	batch := []string{
+		`CREATE TABLE employee (id BIGINT PRIMARY KEY, manager_id BIGINT)`,
+		`CREATE TABLE edge (src BIGINT, dst BIGINT)`,
+		`INSERT INTO employee (id, manager_id) VALUES (1, NULL)`,
+		`INSERT INTO employee (id, manager_id) VALUES (2, 1)`,
+		`INSERT INTO employee (id, manager_id) VALUES (3, 1)`,
+		`INSERT INTO employee (id, manager_id) VALUES (4, 2)`,
+		`INSERT INTO employee (id, manager_id) VALUES (5, 4)`,
+		`INSERT INTO edge (src, dst) VALUES (1, 2)`,
+		`INSERT INTO edge (src, dst) VALUES (2, 3)`,
+		`INSERT INTO edge (src, dst) VALUES (3, 1)`,
+	}
+	for _, b := range batch {
+		_, err = db.Exec(b)
+		if err != nil {
+			t.Fatalf("sql.Exec: Error: %s\n", err)
+		}
+	}
+
+	query := func(q string) string {
+		rows, err := db.Query(q)
+		if err != nil {
+			t.Fatalf("cannot query '%s': %s", q, err)
+		}
+		defer rows.Close()
+
+		var res []string
+		for rows.Next() {
+			var s string
+			if err := rows.Scan(&s); err != nil {
+				t.Fatalf("cannot scan: %s", err)
+			}
+			res = append(res, s)
+		}
+		return strings.Join(res, ",")
+	}
+
+	res := query(`WITH RECURSIVE chain (id) AS (
+		SELECT id FROM employee WHERE id = 2
+		UNION ALL
+		SELECT employee.id FROM employee JOIN chain ON employee.manager_id = chain.id)
+		SELECT id FROM chain ORDER BY id`)
+	if res != "2,4,5" {
+		t.Fatalf("unexpected reports of employee 2: %s", res)
+	}
+
+	// UNION discards rows already seen, so walking a cycle terminates
+	res = query(`WITH RECURSIVE reach AS (
+		SELECT dst FROM edge WHERE src = 1
+		UNION
+		SELECT edge.dst FROM edge JOIN reach ON edge.src = reach.dst)
+		SELECT dst FROM reach ORDER BY dst`)
+	if res != "1,2,3" {
+		t.Fatalf("unexpected reachable nodes: %s", res)
+	}
+
+	_, err = db.Query(`WITH RECURSIVE reach AS (
+		SELECT dst FROM edge WHERE src = 1
+		UNION ALL
+		SELECT edge.dst FROM edge JOIN reach ON edge.src = reach.dst)
+		SELECT dst FROM reach`)
+	if err == nil {
+		t.Fatalf("expected error walking a cycle with UNION ALL")
+	}
+
+	// expressions of a recursive WITH may not be recursive
+	res = query(`WITH RECURSIVE managers AS (SELECT manager_id FROM employee WHERE manager_id IS NOT NULL)
+		SELECT COUNT(*) FROM managers`)
+	if res != "4" {
+		t.Fatalf("unexpected number of managed employees: %s", res)
+	}
+}
+
+func TestAliases(t *testing.T) {
+	db, err := sql.Open("ramsql", "TestAliases")
+	if err != nil {
+		t.Fatalf("sql.Open : Error : %s\n", err)
+	}
+	defer db.Close()
+
+	batch := []string{
+		`CREATE TABLE account (id BIGSERIAL PRIMARY KEY, email TEXT)`,
+		`CREATE TABLE champion (id BIGSERIAL PRIMARY KEY, user_id BIGINT, name TEXT)`,
+		`INSERT INTO account (email) VALUES ('foo@bar.com')`,
+		`INSERT INTO account (email) VALUES ('bar@baz.com')`,
+		`INSERT INTO champion (user_id, name) VALUES (1, 'foo')`,
+		`INSERT INTO champion (user_id, name) VALUES (2, 'bar')`,
+	}
+	for _, b := range batch {
+		_, err = db.Exec(b)
+		if err != nil {
+			t.Fatalf("sql.Exec: Error: %s\n", err)
+		}
+	}
+
+	rows, err := db.Query(`SELECT a.id AS account_id, a.email mail FROM account AS a WHERE a.id = 1`)
+	if err != nil {
+		t.Fatalf("cannot select with aliases: %s", err)
+	}
+	cols, err := rows.Columns()
+	if err != nil {
+		t.Fatalf("cannot get columns: %s", err)
+	}
+	if len(cols) != 2 || cols[0] != "account_id" || cols[1] != "mail" {
+		t.Fatalf("unexpected columns: %v", cols)
+	}
+	rows.Close()
+
+	var name string
+	var id int64
+	err = db.QueryRow(`SELECT a.id, c.name AS champion FROM account a JOIN champion AS c ON c.user_id = a.id WHERE a.email = 'bar@baz.com'`).Scan(&id, &name)
+	if err != nil {
+		t.Fatalf("cannot join with aliases: %s", err)
+	}
+	if id != 2 || name != "bar" {
+		t.Fatalf("unexpected join result: %d %s", id, name)
+	}
+
+	// columns selected through a relation or subquery alias are named after
+	// the attribute, as without alias
+	for _, q := range []string{
+		`SELECT account.id, account.email FROM account`,
+		`SELECT a.id, a.email FROM account a`,
+		`SELECT s.id, s.email FROM (SELECT id, email FROM account) AS s`,
+	} {
+		rows, err = db.Query(q)
+		if err != nil {
+			t.Fatalf("cannot query '%s': %s", q, err)
+		}
+		cols, err = rows.Columns()
+		if err != nil {
+			t.Fatalf("cannot get columns: %s", err)
+		}
+		rows.Close()
+		if len(cols) != 2 || cols[0] != "id" || cols[1] != "email" {
+			t.Fatalf("unexpected columns with '%s': %v", q, cols)
+		}
+	}
+
+	var total int64
+	err = db.QueryRow(`SELECT COUNT(*) AS total FROM account`).Scan(&total)
+	if err != nil {
+		t.Fatalf("cannot select aliased count: %s", err)
+	}
+	if total != 2 {
+		t.Fatalf("expected 2 accounts, got %d", total)
+	}
+
+	// duplicate column aliases are allowed
+	rows, err = db.Query(`SELECT id AS x, email AS x FROM account`)
+	if err != nil {
+		t.Fatalf("cannot select with duplicate column aliases: %s", err)
+	}
+	rows.Close()
+
+	_, err = db.Query(`SELECT a.id FROM account AS a JOIN champion AS a ON a.id = a.user_id`)
+	if err == nil {
+		t.Fatalf("expected error with conflicting table aliases")
+	}
+	_, err = db.Query(`SELECT account.id FROM account JOIN champion AS account ON account.id = account.user_id`)
+	if err == nil {
+		t.Fatalf("expected error with table alias conflicting with relation name")
+	}
+}
+
+func TestSelfJoin(t *testing.T) {
+	db, err := sql.Open("ramsql", "TestSelfJoin")
+	if err != nil {
+		t.Fatalf("sql.Open : Error : %s\n", err)
+	}
+	defer db.Close()
+
+	batch := []string{
+		`CREATE TABLE employee (id BIGINT PRIMARY KEY, name TEXT, manager_id BIGINT)`,
+		`INSERT INTO employee (id, name, manager_id) VALUES (1, 'boss', NULL)`,
+		`INSERT INTO employee (id, name, manager_id) VALUES (2, 'mid', 1)`,
+		`INSERT INTO employee (id, name, manager_id) VALUES (3, 'low', 2)`,
+		`INSERT INTO employee (id, name, manager_id) VALUES (4, 'other', 2)`,
+	}
+	for _, b := range batch {
+		_, err = db.Exec(b)
+		if err != nil {
+			t.Fatalf("sql.Exec: Error: %s\n", err)
+		}
+	}
+
+	query := func(q string) string {
+		rows, err := db.Query(q)
+		if err != nil {
+			t.Fatalf("cannot query '%s': %s", q, err)
+		}
+		defer rows.Close()
+
+		var res []string
+		for rows.Next() {
+			var e, m string
+			if err := rows.Scan(&e, &m); err != nil {
+				t.Fatalf("cannot scan: %s", err)
+			}
+			res = append(res, e+">"+m)
+		}
+		return strings.Join(res, ",")
+	}
+
+	res := query(`SELECT e.name, m.name FROM employee e JOIN employee m ON e.manager_id = m.id ORDER BY e.id`)
+	if res != "mid>boss,low>mid,other>mid" {
+		t.Fatalf("unexpected managers: %s", res)
+	}
+
+	// predicates apply to the aliased side only
+	res = query(`SELECT e.name, m.name AS manager FROM employee AS e JOIN employee AS m ON m.id = e.manager_id WHERE m.id = 2 AND e.id > 3`)
+	if res != "other>mid" {
+		t.Fatalf("unexpected result with predicates: %s", res)
+	}
+
+	// only one side needs an alias
+	res = query(`SELECT employee.name, m.name FROM employee JOIN employee m ON employee.manager_id = m.id WHERE employee.id = 3`)
+	if res != "low>mid" {
+		t.Fatalf("unexpected result with one alias: %s", res)
+	}
+
+	res = query(`SELECT e.name, b.name FROM employee e JOIN employee m ON e.manager_id = m.id JOIN employee b ON m.manager_id = b.id ORDER BY e.id`)
+	if res != "low>boss,other>boss" {
+		t.Fatalf("unexpected result with 2 self-joins: %s", res)
+	}
+
+	_, err = db.Query(`SELECT employee.name FROM employee JOIN employee ON employee.manager_id = employee.id`)
+	if err == nil {
+		t.Fatalf("expected error joining relation with itself without alias")
+	}
+}
+
+func TestOrderByPositionAndAlias(t *testing.T) {
+	db, err := sql.Open("ramsql", "TestOrderByPositionAndAlias")
+	if err != nil {
+		t.Fatalf("sql.Open : Error : %s\n", err)
+	}
+	defer db.Close()
+
+	batch := []string{
+		`CREATE TABLE player (id BIGINT PRIMARY KEY, name TEXT, score BIGINT)`,
+		`INSERT INTO player (id, name, score) VALUES (1, 'carol', 20)`,
+		`INSERT INTO player (id, name, score) VALUES (2, 'alice', 30)`,
+		`INSERT INTO player (id, name, score) VALUES (3, 'bob', 10)`,
+	}
+	for _, b := range batch {
+		_, err = db.Exec(b)
+		if err != nil {
+			t.Fatalf("sql.Exec: Error: %s\n", err)
+		}
+	}
+
+	query := func(q string) string {
+		rows, err := db.Query(q)
+		if err != nil {
+			t.Fatalf("cannot query '%s': %s", q, err)
+		}
+		defer rows.Close()
+
+		var res []string
+		for rows.Next() {
+			var id int64
+			var name string
+			if err := rows.Scan(&id, &name); err != nil {
+				t.Fatalf("cannot scan: %s", err)
+			}
+			res = append(res, name)
+		}
+		return strings.Join(res, ",")
+	}
+
+	res := query(`SELECT id, name FROM player ORDER BY 2`)
+	if res != "alice,bob,carol" {
+		t.Fatalf("unexpected order by position: %s", res)
+	}
+
+	res = query(`SELECT id, name AS player_name FROM player ORDER BY player_name DESC`)
+	if res != "carol,bob,alice" {
+		t.Fatalf("unexpected order by alias: %s", res)
+	}
+
+	res = query(`SELECT score AS id, name FROM player ORDER BY id`)
+	if res != "bob,carol,alice" {
+		t.Fatalf("expected alias to take precedence over attribute: %s", res)
+	}
+
+	rows, err := db.Query(`SELECT * FROM player ORDER BY 3 DESC`)
+	if err != nil {
+		t.Fatalf("cannot order by position of star: %s", err)
+	}
+	var names []string
+	for rows.Next() {
+		var id, score int64
+		var name string
+		if err := rows.Scan(&id, &name, &score); err != nil {
+			t.Fatalf("cannot scan: %s", err)
+		}
+		names = append(names, name)
+	}
+	rows.Close()
+	if res = strings.Join(names, ","); res != "alice,carol,bob" {
+		t.Fatalf("unexpected order by position of star: %s", res)
+	}
+
+	res = query(`SELECT id, name FROM player WHERE id < 3 UNION SELECT id, name FROM player WHERE id > 1 ORDER BY 2 DESC`)
+	if res != "carol,bob,alice" {
+		t.Fatalf("unexpected order by position of union: %s", res)
+	}
+
+	_, err = db.Query(`SELECT id, name FROM player ORDER BY 3`)
+	if err == nil {
+		t.Fatalf("expected error with out of range position")
+	}
+
+	_, err = db.Query(`SELECT id, name FROM player ORDER BY 0`)
+	if err == nil {
+		t.Fatalf("expected error with position 0")
+	}
+}
+
+func TestAggregateWithoutGroupBy(t *testing.T) {
+	db, err := sql.Open("ramsql", "TestAggregateWithoutGroupBy")
+	if err != nil {
+		t.Fatalf("sql.Open : Error : %s\n", err)
+	}
+	defer db.Close()
+
+	_, err = db.Exec(`CREATE TABLE champion (id BIGSERIAL PRIMARY KEY, user_id BIGINT, name TEXT, score FLOAT)`)
+	if err != nil {
+		t.Fatalf("sql.Exec: Error: %s\n", err)
+	}
+
+	// empty relation still returns a single row
+	rows, err := db.Query(`SELECT COUNT(*), MAX(user_id) FROM champion`)
+	if err != nil {
+		t.Fatalf("cannot aggregate empty relation: %s", err)
+	}
+	var n int
+	for rows.Next() {
+		var count int64
+		var max sql.NullInt64
+		if err := rows.Scan(&count, &max); err != nil {
+			t.Fatalf("cannot scan: %s", err)
+		}
+		if count != 0 || max.Valid {
+			t.Fatalf("expected 0 and NULL, got %d and %v", count, max)
+		}
+		n++
+	}
+	rows.Close()
+	if n != 1 {
+		t.Fatalf("expected 1 row, got %d", n)
+	}
+
+	batch := []string{
+		`INSERT INTO champion (user_id, name, score) VALUES (1, 'zed', 1.5)`,
+		`INSERT INTO champion (user_id, name, score) VALUES (3, 'ahri', 2.5)`,
+		`INSERT INTO champion (user_id, name, score) VALUES (2, 'lux', NULL)`,
+		`INSERT INTO champion (user_id, name, score) VALUES (NULL, 'teemo', NULL)`,
+	}
+	for _, b := range batch {
+		_, err = db.Exec(b)
+		if err != nil {
+			t.Fatalf("sql.Exec: Error: %s\n", err)
+		}
+	}
+
+	var count, countUser, max, min, sum int64
+	var avg float64
+	var name string
+	err = db.QueryRow(`SELECT COUNT(*), COUNT(user_id), MAX(user_id), MIN(champion.user_id), SUM(user_id), AVG(score), MIN(name) FROM champion`).Scan(&count, &countUser, &max, &min, &sum, &avg, &name)
+	if err != nil {
+		t.Fatalf("cannot aggregate: %s", err)
+	}
+	if count != 4 || countUser != 3 || max != 3 || min != 1 || sum != 6 || avg != 2 || name != "ahri" {
+		t.Fatalf("unexpected aggregates: %d %d %d %d %d %f %s", count, countUser, max, min, sum, avg, name)
+	}
+
+	err = db.QueryRow(`SELECT MAX(user_id) AS top, 1 FROM champion WHERE user_id < 3`).Scan(&max, &count)
+	if err != nil {
+		t.Fatalf("cannot aggregate with constant: %s", err)
+	}
+	if max != 2 || count != 1 {
+		t.Fatalf("unexpected aggregate with constant: %d %d", max, count)
+	}
+
+	_, err = db.Query(`SELECT name, COUNT(*) FROM champion`)
+	if err == nil {
+		t.Fatalf("expected error mixing aggregate and column without GROUP BY")
+	}
+
+	_, err = db.Query(`SELECT COUNT(*), name FROM champion WHERE id = 1`)
+	if err == nil {
+		t.Fatalf("expected error mixing aggregate and column on a single row")
+	}
+}
+
+func TestWindowRowNumber(t *testing.T) {
+	db, err := sql.Open("ramsql", "TestWindowRowNumber")
+	if err != nil {
+		t.Fatalf("sql.Open : Error : %s\n", err)
+	}
+	defer db.Close()
+
+	batch := []string{
+		`CREATE TABLE champion (id BIGSERIAL PRIMARY KEY, user_id BIGINT, name TEXT)`,
+		`INSERT INTO champion (user_id, name) VALUES (1, 'zed')`,
+		`INSERT INTO champion (user_id, name) VALUES (2, 'lux')`,
+		`INSERT INTO champion (user_id, name) VALUES (1, 'ahri')`,
+		`INSERT INTO champion (user_id, name) VALUES (2, 'annie')`,
+		`INSERT INTO champion (user_id, name) VALUES (1, 'teemo')`,
+	}
+	for _, b := range batch {
+		_, err = db.Exec(b)
+		if err != nil {
+			t.Fatalf("sql.Exec: Error: %s\n", err)
+		}
+	}
+
+	query := func(q string) string {
+		rows, err := db.Query(q)
+		if err != nil {
+			t.Fatalf("cannot query '%s': %s", q, err)
+		}
+		defer rows.Close()
+
+		var res []string
+		for rows.Next() {
+			var name string
+			var n int64
+			if err := rows.Scan(&name, &n); err != nil {
+				t.Fatalf("cannot scan: %s", err)
+			}
+			res = append(res, fmt.Sprintf("%s:%d", name, n))
+		}
+		return strings.Join(res, ",")
+	}
+
+	res := query(`SELECT name, ROW_NUMBER() OVER (PARTITION BY user_id ORDER BY name) FROM champion ORDER BY id`)
+	if res != "zed:3,lux:2,ahri:1,annie:1,teemo:2" {
+		t.Fatalf("unexpected row numbers: %s", res)
+	}
+
+	res = query(`SELECT name, ROW_NUMBER() OVER (ORDER BY name DESC) AS rn FROM champion ORDER BY rn`)
+	if res != "zed:1,teemo:2,lux:3,annie:4,ahri:5" {
+		t.Fatalf("unexpected row numbers without partition: %s", res)
+	}
+
+	// first champion of each user
+	res = query(`SELECT name, ROW_NUMBER() OVER (PARTITION BY c.user_id ORDER BY c.id) AS rn FROM champion c WHERE user_id = 2 ORDER BY 2`)
+	if res != "lux:1,annie:2" {
+		t.Fatalf("unexpected row numbers with predicate: %s", res)
+	}
+
+	rows, err := db.Query(`SELECT *, ROW_NUMBER() OVER () FROM champion`)
+	if err != nil {
+		t.Fatalf("cannot select star with window: %s", err)
+	}
+	cols, err := rows.Columns()
+	if err != nil {
+		t.Fatalf("cannot get columns: %s", err)
+	}
+	rows.Close()
+	if strings.Join(cols, ",") != "id,user_id,name,row_number" {
+		t.Fatalf("unexpected columns: %v", cols)
+	}
+
+	_, err = db.Query(`SELECT name, ROW_NUMBER() OVER (PARTITION BY unknown) FROM champion`)
+	if err == nil {
+		t.Fatalf("expected error partitioning by unknown attribute")
+	}
+}
+
+func TestWindowRankAndAggregate(t *testing.T) {
+	db, err := sql.Open("ramsql", "TestWindowRankAndAggregate")
+	if err != nil {
+		t.Fatalf("sql.Open : Error : %s\n", err)
+	}
+	defer db.Close()
+
+	batch := []string{
+		`CREATE TABLE score (id BIGSERIAL PRIMARY KEY, team BIGINT, points BIGINT)`,
+		`INSERT INTO score (team, points) VALUES (1, 10)`,
+		`INSERT INTO score (team, points) VALUES (1, 30)`,
+		`INSERT INTO score (team, points) VALUES (1, 30)`,
+		`INSERT INTO score (team, points) VALUES (1, 20)`,
+		`INSERT INTO score (team, points) VALUES (2, 5)`,
+	}
+	for _, b := range batch {
+		_, err = db.Exec(b)
+		if err != nil {
+			t.Fatalf("sql.Exec: Error: %s\n", err)
+		}
+	}
+
+	rows, err := db.Query(`SELECT id, RANK() OVER (PARTITION BY team ORDER BY points DESC), DENSE_RANK() OVER (PARTITION BY team ORDER BY points DESC) AS dense, SUM(points) OVER (PARTITION BY team), COUNT(*) OVER () FROM score ORDER BY id`)
+	if err != nil {
+		t.Fatalf("cannot query windows: %s", err)
+	}
+	defer rows.Close()
+
+	cols, err := rows.Columns()
+	if err != nil {
+		t.Fatalf("cannot get columns: %s", err)
+	}
+	if strings.Join(cols, ",") != "id,rank,dense,sum,count" {
+		t.Fatalf("unexpected columns: %v", cols)
+	}
+
+	expected := [][]int64{
+		{1, 4, 3, 90, 5},
+		{2, 1, 1, 90, 5},
+		{3, 1, 1, 90, 5},
+		{4, 3, 2, 90, 5},
+		{5, 1, 1, 5, 5},
+	}
+	var n int
+	for rows.Next() {
+		var id, rank, dense, sum, count int64
+		if err := rows.Scan(&id, &rank, &dense, &sum, &count); err != nil {
+			t.Fatalf("cannot scan: %s", err)
+		}
+		got := []int64{id, rank, dense, sum, count}
+		if n >= len(expected) || fmt.Sprint(got) != fmt.Sprint(expected[n]) {
+			t.Fatalf("unexpected row %d: %v", n, got)
+		}
+		n++
+	}
+	if n != len(expected) {
+		t.Fatalf("expected %d rows, got %d", len(expected), n)
+	}
+}
+
+func TestWindowLagLead(t *testing.T) {
+	db, err := sql.Open("ramsql", "TestWindowLagLead")
+	if err != nil {
+		t.Fatalf("sql.Open : Error : %s\n", err)
+	}
+	defer db.Close()
+
+	batch := []string{
+		`CREATE TABLE measure (id BIGSERIAL PRIMARY KEY, sensor TEXT, ts BIGINT, value BIGINT)`,
+		`INSERT INTO measure (sensor, ts, value) VALUES ('a', 3, 15)`,
+		`INSERT INTO measure (sensor, ts, value) VALUES ('a', 1, 10)`,
+		`INSERT INTO measure (sensor, ts, value) VALUES ('b', 1, 100)`,
+		`INSERT INTO measure (sensor, ts, value) VALUES ('a', 2, 12)`,
+		`INSERT INTO measure (sensor, ts, value) VALUES ('b', 2, 90)`,
+	}
+	for _, b := range batch {
+		_, err = db.Exec(b)
+		if err != nil {
+			t.Fatalf("sql.Exec: Error: %s\n", err)
+		}
+	}
+
+	query := func(q string, args ...any) string {
+		rows, err := db.Query(q, args...)
+		if err != nil {
+			t.Fatalf("cannot query '%s': %s", q, err)
+		}
+		defer rows.Close()
+
+		var res []string
+		for rows.Next() {
+			var v int64
+			var lag, lead sql.NullInt64
+			if err := rows.Scan(&v, &lag, &lead); err != nil {
+				t.Fatalf("cannot scan: %s", err)
+			}
+			res = append(res, fmt.Sprintf("%d:%d/%v:%d/%v", v, lag.Int64, lag.Valid, lead.Int64, lead.Valid))
+		}
+		return strings.Join(res, ",")
+	}
+
+	res := query(`SELECT value, LAG(value) OVER (PARTITION BY sensor ORDER BY ts), LEAD(value, 1) OVER (PARTITION BY sensor ORDER BY ts) FROM measure ORDER BY id`)
+	if res != "15:12/true:0/false,10:0/false:12/true,100:0/false:90/true,12:10/true:15/true,90:100/true:0/false" {
+		t.Fatalf("unexpected lag and lead: %s", res)
+	}
+
+	res = query(`SELECT value, LAG(value, 2, 0) OVER (ORDER BY ts, sensor) AS prev, LEAD(m.value, $1, -1) OVER (PARTITION BY m.sensor ORDER BY m.ts DESC) FROM measure m WHERE sensor = 'a' ORDER BY ts`, 2)
+	if res != "10:0/true:-1/true,12:0/true:-1/true,15:10/true:10/true" {
+		t.Fatalf("unexpected lag and lead with offset and default: %s", res)
+	}
+
+	_, err = db.Query(`SELECT value, LAG(value, 'a') OVER () FROM measure`)
+	if err == nil {
+		t.Fatalf("expected error with non integer offset")
+	}
+}
+
+func TestCast(t *testing.T) {
+	db, err := sql.Open("ramsql", "TestCast")
+	if err != nil {
+		t.Fatalf("sql.Open : Error : %s\n", err)
+	}
+	defer db.Close()
+
+	batch := []string{
+		`CREATE TABLE event (id BIGSERIAL PRIMARY KEY, user_id BIGINT, ts TIMESTAMP)`,
+		`INSERT INTO event (user_id, ts) VALUES (1, '2024-03-01T10:30:00Z')`,
+		`INSERT INTO event (user_id, ts) VALUES (2, '2024-03-02T23:59:59Z')`,
+	}
+	for _, b := range batch {
+		_, err = db.Exec(b)
+		if err != nil {
+			t.Fatalf("sql.Exec: Error: %s\n", err)
+		}
+	}
+
+	var s string
+	var i, j int64
+	err = db.QueryRow(`SELECT CAST(user_id AS TEXT), CAST('123' AS INT), '5'::int FROM event WHERE id = 1`).Scan(&s, &i, &j)
+	if err != nil {
+		t.Fatalf("cannot select casts: %s", err)
+	}
+	if s != "1" || i != 123 || j != 5 {
+		t.Fatalf("unexpected casts: %s, %d, %d", s, i, j)
+	}
+
+	var d time.Time
+	err = db.QueryRow(`SELECT CAST(ts AS DATE) AS day FROM event WHERE id = 2`).Scan(&d)
+	if err != nil {
+		t.Fatalf("cannot cast timestamp to date: %s", err)
+	}
+	if d.Format("2006-01-02 15:04:05") != "2024-03-02 00:00:00" {
+		t.Fatalf("unexpected date: %s", d)
+	}
+
+	var id int64
+	err = db.QueryRow(`SELECT id FROM event WHERE CAST(user_id AS TEXT) = '1'`).Scan(&id)
+	if err != nil {
+		t.Fatalf("cannot filter on cast: %s", err)
+	}
+	if id != 1 {
+		t.Fatalf("expected id 1, got %d", id)
+	}
+
+	err = db.QueryRow(`SELECT id FROM event WHERE user_id = '2'::int`).Scan(&id)
+	if err != nil {
+		t.Fatalf("cannot filter on cast value: %s", err)
+	}
+	if id != 2 {
+		t.Fatalf("expected id 2, got %d", id)
+	}
+
+	err = db.QueryRow(`SELECT id FROM event WHERE user_id::text = CAST($1 AS TEXT)`, 2).Scan(&id)
+	if err != nil {
+		t.Fatalf("cannot filter on cast shorthand: %s", err)
+	}
+	if id != 2 {
+		t.Fatalf("expected id 2, got %d", id)
+	}
+
+	err = db.QueryRow(`SELECT CAST('abc' AS INT) FROM event`).Scan(&i)
+	if err == nil {
+		t.Fatalf("expected error casting 'abc' to INT")
+	}
+
+	_, err = db.Query(`SELECT CAST(user_id AS NOPE) FROM event`)
+	if err == nil {
+		t.Fatalf("expected error casting to unknown type")
+	}
+}
+
+func TestMathFunctions(t *testing.T) {
+	db, err := sql.Open("ramsql", "TestMathFunctions")
+	if err != nil {
+		t.Fatalf("sql.Open : Error : %s\n", err)
+	}
+	defer db.Close()
+
+	batch := []string{
+		`CREATE TABLE measure (id BIGSERIAL PRIMARY KEY, value BIGINT, ratio FLOAT)`,
+		`INSERT INTO measure (value, ratio) VALUES (-7, 2.345)`,
+		`INSERT INTO measure (value, ratio) VALUES (9, -1.5)`,
+		`INSERT INTO measure (value, ratio) VALUES (NULL, NULL)`,
+	}
+	for _, b := range batch {
+		_, err = db.Exec(b)
+		if err != nil {
+			t.Fatalf("sql.Exec: Error: %s\n", err)
+		}
+	}
+
+	var abs, mod, power int64
+	var round, ceil, floor, sqrt float64
+	err = db.QueryRow(`SELECT ABS(value), MOD(value, 4), POWER(value, 2), ROUND(ratio, 2), CEIL(ratio), FLOOR(ratio), SQRT(ABS(value)) FROM measure WHERE id = 1`).Scan(&abs, &mod, &power, &round, &ceil, &floor, &sqrt)
+	if err != nil {
+		t.Fatalf("cannot select math functions: %s", err)
+	}
+	if abs != 7 || mod != -3 || power != 49 || round != 2.35 || ceil != 3 || floor != 2 || sqrt*sqrt-7 > 1e-9 {
+		t.Fatalf("unexpected results: %d %d %d %v %v %v %v", abs, mod, power, round, ceil, floor, sqrt)
+	}
+
+	var r sql.NullFloat64
+	var a sql.NullInt64
+	err = db.QueryRow(`SELECT ABS(value), ROUND(ratio) AS r FROM measure WHERE id = 3`).Scan(&a, &r)
+	if err != nil {
+		t.Fatalf("cannot select math functions on NULL: %s", err)
+	}
+	if a.Valid || r.Valid {
+		t.Fatalf("expected NULL results, got %v and %v", a, r)
+	}
+
+	var id int64
+	err = db.QueryRow(`SELECT id FROM measure WHERE ABS(value) > 8`).Scan(&id)
+	if err != nil {
+		t.Fatalf("cannot filter on function: %s", err)
+	}
+	if id != 2 {
+		t.Fatalf("expected id 2, got %d", id)
+	}
+
+	err = db.QueryRow(`SELECT id FROM measure WHERE value = ABS($1)`, -9).Scan(&id)
+	if err != nil {
+		t.Fatalf("cannot filter on function of argument: %s", err)
+	}
+	if id != 2 {
+		t.Fatalf("expected id 2, got %d", id)
+	}
+
+	_, err = db.Query(`SELECT MOD(value, 0) FROM measure`)
+	if err == nil {
+		t.Fatalf("expected division by zero error")
+	}
+
+	_, err = db.Query(`SELECT NOPE(value) FROM measure`)
+	if err == nil {
+		t.Fatalf("expected error with unknown function")
+	}
+
+	_, err = db.Query(`SELECT ABS(value, 2) FROM measure`)
+	if err == nil {
+		t.Fatalf("expected error with wrong number of arguments")
+	}
+}
+
+func TestDateFunctions(t *testing.T) {
+	db, err := sql.Open("ramsql", "TestDateFunctions")
+	if err != nil {
+		t.Fatalf("sql.Open : Error : %s\n", err)
+	}
+	defer db.Close()
+
+	batch := []string{
+		`CREATE TABLE event (id BIGSERIAL PRIMARY KEY, ts TIMESTAMP)`,
+		`INSERT INTO event (ts) VALUES ('2024-03-14T15:09:26Z')`,
+		`INSERT INTO event (ts) VALUES ('2023-11-05T08:00:00Z')`,
+		`INSERT INTO event (ts) VALUES (NOW())`,
+	}
+	for _, b := range batch {
+		_, err = db.Exec(b)
+		if err != nil {
+			t.Fatalf("sql.Exec: Error: %s\n", err)
+		}
+	}
+
+	var year, month, day, hour, dow int64
+	var epoch float64
+	err = db.QueryRow(`SELECT EXTRACT(YEAR FROM ts), EXTRACT(MONTH FROM ts), EXTRACT(DAY FROM ts), EXTRACT(HOUR FROM ts), EXTRACT(DOW FROM ts), EXTRACT(EPOCH FROM ts) FROM event WHERE id = 1`).Scan(&year, &month, &day, &hour, &dow, &epoch)
+	if err != nil {
+		t.Fatalf("cannot extract fields: %s", err)
+	}
+	if year != 2024 || month != 3 || day != 14 || hour != 15 || dow != 4 || epoch != 1710428966 {
+		t.Fatalf("unexpected fields: %d %d %d %d %d %v", year, month, day, hour, dow, epoch)
+	}
+
+	var m, d time.Time
+	err = db.QueryRow(`SELECT DATE_TRUNC('month', ts) AS m, DATE_TRUNC('day', ts) FROM event WHERE id = 1`).Scan(&m, &d)
+	if err != nil {
+		t.Fatalf("cannot truncate dates: %s", err)
+	}
+	if m.Format(time.RFC3339) != "2024-03-01T00:00:00Z" || d.Format(time.RFC3339) != "2024-03-14T00:00:00Z" {
+		t.Fatalf("unexpected truncated dates: %s, %s", m, d)
+	}
+
+	var id int64
+	err = db.QueryRow(`SELECT id FROM event WHERE EXTRACT(YEAR FROM ts) = 2023`).Scan(&id)
+	if err != nil {
+		t.Fatalf("cannot filter on extracted field: %s", err)
+	}
+	if id != 2 {
+		t.Fatalf("expected id 2, got %d", id)
+	}
+
+	err = db.QueryRow(`SELECT id FROM event WHERE ts > CURRENT_DATE`).Scan(&id)
+	if err != nil {
+		t.Fatalf("cannot filter on current date: %s", err)
+	}
+	if id != 3 {
+		t.Fatalf("expected id 3, got %d", id)
+	}
+
+	// NOW() is the same for every row of a statement
+	rows, err := db.Query(`SELECT NOW(), CURRENT_TIMESTAMP, CURRENT_DATE FROM event`)
+	if err != nil {
+		t.Fatalf("cannot select current time: %s", err)
+	}
+	defer rows.Close()
+
+	var first time.Time
+	for rows.Next() {
+		var now, ts, date time.Time
+		if err := rows.Scan(&now, &ts, &date); err != nil {
+			t.Fatalf("cannot scan: %s", err)
+		}
+		if !now.Equal(ts) {
+			t.Fatalf("expected NOW() and CURRENT_TIMESTAMP to be equal, got %s and %s", now, ts)
+		}
+		if first.IsZero() {
+			first = now
+		}
+		if !now.Equal(first) {
+			t.Fatalf("expected NOW() to be stable within statement, got %s and %s", first, now)
+		}
+		if date.Hour() != 0 || date.Day() != now.Day() {
+			t.Fatalf("unexpected current date %s", date)
+		}
+	}
+
+	_, err = db.Query(`SELECT EXTRACT(FORTNIGHT FROM ts) FROM event`)
+	if err == nil {
+		t.Fatalf("expected error with unknown field")
+	}
+}
+
+func TestIntervalArithmetic(t *testing.T) {
+	db, err := sql.Open("ramsql", "TestIntervalArithmetic")
+	if err != nil {
+		t.Fatalf("sql.Open : Error : %s\n", err)
+	}
+	defer db.Close()
+
+	batch := []string{
+		`CREATE TABLE task (id BIGSERIAL PRIMARY KEY, created TIMESTAMP, done TIMESTAMP, cost BIGINT)`,
+		`INSERT INTO task (created, done, cost) VALUES ('2024-01-31T10:00:00Z', '2024-02-02T12:30:00Z', 10)`,
+		`INSERT INTO task (created, done, cost) VALUES (NOW(), NOW(), 5)`,
+	}
+	for _, b := range batch {
+		_, err = db.Exec(b)
+		if err != nil {
+			t.Fatalf("sql.Exec: Error: %s\n", err)
+		}
+	}
+
+	var next, prev time.Time
+	var elapsed string
+	var total int64
+	err = db.QueryRow(`SELECT created + INTERVAL '1 month', created - INTERVAL '1 day 2 hours', done - created, cost + 2 - 1 FROM task WHERE id = 1`).Scan(&next, &prev, &elapsed, &total)
+	if err != nil {
+		t.Fatalf("cannot select date arithmetic: %s", err)
+	}
+	if next.Format(time.RFC3339) != "2024-02-29T10:00:00Z" {
+		t.Fatalf("unexpected timestamp plus interval: %s", next)
+	}
+	if prev.Format(time.RFC3339) != "2024-01-30T08:00:00Z" {
+		t.Fatalf("unexpected timestamp minus interval: %s", prev)
+	}
+	if elapsed != "2 days 02:30:00" {
+		t.Fatalf("unexpected interval between timestamps: %s", elapsed)
+	}
+	if total != 11 {
+		t.Fatalf("unexpected sum: %d", total)
+	}
+
+	var id int64
+	err = db.QueryRow(`SELECT id FROM task WHERE created > now() - INTERVAL '7 days'`).Scan(&id)
+	if err != nil {
+		t.Fatalf("cannot filter on recent rows: %s", err)
+	}
+	if id != 2 {
+		t.Fatalf("expected id 2, got %d", id)
+	}
+
+	err = db.QueryRow(`SELECT id FROM task WHERE done - created > INTERVAL '48 hours'`).Scan(&id)
+	if err != nil {
+		t.Fatalf("cannot filter on interval: %s", err)
+	}
+	if id != 1 {
+		t.Fatalf("expected id 1, got %d", id)
+	}
+
+	err = db.QueryRow(`SELECT id FROM task WHERE created + '1 year'::interval > $1`, time.Now()).Scan(&id)
+	if err != nil {
+		t.Fatalf("cannot filter on cast interval: %s", err)
+	}
+	if id != 2 {
+		t.Fatalf("expected id 2, got %d", id)
+	}
+
+	_, err = db.Query(`SELECT created + INTERVAL '1000000000 years' FROM task`)
+	if err == nil {
+		t.Fatalf("expected out of range error")
+	}
+
+	_, err = db.Query(`SELECT created + cost FROM task`)
+	if err == nil {
+		t.Fatalf("expected error adding integer to timestamp")
+	}
+}
+
+func TestGreatestLeast(t *testing.T) {
+	db, err := sql.Open("ramsql", "TestGreatestLeast")
+	if err != nil {
+		t.Fatalf("sql.Open : Error : %s\n", err)
+	}
+	defer db.Close()
+
+	batch := []string{
+		`CREATE TABLE score (id BIGSERIAL PRIMARY KEY, name TEXT, nick TEXT, a BIGINT, b BIGINT, seen TIMESTAMP)`,
+		`INSERT INTO score (name, nick, a, b, seen) VALUES ('bob', 'bobby', 3, 12, '2024-01-01T00:00:00Z')`,
+		`INSERT INTO score (name, nick, a, b, seen) VALUES ('alice', 'al', -4, NULL, '2023-06-01T00:00:00Z')`,
+		`INSERT INTO score (name, nick, a, b, seen) VALUES ('carol', NULL, NULL, NULL, NULL)`,
+	}
+	for _, b := range batch {
+		_, err = db.Exec(b)
+		if err != nil {
+			t.Fatalf("sql.Exec: Error: %s\n", err)
+		}
+	}
+
+	rows, err := db.Query(`SELECT GREATEST(a, b, 0), LEAST(a, b, 10) AS clamped, GREATEST(name, nick), LEAST(seen, $1) FROM score ORDER BY id`, time.Date(2023, 12, 1, 0, 0, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatalf("cannot select greatest and least: %s", err)
+	}
+	defer rows.Close()
+
+	var res []string
+	for rows.Next() {
+		var g, l sql.NullInt64
+		var s sql.NullString
+		var d sql.NullTime
+		if err := rows.Scan(&g, &l, &s, &d); err != nil {
+			t.Fatalf("cannot scan: %s", err)
+		}
+		res = append(res, fmt.Sprintf("%d/%d/%s/%s", g.Int64, l.Int64, s.String, d.Time.Format("2006-01")))
+	}
+	if r := strings.Join(res, ","); r != "12/3/bobby/2023-12,0/-4/alice/2023-06,0/10/carol/2023-12" {
+		t.Fatalf("unexpected greatest and least: %s", r)
+	}
+
+	var id int64
+	err = db.QueryRow(`SELECT id FROM score WHERE GREATEST(a, b) > 10`).Scan(&id)
+	if err != nil {
+		t.Fatalf("cannot filter on greatest: %s", err)
+	}
+	if id != 1 {
+		t.Fatalf("expected id 1, got %d", id)
+	}
+
+	var v sql.NullInt64
+	err = db.QueryRow(`SELECT LEAST(a, b) FROM score WHERE id = 3`).Scan(&v)
+	if err != nil {
+		t.Fatalf("cannot select least of NULL values: %s", err)
+	}
+	if v.Valid {
+		t.Fatalf("expected NULL, got %d", v.Int64)
+	}
+
+	_, err = db.Query(`SELECT GREATEST(a, name) FROM score`)
+	if err == nil {
+		t.Fatalf("expected error comparing integer and text")
+	}
+}
+
+func TestSessionVariables(t *testing.T) {
+	db, err := sql.Open("ramsql", "TestSessionVariables")
+	if err != nil {
+		t.Fatalf("sql.Open : Error : %s\n", err)
+	}
+	defer db.Close()
+
+	ctx := context.Background()
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		t.Fatalf("cannot get connection: %s", err)
+	}
+	defer conn.Close()
+
+	batch := []string{
+		`CREATE SCHEMA app`,
+		`CREATE TABLE app.account (id BIGSERIAL PRIMARY KEY, email TEXT, created TIMESTAMP WITH TIME ZONE)`,
+		`CREATE TABLE public.setting (name TEXT, value TEXT)`,
+		`INSERT INTO app.account (email, created) VALUES ('bob@example.com', '2024-01-01T12:00:00Z')`,
+		`INSERT INTO setting (name, value) VALUES ('theme', 'dark')`,
+		`SET standard_conforming_strings = on`,
+		`SET application_name TO 'ramsql test'`,
+	}
+	for _, b := range batch {
+		_, err = conn.ExecContext(ctx, b)
+		if err != nil {
+			t.Fatalf("sql.Exec: Error: %s\n", err)
+		}
+	}
+
+	var v string
+	err = conn.QueryRowContext(ctx, `SHOW application_name`).Scan(&v)
+	if err != nil {
+		t.Fatalf("cannot show unknown variable: %s", err)
+	}
+	if v != "ramsql test" {
+		t.Fatalf("expected 'ramsql test', got '%s'", v)
+	}
+
+	err = conn.QueryRowContext(ctx, `SHOW search_path`).Scan(&v)
+	if err != nil {
+		t.Fatalf("cannot show search_path: %s", err)
+	}
+	if v != "public" {
+		t.Fatalf("expected default search_path, got '%s'", v)
+	}
+
+	// unqualified relations are looked up in search_path, in order
+	_, err = conn.ExecContext(ctx, `SET search_path TO app, public`)
+	if err != nil {
+		t.Fatalf("cannot set search_path: %s", err)
+	}
+	var email string
+	err = conn.QueryRowContext(ctx, `SELECT email FROM account WHERE id = 1`).Scan(&email)
+	if err != nil {
+		t.Fatalf("cannot select from search_path schema: %s", err)
+	}
+	if email != "bob@example.com" {
+		t.Fatalf("unexpected email %s", email)
+	}
+	err = conn.QueryRowContext(ctx, `SELECT value FROM setting WHERE name = 'theme'`).Scan(&v)
+	if err != nil {
+		t.Fatalf("cannot select from second search_path schema: %s", err)
+	}
+
+	// new relations are created in first schema of search_path
+	_, err = conn.ExecContext(ctx, `CREATE TABLE profile (account_id BIGINT, bio TEXT)`)
+	if err != nil {
+		t.Fatalf("cannot create relation: %s", err)
+	}
+	_, err = conn.ExecContext(ctx, `INSERT INTO profile (account_id, bio) VALUES (1, 'hello')`)
+	if err != nil {
+		t.Fatalf("cannot insert into search_path relation: %s", err)
+	}
+	var n int64
+	err = conn.QueryRowContext(ctx, `SELECT COUNT(*) FROM app.profile`).Scan(&n)
+	if err != nil {
+		t.Fatalf("cannot select from qualified relation: %s", err)
+	}
+	if n != 1 {
+		t.Fatalf("expected 1 profile in app schema, got %d", n)
+	}
+
+	// search_path is kept across transactions of the connection
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		t.Fatalf("cannot begin: %s", err)
+	}
+	err = tx.QueryRow(`SELECT bio FROM profile`).Scan(&v)
+	if err != nil {
+		t.Fatalf("cannot select in transaction: %s", err)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("cannot commit: %s", err)
+	}
+
+	// other connections are not affected
+	_, err = db.Query(`SELECT bio FROM profile`)
+	if err == nil {
+		t.Fatalf("expected error selecting from app relation without search_path")
+	}
+
+	// TIMESTAMPTZ values are returned in session timezone
+	_, err = conn.ExecContext(ctx, `SET TIME ZONE 'America/New_York'`)
+	if err != nil {
+		t.Fatalf("cannot set timezone: %s", err)
+	}
+	var created time.Time
+	err = conn.QueryRowContext(ctx, `SELECT created FROM account`).Scan(&created)
+	if err != nil {
+		t.Fatalf("cannot select timestamp: %s", err)
+	}
+	if created.Location().String() != "America/New_York" || created.Hour() != 7 {
+		t.Fatalf("expected timestamp in New York time, got %s", created)
+	}
+	err = conn.QueryRowContext(ctx, `SHOW timezone`).Scan(&v)
+	if err != nil {
+		t.Fatalf("cannot show timezone: %s", err)
+	}
+	if v != "America/New_York" {
+		t.Fatalf("expected timezone America/New_York, got '%s'", v)
+	}
+
+	_, err = conn.ExecContext(ctx, `SET timezone = 'Mars/Olympus_Mons'`)
+	if err == nil {
+		t.Fatalf("expected error setting invalid timezone")
+	}
+
+	_, err = conn.ExecContext(ctx, `SET search_path TO DEFAULT`)
+	if err != nil {
+		t.Fatalf("cannot reset search_path: %s", err)
+	}
+	_, err = conn.QueryContext(ctx, `SELECT bio FROM profile`)
+	if err == nil {
+		t.Fatalf("expected error selecting from app relation after search_path reset")
+	}
+
+	_, err = conn.QueryContext(ctx, `SHOW unknown_variable`)
+	if err == nil {
+		t.Fatalf("expected error showing unset unknown variable")
+	}
+}
+
+func TestCrossSchemaQuery(t *testing.T) {
+	db, err := sql.Open("ramsql", "TestCrossSchemaQuery")
+	if err != nil {
+		t.Fatalf("sql.Open : Error : %s\n", err)
+	}
+	defer db.Close()
+
+	batch := []string{
+		`CREATE SCHEMA analytics`,
+		`CREATE TABLE analytics.events (id BIGSERIAL PRIMARY KEY, user_id BIGINT, kind TEXT)`,
+		`CREATE TABLE users (id BIGSERIAL PRIMARY KEY, name TEXT)`,
+		`CREATE TABLE analytics.users (id BIGINT, name TEXT)`,
+		`INSERT INTO users (name) VALUES ('bob')`,
+		`INSERT INTO users (name) VALUES ('alice')`,
+		`INSERT INTO analytics.users (id, name) VALUES (1, 'not bob')`,
+		`INSERT INTO analytics.events (user_id, kind) VALUES (1, 'login')`,
+		`INSERT INTO analytics.events (user_id, kind) VALUES (2, 'login')`,
+		`INSERT INTO analytics.events (user_id, kind) VALUES (1, 'logout')`,
+	}
+	for _, b := range batch {
+		_, err = db.Exec(b)
+		if err != nil {
+			t.Fatalf("sql.Exec: Error: %s\n", err)
+		}
+	}
+
+	var n int64
+	err = db.QueryRow(`SELECT COUNT(*) FROM analytics.events`).Scan(&n)
+	if err != nil {
+		t.Fatalf("cannot select from qualified relation: %s", err)
+	}
+	if n != 3 {
+		t.Fatalf("expected 3 events, got %d", n)
+	}
+
+	queries := []string{
+		`SELECT e.kind, u.name FROM analytics.events e JOIN users u ON e.user_id = u.id ORDER BY e.id`,
+		`SELECT e.kind, u.name FROM analytics.events AS e JOIN public.users AS u ON e.user_id = u.id ORDER BY e.id`,
+		`SELECT events.kind, users.name FROM users JOIN analytics.events ON users.id = events.user_id ORDER BY events.id`,
+	}
+	for _, q := range queries {
+		rows, err := db.Query(q)
+		if err != nil {
+			t.Fatalf("cannot join relations of two schemas: %s: %s", q, err)
+		}
+
+		var res []string
+		for rows.Next() {
+			var kind, name string
+			if err := rows.Scan(&kind, &name); err != nil {
+				t.Fatalf("cannot scan: %s", err)
+			}
+			res = append(res, kind+":"+name)
+		}
+		rows.Close()
+		if r := strings.Join(res, ","); r != "login:bob,login:alice,logout:bob" {
+			t.Fatalf("unexpected join result for %s: %s", q, r)
+		}
+	}
+
+	var name string
+	err = db.QueryRow(`SELECT u.name FROM analytics.events e JOIN analytics.users u ON e.user_id = u.id WHERE e.id = 1`).Scan(&name)
+	if err != nil {
+		t.Fatalf("cannot join relations of the same schema: %s", err)
+	}
+	if name != "not bob" {
+		t.Fatalf("expected analytics user, got %s", name)
+	}
+
+	_, err = db.Exec(`DROP SCHEMA analytics RESTRICT`)
+	if err == nil {
+		t.Fatalf("expected error dropping non empty schema with RESTRICT")
+	}
+
+	_, err = db.Exec(`DROP SCHEMA analytics CASCADE`)
+	if err != nil {
+		t.Fatalf("cannot drop schema: %s", err)
+	}
+	_, err = db.Query(`SELECT * FROM analytics.events`)
+	if err == nil {
+		t.Fatalf("expected error selecting from dropped schema")
+	}
+	err = db.QueryRow(`SELECT COUNT(*) FROM users`).Scan(&n)
+	if err != nil || n != 2 {
+		t.Fatalf("expected default schema relations to be kept, got %d (%v)", n, err)
+	}
+}
+
+func TestDropTableCascade(t *testing.T) {
+	db, err := sql.Open("ramsql", "TestDropTableCascade")
+	if err != nil {
+		t.Fatalf("sql.Open : Error : %s\n", err)
+	}
+	defer db.Close()
+
+	batch := []string{
+		`CREATE TABLE account (id BIGSERIAL PRIMARY KEY, email TEXT)`,
+		`CREATE TABLE champion (id BIGSERIAL PRIMARY KEY, name TEXT, account_id BIGINT REFERENCES account(id), mentor_id BIGINT REFERENCES champion)`,
+		`INSERT INTO account (email) VALUES ('bob@example.com')`,
+		`INSERT INTO champion (name, account_id, mentor_id) VALUES ('ashe', 1, NULL)`,
+	}
+	for _, b := range batch {
+		_, err = db.Exec(b)
+		if err != nil {
+			t.Fatalf("sql.Exec: Error: %s\n", err)
+		}
+	}
+
+	_, err = db.Exec(`CREATE TABLE team (id BIGSERIAL PRIMARY KEY, owner_id BIGINT REFERENCES nope(id))`)
+	if err == nil {
+		t.Fatalf("expected error referencing non-existing relation")
+	}
+	_, err = db.Exec(`CREATE TABLE team (id BIGSERIAL PRIMARY KEY, owner_id BIGINT REFERENCES account(nope))`)
+	if err == nil {
+		t.Fatalf("expected error referencing non-existing attribute")
+	}
+
+	_, err = db.Exec(`DROP TABLE account`)
+	if err == nil {
+		t.Fatalf("expected error dropping referenced relation")
+	}
+	_, err = db.Exec(`DROP TABLE account RESTRICT`)
+	if err == nil {
+		t.Fatalf("expected error dropping referenced relation with RESTRICT")
+	}
+
+	// cascaded foreign key drop is reverted with the relation drop
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatalf("cannot begin: %s", err)
+	}
+	_, err = tx.Exec(`DROP TABLE account CASCADE`)
+	if err != nil {
+		t.Fatalf("cannot drop relation with CASCADE: %s", err)
+	}
+	if err := tx.Rollback(); err != nil {
+		t.Fatalf("cannot rollback: %s", err)
+	}
+	_, err = db.Exec(`DROP TABLE account`)
+	if err == nil {
+		t.Fatalf("expected error dropping referenced relation after rollback")
+	}
+
+	_, err = db.Exec(`DROP TABLE account CASCADE`)
+	if err != nil {
+		t.Fatalf("cannot drop relation with CASCADE: %s", err)
+	}
+
+	// referencing relation keeps its attributes and rows
+	var accountID int64
+	err = db.QueryRow(`SELECT account_id FROM champion WHERE name = 'ashe'`).Scan(&accountID)
+	if err != nil {
+		t.Fatalf("cannot select from referencing relation: %s", err)
+	}
+	if accountID != 1 {
+		t.Fatalf("expected account_id 1, got %d", accountID)
+	}
+
+	// self reference does not prevent drop
+	_, err = db.Exec(`DROP TABLE champion`)
+	if err != nil {
+		t.Fatalf("cannot drop self referencing relation: %s", err)
+	}
+}
+
+func TestQuotedIdentifiers(t *testing.T) {
+	db, err := sql.Open("ramsql", "TestQuotedIdentifiers")
+	if err != nil {
+		t.Fatalf("sql.Open : Error : %s\n", err)
+	}
+	defer db.Close()
+
+	queries := []string{
+		`CREATE TABLE "User" (id INT, name TEXT)`,
+		`CREATE TABLE user (id INT, name TEXT)`,
+		`INSERT INTO "User" (id, name) VALUES (1, 'quoted')`,
+		`INSERT INTO USER (id, name) VALUES (2, 'folded')`,
+		`INSERT INTO User (id, name) VALUES (3, 'folded')`,
+	}
+	for _, q := range queries {
+		if _, err := db.Exec(q); err != nil {
+			t.Fatalf("cannot exec '%s': %s", q, err)
+		}
+	}
+
+	count := func(q string) int {
+		var n int
+		if err := db.QueryRow(q).Scan(&n); err != nil {
+			t.Fatalf("cannot query '%s': %s", q, err)
+		}
+		return n
+	}
+
+	if n := count(`SELECT COUNT(*) FROM "User"`); n != 1 {
+		t.Fatalf("expected 1 row in \"User\", got %d", n)
+	}
+	if n := count(`SELECT COUNT(*) FROM user`); n != 2 {
+		t.Fatalf("expected 2 rows in user, got %d", n)
+	}
+	if n := count(`SELECT COUNT(*) FROM "user"`); n != 2 {
+		t.Fatalf("expected 2 rows in \"user\", got %d", n)
+	}
+
+	var name string
+	err = db.QueryRow(`SELECT U.name FROM "User" AS u WHERE U.id = 1`).Scan(&name)
+	if err != nil {
+		t.Fatalf("cannot query with folded alias: %s", err)
+	}
+	if name != "quoted" {
+		t.Fatalf("expected 'quoted', got '%s'", name)
+	}
+
+	_, err = db.Exec(`CREATE TABLE Account (id INT)`)
+	if err != nil {
+		t.Fatalf("cannot create relation: %s", err)
+	}
+	if _, err = db.Query(`SELECT * FROM "Account"`); err == nil {
+		t.Fatalf("expected error querying quoted name of folded relation")
+	}
+
+	// column names follow the same rules
+	queries = []string{
+		`CREATE TABLE member (id INT PRIMARY KEY, "Email" TEXT UNIQUE, Nickname TEXT)`,
+		`INSERT INTO member (id, "Email", NICKNAME) VALUES (1, 'a@b.c', 'A')`,
+		`UPDATE member SET "Email" = 'b@c.d' WHERE nickname = 'A'`,
+		`CREATE INDEX member_email_idx ON member ("Email")`,
+	}
+	for _, q := range queries {
+		if _, err := db.Exec(q); err != nil {
+			t.Fatalf("cannot exec '%s': %s", q, err)
+		}
+	}
+
+	rows, err := db.Query(`SELECT "Email", Nickname FROM member m WHERE m."Email" = 'b@c.d'`)
+	if err != nil {
+		t.Fatalf("cannot select quoted column: %s", err)
+	}
+	cols, err := rows.Columns()
+	if err != nil {
+		t.Fatalf("cannot get columns: %s", err)
+	}
+	rows.Close()
+	if len(cols) != 2 || cols[0] != "Email" || cols[1] != "nickname" {
+		t.Fatalf("unexpected columns: %v", cols)
+	}
+
+	for _, q := range []string{
+		`SELECT email FROM member`,
+		`SELECT Email FROM member`,
+		`SELECT "EMAIL" FROM member`,
+		`SELECT "Nickname" FROM member`,
+		`INSERT INTO member (id, email) VALUES (2, 'c@d.e')`,
+		`UPDATE member SET email = 'c@d.e'`,
+	} {
+		if _, err = db.Exec(q); err == nil {
+			t.Fatalf("expected error with '%s'", q)
+		}
+	}
+}
+
+func TestUnreservedKeywords(t *testing.T) {
+	db, err := sql.Open("ramsql", "TestUnreservedKeywords")
+	if err != nil {
+		t.Fatalf("sql.Open : Error : %s\n", err)
+	}
+	defer db.Close()
+
+	// words of the grammar which are not keywords can name attributes and aliases
+	words := []string{
+		"sequence", "start", "increment", "nextval", "currval",
+		"max", "min", "sum", "avg",
+		"row_number", "rank", "dense_rank", "lag", "lead", "over", "partition",
+		"interval", "filter", "show", "describe", "restart", "identity", "array", "within",
+		"natural", "cast", "extract", "column", "rename", "conflict", "nothing", "using",
+	}
+	for _, w := range words {
+		queries := []string{
+			fmt.Sprintf(`CREATE TABLE kw_%s (id INT, %s INT)`, w, w),
+			fmt.Sprintf(`INSERT INTO kw_%s (id, %s) VALUES (1, 2)`, w, w),
+			fmt.Sprintf(`UPDATE kw_%s SET %s = 3 WHERE %s = 2`, w, w, w),
+		}
+		for _, q := range queries {
+			if _, err := db.Exec(q); err != nil {
+				t.Fatalf("cannot exec '%s': %s", q, err)
+			}
+		}
+
+		var v int64
+		q := fmt.Sprintf(`SELECT %s FROM kw_%s WHERE kw_%s.%s = 3 ORDER BY %s`, w, w, w, w, w)
+		if err := db.QueryRow(q).Scan(&v); err != nil {
+			t.Fatalf("cannot query '%s': %s", q, err)
+		}
+		if v != 3 {
+			t.Fatalf("expected 3 from '%s', got %d", q, v)
+		}
+
+		q = fmt.Sprintf(`SELECT %s.id AS %s FROM kw_%s AS %s`, w, w, w, w)
+		rows, err := db.Query(q)
+		if err != nil {
+			t.Fatalf("cannot query '%s': %s", q, err)
+		}
+		columns, err := rows.Columns()
+		rows.Close()
+		if err != nil || len(columns) != 1 || columns[0] != w {
+			t.Fatalf("expected column %s from '%s', got %v (%v)", w, q, columns, err)
+		}
+	}
+	// and are still matched where grammar expects them
+	queries := []string{
+		`ALTER TABLE kw_rename ADD column INT`,
+		`ALTER TABLE kw_rename RENAME column TO col`,
+		`ALTER TABLE kw_rename RENAME COLUMN rename TO renamed`,
+		`ALTER TABLE kw_rename DROP COLUMN col`,
+		`SHOW TABLES`,
+		`DESCRIBE kw_rename`,
+		`TRUNCATE kw_restart RESTART IDENTITY`,
+	}
+	for _, q := range queries {
+		if _, err := db.Exec(q); err != nil {
+			t.Fatalf("cannot exec '%s': %s", q, err)
+		}
+	}
+
+	checks := map[string]string{
+		`SELECT COUNT(*) FILTER (WHERE filter = 3) FROM kw_filter`:                  "1",
+		`SELECT CAST(cast AS TEXT) FROM kw_cast`:                                    "3",
+		`SELECT EXTRACT(year FROM '2024-03-01'::date) FROM kw_extract`:              "2024",
+		`SELECT array FROM kw_array WHERE array = ANY(ARRAY[3, 4])`:                 "3",
+		`SELECT n.natural FROM kw_natural n NATURAL JOIN kw_using`:                  "3",
+		`SELECT n.natural FROM kw_natural n JOIN kw_using u USING (id)`:             "3",
+		`SELECT renamed FROM kw_rename`:                                             "3",
+		`SELECT COUNT(*) FROM kw_restart`:                                           "0",
+		`SELECT LAG(lag, 1, 0) OVER (ORDER BY lag) FROM kw_lag`:                     "0",
+		`SELECT RANK() OVER (PARTITION BY partition ORDER BY id) FROM kw_partition`: "1",
+	}
+	for q, expected := range checks {
+		var v string
+		if err := db.QueryRow(q).Scan(&v); err != nil {
+			t.Fatalf("cannot query '%s': %s", q, err)
+		}
+		if v != expected {
+			t.Fatalf("expected %s from '%s', got %s", expected, q, v)
+		}
+	}
+}
+
+func TestResetDB(t *testing.T) {
+	db, err := sql.Open("ramsql", "TestResetDB")
+	if err != nil {
+		t.Fatalf("sql.Open : Error : %s\n", err)
+	}
+	defer db.Close()
+
+	queries := []string{
+		`CREATE SCHEMA app`,
+		`CREATE TABLE app.account (id BIGSERIAL PRIMARY KEY, email TEXT)`,
+		`CREATE TABLE user (id BIGSERIAL PRIMARY KEY, name TEXT)`,
+		`INSERT INTO user (name) VALUES ('foo')`,
+	}
+	for _, q := range queries {
+		if _, err := db.Exec(q); err != nil {
+			t.Fatalf("cannot exec '%s': %s", q, err)
+		}
+	}
+
+	// reset is seen by concurrent connections to the same database
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			rows, err := db.Query(`SELECT * FROM user`)
+			if err == nil {
+				rows.Close()
+			}
+		}()
+	}
+	err = ResetDB("TestResetDB")
+	wg.Wait()
+	if err != nil {
+		t.Fatalf("cannot reset database: %s", err)
+	}
+
+	if _, err := db.Query(`SELECT * FROM user`); err == nil {
+		t.Fatalf("expected error querying relation after reset")
+	}
+	if _, err := db.Exec(`CREATE TABLE app.account (id INT)`); err == nil {
+		t.Fatalf("expected error creating relation in dropped schema")
+	}
+
+	// database is usable again under the same name
+	for _, q := range queries {
+		if _, err := db.Exec(q); err != nil {
+			t.Fatalf("cannot exec '%s' after reset: %s", q, err)
+		}
+	}
+	var id int64
+	if err := db.QueryRow(`SELECT id FROM user WHERE name = 'foo'`).Scan(&id); err != nil {
+		t.Fatalf("cannot select after reset: %s", err)
+	}
+	if id != 1 {
+		t.Fatalf("expected sequence to restart at 1, got %d", id)
+	}
+
+	// unknown database
+	if err := ResetDB("TestResetDBUnknown"); err != nil {
+		t.Fatalf("expected no error resetting unknown database, got %s", err)
+	}
+}
+
+func TestSnapshotDB(t *testing.T) {
+	db, err := sql.Open("ramsql", "TestSnapshotDB")
+	if err != nil {
+		t.Fatalf("sql.Open : Error : %s\n", err)
+	}
+	defer db.Close()
+
+	batch := []string{
+		`CREATE SCHEMA app`,
+		`CREATE TABLE app.account (id BIGSERIAL PRIMARY KEY, email TEXT UNIQUE)`,
+		`CREATE INDEX account_email_idx ON app.account USING BTREE (email)`,
+		`CREATE SEQUENCE app.ticket_seq START WITH 10`,
+		`INSERT INTO app.account (email) VALUES ('foo@bar.com')`,
+		`INSERT INTO app.account (email) VALUES ('bar@foo.com')`,
+	}
+	for _, b := range batch {
+		if _, err := db.Exec(b); err != nil {
+			t.Fatalf("cannot exec '%s': %s", b, err)
+		}
+	}
+
+	if _, err := SnapshotDB("TestSnapshotDBUnknown"); err == nil {
+		t.Fatalf("expected error taking snapshot of unknown database")
+	}
+
+	snap, err := SnapshotDB("TestSnapshotDB")
+	if err != nil {
+		t.Fatalf("cannot take snapshot: %s", err)
+	}
+
+	// changes after snapshot are not seen by restored databases
+	if _, err := db.Exec(`DELETE FROM app.account WHERE email = 'bar@foo.com'`); err != nil {
+		t.Fatalf("cannot delete: %s", err)
+	}
+
+	for _, name := range []string{"TestSnapshotDBFork1", "TestSnapshotDBFork2"} {
+		if err := snap.Restore(name); err != nil {
+			t.Fatalf("cannot restore snapshot to %s: %s", name, err)
+		}
+	}
+
+	fork1, err := sql.Open("ramsql", "TestSnapshotDBFork1")
+	if err != nil {
+		t.Fatalf("sql.Open : Error : %s\n", err)
+	}
+	defer fork1.Close()
+	fork2, err := sql.Open("ramsql", "TestSnapshotDBFork2")
+	if err != nil {
+		t.Fatalf("sql.Open : Error : %s\n", err)
+	}
+	defer fork2.Close()
+
+	// rows, sequences, auto-increment and unique indexes are copied
+	_, err = fork1.Exec(`INSERT INTO app.account (email) VALUES ('baz@bar.com')`)
+	if err != nil {
+		t.Fatalf("cannot insert in restored database: %s", err)
+	}
+	_, err = fork1.Exec(`INSERT INTO app.account (email) VALUES ('foo@bar.com')`)
+	if err == nil {
+		t.Fatalf("expected unique violation in restored database")
+	}
+	var id int64
+	if err := fork1.QueryRow(`SELECT id FROM app.account WHERE email = 'baz@bar.com'`).Scan(&id); err != nil {
+		t.Fatalf("cannot select from restored database: %s", err)
+	}
+	if id != 3 {
+		t.Fatalf("expected id 3, got %d", id)
+	}
+	var next int64
+	if err := fork1.QueryRow(`INSERT INTO app.account (id, email) VALUES (nextval('app.ticket_seq'), 'seq@bar.com') RETURNING id`).Scan(&next); err != nil {
+		t.Fatalf("cannot get next sequence value: %s", err)
+	}
+	if next != 10 {
+		t.Fatalf("expected sequence value 10, got %d", next)
+	}
+
+	count := func(db *sql.DB) int {
+		var n int
+		if err := db.QueryRow(`SELECT COUNT(*) FROM app.account`).Scan(&n); err != nil {
+			t.Fatalf("cannot count: %s", err)
+		}
+		return n
+	}
+	if n := count(fork1); n != 4 {
+		t.Fatalf("expected 4 rows in first fork, got %d", n)
+	}
+	if n := count(fork2); n != 2 {
+		t.Fatalf("expected 2 rows in second fork, got %d", n)
+	}
+	if n := count(db); n != 1 {
+		t.Fatalf("expected 1 row in source database, got %d", n)
+	}
+
+	// restoring an opened database replaces its content
+	if err := snap.Restore("TestSnapshotDBFork1"); err != nil {
+		t.Fatalf("cannot restore snapshot: %s", err)
+	}
+	if n := count(fork1); n != 2 {
+		t.Fatalf("expected 2 rows after restore, got %d", n)
+	}
+}
+
+func TestSaveLoadDB(t *testing.T) {
+	db, err := sql.Open("ramsql", "TestSaveLoadDB")
+	if err != nil {
+		t.Fatalf("sql.Open : Error : %s\n", err)
+	}
+	defer db.Close()
+
+	batch := []string{
+		`CREATE SCHEMA app`,
+		`CREATE SEQUENCE app.invoice_seq START WITH 100`,
+		`CREATE TABLE app.account (id BIGSERIAL PRIMARY KEY, email TEXT UNIQUE, score FLOAT DEFAULT 1.5, active BOOLEAN DEFAULT true, created_at TIMESTAMP DEFAULT NOW(), age INT)`,
+		`CREATE INDEX account_age_idx ON app.account USING BTREE (age)`,
+		`INSERT INTO app.account (email, age) VALUES ('foo@bar.com', 30)`,
+		`INSERT INTO app.account (id, email, age) VALUES (nextval('app.invoice_seq'), 'seq@bar.com', 40)`,
+	}
+	for _, b := range batch {
+		if _, err := db.Exec(b); err != nil {
+			t.Fatalf("cannot exec '%s': %s", b, err)
+		}
+	}
+	_, err = db.Exec(`INSERT INTO app.account (email, score, active, created_at, age) VALUES ('bar@foo.com', 2.25, false, $1, NULL)`, time.Date(2021, 3, 4, 5, 6, 7, 0, time.UTC))
+	if err != nil {
+		t.Fatalf("cannot insert: %s", err)
+	}
+
+	path := filepath.Join(t.TempDir(), "ramsql.db")
+	if err := SaveDB("TestSaveLoadDBUnknown", path); err == nil {
+		t.Fatalf("expected error saving unknown database")
+	}
+	if err := SaveDB("TestSaveLoadDB", path); err != nil {
+		t.Fatalf("cannot save database: %s", err)
+	}
+	if err := LoadDB("TestSaveLoadDBLoaded", path); err != nil {
+		t.Fatalf("cannot load database: %s", err)
+	}
+
+	loaded, err := sql.Open("ramsql", "TestSaveLoadDBLoaded")
+	if err != nil {
+		t.Fatalf("sql.Open : Error : %s\n", err)
+	}
+	defer loaded.Close()
+
+	var score float64
+	var active bool
+	var created time.Time
+	var age sql.NullInt64
+	err = loaded.QueryRow(`SELECT score, active, created_at, age FROM app.account WHERE email = 'bar@foo.com'`).Scan(&score, &active, &created, &age)
+	if err != nil {
+		t.Fatalf("cannot query loaded database: %s", err)
+	}
+	if score != 2.25 || active || age.Valid || !created.Equal(time.Date(2021, 3, 4, 5, 6, 7, 0, time.UTC)) {
+		t.Fatalf("unexpected loaded row: %v, %v, %v, %v", score, active, created, age)
+	}
+
+	// defaults, auto-increment, sequences and indexes are restored
+	var id, next int64
+	err = loaded.QueryRow(`INSERT INTO app.account (email, age) VALUES ('new@bar.com', 50) RETURNING id`).Scan(&id)
+	if err != nil {
+		t.Fatalf("cannot insert into loaded database: %s", err)
+	}
+	if id != 3 {
+		t.Fatalf("expected auto-increment to continue at 3, got %d", id)
+	}
+	err = loaded.QueryRow(`SELECT score, active FROM app.account WHERE id = 3`).Scan(&score, &active)
+	if err != nil {
+		t.Fatalf("cannot query loaded database: %s", err)
+	}
+	if score != 1.5 || !active {
+		t.Fatalf("expected default values, got %v, %v", score, active)
+	}
+	err = loaded.QueryRow(`INSERT INTO app.account (id, email, age) VALUES (nextval('app.invoice_seq'), 'seq2@bar.com', 20) RETURNING id`).Scan(&next)
+	if err != nil {
+		t.Fatalf("cannot get next sequence value: %s", err)
+	}
+	if next != 101 {
+		t.Fatalf("expected sequence to continue at 101, got %d", next)
+	}
+	if _, err = loaded.Exec(`INSERT INTO app.account (email, age) VALUES ('foo@bar.com', 10)`); err == nil {
+		t.Fatalf("expected unique constraint to be restored")
+	}
+	var n int
+	if err = loaded.QueryRow(`SELECT COUNT(*) FROM app.account WHERE age > 35`).Scan(&n); err != nil {
+		t.Fatalf("cannot query with index: %s", err)
+	}
+	if n != 2 {
+		t.Fatalf("expected 2 rows, got %d", n)
+	}
+
+	// loading into an opened database replaces its content
+	if err := LoadDB("TestSaveLoadDB", path); err != nil {
+		t.Fatalf("cannot load database: %s", err)
+	}
+	if err = db.QueryRow(`SELECT COUNT(*) FROM app.account`).Scan(&n); err != nil {
+		t.Fatalf("cannot count: %s", err)
+	}
+	if n != 3 {
+		t.Fatalf("expected 3 rows, got %d", n)
+	}
+
+	if err := LoadDB("TestSaveLoadDBMissing", filepath.Join(t.TempDir(), "missing.db")); err == nil {
+		t.Fatalf("expected error loading missing file")
+	}
+}
+
+func TestWriteAheadLog(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ramsql.wal")
+
+	db, err := sql.Open("ramsql", "TestWriteAheadLog?wal="+path)
+	if err != nil {
+		t.Fatalf("sql.Open : Error : %s\n", err)
+	}
+	defer db.Close()
+
+	batch := []string{
+		`CREATE SCHEMA app`,
+		`CREATE SEQUENCE app.invoice_seq`,
+		`CREATE TABLE account (id BIGSERIAL PRIMARY KEY, email TEXT UNIQUE, age INT)`,
+		`CREATE TABLE session (id INT, token TEXT)`,
+		`CREATE TABLE tmp (id INT)`,
+		`INSERT INTO account (email, age) VALUES ('foo@bar.com', 20)`,
+		`INSERT INTO account (email, age) VALUES ('bar@bar.com', 30)`,
+		`INSERT INTO account (email, age) VALUES ('baz@bar.com', 40)`,
+		`INSERT INTO session (id, token) VALUES (1, 'abc')`,
+		`UPDATE account SET age = 21 WHERE email = 'foo@bar.com'`,
+		`DELETE FROM account WHERE email = 'baz@bar.com'`,
+		`ALTER TABLE account ADD COLUMN name TEXT`,
+		`ALTER TABLE session RENAME TO token`,
+		`DROP TABLE tmp`,
+		`INSERT INTO token (id, token) VALUES (nextval('app.invoice_seq'), 'def')`,
+	}
+	for _, b := range batch {
+		if _, err := db.Exec(b); err != nil {
+			t.Fatalf("cannot exec '%s': %s", b, err)
+		}
+	}
+
+	// rolled back changes are not logged
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatalf("cannot begin: %s", err)
+	}
+	if _, err := tx.Exec(`INSERT INTO account (email, age, name) VALUES ('rollback@bar.com', 50, 'foo')`); err != nil {
+		t.Fatalf("cannot insert: %s", err)
+	}
+	if err := tx.Rollback(); err != nil {
+		t.Fatalf("cannot rollback: %s", err)
+	}
+
+	// a transaction modifying a row several times is logged once
+	tx, err = db.Begin()
+	if err != nil {
+		t.Fatalf("cannot begin: %s", err)
+	}
+	for _, q := range []string{
+		`INSERT INTO account (email, age, name) VALUES ('qux@bar.com', 50, 'qux')`,
+		`UPDATE account SET age = 51 WHERE email = 'qux@bar.com'`,
+		`UPDATE account SET name = 'foo' WHERE email = 'foo@bar.com'`,
+		`UPDATE account SET name = 'bar' WHERE email = 'foo@bar.com'`,
+	} {
+		if _, err := tx.Exec(q); err != nil {
+			t.Fatalf("cannot exec '%s': %s", q, err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("cannot commit: %s", err)
+	}
+
+	// simulate a crash, with a record partially written
+	drv.Lock()
+	drv.engines["TestWriteAheadLog?wal="+path].Stop()
+	drv.Unlock()
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		t.Fatalf("cannot open log: %s", err)
+	}
+	if _, err := f.Write([]byte{0, 0, 1, 0, 1, 2, 3}); err != nil {
+		t.Fatalf("cannot write to log: %s", err)
+	}
+	f.Close()
+
+	replayed, err := sql.Open("ramsql", "TestWriteAheadLogReplayed?wal="+path)
+	if err != nil {
+		t.Fatalf("sql.Open : Error : %s\n", err)
+	}
+	defer replayed.Close()
+
+	rows, err := replayed.Query(`SELECT id, email, age, name FROM account ORDER BY id`)
+	if err != nil {
+		t.Fatalf("cannot query replayed database: %s", err)
+	}
+	var got []string
+	for rows.Next() {
+		var id, age int64
+		var email string
+		var name sql.NullString
+		if err := rows.Scan(&id, &email, &age, &name); err != nil {
+			t.Fatalf("cannot scan: %s", err)
+		}
+		got = append(got, fmt.Sprintf("%d %s %d %s", id, email, age, name.String))
+	}
+	rows.Close()
+	want := []string{"1 foo@bar.com 21 bar", "2 bar@bar.com 30 ", "5 qux@bar.com 51 qux"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("expected %v, got %v", want, got)
+	}
+
+	var n int
+	if err := replayed.QueryRow(`SELECT COUNT(*) FROM token`).Scan(&n); err != nil {
+		t.Fatalf("cannot query renamed relation: %s", err)
+	}
+	if n != 2 {
+		t.Fatalf("expected 2 rows in renamed relation, got %d", n)
+	}
+	if _, err := replayed.Query(`SELECT * FROM session`); err == nil {
+		t.Fatalf("expected renamed relation to be gone")
+	}
+	if _, err := replayed.Query(`SELECT * FROM tmp`); err == nil {
+		t.Fatalf("expected dropped relation to be gone")
+	}
+
+	// indexes, auto-increment and sequences are restored
+	if _, err := replayed.Exec(`INSERT INTO account (email, age, name) VALUES ('foo@bar.com', 1, 'dup')`); err == nil {
+		t.Fatalf("expected unique violation in replayed database")
+	}
+	var id int64
+	err = replayed.QueryRow(`INSERT INTO account (email, age, name) VALUES ('new@bar.com', 60, 'new') RETURNING id`).Scan(&id)
+	if err != nil {
+		t.Fatalf("cannot insert in replayed database: %s", err)
+	}
+	if id != 7 {
+		t.Fatalf("expected auto-increment to continue at 7, got %d", id)
+	}
+	err = replayed.QueryRow(`INSERT INTO token (id, token) VALUES (nextval('app.invoice_seq'), 'ghi') RETURNING id`).Scan(&id)
+	if err != nil {
+		t.Fatalf("cannot get next sequence value: %s", err)
+	}
+	if id != 2 {
+		t.Fatalf("expected sequence to continue at 2, got %d", id)
+	}
+
+	// log keeps growing after replay, torn record is discarded
+	drv.Lock()
+	drv.engines["TestWriteAheadLogReplayed?wal="+path].Stop()
+	drv.Unlock()
+	again, err := sql.Open("ramsql", "TestWriteAheadLogAgain?wal="+path)
+	if err != nil {
+		t.Fatalf("sql.Open : Error : %s\n", err)
+	}
+	defer again.Close()
+	if err := again.QueryRow(`SELECT COUNT(*) FROM account`).Scan(&n); err != nil {
+		t.Fatalf("cannot count: %s", err)
+	}
+	if n != 4 {
+		t.Fatalf("expected 4 rows, got %d", n)
+	}
+
+	if _, err := parseConnectionURI("TestWriteAheadLog?foo=bar"); err == nil {
+		t.Fatalf("expected error with unknown option")
+	}
+}
+
+func TestAnalyze(t *testing.T) {
+
+	db, err := sql.Open("ramsql", "TestAnalyze")
+	if err != nil {
+		t.Fatalf("sql.Open : Error : %s\n", err)
+	}
+	defer db.Close()
+
+	_, err = db.Exec(`CREATE TABLE champion (id BIGSERIAL PRIMARY KEY, user_id INT, name TEXT)`)
+	if err != nil {
+		t.Fatalf("sql.Exec: Error: %s\n", err)
+	}
+	for i := 0; i < 100; i++ {
+		_, err = db.Exec(`INSERT INTO champion (user_id, name) VALUES ($1, 'foo')`, i)
+		if err != nil {
+			t.Fatalf("sql.Exec: Error: %s\n", err)
+		}
+	}
+
+	// estimated cardinal of the scan node
+	estimate := func(query string) int64 {
+		rows, err := db.Query(`EXPLAIN ` + query)
+		if err != nil {
+			t.Fatalf("sql.Query: %s", err)
+		}
+		defer rows.Close()
+
+		var cardinal int64
+		for rows.Next() {
+			var depth int64
+			var node string
+			if err = rows.Scan(&depth, &node, &cardinal); err != nil {
+				t.Fatalf("cannot scan plan row: %s", err)
+			}
+		}
+		return cardinal
+	}
+
+	if c := estimate(`SELECT name FROM champion WHERE user_id = 7`); c != 51 {
+		t.Fatalf("expected 51 estimated rows without statistics, got %d", c)
+	}
+
+	_, err = db.Exec(`ANALYZE champion`)
+	if err != nil {
+		t.Fatalf("sql.Exec: Error: %s\n", err)
+	}
+	if c := estimate(`SELECT name FROM champion WHERE user_id = 7`); c != 2 {
+		t.Fatalf("expected 2 estimated rows, got %d", c)
+	}
+	if c := estimate(`SELECT name FROM champion WHERE user_id > 150`); c != 1 {
+		t.Fatalf("expected 1 estimated row above max value, got %d", c)
+	}
+
+	// statistics are refreshed by next ANALYZE
+	for i := 100; i < 200; i++ {
+		_, err = db.Exec(`INSERT INTO champion (user_id, name) VALUES ($1, 'bar')`, i)
+		if err != nil {
+			t.Fatalf("sql.Exec: Error: %s\n", err)
+		}
+	}
+	_, err = db.Exec(`ANALYZE`)
+	if err != nil {
+		t.Fatalf("sql.Exec: Error: %s\n", err)
+	}
+	if c := estimate(`SELECT name FROM champion WHERE user_id > 150`); c < 40 || c > 60 {
+		t.Fatalf("expected about 50 estimated rows, got %d", c)
+	}
+
+	_, err = db.Exec(`ANALYZE nope`)
+	if err == nil {
+		t.Fatalf("expected error analyzing unknown table")
+	}
+}
+
+func TestAnalyzeHistogram(t *testing.T) {
+	ctx := context.Background()
+
+	db, err := sql.Open("ramsql", "TestAnalyzeHistogram")
+	if err != nil {
+		t.Fatalf("sql.Open : Error : %s\n", err)
+	}
+	defer db.Close()
+
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		t.Fatalf("cannot get connection: %s", err)
+	}
+	defer conn.Close()
+
+	_, err = conn.ExecContext(ctx, `CREATE TABLE champion (id BIGSERIAL PRIMARY KEY, user_id INT)`)
+	if err != nil {
+		t.Fatalf("sql.Exec: Error: %s\n", err)
+	}
+	// skewed data: 99 small values and a single outlier
+	for i := 1; i < 100; i++ {
+		_, err = conn.ExecContext(ctx, `INSERT INTO champion (user_id) VALUES ($1)`, i)
+		if err != nil {
+			t.Fatalf("sql.Exec: Error: %s\n", err)
+		}
+	}
+	_, err = conn.ExecContext(ctx, `INSERT INTO champion (user_id) VALUES (10000)`)
+	if err != nil {
+		t.Fatalf("sql.Exec: Error: %s\n", err)
+	}
+
+	// estimated cardinal of the scan node
+	estimate := func() int64 {
+		rows, err := conn.QueryContext(ctx, `EXPLAIN SELECT id FROM champion WHERE user_id > 100`)
+		if err != nil {
+			t.Fatalf("sql.Query: %s", err)
+		}
+		defer rows.Close()
+
+		var cardinal int64
+		for rows.Next() {
+			var depth int64
+			var node string
+			if err = rows.Scan(&depth, &node, &cardinal); err != nil {
+				t.Fatalf("cannot scan plan row: %s", err)
+			}
+		}
+		return cardinal
+	}
+
+	_, err = conn.ExecContext(ctx, `ANALYZE champion`)
+	if err != nil {
+		t.Fatalf("sql.Exec: Error: %s\n", err)
+	}
+	if c := estimate(); c > 5 {
+		t.Fatalf("expected few estimated rows with histogram, got %d", c)
+	}
+
+	// a single bucket only interpolates between min and max
+	_, err = conn.ExecContext(ctx, `SET default_statistics_target = 1`)
+	if err != nil {
+		t.Fatalf("sql.Exec: Error: %s\n", err)
+	}
+	_, err = conn.ExecContext(ctx, `ANALYZE champion`)
+	if err != nil {
+		t.Fatalf("sql.Exec: Error: %s\n", err)
+	}
+	if c := estimate(); c < 90 {
+		t.Fatalf("expected most rows estimated with a single bucket, got %d", c)
+	}
+
+	_, err = conn.ExecContext(ctx, `SET default_statistics_target = 0`)
+	if err == nil {
+		t.Fatalf("expected error setting 0 bucket")
+	}
+}
+
+func TestParallelSelection(t *testing.T) {
+	ctx := context.Background()
+
+	db, err := sql.Open("ramsql", "TestParallelSelection")
+	if err != nil {
+		t.Fatalf("sql.Open : Error : %s\n", err)
+	}
+	defer db.Close()
+
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		t.Fatalf("cannot get connection: %s", err)
+	}
+	defer conn.Close()
+
+	batch := []string{
+		`CREATE TABLE account (id INT, name TEXT)`,
+		`CREATE TABLE champion (account_id INT, name TEXT)`,
+		`CREATE TABLE skin (champion_name TEXT, price INT)`,
+	}
+	for _, b := range batch {
+		if _, err = conn.ExecContext(ctx, b); err != nil {
+			t.Fatalf("sql.Exec: Error: %s\n", err)
+		}
+	}
+	for i := 0; i < 50; i++ {
+		if _, err = conn.ExecContext(ctx, `INSERT INTO account (id, name) VALUES ($1, $2)`, i, fmt.Sprintf("account%d", i)); err != nil {
+			t.Fatalf("sql.Exec: Error: %s\n", err)
+		}
+		if _, err = conn.ExecContext(ctx, `INSERT INTO champion (account_id, name) VALUES ($1, $2)`, i, fmt.Sprintf("champion%d", i)); err != nil {
+			t.Fatalf("sql.Exec: Error: %s\n", err)
+		}
+		if _, err = conn.ExecContext(ctx, `INSERT INTO skin (champion_name, price) VALUES ($1, $2)`, fmt.Sprintf("champion%d", i), i*10); err != nil {
+			t.Fatalf("sql.Exec: Error: %s\n", err)
+		}
+	}
+
+	query := func() []string {
+		rows, err := conn.QueryContext(ctx, `SELECT account.name, skin.price FROM account
+			JOIN champion ON account.id = champion.account_id
+			JOIN skin ON champion.name = skin.champion_name
+			WHERE account.id >= 10 AND skin.price < 300 AND champion.account_id <> 15`)
+		if err != nil {
+			t.Fatalf("sql.Query: %s", err)
+		}
+		defer rows.Close()
+
+		var res []string
+		for rows.Next() {
+			var name string
+			var price int64
+			if err = rows.Scan(&name, &price); err != nil {
+				t.Fatalf("cannot scan row: %s", err)
+			}
+			res = append(res, fmt.Sprintf("%s:%d", name, price))
+		}
+		sort.Strings(res)
+		return res
+	}
+
+	parallel := query()
+	if len(parallel) != 19 {
+		t.Fatalf("expected 19 rows, got %d: %v", len(parallel), parallel)
+	}
+
+	_, err = conn.ExecContext(ctx, `SET max_parallel_workers_per_gather = 0`)
+	if err != nil {
+		t.Fatalf("sql.Exec: Error: %s\n", err)
+	}
+	sequential := query()
+	if !reflect.DeepEqual(parallel, sequential) {
+		t.Fatalf("parallel and sequential results differ: %v, %v", parallel, sequential)
+	}
+
+	_, err = conn.ExecContext(ctx, `SET max_parallel_workers_per_gather = -1`)
+	if err == nil {
+		t.Fatalf("expected error setting negative workers")
+	}
+}
+
+func TestStatementRollback(t *testing.T) {
+	ctx := context.Background()
+
+	db, err := sql.Open("ramsql", "TestStatementRollback")
+	if err != nil {
+		t.Fatalf("sql.Open : Error : %s\n", err)
+	}
+	defer db.Close()
+
+	_, err = db.Exec(`CREATE TABLE account (id BIGINT PRIMARY KEY, balance BIGINT)`)
+	if err != nil {
+		t.Fatalf("sql.Exec: Error: %s\n", err)
+	}
+
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		t.Fatalf("cannot get connection: %s", err)
+	}
+	defer conn.Close()
+
+	count := func() int {
+		var n int
+		if err := db.QueryRow(`SELECT COUNT(*) FROM account`).Scan(&n); err != nil {
+			t.Fatalf("cannot count rows: %s", err)
+		}
+		return n
+	}
+
+	// by default, an error aborts the transaction
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		t.Fatalf("cannot begin transaction: %s", err)
+	}
+	if _, err = tx.Exec(`INSERT INTO account (id, balance) VALUES (1, 10)`); err != nil {
+		t.Fatalf("cannot insert: %s", err)
+	}
+	if _, err = tx.Exec(`INSERT INTO account (id, balance) VALUES (1, 20)`); err == nil {
+		t.Fatalf("expected primary key violation")
+	}
+	if _, err = tx.Exec(`INSERT INTO account (id, balance) VALUES (2, 20)`); err == nil {
+		t.Fatalf("expected aborted transaction to fail")
+	}
+	_ = tx.Rollback()
+	if n := count(); n != 0 {
+		t.Fatalf("expected 0 rows, got %d", n)
+	}
+
+	_, err = conn.ExecContext(ctx, `SET on_error_rollback = on`)
+	if err != nil {
+		t.Fatalf("sql.Exec: Error: %s\n", err)
+	}
+	_, err = conn.ExecContext(ctx, `SET on_error_rollback = maybe`)
+	if err == nil {
+		t.Fatalf("expected error setting invalid on_error_rollback")
+	}
+
+	tx, err = conn.BeginTx(ctx, nil)
+	if err != nil {
+		t.Fatalf("cannot begin transaction: %s", err)
+	}
+	if _, err = tx.Exec(`INSERT INTO account (id, balance) VALUES (1, 10)`); err != nil {
+		t.Fatalf("cannot insert: %s", err)
+	}
+	if _, err = tx.Exec(`UPDATE account SET balance = 15 WHERE id = 1`); err != nil {
+		t.Fatalf("cannot update: %s", err)
+	}
+	// failing statement undoes its own changes only
+	if _, err = tx.Exec(`INSERT INTO account (id, balance) VALUES (2, 20), (1, 20)`); err == nil {
+		t.Fatalf("expected primary key violation")
+	}
+	if _, err = tx.Exec(`UPDATE account SET balance = 30`); err != nil {
+		t.Fatalf("cannot update: %s", err)
+	}
+	if _, err = tx.Exec(`DELETE FROM account WHERE id = 1`); err != nil {
+		t.Fatalf("cannot delete: %s", err)
+	}
+	if _, err = tx.Exec(`INSERT INTO account (id, balance) VALUES (3, 30), (3, 30)`); err == nil {
+		t.Fatalf("expected primary key violation")
+	}
+	if _, err = tx.Exec(`INSERT INTO account (id, balance) VALUES (2, 20)`); err != nil {
+		t.Fatalf("cannot insert after failed statement: %s", err)
+	}
+	if err = tx.Commit(); err != nil {
+		t.Fatalf("cannot commit: %s", err)
+	}
+
+	rows, err := db.Query(`SELECT id, balance FROM account ORDER BY id`)
+	if err != nil {
+		t.Fatalf("cannot query: %s", err)
+	}
+	defer rows.Close()
+	var got []int64
+	for rows.Next() {
+		var id, balance int64
+		if err := rows.Scan(&id, &balance); err != nil {
+			t.Fatalf("cannot scan: %s", err)
+		}
+		got = append(got, id, balance)
+	}
+	if len(got) != 2 || got[0] != 2 || got[1] != 20 {
+		t.Fatalf("expected row (2, 20), got %v", got)
+	}
+
+	// rolling back transaction undoes every statement
+	tx, err = conn.BeginTx(ctx, nil)
+	if err != nil {
+		t.Fatalf("cannot begin transaction: %s", err)
+	}
+	if _, err = tx.Exec(`UPDATE account SET balance = 40`); err != nil {
+		t.Fatalf("cannot update: %s", err)
+	}
+	if _, err = tx.Exec(`UPDATE account SET balance = 50`); err != nil {
+		t.Fatalf("cannot update: %s", err)
+	}
+	_ = tx.Rollback()
+	var balance int64
+	if err = db.QueryRow(`SELECT balance FROM account WHERE id = 2`).Scan(&balance); err != nil {
+		t.Fatalf("cannot query: %s", err)
+	}
+	if balance != 20 {
+		t.Fatalf("expected balance 20 after rollback, got %d", balance)
+	}
+}
+
+func TestLockTimeout(t *testing.T) {
+	ctx := context.Background()
+
+	db, err := sql.Open("ramsql", "TestLockTimeout")
+	if err != nil {
+		t.Fatalf("sql.Open : Error : %s\n", err)
+	}
+	defer db.Close()
+
+	_, err = db.Exec(`CREATE TABLE job (id BIGINT PRIMARY KEY, state TEXT)`)
+	if err != nil {
+		t.Fatalf("sql.Exec: Error: %s\n", err)
+	}
+	_, err = db.Exec(`INSERT INTO job (id, state) VALUES (1, 'new')`)
+	if err != nil {
+		t.Fatalf("sql.Exec: Error: %s\n", err)
+	}
+
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		t.Fatalf("cannot get connection: %s", err)
+	}
+	defer conn.Close()
+
+	_, err = conn.ExecContext(ctx, `SET lock_timeout = -1`)
+	if err == nil {
+		t.Fatalf("expected error setting negative lock_timeout")
+	}
+	_, err = conn.ExecContext(ctx, `SET lock_timeout = '1s'`)
+	if err != nil {
+		t.Fatalf("sql.Exec: Error: %s\n", err)
+	}
+	_, err = conn.ExecContext(ctx, `SET lock_timeout = 50`)
+	if err != nil {
+		t.Fatalf("sql.Exec: Error: %s\n", err)
+	}
+
+	holder, err := db.Begin()
+	if err != nil {
+		t.Fatalf("cannot begin transaction: %s", err)
+	}
+	_, err = holder.Exec(`UPDATE job SET state = 'running' WHERE id = 1`)
+	if err != nil {
+		t.Fatalf("cannot update: %s", err)
+	}
+
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		t.Fatalf("cannot begin transaction: %s", err)
+	}
+	start := time.Now()
+	_, err = tx.Exec(`UPDATE job SET state = 'done' WHERE id = 1`)
+	if err == nil || !strings.Contains(err.Error(), "lock timeout") {
+		t.Fatalf("expected lock timeout error, got %v", err)
+	}
+	if d := time.Since(start); d > time.Second {
+		t.Fatalf("expected lock timeout after 50ms, waited %s", d)
+	}
+	_ = tx.Rollback()
+
+	if err = holder.Commit(); err != nil {
+		t.Fatalf("cannot commit: %s", err)
+	}
+
+	_, err = conn.ExecContext(ctx, `UPDATE job SET state = 'done' WHERE id = 1`)
+	if err != nil {
+		t.Fatalf("cannot update once lock is released: %s", err)
+	}
+	var state string
+	if err = db.QueryRow(`SELECT state FROM job WHERE id = 1`).Scan(&state); err != nil {
+		t.Fatalf("cannot query: %s", err)
+	}
+	if state != "done" {
+		t.Fatalf("expected state done, got %s", state)
+	}
+}
+
+func TestLockSameNameRelations(t *testing.T) {
+	ctx := context.Background()
+
+	db, err := sql.Open("ramsql", "TestLockSameNameRelations")
+	if err != nil {
+		t.Fatalf("sql.Open : Error : %s\n", err)
+	}
+	defer db.Close()
+
+	batch := []string{
+		`CREATE SCHEMA a`,
+		`CREATE TABLE a.t (id BIGINT PRIMARY KEY, v BIGINT)`,
+		`CREATE TABLE t (id BIGINT PRIMARY KEY, v BIGINT)`,
+	}
+	for _, b := range batch {
+		_, err = db.Exec(b)
+		if err != nil {
+			t.Fatalf("sql.Exec: Error: %s\n", err)
+		}
+	}
+
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		t.Fatalf("cannot get connection: %s", err)
+	}
+	defer conn.Close()
+	_, err = conn.ExecContext(ctx, `SET lock_timeout = 50`)
+	if err != nil {
+		t.Fatalf("sql.Exec: Error: %s\n", err)
+	}
+
+	holder, err := db.Begin()
+	if err != nil {
+		t.Fatalf("cannot begin transaction: %s", err)
+	}
+	_, err = holder.Exec(`INSERT INTO a.t (id, v) VALUES (1, 1)`)
+	if err != nil {
+		t.Fatalf("cannot insert: %s", err)
+	}
+	_, err = holder.Exec(`INSERT INTO t (id, v) VALUES (1, 1)`)
+	if err != nil {
+		t.Fatalf("cannot insert: %s", err)
+	}
+
+	// holder locked both relations, not only the first one named t
+	_, err = conn.ExecContext(ctx, `UPDATE t SET v = 99`)
+	if err == nil || !strings.Contains(err.Error(), "lock timeout") {
+		t.Fatalf("expected lock timeout error, got %v", err)
+	}
+
+	if err = holder.Rollback(); err != nil {
+		t.Fatalf("cannot rollback: %s", err)
+	}
+
+	var n int64
+	if err = db.QueryRow(`SELECT COUNT(*) FROM t`).Scan(&n); err != nil {
+		t.Fatalf("cannot query: %s", err)
+	}
+	if n != 0 {
+		t.Fatalf("expected no row in t after rollback, got %d", n)
+	}
+}
+
+func TestRowVersion(t *testing.T) {
+	db, err := sql.Open("ramsql", "TestRowVersion")
+	if err != nil {
+		t.Fatalf("sql.Open : Error : %s\n", err)
+	}
+	defer db.Close()
+
+	_, err = db.Exec(`CREATE TABLE counter (id BIGINT PRIMARY KEY, value BIGINT)`)
+	if err != nil {
+		t.Fatalf("sql.Exec: Error: %s\n", err)
+	}
+	_, err = db.Exec(`INSERT INTO counter (id, value) VALUES (1, 0)`)
+	if err != nil {
+		t.Fatalf("sql.Exec: Error: %s\n", err)
+	}
+
+	read := func() (int64, int64) {
+		var value, version int64
+		err := db.QueryRow(`SELECT value, xmin FROM counter WHERE id = 1`).Scan(&value, &version)
+		if err != nil {
+			t.Fatalf("cannot read counter: %s", err)
+		}
+		return value, version
+	}
+
+	value, version := read()
+	if value != 0 || version != 1 {
+		t.Fatalf("expected value 0 at version 1, got %d at version %d", value, version)
+	}
+
+	// xmin is not returned by SELECT *
+	rows, err := db.Query(`SELECT * FROM counter`)
+	if err != nil {
+		t.Fatalf("sql.Query: Error: %s\n", err)
+	}
+	cols, err := rows.Columns()
+	if err != nil {
+		t.Fatalf("cannot get columns: %s", err)
+	}
+	rows.Close()
+	if len(cols) != 2 {
+		t.Fatalf("expected 2 columns, got %v", cols)
+	}
+
+	res, err := db.Exec(`UPDATE counter SET value = $1 WHERE id = 1 AND xmin = $2`, value+1, version)
+	if err != nil {
+		t.Fatalf("cannot update: %s", err)
+	}
+	if n, _ := res.RowsAffected(); n != 1 {
+		t.Fatalf("expected 1 row updated, got %d", n)
+	}
+
+	// update with a stale version conflicts
+	res, err = db.Exec(`UPDATE counter SET value = $1 WHERE id = 1 AND xmin = $2`, value+1, version)
+	if err != nil {
+		t.Fatalf("cannot update: %s", err)
+	}
+	if n, _ := res.RowsAffected(); n != 0 {
+		t.Fatalf("expected no row updated with stale version, got %d", n)
+	}
+
+	value, version = read()
+	if value != 1 || version != 2 {
+		t.Fatalf("expected value 1 at version 2, got %d at version %d", value, version)
+	}
+
+	// rollback restores previous version
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatalf("cannot begin transaction: %s", err)
+	}
+	if _, err = tx.Exec(`UPDATE counter SET value = 10 WHERE id = 1`); err != nil {
+		t.Fatalf("cannot update: %s", err)
+	}
+	_ = tx.Rollback()
+	if _, version = read(); version != 2 {
+		t.Fatalf("expected version 2 after rollback, got %d", version)
+	}
+}
+
+func TestErrorCode(t *testing.T) {
+	db, err := sql.Open("ramsql", "TestErrorCode")
+	if err != nil {
+		t.Fatalf("sql.Open : Error : %s\n", err)
+	}
+	defer db.Close()
+
+	_, err = db.Exec(`CREATE TABLE account (id BIGINT PRIMARY KEY, email TEXT UNIQUE)`)
+	if err != nil {
+		t.Fatalf("sql.Exec: Error: %s\n", err)
+	}
+	_, err = db.Exec(`INSERT INTO account (id, email) VALUES (1, 'a@example.com')`)
+	if err != nil {
+		t.Fatalf("sql.Exec: Error: %s\n", err)
+	}
+
+	testCases := []struct {
+		query  string
+		code   string
+		table  string
+		column string
+	}{
+		{`INSERT INTO account (id, email) VALUES (1, 'b@example.com')`, UniqueViolation, "account", ""},
+		{`INSERT INTO account (id, email) VALUES (2, 'a@example.com')`, UniqueViolation, "account", ""},
+		{`INSERT INTO account (id, name) VALUES (2, 'b')`, UndefinedColumn, "account", "name"},
+		{`SELECT name FROM account`, UndefinedColumn, "account", "name"},
+		{`SELECT * FROM missing`, UndefinedTable, "missing", ""},
+		{`CREATE TABLE account (id BIGINT)`, DuplicateTable, "account", ""},
+		{`SELEC * FROM account`, SyntaxError, "", ""},
+	}
+
+	for _, tc := range testCases {
+		_, err := db.Exec(tc.query)
+		var e *Error
+		if !errors.As(err, &e) {
+			t.Fatalf("%s: expected *Error, got %T (%v)", tc.query, err, err)
+		}
+		if e.Code != tc.code {
+			t.Fatalf("%s: expected code %s, got %s (%s)", tc.query, tc.code, e.Code, e.Message)
+		}
+		if e.Table != tc.table || e.Column != tc.column {
+			t.Fatalf("%s: expected %s.%s, got %s.%s", tc.query, tc.table, tc.column, e.Table, e.Column)
+		}
+	}
+
+	// later statements of an aborted transaction fail with their own code
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatalf("cannot begin transaction: %s", err)
+	}
+	_, err = tx.Exec(`INSERT INTO account (id, email) VALUES (1, 'c@example.com')`)
+	if err == nil {
+		t.Fatalf("expected primary key violation")
+	}
+	_, err = tx.Exec(`INSERT INTO account (id, email) VALUES (3, 'c@example.com')`)
+	var e *Error
+	if !errors.As(err, &e) || e.Code != InFailedTransaction {
+		t.Fatalf("expected code %s, got %v", InFailedTransaction, err)
+	}
+	_ = tx.Rollback()
+}
+
+func TestErrorPosition(t *testing.T) {
+	db, err := sql.Open("ramsql", "TestErrorPosition")
+	if err != nil {
+		t.Fatalf("sql.Open : Error : %s\n", err)
+	}
+	defer db.Close()
+
+	_, err = db.Exec(`CREATE TABLE t (id BIGINT, name TEXT)`)
+	if err != nil {
+		t.Fatalf("sql.Exec: Error: %s\n", err)
+	}
+
+	_, err = db.Query(`SELECT id, bad FROM t`)
+	var e *Error
+	if !errors.As(err, &e) {
+		t.Fatalf("expected *Error, got %T (%v)", err, err)
+	}
+	if e.Position != 12 {
+		t.Fatalf("expected error at character 12, got %d", e.Position)
+	}
+	expected := "attribute not defined: t.bad\nLINE 1: SELECT id, bad FROM t\n                   ^"
+	if e.Error() != expected {
+		t.Fatalf("expected error\n%s\ngot\n%s", expected, e.Error())
+	}
+
+	// error on second line of query
+	_, err = db.Query("SELECT id\nFROM missing")
+	if !errors.As(err, &e) || e.Code != UndefinedTable {
+		t.Fatalf("expected undefined table error, got %v", err)
+	}
+	if e.Position != 16 {
+		t.Fatalf("expected error at character 16, got %d", e.Position)
+	}
+	if !strings.HasSuffix(e.Error(), "\nLINE 2: FROM missing\n             ^") {
+		t.Fatalf("expected caret under missing, got\n%s", e.Error())
+	}
+
+	_, err = db.Query(`SELECT id FROM t WHERE id = = 1`)
+	if !errors.As(err, &e) || e.Code != SyntaxError {
+		t.Fatalf("expected syntax error, got %v", err)
+	}
+	if e.Position == 0 {
+		t.Fatalf("expected syntax error position, got none: %s", e.Error())
+	}
+}
+
+func TestStrictTypes(t *testing.T) {
+	ctx := context.Background()
+
+	db, err := sql.Open("ramsql", "TestStrictTypes")
+	if err != nil {
+		t.Fatalf("sql.Open : Error : %s\n", err)
+	}
+	defer db.Close()
+
+	_, err = db.Exec(`CREATE TABLE item (id BIGINT PRIMARY KEY, qty BIGINT, price FLOAT, name TEXT)`)
+	if err != nil {
+		t.Fatalf("sql.Exec: Error: %s\n", err)
+	}
+
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		t.Fatalf("cannot get connection: %s", err)
+	}
+	defer conn.Close()
+
+	// lax mode converts silently
+	_, err = conn.ExecContext(ctx, `INSERT INTO item (id, qty, price, name) VALUES ($1, $2, $3, $4)`, 1, 2.7, 3, "pen")
+	if err != nil {
+		t.Fatalf("cannot insert in lax mode: %s", err)
+	}
+	var qty int64
+	if err = conn.QueryRowContext(ctx, `SELECT qty FROM item WHERE id = 1`).Scan(&qty); err != nil {
+		t.Fatalf("cannot query: %s", err)
+	}
+	if qty != 2 {
+		t.Fatalf("expected truncated qty 2, got %d", qty)
+	}
+
+	_, err = conn.ExecContext(ctx, `SET strict_types = on`)
+	if err != nil {
+		t.Fatalf("sql.Exec: Error: %s\n", err)
+	}
+
+	rejected := []struct {
+		query string
+		args  []any
+	}{
+		{`INSERT INTO item (id, qty, price, name) VALUES ($1, $2, $3, $4)`, []any{2, 2.7, 1.0, "a"}},
+		{`INSERT INTO item (id, qty, price, name) VALUES ($1, $2, $3, $4)`, []any{2, 1, 1.0, 65}},
+		{`INSERT INTO item (id, qty, price, name) VALUES ($1, $2, $3, $4)`, []any{2, 1, int64(1<<53 + 1), "a"}},
+		{`UPDATE item SET qty = $1 WHERE id = 1`, []any{0.5}},
+		{`UPDATE item SET name = $1 WHERE id = 1`, []any{1}},
+	}
+	for _, r := range rejected {
+		_, err = conn.ExecContext(ctx, r.query, r.args...)
+		var e *Error
+		if !errors.As(err, &e) || e.Code != DatatypeMismatch {
+			t.Fatalf("%s %v: expected datatype mismatch, got %v", r.query, r.args, err)
+		}
+	}
+
+	// lossless conversions are accepted
+	_, err = conn.ExecContext(ctx, `INSERT INTO item (id, qty, price, name) VALUES ($1, $2, $3, $4)`, 2, 3.0, 4, "ink")
+	if err != nil {
+		t.Fatalf("cannot insert in strict mode: %s", err)
+	}
+	_, err = conn.ExecContext(ctx, `UPDATE item SET price = $1 WHERE id = 2`, int64(5))
+	if err != nil {
+		t.Fatalf("cannot update in strict mode: %s", err)
+	}
+
+	_, err = conn.ExecContext(ctx, `SET strict_types = maybe`)
+	if err == nil {
+		t.Fatalf("expected error setting invalid strict_types")
+	}
+}
+
+func TestPing(t *testing.T) {
+	db, err := sql.Open("ramsql", "TestPing")
+	if err != nil {
+		t.Fatalf("sql.Open : Error : %s\n", err)
+	}
+	defer db.Close()
+
+	if err = db.Ping(); err != nil {
+		t.Fatalf("cannot ping: %s", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err = db.PingContext(ctx); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context canceled, got %v", err)
+	}
+
+	drv.engines["TestPing"].Stop()
+	if err = db.Ping(); err == nil {
+		t.Fatalf("expected error pinging stopped database")
+	}
+}
+
+func TestScanStruct(t *testing.T) {
+	db, err := sql.Open("ramsql", "TestScanStruct")
+	if err != nil {
+		t.Fatalf("sql.Open : Error : %s\n", err)
+	}
+	defer db.Close()
+
+	_, err = db.Exec(`CREATE TABLE account (id BIGSERIAL PRIMARY KEY, email TEXT, display_name TEXT, nickname TEXT)`)
+	if err != nil {
+		t.Fatalf("cannot create table: %s", err)
+	}
+	_, err = db.Exec(`INSERT INTO account (email, display_name, nickname) VALUES ('a@b.c', 'Alice', NULL)`)
+	if err != nil {
+		t.Fatalf("cannot insert: %s", err)
+	}
+
+	type Model struct {
+		ID int64
+	}
+	type Account struct {
+		Model
+		Mail        string `db:"email"`
+		DisplayName string
+		Nickname    *string
+		Ignored     string `db:"-"`
+	}
+
+	rows, err := db.Query(`SELECT * FROM account`)
+	if err != nil {
+		t.Fatalf("cannot select: %s", err)
+	}
+	if !rows.Next() {
+		t.Fatalf("expected a row")
+	}
+	var a Account
+	if err = ScanStruct(rows, &a); err != nil {
+		t.Fatalf("cannot scan struct: %s", err)
+	}
+	rows.Close()
+	if a.ID != 1 || a.Mail != "a@b.c" || a.DisplayName != "Alice" || a.Nickname != nil {
+		t.Fatalf("unexpected struct %+v", a)
+	}
+
+	// columns selected through an alias are named after the attribute
+	rows, err = db.Query(`SELECT ac.id, ac.email FROM account ac`)
+	if err != nil {
+		t.Fatalf("cannot select: %s", err)
+	}
+	if !rows.Next() {
+		t.Fatalf("expected a row")
+	}
+	a = Account{}
+	if err = ScanStruct(rows, &a); err != nil {
+		t.Fatalf("cannot scan struct from aliased relation: %s", err)
+	}
+	rows.Close()
+	if a.ID != 1 || a.Mail != "a@b.c" {
+		t.Fatalf("unexpected struct %+v", a)
+	}
+
+	type Partial struct {
+		Email string
+	}
+	rows, err = db.Query(`SELECT email, nickname FROM account`)
+	if err != nil {
+		t.Fatalf("cannot select: %s", err)
+	}
+	defer rows.Close()
+	rows.Next()
+	var p Partial
+	if err = ScanStruct(rows, &p); err == nil {
+		t.Fatalf("expected error scanning unmapped column")
+	}
+	if err = ScanStruct(rows, p); err == nil {
+		t.Fatalf("expected error scanning into non pointer")
+	}
+}
+
+type testStatus int
+
+const (
+	statusDraft testStatus = iota
+	statusPublished
+)
+
+func (s testStatus) Value() (driver.Value, error) {
+	return []string{"draft", "published"}[s], nil
+}
+
+func (s *testStatus) Scan(src any) error {
+	switch src {
+	case "draft":
+		*s = statusDraft
+	case "published":
+		*s = statusPublished
+	default:
+		return fmt.Errorf("invalid status %v", src)
+	}
+	return nil
+}
+
+type testMeta map[string]string
+
+func (m testMeta) Value() (driver.Value, error) {
+	return json.Marshal(m)
+}
+
+func (m *testMeta) Scan(src any) error {
+	switch src := src.(type) {
+	case string:
+		return json.Unmarshal([]byte(src), m)
+	case []byte:
+		return json.Unmarshal(src, m)
+	}
+	return fmt.Errorf("cannot scan %T into testMeta", src)
+}
+
+func TestValuerScanner(t *testing.T) {
+	db, err := sql.Open("ramsql", "TestValuerScanner")
+	if err != nil {
+		t.Fatalf("sql.Open : Error : %s\n", err)
+	}
+	defer db.Close()
+
+	_, err = db.Exec(`CREATE TABLE post (id BIGSERIAL PRIMARY KEY, status TEXT, meta JSON)`)
+	if err != nil {
+		t.Fatalf("cannot create table: %s", err)
+	}
+	_, err = db.Exec(`INSERT INTO post (status, meta) VALUES ($1, $2)`, statusPublished, testMeta{"author": "alice"})
+	if err != nil {
+		t.Fatalf("cannot insert: %s", err)
+	}
+	_, err = db.Exec(`INSERT INTO post (status, meta) VALUES ($1, $2)`, statusDraft, testMeta{})
+	if err != nil {
+		t.Fatalf("cannot insert: %s", err)
+	}
+
+	var status testStatus
+	var meta testMeta
+	err = db.QueryRow(`SELECT status, meta FROM post WHERE status = $1`, statusPublished).Scan(&status, &meta)
+	if err != nil {
+		t.Fatalf("cannot select: %s", err)
+	}
+	if status != statusPublished || meta["author"] != "alice" {
+		t.Fatalf("unexpected values %v %v", status, meta)
+	}
+
+	_, err = db.Exec(`UPDATE post SET status = $1 WHERE id = 2`, statusPublished)
+	if err != nil {
+		t.Fatalf("cannot update: %s", err)
+	}
+	var n int
+	err = db.QueryRow(`SELECT COUNT(*) FROM post WHERE status = $1`, statusPublished).Scan(&n)
+	if err != nil {
+		t.Fatalf("cannot count: %s", err)
+	}
+	if n != 2 {
+		t.Fatalf("expected 2 published posts, got %d", n)
+	}
+}
+
+func TestNull(t *testing.T) {
+	db, err := sql.Open("ramsql", "TestNull")
+	if err != nil {
+		t.Fatalf("sql.Open : Error : %s\n", err)
+	}
+	defer db.Close()
+
+	batch := []string{
+		`CREATE TABLE person (id BIGSERIAL PRIMARY KEY, name TEXT NOT NULL, nickname TEXT, age INT)`,
+		`INSERT INTO person (name) VALUES ('alice')`,
+		`INSERT INTO person (name, nickname, age) VALUES ('bob', NULL, NULL)`,
+		`INSERT INTO person (name, nickname, age) VALUES ('carol', 'caz', 32)`,
+	}
+	for _, b := range batch {
+		if _, err = db.Exec(b); err != nil {
+			t.Fatalf("sql.Exec: Error: %s\n", err)
+		}
+	}
+	_, err = db.Exec(`INSERT INTO person (name, age) VALUES ($1, $2)`, "dave", nil)
+	if err != nil {
+		t.Fatalf("cannot insert NULL argument: %s", err)
+	}
+
+	// NOT NULL is enforced on insert and update
+	var e *Error
+	_, err = db.Exec(`INSERT INTO person (nickname) VALUES ('nobody')`)
+	if !errors.As(err, &e) || e.Code != NotNullViolation {
+		t.Fatalf("expected not-null violation on omitted column, got %v", err)
+	}
+	_, err = db.Exec(`INSERT INTO person (name) VALUES (NULL)`)
+	if !errors.As(err, &e) || e.Code != NotNullViolation {
+		t.Fatalf("expected not-null violation on NULL value, got %v", err)
+	}
+	_, err = db.Exec(`UPDATE person SET name = NULL WHERE id = 1`)
+	if !errors.As(err, &e) || e.Code != NotNullViolation {
+		t.Fatalf("expected not-null violation on update, got %v", err)
+	}
+
+	rows, err := db.Query(`SELECT name, nickname, age FROM person ORDER BY id`)
+	if err != nil {
+		t.Fatalf("cannot select: %s", err)
+	}
+	defer rows.Close()
+	var got []string
+	for rows.Next() {
+		var name string
+		var nickname sql.NullString
+		var age *int
+		if err = rows.Scan(&name, &nickname, &age); err != nil {
+			t.Fatalf("cannot scan: %s", err)
+		}
+		s := name
+		if nickname.Valid {
+			s += " " + nickname.String
+		}
+		if age != nil {
+			s += fmt.Sprintf(" %d", *age)
+		}
+		got = append(got, s)
+	}
+	if err = rows.Err(); err != nil {
+		t.Fatalf("cannot iterate rows: %s", err)
+	}
+	if !reflect.DeepEqual(got, []string{"alice", "bob", "carol caz 32", "dave"}) {
+		t.Fatalf("unexpected rows %v", got)
+	}
+
+	// comparisons with NULL follow three-valued logic
+	queries := map[string]int{
+		`SELECT COUNT(*) FROM person WHERE age IS NULL`:                    3,
+		`SELECT COUNT(*) FROM person WHERE age IS NOT NULL`:                1,
+		`SELECT COUNT(*) FROM person WHERE age = NULL`:                     0,
+		`SELECT COUNT(*) FROM person WHERE age <> 32`:                      0,
+		`SELECT COUNT(*) FROM person WHERE age < 40`:                       1,
+		`SELECT COUNT(*) FROM person WHERE nickname NOT IN ('caz')`:        0,
+		`SELECT COUNT(*) FROM person WHERE age = 32 OR nickname IS NULL`:   4,
+		`SELECT COUNT(*) FROM person WHERE name = 'bob' AND age IS NULL`:   1,
+		`SELECT COUNT(*) FROM person WHERE name NOT IN ('alice', 'carol')`: 2,
+	}
+	for q, expected := range queries {
+		var n int
+		if err = db.QueryRow(q).Scan(&n); err != nil {
+			t.Fatalf("cannot query %s: %s", q, err)
+		}
+		if n != expected {
+			t.Fatalf("expected %d rows for %s, got %d", expected, q, n)
+		}
+	}
+}
+
+func TestForeignKeyIndex(t *testing.T) {
+	db, err := sql.Open("ramsql", "TestForeignKeyIndex")
+	if err != nil {
+		t.Fatalf("sql.Open : Error : %s\n", err)
+	}
+	defer db.Close()
+
+	batch := []string{
+		`CREATE TABLE author (id BIGSERIAL PRIMARY KEY, name TEXT)`,
+		`CREATE TABLE book (id BIGSERIAL PRIMARY KEY, author_id BIGINT REFERENCES author(id), title TEXT)`,
+		`INSERT INTO author (name) VALUES ('hugo'), ('zola'), ('sand')`,
+		`INSERT INTO book (author_id, title) VALUES (1, 'les miserables'), (2, 'germinal'), (1, 'notre-dame'), (NULL, 'anonymous')`,
+	}
+	for _, b := range batch {
+		if _, err = db.Exec(b); err != nil {
+			t.Fatalf("sql.Exec: Error: %s\n", err)
+		}
+	}
+
+	rows, err := db.Query(`EXPLAIN SELECT author.name, book.title FROM author JOIN book ON author.id = book.author_id`)
+	if err != nil {
+		t.Fatalf("sql.Query: %s", err)
+	}
+	var plan []string
+	for rows.Next() {
+		var depth, cardinal int64
+		var node string
+		if err = rows.Scan(&depth, &node, &cardinal); err != nil {
+			t.Fatalf("cannot scan plan row: %s", err)
+		}
+		plan = append(plan, node)
+	}
+	rows.Close()
+	if !strings.Contains(strings.Join(plan, "\n"), "IndexLookup on book using fk_public_book_author_id") {
+		t.Fatalf("expected foreign key index lookup, got %v", plan)
+	}
+
+	rows, err = db.Query(`SELECT author.name, book.title FROM author JOIN book ON author.id = book.author_id WHERE book.title <> 'germinal'`)
+	if err != nil {
+		t.Fatalf("sql.Query: %s", err)
+	}
+	defer rows.Close()
+	var got []string
+	for rows.Next() {
+		var name, title string
+		if err = rows.Scan(&name, &title); err != nil {
+			t.Fatalf("cannot scan row: %s", err)
+		}
+		got = append(got, name+": "+title)
+	}
+	sort.Strings(got)
+	if !reflect.DeepEqual(got, []string{"hugo: les miserables", "hugo: notre-dame"}) {
+		t.Fatalf("unexpected join result %v", got)
+	}
+
+	_, err = db.Exec(`DROP INDEX fk_public_book_author_id`)
+	if err == nil {
+		t.Fatalf("expected error dropping foreign key index")
+	}
+}
+
+func TestCompositeIndexProbe(t *testing.T) {
+	db, err := sql.Open("ramsql", "TestCompositeIndexProbe")
+	if err != nil {
+		t.Fatalf("sql.Open : Error : %s\n", err)
+	}
+	defer db.Close()
+
+	batch := []string{
+		`CREATE TABLE enrolment (student_id BIGINT, course_id BIGINT, grade INT, PRIMARY KEY (student_id, course_id))`,
+		`INSERT INTO enrolment (student_id, course_id, grade) VALUES (1, 1, 10), (1, 2, 12), (2, 1, 14), (2, 2, 16)`,
+	}
+	for _, b := range batch {
+		if _, err = db.Exec(b); err != nil {
+			t.Fatalf("sql.Exec: Error: %s\n", err)
+		}
+	}
+
+	query := `SELECT grade FROM enrolment WHERE course_id = 1 AND grade > 3 AND student_id = 2`
+	rows, err := db.Query(`EXPLAIN ` + query)
+	if err != nil {
+		t.Fatalf("sql.Query: %s", err)
+	}
+	var scan string
+	var cardinal int64
+	for rows.Next() {
+		var depth int64
+		if err = rows.Scan(&depth, &scan, &cardinal); err != nil {
+			t.Fatalf("cannot scan plan row: %s", err)
+		}
+	}
+	rows.Close()
+	if !strings.Contains(scan, "IndexScan on enrolment") || cardinal != 1 {
+		t.Fatalf("expected a single row index probe, got %s (%d)", scan, cardinal)
+	}
+
+	var grade int
+	if err = db.QueryRow(query).Scan(&grade); err != nil {
+		t.Fatalf("cannot select: %s", err)
+	}
+	if grade != 14 {
+		t.Fatalf("expected grade 14, got %d", grade)
+	}
+}
+
+func TestPlanMetrics(t *testing.T) {
+	db, err := sql.Open("ramsql", "TestPlanMetrics")
+	if err != nil {
+		t.Fatalf("sql.Open : Error : %s\n", err)
+	}
+	defer db.Close()
+
+	batch := []string{
+		`CREATE TABLE author (id BIGSERIAL PRIMARY KEY, name TEXT)`,
+		`CREATE TABLE book (id BIGSERIAL PRIMARY KEY, title TEXT, author_id BIGINT REFERENCES author (id))`,
+		`INSERT INTO author (name) VALUES ('hugo'), ('zola')`,
+		`INSERT INTO book (title, author_id) VALUES ('les miserables', 1), ('germinal', 2), ('nana', 2)`,
+	}
+	for _, b := range batch {
+		if _, err = db.Exec(b); err != nil {
+			t.Fatalf("sql.Exec: Error: %s\n", err)
+		}
+	}
+
+	var m PlanMetrics
+	ctx := WithPlanMetrics(context.Background(), &m)
+	rows, err := db.QueryContext(ctx, `SELECT book.title FROM author JOIN book ON author.id = book.author_id WHERE author.name = 'zola'`)
+	if err != nil {
+		t.Fatalf("sql.Query: %s", err)
+	}
+	n := 0
+	for rows.Next() {
+		n++
+	}
+	rows.Close()
+	if n != 2 || m.Actual() != 2 {
+		t.Fatalf("expected 2 rows in result and metrics, got %d and %d", n, m.Actual())
+	}
+	if len(m.Indexes()) != 1 || m.Indexes()[0] != "fk_public_book_author_id" {
+		t.Fatalf("expected foreign key index lookup, got %v", m.Indexes())
+	}
+
+	var id int64
+	if err = db.QueryRowContext(ctx, `SELECT id FROM book WHERE id = 3`).Scan(&id); err != nil {
+		t.Fatalf("cannot select: %s", err)
+	}
+	if m.Estimated() != 1 || m.Actual() != 1 {
+		t.Fatalf("expected 1 estimated and actual row, got %d and %d", m.Estimated(), m.Actual())
+	}
+}
+
+func TestNaturalJoin(t *testing.T) {
+	db, err := sql.Open("ramsql", "TestNaturalJoin")
 	if err != nil {
-		t.Fatalf("sql.Open: %s", err)
+		t.Fatalf("sql.Open : Error : %s\n", err)
 	}
 	defer db.Close()
 
-	init := []string{
-		`CREATE TABLE user (id BIGSERIAL, name TEXT)`,
-		`CREATE TABLE address (id BIGSERIAL, user_id INT, value TEXT)`,
-		`INSERT INTO user (name) VALUES ($$riri$$)`,
-		`INSERT INTO user (name) VALUES ($$fifi$$)`,
-		`INSERT INTO user (name) VALUES ($$loulou$$)`,
-		`INSERT INTO address (user_id, value) VALUES (1, 'rue du puit')`,
-		`INSERT INTO address (user_id, value) VALUES (1, 'rue du désert')`,
-		`INSERT INTO address (user_id, value) VALUES (3, 'rue du chemin')`,
-		`INSERT INTO address (user_id, value) VALUES (2, 'boulevard du con')`,
+	batch := []string{
+		`CREATE TABLE account (user_id BIGINT PRIMARY KEY, email TEXT)`,
+		`CREATE TABLE champion (user_id BIGINT, name TEXT)`,
+		`CREATE TABLE score (user_id BIGINT, name TEXT, points INT)`,
+		`INSERT INTO account (user_id, email) VALUES (1, 'foo@bar.com'), (2, 'bar@foo.com'), (3, 'baz@foo.com')`,
+		`INSERT INTO champion (user_id, name) VALUES (1, 'zed'), (2, 'lulu'), (4, 'ahri')`,
+		`INSERT INTO score (user_id, name, points) VALUES (1, 'zed', 10), (1, 'lulu', 20), (2, 'lulu', 30)`,
 	}
-	for _, q := range init {
-		_, err := db.Exec(q)
+	for _, b := range batch {
+		if _, err = db.Exec(b); err != nil {
+			t.Fatalf("sql.Exec: Error: %s\n", err)
+		}
+	}
+
+	query := func(q string) ([]string, [][]any) {
+		rows, err := db.Query(q)
 		if err != nil {
-			t.Fatalf("Cannot initialize test: %s", err)
+			t.Fatalf("cannot query %s: %s", q, err)
+		}
+		defer rows.Close()
+		cols, err := rows.Columns()
+		if err != nil {
+			t.Fatalf("cannot get columns: %s", err)
 		}
+		var res [][]any
+		for rows.Next() {
+			row := make([]any, len(cols))
+			ptrs := make([]any, len(cols))
+			for i := range row {
+				ptrs[i] = &row[i]
+			}
+			if err = rows.Scan(ptrs...); err != nil {
+				t.Fatalf("cannot scan row: %s", err)
+			}
+			res = append(res, row)
+		}
+		return cols, res
 	}
 
-	query := `SELECT user.name, address.value
-			FROM user
-			JOIN address ON address.user_id = user.id
-			WHERE user.id = $1
-			ORDER BY address.value ASC`
-	rows, err := db.Query(query, 1)
-	if err != nil {
-		t.Fatalf("Cannot select with joined order by: %s", err)
+	for _, q := range []string{
+		`SELECT * FROM account NATURAL JOIN champion ORDER BY user_id`,
+		`SELECT * FROM account JOIN champion USING (user_id) ORDER BY user_id`,
+	} {
+		cols, res := query(q)
+		if !reflect.DeepEqual(cols, []string{"user_id", "email", "name"}) {
+			t.Fatalf("unexpected columns %v for %s", cols, q)
+		}
+		expected := [][]any{{int64(1), "foo@bar.com", "zed"}, {int64(2), "bar@foo.com", "lulu"}}
+		if !reflect.DeepEqual(res, expected) {
+			t.Fatalf("expected %v for %s, got %v", expected, q, res)
+		}
 	}
-	defer rows.Close()
 
-	n := 0
-	for rows.Next() {
-		n++
+	// natural join on several attributes
+	cols, res := query(`SELECT * FROM champion NATURAL JOIN score`)
+	if !reflect.DeepEqual(cols, []string{"user_id", "name", "points"}) {
+		t.Fatalf("unexpected columns %v", cols)
 	}
-	if n != 2 {
-		t.Fatalf("Expected 2 rows, got %d", n)
+	if len(res) != 2 {
+		t.Fatalf("expected 2 rows, got %v", res)
 	}
-}
 
-func TestMultipleJoin(t *testing.T) {
+	cols, res = query(`SELECT c.name, s.points FROM champion AS c JOIN score AS s USING (user_id) WHERE s.points > 15`)
+	if len(cols) != 2 || len(res) != 2 {
+		t.Fatalf("expected 2 rows of 2 columns, got %v %v", cols, res)
+	}
 
-	db, err := sql.Open("ramsql", "TestMultipleJoin")
+	// user_id is joined once
+	_, res = query(`SELECT * FROM account JOIN champion USING (user_id) JOIN score USING (user_id)`)
+	if len(res) != 3 {
+		t.Fatalf("expected 3 rows, got %v", res)
+	}
+
+	// natural self join
+	_, res = query(`SELECT * FROM account NATURAL JOIN account AS other`)
+	if len(res) != 3 {
+		t.Fatalf("expected 3 rows, got %v", res)
+	}
+
+	errs := map[string]string{
+		`SELECT * FROM account JOIN champion USING (email)`:                                            UndefinedColumn,
+		`SELECT * FROM account JOIN champion USING (foo)`:                                              UndefinedColumn,
+		`SELECT * FROM champion JOIN score USING (user_id) NATURAL JOIN champion AS other`:             AmbiguousColumn,
+		`SELECT * FROM account JOIN champion ON account.user_id = champion.user_id NATURAL JOIN score`: AmbiguousColumn,
+	}
+	for q, code := range errs {
+		_, err := db.Query(q)
+		if err == nil {
+			t.Fatalf("expected error for %s", q)
+		}
+		var e *Error
+		if code != "" && (!errors.As(err, &e) || e.Code != code) {
+			t.Fatalf("expected error %s for %s, got %s", code, q, err)
+		}
+	}
+}
+
+func TestJoinConditions(t *testing.T) {
+	db, err := sql.Open("ramsql", "TestJoinConditions")
 	if err != nil {
-		t.Fatalf("sql.Open: %s", err)
+		t.Fatalf("sql.Open : Error : %s\n", err)
 	}
 	defer db.Close()
 
-	init := []string{
-		`CREATE TABLE user (id BIGSERIAL, name TEXT)`,
-		`CREATE TABLE address (id BIGSERIAL, user_id INT, value TEXT)`,
-		`CREATE TABLE user_group (id BIGSERIAL, user_id INT, name TEXT)`,
-		`INSERT INTO user (name) VALUES ($$riri$$)`,
-		`INSERT INTO user (name) VALUES ($$fifi$$)`,
-		`INSERT INTO user (name) VALUES ($$loulou$$)`,
-		`INSERT INTO user (name) VALUES ("foo")`,
-		`INSERT INTO user (name) VALUES ("bar")`,
-		`INSERT INTO user (name) VALUES ("baz")`,
-		`INSERT INTO address (user_id, value) VALUES (1, 'rue du puit')`,
-		`INSERT INTO address (user_id, value) VALUES (1, 'rue du désert')`,
-		`INSERT INTO address (user_id, value) VALUES (3, 'rue du chemin')`,
-		`INSERT INTO address (user_id, value) VALUES (2, 'boulevard du con')`,
-		`INSERT INTO address (user_id, value) VALUES (2, 'boulevard du fion')`,
-		`INSERT INTO address (user_id, value) VALUES (2, 'boulevard du rond')`,
-		`INSERT INTO address (user_id, value) VALUES (3, 'boulevard du don')`,
-		`INSERT INTO address (user_id, value) VALUES (4, 'boulevard du son')`,
-		`INSERT INTO address (user_id, value) VALUES (5, 'boulevard du mont')`,
-		`INSERT INTO address (user_id, value) VALUES (6, 'boulevard du non')`,
-		`INSERT INTO user_group (user_id, name) VALUES (1, 'toto')`,
-		`INSERT INTO user_group (user_id, name) VALUES (2, 'toto')`,
-		`INSERT INTO user_group (user_id, name) VALUES (3, 'lonely')`,
-		`INSERT INTO user_group (user_id, name) VALUES (1, 'cowboy')`,
+	batch := []string{
+		`CREATE TABLE season (year INT, league TEXT, starts INT, ends INT)`,
+		`CREATE TABLE game (id BIGSERIAL PRIMARY KEY, year INT, league TEXT, day INT)`,
+		`CREATE TABLE ticket (id BIGSERIAL PRIMARY KEY, game_id BIGINT, price INT)`,
+		`INSERT INTO season (year, league, starts, ends) VALUES (2023, 'east', 10, 20), (2023, 'west', 10, 30), (2024, 'east', 5, 15)`,
+		`INSERT INTO game (year, league, day) VALUES (2023, 'east', 12), (2023, 'east', 25), (2023, 'west', 25), (2024, 'east', 12), (2024, 'west', 12)`,
+		`INSERT INTO ticket (game_id, price) VALUES (1, 10), (1, 20), (3, 30), (4, 40)`,
 	}
-	for _, q := range init {
-		_, err := db.Exec(q)
+	for _, b := range batch {
+		if _, err = db.Exec(b); err != nil {
+			t.Fatalf("sql.Exec: Error: %s\n", err)
+		}
+	}
+
+	ids := func(q string) []int64 {
+		rows, err := db.Query(q)
 		if err != nil {
-			t.Fatalf("Cannot initialize test: %s", err)
+			t.Fatalf("cannot query %s: %s", q, err)
+		}
+		defer rows.Close()
+		var res []int64
+		for rows.Next() {
+			var id int64
+			if err = rows.Scan(&id); err != nil {
+				t.Fatalf("cannot scan row: %s", err)
+			}
+			res = append(res, id)
+		}
+		sort.Slice(res, func(i, j int) bool { return res[i] < res[j] })
+		return res
+	}
+
+	tests := map[string][]int64{
+		// both equalities are required
+		`SELECT game.id FROM game JOIN season ON season.year = game.year AND season.league = game.league`: {1, 2, 3, 4},
+		`SELECT g.id FROM season s JOIN game g ON s.year = g.year AND g.league = s.league`:                {1, 2, 3, 4},
+		// residual conditions filter matched rows
+		`SELECT game.id FROM game JOIN season ON season.year = game.year AND season.league = game.league AND game.day >= season.starts AND game.day <= season.ends`: {1, 3, 4},
+		`SELECT game.id FROM game JOIN season ON season.year = game.year AND game.day > season.ends`:                                                                {2, 3},
+		// compound join among several joins
+		`SELECT ticket.id FROM ticket JOIN game ON game.id = ticket.game_id JOIN season ON season.year = game.year AND season.league = game.league AND game.day < season.ends`: {1, 2, 3, 4},
+		`SELECT ticket.id FROM season JOIN game ON season.year = game.year AND season.league = game.league AND game.day < season.ends JOIN ticket ON game.id = ticket.game_id`: {1, 2, 3, 4},
+	}
+	for q, expected := range tests {
+		if got := ids(q); !reflect.DeepEqual(got, expected) {
+			t.Fatalf("expected %v for %s, got %v", expected, q, got)
 		}
 	}
 
-	query := `SELECT user.name, address.value
-			FROM user
-			JOIN address ON address.user_id = user.id
-			JOIN user_group ON user_group.user_id = address.user_id
-			WHERE user_group.name = $1
-			ORDER BY address.value ASC`
-	rows, err := db.Query(query, "toto")
+	_, err = db.Query(`SELECT game.id FROM game JOIN season ON season.year > game.year`)
+	if err == nil {
+		t.Fatalf("expected error joining without equality")
+	}
+}
+
+func TestDistinctOn(t *testing.T) {
+	db, err := sql.Open("ramsql", "TestDistinctOn")
 	if err != nil {
-		t.Fatalf("Cannot select with 3 tables joined: %s", err)
+		t.Fatalf("sql.Open : Error : %s\n", err)
 	}
-	defer rows.Close()
+	defer db.Close()
 
-	n := 0
-	for rows.Next() {
-		n++
+	batch := []string{
+		`CREATE TABLE champion (user_id BIGINT, name TEXT, level INT)`,
+		`INSERT INTO champion (user_id, name, level) VALUES (1, 'zed', 3), (1, 'lulu', 7), (2, 'ahri', 2), (3, 'jinx', 5), (3, 'vi', 5), (2, 'yasuo', 9)`,
 	}
-	if n != 5 {
-		t.Fatalf("Expected 5 rows, got %d", n)
+	for _, b := range batch {
+		if _, err = db.Exec(b); err != nil {
+			t.Fatalf("sql.Exec: Error: %s\n", err)
+		}
 	}
 
-}
+	query := func(q string) []string {
+		rows, err := db.Query(q)
+		if err != nil {
+			t.Fatalf("cannot query %s: %s", q, err)
+		}
+		defer rows.Close()
+		var res []string
+		for rows.Next() {
+			var id int64
+			var name string
+			if err = rows.Scan(&id, &name); err != nil {
+				t.Fatalf("cannot scan row: %s", err)
+			}
+			res = append(res, fmt.Sprintf("%d:%s", id, name))
+		}
+		return res
+	}
 
-func TestJoinGroup(t *testing.T) {
+	tests := map[string][]string{
+		`SELECT DISTINCT ON (user_id) user_id, name FROM champion ORDER BY user_id, name DESC`:                    {"1:zed", "2:yasuo", "3:vi"},
+		`SELECT DISTINCT ON (user_id) user_id, name FROM champion ORDER BY user_id DESC, level DESC, name`:        {"3:jinx", "2:yasuo", "1:lulu"},
+		`SELECT DISTINCT ON (c.user_id) c.user_id, c.name FROM champion AS c ORDER BY c.user_id, c.level, c.name`: {"1:zed", "2:ahri", "3:jinx"},
+		`SELECT DISTINCT ON (level, user_id) user_id, name FROM champion ORDER BY user_id, level, name LIMIT 3`:   {"1:zed", "1:lulu", "2:ahri"},
+	}
+	for q, expected := range tests {
+		if got := query(q); !reflect.DeepEqual(got, expected) {
+			t.Fatalf("expected %v for %s, got %v", expected, q, got)
+		}
+	}
 
-	db, err := sql.Open("ramsql", "TestJoinGroup")
+	for _, q := range []string{
+		`SELECT DISTINCT ON (user_id) user_id, name FROM champion ORDER BY name`,
+		`SELECT DISTINCT ON (user_id, level) user_id, name FROM champion ORDER BY user_id, name, level`,
+	} {
+		_, err := db.Query(q)
+		var e *Error
+		if !errors.As(err, &e) || e.Code != InvalidColumnReference {
+			t.Fatalf("expected invalid column reference error for %s, got %v", q, err)
+		}
+	}
+}
+
+func TestAggregateFilter(t *testing.T) {
+	db, err := sql.Open("ramsql", "TestAggregateFilter")
 	if err != nil {
-		t.Fatalf("sql.Open: %s", err)
+		t.Fatalf("sql.Open : Error : %s\n", err)
 	}
 	defer db.Close()
 
-	init := []string{
-		`CREATE TABLE user (id BIGSERIAL, name TEXT)`,
-		`CREATE TABLE group (id BIGSERIAL, name TEXT)`,
-		`CREATE TABLE user_group (id BIGSERIAL, user_id INT, group_id INT)`,
-		`INSERT INTO user (name) VALUES ($$riri$$)`,
-		`INSERT INTO user (name) VALUES ($$fifi$$)`,
-		`INSERT INTO user (name) VALUES ($$loulou$$)`,
-		`INSERT INTO group (name) VALUES ('cowboys')`,
-		`INSERT INTO group (name) VALUES ('troopers')`,
-		`INSERT INTO group (name) VALUES ('toys')`,
-		`INSERT INTO user_group (user_id, group_id) VALUES (1, 1)`,
-		`INSERT INTO user_group (user_id, group_id) VALUES (2, 1)`,
+	batch := []string{
+		`CREATE TABLE champion (user_id BIGINT, name TEXT, level INT)`,
+		`INSERT INTO champion (user_id, name, level) VALUES (1, 'zed', 3), (1, 'lulu', 7), (2, 'ahri', 2), (3, 'jinx', NULL)`,
 	}
-	for _, q := range init {
-		_, err := db.Exec(q)
+	for _, b := range batch {
+		if _, err = db.Exec(b); err != nil {
+			t.Fatalf("sql.Exec: Error: %s\n", err)
+		}
+	}
+
+	var filtered, total int64
+	err = db.QueryRow(`SELECT COUNT(*) FILTER (WHERE user_id = 1), COUNT(*) FROM champion`).Scan(&filtered, &total)
+	if err != nil {
+		t.Fatalf("cannot select: %s", err)
+	}
+	if filtered != 2 || total != 4 {
+		t.Fatalf("expected 2 and 4, got %d and %d", filtered, total)
+	}
+
+	var sum, max sql.NullInt64
+	var levels int64
+	err = db.QueryRow(`SELECT SUM(level) FILTER (WHERE user_id = $1 OR name = 'ahri') AS s, MAX(level) FILTER (WHERE user_id > 5), COUNT(level) FILTER (WHERE level IS NULL OR user_id < 3) FROM champion`, 1).Scan(&sum, &max, &levels)
+	if err != nil {
+		t.Fatalf("cannot select: %s", err)
+	}
+	if !sum.Valid || sum.Int64 != 12 || max.Valid || levels != 3 {
+		t.Fatalf("expected 12, NULL and 3, got %v, %v and %d", sum, max, levels)
+	}
+
+	// aggregates of many rows are computed in parallel
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatalf("cannot begin: %s", err)
+	}
+	for i := 0; i < 12000; i++ {
+		if _, err = tx.Exec(`INSERT INTO champion (user_id, name, level) VALUES ($1, 'bot', $2)`, 10+i%3, i); err != nil {
+			t.Fatalf("cannot insert: %s", err)
+		}
+	}
+	if err = tx.Commit(); err != nil {
+		t.Fatalf("cannot commit: %s", err)
+	}
+	err = db.QueryRow(`SELECT COUNT(*) FILTER (WHERE user_id = 10), COUNT(*) FROM champion`).Scan(&filtered, &total)
+	if err != nil {
+		t.Fatalf("cannot select: %s", err)
+	}
+	if filtered != 4000 || total != 12004 {
+		t.Fatalf("expected 4000 and 12004, got %d and %d", filtered, total)
+	}
+
+	_, err = db.Query(`SELECT COUNT(*) FILTER (WHERE user_id = 1) OVER () FROM champion`)
+	if err == nil {
+		t.Fatalf("expected error filtering window function")
+	}
+}
+
+func TestGenerateSeries(t *testing.T) {
+	db, err := sql.Open("ramsql", "TestGenerateSeries")
+	if err != nil {
+		t.Fatalf("sql.Open : Error : %s\n", err)
+	}
+	defer db.Close()
+
+	ints := func(query string, args ...any) []int64 {
+		rows, err := db.Query(query, args...)
 		if err != nil {
-			t.Fatalf("Cannot initialize test: %s", err)
+			t.Fatalf("cannot query '%s': %s", query, err)
+		}
+		defer rows.Close()
+
+		var res []int64
+		for rows.Next() {
+			var v int64
+			if err := rows.Scan(&v); err != nil {
+				t.Fatalf("cannot scan: %s", err)
+			}
+			res = append(res, v)
+		}
+		if err := rows.Err(); err != nil {
+			t.Fatalf("cannot iterate: %s", err)
 		}
+		return res
 	}
 
-	query := `SELECT user.name FROM user
-			JOIN user_group ON user.id = user_group.user_id
-			WHERE user_group.group_id = $1
-			ORDER BY user.name ASC`
-	rows, err := db.Query(query, 1)
+	res := ints(`SELECT * FROM generate_series(1, 5)`)
+	if fmt.Sprint(res) != "[1 2 3 4 5]" {
+		t.Fatalf("expected 1 to 5, got %v", res)
+	}
+	res = ints(`SELECT n FROM generate_series(10, 1, -3) AS n`)
+	if fmt.Sprint(res) != "[10 7 4 1]" {
+		t.Fatalf("expected 10 to 1 by -3, got %v", res)
+	}
+	res = ints(`SELECT generate_series FROM generate_series($1, $2) WHERE generate_series > 3`, 1, 5)
+	if fmt.Sprint(res) != "[4 5]" {
+		t.Fatalf("expected 4 and 5, got %v", res)
+	}
+	res = ints(`SELECT * FROM generate_series(5, 1)`)
+	if len(res) != 0 {
+		t.Fatalf("expected no row counting up from 5 to 1, got %v", res)
+	}
+
+	rows, err := db.Query(`SELECT d FROM generate_series('2024-01-30'::date, '2024-02-02'::date, '1 day') d`)
 	if err != nil {
-		t.Fatalf("Cannot select joined: %s", err)
+		t.Fatalf("cannot query dates: %s", err)
+	}
+	var days []string
+	for rows.Next() {
+		var d time.Time
+		if err := rows.Scan(&d); err != nil {
+			t.Fatalf("cannot scan: %s", err)
+		}
+		days = append(days, d.Format("2006-01-02"))
+	}
+	rows.Close()
+	if fmt.Sprint(days) != "[2024-01-30 2024-01-31 2024-02-01 2024-02-02]" {
+		t.Fatalf("unexpected days %v", days)
+	}
+
+	batch := []string{
+		`CREATE TABLE shipment (id BIGSERIAL PRIMARY KEY, day INT)`,
+		`INSERT INTO shipment (day) VALUES (2), (2), (4)`,
+	}
+	for _, b := range batch {
+		if _, err = db.Exec(b); err != nil {
+			t.Fatalf("sql.Exec: Error: %s\n", err)
+		}
+	}
+	res = ints(`SELECT s.id FROM generate_series(1, 3) AS d JOIN shipment s ON d.d = s.day ORDER BY s.id`)
+	if fmt.Sprint(res) != "[1 2]" {
+		t.Fatalf("expected shipments 1 and 2, got %v", res)
+	}
+	res = ints(`SELECT b.b FROM generate_series(1, 3) a JOIN generate_series(2, 5) b ON a.a = b.b ORDER BY b.b`)
+	if fmt.Sprint(res) != "[2 3]" {
+		t.Fatalf("expected 2 and 3, got %v", res)
+	}
+
+	_, err = db.Query(`SELECT * FROM generate_series(1, 10, 0)`)
+	var e *Error
+	if !errors.As(err, &e) || e.Code != InvalidParameterValue {
+		t.Fatalf("expected invalid parameter value error with zero step, got %v", err)
+	}
+	_, err = db.Query(`SELECT * FROM unknown_function(1)`)
+	if err == nil {
+		t.Fatalf("expected error calling unknown function")
+	}
+}
+
+func TestSelectWithoutFrom(t *testing.T) {
+	db, err := sql.Open("ramsql", "TestSelectWithoutFrom")
+	if err != nil {
+		t.Fatalf("sql.Open : Error : %s\n", err)
+	}
+	defer db.Close()
+
+	var one int64
+	if err = db.QueryRow(`SELECT 1`).Scan(&one); err != nil || one != 1 {
+		t.Fatalf("expected 1, got %d: %v", one, err)
+	}
+
+	var sum int64
+	var hello string
+	var now time.Time
+	err = db.QueryRow(`SELECT 1 + 1 AS two, 'hello', now()`).Scan(&sum, &hello, &now)
+	if err != nil {
+		t.Fatalf("cannot select constants: %s", err)
+	}
+	if sum != 2 || hello != "hello" || now.IsZero() {
+		t.Fatalf("expected 2, hello and current time, got %d, %s and %s", sum, hello, now)
+	}
+
+	rows, err := db.Query(`SELECT 1 AS n UNION SELECT 2 ORDER BY n`)
+	if err != nil {
+		t.Fatalf("cannot select union: %s", err)
+	}
+	var ns []int64
+	for rows.Next() {
+		var n int64
+		if err := rows.Scan(&n); err != nil {
+			t.Fatalf("cannot scan: %s", err)
+		}
+		ns = append(ns, n)
+	}
+	rows.Close()
+	if fmt.Sprint(ns) != "[1 2]" {
+		t.Fatalf("expected 1 and 2, got %v", ns)
+	}
+
+	for _, q := range []string{`SELECT 1 LIMIT 0`, `SELECT 1 OFFSET 1`} {
+		if err = db.QueryRow(q).Scan(&one); err != sql.ErrNoRows {
+			t.Fatalf("expected no row with %s, got %v", q, err)
+		}
 	}
-	defer rows.Close()
 
-	n := 0
-	for rows.Next() {
-		n++
+	if _, err = db.Exec(`CREATE TABLE account (id INT)`); err != nil {
+		t.Fatalf("sql.Exec: Error: %s\n", err)
 	}
-	if n != 2 {
-		t.Fatalf("Expected 2 rows, got %d", n)
+	if _, err = db.Exec(`INSERT INTO account (id) VALUES (1), (2)`); err != nil {
+		t.Fatalf("sql.Exec: Error: %s\n", err)
+	}
+	var id int64
+	if err = db.QueryRow(`SELECT id FROM account WHERE id = (SELECT 2)`).Scan(&id); err != nil || id != 2 {
+		t.Fatalf("expected 2, got %d: %v", id, err)
 	}
 
+	_, err = db.Query(`SELECT id`)
+	var e *Error
+	if !errors.As(err, &e) || e.Code != UndefinedColumn {
+		t.Fatalf("expected undefined column error, got %v", err)
+	}
+	for _, q := range []string{`SELECT *`, `SELECT 1 WHERE 1 = 0`} {
+		if _, err = db.Query(q); err == nil {
+			t.Fatalf("expected error with %s", q)
+		}
+	}
 }
 
-func TestOrderByInt(t *testing.T) {
-
-	db, err := sql.Open("ramsql", "TestOrderByInt")
+func TestSelectOne(t *testing.T) {
+	db, err := sql.Open("ramsql", "TestSelectOne")
 	if err != nil {
 		t.Fatalf("sql.Open : Error : %s\n", err)
 	}
 	defer db.Close()
 
-	batch := []string{
-		`CREATE TABLE user (name TEXT, surname TEXT, age INT);`,
-		`INSERT INTO user (name, surname, age) VALUES (Foo, Bar, 20);`,
-		`INSERT INTO user (name, surname, age) VALUES (John, Doe, 32);`,
-		`INSERT INTO user (name, surname, age) VALUES (Jane, Doe, 33);`,
-		`INSERT INTO user (name, surname, age) VALUES (Joe, Doe, 10);`,
-		`INSERT INTO user (name, surname, age) VALUES (Homer, Simpson, 40);`,
-		`INSERT INTO user (name, surname, age) VALUES (Marge, Simpson, 40);`,
-		`INSERT INTO user (name, surname, age) VALUES (Bruce, Wayne, 3333);`,
+	if _, err = db.Exec(`CREATE TABLE account (id INT)`); err != nil {
+		t.Fatalf("sql.Exec: Error: %s\n", err)
 	}
 
-	for _, b := range batch {
-		_, err = db.Exec(b)
-		if err != nil {
-			t.Fatalf("sql.Exec: Error: %s", err)
+	// a transaction holding a lock on account does not delay liveness checks
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatalf("cannot begin: %s", err)
+	}
+	defer tx.Rollback()
+	if _, err = tx.Exec(`INSERT INTO account (id) VALUES (1)`); err != nil {
+		t.Fatalf("cannot insert: %s", err)
+	}
+
+	for _, q := range []string{`SELECT 1`, ` select 1; `} {
+		var one int64
+		if err = db.QueryRow(q).Scan(&one); err != nil || one != 1 {
+			t.Fatalf("expected 1 with '%s', got %d: %v", q, one, err)
+		}
+		if _, err = db.Exec(q); err != nil {
+			t.Fatalf("cannot exec '%s': %s", q, err)
 		}
 	}
 
-	query := `SELECT age FROM user WHERE surname = Wayne OR surname = Doe ORDER BY age DESC`
-	rows, err := db.Query(query)
+	stmt, err := db.Prepare(`SELECT 1`)
 	if err != nil {
-		t.Fatalf("Cannot select and order by age: %s", err)
+		t.Fatalf("cannot prepare: %s", err)
 	}
-	defer rows.Close()
+	var one int64
+	if err = stmt.QueryRow().Scan(&one); err != nil || one != 1 {
+		t.Fatalf("expected 1 with prepared statement, got %d: %v", one, err)
+	}
+	stmt.Close()
 
-	var age, last, size int64
-	last = 4000
-	// Now every time 'age' should be less than 'last'
-	for rows.Next() {
-		err = rows.Scan(&age)
-		if err != nil {
-			t.Fatalf("Cannot scan age: %s", err)
-		}
-		if age > last {
-			t.Fatalf("Got %d previously and now %d", last, age)
-		}
-		last = age
-		size++
+	// within a transaction, SELECT 1 is a regular statement
+	if err = tx.QueryRow(`SELECT 1`).Scan(&one); err != nil || one != 1 {
+		t.Fatalf("expected 1 in transaction, got %d: %v", one, err)
 	}
 
-	if size != 4 {
-		t.Fatalf("Expecting 4 rows here, got %d", size)
+	drv.engines["TestSelectOne"].Stop()
+	if err = db.QueryRow(`SELECT 1`).Scan(&one); err == nil {
+		t.Fatalf("expected error with stopped database")
 	}
+}
 
-	query = `SELECT age FROM user ORDER BY age ASC`
-	rows, err = db.Query(query)
+func TestDerivedTable(t *testing.T) {
+	db, err := sql.Open("ramsql", "TestDerivedTable")
 	if err != nil {
-		t.Fatalf("cannot order by age: %s\n", err)
+		t.Fatalf("sql.Open : Error : %s\n", err)
 	}
+	defer db.Close()
 
-	size = 0
-	last = 0
-	// Now 'last' should be less than current 'age'
-	for rows.Next() {
-		err = rows.Scan(&age)
+	batch := []string{
+		`CREATE TABLE champion (user_id INT, name TEXT)`,
+		`INSERT INTO champion (user_id, name) VALUES (1, 'zed')`,
+		`INSERT INTO champion (user_id, name) VALUES (1, 'lulu')`,
+		`INSERT INTO champion (user_id, name) VALUES (2, 'ahri')`,
+	}
+	for _, b := range batch {
+		if _, err = db.Exec(b); err != nil {
+			t.Fatalf("sql.Exec: Error: %s\n", err)
+		}
+	}
+
+	names := func(query string, args ...any) []string {
+		rows, err := db.Query(query, args...)
 		if err != nil {
-			t.Fatalf("Cannot scan age: %s", err)
+			t.Fatalf("cannot query '%s': %s", query, err)
 		}
-		if last > age {
-			t.Fatalf("Got %d previously and now %d", last, age)
+		defer rows.Close()
+
+		var res []string
+		for rows.Next() {
+			var v string
+			if err := rows.Scan(&v); err != nil {
+				t.Fatalf("cannot scan: %s", err)
+			}
+			res = append(res, v)
+		}
+		if err := rows.Err(); err != nil {
+			t.Fatalf("cannot iterate: %s", err)
+		}
+		return res
+	}
+
+	tests := []struct {
+		query    string
+		args     []any
+		expected []string
+	}{
+		{`SELECT x.n FROM (SELECT name AS n FROM champion WHERE user_id = $1) AS x ORDER BY x.n`, []any{1}, []string{"lulu", "zed"}},
+		{`SELECT name FROM (SELECT * FROM champion) c WHERE user_id = 2`, nil, []string{"ahri"}},
+		{`SELECT y.n FROM (SELECT x.n FROM (SELECT name AS n FROM champion) x WHERE x.n <> 'zed') y ORDER BY y.n DESC`, nil, []string{"lulu", "ahri"}},
+		{`SELECT s FROM (SELECT 'a' AS s UNION SELECT 'b') u ORDER BY s`, nil, []string{"a", "b"}},
+		{`SELECT c.name FROM champion c JOIN (SELECT user_id FROM champion WHERE name = 'ahri') a ON a.user_id = c.user_id`, nil, []string{"ahri"}},
+	}
+	for _, tt := range tests {
+		res := names(tt.query, tt.args...)
+		if !reflect.DeepEqual(res, tt.expected) {
+			t.Fatalf("expected %v with '%s', got %v", tt.expected, tt.query, res)
 		}
-		last = age
-		size++
 	}
 
-	if size != 7 {
-		t.Fatalf("Expecting 7 rows, got %d", size)
+	_, err = db.Query(`SELECT x.nope FROM (SELECT name FROM champion) x`)
+	var e *Error
+	if !errors.As(err, &e) || e.Code != UndefinedColumn {
+		t.Fatalf("expected undefined column error, got %v", err)
+	}
+	if _, err = db.Query(`SELECT name FROM (SELECT name FROM champion)`); err == nil {
+		t.Fatalf("expected error with subquery in FROM without alias")
 	}
 }
 
-func TestOrderByString(t *testing.T) {
-
-	db, err := sql.Open("ramsql", "TestOrderByString")
+func TestOrderedSetAggregate(t *testing.T) {
+	db, err := sql.Open("ramsql", "TestOrderedSetAggregate")
 	if err != nil {
 		t.Fatalf("sql.Open : Error : %s\n", err)
 	}
 	defer db.Close()
 
 	batch := []string{
-		`CREATE TABLE user (name TEXT, surname TEXT, age INT);`,
-		`INSERT INTO user (name, surname, age) VALUES (Foo, Bar, 20);`,
-		`INSERT INTO user (name, surname, age) VALUES (John, Doe, 32);`,
-		`INSERT INTO user (name, surname, age) VALUES (Jane, Doe, 33);`,
-		`INSERT INTO user (name, surname, age) VALUES (Joe, Doe, 10);`,
-		`INSERT INTO user (name, surname, age) VALUES (Homer, Simpson, 40);`,
-		`INSERT INTO user (name, surname, age) VALUES (Marge, Simpson, 40);`,
-		`INSERT INTO user (name, surname, age) VALUES (Bruce, Wayne, 3333);`,
+		`CREATE TABLE measure (id INT, value INT, unit TEXT)`,
+		`INSERT INTO measure (id, value, unit) VALUES (1, 10, 'cm')`,
+		`INSERT INTO measure (id, value, unit) VALUES (2, 20, 'mm')`,
+		`INSERT INTO measure (id, value, unit) VALUES (3, 30, 'mm')`,
+		`INSERT INTO measure (id, value, unit) VALUES (4, 40, 'cm')`,
+		`INSERT INTO measure (id, value, unit) VALUES (5, NULL, NULL)`,
 	}
-
 	for _, b := range batch {
-		_, err = db.Exec(b)
-		if err != nil {
-			t.Fatalf("sql.Exec: Error: %s", err)
+		if _, err = db.Exec(b); err != nil {
+			t.Fatalf("sql.Exec: Error: %s\n", err)
 		}
 	}
 
-	query := `SELECT name, surname FROM user WHERE surname = $1 ORDER BY name ASC`
-	rows, err := db.Query(query, "Doe")
+	var median, p25 float64
+	var count int64
+	err = db.QueryRow(`SELECT percentile_cont(0.5) WITHIN GROUP (ORDER BY value), percentile_cont($1) WITHIN GROUP (ORDER BY value DESC) AS p25, COUNT(*) FROM measure`, 0.25).Scan(&median, &p25, &count)
 	if err != nil {
-		t.Fatalf("Cannot select and order by age: %s", err)
+		t.Fatalf("cannot query percentiles: %s", err)
 	}
-
-	var names []string
-	var name, surname string
-	for rows.Next() {
-		err = rows.Scan(&name, &surname)
-		if err != nil {
-			t.Fatalf("Cannot scan row: %s\n", err)
-		}
-		if surname != "Doe" {
-			t.Fatalf("Didn't expect surname being %s", surname)
-		}
-		names = append(names, name)
+	if median != 25 || p25 != 32.5 || count != 5 {
+		t.Fatalf("expected median 25, percentile 32.5 of 5 rows, got %v, %v, %d", median, p25, count)
 	}
 
-	if len(names) != 3 {
-		t.Fatalf("Expected 3 rows, not %d", len(names))
+	var mode, modeDesc string
+	err = db.QueryRow(`SELECT mode() WITHIN GROUP (ORDER BY unit), mode() WITHIN GROUP (ORDER BY unit DESC) FROM measure`).Scan(&mode, &modeDesc)
+	if err != nil {
+		t.Fatalf("cannot query modes: %s", err)
 	}
-
-	if names[0] != "Jane" {
-		t.Fatalf("Wanted Jane, got %s", names[0])
+	if mode != "cm" || modeDesc != "mm" {
+		t.Fatalf("expected modes cm and mm, got %s and %s", mode, modeDesc)
 	}
 
-	if names[1] != "Joe" {
-		t.Fatalf("Wanted Joe, got %s", names[1])
+	err = db.QueryRow(`SELECT mode() WITHIN GROUP (ORDER BY unit) FILTER (WHERE value > 15) FROM measure`).Scan(&mode)
+	if err != nil || mode != "mm" {
+		t.Fatalf("expected filtered mode mm, got %s: %v", mode, err)
 	}
 
-	if names[2] != "John" {
-		t.Fatalf("Wanted John, got %s", names[2])
+	var none sql.NullFloat64
+	err = db.QueryRow(`SELECT percentile_cont(0.5) WITHIN GROUP (ORDER BY value) FROM measure WHERE id > 4`).Scan(&none)
+	if err != nil || none.Valid {
+		t.Fatalf("expected NULL percentile of NULL values, got %v: %v", none, err)
 	}
 
+	_, err = db.Query(`SELECT percentile_cont(1.5) WITHIN GROUP (ORDER BY value) FROM measure`)
+	var e *Error
+	if !errors.As(err, &e) || e.Code != NumericValueOutOfRange {
+		t.Fatalf("expected numeric value out of range error, got %v", err)
+	}
+	if _, err = db.Query(`SELECT id, mode() WITHIN GROUP (ORDER BY unit) FROM measure`); err == nil {
+		t.Fatalf("expected error mixing aggregate and column")
+	}
 }
 
-func TestOrderByLimit(t *testing.T) {
-
-	db, err := sql.Open("ramsql", "TestOrderByLimit")
+func TestCollation(t *testing.T) {
+	db, err := sql.Open("ramsql", "TestCollation")
 	if err != nil {
 		t.Fatalf("sql.Open : Error : %s\n", err)
 	}
 	defer db.Close()
 
 	batch := []string{
-		`CREATE TABLE user (name TEXT, surname TEXT, age INT);`,
-		`INSERT INTO user (name, surname, age) VALUES (Foo, Bar, 20);`,
-		`INSERT INTO user (name, surname, age) VALUES (John, Doe, 32);`,
-		`INSERT INTO user (name, surname, age) VALUES (Jane, Doe, 33);`,
-		`INSERT INTO user (name, surname, age) VALUES (Joe, Doe, 10);`,
-		`INSERT INTO user (name, surname, age) VALUES (Homer, Simpson, 40);`,
-		`INSERT INTO user (name, surname, age) VALUES (Marge, Simpson, 40);`,
-		`INSERT INTO user (name, surname, age) VALUES (Bruce, Wayne, 3333);`,
+		`CREATE TABLE account (id INT, name TEXT, email TEXT COLLATE nocase)`,
+		`CREATE INDEX account_email_idx ON account (email)`,
+		`INSERT INTO account (id, name, email) VALUES (1, 'Émile', 'Emile@Bar.com')`,
+		`INSERT INTO account (id, name, email) VALUES (2, 'zed', 'zed@bar.com')`,
+		`INSERT INTO account (id, name, email) VALUES (3, 'Zoe', 'ZOE@bar.com')`,
+		`INSERT INTO account (id, name, email) VALUES (4, 'alice', NULL)`,
 	}
-
 	for _, b := range batch {
-		_, err = db.Exec(b)
-		if err != nil {
-			t.Fatalf("sql.Exec: Error: %s", err)
+		if _, err = db.Exec(b); err != nil {
+			t.Fatalf("sql.Exec: Error: %s\n", err)
 		}
 	}
 
-	query := `SELECT age FROM user WHERE 1=1 ORDER BY age DESC LIMIT 2`
-	rows, err := db.Query(query)
-	if err != nil {
-		t.Fatalf("Cannot limit select: %s", err)
-	}
-
-	var age, last, size int64
-	last = 4000
-	// Now every time 'age' should be less than 'last'
-	for rows.Next() {
-		err = rows.Scan(&age)
+	strs := func(db *sql.DB, query string) []string {
+		rows, err := db.Query(query)
 		if err != nil {
-			t.Fatalf("Cannot scan age: %s", err)
+			t.Fatalf("cannot query '%s': %s", query, err)
 		}
-		if age > last {
-			t.Fatalf("Got %d previously and now %d", last, age)
+		defer rows.Close()
+
+		var res []string
+		for rows.Next() {
+			var v string
+			if err := rows.Scan(&v); err != nil {
+				t.Fatalf("cannot scan: %s", err)
+			}
+			res = append(res, v)
+		}
+		if err := rows.Err(); err != nil {
+			t.Fatalf("cannot iterate: %s", err)
+		}
+		return res
+	}
+
+	tests := []struct {
+		query    string
+		expected []string
+	}{
+		// column collation, even with an index on the column
+		{`SELECT name FROM account WHERE email = 'emile@bar.com'`, []string{"Émile"}},
+		{`SELECT name FROM account WHERE email >= 'Z' ORDER BY id`, []string{"zed", "Zoe"}},
+		{`SELECT name FROM account WHERE email = 'emile@bar.com' COLLATE "C"`, nil},
+		// comparison collation
+		{`SELECT name FROM account WHERE name = 'ZED'`, nil},
+		{`SELECT name FROM account WHERE name COLLATE nocase = 'ZED'`, []string{"zed"}},
+		{`SELECT name FROM account WHERE name = 'ZED' COLLATE nocase`, []string{"zed"}},
+		{`SELECT name FROM account WHERE name COLLATE nocase < 'b'`, []string{"alice"}},
+		// ordering
+		{`SELECT name FROM account ORDER BY name`, []string{"Zoe", "alice", "zed", "Émile"}},
+		{`SELECT name FROM account ORDER BY name COLLATE nocase`, []string{"alice", "zed", "Zoe", "Émile"}},
+		{`SELECT name FROM account ORDER BY name COLLATE "en_US"`, []string{"alice", "Émile", "zed", "Zoe"}},
+		{`SELECT name FROM account ORDER BY account.name COLLATE "en_US.utf8" DESC`, []string{"Zoe", "zed", "Émile", "alice"}},
+		{`SELECT email FROM account WHERE id < 4 ORDER BY email DESC`, []string{"ZOE@bar.com", "zed@bar.com", "Emile@Bar.com"}},
+	}
+	for _, tt := range tests {
+		res := strs(db, tt.query)
+		if !reflect.DeepEqual(res, tt.expected) {
+			t.Fatalf("expected %v with '%s', got %v", tt.expected, tt.query, res)
 		}
-		last = age
-		size++
 	}
 
-	if size != 2 {
-		t.Fatalf("Expecting 2 rows here, got %d", size)
+	var e *Error
+	_, err = db.Query(`SELECT name FROM account ORDER BY name COLLATE "xx_nope"`)
+	if !errors.As(err, &e) || e.Code != UndefinedObject {
+		t.Fatalf("expected undefined object error, got %v", err)
+	}
+	_, err = db.Query(`SELECT name FROM account WHERE name COLLATE nocase = 'zed' COLLATE "C"`)
+	if !errors.As(err, &e) || e.Code != CollationMismatch {
+		t.Fatalf("expected collation mismatch error, got %v", err)
+	}
+	_, err = db.Exec(`CREATE TABLE invalid (n INT COLLATE nocase)`)
+	if !errors.As(err, &e) || e.Code != DatatypeMismatch {
+		t.Fatalf("expected datatype mismatch error, got %v", err)
 	}
-}
 
-func TestOrderByIntEmpty(t *testing.T) {
+	// collation of columns is dumped
+	conn, err := db.Conn(context.Background())
+	if err != nil {
+		t.Fatalf("cannot get connection: %s", err)
+	}
+	var sb strings.Builder
+	err = conn.Raw(func(driverConn any) error {
+		return driverConn.(*Conn).e.Dump(&sb)
+	})
+	conn.Close()
+	if err != nil {
+		t.Fatalf("cannot dump database: %s", err)
+	}
+	if !strings.Contains(sb.String(), `email TEXT COLLATE "nocase"`) {
+		t.Fatalf("expected collation in dump, got:\n%s", sb.String())
+	}
 
-	db, err := sql.Open("ramsql", "TestOrderByIntEmpty")
+	restored, err := sql.Open("ramsql", "TestCollationRestored")
+	if err != nil {
+		t.Fatalf("sql.Open : Error : %s\n", err)
+	}
+	defer restored.Close()
+	if _, err = restored.Exec(sb.String()); err != nil {
+		t.Fatalf("cannot replay dump: %s", err)
+	}
+	if res := strs(restored, `SELECT name FROM account WHERE email = 'ZED@BAR.COM'`); !reflect.DeepEqual(res, []string{"zed"}) {
+		t.Fatalf("expected restored collation, got %v", res)
+	}
+}
+
+func TestRegexMatch(t *testing.T) {
+	db, err := sql.Open("ramsql", "TestRegexMatch")
 	if err != nil {
 		t.Fatalf("sql.Open : Error : %s\n", err)
 	}
 	defer db.Close()
 
 	batch := []string{
-		`CREATE TABLE user (name TEXT, surname TEXT, age INT);`,
+		`CREATE TABLE account (id INT PRIMARY KEY, email TEXT)`,
+		`INSERT INTO account (id, email) VALUES (1, 'foo@bar.com')`,
+		`INSERT INTO account (id, email) VALUES (2, 'Foo@baz.com')`,
+		`INSERT INTO account (id, email) VALUES (3, 'bar42@foo.com')`,
+		`INSERT INTO account (id, email) VALUES (4, NULL)`,
 	}
-
 	for _, b := range batch {
-		_, err = db.Exec(b)
-		if err != nil {
-			t.Fatalf("sql.Exec: Error: %s", err)
+		if _, err = db.Exec(b); err != nil {
+			t.Fatalf("sql.Exec: Error: %s\n", err)
 		}
 	}
 
-	query := `SELECT age FROM user WHERE surname = Wayne OR surname = Doe ORDER BY age DESC`
-	rows, err := db.Query(query)
-	if err != nil {
-		t.Fatalf("Cannot select and order by age: %s", err)
+	tests := []struct {
+		query    string
+		args     []any
+		expected []int64
+	}{
+		{`SELECT id FROM account WHERE email ~ '^foo' ORDER BY id`, nil, []int64{1}},
+		{`SELECT id FROM account WHERE email ~* '^foo' ORDER BY id`, nil, []int64{1, 2}},
+		{`SELECT id FROM account WHERE email !~ '^foo' ORDER BY id`, nil, []int64{2, 3}},
+		{`SELECT id FROM account WHERE email !~* '^foo' ORDER BY id`, nil, []int64{3}},
+		{`SELECT id FROM account WHERE email~'\.com$' AND id > 1 ORDER BY id`, nil, []int64{2, 3}},
+		{`SELECT id FROM account WHERE email ~ '42' ORDER BY id`, nil, []int64{3}},
+		{`SELECT id FROM account WHERE account.email ~ $1 ORDER BY id`, []any{`ba[rz]\.com$`}, []int64{1, 2}},
+		{`SELECT id FROM account WHERE CAST(id AS TEXT) ~ '^[23]$' ORDER BY id`, nil, []int64{2, 3}},
+	}
+	for _, tt := range tests {
+		rows, err := db.Query(tt.query, tt.args...)
+		if err != nil {
+			t.Fatalf("cannot query '%s': %s", tt.query, err)
+		}
+		var res []int64
+		for rows.Next() {
+			var id int64
+			if err := rows.Scan(&id); err != nil {
+				t.Fatalf("cannot scan: %s", err)
+			}
+			res = append(res, id)
+		}
+		rows.Close()
+		if !reflect.DeepEqual(res, tt.expected) {
+			t.Fatalf("expected %v with '%s', got %v", tt.expected, tt.query, res)
+		}
 	}
-	defer rows.Close()
 
+	var e *Error
+	_, err = db.Query(`SELECT id FROM account WHERE email ~ '(foo'`)
+	if !errors.As(err, &e) || e.Code != InvalidRegularExpression {
+		t.Fatalf("expected invalid regular expression error, got %v", err)
+	}
+	_, err = db.Query(`SELECT id FROM account WHERE email ~* $1`, "[a-")
+	if !errors.As(err, &e) || e.Code != InvalidRegularExpression {
+		t.Fatalf("expected invalid regular expression error, got %v", err)
+	}
 }
 
-func TestOrderByMultipleStrings(t *testing.T) {
-
-	db, err := sql.Open("ramsql", "TestOrderByMultipleStrings")
+func TestLiteralComparison(t *testing.T) {
+	db, err := sql.Open("ramsql", "TestLiteralComparison")
 	if err != nil {
 		t.Fatalf("sql.Open : Error : %s\n", err)
 	}
-
-	defer func() {
-		if err := db.Close(); err != nil {
-			t.Error(err)
-		}
-	}()
+	defer db.Close()
 
 	batch := []string{
-		`CREATE TABLE user (name TEXT, surname TEXT, age BIGINT, savings DECIMAL);`,
-		`INSERT INTO user (name, surname, age, savings) VALUES (Joe, Angel, 11, 125.215);`,
-		`INSERT INTO user (name, surname, age, savings) VALUES (Joe, Angel, 11, 1.1);`,
-		`INSERT INTO user (name, surname, age, savings) VALUES (Joe, Zebra, 32, 0.921);`,
-		`INSERT INTO user (name, surname, age, savings) VALUES (Anna, Angel, 33, 0);`,
-		`INSERT INTO user (name, surname, age, savings) VALUES (Anna, Zebra, 9, 25);`,
+		`CREATE TABLE item (id INT PRIMARY KEY, v INT, name TEXT)`,
+		`CREATE INDEX item_v_idx ON item (v)`,
+		`INSERT INTO item (id, v, name) VALUES (1, 3, 'x')`,
+		`INSERT INTO item (id, v, name) VALUES (2, 50, 'y')`,
+		`INSERT INTO item (id, v, name) VALUES (3, 70, 'x')`,
 	}
-
 	for _, b := range batch {
-		_, err = db.Exec(b)
-		if err != nil {
-			t.Fatalf("sql.Exec: Error: %s", err)
+		if _, err = db.Exec(b); err != nil {
+			t.Fatalf("sql.Exec: Error: %s\n", err)
 		}
 	}
 
-	query := `SELECT name, surname, age, savings FROM user ORDER BY name ASC, age DESC, savings ASC`
-	rows, err := db.Query(query)
-	if err != nil {
-		t.Fatalf("Cannot select and order by age: %s", err)
+	tests := []struct {
+		query    string
+		expected []int64
+	}{
+		{`SELECT id FROM item WHERE 3 = v ORDER BY id`, []int64{1}},
+		{`SELECT id FROM item WHERE 50 <= v ORDER BY id`, []int64{2, 3}},
+		{`SELECT id FROM item WHERE 50 < v ORDER BY id`, []int64{3}},
+		{`SELECT id FROM item WHERE 50 > item.v ORDER BY id`, []int64{1}},
+		{`SELECT id FROM item WHERE 'x' = name ORDER BY id`, []int64{1, 3}},
+		{`SELECT id FROM item WHERE 'x' <> name AND 1 = id ORDER BY id`, nil},
+		{`SELECT id FROM item WHERE 3 = id OR 'y' = name ORDER BY id`, []int64{2, 3}},
+	}
+	for _, tt := range tests {
+		rows, err := db.Query(tt.query)
+		if err != nil {
+			t.Fatalf("cannot query '%s': %s", tt.query, err)
+		}
+		var res []int64
+		for rows.Next() {
+			var id int64
+			if err := rows.Scan(&id); err != nil {
+				t.Fatalf("cannot scan: %s", err)
+			}
+			res = append(res, id)
+		}
+		rows.Close()
+		if !reflect.DeepEqual(res, tt.expected) {
+			t.Fatalf("expected %v with '%s', got %v", tt.expected, tt.query, res)
+		}
 	}
 
-	exp := [][]string{
-		{"Anna", "33", "0"},
-		{"Anna", "9", "25"},
-		{"Joe", "32", "0.921"},
-		{"Joe", "11", "1.1"},
-		{"Joe", "11", "125.215"},
+	rows, err := db.Query(`EXPLAIN SELECT id FROM item WHERE 3 = v`)
+	if err != nil {
+		t.Fatalf("sql.Query: %s", err)
 	}
-	var (
-		got           [][]string
-		name, surname string
-		age           int64
-		savings       float64
-	)
-	for rows.Next() {
-		err = rows.Scan(&name, &surname, &age, &savings)
-		if err != nil {
-			t.Fatalf("Cannot scan row: %s\n", err)
+	var plan []string
+	for rows.Next() {
+		var depth, cardinal int64
+		var node string
+		if err = rows.Scan(&depth, &node, &cardinal); err != nil {
+			t.Fatalf("cannot scan plan row: %s", err)
 		}
-		got = append(got, []string{name, fmt.Sprint(age), fmt.Sprint(savings)})
+		plan = append(plan, node)
 	}
-
-	if len(exp) != len(got) {
-		t.Fatalf("length mismatch, expected %d but got %d", len(exp), len(got))
+	rows.Close()
+	if !strings.Contains(strings.Join(plan, "\n"), "IndexScan on item with [item.v = const 3") {
+		t.Fatalf("expected flipped comparison to use item_v_idx, got %v", plan)
 	}
-	for i := 0; i < len(exp); i++ {
-		for j := 0; j < len(exp[i]); j++ {
-			if exp[i][j] != got[i][j] {
-				t.Fatalf("data mismatch at %d/%d, expected %v but got %v", i, j, exp[i][j], got[i][j])
-			}
+
+	for _, q := range []string{
+		`SELECT id FROM item WHERE 3 = 3`,
+		`SELECT id FROM item WHERE 'x' ~ name`,
+		`SELECT id FROM item WHERE 3 IN (1, 2)`,
+	} {
+		if _, err = db.Query(q); err == nil {
+			t.Fatalf("expected error with '%s'", q)
 		}
 	}
 }
 
-func TestSelectNoOp(t *testing.T) {
-	log.SetLevel(log.WarningLevel)
-
-	db, err := sql.Open("ramsql", "TestSelectNoOp")
+func TestArray(t *testing.T) {
+	db, err := sql.Open("ramsql", "TestArray")
 	if err != nil {
 		t.Fatalf("sql.Open : Error : %s\n", err)
 	}
 	defer db.Close()
 
 	batch := []string{
-		`CREATE TABLE account (id BIGSERIAL, email TEXT)`,
-		`INSERT INTO account (email) VALUES ("foo@bar.com")`,
-		`INSERT INTO account (email) VALUES ("bar@bar.com")`,
-		`INSERT INTO account (email) VALUES ("foobar@bar.com")`,
-		`INSERT INTO account (email) VALUES ("babar@bar.com")`,
+		`CREATE TABLE post (id INT PRIMARY KEY, tags TEXT[], scores INT[])`,
+		`INSERT INTO post (id, tags, scores) VALUES (1, '{go,sql}', '{1,2,3}')`,
+		`INSERT INTO post (id, tags, scores) VALUES (2, ARRAY['rust', 'go'], ARRAY[4, 5])`,
+		`INSERT INTO post (id, tags) VALUES (3, '{}')`,
+		`UPDATE post SET scores = ARRAY[6] WHERE id = 3`,
 	}
-
 	for _, b := range batch {
-		_, err = db.Exec(b)
-		if err != nil {
+		if _, err = db.Exec(b); err != nil {
 			t.Fatalf("sql.Exec: Error: %s\n", err)
 		}
 	}
-
-	query := `SELECT * from account WHERE 1 = 1`
-	rows, err := db.Query(query)
+	_, err = db.Exec(`INSERT INTO post (id, tags, scores) VALUES (4, $1, $2)`, []string{"a b", "go"}, []int64{7, 8})
 	if err != nil {
-		t.Fatalf("cannot create table: %s", err)
+		t.Fatalf("cannot insert Go slices: %s", err)
 	}
 
-	nb := 0
-	for rows.Next() {
-		nb++
+	tests := []struct {
+		query    string
+		expected []int64
+	}{
+		{`SELECT id FROM post WHERE tags @> ARRAY['go'] ORDER BY id`, []int64{1, 2, 4}},
+		{`SELECT id FROM post WHERE tags @> '{go,sql}' ORDER BY id`, []int64{1}},
+		{`SELECT id FROM post WHERE tags <@ ARRAY['go', 'sql', 'rust'] ORDER BY id`, []int64{1, 2, 3}},
+		{`SELECT id FROM post WHERE tags && ARRAY['rust', 'sql'] ORDER BY id`, []int64{1, 2}},
+		{`SELECT id FROM post WHERE 'go' = ANY(tags) ORDER BY id`, []int64{1, 2, 4}},
+		{`SELECT id FROM post WHERE 5 = ANY(scores) ORDER BY id`, []int64{2}},
+		{`SELECT id FROM post WHERE tags[1] = 'rust' ORDER BY id`, []int64{2}},
+		{`SELECT id FROM post WHERE tags = '{go,sql}' ORDER BY id`, []int64{1}},
+		{`SELECT id FROM post WHERE array_length(tags, 1) = 2 ORDER BY id`, []int64{1, 2, 4}},
+		{`SELECT id FROM post WHERE cardinality(tags) = 0 ORDER BY id`, []int64{3}},
+	}
+	for _, tt := range tests {
+		rows, err := db.Query(tt.query)
+		if err != nil {
+			t.Fatalf("cannot query '%s': %s", tt.query, err)
+		}
+		var res []int64
+		for rows.Next() {
+			var id int64
+			if err := rows.Scan(&id); err != nil {
+				t.Fatalf("cannot scan: %s", err)
+			}
+			res = append(res, id)
+		}
+		rows.Close()
+		if !reflect.DeepEqual(res, tt.expected) {
+			t.Fatalf("expected %v with '%s', got %v", tt.expected, tt.query, res)
+		}
 	}
 
-	if nb != 4 {
-		t.Fatalf("Expected 4 rows, got %d", nb)
+	var tags, scores string
+	var first sql.NullString
+	var length sql.NullInt64
+	err = db.QueryRow(`SELECT tags, scores, tags[1], array_length(tags, 1) FROM post WHERE id = 4`).Scan(&tags, &scores, &first, &length)
+	if err != nil {
+		t.Fatalf("cannot select arrays: %s", err)
+	}
+	if tags != `{"a b",go}` || scores != `{7,8}` || first.String != "a b" || length.Int64 != 2 {
+		t.Fatalf("unexpected values %s, %s, %v, %v", tags, scores, first, length)
+	}
+	err = db.QueryRow(`SELECT tags[3], array_length(tags, 1) FROM post WHERE id = 3`).Scan(&first, &length)
+	if err != nil {
+		t.Fatalf("cannot select arrays: %s", err)
+	}
+	if first.Valid || length.Valid {
+		t.Fatalf("expected NULL subscript and length of empty array, got %v and %v", first, length)
 	}
 
+	var e *Error
+	_, err = db.Exec(`INSERT INTO post (id, tags) VALUES (5, '{a')`)
+	if !errors.As(err, &e) || e.Code != InvalidTextRepresentation {
+		t.Fatalf("expected malformed array literal error, got %v", err)
+	}
+	_, err = db.Exec(`INSERT INTO post (id, tags) VALUES (5, '{{a}}')`)
+	if err == nil {
+		t.Fatalf("expected error with nested array")
+	}
+	_, err = db.Exec(`CREATE TABLE matrix (cells INT[][])`)
+	if err == nil {
+		t.Fatalf("expected error with multidimensional array type")
+	}
 }
 
-func TestSelect(t *testing.T) {
-	db, err := sql.Open("ramsql", "TestSelect")
+func TestEnum(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ramsql.wal")
+	db, err := sql.Open("ramsql", "TestEnum?wal="+path)
 	if err != nil {
 		t.Fatalf("sql.Open : Error : %s\n", err)
 	}
 	defer db.Close()
 
-	_, err = db.Exec("CREATE TABLE account (id INT, email TEXT)")
-	if err != nil {
-		t.Fatalf("sql.Exec: Error: %s\n", err)
+	batch := []string{
+		`CREATE TYPE mood AS ENUM ('sad', 'ok', 'happy')`,
+		`CREATE TABLE person (id INT PRIMARY KEY, type TEXT, current_mood mood)`,
+		`INSERT INTO person (id, current_mood) VALUES (1, 'happy')`,
+		`INSERT INTO person (id, current_mood) VALUES (2, 'sad')`,
+		`INSERT INTO person (id, current_mood) VALUES (3, NULL)`,
 	}
-
-	_, err = db.Exec("INSERT INTO account ('id', 'email') VALUES (2, 'bar@bar.com')")
-	if err != nil {
-		t.Fatalf("Cannot insert into table account: %s", err)
+	for _, b := range batch {
+		if _, err = db.Exec(b); err != nil {
+			t.Fatalf("sql.Exec: Error: %s\n", err)
+		}
 	}
-
-	_, err = db.Exec("INSERT INTO account ('id', 'email') VALUES (1, 'foo@bar.com')")
-	if err != nil {
-		t.Fatalf("Cannot insert into table account: %s", err)
+	if _, err = db.Exec(`INSERT INTO person (id, current_mood) VALUES (4, $1)`, "ok"); err != nil {
+		t.Fatalf("cannot insert enum argument: %s", err)
 	}
 
-	rows, err := db.Query("SELECT * FROM account WHERE email = $1", "foo@bar.com")
-	if err != nil {
-		t.Fatalf("sql.Query error : %s", err)
+	var e *Error
+	for _, q := range []string{
+		`INSERT INTO person (id, current_mood) VALUES (5, 'angry')`,
+		`INSERT INTO person (id, current_mood) VALUES (5, 'Happy')`,
+		`UPDATE person SET current_mood = 'angry' WHERE id = 1`,
+	} {
+		_, err = db.Exec(q)
+		if !errors.As(err, &e) || e.Code != InvalidTextRepresentation {
+			t.Fatalf("expected invalid input value error with '%s', got %v", q, err)
+		}
 	}
 
-	columns, err := rows.Columns()
-	if err != nil {
-		t.Fatalf("rows.Column : %s", err)
-		return
+	ids := func(q string) []int64 {
+		rows, err := db.Query(q)
+		if err != nil {
+			t.Fatalf("cannot query '%s': %s", q, err)
+		}
+		defer rows.Close()
+		var res []int64
+		for rows.Next() {
+			var id int64
+			if err := rows.Scan(&id); err != nil {
+				t.Fatalf("cannot scan: %s", err)
+			}
+			res = append(res, id)
+		}
+		return res
+	}
+
+	tests := []struct {
+		query    string
+		expected []int64
+	}{
+		{`SELECT id FROM person WHERE current_mood IS NOT NULL ORDER BY current_mood`, []int64{2, 4, 1}},
+		{`SELECT id FROM person WHERE current_mood IS NOT NULL ORDER BY current_mood DESC`, []int64{1, 4, 2}},
+		{`SELECT id FROM person WHERE current_mood > 'sad' ORDER BY id`, []int64{1, 4}},
+		{`SELECT id FROM person WHERE current_mood <= 'ok' ORDER BY id`, []int64{2, 4}},
+		{`SELECT id FROM person WHERE current_mood = 'happy'`, []int64{1}},
+	}
+	for _, tt := range tests {
+		if res := ids(tt.query); !reflect.DeepEqual(res, tt.expected) {
+			t.Fatalf("expected %v with '%s', got %v", tt.expected, tt.query, res)
+		}
 	}
 
-	if len(columns) != 2 {
-		t.Fatalf("Expected 2 columns, got %d", len(columns))
+	var max, min string
+	if err = db.QueryRow(`SELECT MAX(current_mood), MIN(current_mood) FROM person`).Scan(&max, &min); err != nil {
+		t.Fatalf("cannot select MAX and MIN: %s", err)
+	}
+	if max != "happy" || min != "sad" {
+		t.Fatalf("expected MAX happy and MIN sad, got %s and %s", max, min)
 	}
 
-	row := db.QueryRow("SELECT * FROM account WHERE email = $1", "foo@bar.com")
-	if row == nil {
-		t.Fatalf("sql.QueryRow error")
+	_, err = db.Exec(`CREATE TYPE mood AS ENUM ('x')`)
+	if err == nil {
+		t.Fatalf("expected error creating existing type")
+	}
+	_, err = db.Exec(`CREATE TYPE size AS ENUM ('s', 's')`)
+	if err == nil {
+		t.Fatalf("expected error with duplicate label")
+	}
+	_, err = db.Exec(`DROP TYPE mood`)
+	if !errors.As(err, &e) || e.Code != DependentObjectsExist {
+		t.Fatalf("expected dependent objects error, got %v", err)
 	}
 
-	var email string
-	var id int
-	err = row.Scan(&id, &email)
+	// type creation is rolled back
+	tx, err := db.Begin()
 	if err != nil {
-		t.Fatalf("row.Scan: %s", err)
+		t.Fatalf("cannot begin: %s", err)
 	}
-
-	if id != 1 {
-		t.Fatalf("Expected id = 1, got %d", id)
+	if _, err = tx.Exec(`CREATE TYPE size AS ENUM ('s', 'm', 'l')`); err != nil {
+		t.Fatalf("cannot create type: %s", err)
 	}
-
-	if email != "foo@bar.com" {
-		t.Fatalf("Expected email = <foo@bar.com>, got <%s>", email)
+	if err = tx.Rollback(); err != nil {
+		t.Fatalf("cannot rollback: %s", err)
+	}
+	_, err = db.Exec(`DROP TYPE size`)
+	if !errors.As(err, &e) || e.Code != UndefinedObject {
+		t.Fatalf("expected undefined type error, got %v", err)
+	}
+	if _, err = db.Exec(`DROP TYPE IF EXISTS size`); err != nil {
+		t.Fatalf("cannot drop missing type with IF EXISTS: %s", err)
+	}
+	if _, err = db.Exec(`CREATE TYPE size AS ENUM ('s', 'm', 'l')`); err != nil {
+		t.Fatalf("cannot create type: %s", err)
+	}
+	if _, err = db.Exec(`DROP TYPE size`); err != nil {
+		t.Fatalf("cannot drop type: %s", err)
 	}
 
-	err = db.Close()
+	// enum types are dumped before tables using them
+	conn, err := db.Conn(context.Background())
 	if err != nil {
-		t.Fatalf("sql.Close : Error : %s\n", err)
+		t.Fatalf("cannot get connection: %s", err)
+	}
+	var sb strings.Builder
+	err = conn.Raw(func(driverConn any) error {
+		return driverConn.(*Conn).e.Dump(&sb)
+	})
+	conn.Close()
+	if err != nil {
+		t.Fatalf("cannot dump database: %s", err)
+	}
+	if !strings.HasPrefix(sb.String(), `CREATE TYPE mood AS ENUM ('sad', 'ok', 'happy');`) {
+		t.Fatalf("expected enum type in dump, got:\n%s", sb.String())
+	}
+
+	// enum types are saved and logged
+	dbPath := filepath.Join(t.TempDir(), "ramsql.db")
+	if err := SaveDB("TestEnum?wal="+path, dbPath); err != nil {
+		t.Fatalf("cannot save database: %s", err)
+	}
+	if err := LoadDB("TestEnumLoaded", dbPath); err != nil {
+		t.Fatalf("cannot load database: %s", err)
 	}
+	drv.Lock()
+	drv.engines["TestEnum?wal="+path].Stop()
+	drv.Unlock()
 
+	for _, dsn := range []string{"TestEnumLoaded", "TestEnumReplayed?wal=" + path} {
+		other, err := sql.Open("ramsql", dsn)
+		if err != nil {
+			t.Fatalf("sql.Open : Error : %s\n", err)
+		}
+		_, err = other.Exec(`INSERT INTO person (id, current_mood) VALUES (5, 'angry')`)
+		if !errors.As(err, &e) || e.Code != InvalidTextRepresentation {
+			t.Fatalf("expected invalid input value error in %s, got %v", dsn, err)
+		}
+		if _, err = other.Exec(`CREATE TABLE other (m mood)`); err != nil {
+			t.Fatalf("cannot use enum type in %s: %s", dsn, err)
+		}
+		var mood string
+		if err = other.QueryRow(`SELECT current_mood FROM person WHERE current_mood < 'happy' ORDER BY current_mood DESC LIMIT 1`).Scan(&mood); err != nil || mood != "ok" {
+			t.Fatalf("expected ok in %s, got %s (%v)", dsn, mood, err)
+		}
+		other.Close()
+	}
 }
 
-func TestCount(t *testing.T) {
-	db, err := sql.Open("ramsql", "TestCount")
+func TestDomain(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ramsql.wal")
+	db, err := sql.Open("ramsql", "TestDomain?wal="+path)
 	if err != nil {
 		t.Fatalf("sql.Open : Error : %s\n", err)
 	}
 	defer db.Close()
 
 	batch := []string{
-		`CREATE TABLE account (id BIGSERIAL, email TEXT)`,
-		`INSERT INTO account (email) VALUES ("foo@bar.com")`,
-		`INSERT INTO account (email) VALUES ("bar@bar.com")`,
-		`INSERT INTO account (email) VALUES ("foobar@bar.com")`,
-		`INSERT INTO account (email) VALUES ("babar@bar.com")`,
+		`CREATE DOMAIN positive_int AS INT CHECK (VALUE > 0) DEFAULT 1`,
+		`CREATE DOMAIN code TEXT NOT NULL CHECK (VALUE ~ '^[A-Z]+$' AND VALUE <> 'NONE')`,
+		`CREATE TABLE item (id INT PRIMARY KEY, qty positive_int, stock positive_int DEFAULT 10, c code)`,
+		`INSERT INTO item (id, qty, c) VALUES (1, 5, 'AB')`,
+		`INSERT INTO item (id, c) VALUES (2, 'XYZ')`,
+		`INSERT INTO item (id, qty, stock, c) VALUES (3, NULL, 2, 'Q')`,
 	}
-
 	for _, b := range batch {
-		_, err = db.Exec(b)
-		if err != nil {
+		if _, err = db.Exec(b); err != nil {
 			t.Fatalf("sql.Exec: Error: %s\n", err)
 		}
 	}
 
-	var count int64
-	err = db.QueryRow(`SELECT COUNT(*) FROM account WHERE 1=1`).Scan(&count)
-	if err != nil {
-		t.Fatalf("cannot select COUNT of account: %s\n", err)
+	var qty sql.NullInt64
+	var stock int64
+	if err = db.QueryRow(`SELECT qty, stock FROM item WHERE id = 2`).Scan(&qty, &stock); err != nil {
+		t.Fatalf("cannot select defaults: %s", err)
+	}
+	if !qty.Valid || qty.Int64 != 1 || stock != 10 {
+		t.Fatalf("expected domain default 1 and column default 10, got %v and %d", qty, stock)
+	}
+	if err = db.QueryRow(`SELECT qty FROM item WHERE id = 3`).Scan(&qty); err != nil || qty.Valid {
+		t.Fatalf("expected NULL to satisfy check, got %v (%v)", qty, err)
 	}
 
-	if count != 4 {
-		t.Fatalf("Expected count to be 4, not %d", count)
+	var e *Error
+	for _, q := range []string{
+		`INSERT INTO item (id, qty, c) VALUES (4, 0, 'A')`,
+		`INSERT INTO item (id, qty, c) VALUES (4, -3, 'A')`,
+		`INSERT INTO item (id, c) VALUES (4, 'abc')`,
+		`INSERT INTO item (id, c) VALUES (4, 'NONE')`,
+		`UPDATE item SET qty = 0 WHERE id = 1`,
+	} {
+		_, err = db.Exec(q)
+		if !errors.As(err, &e) || e.Code != CheckViolation {
+			t.Fatalf("expected check violation with '%s', got %v", q, err)
+		}
+		if !strings.Contains(err.Error(), "value for domain ") {
+			t.Fatalf("expected error naming domain with '%s', got %v", q, err)
+		}
+	}
+	_, err = db.Exec(`INSERT INTO item (id, qty, c) VALUES (4, $1, 'A')`, -1)
+	if !errors.As(err, &e) || e.Code != CheckViolation || !strings.Contains(err.Error(), "positive_int") {
+		t.Fatalf("expected check violation of positive_int with argument, got %v", err)
+	}
+	_, err = db.Exec(`INSERT INTO item (id, qty) VALUES (4, 1)`)
+	if !errors.As(err, &e) || e.Code != NotNullViolation {
+		t.Fatalf("expected not null violation of code, got %v", err)
 	}
 
-	err = db.QueryRow(`SELECT COUNT(i_dont_exist_lol) FROM account WHERE 1=1`).Scan(&count)
+	_, err = db.Exec(`CREATE DOMAIN positive_int AS INT`)
 	if err == nil {
-		t.Fatalf("Expected an error from a non existing attribute")
+		t.Fatalf("expected error creating existing domain")
+	}
+	_, err = db.Exec(`CREATE DOMAIN bad AS INT DEFAULT 0 CHECK (VALUE > 0)`)
+	if !errors.As(err, &e) || e.Code != CheckViolation {
+		t.Fatalf("expected check violation of default value, got %v", err)
+	}
+	_, err = db.Exec(`CREATE DOMAIN bad AS unknown_type`)
+	if !errors.As(err, &e) || e.Code != UndefinedObject {
+		t.Fatalf("expected undefined type error, got %v", err)
+	}
+	_, err = db.Exec(`DROP DOMAIN positive_int`)
+	if !errors.As(err, &e) || e.Code != DependentObjectsExist {
+		t.Fatalf("expected dependent objects error, got %v", err)
 	}
 
-}
+	// domain creation is rolled back
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatalf("cannot begin: %s", err)
+	}
+	if _, err = tx.Exec(`CREATE DOMAIN small AS INT CHECK (VALUE < 10)`); err != nil {
+		t.Fatalf("cannot create domain: %s", err)
+	}
+	if err = tx.Rollback(); err != nil {
+		t.Fatalf("cannot rollback: %s", err)
+	}
+	_, err = db.Exec(`DROP DOMAIN small`)
+	if !errors.As(err, &e) || e.Code != UndefinedObject {
+		t.Fatalf("expected undefined domain error, got %v", err)
+	}
+	if _, err = db.Exec(`DROP DOMAIN IF EXISTS small`); err != nil {
+		t.Fatalf("cannot drop missing domain with IF EXISTS: %s", err)
+	}
 
-func TestUpdateSimple(t *testing.T) {
+	// domains are dumped before tables using them
+	conn, err := db.Conn(context.Background())
+	if err != nil {
+		t.Fatalf("cannot get connection: %s", err)
+	}
+	var sb strings.Builder
+	err = conn.Raw(func(driverConn any) error {
+		return driverConn.(*Conn).e.Dump(&sb)
+	})
+	conn.Close()
+	if err != nil {
+		t.Fatalf("cannot dump database: %s", err)
+	}
+	if !strings.HasPrefix(sb.String(), `CREATE DOMAIN code AS text NOT NULL CHECK (VALUE ~ '^[A-Z]+$' AND VALUE <> 'NONE');
+CREATE DOMAIN positive_int AS int DEFAULT 1 CHECK (VALUE > 0);`) {
+		t.Fatalf("expected domains in dump, got:\n%s", sb.String())
+	}
 
-	db, err := sql.Open("ramsql", "TestUpdateSimple")
+	// domains are saved and logged, their check compiled again
+	dbPath := filepath.Join(t.TempDir(), "ramsql.db")
+	if err := SaveDB("TestDomain?wal="+path, dbPath); err != nil {
+		t.Fatalf("cannot save database: %s", err)
+	}
+	if err := LoadDB("TestDomainLoaded", dbPath); err != nil {
+		t.Fatalf("cannot load database: %s", err)
+	}
+	drv.Lock()
+	drv.engines["TestDomain?wal="+path].Stop()
+	drv.Unlock()
+
+	for _, dsn := range []string{"TestDomainLoaded", "TestDomainReplayed?wal=" + path} {
+		other, err := sql.Open("ramsql", dsn)
+		if err != nil {
+			t.Fatalf("sql.Open : Error : %s\n", err)
+		}
+		_, err = other.Exec(`UPDATE item SET qty = 0 WHERE id = 1`)
+		if !errors.As(err, &e) || e.Code != CheckViolation {
+			t.Fatalf("expected check violation in %s, got %v", dsn, err)
+		}
+		if _, err = other.Exec(`CREATE TABLE other (id INT, n positive_int)`); err != nil {
+			t.Fatalf("cannot use domain in %s: %s", dsn, err)
+		}
+		_, err = other.Exec(`INSERT INTO other (id, n) VALUES (1, -1)`)
+		if !errors.As(err, &e) || e.Code != CheckViolation {
+			t.Fatalf("expected check violation of new table in %s, got %v", dsn, err)
+		}
+		var n int64
+		if _, err = other.Exec(`INSERT INTO other (id) VALUES (1)`); err != nil {
+			t.Fatalf("cannot insert in %s: %s", dsn, err)
+		}
+		if err = other.QueryRow(`SELECT n FROM other`).Scan(&n); err != nil || n != 1 {
+			t.Fatalf("expected domain default in %s, got %d (%v)", dsn, n, err)
+		}
+		other.Close()
+	}
+}
+
+func TestPreparedStatement(t *testing.T) {
+	db, err := sql.Open("ramsql", "TestPreparedStatement")
 	if err != nil {
 		t.Fatalf("sql.Open : Error : %s\n", err)
 	}
 	defer db.Close()
 
-	_, err = db.Exec("CREATE TABLE account (id INT AUTOINCREMENT, email TEXT)")
-	if err != nil {
+	if _, err = db.Exec(`CREATE TABLE item (id INT PRIMARY KEY, name TEXT)`); err != nil {
 		t.Fatalf("sql.Exec: Error: %s\n", err)
 	}
 
-	_, err = db.Exec("INSERT INTO account ('email') VALUES ('foo@bar.com')")
+	insert, err := db.Prepare(`INSERT INTO item (id, name) VALUES ($1, $2)`)
 	if err != nil {
-		t.Fatalf("Cannot insert into table account: %s", err)
+		t.Fatalf("cannot prepare insert: %s", err)
 	}
-
-	_, err = db.Exec("INSERT INTO account ('email') VALUES ('leon@bar.com')")
-	if err != nil {
-		t.Fatalf("Cannot insert into table account: %s", err)
+	defer insert.Close()
+	for i := 1; i <= 100; i++ {
+		if _, err = insert.Exec(i, fmt.Sprintf("item %d", i)); err != nil {
+			t.Fatalf("cannot execute prepared insert %d: %s", i, err)
+		}
+	}
+	if _, err = insert.Exec(1, "duplicate"); err == nil {
+		t.Fatalf("expected unique violation executing prepared insert")
 	}
 
-	_, err = db.Exec("UPDATE account SET email = 'roger@gmail.com' WHERE id = 2")
+	sel, err := db.Prepare(`SELECT * FROM item WHERE id = $1`)
 	if err != nil {
-		t.Fatalf("Cannot update table account: %s", err)
+		t.Fatalf("cannot prepare select: %s", err)
 	}
-
-	row := db.QueryRow("SELECT * FROM account WHERE id = 2")
-	if row == nil {
-		t.Fatalf("sql.Query failed")
+	defer sel.Close()
+	columns := func(id int) []string {
+		rows, err := sel.Query(id)
+		if err != nil {
+			t.Fatalf("cannot execute prepared select: %s", err)
+		}
+		defer rows.Close()
+		cols, err := rows.Columns()
+		if err != nil {
+			t.Fatalf("cannot get columns: %s", err)
+		}
+		if !rows.Next() {
+			t.Fatalf("expected row %d", id)
+		}
+		return cols
+	}
+	if cols := columns(42); len(cols) != 2 {
+		t.Fatalf("expected 2 columns, got %v", cols)
 	}
 
-	var email string
-	var id int
-	err = row.Scan(&id, &email)
-	if err != nil {
-		t.Fatalf("row.Scan: %s", err)
+	// relations are looked up on each execution
+	if _, err = db.Exec(`ALTER TABLE item ADD COLUMN price INT DEFAULT 0`); err != nil {
+		t.Fatalf("cannot alter table: %s", err)
+	}
+	if cols := columns(42); len(cols) != 3 || cols[2] != "price" {
+		t.Fatalf("expected price column after schema change, got %v", cols)
+	}
+	if _, err = db.Exec(`DROP TABLE item`); err != nil {
+		t.Fatalf("cannot drop table: %s", err)
+	}
+	var e *Error
+	if _, err = insert.Exec(101, "dropped"); !errors.As(err, &e) || e.Code != UndefinedTable {
+		t.Fatalf("expected undefined table error, got %v", err)
+	}
+	if _, err = db.Exec(`CREATE TABLE item (id INT PRIMARY KEY, name TEXT, price INT)`); err != nil {
+		t.Fatalf("cannot create table: %s", err)
+	}
+	if _, err = insert.Exec(1, "again"); err != nil {
+		t.Fatalf("cannot execute prepared insert on new table: %s", err)
 	}
 
-	if email != "roger@gmail.com" {
-		t.Fatalf("Expected email 'roger@gmail.com', got '%s'", email)
+	// queries are parsed when prepared
+	_, err = db.Prepare(`SELEC * FROM item`)
+	if !errors.As(err, &e) || e.Code != SyntaxError {
+		t.Fatalf("expected syntax error preparing statement, got %v", err)
 	}
 }
 
-func TestUpdateIsNull(t *testing.T) {
-
-	db, err := sql.Open("ramsql", "TestUpdateIsNull")
+func TestExecBatch(t *testing.T) {
+	db, err := sql.Open("ramsql", "TestExecBatch")
 	if err != nil {
 		t.Fatalf("sql.Open : Error : %s\n", err)
 	}
 	defer db.Close()
 
-	_, err = db.Exec("CREATE TABLE account (id INT AUTOINCREMENT, email TEXT, creation_date TIMESTAMP WITH TIME ZONE DEFAULT NULL)")
-	if err != nil {
+	if _, err = db.Exec(`CREATE TABLE item (id INT PRIMARY KEY, name TEXT)`); err != nil {
 		t.Fatalf("sql.Exec: Error: %s\n", err)
 	}
 
-	_, err = db.Exec("INSERT INTO account ('email') VALUES ('foo@bar.com')")
+	ctx := context.Background()
+	conn, err := db.Conn(ctx)
 	if err != nil {
-		t.Fatalf("Cannot insert into table account: %s", err)
+		t.Fatalf("cannot get connection: %s", err)
 	}
+	defer conn.Close()
 
-	_, err = db.Exec("INSERT INTO account ('email') VALUES ('leon@bar.com')")
+	count := func() int64 {
+		var n int64
+		if err := db.QueryRow(`SELECT COUNT(*) FROM item`).Scan(&n); err != nil {
+			t.Fatalf("cannot count rows: %s", err)
+		}
+		return n
+	}
+
+	query := `INSERT INTO item (id, name) VALUES ($1, $2)`
+	batch := make([][]any, 1000)
+	for i := range batch {
+		batch[i] = []any{i + 1, fmt.Sprintf("item %d", i+1)}
+	}
+	n, err := ExecBatch(ctx, conn, query, batch)
 	if err != nil {
-		t.Fatalf("Cannot insert into table account: %s", err)
+		t.Fatalf("cannot execute batch: %s", err)
+	}
+	if n != 1000 || count() != 1000 {
+		t.Fatalf("expected 1000 rows inserted, got %d and %d", n, count())
 	}
 
-	res, err := db.Exec("UPDATE account SET email = 'roger@gmail.com', creation_date = $1 WHERE id = 2 AND creation_date IS NULL", time.Now())
+	// a failing execution reverts the whole batch
+	var e *Error
+	_, err = ExecBatch(ctx, conn, query, [][]any{{1001, "a"}, {1002, "b"}, {1, "duplicate"}})
+	if !errors.As(err, &e) || e.Code != UniqueViolation || !strings.HasPrefix(err.Error(), "batch[2]: ") {
+		t.Fatalf("expected unique violation of batch[2], got %v", err)
+	}
+	if count() != 1000 {
+		t.Fatalf("expected failing batch to be reverted, got %d rows", count())
+	}
+	_, err = ExecBatch(ctx, conn, query, [][]any{{1001, "a"}, {1002}})
+	if err == nil || count() != 1000 {
+		t.Fatalf("expected error with missing argument and no row inserted, got %v", err)
+	}
+	_, err = ExecBatch(ctx, conn, `INSERT INTO item (id, name) VALUES ($1, $2`, nil)
+	if !errors.As(err, &e) || e.Code != SyntaxError {
+		t.Fatalf("expected syntax error, got %v", err)
+	}
+	n, err = ExecBatch(ctx, conn, `UPDATE item SET name = :name WHERE id <= :id`, [][]any{
+		{sql.Named("name", "first"), sql.Named("id", 10)},
+		{sql.Named("name", "second"), sql.Named("id", 5)},
+	})
+	if err != nil || n != 15 {
+		t.Fatalf("expected 15 rows updated with named arguments, got %d (%v)", n, err)
+	}
+
+	// batch runs in transaction of connection
+	tx, err := conn.BeginTx(ctx, nil)
 	if err != nil {
-		t.Fatalf("Cannot update table account: %s", err)
+		t.Fatalf("cannot begin: %s", err)
+	}
+	if _, err = ExecBatch(ctx, conn, query, [][]any{{1001, "a"}, {1002, "b"}}); err != nil {
+		t.Fatalf("cannot execute batch in transaction: %s", err)
+	}
+	if err = tx.Rollback(); err != nil {
+		t.Fatalf("cannot rollback: %s", err)
+	}
+	if count() != 1000 {
+		t.Fatalf("expected batch to be rolled back with transaction, got %d rows", count())
 	}
 
-	ra, err := res.RowsAffected()
+	// with statement level rollback, transaction stays usable
+	if _, err = conn.ExecContext(ctx, `SET on_error_rollback = on`); err != nil {
+		t.Fatalf("cannot set on_error_rollback: %s", err)
+	}
+	tx, err = conn.BeginTx(ctx, nil)
 	if err != nil {
-		t.Fatalf("Cannot check number of rows affected: %s", err)
+		t.Fatalf("cannot begin: %s", err)
 	}
-	if ra != 1 {
-		t.Fatalf("Expected 1 row, affected. Got %d", ra)
+	if _, err = ExecBatch(ctx, conn, query, [][]any{{1001, "a"}, {1, "duplicate"}}); err == nil {
+		t.Fatalf("expected unique violation")
+	}
+	if _, err = ExecBatch(ctx, conn, query, [][]any{{1003, "c"}}); err != nil {
+		t.Fatalf("cannot execute batch after failing one: %s", err)
 	}
+	if err = tx.Commit(); err != nil {
+		t.Fatalf("cannot commit: %s", err)
+	}
+	var id int64
+	if err = db.QueryRow(`SELECT MAX(id) FROM item`).Scan(&id); err != nil || id != 1003 || count() != 1001 {
+		t.Fatalf("expected only row 1003 inserted, got %d and %d rows (%v)", id, count(), err)
+	}
+}
 
-	rows, err := db.Query(`SELECT id FROM account WHERE creation_date IS NULL`)
+func TestSetClock(t *testing.T) {
+	db, err := sql.Open("ramsql", "TestSetClock")
 	if err != nil {
-		t.Fatalf("cannot select null columns: %s", err)
+		t.Fatalf("sql.Open : Error : %s\n", err)
+	}
+	defer db.Close()
+	if err = db.Ping(); err != nil {
+		t.Fatalf("cannot ping: %s", err)
+	}
+
+	if err = SetClock("TestSetClockUnknown", time.Now); err == nil {
+		t.Fatalf("expected error setting clock of unknown database")
+	}
+
+	now := time.Date(2024, 2, 29, 13, 45, 30, 0, time.UTC)
+	if err = SetClock("TestSetClock", func() time.Time { return now }); err != nil {
+		t.Fatalf("cannot set clock: %s", err)
 	}
 
-	var n, id int64
-	for rows.Next() {
-		n++
-		err = rows.Scan(&id)
-		if err != nil {
-			t.Fatalf("cannot scan null columns: %s", err)
+	batch := []string{
+		`CREATE TABLE event (id INT PRIMARY KEY, created_at TIMESTAMP DEFAULT NOW(), day DATE DEFAULT CURRENT_DATE)`,
+		`INSERT INTO event (id) VALUES (1)`,
+	}
+	for _, b := range batch {
+		if _, err = db.Exec(b); err != nil {
+			t.Fatalf("sql.Exec: Error: %s\n", err)
 		}
 	}
-	rows.Close()
-	if n != 1 {
-		t.Fatalf("Expected 1 rows, got %d", n)
+
+	var createdAt, day time.Time
+	if err = db.QueryRow(`SELECT created_at, day FROM event WHERE id = 1`).Scan(&createdAt, &day); err != nil {
+		t.Fatalf("cannot select defaults: %s", err)
+	}
+	if !createdAt.Equal(now) || !day.Equal(time.Date(2024, 2, 29, 0, 0, 0, 0, time.UTC)) {
+		t.Fatalf("expected default timestamps of clock, got %s and %s", createdAt, day)
 	}
 
-	rows, err = db.Query(`SELECT id FROM account WHERE creation_date IS NOT NULL`)
-	if err != nil {
-		t.Fatalf("cannot select not null columns: %s", err)
+	var n, ts, d time.Time
+	if err = db.QueryRow(`SELECT NOW(), CURRENT_TIMESTAMP, CURRENT_DATE`).Scan(&n, &ts, &d); err != nil {
+		t.Fatalf("cannot select current time: %s", err)
+	}
+	if !n.Equal(now) || !ts.Equal(now) || !d.Equal(day) {
+		t.Fatalf("expected current time of clock, got %s, %s and %s", n, ts, d)
 	}
 
-	n = 0
-	for rows.Next() {
-		n++
-		err = rows.Scan(&id)
-		if err != nil {
-			t.Fatalf("cannot scan null columns: %s", err)
-		}
+	// clock is read for each statement
+	now = now.Add(time.Hour)
+	if _, err = db.Exec(`INSERT INTO event (id) VALUES (2)`); err != nil {
+		t.Fatalf("cannot insert: %s", err)
 	}
-	rows.Close()
-	if n != 1 {
-		t.Fatalf("Expected 1 rows, got %d", n)
+	var count int64
+	if err = db.QueryRow(`SELECT COUNT(*) FROM event WHERE created_at < NOW()`).Scan(&count); err != nil || count != 1 {
+		t.Fatalf("expected 1 event before clock time, got %d (%v)", count, err)
+	}
+	if _, err = db.Exec(`ALTER TABLE event ADD COLUMN seen_at TIMESTAMP DEFAULT NOW()`); err != nil {
+		t.Fatalf("cannot add column: %s", err)
+	}
+	if err = db.QueryRow(`SELECT COUNT(*) FROM event WHERE seen_at = $1`, now).Scan(&count); err != nil || count != 2 {
+		t.Fatalf("expected added column to default to clock time, got %d (%v)", count, err)
 	}
 
+	// real clock is restored
+	if err = SetClock("TestSetClock", nil); err != nil {
+		t.Fatalf("cannot restore clock: %s", err)
+	}
+	if err = db.QueryRow(`SELECT NOW()`).Scan(&n); err != nil || time.Since(n) > time.Minute {
+		t.Fatalf("expected real current time, got %s (%v)", n, err)
+	}
 }
 
-func TestUpdateNotNull(t *testing.T) {
-
-	db, err := sql.Open("ramsql", "TestUpdateNotNull")
+func TestStableOrder(t *testing.T) {
+	db, err := sql.Open("ramsql", "TestStableOrder")
 	if err != nil {
 		t.Fatalf("sql.Open : Error : %s\n", err)
 	}
 	defer db.Close()
 
-	_, err = db.Exec("CREATE TABLE account (id INT AUTOINCREMENT, email TEXT, creation_date TIMESTAMP WITH TIME ZONE DEFAULT NOW())")
+	conn, err := db.Conn(context.Background())
 	if err != nil {
-		t.Fatalf("sql.Exec: Error: %s\n", err)
+		t.Fatalf("cannot get connection: %s", err)
 	}
+	defer conn.Close()
 
-	_, err = db.Exec("INSERT INTO account ('email') VALUES ('foo@bar.com')")
-	if err != nil {
-		t.Fatalf("Cannot insert into table account: %s", err)
+	batch := []string{
+		`CREATE TABLE item (id INT PRIMARY KEY, score INT)`,
+		`CREATE INDEX item_score_idx ON item USING btree (score)`,
+		`CREATE TABLE tag (item_id INT, name TEXT)`,
+		`CREATE INDEX tag_item_id_idx ON tag (item_id)`,
+		`INSERT INTO item (id, score) VALUES (4, 30), (2, 10), (3, 20), (1, 10)`,
+		`INSERT INTO tag (item_id, name) VALUES (3, 'c'), (1, 'a'), (4, 'd'), (2, 'b')`,
+		`UPDATE item SET score = 20 WHERE id = 2`,
+		`UPDATE item SET score = 10 WHERE id = 2`,
+		`SET stable_order = on`,
 	}
-
-	_, err = db.Exec("INSERT INTO account ('email') VALUES ('leon@bar.com')")
-	if err != nil {
-		t.Fatalf("Cannot insert into table account: %s", err)
+	for _, b := range batch {
+		if _, err = conn.ExecContext(context.Background(), b); err != nil {
+			t.Fatalf("sql.Exec: Error: %s\n", err)
+		}
 	}
 
-	_, err = db.Exec("UPDATE account SET email = 'roger@gmail.com' WHERE id = 2 AND creation_date IS NOT NULL")
-	if err != nil {
-		t.Fatalf("Cannot update table account: %s", err)
+	var on string
+	if err = conn.QueryRowContext(context.Background(), `SHOW stable_order`).Scan(&on); err != nil || on != "on" {
+		t.Fatalf("expected stable_order to be on, got '%s' (%v)", on, err)
 	}
 
-}
+	ids := func(query string) string {
+		rows, err := conn.QueryContext(context.Background(), query)
+		if err != nil {
+			t.Fatalf("cannot query '%s': %s", query, err)
+		}
+		defer rows.Close()
 
-func TestUpdateToNull(t *testing.T) {
+		var res []string
+		for rows.Next() {
+			var id string
+			if err := rows.Scan(&id); err != nil {
+				t.Fatalf("cannot scan: %s", err)
+			}
+			res = append(res, id)
+		}
+		return strings.Join(res, ",")
+	}
+
+	queries := []struct {
+		query    string
+		expected string
+	}{
+		{`SELECT id FROM item`, "4,2,3,1"},
+		{`SELECT id FROM item WHERE score >= 10 AND score < 30`, "2,3,1"},
+		{`SELECT id FROM item WHERE id IN (1, 2, 3)`, "2,3,1"},
+		{`SELECT id FROM item ORDER BY score`, "2,1,3,4"},
+		{`SELECT id FROM item ORDER BY score DESC`, "4,3,2,1"},
+		{`SELECT tag.name FROM item JOIN tag ON tag.item_id = item.id`, "d,b,c,a"},
+		{`SELECT item.id FROM tag JOIN item ON item.id = tag.item_id`, "3,1,4,2"},
+		{`SELECT id FROM item WHERE score = 10 UNION SELECT id FROM item WHERE score = 30 ORDER BY id`, "1,2,4"},
+	}
+	for _, q := range queries {
+		for i := 0; i < 3; i++ {
+			if res := ids(q.query); res != q.expected {
+				t.Fatalf("expected '%s' to return %s, got %s", q.query, q.expected, res)
+			}
+		}
+		if _, err = conn.ExecContext(context.Background(), `ANALYZE`); err != nil {
+			t.Fatalf("cannot analyze: %s", err)
+		}
+	}
+}
 
-	db, err := sql.Open("ramsql", "TestUpdateToNull")
+func TestMaxRows(t *testing.T) {
+	db, err := sql.Open("ramsql", "TestMaxRows?max_rows=3")
 	if err != nil {
 		t.Fatalf("sql.Open : Error : %s\n", err)
 	}
 	defer db.Close()
 
-	_, err = db.Exec("CREATE TABLE account (id INT AUTOINCREMENT, email TEXT, creation_date TIMESTAMP WITH TIME ZONE DEFAULT NOW())")
-	if err != nil {
-		t.Fatalf("sql.Exec: Error: %s\n", err)
+	batch := []string{
+		`CREATE TABLE account (id INT PRIMARY KEY, email TEXT)`,
+		`CREATE TABLE session (id INT PRIMARY KEY)`,
+		`INSERT INTO account (id, email) VALUES (1, 'a@x.com'), (2, 'b@x.com')`,
+		`INSERT INTO account (id, email) VALUES (3, 'c@x.com')`,
+		`INSERT INTO session (id) VALUES (1), (2), (3)`,
 	}
-
-	_, err = db.Exec("INSERT INTO account ('email') VALUES ('foo@bar.com')")
-	if err != nil {
-		t.Fatalf("Cannot insert into table account: %s", err)
+	for _, b := range batch {
+		if _, err = db.Exec(b); err != nil {
+			t.Fatalf("sql.Exec: Error: %s\n", err)
+		}
 	}
 
-	row1 := db.QueryRow("SELECT email FROM account WHERE id = 1")
-	if row1 == nil {
-		t.Fatalf("sql.Query failed")
+	var e *Error
+	_, err = db.Exec(`INSERT INTO account (id, email) VALUES (4, 'd@x.com')`)
+	if !errors.As(err, &e) || e.Code != ProgramLimitExceeded || e.Table != "account" {
+		t.Fatalf("expected code %s on account, got %v", ProgramLimitExceeded, err)
 	}
 
-	var email1 *string
-	err = row1.Scan(&email1)
-	if err != nil {
-		t.Fatalf("row.Scan: %s", err)
+	// insert of several rows is reverted as a whole
+	if _, err = db.Exec(`DELETE FROM account WHERE id = 3`); err != nil {
+		t.Fatalf("cannot delete: %s", err)
 	}
-	if email1 == nil {
-		t.Fatalf("expected 'foo@bar.com' email, but got NULL")
+	_, err = db.Exec(`INSERT INTO account (id, email) VALUES (3, 'c@x.com'), (4, 'd@x.com')`)
+	if !errors.As(err, &e) || e.Code != ProgramLimitExceeded {
+		t.Fatalf("expected code %s, got %v", ProgramLimitExceeded, err)
+	}
+	var count int64
+	if err = db.QueryRow(`SELECT COUNT(*) FROM account`).Scan(&count); err != nil || count != 2 {
+		t.Fatalf("expected 2 accounts, got %d (%v)", count, err)
 	}
 
-	_, err = db.Exec("UPDATE account SET email = NULL WHERE id = 1")
+	// failed insert aborts transaction
+	tx, err := db.Begin()
 	if err != nil {
-		t.Fatalf("Cannot update table account: %s", err)
+		t.Fatalf("cannot begin: %s", err)
 	}
-
-	row2 := db.QueryRow("SELECT email FROM account WHERE id = 1")
-	if row2 == nil {
-		t.Fatalf("sql.Query failed")
+	if _, err = tx.Exec(`INSERT INTO account (id, email) VALUES (3, 'c@x.com')`); err != nil {
+		t.Fatalf("cannot insert: %s", err)
+	}
+	_, err = tx.Exec(`INSERT INTO account (id, email) VALUES (4, 'd@x.com')`)
+	if !errors.As(err, &e) || e.Code != ProgramLimitExceeded {
+		t.Fatalf("expected code %s, got %v", ProgramLimitExceeded, err)
+	}
+	_, err = tx.Exec(`INSERT INTO session (id) VALUES (4)`)
+	if !errors.As(err, &e) || e.Code != InFailedTransaction {
+		t.Fatalf("expected code %s, got %v", InFailedTransaction, err)
+	}
+	if err = tx.Rollback(); err != nil {
+		t.Fatalf("cannot rollback: %s", err)
+	}
+	if err = db.QueryRow(`SELECT COUNT(*) FROM account`).Scan(&count); err != nil || count != 2 {
+		t.Fatalf("expected 2 accounts after rollback, got %d (%v)", count, err)
 	}
 
-	var email2 sql.NullString
-	err = row2.Scan(&email2)
-	if err != nil {
-		t.Fatalf("row.Scan: %s", err)
+	if err = SetMaxRows("TestMaxRows?max_rows=3", 0); err != nil {
+		t.Fatalf("cannot remove limit: %s", err)
 	}
-	if email2.Valid == true {
-		t.Fatalf("expected NULL email, but got '%v'", email2.String)
+	if _, err = db.Exec(`INSERT INTO session (id) VALUES (4), (5)`); err != nil {
+		t.Fatalf("expected insert without limit to succeed: %s", err)
+	}
+	if err = SetMaxRows("TestMaxRowsUnknown", 1); err == nil {
+		t.Fatalf("expected error setting limit of unknown database")
 	}
 
+	for _, dsn := range []string{"TestMaxRows?max_rows=many", "TestMaxRows?max_rows=-1"} {
+		if _, err := parseConnectionURI(dsn); err == nil {
+			t.Fatalf("expected error parsing %s", dsn)
+		}
+	}
 }
 
-func TestDeadlock(t *testing.T) {
-	db, err := sql.Open("ramsql", "TestDeadlock")
+func TestStatementTimeout(t *testing.T) {
+	db, err := sql.Open("ramsql", "TestStatementTimeout")
 	if err != nil {
-		t.Fatalf("cannot open db: %s", err)
+		t.Fatalf("sql.Open : Error : %s\n", err)
 	}
 	defer db.Close()
-	if err := db.Ping(); err != nil {
-		t.Fatalf("cannot ping db: %s", err)
-	}
-	if _, err := db.Exec("CREATE TABLE address (id int, street text)"); err != nil {
-		t.Fatalf("cannot create table: %s", err)
-	}
 
-	stmt, err := db.Prepare("insert into address (id,street) values (?,?)")
+	ctx := context.Background()
+	conn, err := db.Conn(ctx)
 	if err != nil {
-		t.Fatalf("cannot prepare statement: %s", err)
+		t.Fatalf("cannot get connection: %s", err)
 	}
+	defer conn.Close()
 
-	for i := 0; i < 10; i++ {
-		if _, err := stmt.Exec(i, fmt.Sprintf("%d park ave", 100+i)); err != nil { // ERROR
-			t.Fatalf("cannot exec %dnt statement: %s", i, err)
+	batch := []string{
+		`CREATE TABLE item (id INT PRIMARY KEY, kind INT)`,
+		`INSERT INTO item (id, kind) SELECT generate_series, 1 FROM generate_series(1, 5000)`,
+		`SET statement_timeout = '20ms'`,
+	}
+	for _, b := range batch {
+		if _, err = conn.ExecContext(ctx, b); err != nil {
+			t.Fatalf("sql.Exec: Error: %s\n", err)
 		}
 	}
-}
-
-func TestNamedArg(t *testing.T) {
 
-	db, err := sql.Open("ramsql", "TestNamedArg2")
-	if err != nil {
-		t.Fatalf("cannot open db: %s", err)
+	// joins every row with every other row
+	var count int64
+	start := time.Now()
+	err = conn.QueryRowContext(ctx, `SELECT COUNT(*) FROM item a JOIN item b ON a.kind = b.kind`).Scan(&count)
+	var e *Error
+	if !errors.As(err, &e) || e.Code != QueryCanceled {
+		t.Fatalf("expected code %s, got %v", QueryCanceled, err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Fatalf("expected statement to be canceled after timeout, took %s", elapsed)
 	}
-	defer db.Close()
 
-	var name string
+	// fast statements are not affected, and locks were released
+	if err = conn.QueryRowContext(ctx, `SELECT COUNT(*) FROM item WHERE id < 10`).Scan(&count); err != nil || count != 9 {
+		t.Fatalf("expected 9 items, got %d (%v)", count, err)
+	}
+	if _, err = db.Exec(`UPDATE item SET kind = 2 WHERE id = 1`); err != nil {
+		t.Fatalf("cannot update from other connection: %s", err)
+	}
 
-	_, err = db.Exec(`CREATE TABLE people (id BIGSERIAL PRIMARY KEY, name TEXT, surname TEXT, age INT)`)
+	// timeout applies to each statement of a transaction, which is aborted
+	tx, err := conn.BeginTx(ctx, nil)
 	if err != nil {
-		t.Fatalf("cannot create table: %s", err)
+		t.Fatalf("cannot begin: %s", err)
+	}
+	if _, err = tx.Exec(`UPDATE item SET kind = 3 WHERE id = 2`); err != nil {
+		t.Fatalf("cannot update: %s", err)
+	}
+	_, err = tx.Exec(`UPDATE item SET kind = 3 WHERE id IN (SELECT a.id FROM item a JOIN item b ON a.kind = b.kind)`)
+	if !errors.As(err, &e) || e.Code != QueryCanceled {
+		t.Fatalf("expected code %s, got %v", QueryCanceled, err)
+	}
+	if _, err = tx.Exec(`UPDATE item SET kind = 3 WHERE id = 3`); !errors.As(err, &e) || e.Code != InFailedTransaction {
+		t.Fatalf("expected code %s, got %v", InFailedTransaction, err)
+	}
+	if err = tx.Rollback(); err != nil {
+		t.Fatalf("cannot rollback: %s", err)
+	}
+	if err = conn.QueryRowContext(ctx, `SELECT COUNT(*) FROM item WHERE kind = 3`).Scan(&count); err != nil || count != 0 {
+		t.Fatalf("expected no item of kind 3 after rollback, got %d (%v)", count, err)
 	}
 
-	_, err = db.ExecContext(context.TODO(), "INSERT INTO people (id,name,surname,age) VALUES (?,?,?,?)", 1234, "Ramone", "Juz", 12)
+	// a wait for a lock is canceled too
+	other, err := db.Conn(ctx)
 	if err != nil {
-		t.Fatalf("cannot exec context: %s", err)
+		t.Fatalf("cannot get connection: %s", err)
 	}
-
-	err = db.QueryRowContext(context.TODO(), "select p.name from people as p where p.id = :id;", sql.Named("id", 1234)).Scan(&name)
+	defer other.Close()
+	otx, err := other.BeginTx(ctx, nil)
 	if err != nil {
-		t.Fatalf("cannot query context: %s", err)
+		t.Fatalf("cannot begin: %s", err)
+	}
+	if _, err = otx.Exec(`UPDATE item SET kind = 4 WHERE id = 4`); err != nil {
+		t.Fatalf("cannot update: %s", err)
+	}
+	_, err = conn.ExecContext(ctx, `UPDATE item SET kind = 5 WHERE id = 5`)
+	if !errors.As(err, &e) || e.Code != QueryCanceled {
+		t.Fatalf("expected code %s waiting for lock, got %v", QueryCanceled, err)
+	}
+	if err = otx.Rollback(); err != nil {
+		t.Fatalf("cannot rollback: %s", err)
 	}
 
+	if _, err = conn.ExecContext(ctx, `SET statement_timeout = 0`); err != nil {
+		t.Fatalf("cannot reset timeout: %s", err)
+	}
+	if _, err = conn.ExecContext(ctx, `SET statement_timeout = 'forever'`); err == nil {
+		t.Fatalf("expected error setting invalid timeout")
+	}
 }
 
-func TestScanTimestamp(t *testing.T) {
-	db, err := sql.Open("ramsql", "TestScanTimestamp")
+func TestAmbiguousColumn(t *testing.T) {
+	db, err := sql.Open("ramsql", "TestAmbiguousColumn")
 	if err != nil {
-		t.Fatalf("cannot open db: %s", err)
+		t.Fatalf("sql.Open : Error : %s\n", err)
 	}
 	defer db.Close()
 
-	query := `
-	  CREATE TABLE IF NOT EXISTS properties (
-			id         VARCHAR(36)  PRIMARY KEY,
-			street     VARCHAR(255),
-			city       VARCHAR(32),
-			state      VARCHAR(32),
-			zip        VARCHAR(10),
-			created_at TIMESTAMPTZ
-		)
-	`
-	_, err = db.Exec(query)
-	if err != nil {
-		t.Fatalf("cannot create table: %s", err)
+	batch := []string{
+		`CREATE TABLE account (id INT PRIMARY KEY, name TEXT)`,
+		`CREATE TABLE project (id INT PRIMARY KEY, account_id INT, name TEXT, status TEXT)`,
+		`INSERT INTO account (id, name) VALUES (1, 'alice'), (2, 'bob')`,
+		`INSERT INTO project (id, account_id, name, status) VALUES (10, 1, 'ramsql', 'open'), (20, 2, 'gorm', 'closed')`,
 	}
-
-	id := "OIJOIJ"
-	query = `INSERT INTO properties (id, street, city, state, zip, created_at) VALUES ($1, $2, $3, $4, $5, NOW())`
-	_, err = db.Exec(query, id, "5th", "NY", "NY", "NY")
-	if err != nil {
-		t.Fatalf("cannot insert into table: %s", err)
+	for _, b := range batch {
+		if _, err = db.Exec(b); err != nil {
+			t.Fatalf("sql.Exec: Error: %s\n", err)
+		}
 	}
 
-	p := struct {
-		ID        string
-		Street    string
-		City      string
-		StateCode string
-		Zip       string
-		CreatedAt time.Time
-	}{}
-
-	query = `
-		SELECT id, street, city, state, zip, created_at
-		FROM properties WHERE id = $1
-	`
-
-	ctx := context.Background()
-	err = db.QueryRowContext(ctx, query, id).Scan(
-		&p.ID, &p.Street, &p.City,
-		&p.StateCode, &p.Zip, &p.CreatedAt,
-	)
-	if err != nil {
-		t.Fatalf("cannot scan in struct: %s", err)
+	ambiguous := []string{
+		`SELECT id FROM account JOIN project ON project.account_id = account.id`,
+		`SELECT account.id FROM account JOIN project ON project.account_id = account.id WHERE id = 1`,
+		`SELECT a.id FROM account AS a JOIN project AS p ON p.account_id = a.id WHERE name = 'alice'`,
+		`SELECT COUNT(id) FROM account JOIN project ON project.account_id = account.id`,
+		`SELECT id + 1 FROM account JOIN project ON project.account_id = account.id`,
+		`SELECT account.id FROM account JOIN project ON project.account_id = account.id ORDER BY name`,
+		`SELECT account.id, project.id FROM account JOIN project ON project.account_id = account.id ORDER BY id`,
+	}
+	for _, q := range ambiguous {
+		var e *Error
+		_, err := db.Query(q)
+		if !errors.As(err, &e) || e.Code != AmbiguousColumn {
+			t.Fatalf("expected code %s for '%s', got %v", AmbiguousColumn, q, err)
+		}
 	}
-	if p.CreatedAt.IsZero() {
-		t.Fatalf("CreatedAt should not be 0")
+
+	var e *Error
+	_, err = db.Query(`SELECT status FROM account JOIN project ON project.account_id = account.id WHERE id = 1`)
+	if !errors.As(err, &e) || e.Column != "id" || e.Position != 82 {
+		t.Fatalf("expected ambiguous column id at position 82, got %v", err)
+	}
+
+	queries := []struct {
+		query    string
+		expected string
+	}{
+		{`SELECT account.id FROM account JOIN project ON project.account_id = account.id WHERE status = 'open'`, "1"},
+		{`SELECT project.id FROM account JOIN project ON project.account_id = account.id WHERE account.name = 'bob'`, "20"},
+		{`SELECT p.id FROM account AS a JOIN project AS p ON p.account_id = a.id WHERE a.id = 1`, "10"},
+		{`SELECT status FROM account JOIN project ON project.account_id = account.id ORDER BY status`, "closed,open"},
+		{`SELECT project.id FROM account JOIN project ON project.account_id = account.id ORDER BY id DESC`, "20,10"},
+		{`SELECT account.name AS owner FROM account JOIN project ON project.account_id = account.id ORDER BY owner`, "alice,bob"},
+		{`SELECT id FROM account WHERE id IN (SELECT account_id FROM project WHERE name = 'gorm')`, "2"},
+		{`SELECT id FROM account JOIN project USING (id, name)`, ""},
+		{`SELECT name FROM account NATURAL JOIN account AS other ORDER BY name`, "alice,bob"},
+	}
+	for _, q := range queries {
+		rows, err := db.Query(q.query)
+		if err != nil {
+			t.Fatalf("cannot query '%s': %s", q.query, err)
+		}
+		var res []string
+		for rows.Next() {
+			var v string
+			if err := rows.Scan(&v); err != nil {
+				t.Fatalf("cannot scan: %s", err)
+			}
+			res = append(res, v)
+		}
+		rows.Close()
+		if got := strings.Join(res, ","); got != q.expected {
+			t.Fatalf("expected '%s' to return %s, got %s", q.query, q.expected, got)
+		}
 	}
 }
 
-func TestPrimaryKeyConstraint(t *testing.T) {
-
-	db, err := sql.Open("ramsql", "TestPrimaryKeyConstraint")
+func TestGroupingError(t *testing.T) {
+	db, err := sql.Open("ramsql", "TestGroupingError")
 	if err != nil {
-		t.Fatalf("sql.Open: %s", err)
+		t.Fatalf("sql.Open : Error : %s\n", err)
 	}
 	defer db.Close()
 
-	_, err = db.Exec(`CREATE TABLE test (a INT, b TEXT, PRIMARY KEY(a, b))`)
-	if err != nil {
-		t.Fatalf("Create table: %s", err)
-	}
-	_, err = db.Exec(`INSERT INTO test (a,b) VALUES (1, "1")`)
-	if err != nil {
-		t.Fatalf("Insert : %s", err)
+	batch := []string{
+		`CREATE TABLE champion (id INT PRIMARY KEY, user_id INT, name TEXT)`,
+		`INSERT INTO champion (id, user_id, name) VALUES (1, 1, 'ahri'), (2, 1, 'zed'), (3, 2, 'lux')`,
 	}
-	_, err = db.Exec(`INSERT INTO test (a,b) VALUES (2, "2")`)
-	if err != nil {
-		t.Fatalf("Insert : %s", err)
+	for _, b := range batch {
+		if _, err = db.Exec(b); err != nil {
+			t.Fatalf("sql.Exec: Error: %s\n", err)
+		}
 	}
-	_, err = db.Exec(`INSERT INTO test (a,b) VALUES (2, "1")`)
-	if err != nil {
-		t.Fatalf("Insert : %s", err)
+
+	var e *Error
+	_, err = db.Query(`SELECT name, COUNT(*) FROM champion`)
+	if !errors.As(err, &e) || e.Code != GroupingError || e.Column != "name" || e.Position != 8 {
+		t.Fatalf("expected code %s on column name at position 8, got %v", GroupingError, err)
 	}
-	_, err = db.Exec(`INSERT INTO test (a,b) VALUES (2, "1")`)
-	if err == nil {
-		t.Fatalf("expected error on primary key violation")
+	if !strings.Contains(err.Error(), `column "name" must appear in the GROUP BY clause`) {
+		t.Fatalf("expected error to name the column, got %s", err)
 	}
-}
-
-func TestLimitEmptyTable(t *testing.T) {
 
-	db, err := sql.Open("ramsql", "TestLimitEmptyTable")
-	if err != nil {
-		t.Fatalf("cannot open db: %s", err)
+	_, err = db.Query(`SELECT COUNT(*), MAX(id), champion.user_id FROM champion WHERE id > 1`)
+	if !errors.As(err, &e) || e.Code != GroupingError || e.Column != "user_id" {
+		t.Fatalf("expected code %s on column user_id, got %v", GroupingError, err)
 	}
 
-	q := `CREATE TABLE event_db_entries (test_id BIGINT, result TEXT)`
-	_, err = db.Exec(q)
-	if err != nil {
-		t.Fatalf("cannot create table: %s", err)
+	// GROUP BY is not supported yet
+	_, err = db.Query(`SELECT user_id, COUNT(*) FROM champion GROUP BY user_id`)
+	if !errors.As(err, &e) || e.Code != SyntaxError {
+		t.Fatalf("expected code %s, got %v", SyntaxError, err)
 	}
 
-	q = `SELECT * FROM "event_db_entries" WHERE 1 LIMIT 1`
-	_, err = db.Query(q)
-	if err != nil {
-		t.Fatalf("cannot select: %s", err)
+	var count int64
+	if err = db.QueryRow(`SELECT COUNT(*) FROM champion`).Scan(&count); err != nil || count != 3 {
+		t.Fatalf("expected 3 champions, got %d (%v)", count, err)
 	}
 }
@@ -0,0 +1,41 @@
+package ramsql
+
+import "github.com/proullon/ramsql/engine/agnostic"
+
+// Error is the error returned by the driver when a statement fails, with
+// the SQLSTATE code classifying it:
+//
+//	var e *ramsql.Error
+//	if errors.As(err, &e) && e.Code == ramsql.UniqueViolation {
+//		...
+//	}
+type Error = agnostic.Error
+
+// SQLSTATE codes of errors returned by the driver
+const (
+	NumericValueOutOfRange    = agnostic.NumericValueOutOfRange
+	InvalidRegularExpression  = agnostic.InvalidRegularExpression
+	InvalidParameterValue     = agnostic.InvalidParameterValue
+	InvalidTextRepresentation = agnostic.InvalidTextRepresentation
+	NotNullViolation          = agnostic.NotNullViolation
+	UniqueViolation           = agnostic.UniqueViolation
+	CheckViolation            = agnostic.CheckViolation
+	InFailedTransaction       = agnostic.InFailedTransaction
+	DependentObjectsExist     = agnostic.DependentObjectsExist
+	InvalidSchemaName         = agnostic.InvalidSchemaName
+	SyntaxError               = agnostic.SyntaxError
+	DuplicateColumn           = agnostic.DuplicateColumn
+	AmbiguousColumn           = agnostic.AmbiguousColumn
+	UndefinedColumn           = agnostic.UndefinedColumn
+	GroupingError             = agnostic.GroupingError
+	UndefinedObject           = agnostic.UndefinedObject
+	DatatypeMismatch          = agnostic.DatatypeMismatch
+	DuplicateTable            = agnostic.DuplicateTable
+	DuplicateSchema           = agnostic.DuplicateSchema
+	UndefinedTable            = agnostic.UndefinedTable
+	InvalidColumnReference    = agnostic.InvalidColumnReference
+	CollationMismatch         = agnostic.CollationMismatch
+	ProgramLimitExceeded      = agnostic.ProgramLimitExceeded
+	QueryCanceled             = agnostic.QueryCanceled
+	LockNotAvailable          = agnostic.LockNotAvailable
+)
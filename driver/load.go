@@ -0,0 +1,111 @@
+package ramsql
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// LoadFile executes on db the SQL statements of file at path, like a
+// database dump.
+//
+// Statements are separated by semicolons. Blank lines, line comments
+// starting with -- and block comments between /* and */ are skipped.
+// Statements are executed in order, and the first failing one stops
+// loading with an error reporting its line in file.
+func LoadFile(db *sql.DB, path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	for _, stmt := range splitStatements(string(data)) {
+		_, err = db.Exec(stmt.query)
+		if err != nil {
+			return fmt.Errorf("%s:%d: %s: %w", path, stmt.line, stmt.query, err)
+		}
+	}
+
+	return nil
+}
+
+type statement struct {
+	query string
+	// line of statement first character, starting at 1
+	line int
+}
+
+// splitStatements splits SQL script on semicolons outside of string
+// literals, removing comments and empty statements.
+func splitStatements(script string) []statement {
+	var stmts []statement
+	var sb strings.Builder
+	line, start := 1, 0
+
+	flush := func() {
+		q := strings.TrimSpace(sb.String())
+		if q != "" {
+			stmts = append(stmts, statement{query: q, line: start})
+		}
+		sb.Reset()
+		start = 0
+	}
+
+	for i := 0; i < len(script); i++ {
+		c := script[i]
+
+		switch {
+		case c == '-' && strings.HasPrefix(script[i:], "--"):
+			for i < len(script) && script[i] != '\n' {
+				i++
+			}
+			if i < len(script) {
+				sb.WriteByte('\n')
+				line++
+			}
+			continue
+		case c == '/' && strings.HasPrefix(script[i:], "/*"):
+			end := strings.Index(script[i+2:], "*/")
+			if end == -1 {
+				end = len(script) - i - 2
+			}
+			comment := script[i : i+2+end]
+			line += strings.Count(comment, "\n")
+			sb.WriteByte(' ')
+			i += len(comment) + 1
+			continue
+		case c == ';':
+			flush()
+			continue
+		}
+
+		if start == 0 && c != ' ' && c != '\t' && c != '\n' && c != '\r' {
+			start = line
+		}
+
+		// copy quoted literals and identifiers as is
+		if c == '\'' || c == '"' {
+			j := i + 1
+			for j < len(script) && script[j] != c {
+				j++
+			}
+			if j == len(script) {
+				j--
+			}
+			literal := script[i : j+1]
+			sb.WriteString(literal)
+			line += strings.Count(literal, "\n")
+			i = j
+			continue
+		}
+
+		if c == '\n' {
+			line++
+		}
+		sb.WriteByte(c)
+	}
+	flush()
+
+	return stmts
+}
@@ -0,0 +1,26 @@
+package ramsql
+
+import (
+	"context"
+
+	"github.com/proullon/ramsql/engine/agnostic"
+)
+
+// PlanMetrics are the estimated and actual cardinals of the plan nodes of
+// a query, as shown by EXPLAIN ANALYZE:
+//
+//	var m ramsql.PlanMetrics
+//	rows, err := db.QueryContext(ramsql.WithPlanMetrics(ctx, &m), query)
+//	...
+//	rows.Close()
+//	fmt.Println(m.Estimated(), m.Actual(), m.Indexes())
+type PlanMetrics = agnostic.PlanMetrics
+
+// PlanNode describes a node of an executed query plan
+type PlanNode = agnostic.PlanNode
+
+// WithPlanMetrics returns a copy of ctx in which queries collect the metrics
+// of their plan into m
+func WithPlanMetrics(ctx context.Context, m *PlanMetrics) context.Context {
+	return agnostic.WithPlanMetrics(ctx, m)
+}
@@ -10,6 +10,10 @@ type Result struct {
 // LastInsertId returns the database's auto-generated ID
 // after, for example, an INSERT into a table with primary
 // key.
+//
+// If statement inserted several rows, ID generated for the last one is returned.
+// If no value was generated, because relation has no auto-increment attribute
+// or value was specified, LastInsertId returns 0.
 func (r *Result) LastInsertId() (int64, error) {
 	if r.err != nil {
 		return 0, r.err
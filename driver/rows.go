@@ -4,6 +4,9 @@ import (
 	"database/sql/driver"
 	"fmt"
 	"io"
+	"reflect"
+	"strings"
+	"time"
 
 	"github.com/proullon/ramsql/engine/agnostic"
 )
@@ -11,17 +14,22 @@ import (
 // Rows implements the sql/driver Rows interface
 type Rows struct {
 	columns []string
+	attrs   []*agnostic.Attribute
 	tuples  []*agnostic.Tuple
 	idx     int
 	end     int
+	// location TIMESTAMPTZ values are returned in, as stored if nil
+	loc *time.Location
 }
 
-func newRows(cols []string, tuples []*agnostic.Tuple) *Rows {
+func newRows(cols []string, attrs []*agnostic.Attribute, tuples []*agnostic.Tuple, loc *time.Location) *Rows {
 
 	r := &Rows{
 		tuples:  tuples,
 		columns: cols,
+		attrs:   attrs,
 		end:     len(tuples) - 1,
+		loc:     loc,
 	}
 
 	return r
@@ -63,8 +71,86 @@ func (r *Rows) Next(dest []driver.Value) (err error) {
 	}
 
 	for i, v := range values {
+		// intervals are returned in PostgreSQL text format
+		if iv, ok := v.(agnostic.Interval); ok {
+			dest[i] = iv.String()
+			continue
+		}
+		// arrays are returned in PostgreSQL text format, like {a,b}
+		if av, ok := v.(agnostic.Array); ok {
+			dest[i] = av.String()
+			continue
+		}
+		// TIMESTAMPTZ values are returned in session timezone
+		if tv, ok := v.(time.Time); ok && r.loc != nil {
+			if attr := r.attribute(i); attr != nil && strings.EqualFold(attr.TypeName(), "timestamptz") {
+				dest[i] = tv.In(r.loc)
+				continue
+			}
+		}
 		dest[i] = v
 	}
 
 	return nil
 }
+
+// ColumnTypeDatabaseTypeName returns the database system type name
+// of the column, as declared in CREATE TABLE.
+// Empty string is returned for computed columns.
+//
+// Implemented for RowsColumnTypeDatabaseTypeName interface
+func (r *Rows) ColumnTypeDatabaseTypeName(index int) string {
+	attr := r.attribute(index)
+	if attr == nil {
+		return ""
+	}
+
+	return strings.ToUpper(attr.TypeName())
+}
+
+// ColumnTypeScanType returns the Go type suitable for scanning values of the column.
+// For computed columns, type is inferred from the first non NULL value.
+//
+// Implemented for RowsColumnTypeScanType interface
+func (r *Rows) ColumnTypeScanType(index int) reflect.Type {
+	if attr := r.attribute(index); attr != nil {
+		// arrays are returned as text
+		if _, ok := agnostic.ArrayElemType(attr.TypeName()); ok {
+			return reflect.TypeOf("")
+		}
+		return attr.ScanType()
+	}
+
+	for _, t := range r.tuples {
+		values := t.Values()
+		if index < len(values) && values[index] != nil {
+			if _, ok := values[index].(agnostic.Array); ok {
+				return reflect.TypeOf("")
+			}
+			return reflect.TypeOf(values[index])
+		}
+	}
+
+	return reflect.TypeOf(new(any)).Elem()
+}
+
+// ColumnTypeNullable reports whether the column may be NULL.
+// ok is false for computed columns.
+//
+// Implemented for RowsColumnTypeNullable interface
+func (r *Rows) ColumnTypeNullable(index int) (nullable, ok bool) {
+	attr := r.attribute(index)
+	if attr == nil {
+		return false, false
+	}
+
+	return attr.Nullable(), true
+}
+
+func (r *Rows) attribute(index int) *agnostic.Attribute {
+	if len(r.attrs) != len(r.columns) || index < 0 || index >= len(r.attrs) {
+		return nil
+	}
+
+	return r.attrs[index]
+}
@@ -0,0 +1,90 @@
+package ramsql
+
+import (
+	"database/sql"
+	"fmt"
+	"reflect"
+	"strings"
+	"unicode"
+)
+
+// ScanStruct copies the columns of the current row of rows into the fields
+// of the struct dest points to, as rows.Scan would.
+//
+// A column is copied into the field whose db tag is the column name, or
+// else whose name matches the column name ignoring case and underscores,
+// so that column created_at fills field CreatedAt. Fields of embedded
+// structs are matched too, and fields tagged db:"-" are ignored. A column
+// without matching field is an error.
+//
+// NULL values are only accepted by pointer fields, set to nil, and by
+// fields implementing sql.Scanner, like sql.NullString.
+func ScanStruct(rows *sql.Rows, dest any) error {
+	v := reflect.ValueOf(dest)
+	if v.Kind() != reflect.Pointer || v.IsNil() || v.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("ScanStruct: destination must be a non nil pointer to a struct, got %T", dest)
+	}
+
+	cols, err := rows.Columns()
+	if err != nil {
+		return err
+	}
+
+	fields := structFields(v.Elem().Type())
+	targets := make([]any, len(cols))
+	for i, col := range cols {
+		index, ok := fields[fieldKey(col)]
+		if !ok {
+			return fmt.Errorf("ScanStruct: column %s has no matching field in %s", col, v.Elem().Type())
+		}
+		targets[i] = v.Elem().FieldByIndex(index).Addr().Interface()
+	}
+
+	return rows.Scan(targets...)
+}
+
+// structFields returns the index of exported fields of struct type t and of
+// its embedded structs, keyed by the column name they match
+func structFields(t reflect.Type) map[string][]int {
+	fields := make(map[string][]int)
+
+	var walk func(t reflect.Type, index []int)
+	walk = func(t reflect.Type, index []int) {
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			tag := f.Tag.Get("db")
+			if tag == "-" {
+				continue
+			}
+			idx := append(append([]int(nil), index...), i)
+			if f.Anonymous && f.Type.Kind() == reflect.Struct && tag == "" {
+				walk(f.Type, idx)
+				continue
+			}
+			if !f.IsExported() {
+				continue
+			}
+			name := f.Name
+			if tag != "" {
+				name = strings.Split(tag, ",")[0]
+			}
+			// fields of the outer struct hide those of embedded ones
+			if _, ok := fields[fieldKey(name)]; !ok || len(idx) < len(fields[fieldKey(name)]) {
+				fields[fieldKey(name)] = idx
+			}
+		}
+	}
+	walk(t, nil)
+
+	return fields
+}
+
+// fieldKey returns name in lower case without underscores
+func fieldKey(name string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '_' {
+			return -1
+		}
+		return unicode.ToLower(r)
+	}, name)
+}
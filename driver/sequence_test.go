@@ -0,0 +1,130 @@
+package ramsql
+
+import (
+	"database/sql"
+	"testing"
+)
+
+func TestSequence(t *testing.T) {
+
+	db, err := sql.Open("ramsql", "TestSequence")
+	if err != nil {
+		t.Fatalf("sql.Open : Error : %s\n", err)
+	}
+	defer db.Close()
+
+	batch := []string{
+		`CREATE SEQUENCE account_seq START 100 INCREMENT 2`,
+		`CREATE TABLE account (id BIGINT PRIMARY KEY, email TEXT)`,
+		`INSERT INTO account (id, email) VALUES (nextval('account_seq'), 'foo@bar.com')`,
+		`INSERT INTO account (id, email) VALUES (nextval('account_seq'), 'bar@bar.com')`,
+	}
+	for _, b := range batch {
+		_, err = db.Exec(b)
+		if err != nil {
+			t.Fatalf("sql.Exec: Error: %s\n", err)
+		}
+	}
+
+	var id int64
+	err = db.QueryRow(`SELECT id FROM account WHERE email = 'bar@bar.com'`).Scan(&id)
+	if err != nil {
+		t.Fatalf("cannot query account: %s", err)
+	}
+	if id != 102 {
+		t.Fatalf("expected id 102, got %d", id)
+	}
+
+	// currval returns last value without advancing the sequence
+	_, err = db.Exec(`CREATE TABLE log (account_id BIGINT, message TEXT)`)
+	if err != nil {
+		t.Fatalf("sql.Exec: Error: %s\n", err)
+	}
+	_, err = db.Exec(`INSERT INTO log (account_id, message) VALUES (currval('public.account_seq'), 'created')`)
+	if err != nil {
+		t.Fatalf("cannot insert with currval: %s", err)
+	}
+	err = db.QueryRow(`SELECT account_id FROM log WHERE message = 'created'`).Scan(&id)
+	if err != nil {
+		t.Fatalf("cannot query log: %s", err)
+	}
+	if id != 102 {
+		t.Fatalf("expected currval 102, got %d", id)
+	}
+
+	// nextval is not reverted on rollback
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatalf("cannot begin transaction: %s", err)
+	}
+	_, err = tx.Exec(`INSERT INTO account (id, email) VALUES (nextval('account_seq'), 'rollback@bar.com')`)
+	if err != nil {
+		t.Fatalf("cannot insert in transaction: %s", err)
+	}
+	err = tx.Rollback()
+	if err != nil {
+		t.Fatalf("cannot rollback: %s", err)
+	}
+
+	_, err = db.Exec(`INSERT INTO account (id, email) VALUES (nextval('account_seq'), 'after@bar.com')`)
+	if err != nil {
+		t.Fatalf("cannot insert into account: %s", err)
+	}
+	err = db.QueryRow(`SELECT id FROM account WHERE email = 'after@bar.com'`).Scan(&id)
+	if err != nil {
+		t.Fatalf("cannot query account: %s", err)
+	}
+	if id != 106 {
+		t.Fatalf("expected id 106 after rollback, got %d", id)
+	}
+
+	_, err = db.Exec(`DROP SEQUENCE account_seq`)
+	if err != nil {
+		t.Fatalf("cannot drop sequence: %s", err)
+	}
+
+	_, err = db.Exec(`INSERT INTO account (id, email) VALUES (nextval('account_seq'), 'dropped@bar.com')`)
+	if err == nil {
+		t.Fatalf("expected error using dropped sequence")
+	}
+}
+
+func TestSequenceCurrvalUndefined(t *testing.T) {
+
+	db, err := sql.Open("ramsql", "TestSequenceCurrvalUndefined")
+	if err != nil {
+		t.Fatalf("sql.Open : Error : %s\n", err)
+	}
+	defer db.Close()
+
+	batch := []string{
+		`CREATE SEQUENCE IF NOT EXISTS s`,
+		`CREATE SEQUENCE IF NOT EXISTS s START WITH 5 INCREMENT BY 5`,
+		`CREATE TABLE t (id BIGINT)`,
+	}
+	for _, b := range batch {
+		_, err = db.Exec(b)
+		if err != nil {
+			t.Fatalf("sql.Exec: Error: %s\n", err)
+		}
+	}
+
+	_, err = db.Exec(`INSERT INTO t (id) VALUES (currval('s'))`)
+	if err == nil {
+		t.Fatalf("expected error calling currval before nextval")
+	}
+
+	_, err = db.Exec(`INSERT INTO t (id) VALUES (nextval('s'))`)
+	if err != nil {
+		t.Fatalf("cannot insert with nextval: %s", err)
+	}
+
+	var id int64
+	err = db.QueryRow(`SELECT id FROM t WHERE 1`).Scan(&id)
+	if err != nil {
+		t.Fatalf("cannot query t: %s", err)
+	}
+	if id != 1 {
+		t.Fatalf("expected id 1, got %d", id)
+	}
+}
@@ -4,45 +4,40 @@ import (
 	"context"
 	"database/sql/driver"
 	"fmt"
-	"strings"
+
+	"github.com/proullon/ramsql/engine/executor"
 )
 
-// Stmt implements the Statement interface of sql/driver
+// Stmt implements the Statement interface of sql/driver. Query is parsed
+// once, when prepared, and each execution only binds arguments.
 type Stmt struct {
 	conn     *Conn
 	query    string
+	stmt     *executor.Statement
 	numInput int
 }
 
-func countArguments(query string) int {
-	for id := 1; id > 0; id++ {
-		sep := fmt.Sprintf("$%d", id)
-		if strings.Count(query, sep) == 0 {
-			return id - 1
+func prepareStatement(c *Conn, query string) (*Stmt, error) {
+	// liveness checks of connection pools are not parsed, see isSelectOne
+	var s *executor.Statement
+	if query != "" && !isSelectOne(query) {
+		var err error
+		s, err = executor.Prepare(query)
+		if err != nil {
+			return nil, err
 		}
 	}
 
-	return -1
-}
-
-func prepareStatement(c *Conn, query string) *Stmt {
-
-	// Parse number of arguments here
-	// Should handler either Postgres ($*) or ODBC (?) parameter markers
-	numInput := strings.Count(query, "?")
-	// if numInput == 0, maybe it's Postgres format
-	if numInput == 0 {
-		numInput = countArguments(query)
-	}
-
-	// Create statement
+	// Placeholders can be positional ($1 or ?) or named (:name, @name or
+	// $name). Engine checks arguments against parsed statement on execution.
 	stmt := &Stmt{
 		conn:     c,
 		query:    query,
-		numInput: numInput,
+		stmt:     s,
+		numInput: -1,
 	}
 
-	return stmt
+	return stmt, nil
 }
 
 // Close closes the statement.
@@ -85,7 +80,7 @@ func (s *Stmt) Exec(args []driver.Value) (r driver.Result, err error) {
 		cargs = append(cargs, driver.NamedValue{Name: fmt.Sprintf("%d", i+1), Ordinal: i + 1, Value: arg})
 	}
 
-	return s.conn.ExecContext(context.Background(), s.query, cargs)
+	return s.conn.execContext(context.Background(), s.query, s.stmt, cargs)
 }
 
 // Query executes a query that may return rows, such as a
@@ -106,5 +101,43 @@ func (s *Stmt) Query(args []driver.Value) (r driver.Rows, err error) {
 		cargs = append(cargs, driver.NamedValue{Name: fmt.Sprintf("%d", i+1), Ordinal: i + 1, Value: arg})
 	}
 
-	return s.conn.QueryContext(context.Background(), s.query, cargs)
+	return s.conn.queryContext(context.Background(), s.query, s.stmt, cargs)
+}
+
+// ExecContext executes a query that doesn't return rows, such
+// as an INSERT or UPDATE, with positional or named arguments.
+//
+// Implemented for StmtExecContext interface
+func (s *Stmt) ExecContext(ctx context.Context, args []driver.NamedValue) (r driver.Result, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("fatalf error: %s", r)
+			return
+		}
+	}()
+
+	if s.query == "" {
+		return nil, fmt.Errorf("empty statement")
+	}
+
+	return s.conn.execContext(ctx, s.query, s.stmt, args)
+}
+
+// QueryContext executes a query that may return rows, such as a
+// SELECT, with positional or named arguments.
+//
+// Implemented for StmtQueryContext interface
+func (s *Stmt) QueryContext(ctx context.Context, args []driver.NamedValue) (r driver.Rows, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("fatalf error: %s", r)
+			return
+		}
+	}()
+
+	if s.query == "" {
+		return nil, fmt.Errorf("empty statement")
+	}
+
+	return s.conn.queryContext(ctx, s.query, s.stmt, args)
 }
@@ -2,6 +2,8 @@ package ramsql
 
 import (
 	"database/sql"
+	"errors"
+	"strings"
 	"sync"
 	"testing"
 
@@ -162,17 +164,34 @@ func TestCheckAttributes(t *testing.T) {
 	if err == nil {
 		t.Errorf("expected an error trying to insert non existing attribute")
 	}
+	checkPosition(t, query, err, "nonexisting_attribute")
 
 	query = `SELECT * FROM account WHERE nonexisting_attribute = 2`
 	_, err = db.Query(query)
 	if err == nil {
 		t.Errorf("expected an error trying to make a comparison with a non existing attribute")
 	}
+	checkPosition(t, query, err, "nonexisting_attribute")
 
 	query = `SELECT id, nonexisting_attribute FROM account WHERE id = 2`
 	rows, err := db.Query(query)
 	if err == nil {
 		t.Errorf("expected an error trying to select a non existing attribute")
 	}
+	checkPosition(t, query, err, "nonexisting_attribute")
 	_ = rows
 }
+
+// checkPosition fails if err is not located at first occurrence of name in query
+func checkPosition(t *testing.T, query string, err error, name string) {
+	t.Helper()
+
+	var e *Error
+	if !errors.As(err, &e) {
+		t.Errorf("expected *Error, got %T (%v)", err, err)
+		return
+	}
+	if expected := strings.Index(query, name) + 1; e.Position != expected {
+		t.Errorf("expected error at character %d of %s, got %d (%s)", expected, query, e.Position, e.Message)
+	}
+}
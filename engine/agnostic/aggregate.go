@@ -0,0 +1,739 @@
+package agnostic
+
+import (
+	"container/list"
+	"fmt"
+	"math"
+	"sort"
+	"sync"
+)
+
+// parallelAggregateRows is the number of input rows from which aggregates are
+// computed by several goroutines
+const parallelAggregateRows = 10000
+
+// MaxSelector returns the greatest non NULL value of attribute, or NULL if
+// there is none.
+type MaxSelector struct {
+	relation  string
+	attribute string
+	collation *Collation
+}
+
+func NewMaxSelector(rname string, attr string) *MaxSelector {
+	return &MaxSelector{
+		relation:  rname,
+		attribute: attr,
+	}
+}
+
+// WithCollation returns selector comparing strings with collation c
+func (s *MaxSelector) WithCollation(c *Collation) *MaxSelector {
+	s.collation = c
+	return s
+}
+
+func (s *MaxSelector) Attribute() []string {
+	return []string{"MAX(" + s.attribute + ")"}
+}
+
+func (s *MaxSelector) Relation() string {
+	return s.relation
+}
+
+func (s *MaxSelector) Alias() string {
+	return ""
+}
+
+func (s *MaxSelector) Select(cols []string, in []*list.Element) ([]*Tuple, error) {
+	values, err := aggregateValues(cols, in, s.relation, s.attribute)
+	if err != nil {
+		return nil, err
+	}
+
+	var max any
+	for _, v := range values {
+		gt, err := collatedGreater(s.collation, v, max)
+		if err != nil {
+			return nil, err
+		}
+		if gt {
+			max = v
+		}
+	}
+
+	return []*Tuple{NewTuple(max)}, nil
+}
+
+func (s MaxSelector) String() string {
+	return fmt.Sprintf("MAX(%s.%s)", s.relation, s.attribute)
+}
+
+// MinSelector returns the least non NULL value of attribute, or NULL if
+// there is none.
+type MinSelector struct {
+	relation  string
+	attribute string
+	collation *Collation
+}
+
+func NewMinSelector(rname string, attr string) *MinSelector {
+	return &MinSelector{
+		relation:  rname,
+		attribute: attr,
+	}
+}
+
+// WithCollation returns selector comparing strings with collation c
+func (s *MinSelector) WithCollation(c *Collation) *MinSelector {
+	s.collation = c
+	return s
+}
+
+func (s *MinSelector) Attribute() []string {
+	return []string{"MIN(" + s.attribute + ")"}
+}
+
+func (s *MinSelector) Relation() string {
+	return s.relation
+}
+
+func (s *MinSelector) Alias() string {
+	return ""
+}
+
+func (s *MinSelector) Select(cols []string, in []*list.Element) ([]*Tuple, error) {
+	values, err := aggregateValues(cols, in, s.relation, s.attribute)
+	if err != nil {
+		return nil, err
+	}
+
+	var min any
+	for i, v := range values {
+		if i == 0 {
+			min = v
+			continue
+		}
+		gt, err := collatedGreater(s.collation, min, v)
+		if err != nil {
+			return nil, err
+		}
+		if gt {
+			min = v
+		}
+	}
+
+	return []*Tuple{NewTuple(min)}, nil
+}
+
+func (s MinSelector) String() string {
+	return fmt.Sprintf("MIN(%s.%s)", s.relation, s.attribute)
+}
+
+// SumSelector returns the sum of non NULL values of attribute, or NULL if
+// there is none.
+type SumSelector struct {
+	relation  string
+	attribute string
+}
+
+func NewSumSelector(rname string, attr string) *SumSelector {
+	return &SumSelector{
+		relation:  rname,
+		attribute: attr,
+	}
+}
+
+func (s *SumSelector) Attribute() []string {
+	return []string{"SUM(" + s.attribute + ")"}
+}
+
+func (s *SumSelector) Relation() string {
+	return s.relation
+}
+
+func (s *SumSelector) Alias() string {
+	return ""
+}
+
+func (s *SumSelector) Select(cols []string, in []*list.Element) ([]*Tuple, error) {
+	values, err := aggregateValues(cols, in, s.relation, s.attribute)
+	if err != nil {
+		return nil, err
+	}
+	if len(values) == 0 {
+		return []*Tuple{NewTuple(nil)}, nil
+	}
+
+	sum, err := sum(values)
+	if err != nil {
+		return nil, fmt.Errorf("SUM(%s): %s", s.attribute, err)
+	}
+
+	return []*Tuple{NewTuple(sum)}, nil
+}
+
+func (s SumSelector) String() string {
+	return fmt.Sprintf("SUM(%s.%s)", s.relation, s.attribute)
+}
+
+// AvgSelector returns the mean of non NULL values of attribute as a float64,
+// or NULL if there is none.
+type AvgSelector struct {
+	relation  string
+	attribute string
+}
+
+func NewAvgSelector(rname string, attr string) *AvgSelector {
+	return &AvgSelector{
+		relation:  rname,
+		attribute: attr,
+	}
+}
+
+func (s *AvgSelector) Attribute() []string {
+	return []string{"AVG(" + s.attribute + ")"}
+}
+
+func (s *AvgSelector) Relation() string {
+	return s.relation
+}
+
+func (s *AvgSelector) Alias() string {
+	return ""
+}
+
+func (s *AvgSelector) Select(cols []string, in []*list.Element) ([]*Tuple, error) {
+	values, err := aggregateValues(cols, in, s.relation, s.attribute)
+	if err != nil {
+		return nil, err
+	}
+	if len(values) == 0 {
+		return []*Tuple{NewTuple(nil)}, nil
+	}
+
+	sum, err := sum(values)
+	if err != nil {
+		return nil, fmt.Errorf("AVG(%s): %s", s.attribute, err)
+	}
+
+	var avg float64
+	switch v := sum.(type) {
+	case int64:
+		avg = float64(v) / float64(len(values))
+	case float64:
+		avg = v / float64(len(values))
+	}
+
+	return []*Tuple{NewTuple(avg)}, nil
+}
+
+func (s AvgSelector) String() string {
+	return fmt.Sprintf("AVG(%s.%s)", s.relation, s.attribute)
+}
+
+// PercentileContSelector returns the value at a fraction of the ordered non
+// NULL values of attribute, interpolating between the two nearest values, as
+// a float64, or NULL if there is none or if fraction is NULL. It is the
+// ordered-set aggregate
+// percentile_cont(fraction) WITHIN GROUP (ORDER BY attribute).
+type PercentileContSelector struct {
+	relation  string
+	attribute string
+	fraction  any
+	direction SortType
+}
+
+// NewPercentileContSelector returns an error if fraction is neither NULL nor
+// a number between 0 and 1.
+func NewPercentileContSelector(rname string, attr string, fraction any, direction SortType) (*PercentileContSelector, error) {
+	if fraction != nil {
+		n, f, isFloat, err := number(fraction)
+		if err != nil {
+			return nil, fmt.Errorf("percentile value %v is not a number", fraction)
+		}
+		if !isFloat {
+			f = float64(n)
+		}
+		if math.IsNaN(f) || f < 0 || f > 1 {
+			return nil, NewError(NumericValueOutOfRange, "percentile value %g is not between 0 and 1", f)
+		}
+		fraction = f
+	}
+	return &PercentileContSelector{
+		relation:  rname,
+		attribute: attr,
+		fraction:  fraction,
+		direction: direction,
+	}, nil
+}
+
+func (s *PercentileContSelector) Attribute() []string {
+	return []string{"percentile_cont"}
+}
+
+func (s *PercentileContSelector) Relation() string {
+	return s.relation
+}
+
+func (s *PercentileContSelector) Alias() string {
+	return ""
+}
+
+func (s *PercentileContSelector) Select(cols []string, in []*list.Element) ([]*Tuple, error) {
+	values, err := orderedValues(cols, in, s.relation, s.attribute, s.direction)
+	if err != nil {
+		return nil, err
+	}
+	if len(values) == 0 || s.fraction == nil {
+		return []*Tuple{NewTuple(nil)}, nil
+	}
+
+	// row position of the percentile, between rows lo and hi
+	pos := s.fraction.(float64) * float64(len(values)-1)
+	lo, hi := int(math.Floor(pos)), int(math.Ceil(pos))
+	vlo, err := s.float(values[lo])
+	if err != nil {
+		return nil, err
+	}
+	vhi, err := s.float(values[hi])
+	if err != nil {
+		return nil, err
+	}
+
+	return []*Tuple{NewTuple(vlo + (vhi-vlo)*(pos-float64(lo)))}, nil
+}
+
+func (s *PercentileContSelector) float(v any) (float64, error) {
+	n, f, isFloat, err := number(v)
+	if err != nil {
+		return 0, fmt.Errorf("percentile_cont(%s): cannot interpolate %v of type %T", s.attribute, v, v)
+	}
+	if isFloat {
+		return f, nil
+	}
+	return float64(n), nil
+}
+
+func (s PercentileContSelector) String() string {
+	return fmt.Sprintf("percentile_cont(%v) WITHIN GROUP (ORDER BY %s)", s.fraction, orderKey(s.relation, s.attribute, s.direction))
+}
+
+// ModeSelector returns the most frequent non NULL value of attribute, the
+// first in attribute order among equally frequent values, or NULL if there
+// is none. It is the ordered-set aggregate
+// mode() WITHIN GROUP (ORDER BY attribute).
+type ModeSelector struct {
+	relation  string
+	attribute string
+	direction SortType
+}
+
+func NewModeSelector(rname string, attr string, direction SortType) *ModeSelector {
+	return &ModeSelector{
+		relation:  rname,
+		attribute: attr,
+		direction: direction,
+	}
+}
+
+func (s *ModeSelector) Attribute() []string {
+	return []string{"mode"}
+}
+
+func (s *ModeSelector) Relation() string {
+	return s.relation
+}
+
+func (s *ModeSelector) Alias() string {
+	return ""
+}
+
+func (s *ModeSelector) Select(cols []string, in []*list.Element) ([]*Tuple, error) {
+	values, err := orderedValues(cols, in, s.relation, s.attribute, s.direction)
+	if err != nil {
+		return nil, err
+	}
+
+	// equal values are adjacent once ordered
+	var mode any
+	var best, run int
+	for i, v := range values {
+		run++
+		if i+1 < len(values) {
+			eq, err := equal(v, values[i+1])
+			if err != nil {
+				return nil, err
+			}
+			if eq {
+				continue
+			}
+		}
+		if run > best {
+			mode, best = v, run
+		}
+		run = 0
+	}
+
+	return []*Tuple{NewTuple(mode)}, nil
+}
+
+func (s ModeSelector) String() string {
+	return fmt.Sprintf("mode() WITHIN GROUP (ORDER BY %s)", orderKey(s.relation, s.attribute, s.direction))
+}
+
+// orderedValues returns the non NULL values of attribute in given rows,
+// sorted in direction.
+func orderedValues(cols []string, in []*list.Element, rel, attr string, direction SortType) ([]any, error) {
+	values, err := aggregateValues(cols, in, rel, attr)
+	if err != nil {
+		return nil, err
+	}
+
+	var serr error
+	sort.SliceStable(values, func(i, j int) bool {
+		l, r := values[i], values[j]
+		if direction == DESC {
+			l, r = r, l
+		}
+		gt, err := greater(r, l)
+		if err != nil && serr == nil {
+			serr = err
+		}
+		return gt
+	})
+	if serr != nil {
+		return nil, serr
+	}
+	return values, nil
+}
+
+func orderKey(rel, attr string, direction SortType) string {
+	if direction == DESC {
+		return fmt.Sprintf("%s.%s DESC", rel, attr)
+	}
+	return fmt.Sprintf("%s.%s", rel, attr)
+}
+
+// FilterSelector computes an aggregate on input rows matching a predicate,
+// like COUNT(*) FILTER (WHERE user_id = 1).
+type FilterSelector struct {
+	Selector
+	filter Predicate
+}
+
+// NewFilterSelector returns aggregate selector s computed on rows matching p
+func NewFilterSelector(s Selector, p Predicate) *FilterSelector {
+	return &FilterSelector{Selector: s, filter: p}
+}
+
+func (s *FilterSelector) Select(cols []string, in []*list.Element) ([]*Tuple, error) {
+	rows, err := s.rows(cols, in)
+	if err != nil {
+		return nil, err
+	}
+	return s.Selector.Select(cols, rows)
+}
+
+// rows returns rows of in matching filter
+func (s *FilterSelector) rows(cols []string, in []*list.Element) ([]*list.Element, error) {
+	rows := make([]*list.Element, 0, len(in))
+	for _, e := range in {
+		ok, err := s.filter.Eval(cols, e.Value.(*Tuple))
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			rows = append(rows, e)
+		}
+	}
+	return rows, nil
+}
+
+func (s FilterSelector) String() string {
+	return fmt.Sprintf("%s FILTER (WHERE %s)", s.Selector, s.filter)
+}
+
+// isAggregate returns true if selector summarizes all input rows into a
+// single row.
+func isAggregate(s Selector) bool {
+	if ns, ok := s.(*NamedSelector); ok {
+		s = ns.Selector
+	}
+	if fs, ok := s.(*FilterSelector); ok {
+		s = fs.Selector
+	}
+
+	switch s.(type) {
+	case *CountSelector, *MaxSelector, *MinSelector, *SumSelector, *AvgSelector,
+		*PercentileContSelector, *ModeSelector:
+		return true
+	}
+	return false
+}
+
+// aggregateValues returns the non NULL values of attribute in given rows.
+func aggregateValues(cols []string, in []*list.Element, rel, attr string) ([]any, error) {
+	idx := -1
+	for i, c := range cols {
+		if c == attr || c == rel+"."+attr {
+			idx = i
+			break
+		}
+	}
+	if idx == -1 {
+		return nil, fmt.Errorf("%s.%s: columns not found in left node", rel, attr)
+	}
+
+	values := make([]any, 0, len(in))
+	for _, e := range in {
+		v := e.Value.(*Tuple).values[idx]
+		if v == nil {
+			continue
+		}
+		values = append(values, v)
+	}
+
+	return values, nil
+}
+
+// sum adds up numeric values. Result is an int64 if all values are integers,
+// a float64 otherwise.
+func sum(values []any) (any, error) {
+	var isum int64
+	var fsum float64
+	var float bool
+
+	for _, v := range values {
+		switch n := v.(type) {
+		case int64:
+			isum += n
+		case int:
+			isum += int64(n)
+		case int32:
+			isum += int64(n)
+		case float64:
+			fsum += n
+			float = true
+		case float32:
+			fsum += float64(n)
+			float = true
+		default:
+			return nil, fmt.Errorf("cannot sum %v of type %T", v, v)
+		}
+	}
+
+	if float {
+		return fsum + float64(isum), nil
+	}
+	return isum, nil
+}
+
+// partialAggregator is implemented by aggregates which can be computed on
+// partitions of input rows, partial results being merged afterward.
+type partialAggregator interface {
+	partial(cols []string, in []*list.Element) (any, error)
+	merge(partials []any) (*Tuple, error)
+}
+
+// aggregateSelect returns the result of aggregate selector on rows in. With
+// at least parallelAggregateRows rows, rows are split among workers
+// goroutines, each computing a partial aggregate, then partials are merged.
+//
+// Aggregates which cannot be merged from partials, like ordered or distinct
+// aggregates, are computed by a single goroutine.
+func aggregateSelect(selector Selector, cols []string, in []*list.Element, workers int) ([]*Tuple, error) {
+	s := selector
+	if ns, ok := s.(*NamedSelector); ok {
+		s = ns.Selector
+	}
+	pa, ok := s.(partialAggregator)
+	if fs, isFilter := s.(*FilterSelector); isFilter {
+		// aggregate rows matching filter
+		var err error
+		if in, err = fs.rows(cols, in); err != nil {
+			return nil, err
+		}
+		s = fs.Selector
+		pa, ok = s.(partialAggregator)
+	}
+	if !ok || workers < 2 || len(in) < parallelAggregateRows {
+		return s.Select(cols, in)
+	}
+
+	size := (len(in) + workers - 1) / workers
+	partials := make([]any, 0, workers)
+	errs := make([]error, 0, workers)
+	for i := 0; i < len(in); i += size {
+		partials = append(partials, nil)
+		errs = append(errs, nil)
+	}
+
+	var wg sync.WaitGroup
+	for w := range partials {
+		lo, hi := w*size, (w+1)*size
+		if hi > len(in) {
+			hi = len(in)
+		}
+		wg.Add(1)
+		go func(w int, chunk []*list.Element) {
+			defer wg.Done()
+			partials[w], errs[w] = pa.partial(cols, chunk)
+		}(w, in[lo:hi])
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	t, err := pa.merge(partials)
+	if err != nil {
+		return nil, err
+	}
+	return []*Tuple{t}, nil
+}
+
+func (s *CountSelector) partial(cols []string, in []*list.Element) (any, error) {
+	return s.count(cols, in)
+}
+
+func (s *CountSelector) merge(partials []any) (*Tuple, error) {
+	var count int64
+	for _, p := range partials {
+		count += p.(int64)
+	}
+	s.cols = []string{"COUNT(" + s.attribute + ")"}
+	return NewTuple(count), nil
+}
+
+func (s *MaxSelector) partial(cols []string, in []*list.Element) (any, error) {
+	out, err := s.Select(cols, in)
+	if err != nil {
+		return nil, err
+	}
+	return out[0].values[0], nil
+}
+
+func (s *MaxSelector) merge(partials []any) (*Tuple, error) {
+	var max any
+	for _, v := range partials {
+		gt, err := collatedGreater(s.collation, v, max)
+		if err != nil {
+			return nil, err
+		}
+		if gt {
+			max = v
+		}
+	}
+	return NewTuple(max), nil
+}
+
+func (s *MinSelector) partial(cols []string, in []*list.Element) (any, error) {
+	out, err := s.Select(cols, in)
+	if err != nil {
+		return nil, err
+	}
+	return out[0].values[0], nil
+}
+
+func (s *MinSelector) merge(partials []any) (*Tuple, error) {
+	var min any
+	for _, v := range partials {
+		if v == nil {
+			continue
+		}
+		if min == nil {
+			min = v
+			continue
+		}
+		gt, err := collatedGreater(s.collation, min, v)
+		if err != nil {
+			return nil, err
+		}
+		if gt {
+			min = v
+		}
+	}
+	return NewTuple(min), nil
+}
+
+func (s *SumSelector) partial(cols []string, in []*list.Element) (any, error) {
+	out, err := s.Select(cols, in)
+	if err != nil {
+		return nil, err
+	}
+	return out[0].values[0], nil
+}
+
+func (s *SumSelector) merge(partials []any) (*Tuple, error) {
+	var values []any
+	for _, v := range partials {
+		if v != nil {
+			values = append(values, v)
+		}
+	}
+	if len(values) == 0 {
+		return NewTuple(nil), nil
+	}
+
+	sum, err := sum(values)
+	if err != nil {
+		return nil, fmt.Errorf("SUM(%s): %s", s.attribute, err)
+	}
+	return NewTuple(sum), nil
+}
+
+// avgPartial is the sum and the number of non NULL values of a partition
+type avgPartial struct {
+	sum   any
+	count int64
+}
+
+func (s *AvgSelector) partial(cols []string, in []*list.Element) (any, error) {
+	values, err := aggregateValues(cols, in, s.relation, s.attribute)
+	if err != nil {
+		return nil, err
+	}
+	if len(values) == 0 {
+		return avgPartial{}, nil
+	}
+
+	sum, err := sum(values)
+	if err != nil {
+		return nil, fmt.Errorf("AVG(%s): %s", s.attribute, err)
+	}
+	return avgPartial{sum: sum, count: int64(len(values))}, nil
+}
+
+func (s *AvgSelector) merge(partials []any) (*Tuple, error) {
+	var sums []any
+	var count int64
+	for _, p := range partials {
+		ap := p.(avgPartial)
+		if ap.count == 0 {
+			continue
+		}
+		sums = append(sums, ap.sum)
+		count += ap.count
+	}
+	if count == 0 {
+		return NewTuple(nil), nil
+	}
+
+	total, err := sum(sums)
+	if err != nil {
+		return nil, fmt.Errorf("AVG(%s): %s", s.attribute, err)
+	}
+
+	var avg float64
+	switch v := total.(type) {
+	case int64:
+		avg = float64(v) / float64(count)
+	case float64:
+		avg = v / float64(count)
+	}
+	return NewTuple(avg), nil
+}
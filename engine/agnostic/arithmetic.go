@@ -0,0 +1,205 @@
+package agnostic
+
+import (
+	"fmt"
+	"math"
+	"time"
+)
+
+// ArithmeticValueFunctor adds or subtracts the values returned by two
+// ValueFunctors, like ts + INTERVAL '1 day'.
+//
+// Numbers are added as integers if both are integers, as floats otherwise.
+// Adding an interval to a timestamp yields a timestamp, and subtracting two
+// timestamps yields an interval. A string literal combined with a timestamp
+// is read as an interval. If either value is NULL, result is NULL.
+type ArithmeticValueFunctor struct {
+	op    string
+	left  ValueFunctor
+	right ValueFunctor
+}
+
+// NewArithmeticValueFunctor creates a ValueFunctor computing left op right,
+// where op is + or -.
+func NewArithmeticValueFunctor(op string, left, right ValueFunctor) (*ArithmeticValueFunctor, error) {
+	if op != "+" && op != "-" {
+		return nil, fmt.Errorf("operator %s does not exist", op)
+	}
+
+	f := &ArithmeticValueFunctor{
+		op:    op,
+		left:  left,
+		right: right,
+	}
+	return f, nil
+}
+
+func (f *ArithmeticValueFunctor) Value(cols []string, t *Tuple) (any, error) {
+	l, err := f.left.Value(cols, t)
+	if err != nil {
+		return nil, err
+	}
+	r, err := f.right.Value(cols, t)
+	if err != nil {
+		return nil, err
+	}
+	if l == nil || r == nil {
+		return nil, nil
+	}
+
+	if f.op == "+" {
+		return add(l, r)
+	}
+	return subtract(l, r)
+}
+
+// Relation returns the relation of the first operand referencing one
+func (f *ArithmeticValueFunctor) Relation() string {
+	if r := f.left.Relation(); r != "" {
+		return r
+	}
+	return f.right.Relation()
+}
+
+func (f *ArithmeticValueFunctor) Attribute() []string {
+	return append(f.left.Attribute(), f.right.Attribute()...)
+}
+
+func (f ArithmeticValueFunctor) String() string {
+	return fmt.Sprintf("(%s %s %s)", f.left, f.op, f.right)
+}
+
+func add(l, r any) (any, error) {
+	switch lv := l.(type) {
+	case time.Time:
+		i, err := intervalValue(r)
+		if err != nil {
+			return nil, operatorError(l, "+", r)
+		}
+		return i.AddTo(lv)
+	case Interval:
+		switch rv := r.(type) {
+		case time.Time:
+			return lv.AddTo(rv)
+		case Interval:
+			return lv.Add(rv)
+		}
+		return nil, operatorError(l, "+", r)
+	case string:
+		if _, ok := r.(time.Time); ok {
+			return add(r, l)
+		}
+	}
+
+	return numeric(l, r, "+")
+}
+
+func subtract(l, r any) (any, error) {
+	switch lv := l.(type) {
+	case time.Time:
+		switch rv := r.(type) {
+		case time.Time:
+			return IntervalBetween(lv, rv), nil
+		case string:
+			if i, err := ParseInterval(rv); err == nil {
+				return subtract(lv, i)
+			}
+			if t, err := parseDate(rv); err == nil {
+				return IntervalBetween(lv, t), nil
+			}
+		}
+		i, err := intervalValue(r)
+		if err != nil {
+			return nil, operatorError(l, "-", r)
+		}
+		n, err := i.Neg()
+		if err != nil {
+			return nil, err
+		}
+		return n.AddTo(lv)
+	case Interval:
+		rv, ok := r.(Interval)
+		if !ok {
+			return nil, operatorError(l, "-", r)
+		}
+		n, err := rv.Neg()
+		if err != nil {
+			return nil, err
+		}
+		return lv.Add(n)
+	}
+
+	return numeric(l, r, "-")
+}
+
+// intervalValue returns v as an interval, parsing it if it is a string
+func intervalValue(v any) (Interval, error) {
+	switch v := v.(type) {
+	case Interval:
+		return v, nil
+	case string:
+		return ParseInterval(v)
+	}
+	return Interval{}, fmt.Errorf("%v is not an interval", v)
+}
+
+// numeric adds or subtracts numbers. Integer overflow is an error.
+func numeric(l, r any, op string) (any, error) {
+	il, fl, lFloat, err := number(l)
+	if err != nil {
+		return nil, operatorError(l, op, r)
+	}
+	ir, fr, rFloat, err := number(r)
+	if err != nil {
+		return nil, operatorError(l, op, r)
+	}
+
+	if !lFloat && !rFloat {
+		if op == "-" {
+			if ir == math.MinInt64 {
+				return nil, fmt.Errorf("integer out of range")
+			}
+			ir = -ir
+		}
+		s, err := addInt64(il, ir)
+		if err != nil {
+			return nil, fmt.Errorf("integer out of range")
+		}
+		return s, nil
+	}
+
+	if !lFloat {
+		fl = float64(il)
+	}
+	if !rFloat {
+		fr = float64(ir)
+	}
+	if op == "-" {
+		return fl - fr, nil
+	}
+	return fl + fr, nil
+}
+
+func operatorError(l any, op string, r any) error {
+	return fmt.Errorf("operator does not exist: %s %s %s", typeName(l), op, typeName(r))
+}
+
+// typeName returns the SQL name of the type of v
+func typeName(v any) string {
+	switch v.(type) {
+	case time.Time:
+		return "timestamp"
+	case Interval:
+		return "interval"
+	case string:
+		return "text"
+	case bool:
+		return "boolean"
+	case float32, float64:
+		return "double precision"
+	}
+	if _, _, _, err := number(v); err == nil {
+		return "bigint"
+	}
+	return fmt.Sprintf("%T", v)
+}
@@ -0,0 +1,610 @@
+package agnostic
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// Array is a one dimensional array of values of a same type, like
+// '{a,b,c}' or ARRAY[1, 2, 3]. ElemType is the type name of values, as in
+// CAST, and NULL values are nil. Nested arrays are not supported.
+type Array struct {
+	ElemType string
+	Values   []any
+}
+
+// ArrayElemType returns the type of the elements of array type typeName,
+// like text for text[], and false if typeName is not an array type
+func ArrayElemType(typeName string) (string, bool) {
+	elem, ok := strings.CutSuffix(strings.TrimSpace(typeName), "[]")
+	return strings.TrimSpace(elem), ok
+}
+
+// NewArray returns an array of values converted to type elemType
+func NewArray(elemType string, values ...any) (Array, error) {
+	elemType = strings.ToLower(elemType)
+	if _, ok := ArrayElemType(elemType); ok {
+		return Array{}, fmt.Errorf("nested arrays are not supported")
+	}
+	if _, ok := castFuncs[elemType]; !ok {
+		return Array{}, fmt.Errorf("type %s does not exist", elemType)
+	}
+
+	a := Array{ElemType: elemType, Values: make([]any, len(values))}
+	for i, v := range values {
+		v, err := driverValue(v)
+		if err != nil {
+			return Array{}, err
+		}
+		if a.Values[i], err = Cast(v, elemType); err != nil {
+			return Array{}, err
+		}
+	}
+	return a, nil
+}
+
+// ParseArray parses array literal s, like {a,"b c",NULL}, into an array of
+// values of type elemType. Elements are separated by commas, and double quoted
+// if they hold a comma, a brace, a double quote, a backslash or spaces.
+func ParseArray(s, elemType string) (Array, error) {
+	malformed := func(detail string) error {
+		return NewError(InvalidTextRepresentation, "malformed array literal: \"%s\": %s", s, detail)
+	}
+
+	body := strings.TrimSpace(s)
+	if body == "" || body[0] != '{' {
+		return Array{}, malformed("array value must start with \"{\"")
+	}
+	if len(body) < 2 || body[len(body)-1] != '}' {
+		return Array{}, malformed("unexpected end of input")
+	}
+	body = body[1 : len(body)-1]
+
+	var values []any
+	if strings.TrimSpace(body) == "" {
+		return NewArray(elemType)
+	}
+
+	for i := 0; ; {
+		for i < len(body) && body[i] == ' ' {
+			i++
+		}
+
+		var elem strings.Builder
+		quoted := i < len(body) && body[i] == '"'
+		if quoted {
+			i++
+			for ; i < len(body) && body[i] != '"'; i++ {
+				if body[i] == '\\' && i+1 < len(body) {
+					i++
+				}
+				elem.WriteByte(body[i])
+			}
+			if i == len(body) {
+				return Array{}, malformed("unexpected end of input")
+			}
+			i++
+			for i < len(body) && body[i] == ' ' {
+				i++
+			}
+		} else {
+			for ; i < len(body) && body[i] != ','; i++ {
+				switch body[i] {
+				case '{', '}', '"':
+					if body[i] == '{' {
+						return Array{}, fmt.Errorf("nested arrays are not supported")
+					}
+					return Array{}, malformed(fmt.Sprintf("unexpected \"%c\" character", body[i]))
+				case '\\':
+					if i+1 < len(body) {
+						i++
+					}
+				}
+				elem.WriteByte(body[i])
+			}
+		}
+
+		e := elem.String()
+		switch {
+		case quoted:
+			values = append(values, e)
+		case strings.TrimSpace(e) == "":
+			return Array{}, malformed("unexpected \",\" character")
+		case strings.EqualFold(strings.TrimSpace(e), "null"):
+			values = append(values, nil)
+		default:
+			values = append(values, strings.TrimSpace(e))
+		}
+
+		if i == len(body) {
+			break
+		}
+		if body[i] != ',' {
+			return Array{}, malformed(fmt.Sprintf("unexpected \"%c\" character", body[i]))
+		}
+		i++
+	}
+
+	return NewArray(elemType, values...)
+}
+
+// toArray converts v to an array of values of type elemType. v may be an
+// array, an array literal or a Go slice.
+func toArray(v any, elemType string) (Array, error) {
+	switch v := v.(type) {
+	case Array:
+		if v.ElemType == strings.ToLower(elemType) {
+			return v, nil
+		}
+		return NewArray(elemType, v.Values...)
+	case string:
+		return ParseArray(v, elemType)
+	case []byte:
+		return ParseArray(string(v), elemType)
+	}
+
+	r := reflect.ValueOf(v)
+	if r.Kind() != reflect.Slice && r.Kind() != reflect.Array {
+		return Array{}, fmt.Errorf("cannot convert %v (type %T) to %s[]", v, v, elemType)
+	}
+	values := make([]any, r.Len())
+	for i := range values {
+		values[i] = r.Index(i).Interface()
+	}
+	return NewArray(elemType, values...)
+}
+
+// elemTypeOf returns the type name of elements of an array holding v
+func elemTypeOf(v any) string {
+	switch v.(type) {
+	case string, []byte:
+		return "text"
+	case bool:
+		return "boolean"
+	case time.Time:
+		return "timestamp"
+	case Interval:
+		return "interval"
+	case float32, float64:
+		return "float"
+	}
+	if _, _, _, err := number(v); err == nil {
+		return "bigint"
+	}
+	return "text"
+}
+
+// arrayOperand returns v as an array. An array literal takes the element type
+// of array other, if any.
+func arrayOperand(v any, other any) (Array, error) {
+	if a, ok := v.(Array); ok {
+		return a, nil
+	}
+	elemType := "text"
+	if o, ok := other.(Array); ok {
+		elemType = o.ElemType
+	}
+	if _, ok := v.(string); !ok {
+		return Array{}, NewError(DatatypeMismatch, "%v is not an array", v)
+	}
+	return toArray(v, elemType)
+}
+
+// contains returns true if every element of b is an element of a. NULL
+// elements are never equal.
+func (a Array) contains(b Array) (bool, error) {
+	for _, vb := range b.Values {
+		found := false
+		for _, va := range a.Values {
+			if va == nil || vb == nil {
+				continue
+			}
+			eq, err := equal(va, vb)
+			if err != nil {
+				return false, err
+			}
+			if eq {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// overlaps returns true if a and b have an element in common
+func (a Array) overlaps(b Array) (bool, error) {
+	for _, vb := range b.Values {
+		ok, err := a.contains(Array{Values: []any{vb}})
+		if err != nil || ok {
+			return ok, err
+		}
+	}
+	return false, nil
+}
+
+// equal returns true if a and b have equal elements, in the same order. As
+// in PostgreSQL, NULL elements are equal.
+func (a Array) equal(b Array) (bool, error) {
+	if len(a.Values) != len(b.Values) {
+		return false, nil
+	}
+	for i := range a.Values {
+		eq, err := equal(a.Values[i], b.Values[i])
+		if err != nil || !eq {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+// String formats array like PostgreSQL, as in {a,"b c",NULL}
+func (a Array) String() string {
+	var sb strings.Builder
+	sb.WriteByte('{')
+	for i, v := range a.Values {
+		if i > 0 {
+			sb.WriteByte(',')
+		}
+		if v == nil {
+			sb.WriteString("NULL")
+			continue
+		}
+		s := fmt.Sprint(v)
+		if t, err := castText(v); err == nil {
+			s = t.(string)
+		}
+		if s == "" || strings.EqualFold(s, "null") || strings.ContainsAny(s, "{},\"\\ \t\n") {
+			s = `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+		}
+		sb.WriteString(s)
+	}
+	sb.WriteByte('}')
+	return sb.String()
+}
+
+// ArrayValueFunctor builds an array from the values of element
+// ValueFunctors, like ARRAY['a', 'b'].
+type ArrayValueFunctor struct {
+	elems []ValueFunctor
+}
+
+func NewArrayValueFunctor(elems ...ValueFunctor) *ArrayValueFunctor {
+	return &ArrayValueFunctor{elems: elems}
+}
+
+// Value returns an array of the type of its first non NULL element, or of
+// floats if it mixes integers and floats
+func (f *ArrayValueFunctor) Value(cols []string, t *Tuple) (any, error) {
+	values := make([]any, len(f.elems))
+	elemType := ""
+	for i, e := range f.elems {
+		v, err := e.Value(cols, t)
+		if err != nil {
+			return nil, err
+		}
+		values[i] = v
+		if v == nil {
+			continue
+		}
+		switch et := elemTypeOf(v); {
+		case elemType == "", elemType == "bigint" && et == "float":
+			elemType = et
+		}
+	}
+	if elemType == "" {
+		elemType = "text"
+	}
+
+	return NewArray(elemType, values...)
+}
+
+func (f *ArrayValueFunctor) Relation() string {
+	for _, e := range f.elems {
+		if r := e.Relation(); r != "" {
+			return r
+		}
+	}
+	return ""
+}
+
+func (f *ArrayValueFunctor) Attribute() []string {
+	var attrs []string
+	for _, e := range f.elems {
+		attrs = append(attrs, e.Attribute()...)
+	}
+	return attrs
+}
+
+func (f ArrayValueFunctor) String() string {
+	elems := make([]string, len(f.elems))
+	for i, e := range f.elems {
+		elems[i] = fmt.Sprint(e)
+	}
+	return fmt.Sprintf("ARRAY[%s]", strings.Join(elems, ", "))
+}
+
+// SubscriptValueFunctor returns an element of an array, like tags[1].
+// Subscripts start at 1, and a subscript out of bounds returns NULL.
+type SubscriptValueFunctor struct {
+	src   ValueFunctor
+	index ValueFunctor
+}
+
+func NewSubscriptValueFunctor(src, index ValueFunctor) *SubscriptValueFunctor {
+	return &SubscriptValueFunctor{src: src, index: index}
+}
+
+func (f *SubscriptValueFunctor) Value(cols []string, t *Tuple) (any, error) {
+	v, err := f.src.Value(cols, t)
+	if err != nil {
+		return nil, err
+	}
+	idx, err := f.index.Value(cols, t)
+	if err != nil {
+		return nil, err
+	}
+	if v == nil || idx == nil {
+		return nil, nil
+	}
+
+	a, ok := v.(Array)
+	if !ok {
+		return nil, NewError(DatatypeMismatch, "cannot subscript type %s because it is not an array", typeName(v))
+	}
+	i, _, isFloat, err := number(idx)
+	if err != nil || isFloat {
+		return nil, NewError(DatatypeMismatch, "array subscript must have type integer")
+	}
+	if i < 1 || i > int64(len(a.Values)) {
+		return nil, nil
+	}
+	return a.Values[i-1], nil
+}
+
+func (f *SubscriptValueFunctor) Relation() string {
+	if r := f.src.Relation(); r != "" {
+		return r
+	}
+	return f.index.Relation()
+}
+
+func (f *SubscriptValueFunctor) Attribute() []string {
+	return append(f.src.Attribute(), f.index.Attribute()...)
+}
+
+func (f SubscriptValueFunctor) String() string {
+	return fmt.Sprintf("%s[%s]", f.src, f.index)
+}
+
+func arrayLengthFunc(args []any) (any, error) {
+	a, ok := args[0].(Array)
+	if !ok {
+		return nil, fmt.Errorf("%v is not an array", args[0])
+	}
+	dim, _, isFloat, err := number(args[1])
+	if err != nil || isFloat {
+		return nil, fmt.Errorf("dimension must be an integer")
+	}
+	// arrays have one dimension, and empty arrays none
+	if dim != 1 || len(a.Values) == 0 {
+		return nil, nil
+	}
+	return int64(len(a.Values)), nil
+}
+
+func cardinalityFunc(args []any) (any, error) {
+	a, ok := args[0].(Array)
+	if !ok {
+		return nil, fmt.Errorf("%v is not an array", args[0])
+	}
+	return int64(len(a.Values)), nil
+}
+
+// ArrayPredicate compares two arrays with operator @> (contains), <@ (is
+// contained by) or && (overlaps), like tags @> ARRAY['a']. An array literal
+// takes the element type of the other array.
+type ArrayPredicate struct {
+	left  ValueFunctor
+	right ValueFunctor
+	op    string
+}
+
+func NewArrayPredicate(left ValueFunctor, op string, right ValueFunctor) (*ArrayPredicate, error) {
+	switch op {
+	case "@>", "<@", "&&":
+	default:
+		return nil, fmt.Errorf("unknown array operator %s", op)
+	}
+	return &ArrayPredicate{left: left, right: right, op: op}, nil
+}
+
+func (p *ArrayPredicate) Type() PredicateType {
+	return ArrayOp
+}
+
+func (p ArrayPredicate) String() string {
+	return fmt.Sprintf("%s %s %s", p.left, p.op, p.right)
+}
+
+func (p *ArrayPredicate) Eval(cols []string, t *Tuple) (bool, error) {
+	vl, err := p.left.Value(cols, t)
+	if err != nil {
+		return false, err
+	}
+	vr, err := p.right.Value(cols, t)
+	if err != nil {
+		return false, err
+	}
+	// comparison with NULL is unknown
+	if vl == nil || vr == nil {
+		return false, nil
+	}
+
+	l, err := arrayOperand(vl, vr)
+	if err != nil {
+		return false, err
+	}
+	r, err := arrayOperand(vr, l)
+	if err != nil {
+		return false, err
+	}
+
+	switch p.op {
+	case "@>":
+		return l.contains(r)
+	case "<@":
+		return r.contains(l)
+	}
+	return l.overlaps(r)
+}
+
+// unknown returns true if an array is NULL
+func (p *ArrayPredicate) unknown(cols []string, t *Tuple) (bool, error) {
+	vl, err := p.left.Value(cols, t)
+	if err != nil {
+		return false, err
+	}
+	vr, err := p.right.Value(cols, t)
+	if err != nil {
+		return false, err
+	}
+	return vl == nil || vr == nil, nil
+}
+
+func (p *ArrayPredicate) Left() (Predicate, bool) {
+	return nil, false
+}
+
+func (p *ArrayPredicate) Right() (Predicate, bool) {
+	return nil, false
+}
+
+func (p *ArrayPredicate) Relation() string {
+	if p.left.Relation() != "" {
+		return p.left.Relation()
+	}
+	return p.right.Relation()
+}
+
+func (p *ArrayPredicate) Attribute() []string {
+	return append(p.left.Attribute(), p.right.Attribute()...)
+}
+
+// AnyPredicate compares a value with each element of an array, and is true
+// if any comparison is, like 'a' = ANY(tags). An array literal takes the type
+// of the value.
+type AnyPredicate struct {
+	left  ValueFunctor
+	t     PredicateType
+	array ValueFunctor
+}
+
+func NewAnyPredicate(left ValueFunctor, t PredicateType, array ValueFunctor) (*AnyPredicate, error) {
+	if _, err := newComparisonPredicate(left, t, array); err != nil {
+		return nil, err
+	}
+	return &AnyPredicate{left: left, t: t, array: array}, nil
+}
+
+func (p *AnyPredicate) Type() PredicateType {
+	return Any
+}
+
+func (p AnyPredicate) String() string {
+	op := map[PredicateType]string{Eq: "=", Neq: "!=", Geq: ">=", Leq: "<=", Ge: ">", Le: "<"}[p.t]
+	return fmt.Sprintf("%s %s ANY(%s)", p.left, op, p.array)
+}
+
+func (p *AnyPredicate) Eval(cols []string, t *Tuple) (bool, error) {
+	v, err := p.left.Value(cols, t)
+	if err != nil {
+		return false, err
+	}
+	av, err := p.array.Value(cols, t)
+	if err != nil {
+		return false, err
+	}
+	if v == nil || av == nil {
+		return false, nil
+	}
+
+	a, ok := av.(Array)
+	if !ok {
+		s, isString := av.(string)
+		if !isString {
+			return false, NewError(DatatypeMismatch, "op ANY requires array on right side")
+		}
+		if a, err = ParseArray(s, elemTypeOf(v)); err != nil {
+			return false, err
+		}
+	}
+
+	left := NewConstValueFunctor(v)
+	for _, e := range a.Values {
+		if e == nil {
+			continue
+		}
+		c, err := newComparisonPredicate(left, p.t, NewConstValueFunctor(e))
+		if err != nil {
+			return false, err
+		}
+		ok, err := c.Eval(cols, t)
+		if err != nil {
+			return false, err
+		}
+		if ok {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// unknown returns true if no comparison is true and value, array or one of
+// its elements is NULL
+func (p *AnyPredicate) unknown(cols []string, t *Tuple) (bool, error) {
+	ok, err := p.Eval(cols, t)
+	if err != nil || ok {
+		return false, err
+	}
+	v, err := p.left.Value(cols, t)
+	if err != nil || v == nil {
+		return v == nil, err
+	}
+	av, err := p.array.Value(cols, t)
+	if err != nil || av == nil {
+		return av == nil, err
+	}
+	if a, ok := av.(Array); ok {
+		for _, e := range a.Values {
+			if e == nil {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
+
+func (p *AnyPredicate) Left() (Predicate, bool) {
+	return nil, false
+}
+
+func (p *AnyPredicate) Right() (Predicate, bool) {
+	return nil, false
+}
+
+func (p *AnyPredicate) Relation() string {
+	if p.left.Relation() != "" {
+		return p.left.Relation()
+	}
+	return p.array.Relation()
+}
+
+func (p *AnyPredicate) Attribute() []string {
+	return append(p.left.Attribute(), p.array.Attribute()...)
+}
@@ -1,7 +1,10 @@
 package agnostic
 
 import (
+	"database/sql/driver"
+	"errors"
 	"fmt"
+	"math"
 	"math/rand"
 	"reflect"
 	"strconv"
@@ -17,23 +20,25 @@ type ForeignKey struct {
 	attribute string
 }
 
-// Domain is the set of allowable values for an Attribute.
-type Domain struct {
-}
-
 // Attribute is a named column of a relation
 // AKA Field
 // AKA Column
 type Attribute struct {
-	name          string
-	typeName      string
-	typeInstance  reflect.Type
-	defaultValue  Defaulter
-	domain        Domain
+	name         string
+	typeName     string
+	typeInstance reflect.Type
+	defaultValue Defaulter
+	// SQL expression of default value, empty if unknown
+	defaultExpr   string
+	domain        *Domain
 	autoIncrement bool
 	nextValue     uint64
+	startValue    uint64
 	unique        bool
+	notNull       bool
 	fk            *ForeignKey
+	collation     *Collation
+	enum          *Enum
 }
 
 func NewAttribute(name, typeName string) Attribute {
@@ -49,6 +54,15 @@ func NewAttribute(name, typeName string) Attribute {
 func (a Attribute) WithAutoIncrement() Attribute {
 	a.autoIncrement = true
 	a.nextValue = 1
+	a.startValue = 1
+	return a
+}
+
+// WithStartValue sets the first value generated by an auto-increment
+// attribute, which TRUNCATE RESTART IDENTITY restarts from
+func (a Attribute) WithStartValue(v uint64) Attribute {
+	a.nextValue = v
+	a.startValue = v
 	return a
 }
 
@@ -63,11 +77,13 @@ func (a Attribute) WithDefaultConst(defaultValue any) Attribute {
 		}
 		return reflect.ValueOf(defaultValue).Convert(a.typeInstance).Interface()
 	}
+	a.defaultExpr = sqlLiteral(a.defaultValue())
 	return a
 }
 
 func (a Attribute) WithDefault(defaultValue Defaulter) Attribute {
 	a.defaultValue = defaultValue
+	a.defaultExpr = ""
 	return a
 }
 
@@ -75,6 +91,45 @@ func (a Attribute) WithDefaultNow() Attribute {
 	a.defaultValue = func() any {
 		return time.Now()
 	}
+	a.defaultExpr = "NOW()"
+	return a
+}
+
+// WithDefaultCurrentDate sets default value to the date of insertion, at midnight
+func (a Attribute) WithDefaultCurrentDate() Attribute {
+	a.defaultValue = func() any {
+		now := time.Now()
+		return time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	}
+	a.defaultExpr = "CURRENT_DATE"
+	return a
+}
+
+// WithDefaultRandom sets default value to a random float in [0.0,1.0)
+func (a Attribute) WithDefaultRandom() Attribute {
+	a.defaultValue = func() any {
+		return rand.Float64()
+	}
+	a.defaultExpr = "RANDOM()"
+	return a
+}
+
+// defaultAt returns the default value of attribute for a row inserted at now
+func (a Attribute) defaultAt(now time.Time) any {
+	switch a.defaultExpr {
+	case "NOW()":
+		return now
+	case "CURRENT_DATE":
+		return time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	}
+	return a.defaultValue()
+}
+
+// WithForeignKey declares attribute as referencing attribute of relation in
+// schema. Empty schema is resolved when relation is created, and empty
+// attribute references the primary key of relation.
+func (a Attribute) WithForeignKey(schema, relation, attribute string) Attribute {
+	a.fk = &ForeignKey{schema: schema, relation: relation, attribute: attribute}
 	return a
 }
 
@@ -83,10 +138,197 @@ func (a Attribute) WithUnique() Attribute {
 	return a
 }
 
+// WithNotNull declares attribute as NOT NULL
+func (a Attribute) WithNotNull() Attribute {
+	a.notNull = true
+	return a
+}
+
+// WithCollation sets the collation comparing and ordering attribute values
+func (a Attribute) WithCollation(c *Collation) Attribute {
+	a.collation = c
+	return a
+}
+
+// WithEnum declares attribute values as labels of enum type e
+func (a Attribute) WithEnum(e *Enum) Attribute {
+	a.enum = e
+	return a
+}
+
+// Enum returns the enum type of attribute, or nil if it is not an enum
+func (a Attribute) Enum() *Enum {
+	return a.enum
+}
+
+// WithDomain declares attribute values as values of domain d. Attribute
+// inherits the default value of d unless it has one.
+func (a Attribute) WithDomain(d *Domain) Attribute {
+	a.domain = d
+	a.typeInstance = typeInstanceFromName(d.baseType)
+	if a.defaultValue == nil && d.defaultValue != nil {
+		a = a.WithDefaultConst(d.defaultValue)
+	}
+	if d.notNull {
+		a.notNull = true
+	}
+	return a
+}
+
+// Domain returns the domain of attribute, or nil if it has none
+func (a Attribute) Domain() *Domain {
+	return a.domain
+}
+
+// Collation returns the collation of attribute, or nil if it has none.
+// Values of an enum are ordered as its labels.
+func (a Attribute) Collation() *Collation {
+	if a.collation == nil && a.enum != nil {
+		return a.enum.collation
+	}
+	return a.collation
+}
+
 func (a Attribute) Name() string {
 	return a.name
 }
 
+// TypeName returns the SQL type attribute was declared with
+func (a Attribute) TypeName() string {
+	return a.typeName
+}
+
+// ScanType returns the Go type of attribute values
+func (a Attribute) ScanType() reflect.Type {
+	return a.typeInstance
+}
+
+// Nullable returns false if attribute was declared NOT NULL
+func (a Attribute) Nullable() bool {
+	return !a.notNull
+}
+
+// Accepts returns true if v can be assigned to attribute. NULL is always accepted.
+func (a Attribute) Accepts(v any) bool {
+	v, err := driverValue(v)
+	if err != nil {
+		return false
+	}
+	if v == nil {
+		return true
+	}
+	if elemType, ok := ArrayElemType(a.typeName); ok {
+		_, err := toArray(v, elemType)
+		return err == nil
+	}
+	if a.enum != nil {
+		s, ok := v.(string)
+		return ok && a.enum.check(s) == nil
+	}
+	return reflect.TypeOf(v).ConvertibleTo(a.typeInstance)
+}
+
+// convert returns v converted to attribute type. In strict mode, v must be
+// converted without loss nor change of domain. A driver.Valuer is converted
+// from the result of its Value method.
+func (a Attribute) convert(relation string, v any, strict bool) (any, error) {
+	v, err := driverValue(v)
+	if err != nil || v == nil {
+		return nil, err
+	}
+	if elemType, ok := ArrayElemType(a.typeName); ok {
+		arr, err := toArray(v, elemType)
+		if err != nil {
+			// a malformed literal keeps its code
+			code := DatatypeMismatch
+			var e *Error
+			if errors.As(err, &e) {
+				code = e.Code
+			}
+			return nil, NewError(code, "cannot assign '%v' to %s.%s (type %s): %s", v, relation, a.name, a.typeName, err).On(relation, a.name)
+		}
+		return arr, nil
+	}
+	if a.enum != nil {
+		s, ok := v.(string)
+		if !ok {
+			return nil, NewError(DatatypeMismatch, "cannot assign '%v' (type %T) to %s.%s (type %s)", v, v, relation, a.name, a.enum).On(relation, a.name)
+		}
+		if err := a.enum.check(s); err != nil {
+			return nil, err.On(relation, a.name)
+		}
+		return s, nil
+	}
+	tof := reflect.TypeOf(v)
+	if !tof.ConvertibleTo(a.typeInstance) {
+		return nil, NewError(DatatypeMismatch, "cannot assign '%v' (type %s) to %s.%s (type %s)", v, tof, relation, a.name, a.typeInstance).On(relation, a.name)
+	}
+	if strict && !lossless(reflect.ValueOf(v), a.typeInstance) {
+		return nil, NewError(DatatypeMismatch, "cannot assign '%v' (type %s) to %s.%s (type %s) without loss", v, tof, relation, a.name, a.typeInstance).On(relation, a.name)
+	}
+	v = reflect.ValueOf(v).Convert(a.typeInstance).Interface()
+	if a.domain != nil {
+		if err := a.domain.validate(v); err != nil {
+			var e *Error
+			if errors.As(err, &e) {
+				return nil, e.On(relation, a.name)
+			}
+			return nil, err
+		}
+	}
+	return v, nil
+}
+
+// nullViolation returns the error of assigning NULL to NOT NULL attribute
+func (a Attribute) nullViolation(relation string) error {
+	return NewError(NotNullViolation, "null value in column %s of relation %s violates not-null constraint", a.name, relation).On(relation, a.name)
+}
+
+// driverValue returns the value stored for v: the result of its Value method if
+// it implements driver.Valuer, v itself otherwise
+func driverValue(v any) (any, error) {
+	vr, ok := v.(driver.Valuer)
+	if !ok {
+		return v, nil
+	}
+	return vr.Value()
+}
+
+// lossless returns true if v converts to type t keeping its value and domain:
+// numbers convert to numbers that represent them exactly, other values only
+// to values of same kind.
+func lossless(v reflect.Value, t reflect.Type) bool {
+	// largest integer a float64 holds exactly
+	const maxExact = 1 << 53
+
+	switch t.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		switch v.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			return !reflect.Zero(t).OverflowInt(v.Int())
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			return v.Uint() <= math.MaxInt64 && !reflect.Zero(t).OverflowInt(int64(v.Uint()))
+		case reflect.Float32, reflect.Float64:
+			f := v.Float()
+			return f == math.Trunc(f) && f >= math.MinInt64 && f < math.MaxInt64 && !reflect.Zero(t).OverflowInt(int64(f))
+		}
+		return false
+	case reflect.Float32, reflect.Float64:
+		switch v.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			return v.Int() >= -maxExact && v.Int() <= maxExact
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			return v.Uint() <= maxExact
+		case reflect.Float32, reflect.Float64:
+			return true
+		}
+		return false
+	case reflect.String:
+		return v.Kind() == reflect.String || (v.Kind() == reflect.Slice && v.Type().Elem().Kind() == reflect.Uint8)
+	}
+	return v.Kind() == t.Kind()
+}
+
 func (a Attribute) String() string {
 	s := a.name + " (" + a.typeName
 	if a.autoIncrement {
@@ -95,11 +337,17 @@ func (a Attribute) String() string {
 	if a.unique {
 		s = s + " unique"
 	}
+	if a.notNull {
+		s = s + " not null"
+	}
 	s = s + ")"
 	return s
 }
 
 func typeInstanceFromName(name string) reflect.Type {
+	if _, ok := ArrayElemType(name); ok {
+		return reflect.TypeOf(Array{})
+	}
 	switch strings.ToLower(name) {
 	case "serial", "bigserial", "int", "bigint":
 		var v int64
@@ -120,12 +368,19 @@ func typeInstanceFromName(name string) reflect.Type {
 }
 
 func ToInstance(value, typeName string) (any, error) {
-	if value == "now()" || value == "current_timestamp" {
+	switch value {
+	case "now()", "current_timestamp", "localtimestamp":
 		return time.Now(), nil
+	case "current_date":
+		now := time.Now()
+		return time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location()), nil
 	}
 	if value == "null" {
 		return nil, nil
 	}
+	if elemType, ok := ArrayElemType(typeName); ok {
+		return ParseArray(value, elemType)
+	}
 
 	switch strings.ToLower(typeName) {
 	case "serial", "bigserial":
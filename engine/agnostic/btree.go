@@ -0,0 +1,472 @@
+package agnostic
+
+import (
+	"container/list"
+	"fmt"
+	"unsafe"
+)
+
+// btreeDegree is the minimum degree of BTreeIndex nodes. Each node but the root
+// holds between btreeDegree-1 and 2*btreeDegree-1 items.
+const btreeDegree = 16
+
+// BTreeIndex is an ordered index over relation rows.
+//
+// Rows are ordered by the indexed attributes values, then by row address so
+// rows with the same key can coexist in the tree. Contrary to HashIndex, a
+// BTreeIndex can be used as source for range predicates (<, <=, >, >=) on its
+// first attribute, and to produce rows sorted on this attribute.
+type BTreeIndex struct {
+	name      string
+	relName   string
+	relAttrs  []string
+	attrs     []int
+	attrsName []string
+	unique    bool
+	root      *btreeNode
+}
+
+type btreeItem struct {
+	key []any
+	e   *list.Element
+}
+
+type btreeNode struct {
+	items    []btreeItem
+	children []*btreeNode
+}
+
+// btreeBound is a lower or upper limit on first key value of a range scan
+type btreeBound struct {
+	v         any
+	inclusive bool
+}
+
+func NewBTreeIndex(name string, relName string, relAttrs []Attribute, attrsName []string, attrs []int, unique bool) *BTreeIndex {
+	b := &BTreeIndex{
+		name:      name,
+		relName:   relName,
+		attrs:     attrs,
+		attrsName: attrsName,
+		unique:    unique,
+		root:      &btreeNode{},
+	}
+	for _, a := range relAttrs {
+		b.relAttrs = append(b.relAttrs, a.name)
+	}
+	return b
+}
+
+func (b *BTreeIndex) Name() string {
+	return b.name
+}
+
+// Unique returns true if index does not accept several rows with the same key
+func (b *BTreeIndex) Unique() bool {
+	return b.unique
+}
+
+func (b *BTreeIndex) String() string {
+	return b.Name()
+}
+
+func (b *BTreeIndex) key(e *list.Element) []any {
+	t := e.Value.(*Tuple)
+	values := make([]any, len(b.attrs))
+	for i, idx := range b.attrs {
+		values[i] = t.values[idx]
+	}
+	return values
+}
+
+func (b *BTreeIndex) Add(e *list.Element) {
+	it := btreeItem{key: b.key(e), e: e}
+
+	if len(b.root.items) == 2*btreeDegree-1 {
+		old := b.root
+		b.root = &btreeNode{children: []*btreeNode{old}}
+		b.root.split(0)
+	}
+	b.root.insert(it)
+}
+
+func (b *BTreeIndex) Remove(e *list.Element) {
+	b.root.remove(btreeItem{key: b.key(e), e: e})
+
+	if len(b.root.items) == 0 && len(b.root.children) > 0 {
+		b.root = b.root.children[0]
+	}
+}
+
+// Get returns the first row indexed with given values, or nil if there is none
+func (b *BTreeIndex) Get(values []any) (*list.Element, error) {
+	var res *list.Element
+	b.root.ascend(values, func(it btreeItem) bool {
+		if compareKeys(it.key, values) != 0 {
+			return false
+		}
+		res = it.e
+		return false
+	})
+	return res, nil
+}
+
+// Range returns rows whose first key value is between lo and hi, in ascending order.
+// A nil bound means the range is not limited on this side.
+func (b *BTreeIndex) Range(lo, hi *btreeBound) []*list.Element {
+	var res []*list.Element
+	var from []any
+	if lo != nil {
+		from = []any{lo.v}
+	}
+
+	b.root.ascend(from, func(it btreeItem) bool {
+		if lo != nil && !lo.inclusive && compare(it.key[0], lo.v) == 0 {
+			return true
+		}
+		if hi != nil {
+			c := compare(it.key[0], hi.v)
+			if c > 0 || (c == 0 && !hi.inclusive) {
+				return false
+			}
+		}
+		res = append(res, it.e)
+		return true
+	})
+	return res
+}
+
+func (b *BTreeIndex) Truncate() {
+	b.root = &btreeNode{}
+}
+
+// clone returns an empty index with the same definition
+func (b *BTreeIndex) clone() *BTreeIndex {
+	return &BTreeIndex{
+		name:      b.name,
+		relName:   b.relName,
+		relAttrs:  append([]string(nil), b.relAttrs...),
+		attrs:     append([]int(nil), b.attrs...),
+		attrsName: append([]string(nil), b.attrsName...),
+		unique:    b.unique,
+		root:      &btreeNode{},
+	}
+}
+
+func (b *BTreeIndex) CanSourceWith(p Predicate) (bool, int64) {
+	_, _, ok := b.bounds(p)
+	if !ok {
+		return false, 0
+	}
+
+	// prefer HashIndex on equality
+	if p.Type() == Eq {
+		return true, 2
+	}
+	return true, 3
+}
+
+// orders returns true if index rows are sorted by given attribute
+func (b *BTreeIndex) orders(attr string) bool {
+	return b.attrsName[0] == attr || b.relName+"."+b.attrsName[0] == attr
+}
+
+// bounds returns the limits put by comparison predicate p on index first attribute
+func (b *BTreeIndex) bounds(p Predicate) (lo *btreeBound, hi *btreeBound, ok bool) {
+	var left, right ValueFunctor
+	switch p := p.(type) {
+	case *EqPredicate:
+		left, right = p.left, p.right
+	case *GeqPredicate:
+		left, right = p.left, p.right
+	case *GePredicate:
+		left, right = p.left, p.right
+	case *LeqPredicate:
+		left, right = p.left, p.right
+	case *LePredicate:
+		left, right = p.left, p.right
+	default:
+		return nil, nil, false
+	}
+
+	t := p.Type()
+	switch {
+	case b.isAttribute(left) && len(right.Attribute()) == 0:
+	case b.isAttribute(right) && len(left.Attribute()) == 0:
+		// constant on the left side, flip comparison
+		left, right = right, left
+		switch t {
+		case Geq:
+			t = Leq
+		case Ge:
+			t = Le
+		case Leq:
+			t = Geq
+		case Le:
+			t = Ge
+		}
+	default:
+		return nil, nil, false
+	}
+
+	v, err := right.Value(nil, nil)
+	if err != nil {
+		return nil, nil, false
+	}
+	switch t {
+	case Eq:
+		return &btreeBound{v: v, inclusive: true}, &btreeBound{v: v, inclusive: true}, true
+	case Geq:
+		return &btreeBound{v: v, inclusive: true}, nil, true
+	case Ge:
+		return &btreeBound{v: v}, nil, true
+	case Leq:
+		return nil, &btreeBound{v: v, inclusive: true}, true
+	case Le:
+		return nil, &btreeBound{v: v}, true
+	}
+
+	return nil, nil, false
+}
+
+func (b *BTreeIndex) isAttribute(f ValueFunctor) bool {
+	if _, ok := f.(*AttributeValueFunctor); !ok {
+		return false
+	}
+	attrs := f.Attribute()
+	return len(attrs) == 1 && (attrs[0] == b.attrsName[0] || attrs[0] == b.relName+"."+b.attrsName[0])
+}
+
+// less orders items by key, then by row address
+func (it btreeItem) less(o btreeItem) bool {
+	if c := compareKeys(it.key, o.key); c != 0 {
+		return c < 0
+	}
+	return uintptr(unsafe.Pointer(it.e)) < uintptr(unsafe.Pointer(o.e))
+}
+
+// find returns the index of the first item not less than it
+func (n *btreeNode) find(it btreeItem) int {
+	lo, hi := 0, len(n.items)
+	for lo < hi {
+		m := (lo + hi) / 2
+		if n.items[m].less(it) {
+			lo = m + 1
+		} else {
+			hi = m
+		}
+	}
+	return lo
+}
+
+func (n *btreeNode) leaf() bool {
+	return len(n.children) == 0
+}
+
+// split moves the upper half of full child i into a new node, and its median item in n
+func (n *btreeNode) split(i int) {
+	c := n.children[i]
+	mid := c.items[btreeDegree-1]
+
+	right := &btreeNode{}
+	right.items = append(right.items, c.items[btreeDegree:]...)
+	if !c.leaf() {
+		right.children = append(right.children, c.children[btreeDegree:]...)
+		c.children = c.children[:btreeDegree]
+	}
+	c.items = c.items[:btreeDegree-1]
+
+	n.items = append(n.items, btreeItem{})
+	copy(n.items[i+1:], n.items[i:])
+	n.items[i] = mid
+
+	n.children = append(n.children, nil)
+	copy(n.children[i+2:], n.children[i+1:])
+	n.children[i+1] = right
+}
+
+func (n *btreeNode) insert(it btreeItem) {
+	i := n.find(it)
+
+	if n.leaf() {
+		n.items = append(n.items, btreeItem{})
+		copy(n.items[i+1:], n.items[i:])
+		n.items[i] = it
+		return
+	}
+
+	if len(n.children[i].items) == 2*btreeDegree-1 {
+		n.split(i)
+		if n.items[i].less(it) {
+			i++
+		}
+	}
+	n.children[i].insert(it)
+}
+
+func (n *btreeNode) remove(it btreeItem) bool {
+	i := n.find(it)
+	found := i < len(n.items) && n.items[i].e == it.e
+
+	if n.leaf() {
+		if !found {
+			return false
+		}
+		n.items = append(n.items[:i], n.items[i+1:]...)
+		return true
+	}
+
+	if found {
+		switch {
+		case len(n.children[i].items) >= btreeDegree:
+			pred := n.children[i].max()
+			n.items[i] = pred
+			return n.children[i].remove(pred)
+		case len(n.children[i+1].items) >= btreeDegree:
+			succ := n.children[i+1].min()
+			n.items[i] = succ
+			return n.children[i+1].remove(succ)
+		default:
+			n.merge(i)
+			return n.children[i].remove(it)
+		}
+	}
+
+	// make sure the child we descend into can lose an item
+	if len(n.children[i].items) < btreeDegree {
+		switch {
+		case i > 0 && len(n.children[i-1].items) >= btreeDegree:
+			n.rotateRight(i)
+		case i < len(n.children)-1 && len(n.children[i+1].items) >= btreeDegree:
+			n.rotateLeft(i)
+		case i < len(n.children)-1:
+			n.merge(i)
+		default:
+			n.merge(i - 1)
+			i--
+		}
+	}
+	return n.children[i].remove(it)
+}
+
+// rotateRight moves an item from child i-1 to child i through n
+func (n *btreeNode) rotateRight(i int) {
+	c, left := n.children[i], n.children[i-1]
+
+	c.items = append([]btreeItem{n.items[i-1]}, c.items...)
+	n.items[i-1] = left.items[len(left.items)-1]
+	left.items = left.items[:len(left.items)-1]
+
+	if !left.leaf() {
+		c.children = append([]*btreeNode{left.children[len(left.children)-1]}, c.children...)
+		left.children = left.children[:len(left.children)-1]
+	}
+}
+
+// rotateLeft moves an item from child i+1 to child i through n
+func (n *btreeNode) rotateLeft(i int) {
+	c, right := n.children[i], n.children[i+1]
+
+	c.items = append(c.items, n.items[i])
+	n.items[i] = right.items[0]
+	right.items = right.items[1:]
+
+	if !right.leaf() {
+		c.children = append(c.children, right.children[0])
+		right.children = right.children[1:]
+	}
+}
+
+// merge joins child i, item i and child i+1 into child i
+func (n *btreeNode) merge(i int) {
+	left, right := n.children[i], n.children[i+1]
+
+	left.items = append(left.items, n.items[i])
+	left.items = append(left.items, right.items...)
+	left.children = append(left.children, right.children...)
+
+	n.items = append(n.items[:i], n.items[i+1:]...)
+	n.children = append(n.children[:i+1], n.children[i+2:]...)
+}
+
+func (n *btreeNode) min() btreeItem {
+	for !n.leaf() {
+		n = n.children[0]
+	}
+	return n.items[0]
+}
+
+func (n *btreeNode) max() btreeItem {
+	for !n.leaf() {
+		n = n.children[len(n.children)-1]
+	}
+	return n.items[len(n.items)-1]
+}
+
+// ascend calls fn on each item whose key is not less than from, in order,
+// until fn returns false. A nil from starts with the smallest item.
+func (n *btreeNode) ascend(from []any, fn func(btreeItem) bool) bool {
+	i := 0
+	if from != nil {
+		lo, hi := 0, len(n.items)
+		for lo < hi {
+			m := (lo + hi) / 2
+			if compareKeys(n.items[m].key, from) < 0 {
+				lo = m + 1
+			} else {
+				hi = m
+			}
+		}
+		i = lo
+	}
+
+	for ; i < len(n.items); i++ {
+		if !n.leaf() && !n.children[i].ascend(from, fn) {
+			return false
+		}
+		if !fn(n.items[i]) {
+			return false
+		}
+	}
+	if !n.leaf() {
+		return n.children[len(n.items)].ascend(from, fn)
+	}
+	return true
+}
+
+// compareKeys compares keys value by value. If from is shorter than k,
+// only the first len(from) values are compared.
+func compareKeys(k, from []any) int {
+	for i := 0; i < len(k) && i < len(from); i++ {
+		if c := compare(k[i], from[i]); c != 0 {
+			return c
+		}
+	}
+	return 0
+}
+
+// compare returns -1, 0 or 1 if a is respectively less than, equal to or greater than b.
+//
+// NULL is less than any value. Values which cannot be compared by value
+// are compared by their string representation.
+func compare(a, b any) int {
+	eq, err := equal(a, b)
+	if err == nil && eq {
+		return 0
+	}
+	gt, gerr := greater(a, b)
+	if err != nil || gerr != nil {
+		sa, sb := fmt.Sprintf("%v", a), fmt.Sprintf("%v", b)
+		switch {
+		case sa < sb:
+			return -1
+		case sa > sb:
+			return 1
+		}
+		return 0
+	}
+	if gt {
+		return 1
+	}
+	return -1
+}
@@ -0,0 +1,322 @@
+package agnostic
+
+import (
+	"container/list"
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// castFuncs converts a non NULL value to a type, by type name.
+var castFuncs = map[string]func(any) (any, error){
+	"int":         castInt,
+	"integer":     castInt,
+	"smallint":    castInt,
+	"bigint":      castInt,
+	"int2":        castInt,
+	"int4":        castInt,
+	"int8":        castInt,
+	"serial":      castInt,
+	"bigserial":   castInt,
+	"float":       castFloat,
+	"float4":      castFloat,
+	"float8":      castFloat,
+	"real":        castFloat,
+	"double":      castFloat,
+	"decimal":     castFloat,
+	"numeric":     castFloat,
+	"text":        castText,
+	"varchar":     castText,
+	"char":        castText,
+	"character":   castText,
+	"bool":        castBool,
+	"boolean":     castBool,
+	"date":        castDate,
+	"timestamp":   castTimestamp,
+	"timestamptz": castTimestamp,
+	"interval":    castInterval,
+}
+
+// Cast converts v to type typeName. Unlike implicit conversions, a value which
+// cannot be represented in target type, like 'abc' as INT, is an error.
+// NULL is NULL in every type.
+func Cast(v any, typeName string) (any, error) {
+	f, ok := castFunc(typeName)
+	if !ok {
+		return nil, fmt.Errorf("type %s does not exist", typeName)
+	}
+	if v == nil {
+		return nil, nil
+	}
+
+	res, err := f(v)
+	if err != nil {
+		return nil, fmt.Errorf("cannot cast %v to %s: %w", v, strings.ToUpper(typeName), err)
+	}
+	return res, nil
+}
+
+// castFunc returns the function converting values to type typeName, which
+// may be an array type like text[]
+func castFunc(typeName string) (func(any) (any, error), bool) {
+	elemType, ok := ArrayElemType(typeName)
+	if !ok {
+		f, ok := castFuncs[strings.ToLower(typeName)]
+		return f, ok
+	}
+	if _, ok := castFuncs[strings.ToLower(elemType)]; !ok {
+		return nil, false
+	}
+	return func(v any) (any, error) {
+		return toArray(v, elemType)
+	}, true
+}
+
+func castInt(v any) (any, error) {
+	r := reflect.ValueOf(v)
+	switch {
+	case r.CanInt():
+		return r.Int(), nil
+	case r.CanUint():
+		if r.Uint() > math.MaxInt64 {
+			return nil, fmt.Errorf("out of range")
+		}
+		return int64(r.Uint()), nil
+	case r.CanFloat():
+		f := math.Round(r.Float())
+		if math.IsNaN(f) || f > math.MaxInt64 || f < math.MinInt64 {
+			return nil, fmt.Errorf("out of range")
+		}
+		return int64(f), nil
+	}
+
+	switch v := v.(type) {
+	case string:
+		i, err := strconv.ParseInt(strings.TrimSpace(v), 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid integer")
+		}
+		return i, nil
+	case bool:
+		if v {
+			return int64(1), nil
+		}
+		return int64(0), nil
+	}
+
+	return nil, fmt.Errorf("unsupported type %T", v)
+}
+
+func castFloat(v any) (any, error) {
+	r := reflect.ValueOf(v)
+	switch {
+	case r.CanInt():
+		return float64(r.Int()), nil
+	case r.CanUint():
+		return float64(r.Uint()), nil
+	case r.CanFloat():
+		return r.Float(), nil
+	}
+
+	if s, ok := v.(string); ok {
+		f, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid number")
+		}
+		return f, nil
+	}
+
+	return nil, fmt.Errorf("unsupported type %T", v)
+}
+
+func castText(v any) (any, error) {
+	switch v := v.(type) {
+	case string:
+		return v, nil
+	case []byte:
+		return string(v), nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	case time.Time:
+		return v.Format(time.RFC3339Nano), nil
+	case Interval:
+		return v.String(), nil
+	case Array:
+		return v.String(), nil
+	}
+
+	r := reflect.ValueOf(v)
+	switch {
+	case r.CanInt():
+		return strconv.FormatInt(r.Int(), 10), nil
+	case r.CanUint():
+		return strconv.FormatUint(r.Uint(), 10), nil
+	case r.CanFloat():
+		return strconv.FormatFloat(r.Float(), 'f', -1, 64), nil
+	}
+
+	return nil, fmt.Errorf("unsupported type %T", v)
+}
+
+func castBool(v any) (any, error) {
+	switch v := v.(type) {
+	case bool:
+		return v, nil
+	case string:
+		switch strings.ToLower(strings.TrimSpace(v)) {
+		case "t", "true", "y", "yes", "on", "1":
+			return true, nil
+		case "f", "false", "n", "no", "off", "0":
+			return false, nil
+		}
+		return nil, fmt.Errorf("invalid boolean")
+	}
+
+	r := reflect.ValueOf(v)
+	switch {
+	case r.CanInt():
+		return r.Int() != 0, nil
+	case r.CanUint():
+		return r.Uint() != 0, nil
+	}
+
+	return nil, fmt.Errorf("unsupported type %T", v)
+}
+
+func castDate(v any) (any, error) {
+	t, err := castTimestamp(v)
+	if err != nil {
+		return nil, err
+	}
+
+	d := t.(time.Time)
+	return time.Date(d.Year(), d.Month(), d.Day(), 0, 0, 0, 0, d.Location()), nil
+}
+
+func castTimestamp(v any) (any, error) {
+	switch v := v.(type) {
+	case time.Time:
+		return v, nil
+	case string:
+		t, err := parseDate(strings.TrimSpace(v))
+		if err != nil {
+			return nil, fmt.Errorf("invalid date")
+		}
+		return t, nil
+	}
+
+	return nil, fmt.Errorf("unsupported type %T", v)
+}
+
+func castInterval(v any) (any, error) {
+	switch v := v.(type) {
+	case Interval:
+		return v, nil
+	case string:
+		return ParseInterval(v)
+	}
+
+	return nil, fmt.Errorf("unsupported type %T", v)
+}
+
+// CastValueFunctor converts the value returned by another ValueFunctor, like
+// CAST(user_id AS TEXT) in a predicate.
+type CastValueFunctor struct {
+	src      ValueFunctor
+	typeName string
+}
+
+// NewCastValueFunctor creates a ValueFunctor converting values of src to type typeName
+func NewCastValueFunctor(src ValueFunctor, typeName string) (ValueFunctor, error) {
+	if _, ok := castFunc(typeName); !ok {
+		return nil, fmt.Errorf("type %s does not exist", typeName)
+	}
+
+	f := &CastValueFunctor{
+		src:      src,
+		typeName: typeName,
+	}
+	return f, nil
+}
+
+func (f *CastValueFunctor) Value(cols []string, t *Tuple) (any, error) {
+	v, err := f.src.Value(cols, t)
+	if err != nil {
+		return nil, err
+	}
+
+	return Cast(v, f.typeName)
+}
+
+func (f *CastValueFunctor) Relation() string {
+	return f.src.Relation()
+}
+
+func (f *CastValueFunctor) Attribute() []string {
+	return f.src.Attribute()
+}
+
+func (f CastValueFunctor) String() string {
+	return fmt.Sprintf("CAST(%s AS %s)", f.src, strings.ToUpper(f.typeName))
+}
+
+// CastSelector converts values returned by another Selector, like
+// SELECT CAST(user_id AS TEXT).
+type CastSelector struct {
+	src      Selector
+	typeName string
+}
+
+func NewCastSelector(src Selector, typeName string) (*CastSelector, error) {
+	if _, ok := castFunc(typeName); !ok {
+		return nil, fmt.Errorf("type %s does not exist", typeName)
+	}
+
+	s := &CastSelector{
+		src:      src,
+		typeName: typeName,
+	}
+	return s, nil
+}
+
+func (s *CastSelector) Attribute() []string {
+	return s.src.Attribute()
+}
+
+func (s *CastSelector) Relation() string {
+	return s.src.Relation()
+}
+
+func (s *CastSelector) Alias() string {
+	return s.src.Alias()
+}
+
+func (s *CastSelector) Select(cols []string, in []*list.Element) ([]*Tuple, error) {
+	res, err := s.src.Select(cols, in)
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]*Tuple, len(res))
+	for i, t := range res {
+		c := getTuple(len(t.values))
+		for _, v := range t.values {
+			cv, err := Cast(v, s.typeName)
+			if err != nil {
+				return nil, err
+			}
+			c.values = append(c.values, cv)
+		}
+		putTuple(t)
+		out[i] = c
+	}
+
+	return out, nil
+}
+
+func (s CastSelector) String() string {
+	return fmt.Sprintf("CAST(%s AS %s)", s.src, strings.ToUpper(s.typeName))
+}
@@ -4,10 +4,17 @@ import (
 	"container/list"
 )
 
+// ValueChange records a row modification in relation rows list l.
+//
+//   - insert: current is the inserted row, old is nil
+//   - delete: current is nil, old is the removed row and prev the row it followed
+//   - update: current is the updated row, old holds its previous tuple
 type ValueChange struct {
-	current *list.Element
-	old     *list.Element
-	l       *list.List
+	current  *list.Element
+	old      *list.Element
+	prev     *list.Element
+	l        *list.List
+	relation *Relation
 }
 
 type RelationChange struct {
@@ -16,31 +23,118 @@ type RelationChange struct {
 	old     *Relation
 }
 
+type IndexChange struct {
+	relation *Relation
+	current  Index
+	old      Index
+}
+
+type SequenceChange struct {
+	schema  *Schema
+	current *Sequence
+	old     *Sequence
+}
+
+type EnumChange struct {
+	schema  *Schema
+	current *Enum
+	old     *Enum
+}
+
+type DomainChange struct {
+	schema  *Schema
+	current *Domain
+	old     *Domain
+}
+
+// AttributeChange records an attribute added to or dropped from relation.
+//
+//   - add: current is the added attribute, old is nil
+//   - drop: current is nil, old is the dropped attribute, pos its position,
+//     values maps rows to their dropped value and indexes holds the indexes
+//     dropped with attribute
+type AttributeChange struct {
+	relation *Relation
+	current  *Attribute
+	old      *Attribute
+	pos      int
+	values   map[*list.Element]any
+	indexes  []Index
+}
+
+// RenameChange records a relation renamed from old to current, or one of
+// its attributes if attribute is set.
+type RenameChange struct {
+	schema    *Schema
+	relation  *Relation
+	attribute bool
+	current   string
+	old       string
+}
+
+// ForeignKeyChange records the foreign key of relation attribute dropped
+// along with the relation it referenced.
+type ForeignKeyChange struct {
+	relation  *Relation
+	attribute string
+	old       *ForeignKey
+}
+
+// TruncateChange records the rows removed from relation by a truncate, and
+// auto-increment counters of its attributes if they restarted.
+type TruncateChange struct {
+	relation   *Relation
+	rows       *list.List
+	nextValues []uint64
+}
+
 type SchemaChange struct {
 	current *Schema
 	old     *Schema
 	e       *Engine
 }
 
-func (t *Transaction) rollbackValueChange(c ValueChange) {
+// rollbackValueChange reverts c. Rows re-inserted when reverting a delete get
+// a new list element, restored maps removed elements to their new element so
+// older changes on the same row can be reverted too, even by a later rollback.
+func (t *Transaction) rollbackValueChange(c ValueChange, restored map[*list.Element]*list.Element) {
+	for e, ok := restored[c.current]; ok; e, ok = restored[c.current] {
+		c.current = e
+	}
 
 	// revert insert
 	if c.current != nil && c.old == nil {
+		for _, i := range c.relation.indexes {
+			i.Remove(c.current)
+		}
 		c.l.Remove(c.current)
 	}
 
 	// revert delete
 	if c.current == nil && c.old != nil {
-		old := c.old.Value.(*Tuple)
-		c.l.InsertAfter(old, c.old.Prev())
+		var e *list.Element
+		for p, ok := restored[c.prev]; ok; p, ok = restored[c.prev] {
+			c.prev = p
+		}
+		if c.prev == nil {
+			e = c.l.PushFront(c.old.Value)
+		} else {
+			e = c.l.InsertAfter(c.old.Value, c.prev)
+		}
+		restored[c.old] = e
+		for _, i := range c.relation.indexes {
+			i.Add(e)
+		}
 	}
 
 	// revert update
 	if c.current != nil && c.old != nil {
-		cur := c.current.Value.(*Tuple)
-		old := c.old.Value.(*Tuple)
-		for i := range cur.values {
-			cur.values[i] = old.values[i]
+		for _, i := range c.relation.indexes {
+			i.Remove(c.current)
+		}
+		c.current.Value = c.old.Value
+		for _, i := range c.relation.indexes {
+			i.Add(c.current)
 		}
 	}
 }
@@ -64,6 +158,9 @@ func (t *Transaction) rollbackRelationChange(c RelationChange) {
 }
 
 func (t *Transaction) rollbackSchemaChange(c SchemaChange) {
+	c.e.Lock()
+	defer c.e.Unlock()
+
 	// revert schema creation
 	if c.current != nil && c.old == nil {
 		delete(c.e.schemas, c.current.name)
@@ -74,3 +171,110 @@ func (t *Transaction) rollbackSchemaChange(c SchemaChange) {
 		c.e.schemas[c.old.name] = c.old
 	}
 }
+
+func (t *Transaction) rollbackSequenceChange(c SequenceChange) {
+	// revert sequence creation
+	if c.current != nil && c.old == nil {
+		c.schema.RemoveSequence(c.current.name)
+	}
+
+	// revert sequence drop
+	if c.current == nil && c.old != nil {
+		c.schema.AddSequence(c.old.name, c.old)
+	}
+}
+
+func (t *Transaction) rollbackEnumChange(c EnumChange) {
+	// revert enum creation
+	if c.current != nil && c.old == nil {
+		c.schema.RemoveEnum(c.current.name)
+	}
+
+	// revert enum drop
+	if c.current == nil && c.old != nil {
+		c.schema.AddEnum(c.old.name, c.old)
+	}
+}
+
+func (t *Transaction) rollbackDomainChange(c DomainChange) {
+	// revert domain creation
+	if c.current != nil && c.old == nil {
+		c.schema.RemoveDomain(c.current.name)
+	}
+
+	// revert domain drop
+	if c.current == nil && c.old != nil {
+		c.schema.AddDomain(c.old.name, c.old)
+	}
+}
+
+func (t *Transaction) rollbackIndexChange(c IndexChange) {
+	// revert index creation
+	if c.current != nil && c.old == nil {
+		if i, _ := c.relation.index(c.current.Name()); i >= 0 {
+			c.relation.indexes = append(c.relation.indexes[:i], c.relation.indexes[i+1:]...)
+		}
+	}
+
+	// revert index drop
+	if c.current == nil && c.old != nil {
+		c.relation.indexes = append(c.relation.indexes, c.old)
+	}
+}
+
+func (t *Transaction) rollbackAttributeChange(c AttributeChange, restored map[*list.Element]*list.Element) {
+	// revert attribute addition
+	if c.current != nil && c.old == nil {
+		c.relation.removeAttribute(c.current.name)
+	}
+
+	// revert attribute drop, rows deleted since then are now new elements
+	if c.current == nil && c.old != nil {
+		values := make(map[*list.Element]any, len(c.values))
+		for e, v := range c.values {
+			for n, ok := restored[e]; ok; n, ok = restored[e] {
+				e = n
+			}
+			values[e] = v
+		}
+		c.relation.restoreAttribute(*c.old, c.pos, values, c.indexes)
+	}
+}
+
+func (t *Transaction) rollbackRenameChange(c RenameChange) {
+	// revert attribute rename
+	if c.attribute {
+		t.renameAttribute(c.schema, c.relation, c.current, c.old)
+		return
+	}
+
+	// revert relation rename
+	t.renameRelation(c.schema, c.relation, c.old)
+}
+
+func (t *Transaction) rollbackTruncateChange(c TruncateChange) {
+	r := c.relation
+	r.rows = c.rows
+
+	for _, i := range r.indexes {
+		i.Truncate()
+		for e := r.rows.Front(); e != nil; e = e.Next() {
+			i.Add(e)
+		}
+	}
+
+	if c.nextValues != nil {
+		for i := range r.attributes {
+			r.attributes[i].nextValue = c.nextValues[i]
+		}
+	}
+}
+
+func (t *Transaction) rollbackForeignKeyChange(c ForeignKeyChange) {
+	for i := range c.relation.attributes {
+		if c.relation.attributes[i].name == c.attribute {
+			c.relation.attributes[i].fk = c.old
+			return
+		}
+	}
+}
@@ -0,0 +1,151 @@
+package agnostic
+
+import (
+	"container/list"
+	"fmt"
+)
+
+// Clone returns an independent deep copy of every schema, sequence, relation,
+// row and index of engine.
+//
+// As with Dump, each relation is read locked while copied, so Clone waits for
+// transactions modifying it to end, and the copy is consistent relation by
+// relation. Clone must not be called from a goroutine holding an open
+// transaction.
+func (e *Engine) Clone() (*Engine, error) {
+	schemas, err := e.cloneSchemas()
+	if err != nil {
+		return nil, err
+	}
+
+	return &Engine{schemas: schemas}, nil
+}
+
+// Replace replaces every schema of engine with a deep copy of the schemas of
+// src. Transactions open during Replace keep working on the replaced
+// relations, their changes are lost.
+func (e *Engine) Replace(src *Engine) error {
+	schemas, err := src.cloneSchemas()
+	if err != nil {
+		return err
+	}
+
+	e.Lock()
+	defer e.Unlock()
+
+	e.schemas = schemas
+	return e.log()
+}
+
+func (e *Engine) cloneSchemas() (map[string]*Schema, error) {
+	e.Lock()
+	src := make([]*Schema, 0, len(e.schemas))
+	for _, s := range e.schemas {
+		src = append(src, s)
+	}
+	e.Unlock()
+
+	schemas := make(map[string]*Schema, len(src))
+	for _, s := range src {
+		c, err := s.clone()
+		if err != nil {
+			return nil, err
+		}
+		schemas[s.name] = c
+	}
+
+	return schemas, nil
+}
+
+func (s *Schema) clone() (*Schema, error) {
+	s.RLock()
+	relations := make(map[string]*Relation, len(s.relations))
+	for name, r := range s.relations {
+		relations[name] = r
+	}
+	sequences := make(map[string]*Sequence, len(s.sequences))
+	for name, seq := range s.sequences {
+		sequences[name] = seq
+	}
+	c := NewSchema(s.name)
+	// enums and domains are never modified, they are shared
+	for name, e := range s.enums {
+		c.enums[name] = e
+	}
+	for name, d := range s.domains {
+		c.domains[name] = d
+	}
+	s.RUnlock()
+
+	for name, seq := range sequences {
+		c.sequences[name] = seq.clone()
+	}
+	for name, r := range relations {
+		rc, err := r.clone()
+		if err != nil {
+			return nil, err
+		}
+		c.relations[name] = rc
+	}
+
+	return c, nil
+}
+
+func (seq *Sequence) clone() *Sequence {
+	seq.Lock()
+	defer seq.Unlock()
+
+	return &Sequence{
+		name:      seq.name,
+		start:     seq.start,
+		increment: seq.increment,
+		value:     seq.value,
+		called:    seq.called,
+	}
+}
+
+// clone copies relation rows and rebuilds its indexes on the copied rows.
+// Tuple values are shared, as they are never modified in place.
+func (r *Relation) clone() (*Relation, error) {
+	r.RLock()
+	defer r.RUnlock()
+
+	c := &Relation{
+		name:       r.name,
+		schema:     r.schema,
+		attributes: make([]Attribute, len(r.attributes)),
+		attrIndex:  make(map[string]int, len(r.attrIndex)),
+		pk:         make([]int, len(r.pk)),
+		rows:       list.New(),
+		indexes:    make([]Index, len(r.indexes)),
+		stats:      r.stats,
+	}
+	copy(c.attributes, r.attributes)
+	copy(c.pk, r.pk)
+	for name, i := range r.attrIndex {
+		c.attrIndex[name] = i
+	}
+
+	for i, index := range r.indexes {
+		switch index := index.(type) {
+		case *HashIndex:
+			c.indexes[i] = index.clone()
+		case *BTreeIndex:
+			c.indexes[i] = index.clone()
+		default:
+			return nil, fmt.Errorf("cannot copy index %s of relation %s", index.Name(), r.name)
+		}
+	}
+
+	for e := r.rows.Front(); e != nil; e = e.Next() {
+		t := e.Value.(*Tuple)
+		values := make([]any, len(t.values))
+		copy(values, t.values)
+		ce := c.rows.PushBack(&Tuple{values: values, version: t.version})
+		for _, index := range c.indexes {
+			index.Add(ce)
+		}
+	}
+
+	return c, nil
+}
@@ -0,0 +1,228 @@
+package agnostic
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"golang.org/x/text/collate"
+	"golang.org/x/text/language"
+)
+
+// Collation orders and compares strings. Without collation, strings are
+// compared byte by byte.
+type Collation struct {
+	name string
+	// bytewise collations compare strings as without collation
+	bytewise bool
+	compare  func(a, b string) int
+}
+
+// NewCollation returns the collation called name:
+//   - "default", "C" and "POSIX" compare strings byte by byte
+//   - "nocase" compares strings byte by byte once case is folded
+//   - a locale, like "en_US", "en-US" or "fr_FR.utf8", orders strings as
+//     in its language
+func NewCollation(name string) (*Collation, error) {
+	switch strings.ToLower(name) {
+	case "default", "c", "posix", "ucs_basic":
+		return &Collation{name: name, bytewise: true, compare: strings.Compare}, nil
+	case "nocase":
+		return &Collation{name: name, compare: func(a, b string) int {
+			return strings.Compare(strings.ToLower(a), strings.ToLower(b))
+		}}, nil
+	}
+
+	// en_US.utf8 and en-US-x-icu name the en-US locale
+	locale, _, _ := strings.Cut(name, ".")
+	locale = strings.TrimSuffix(strings.ReplaceAll(locale, "_", "-"), "-x-icu")
+	tag, err := language.Parse(locale)
+	if err != nil {
+		return nil, undefinedCollation(name)
+	}
+	if _, _, conf := language.NewMatcher(collate.Supported()).Match(tag); conf == language.No {
+		return nil, undefinedCollation(name)
+	}
+
+	// a collator cannot be used concurrently
+	var mu sync.Mutex
+	c := collate.New(tag)
+	return &Collation{name: name, compare: func(a, b string) int {
+		mu.Lock()
+		defer mu.Unlock()
+		if r := c.CompareString(a, b); r != 0 {
+			return r
+		}
+		// strings equal for the locale still have a deterministic order
+		return strings.Compare(a, b)
+	}}, nil
+}
+
+func undefinedCollation(name string) error {
+	return NewError(UndefinedObject, "collation \"%s\" for encoding \"UTF8\" does not exist", name)
+}
+
+// Name returns the name collation was created with
+func (c *Collation) Name() string {
+	return c.name
+}
+
+// Compare returns -1, 0 or 1 if a is before, equal to or after b
+func (c *Collation) Compare(a, b string) int {
+	return c.compare(a, b)
+}
+
+func (c Collation) String() string {
+	return fmt.Sprintf("%q", c.name)
+}
+
+// collate returns the result of comparing vl and vr with collation c, and
+// true, if c is not bytewise and both values are strings
+func (c *Collation) collate(vl, vr any) (int, bool) {
+	if c == nil || c.bytewise {
+		return 0, false
+	}
+	l, lok := vl.(string)
+	r, rok := vr.(string)
+	if !lok || !rok {
+		return 0, false
+	}
+	return c.compare(l, r), true
+}
+
+// collatedGreater returns true if vl is greater than vr, comparing strings
+// with collation c
+func collatedGreater(c *Collation, vl, vr any) (bool, error) {
+	if vl != nil && vr != nil {
+		if n, ok := c.collate(vl, vr); ok {
+			return n > 0, nil
+		}
+	}
+	return greater(vl, vr)
+}
+
+// CollateValueFunctor returns the values of another ValueFunctor, compared
+// with a collation. Collation is explicit with a COLLATE clause, like
+// name COLLATE nocase, implicit when it is the collation of an attribute.
+type CollateValueFunctor struct {
+	src       ValueFunctor
+	collation *Collation
+	explicit  bool
+}
+
+func NewCollateValueFunctor(src ValueFunctor, c *Collation, explicit bool) *CollateValueFunctor {
+	return &CollateValueFunctor{src: src, collation: c, explicit: explicit}
+}
+
+func (f *CollateValueFunctor) Value(cols []string, t *Tuple) (any, error) {
+	return f.src.Value(cols, t)
+}
+
+func (f *CollateValueFunctor) Relation() string {
+	return f.src.Relation()
+}
+
+func (f *CollateValueFunctor) Attribute() []string {
+	return f.src.Attribute()
+}
+
+func (f CollateValueFunctor) String() string {
+	if !f.explicit {
+		return fmt.Sprint(f.src)
+	}
+	return fmt.Sprintf("%s COLLATE %s", f.src, f.collation)
+}
+
+// comparisonCollation returns the collation comparing left and right, and
+// both without collation. An explicit collation wins over an implicit one,
+// left side first, and explicit collations must not differ.
+func comparisonCollation(left, right ValueFunctor) (*Collation, ValueFunctor, ValueFunctor, error) {
+	var explicit, implicit *Collation
+	unwrap := func(f ValueFunctor) (ValueFunctor, error) {
+		cf, ok := f.(*CollateValueFunctor)
+		if !ok {
+			return f, nil
+		}
+		switch {
+		case cf.explicit && explicit != nil && explicit.name != cf.collation.name:
+			return nil, NewError(CollationMismatch, "collation mismatch between explicit collations %s and %s", explicit, cf.collation)
+		case cf.explicit && explicit == nil:
+			explicit = cf.collation
+		case !cf.explicit && implicit == nil:
+			implicit = cf.collation
+		}
+		return cf.src, nil
+	}
+
+	left, err := unwrap(left)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	right, err = unwrap(right)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if explicit != nil {
+		return explicit, left, right, nil
+	}
+	return implicit, left, right, nil
+}
+
+// CollatedPredicate compares strings with a collation, like
+// name = 'zed' COLLATE nocase. Other values are compared as without
+// collation. Indexes, ordered byte by byte, cannot source its rows.
+type CollatedPredicate struct {
+	Predicate
+	left      ValueFunctor
+	right     ValueFunctor
+	collation *Collation
+}
+
+// NewCollatedPredicate returns comparison predicate p comparing strings with
+// collation c
+func NewCollatedPredicate(p Predicate, c *Collation) (*CollatedPredicate, error) {
+	left, right, ok := operands(p)
+	if !ok {
+		return nil, fmt.Errorf("cannot collate %s", p)
+	}
+	return &CollatedPredicate{Predicate: p, left: left, right: right, collation: c}, nil
+}
+
+func (p CollatedPredicate) String() string {
+	return fmt.Sprintf("%s COLLATE %s", p.Predicate, p.collation)
+}
+
+func (p *CollatedPredicate) Eval(cols []string, t *Tuple) (bool, error) {
+	vl, err := p.left.Value(cols, t)
+	if err != nil {
+		return false, err
+	}
+	vr, err := p.right.Value(cols, t)
+	if err != nil {
+		return false, err
+	}
+	// comparison with NULL is unknown
+	if vl == nil || vr == nil {
+		return false, nil
+	}
+
+	c, ok := p.collation.collate(vl, vr)
+	if !ok {
+		return p.Predicate.Eval(cols, t)
+	}
+	switch p.Type() {
+	case Eq:
+		return c == 0, nil
+	case Neq:
+		return c != 0, nil
+	case Le:
+		return c < 0, nil
+	case Leq:
+		return c <= 0, nil
+	case Ge:
+		return c > 0, nil
+	case Geq:
+		return c >= 0, nil
+	}
+	return false, fmt.Errorf("cannot collate %s", p.Predicate)
+}
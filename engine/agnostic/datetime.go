@@ -0,0 +1,101 @@
+package agnostic
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// timeValue returns v as a time, parsing it if it is a string
+func timeValue(v any) (time.Time, error) {
+	switch v := v.(type) {
+	case time.Time:
+		return v, nil
+	case string:
+		return parseDate(v)
+	}
+	return time.Time{}, fmt.Errorf("%v is not a date", v)
+}
+
+// datePartFunc returns a field of a date, like EXTRACT(YEAR FROM ts). Fields
+// are integers, except second and epoch which include fractional seconds.
+func datePartFunc(args []any) (any, error) {
+	field, ok := args[0].(string)
+	if !ok {
+		return nil, fmt.Errorf("field must be a string")
+	}
+	t, err := timeValue(args[1])
+	if err != nil {
+		return nil, err
+	}
+
+	switch strings.ToLower(field) {
+	case "year":
+		return int64(t.Year()), nil
+	case "quarter":
+		return int64(t.Month()-1)/3 + 1, nil
+	case "month":
+		return int64(t.Month()), nil
+	case "week":
+		_, w := t.ISOWeek()
+		return int64(w), nil
+	case "day":
+		return int64(t.Day()), nil
+	case "dow":
+		return int64(t.Weekday()), nil
+	case "isodow":
+		if t.Weekday() == time.Sunday {
+			return int64(7), nil
+		}
+		return int64(t.Weekday()), nil
+	case "doy":
+		return int64(t.YearDay()), nil
+	case "hour":
+		return int64(t.Hour()), nil
+	case "minute":
+		return int64(t.Minute()), nil
+	case "second":
+		return float64(t.Second()) + float64(t.Nanosecond())/1e9, nil
+	case "epoch":
+		return float64(t.UnixNano()) / 1e9, nil
+	}
+
+	return nil, fmt.Errorf("unit \"%s\" not recognized", field)
+}
+
+// dateTruncFunc truncates a date to given precision, zeroing all finer
+// fields, like DATE_TRUNC('month', ts). Weeks start on monday.
+func dateTruncFunc(args []any) (any, error) {
+	unit, ok := args[0].(string)
+	if !ok {
+		return nil, fmt.Errorf("unit must be a string")
+	}
+	t, err := timeValue(args[1])
+	if err != nil {
+		return nil, err
+	}
+
+	y, m, d := t.Date()
+	loc := t.Location()
+	switch strings.ToLower(unit) {
+	case "second":
+		return time.Date(y, m, d, t.Hour(), t.Minute(), t.Second(), 0, loc), nil
+	case "minute":
+		return time.Date(y, m, d, t.Hour(), t.Minute(), 0, 0, loc), nil
+	case "hour":
+		return time.Date(y, m, d, t.Hour(), 0, 0, 0, loc), nil
+	case "day":
+		return time.Date(y, m, d, 0, 0, 0, 0, loc), nil
+	case "week":
+		offset := (int(t.Weekday()) + 6) % 7
+		return time.Date(y, m, d-offset, 0, 0, 0, 0, loc), nil
+	case "month":
+		return time.Date(y, m, 1, 0, 0, 0, 0, loc), nil
+	case "quarter":
+		return time.Date(y, m-(m-1)%3, 1, 0, 0, 0, 0, loc), nil
+	case "year":
+		return time.Date(y, time.January, 1, 0, 0, 0, 0, loc), nil
+	}
+
+	return nil, fmt.Errorf("unit \"%s\" not recognized", unit)
+}
@@ -0,0 +1,131 @@
+package agnostic
+
+import (
+	"fmt"
+)
+
+// Materialize stores rows as a relation readable by the current statement
+// only, like the result of a common table expression. Materialized relation
+// is referenced with an unqualified name and shadows any relation of the same
+// name in default schema.
+//
+// Rows are computed once, however many times the relation is read, until
+// Release is called.
+func (t *Transaction) Materialize(name string, attributes []Attribute, rows []*Tuple) error {
+	if err := t.aborted(); err != nil {
+		return err
+	}
+
+	if _, ok := t.derived[name]; ok {
+		return t.abort(fmt.Errorf("relation %s specified more than once", name))
+	}
+
+	r, err := NewRelation("", name, attributes, nil)
+	if err != nil {
+		return t.abort(err)
+	}
+	for _, row := range rows {
+		if len(row.values) != len(attributes) {
+			return t.abort(fmt.Errorf("relation %s has %d columns but row has %d values", name, len(attributes), len(row.values)))
+		}
+		r.rows.PushBack(row)
+	}
+
+	if t.derived == nil {
+		t.derived = make(map[string]*Relation)
+	}
+	t.derived[name] = r
+	return nil
+}
+
+// maxRecursion is the maximum number of iterations of a recursive relation,
+// so queries on cyclic data eventually fail instead of looping forever.
+const maxRecursion = 1000
+
+// MaterializeRecursive materializes a recursive relation, like the result of a
+// recursive common table expression.
+//
+// Relation starts with seed rows. Then step is called repeatedly, with rows
+// added by previous iteration materialized as the relation, and the rows it
+// returns are added to the relation until none is added. Unless all is true,
+// duplicate rows are discarded, as with UNION.
+func (t *Transaction) MaterializeRecursive(name string, attributes []Attribute, seed []*Tuple, all bool, step func() ([]*Tuple, error)) error {
+	if err := t.aborted(); err != nil {
+		return err
+	}
+
+	if _, ok := t.derived[name]; ok {
+		return t.abort(fmt.Errorf("relation %s specified more than once", name))
+	}
+
+	seen := make(map[string]struct{})
+	add := func(rows []*Tuple) []*Tuple {
+		var added []*Tuple
+		for _, row := range rows {
+			if !all {
+				k := rowKey(row)
+				if _, ok := seen[k]; ok {
+					continue
+				}
+				seen[k] = struct{}{}
+			}
+			added = append(added, row)
+		}
+		return added
+	}
+
+	res := add(seed)
+	working := res
+	for i := 0; len(working) > 0; i++ {
+		if i == maxRecursion {
+			return t.abort(fmt.Errorf("recursive relation %s exceeded %d iterations", name, maxRecursion))
+		}
+
+		if err := t.Materialize(name, attributes, working); err != nil {
+			return err
+		}
+		rows, err := step()
+		delete(t.derived, name)
+		if err != nil {
+			return err
+		}
+
+		working = add(rows)
+		res = append(res, working...)
+	}
+
+	return t.Materialize(name, attributes, res)
+}
+
+// Materialized returns true if a relation called name is materialized by
+// current statement
+func (t *Transaction) Materialized(name string) bool {
+	_, ok := t.derived[name]
+	return ok
+}
+
+// Release drops all relations materialized by current statement
+func (t *Transaction) Release() {
+	t.derived = nil
+}
+
+// withDerived returns a copy of s in which materialized relations shadow
+// relations of the same name.
+func (t *Transaction) withDerived(s *Schema) *Schema {
+	ds := NewSchema(s.name)
+
+	s.RLock()
+	for name, r := range s.relations {
+		ds.relations[name] = r
+	}
+	for name, seq := range s.sequences {
+		ds.sequences[name] = seq
+	}
+	s.RUnlock()
+
+	for name, r := range t.derived {
+		ds.relations[name] = r
+	}
+
+	return ds
+}
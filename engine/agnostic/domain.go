@@ -0,0 +1,147 @@
+package agnostic
+
+import (
+	"fmt"
+	"io"
+	"reflect"
+)
+
+// Domain is a named builtin type whose values may be restricted by a check
+// constraint, like CREATE DOMAIN positive_int AS INT CHECK (VALUE > 0). It is
+// stored in a Schema.
+//
+// Attributes of a domain have the values of its base type, its default value
+// unless they declare one, and are NOT NULL if it is.
+type Domain struct {
+	name         string
+	baseType     string
+	defaultValue any
+	notNull      bool
+	// check is evaluated with the value as attribute "value". checkExpr is
+	// its SQL expression, the predicate being compiled from it by caller.
+	checkExpr string
+	check     Predicate
+}
+
+func NewDomain(name, baseType string) (*Domain, error) {
+	if _, ok := castFunc(baseType); !ok {
+		return nil, undefinedType(baseType)
+	}
+	if _, ok := ArrayElemType(baseType); ok {
+		return nil, fmt.Errorf("domains over array type %s are not supported", baseType)
+	}
+
+	return &Domain{name: name, baseType: baseType}, nil
+}
+
+// WithDefault sets the default value of attributes of domain
+func (d *Domain) WithDefault(v any) *Domain {
+	if v != nil {
+		v = reflect.ValueOf(v).Convert(typeInstanceFromName(d.baseType)).Interface()
+	}
+	d.defaultValue = v
+	return d
+}
+
+// WithNotNull declares domain as NOT NULL
+func (d *Domain) WithNotNull() *Domain {
+	d.notNull = true
+	return d
+}
+
+// WithCheck sets the check constraint of domain, predicate p being compiled
+// from SQL expression expr
+func (d *Domain) WithCheck(expr string, p Predicate) *Domain {
+	d.checkExpr, d.check = expr, p
+	return d
+}
+
+// Name returns the name of domain
+func (d *Domain) Name() string {
+	return d.name
+}
+
+// BaseType returns the builtin type domain is based on
+func (d *Domain) BaseType() string {
+	return d.baseType
+}
+
+// CheckExpr returns the SQL expression of domain check constraint, or an
+// empty string if it has none
+func (d *Domain) CheckExpr() string {
+	return d.checkExpr
+}
+
+// Check returns the compiled check constraint of domain, or nil if it has
+// none or if it was not compiled yet
+func (d *Domain) Check() Predicate {
+	return d.check
+}
+
+// validate returns an error if v, of domain base type, violates its check
+// constraint. Like NULL, a value whose check is unknown is valid.
+func (d *Domain) validate(v any) error {
+	if d.checkExpr == "" {
+		return nil
+	}
+	if d.check == nil {
+		return fmt.Errorf("check constraint of domain %s is not compiled", d.name)
+	}
+
+	cols := []string{"value"}
+	t := NewTuple(v)
+	ok, err := d.check.Eval(cols, t)
+	if err != nil || ok {
+		return err
+	}
+	u, err := unknown(d.check, cols, t)
+	if err != nil || u {
+		return err
+	}
+
+	return NewError(CheckViolation, "value for domain %s violates check constraint \"%s_check\"", d.name, d.name)
+}
+
+func (d *Domain) String() string {
+	return d.name
+}
+
+// dump writes the CREATE DOMAIN statement of domain, called name
+func (d *Domain) dump(w io.Writer, name string) error {
+	stmt := fmt.Sprintf("CREATE DOMAIN %s AS %s", name, d.baseType)
+	if d.defaultValue != nil {
+		stmt += " DEFAULT " + sqlLiteral(d.defaultValue)
+	}
+	if d.notNull {
+		stmt += " NOT NULL"
+	}
+	if d.checkExpr != "" {
+		stmt += " CHECK (" + d.checkExpr + ")"
+	}
+	_, err := fmt.Fprintf(w, "%s;\n", stmt)
+	return err
+}
+
+// state returns the saved state of domain
+func (d *Domain) state() domainState {
+	return domainState{
+		Name:     d.name,
+		BaseType: d.baseType,
+		Default:  d.defaultValue,
+		NotNull:  d.notNull,
+		Check:    d.checkExpr,
+	}
+}
+
+// domain rebuilds domain from saved state. Its check constraint has to be
+// compiled again, see Engine.Domains.
+func (ds domainState) domain() (*Domain, error) {
+	d, err := NewDomain(ds.Name, ds.BaseType)
+	if err != nil {
+		return nil, err
+	}
+	d.defaultValue = ds.Default
+	d.notNull = ds.NotNull
+	d.checkExpr = ds.Check
+	return d, nil
+}
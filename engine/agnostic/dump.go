@@ -0,0 +1,349 @@
+package agnostic
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Dump writes to w the SQL statements rebuilding every schema, sequence,
+// relation, index and row of engine.
+//
+// Relations are created after the relations their foreign keys reference,
+// so relations referencing each other in a cycle cannot be dumped.
+//
+// Each relation is read locked while dumped, so Dump waits for transactions
+// modifying it to end. Dump must not be called from a goroutine holding an
+// open transaction.
+func (e *Engine) Dump(w io.Writer) error {
+	e.Lock()
+	names := make([]string, 0, len(e.schemas))
+	for name := range e.schemas {
+		if name != DefaultSchema {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	schemas := []*Schema{e.schemas[DefaultSchema]}
+	for _, name := range names {
+		schemas = append(schemas, e.schemas[name])
+	}
+	e.Unlock()
+
+	for _, name := range names {
+		if _, err := fmt.Fprintf(w, "CREATE SCHEMA %s;\n", identifier(name)); err != nil {
+			return err
+		}
+	}
+
+	var relations []*Relation
+	for _, s := range schemas {
+		if s == nil {
+			continue
+		}
+		rels, err := s.dump(w)
+		if err != nil {
+			return err
+		}
+		relations = append(relations, rels...)
+	}
+
+	relations, err := referencedFirst(relations)
+	if err != nil {
+		return err
+	}
+	for _, r := range relations {
+		if err := r.dump(w, qualifiedName(r.schema, r.name)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// referencedFirst returns relations ordered so that each relation comes
+// after the relations its foreign keys reference, keeping the given order
+// otherwise.
+func referencedFirst(relations []*Relation) ([]*Relation, error) {
+	byName := make(map[string]*Relation, len(relations))
+	for _, r := range relations {
+		byName[r.schema+"."+r.name] = r
+	}
+
+	const (
+		visiting = iota + 1
+		visited
+	)
+	state := make(map[*Relation]int, len(relations))
+	ordered := make([]*Relation, 0, len(relations))
+
+	var visit func(r *Relation) error
+	visit = func(r *Relation) error {
+		switch state[r] {
+		case visited:
+			return nil
+		case visiting:
+			return fmt.Errorf("cannot dump relation %s, part of a foreign key cycle", r)
+		}
+		state[r] = visiting
+
+		r.RLock()
+		var referenced []*Relation
+		for _, a := range r.attributes {
+			if a.fk == nil {
+				continue
+			}
+			if ref, ok := byName[a.fk.schema+"."+a.fk.relation]; ok && ref != r {
+				referenced = append(referenced, ref)
+			}
+		}
+		r.RUnlock()
+
+		for _, ref := range referenced {
+			if err := visit(ref); err != nil {
+				return err
+			}
+		}
+		state[r] = visited
+		ordered = append(ordered, r)
+		return nil
+	}
+
+	for _, r := range relations {
+		if err := visit(r); err != nil {
+			return nil, err
+		}
+	}
+	return ordered, nil
+}
+
+// dump writes the creation of schema enums, domains and sequences, and
+// returns schema relations sorted by name, left for Engine.Dump to write
+// once every schema types exist.
+func (s *Schema) dump(w io.Writer) ([]*Relation, error) {
+	s.RLock()
+	seqNames := make([]string, 0, len(s.sequences))
+	for name := range s.sequences {
+		seqNames = append(seqNames, name)
+	}
+	enumNames := make([]string, 0, len(s.enums))
+	for name := range s.enums {
+		enumNames = append(enumNames, name)
+	}
+	domainNames := make([]string, 0, len(s.domains))
+	for name := range s.domains {
+		domainNames = append(domainNames, name)
+	}
+	relNames := make([]string, 0, len(s.relations))
+	for name := range s.relations {
+		relNames = append(relNames, name)
+	}
+	s.RUnlock()
+	sort.Strings(seqNames)
+	sort.Strings(enumNames)
+	sort.Strings(domainNames)
+	sort.Strings(relNames)
+
+	for _, name := range enumNames {
+		e, err := s.Enum(name)
+		if err != nil {
+			return nil, err
+		}
+		labels := make([]string, len(e.labels))
+		for i, l := range e.labels {
+			labels[i] = sqlLiteral(l)
+		}
+		if _, err := fmt.Fprintf(w, "CREATE TYPE %s AS ENUM (%s);\n", qualifiedName(s.name, name), strings.Join(labels, ", ")); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, name := range domainNames {
+		d, err := s.Domain(name)
+		if err != nil {
+			return nil, err
+		}
+		if err := d.dump(w, qualifiedName(s.name, name)); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, name := range seqNames {
+		seq, err := s.Sequence(name)
+		if err != nil {
+			return nil, err
+		}
+		if err := seq.dump(w, qualifiedName(s.name, name)); err != nil {
+			return nil, err
+		}
+	}
+
+	relations := make([]*Relation, 0, len(relNames))
+	for _, name := range relNames {
+		r, err := s.Relation(name)
+		if err != nil {
+			return nil, err
+		}
+		relations = append(relations, r)
+	}
+
+	return relations, nil
+}
+
+// dump writes sequence creation so the next value of the rebuilt
+// sequence is the next value of seq.
+func (seq *Sequence) dump(w io.Writer, name string) error {
+	seq.Lock()
+	next := seq.start
+	if seq.called {
+		next = seq.value + seq.increment
+	}
+	increment := seq.increment
+	seq.Unlock()
+
+	_, err := fmt.Fprintf(w, "CREATE SEQUENCE %s START WITH %d INCREMENT BY %d;\n", name, next, increment)
+	return err
+}
+
+func (r *Relation) dump(w io.Writer, name string) error {
+	r.RLock()
+	defer r.RUnlock()
+
+	defs := make([]string, 0, len(r.attributes)+1)
+	names := make([]string, len(r.attributes))
+	for i, a := range r.attributes {
+		names[i] = identifier(a.name)
+		defs = append(defs, a.definition())
+	}
+	if len(r.pk) > 0 {
+		keys := make([]string, len(r.pk))
+		for i, idx := range r.pk {
+			keys[i] = identifier(r.attributes[idx].name)
+		}
+		defs = append(defs, "PRIMARY KEY ("+strings.Join(keys, ", ")+")")
+	}
+
+	if _, err := fmt.Fprintf(w, "CREATE TABLE %s (%s);\n", name, strings.Join(defs, ", ")); err != nil {
+		return err
+	}
+
+	columns := strings.Join(names, ", ")
+	for e := r.rows.Front(); e != nil; e = e.Next() {
+		t := e.Value.(*Tuple)
+		values := make([]string, len(t.values))
+		for i, v := range t.values {
+			values[i] = sqlLiteral(v)
+		}
+		if _, err := fmt.Fprintf(w, "INSERT INTO %s (%s) VALUES (%s);\n", name, columns, strings.Join(values, ", ")); err != nil {
+			return err
+		}
+	}
+
+	for _, i := range r.indexes {
+		if r.implicitIndex(i.Name()) {
+			continue
+		}
+
+		var method string
+		var unique bool
+		var attrs []string
+		switch i := i.(type) {
+		case *HashIndex:
+			method, unique, attrs = "HASH", i.unique, i.attrsName
+		case *BTreeIndex:
+			method, unique, attrs = "BTREE", i.unique, i.attrsName
+		default:
+			return fmt.Errorf("cannot dump index %s of relation %s", i.Name(), r.name)
+		}
+
+		create := "CREATE INDEX"
+		if unique {
+			create = "CREATE UNIQUE INDEX"
+		}
+		cols := make([]string, len(attrs))
+		for j, a := range attrs {
+			cols[j] = identifier(a)
+		}
+		if _, err := fmt.Fprintf(w, "%s %s ON %s USING %s (%s);\n", create, identifier(i.Name()), name, method, strings.Join(cols, ", ")); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// definition returns attribute definition as in a CREATE TABLE statement
+func (a Attribute) definition() string {
+	def := identifier(a.name) + " " + a.typeName
+	if a.collation != nil {
+		def += " COLLATE " + a.collation.String()
+	}
+	if a.notNull {
+		def += " NOT NULL"
+	}
+	if a.unique {
+		def += " UNIQUE"
+	}
+	if a.autoIncrement {
+		if strings.ToLower(a.typeName) != "bigserial" {
+			def += " AUTOINCREMENT"
+		}
+		if a.nextValue != 1 {
+			def += " START WITH " + strconv.FormatUint(a.nextValue, 10)
+		}
+	}
+	if a.defaultExpr != "" {
+		def += " DEFAULT " + a.defaultExpr
+	}
+	if a.fk != nil {
+		def += " REFERENCES " + qualifiedName(a.fk.schema, a.fk.relation) + " (" + identifier(a.fk.attribute) + ")"
+	}
+	return def
+}
+
+func qualifiedName(schema, name string) string {
+	if schema == "" || schema == DefaultSchema {
+		return identifier(name)
+	}
+	return identifier(schema) + "." + identifier(name)
+}
+
+// identifier returns name as written in a statement, double-quoted if it
+// would otherwise be folded to lower case
+func identifier(name string) string {
+	if name == strings.ToLower(name) {
+		return name
+	}
+	return `"` + name + `"`
+}
+
+// sqlLiteral returns v as a SQL literal
+func sqlLiteral(v any) string {
+	switch v := v.(type) {
+	case nil:
+		return "NULL"
+	case bool:
+		return strconv.FormatBool(v)
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
+		return fmt.Sprintf("%d", v)
+	case float32:
+		return strconv.FormatFloat(float64(v), 'f', -1, 32)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case time.Time:
+		return quote(v.Format("2006-01-02 15:04:05.999999999 -0700 MST"))
+	case []byte:
+		return quote(string(v))
+	case string:
+		return quote(v)
+	default:
+		return quote(fmt.Sprintf("%v", v))
+	}
+}
+
+func quote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
@@ -3,6 +3,8 @@ package agnostic
 import (
 	"fmt"
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
 const (
@@ -12,6 +14,15 @@ const (
 type Engine struct {
 	schemas map[string]*Schema
 
+	// write-ahead log, if any, see OpenWAL
+	wal *wal
+
+	// clock returning current time, if set, see SetClock
+	clock atomic.Pointer[func() time.Time]
+
+	// maximum number of rows of a relation, 0 if unlimited, see SetMaxRows
+	maxRows atomic.Int64
+
 	sync.Mutex
 }
 
@@ -25,6 +36,18 @@ func NewEngine() *Engine {
 	return e
 }
 
+// Reset drops every schema, relation and sequence of engine, leaving an empty
+// public schema. Transactions open during Reset keep working on the dropped
+// relations, their changes are lost.
+func (e *Engine) Reset() error {
+	e.Lock()
+	defer e.Unlock()
+
+	e.schemas = make(map[string]*Schema)
+	e.schemas[DefaultSchema] = NewSchema(DefaultSchema)
+	return e.log()
+}
+
 func (e *Engine) Begin() (*Transaction, error) {
 	t, err := NewTransaction(e)
 	return t, err
@@ -62,23 +85,209 @@ func (e *Engine) dropRelation(schema, relation string) (*Schema, *Relation, erro
 	return s, r, nil
 }
 
+func (e *Engine) createSequence(schema, name string, start, increment int64) (*Schema, *Sequence, error) {
+
+	s, err := e.schema(schema)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if _, err := s.Sequence(name); err == nil {
+		return nil, nil, fmt.Errorf("sequence '%s'.'%s' already exists", s.name, name)
+	}
+
+	seq, err := NewSequence(name, start, increment)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	s.AddSequence(name, seq)
+
+	return s, seq, nil
+}
+
+func (e *Engine) dropSequence(schema, name string) (*Schema, *Sequence, error) {
+
+	s, err := e.schema(schema)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	seq, err := s.RemoveSequence(name)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return s, seq, nil
+}
+
+func (e *Engine) createEnum(schema, name string, labels []string) (*Schema, *Enum, error) {
+
+	s, err := e.schema(schema)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if _, err := s.Enum(name); err == nil {
+		return nil, nil, fmt.Errorf("type '%s'.'%s' already exists", s.name, name)
+	}
+	if _, err := s.Domain(name); err == nil {
+		return nil, nil, fmt.Errorf("type '%s'.'%s' already exists", s.name, name)
+	}
+	if _, ok := castFunc(name); ok {
+		return nil, nil, fmt.Errorf("type %s already exists", name)
+	}
+
+	enum, err := NewEnum(name, labels)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	s.AddEnum(name, enum)
+
+	return s, enum, nil
+}
+
+func (e *Engine) dropEnum(schema, name string) (*Schema, *Enum, error) {
+
+	s, err := e.schema(schema)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	enum, err := s.RemoveEnum(name)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return s, enum, nil
+}
+
+func (e *Engine) createDomain(schema string, d *Domain) (*Schema, error) {
+
+	s, err := e.schema(schema)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := s.Domain(d.name); err == nil {
+		return nil, fmt.Errorf("type '%s'.'%s' already exists", s.name, d.name)
+	}
+	if _, err := s.Enum(d.name); err == nil {
+		return nil, fmt.Errorf("type '%s'.'%s' already exists", s.name, d.name)
+	}
+	if _, ok := castFunc(d.name); ok {
+		return nil, fmt.Errorf("type %s already exists", d.name)
+	}
+
+	s.AddDomain(d.name, d)
+
+	return s, nil
+}
+
+// Domains returns every domain of engine, and the domains of relation
+// attributes. Check constraints are not saved compiled: caller compiles
+// again those of domains loaded by Load or from write-ahead log.
+func (e *Engine) Domains() []*Domain {
+	e.Lock()
+	defer e.Unlock()
+
+	var domains []*Domain
+	for _, s := range e.schemas {
+		s.RLock()
+		for _, d := range s.domains {
+			domains = append(domains, d)
+		}
+		for _, r := range s.relations {
+			r.RLock()
+			for _, a := range r.attributes {
+				if a.domain != nil {
+					domains = append(domains, a.domain)
+				}
+			}
+			r.RUnlock()
+		}
+		s.RUnlock()
+	}
+
+	return domains
+}
+
+func (e *Engine) dropDomain(schema, name string) (*Schema, *Domain, error) {
+
+	s, err := e.schema(schema)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	d, err := s.RemoveDomain(name)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return s, d, nil
+}
+
+// SetClock makes engine read current time from clock, for NOW(),
+// CURRENT_TIMESTAMP, CURRENT_DATE and default timestamps. A nil clock
+// restores the real clock.
+func (e *Engine) SetClock(clock func() time.Time) {
+	if clock == nil {
+		e.clock.Store(nil)
+		return
+	}
+	e.clock.Store(&clock)
+}
+
+// Now returns current time, read from engine clock
+func (e *Engine) Now() time.Time {
+	if clock := e.clock.Load(); clock != nil {
+		return (*clock)()
+	}
+	return time.Now()
+}
+
+// SetMaxRows limits the number of rows of each relation to n: an insert
+// into a full relation fails with a ProgramLimitExceeded error, aborting
+// its transaction. 0 removes the limit.
+func (e *Engine) SetMaxRows(n int64) {
+	if n < 0 {
+		n = 0
+	}
+	e.maxRows.Store(n)
+}
+
+// MaxRows returns the maximum number of rows of a relation, 0 if unlimited
+func (e *Engine) MaxRows() int64 {
+	return e.maxRows.Load()
+}
+
 func (e *Engine) schema(name string) (*Schema, error) {
 	if name == "" {
 		name = DefaultSchema
 	}
 
+	e.Lock()
 	s, ok := e.schemas[name]
+	e.Unlock()
 	if !ok {
-		return nil, fmt.Errorf("schema '%s' does not exist", name)
+		return nil, NewError(InvalidSchemaName, "schema '%s' does not exist", name)
 	}
 
 	return s, nil
 }
 
 func (e *Engine) createSchema(name string) (*Schema, error) {
+	if name == InformationSchema {
+		return nil, fmt.Errorf("schema '%s' is reserved", name)
+	}
+
+	e.Lock()
+	defer e.Unlock()
+
 	s, ok := e.schemas[name]
 	if ok {
-		return nil, fmt.Errorf("schema '%s' already exist", name)
+		return nil, NewError(DuplicateSchema, "schema '%s' already exist", name)
 	}
 
 	s = NewSchema(name)
@@ -87,9 +296,12 @@ func (e *Engine) createSchema(name string) (*Schema, error) {
 }
 
 func (e *Engine) dropSchema(name string) (*Schema, error) {
+	e.Lock()
+	defer e.Unlock()
+
 	s, ok := e.schemas[name]
 	if !ok {
-		return nil, fmt.Errorf("schema '%s' does not exist", name)
+		return nil, NewError(InvalidSchemaName, "schema '%s' does not exist", name)
 	}
 
 	delete(e.schemas, name)
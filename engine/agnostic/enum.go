@@ -0,0 +1,75 @@
+package agnostic
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Enum is a type whose values are one of an ordered list of labels, like
+// CREATE TYPE mood AS ENUM ('sad', 'ok', 'happy'). It is stored in a Schema.
+//
+// Enum values are strings, ordered as their labels were declared.
+type Enum struct {
+	name      string
+	labels    []string
+	order     map[string]int
+	collation *Collation
+}
+
+func NewEnum(name string, labels []string) (*Enum, error) {
+	e := &Enum{
+		name:   name,
+		labels: append([]string(nil), labels...),
+		order:  make(map[string]int, len(labels)),
+	}
+	for i, l := range labels {
+		if _, ok := e.order[l]; ok {
+			return nil, fmt.Errorf("enum label \"%s\" used more than once", l)
+		}
+		e.order[l] = i
+	}
+
+	// values are compared in declaration order, strings which are not a
+	// label after them
+	e.collation = &Collation{name: name, compare: func(a, b string) int {
+		i, aok := e.order[a]
+		j, bok := e.order[b]
+		switch {
+		case aok && bok:
+			return i - j
+		case aok:
+			return -1
+		case bok:
+			return 1
+		}
+		return strings.Compare(a, b)
+	}}
+
+	return e, nil
+}
+
+// Name returns the name of enum type
+func (e *Enum) Name() string {
+	return e.name
+}
+
+// Labels returns enum labels, in declaration order
+func (e *Enum) Labels() []string {
+	return append([]string(nil), e.labels...)
+}
+
+// check returns an error if s is not a label of enum
+func (e *Enum) check(s string) *Error {
+	if _, ok := e.order[s]; !ok {
+		return NewError(InvalidTextRepresentation, "invalid input value for enum %s: \"%s\"", e.name, s)
+	}
+	return nil
+}
+
+func (e *Enum) String() string {
+	return e.name
+}
+
+func undefinedType(name string) error {
+	return NewError(UndefinedObject, "type \"%s\" does not exist", name)
+}
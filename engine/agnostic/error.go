@@ -0,0 +1,99 @@
+package agnostic
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// SQLSTATE codes of errors returned by the engine, as defined by PostgreSQL
+const (
+	NumericValueOutOfRange    = "22003"
+	InvalidRegularExpression  = "2201B"
+	InvalidParameterValue     = "22023"
+	InvalidTextRepresentation = "22P02"
+	NotNullViolation          = "23502"
+	UniqueViolation           = "23505"
+	CheckViolation            = "23514"
+	InFailedTransaction       = "25P02"
+	DependentObjectsExist     = "2BP01"
+	InvalidSchemaName         = "3F000"
+	SyntaxError               = "42601"
+	DuplicateColumn           = "42701"
+	AmbiguousColumn           = "42702"
+	UndefinedColumn           = "42703"
+	GroupingError             = "42803"
+	UndefinedObject           = "42704"
+	DatatypeMismatch          = "42804"
+	DuplicateTable            = "42P07"
+	DuplicateSchema           = "42P06"
+	UndefinedTable            = "42P01"
+	InvalidColumnReference    = "42P10"
+	CollationMismatch         = "42P21"
+	ProgramLimitExceeded      = "54000"
+	QueryCanceled             = "57014"
+	LockNotAvailable          = "55P03"
+)
+
+// Error is an error classified by a SQLSTATE code, so that applications
+// can branch on error class with errors.As instead of matching messages.
+// Table and Column are set when error concerns one.
+type Error struct {
+	Code    string
+	Message string
+	Table   string
+	Column  string
+	// Position is the character position of the error in query, counted
+	// from 1, or 0 if unknown
+	Position int
+
+	// err is the error causing this one, if any
+	err error
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+// Unwrap returns the error causing e, if any
+func (e *Error) Unwrap() error {
+	return e.err
+}
+
+// NewError returns an Error of given SQLSTATE code, with formatted message
+func NewError(code string, format string, args ...any) *Error {
+	return &Error{Code: code, Message: fmt.Sprintf(format, args...)}
+}
+
+// WrapError returns an Error of given SQLSTATE code caused by err, with the
+// same message
+func WrapError(code string, err error) *Error {
+	return &Error{Code: code, Message: err.Error(), err: err}
+}
+
+// At locates e at byte offset pos of query: Position is set, and the query
+// line is appended to message with a caret under the error.
+func (e *Error) At(query string, pos int) *Error {
+	if pos < 0 || pos > len(query) {
+		return e
+	}
+
+	e.Position = utf8.RuneCountInString(query[:pos]) + 1
+	start := strings.LastIndexByte(query[:pos], '\n') + 1
+	end := strings.IndexByte(query[pos:], '\n')
+	if end == -1 {
+		end = len(query)
+	} else {
+		end += pos
+	}
+	prefix := fmt.Sprintf("LINE %d: ", strings.Count(query[:start], "\n")+1)
+	caret := strings.Repeat(" ", len(prefix)+utf8.RuneCountInString(query[start:pos]))
+	e.Message = fmt.Sprintf("%s\n%s%s\n%s^", e.Message, prefix, query[start:end], caret)
+	return e
+}
+
+// On sets table and column concerned by e, column may be empty
+func (e *Error) On(table, column string) *Error {
+	e.Table, e.Column = table, column
+	return e
+}
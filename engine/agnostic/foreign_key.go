@@ -0,0 +1,104 @@
+package agnostic
+
+import (
+	"fmt"
+)
+
+// checkForeignKey checks the relation and attribute referenced by fk exist,
+// and qualifies fk with the schema of referenced relation. fk belongs to an
+// attribute of relation name in schema sn, which is not created yet, with
+// attributes attrs and primary key pk, so that a relation can reference
+// itself.
+func (t *Transaction) checkForeignKey(fk *ForeignKey, sn, name string, attrs []Attribute, pk []string) error {
+	fk.schema = t.resolve(fk.schema, fk.relation)
+	if fk.schema == "" {
+		fk.schema = DefaultSchema
+	}
+
+	if fk.schema != sn || fk.relation != name {
+		s, err := t.schema(fk.schema)
+		if err != nil {
+			return err
+		}
+		r, err := s.Relation(fk.relation)
+		if err != nil {
+			return err
+		}
+
+		var pkIdx []int
+		attrs, pkIdx = t.relationMetadata(r)
+		pk = make([]string, len(pkIdx))
+		for i, idx := range pkIdx {
+			pk[i] = attrs[idx].name
+		}
+	}
+
+	if fk.attribute == "" {
+		if len(pk) != 1 {
+			return fmt.Errorf("there is no single attribute primary key for referenced relation %s", fk.relation)
+		}
+		fk.attribute = pk[0]
+	}
+
+	for _, a := range attrs {
+		if a.name == fk.attribute {
+			return nil
+		}
+	}
+	return fmt.Errorf("attribute %s referenced in foreign key does not exist in relation %s", fk.attribute, fk.relation)
+}
+
+// reference is an attribute of relation with a foreign key
+type reference struct {
+	relation  *Relation
+	attribute string
+	fk        *ForeignKey
+}
+
+// referencing returns attributes of relations other than r with a foreign key
+// referencing r, which belongs to schema s.
+func (t *Transaction) referencing(s *Schema, r *Relation) []reference {
+	t.e.Lock()
+	schemas := make([]*Schema, 0, len(t.e.schemas))
+	for _, s := range t.e.schemas {
+		schemas = append(schemas, s)
+	}
+	t.e.Unlock()
+
+	var refs []reference
+	for _, rs := range schemas {
+		rs.RLock()
+		relations := make([]*Relation, 0, len(rs.relations))
+		for _, rr := range rs.relations {
+			if rr != r {
+				relations = append(relations, rr)
+			}
+		}
+		rs.RUnlock()
+
+		for _, rr := range relations {
+			for _, a := range t.relationAttributes(rr) {
+				if a.fk != nil && a.fk.schema == s.name && a.fk.relation == r.name {
+					refs = append(refs, reference{relation: rr, attribute: a.name, fk: a.fk})
+				}
+			}
+		}
+	}
+
+	return refs
+}
+
+// dropForeignKey drops foreign key of ref attribute. It is recorded as a
+// change, so that rollback restores it.
+func (t *Transaction) dropForeignKey(ref reference) error {
+	if err := t.lock(ref.relation); err != nil {
+		return err
+	}
+	for i := range ref.relation.attributes {
+		if ref.relation.attributes[i].name == ref.attribute {
+			ref.relation.attributes[i].fk = nil
+		}
+	}
+	t.changes.PushBack(ForeignKeyChange{relation: ref.relation, attribute: ref.attribute, old: ref.fk})
+	return nil
+}
@@ -0,0 +1,403 @@
+package agnostic
+
+import (
+	"container/list"
+	"fmt"
+	"math"
+	"reflect"
+	"strings"
+)
+
+// scalarFunction computes a value from the values of its arguments, for each
+// row. Most functions are strict, see strict.
+type scalarFunction struct {
+	minArgs int
+	maxArgs int
+	call    func(args []any) (any, error)
+}
+
+// scalarFuncs is the dispatch table of scalar functions, by name
+var scalarFuncs = map[string]scalarFunction{
+	"abs":     {1, 1, strict(absFunc)},
+	"round":   {1, 2, strict(roundFunc)},
+	"ceil":    {1, 1, strict(ceilFunc)},
+	"ceiling": {1, 1, strict(ceilFunc)},
+	"floor":   {1, 1, strict(floorFunc)},
+	"mod":     {2, 2, strict(modFunc)},
+	"power":   {2, 2, strict(powerFunc)},
+	"pow":     {2, 2, strict(powerFunc)},
+	"sqrt":    {1, 1, strict(sqrtFunc)},
+
+	"greatest": {1, math.MaxInt, greatestFunc},
+	"least":    {1, math.MaxInt, leastFunc},
+
+	"date_part":  {2, 2, strict(datePartFunc)},
+	"date_trunc": {2, 2, strict(dateTruncFunc)},
+
+	"array_length": {2, 2, strict(arrayLengthFunc)},
+	"cardinality":  {1, 1, strict(cardinalityFunc)},
+}
+
+// strict returns a function returning NULL if any argument is NULL, without
+// calling f.
+func strict(f func(args []any) (any, error)) func(args []any) (any, error) {
+	return func(args []any) (any, error) {
+		for _, a := range args {
+			if a == nil {
+				return nil, nil
+			}
+		}
+		return f(args)
+	}
+}
+
+// lookupFunction returns the scalar function called name, after checking it
+// accepts n arguments.
+func lookupFunction(name string, n int) (scalarFunction, error) {
+	f, ok := scalarFuncs[strings.ToLower(name)]
+	if !ok {
+		return f, fmt.Errorf("function %s does not exist", name)
+	}
+	if n < f.minArgs || n > f.maxArgs {
+		return f, fmt.Errorf("function %s does not accept %d arguments", name, n)
+	}
+	return f, nil
+}
+
+// number returns v as an int64 if it is an integer, or as a float64 with
+// isFloat set if it is a floating point number.
+func number(v any) (i int64, f float64, isFloat bool, err error) {
+	r := reflect.ValueOf(v)
+	switch {
+	case r.CanInt():
+		return r.Int(), 0, false, nil
+	case r.CanUint():
+		if r.Uint() > math.MaxInt64 {
+			return 0, 0, false, fmt.Errorf("integer out of range")
+		}
+		return int64(r.Uint()), 0, false, nil
+	case r.CanFloat():
+		return 0, r.Float(), true, nil
+	}
+	return 0, 0, false, fmt.Errorf("%v is not a number", v)
+}
+
+func absFunc(args []any) (any, error) {
+	i, f, isFloat, err := number(args[0])
+	if err != nil {
+		return nil, err
+	}
+	if isFloat {
+		return math.Abs(f), nil
+	}
+	if i == math.MinInt64 {
+		return nil, fmt.Errorf("integer out of range")
+	}
+	if i < 0 {
+		return -i, nil
+	}
+	return i, nil
+}
+
+// roundFunc rounds half away from zero, to the given number of decimal
+// places if any. Integers are returned as integers.
+func roundFunc(args []any) (any, error) {
+	i, f, isFloat, err := number(args[0])
+	if err != nil {
+		return nil, err
+	}
+
+	var places int64
+	if len(args) > 1 {
+		var pf bool
+		places, _, pf, err = number(args[1])
+		if err != nil || pf {
+			return nil, fmt.Errorf("decimal places must be an integer")
+		}
+	}
+
+	if isFloat {
+		p := math.Pow(10, float64(places))
+		return math.Round(f*p) / p, nil
+	}
+	if places >= 0 {
+		return i, nil
+	}
+	p := math.Pow(10, float64(-places))
+	r := math.Round(float64(i)/p) * p
+	if r > math.MaxInt64 || r < math.MinInt64 {
+		return nil, fmt.Errorf("integer out of range")
+	}
+	return int64(r), nil
+}
+
+func ceilFunc(args []any) (any, error) {
+	i, f, isFloat, err := number(args[0])
+	if err != nil {
+		return nil, err
+	}
+	if isFloat {
+		return math.Ceil(f), nil
+	}
+	return i, nil
+}
+
+func floorFunc(args []any) (any, error) {
+	i, f, isFloat, err := number(args[0])
+	if err != nil {
+		return nil, err
+	}
+	if isFloat {
+		return math.Floor(f), nil
+	}
+	return i, nil
+}
+
+// modFunc returns the remainder of a divided by b, with the sign of a
+func modFunc(args []any) (any, error) {
+	ia, fa, aFloat, err := number(args[0])
+	if err != nil {
+		return nil, err
+	}
+	ib, fb, bFloat, err := number(args[1])
+	if err != nil {
+		return nil, err
+	}
+
+	if !aFloat && !bFloat {
+		if ib == 0 {
+			return nil, fmt.Errorf("division by zero")
+		}
+		// MinInt64 % -1 overflows in Go
+		if ib == -1 {
+			return int64(0), nil
+		}
+		return ia % ib, nil
+	}
+
+	if !aFloat {
+		fa = float64(ia)
+	}
+	if !bFloat {
+		fb = float64(ib)
+	}
+	if fb == 0 {
+		return nil, fmt.Errorf("division by zero")
+	}
+	return math.Mod(fa, fb), nil
+}
+
+// powerFunc returns a raised to the power of b. Result is an integer if both
+// arguments are integers, b is not negative and result fits in an int64.
+func powerFunc(args []any) (any, error) {
+	ia, fa, aFloat, err := number(args[0])
+	if err != nil {
+		return nil, err
+	}
+	ib, fb, bFloat, err := number(args[1])
+	if err != nil {
+		return nil, err
+	}
+	if !aFloat {
+		fa = float64(ia)
+	}
+	if !bFloat {
+		fb = float64(ib)
+	}
+
+	if fa == 0 && fb < 0 {
+		return nil, fmt.Errorf("zero raised to a negative power is undefined")
+	}
+	if fa < 0 && fb != math.Trunc(fb) {
+		return nil, fmt.Errorf("a negative number raised to a non-integer power yields a complex result")
+	}
+
+	r := math.Pow(fa, fb)
+	if !aFloat && !bFloat && ib >= 0 && r >= math.MinInt64 && r < math.MaxInt64 && math.Abs(r) < 1<<53 {
+		return int64(r), nil
+	}
+	return r, nil
+}
+
+func sqrtFunc(args []any) (any, error) {
+	i, f, isFloat, err := number(args[0])
+	if err != nil {
+		return nil, err
+	}
+	if !isFloat {
+		f = float64(i)
+	}
+	if f < 0 {
+		return nil, fmt.Errorf("cannot take square root of a negative number")
+	}
+	return math.Sqrt(f), nil
+}
+
+// greatestFunc returns the greatest non NULL argument, compared like in
+// ORDER BY, or NULL if all arguments are NULL.
+func greatestFunc(args []any) (any, error) {
+	var res any
+	for _, a := range args {
+		if err := matchTypes(res, a); err != nil {
+			return nil, err
+		}
+		gt, err := greater(a, res)
+		if err != nil {
+			return nil, err
+		}
+		if gt {
+			res = a
+		}
+	}
+	return res, nil
+}
+
+// leastFunc returns the least non NULL argument, compared like in ORDER BY,
+// or NULL if all arguments are NULL.
+func leastFunc(args []any) (any, error) {
+	var res any
+	for _, a := range args {
+		if a == nil {
+			continue
+		}
+		if res == nil {
+			res = a
+			continue
+		}
+		if err := matchTypes(res, a); err != nil {
+			return nil, err
+		}
+		gt, err := greater(res, a)
+		if err != nil {
+			return nil, err
+		}
+		if gt {
+			res = a
+		}
+	}
+	return res, nil
+}
+
+// matchTypes returns an error if non NULL values a and b are not of the same
+// SQL type
+func matchTypes(a, b any) error {
+	if a == nil || b == nil {
+		return nil
+	}
+	if ta, tb := typeName(a), typeName(b); ta != tb {
+		return fmt.Errorf("types %s and %s cannot be matched", ta, tb)
+	}
+	return nil
+}
+
+// FunctionValueFunctor calls a scalar function with the values returned by
+// argument ValueFunctors, like ABS(score) in a predicate.
+type FunctionValueFunctor struct {
+	name string
+	f    scalarFunction
+	args []ValueFunctor
+}
+
+// NewFunctionValueFunctor creates a ValueFunctor calling function name.
+// Unknown function, or wrong number of arguments, is an error.
+func NewFunctionValueFunctor(name string, args ...ValueFunctor) (*FunctionValueFunctor, error) {
+	f, err := lookupFunction(name, len(args))
+	if err != nil {
+		return nil, err
+	}
+
+	vf := &FunctionValueFunctor{
+		name: strings.ToLower(name),
+		f:    f,
+		args: args,
+	}
+	return vf, nil
+}
+
+func (f *FunctionValueFunctor) Value(cols []string, t *Tuple) (any, error) {
+	values := make([]any, len(f.args))
+	for i, a := range f.args {
+		v, err := a.Value(cols, t)
+		if err != nil {
+			return nil, err
+		}
+		values[i] = v
+	}
+
+	v, err := f.f.call(values)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", strings.ToUpper(f.name), err)
+	}
+	return v, nil
+}
+
+// Relation returns the relation of the first argument referencing one
+func (f *FunctionValueFunctor) Relation() string {
+	for _, a := range f.args {
+		if r := a.Relation(); r != "" {
+			return r
+		}
+	}
+	return ""
+}
+
+func (f *FunctionValueFunctor) Attribute() []string {
+	var attrs []string
+	for _, a := range f.args {
+		attrs = append(attrs, a.Attribute()...)
+	}
+	return attrs
+}
+
+func (f FunctionValueFunctor) String() string {
+	args := make([]string, len(f.args))
+	for i, a := range f.args {
+		args[i] = fmt.Sprint(a)
+	}
+	return fmt.Sprintf("%s(%s)", strings.ToUpper(f.name), strings.Join(args, ", "))
+}
+
+// ExpressionSelector returns, for each row, the value computed by a
+// ValueFunctor, like SELECT ROUND(score, 1).
+type ExpressionSelector struct {
+	relation string
+	name     string
+	value    ValueFunctor
+}
+
+func NewExpressionSelector(rname string, name string, value ValueFunctor) *ExpressionSelector {
+	return &ExpressionSelector{
+		relation: rname,
+		name:     name,
+		value:    value,
+	}
+}
+
+func (s *ExpressionSelector) Attribute() []string {
+	return []string{s.name}
+}
+
+func (s *ExpressionSelector) Relation() string {
+	return s.relation
+}
+
+func (s *ExpressionSelector) Alias() string {
+	return ""
+}
+
+func (s *ExpressionSelector) Select(cols []string, in []*list.Element) ([]*Tuple, error) {
+	out := make([]*Tuple, len(in))
+	for i, e := range in {
+		v, err := s.value.Value(cols, e.Value.(*Tuple))
+		if err != nil {
+			return nil, err
+		}
+		out[i] = getTuple(1)
+		out[i].values = append(out[i].values, v)
+	}
+	return out, nil
+}
+
+func (s ExpressionSelector) String() string {
+	return fmt.Sprint(s.value)
+}
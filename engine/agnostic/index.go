@@ -19,6 +19,9 @@ type Index interface {
 	Add(*list.Element)
 	Remove(*list.Element)
 	Name() string
+	// CanSourceWith returns true, with a cost, if index can source rows
+	// matching p. Caller ensures p is a predicate on index relation, which
+	// may be referenced by an alias.
 	CanSourceWith(p Predicate) (bool, int64)
 	Get(values []any) (*list.Element, error)
 }
@@ -29,18 +32,20 @@ type HashIndex struct {
 	relAttrs  []string
 	attrs     []int
 	attrsName []string
-	m         map[uint64]uintptr
+	unique    bool
+	m         map[uint64][]uintptr
 
 	maphash.Hash
 }
 
-func NewHashIndex(name string, relName string, relAttrs []Attribute, attrsName []string, attrs []int) *HashIndex {
+func NewHashIndex(name string, relName string, relAttrs []Attribute, attrsName []string, attrs []int, unique bool) *HashIndex {
 	h := &HashIndex{
 		name:      name,
 		relName:   relName,
 		attrs:     attrs,
 		attrsName: attrsName,
-		m:         make(map[uint64]uintptr),
+		unique:    unique,
+		m:         make(map[uint64][]uintptr),
 	}
 	h.SetSeed(maphash.MakeSeed())
 	for _, a := range relAttrs {
@@ -53,58 +58,108 @@ func (h *HashIndex) Name() string {
 	return h.name
 }
 
-func (h *HashIndex) Add(e *list.Element) {
-	t := e.Value.(*Tuple)
-	for _, idx := range h.attrs {
-		if t.values[idx] == nil {
+// Unique returns true if index does not accept several rows with the same key
+func (h *HashIndex) Unique() bool {
+	return h.unique
+}
+
+// sum hashes values. Values are prefixed with their length, so that keys
+// like ('ab', 'c') and ('a', 'bc') are not written the same.
+func (h *HashIndex) sum(values []any) uint64 {
+	for _, v := range values {
+		if v == nil {
 			h.Write([]byte("nil"))
 			continue
 		}
-		h.Write([]byte(fmt.Sprintf("%v", t.values[idx])))
+		s := fmt.Sprintf("%v", v)
+		h.Write([]byte(fmt.Sprintf("%d:%s", len(s), s)))
 	}
 	sum := h.Sum64()
 	h.Reset()
-	h.m[sum] = uintptr(unsafe.Pointer(e))
+	return sum
 }
 
-func (h *HashIndex) Remove(e *list.Element) {
+func (h *HashIndex) key(e *list.Element) []any {
 	t := e.Value.(*Tuple)
-	for _, idx := range h.attrs {
-		if t.values[idx] == nil {
-			h.Write([]byte("nil"))
-			continue
-		}
-		h.Write([]byte(fmt.Sprintf("%v", t.values[idx])))
+	values := make([]any, len(h.attrs))
+	for i, idx := range h.attrs {
+		values[i] = t.values[idx]
 	}
-	sum := h.Sum64()
-	h.Reset()
-	delete(h.m, sum)
+	return values
 }
 
-func (h *HashIndex) Get(values []any) (*list.Element, error) {
-	for _, v := range values {
-		if v == nil {
-			h.Write([]byte("nil"))
-			continue
+func (h *HashIndex) Add(e *list.Element) {
+	sum := h.sum(h.key(e))
+	h.m[sum] = append(h.m[sum], uintptr(unsafe.Pointer(e)))
+}
+
+func (h *HashIndex) Remove(e *list.Element) {
+	sum := h.sum(h.key(e))
+	ptr := uintptr(unsafe.Pointer(e))
+
+	ptrs := h.m[sum]
+	for i := range ptrs {
+		if ptrs[i] == ptr {
+			ptrs = append(ptrs[:i], ptrs[i+1:]...)
+			break
 		}
-		h.Write([]byte(fmt.Sprintf("%v", v)))
 	}
-	sum := h.Sum64()
-	h.Reset()
+	if len(ptrs) == 0 {
+		delete(h.m, sum)
+		return
+	}
+	h.m[sum] = ptrs
+}
 
-	var t *list.Element
-	ptr, ok := h.m[sum]
-	if !ok {
+// Get returns the first row indexed with given values, or nil if there is none
+func (h *HashIndex) Get(values []any) (*list.Element, error) {
+	res := h.lookup(values, false)
+	if len(res) == 0 {
 		return nil, nil
-		//		return nil, fmt.Errorf("could not find sum '%d' (%v) in index %s", sum, values, h)
 	}
 
-	t = (*list.Element)(unsafe.Pointer(ptr))
-	return t, nil
+	return res[0], nil
+}
+
+// GetAll returns all rows indexed with given values
+func (h *HashIndex) GetAll(values []any) ([]*list.Element, error) {
+	return h.lookup(values, true), nil
+}
+
+// lookup returns the first row indexed with given values, or all of them.
+// Different keys may hash the same, so keys of rows are compared with values.
+func (h *HashIndex) lookup(values []any, all bool) []*list.Element {
+	var res []*list.Element
+	for _, ptr := range h.m[h.sum(values)] {
+		e := (*list.Element)(unsafe.Pointer(ptr))
+		if compareKeys(h.key(e), values) != 0 {
+			continue
+		}
+		res = append(res, e)
+		if !all {
+			break
+		}
+	}
+	return res
 }
 
 func (h *HashIndex) Truncate() {
-	h.m = make(map[uint64]uintptr)
+	h.m = make(map[uint64][]uintptr)
+}
+
+// clone returns an empty index with the same definition
+func (h *HashIndex) clone() *HashIndex {
+	c := &HashIndex{
+		name:      h.name,
+		relName:   h.relName,
+		relAttrs:  append([]string(nil), h.relAttrs...),
+		attrs:     append([]int(nil), h.attrs...),
+		attrsName: append([]string(nil), h.attrsName...),
+		unique:    h.unique,
+		m:         make(map[uint64][]uintptr),
+	}
+	c.SetSeed(maphash.MakeSeed())
+	return c
 }
 
 func (h *HashIndex) String() string {
@@ -112,27 +167,90 @@ func (h *HashIndex) String() string {
 }
 
 func (h *HashIndex) CanSourceWith(p Predicate) (bool, int64) {
-	if p.Relation() != h.relName {
+	if _, ok := h.probe(p); !ok {
 		return false, 0
 	}
+	return true, 1
+}
 
-	if p.Type() != Eq {
-		return false, 0
+// probe returns the key of rows matching p, if p is an equality between each
+// index attribute and a constant, combined with AND. Rows are looked up with
+// the constant right side of equalities, left side must be the indexed
+// attribute itself.
+func (h *HashIndex) probe(p Predicate) ([]any, bool) {
+	key := make([]any, len(h.attrs))
+	found := make([]bool, len(h.attrs))
+
+	var walk func(p Predicate) bool
+	walk = func(p Predicate) bool {
+		if p.Type() == And {
+			lp, _ := p.Left()
+			rp, _ := p.Right()
+			return walk(lp) && walk(rp)
+		}
+		eq, ok := p.(*EqPredicate)
+		if !ok || len(eq.right.Attribute()) != 0 {
+			return false
+		}
+		if _, ok := eq.left.(*AttributeValueFunctor); !ok {
+			return false
+		}
+		i := h.position(eq.left.Attribute()[0])
+		if i == -1 {
+			return false
+		}
+		v, err := eq.right.Value(nil, nil)
+		if err != nil {
+			return false
+		}
+		key[i], found[i] = v, true
+		return true
+	}
+	if !walk(p) {
+		return nil, false
+	}
+	for _, f := range found {
+		if !f {
+			return nil, false
+		}
 	}
+	return key, true
+}
 
-	var found bool
-	for _, l := range h.attrsName {
-		found = false
-		for _, r := range p.Attribute() {
-			if l == r || h.relName+"."+l == r {
-				found = true
+// cover returns an equality predicate of preds for each index attribute,
+// combined with AND, so that index is probed with all of them
+func (h *HashIndex) cover(preds []Predicate) (Predicate, bool) {
+	var p Predicate
+	for i := range h.attrs {
+		var eq Predicate
+		for _, cp := range preds {
+			e, ok := cp.(*EqPredicate)
+			if !ok || len(e.right.Attribute()) != 0 {
+				continue
+			}
+			if _, ok := e.left.(*AttributeValueFunctor); ok && h.position(e.left.Attribute()[0]) == i {
+				eq = e
 				break
 			}
 		}
-		if !found {
-			return false, 0
+		if eq == nil {
+			return nil, false
+		}
+		if p == nil {
+			p = eq
+		} else {
+			p = NewAndPredicate(p, eq)
 		}
 	}
+	return p, true
+}
 
-	return true, 1
+// position returns the position of named attribute in index key, or -1
+func (h *HashIndex) position(attr string) int {
+	for i, a := range h.attrsName {
+		if a == attr || h.relName+"."+a == attr {
+			return i
+		}
+	}
+	return -1
 }
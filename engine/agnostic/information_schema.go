@@ -0,0 +1,123 @@
+package agnostic
+
+import (
+	"sort"
+	"strings"
+)
+
+const (
+	// InformationSchema is the read-only schema describing relations of all other schemas
+	InformationSchema = "information_schema"
+)
+
+// schema returns named schema for reading. Relations of information_schema
+// are built on the fly from engine metadata. When name is empty, relations of
+// every schema of search path are visible, as well as materialized relations.
+func (t *Transaction) schema(name string) (*Schema, error) {
+	if name == InformationSchema {
+		return t.informationSchema(), nil
+	}
+
+	var s *Schema
+	var err error
+	if name == "" && len(t.searchPath) > 0 {
+		s, err = t.searchSchema()
+	} else {
+		s, err = t.e.schema(name)
+	}
+	if err != nil || name != "" || len(t.derived) == 0 {
+		return s, err
+	}
+
+	return t.withDerived(s), nil
+}
+
+// informationSchema builds information_schema relations:
+//
+//   - schemata: schema_name
+//   - tables: table_schema, table_name, table_type
+//   - columns: table_schema, table_name, column_name, ordinal_position,
+//     data_type, is_nullable, column_default
+func (t *Transaction) informationSchema() *Schema {
+	schemata, _ := NewRelation(InformationSchema, "schemata", []Attribute{
+		NewAttribute("schema_name", "text"),
+	}, nil)
+	tables, _ := NewRelation(InformationSchema, "tables", []Attribute{
+		NewAttribute("table_schema", "text"),
+		NewAttribute("table_name", "text"),
+		NewAttribute("table_type", "text"),
+	}, nil)
+	columns, _ := NewRelation(InformationSchema, "columns", []Attribute{
+		NewAttribute("table_schema", "text"),
+		NewAttribute("table_name", "text"),
+		NewAttribute("column_name", "text"),
+		NewAttribute("ordinal_position", "bigint"),
+		NewAttribute("data_type", "text"),
+		NewAttribute("is_nullable", "text"),
+		NewAttribute("column_default", "text"),
+	}, nil)
+
+	t.e.Lock()
+	schemas := make([]*Schema, 0, len(t.e.schemas))
+	for _, s := range t.e.schemas {
+		schemas = append(schemas, s)
+	}
+	t.e.Unlock()
+	sort.Slice(schemas, func(i, j int) bool { return schemas[i].name < schemas[j].name })
+
+	for _, s := range schemas {
+		schemata.rows.PushBack(NewTuple(s.name))
+
+		s.RLock()
+		relations := make([]*Relation, 0, len(s.relations))
+		for _, r := range s.relations {
+			relations = append(relations, r)
+		}
+		s.RUnlock()
+		sort.Slice(relations, func(i, j int) bool { return relations[i].name < relations[j].name })
+
+		for _, r := range relations {
+			tables.rows.PushBack(NewTuple(s.name, r.name, "BASE TABLE"))
+
+			for i, a := range t.relationAttributes(r) {
+				nullable := "YES"
+				if !a.Nullable() {
+					nullable = "NO"
+				}
+				var def any
+				if a.defaultExpr != "" {
+					def = a.defaultExpr
+				}
+				columns.rows.PushBack(NewTuple(s.name, r.name, a.name, int64(i+1), strings.ToLower(a.typeName), nullable, def))
+			}
+		}
+	}
+
+	s := NewSchema(InformationSchema)
+	s.Add(schemata.name, schemata)
+	s.Add(tables.name, tables)
+	s.Add(columns.name, columns)
+	return s
+}
+
+// relationAttributes returns a copy of relation attributes, read locking
+// relation unless transaction already holds its lock.
+func (t *Transaction) relationAttributes(r *Relation) []Attribute {
+	attrs, _ := t.relationMetadata(r)
+	return attrs
+}
+
+// relationMetadata returns a copy of relation attributes and primary key
+// attribute indexes, read locking relation unless transaction already holds its lock.
+func (t *Transaction) relationMetadata(r *Relation) ([]Attribute, []int) {
+	if l, ok := t.locks[r.String()]; !ok || l != r {
+		r.RLock()
+		defer r.RUnlock()
+	}
+
+	attrs := make([]Attribute, len(r.attributes))
+	copy(attrs, r.attributes)
+	pk := make([]int, len(r.pk))
+	copy(pk, r.pk)
+	return attrs, pk
+}
@@ -0,0 +1,343 @@
+package agnostic
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Interval is a span of time, like INTERVAL '1 month 2 days 03:00:00'.
+//
+// As in PostgreSQL, months, days and time are kept apart and never
+// normalized into each other, because the length of a month or of a day
+// depends on the timestamp the interval is added to. '36 hours' stays 36
+// hours and is not turned into 1 day 12 hours. Years are stored as 12 months,
+// weeks as 7 days, and fractional units spill into the next smaller field
+// with 30 days months and 24 hours days, so '1.5 months' is 1 month 15 days.
+//
+// Time is a time.Duration, so it holds at most about 292 years of hours.
+// Parsing or arithmetic overflowing any field is an "interval out of range"
+// error rather than a wrapped value.
+type Interval struct {
+	Months int64
+	Days   int64
+	Time   time.Duration
+}
+
+var errIntervalRange = fmt.Errorf("interval out of range")
+
+// PostgreSQL timestamp range
+const (
+	minTimestampYear = -4713
+	maxTimestampYear = 294276
+	maxIntervalYears = maxTimestampYear - minTimestampYear
+)
+
+// intervalUnits maps unit names to a number of months, days or nanoseconds
+var intervalUnits = map[string]struct {
+	months int64
+	days   int64
+	nanos  int64
+}{
+	"microsecond": {nanos: int64(time.Microsecond)},
+	"millisecond": {nanos: int64(time.Millisecond)},
+	"second":      {nanos: int64(time.Second)},
+	"minute":      {nanos: int64(time.Minute)},
+	"hour":        {nanos: int64(time.Hour)},
+	"day":         {days: 1},
+	"week":        {days: 7},
+	"mon":         {months: 1},
+	"month":       {months: 1},
+	"year":        {months: 12},
+	"decade":      {months: 120},
+	"century":     {months: 1200},
+}
+
+// intervalUnitAliases maps abbreviations and plurals to unit names
+var intervalUnitAliases = map[string]string{
+	"us": "microsecond", "usec": "microsecond", "usecs": "microsecond", "microseconds": "microsecond",
+	"ms": "millisecond", "msec": "millisecond", "msecs": "millisecond", "milliseconds": "millisecond",
+	"s": "second", "sec": "second", "secs": "second", "seconds": "second",
+	"m": "minute", "min": "minute", "mins": "minute", "minutes": "minute",
+	"h": "hour", "hr": "hour", "hrs": "hour", "hours": "hour",
+	"d": "day", "days": "day",
+	"w": "week", "weeks": "week",
+	"mons": "mon", "months": "month",
+	"y": "year", "yr": "year", "yrs": "year", "years": "year",
+	"decades": "decade", "centuries": "century",
+}
+
+// ParseInterval parses an interval literal made of quantity and unit pairs,
+// like '1 year 2 months', optionally followed by a time of the form
+// [-]HH:MM[:SS[.fraction]] and by "ago", which negates the interval.
+// String output of Interval is accepted.
+func ParseInterval(s string) (Interval, error) {
+	var i Interval
+
+	fields := strings.Fields(strings.ToLower(s))
+	if len(fields) == 0 {
+		return i, fmt.Errorf("invalid interval '%s'", s)
+	}
+
+	ago := false
+	if fields[len(fields)-1] == "ago" {
+		ago = true
+		fields = fields[:len(fields)-1]
+	}
+
+	for n := 0; n < len(fields); n++ {
+		f := fields[n]
+		if strings.Contains(f, ":") {
+			d, err := parseIntervalClock(f)
+			if err != nil {
+				return i, fmt.Errorf("invalid interval '%s': %w", s, err)
+			}
+			if i.Time, err = addDuration(i.Time, d); err != nil {
+				return i, err
+			}
+			continue
+		}
+
+		// quantity may be stuck to its unit, like 10d
+		qty, unit := f, ""
+		if idx := strings.IndexFunc(f, func(r rune) bool { return (r < '0' || r > '9') && r != '.' && r != '-' && r != '+' }); idx > 0 {
+			qty, unit = f[:idx], f[idx:]
+		} else if n+1 < len(fields) {
+			n++
+			unit = fields[n]
+		}
+
+		// as in PostgreSQL, a lone quantity is a number of seconds
+		if unit == "" {
+			unit = "second"
+		}
+
+		q, err := strconv.ParseFloat(qty, 64)
+		if err != nil {
+			return i, fmt.Errorf("invalid interval '%s': invalid quantity %s", s, qty)
+		}
+		if err := i.addUnit(q, unit); err != nil {
+			return i, fmt.Errorf("invalid interval '%s': %w", s, err)
+		}
+	}
+
+	if ago {
+		return i.Neg()
+	}
+	return i, nil
+}
+
+// parseIntervalClock parses the time part of an interval, [-]HH:MM[:SS[.fraction]]
+func parseIntervalClock(s string) (time.Duration, error) {
+	neg := strings.HasPrefix(s, "-")
+	s = strings.TrimLeft(s, "+-")
+
+	parts := strings.Split(s, ":")
+	if len(parts) > 3 {
+		return 0, fmt.Errorf("invalid time %s", s)
+	}
+
+	var total float64
+	scales := []float64{float64(time.Hour), float64(time.Minute), float64(time.Second)}
+	for i, p := range parts {
+		v, err := strconv.ParseFloat(p, 64)
+		// hours are not bounded, unlike minutes and seconds
+		if err != nil || v < 0 || (i > 0 && v >= 60) || (i < len(parts)-1 && v != math.Trunc(v)) {
+			return 0, fmt.Errorf("invalid time %s", s)
+		}
+		total += v * scales[i]
+	}
+	if total >= math.MaxInt64 {
+		return 0, errIntervalRange
+	}
+
+	d := time.Duration(math.Round(total))
+	if neg {
+		d = -d
+	}
+	return d, nil
+}
+
+// addUnit adds qty units to interval, spilling fractional months into days
+// and fractional days into time.
+func (i *Interval) addUnit(qty float64, unit string) error {
+	if a, ok := intervalUnitAliases[unit]; ok {
+		unit = a
+	}
+	u, ok := intervalUnits[unit]
+	if !ok {
+		return fmt.Errorf("unit \"%s\" not recognized", unit)
+	}
+
+	var err error
+	switch {
+	case u.months != 0:
+		months := qty * float64(u.months)
+		whole := math.Trunc(months)
+		if math.Abs(whole) >= math.MaxInt64 {
+			return errIntervalRange
+		}
+		if i.Months, err = addInt64(i.Months, int64(whole)); err != nil {
+			return err
+		}
+		return i.addUnit((months-whole)*30, "day")
+	case u.days != 0:
+		days := qty * float64(u.days)
+		whole := math.Trunc(days)
+		if math.Abs(whole) >= math.MaxInt64 {
+			return errIntervalRange
+		}
+		if i.Days, err = addInt64(i.Days, int64(whole)); err != nil {
+			return err
+		}
+		return i.addUnit((days-whole)*24, "hour")
+	}
+
+	nanos := math.Round(qty * float64(u.nanos))
+	if math.Abs(nanos) >= math.MaxInt64 {
+		return errIntervalRange
+	}
+	i.Time, err = addDuration(i.Time, time.Duration(nanos))
+	return err
+}
+
+// Add returns the sum of intervals i and o
+func (i Interval) Add(o Interval) (Interval, error) {
+	var r Interval
+	var err error
+	if r.Months, err = addInt64(i.Months, o.Months); err != nil {
+		return r, err
+	}
+	if r.Days, err = addInt64(i.Days, o.Days); err != nil {
+		return r, err
+	}
+	if r.Time, err = addDuration(i.Time, o.Time); err != nil {
+		return r, err
+	}
+	return r, nil
+}
+
+// Neg returns the opposite of interval i
+func (i Interval) Neg() (Interval, error) {
+	if i.Months == math.MinInt64 || i.Days == math.MinInt64 || i.Time == math.MinInt64 {
+		return i, errIntervalRange
+	}
+	return Interval{Months: -i.Months, Days: -i.Days, Time: -i.Time}, nil
+}
+
+// AddTo returns timestamp t moved by interval i. Months are added first,
+// clamping the day to the end of the resulting month, then days, then time.
+func (i Interval) AddTo(t time.Time) (time.Time, error) {
+	// beyond PostgreSQL timestamp range whatever t is
+	if i.Months > maxIntervalYears*12 || i.Months < -maxIntervalYears*12 || i.Days > maxIntervalYears*366 || i.Days < -maxIntervalYears*366 {
+		return t, fmt.Errorf("timestamp out of range")
+	}
+
+	y, m, d := t.Date()
+	months := int64(y)*12 + int64(m-1) + i.Months
+	year, month := months/12, time.Month(months%12+1)
+	if months < 0 && months%12 != 0 {
+		year, month = year-1, time.Month(months%12+13)
+	}
+
+	if last := time.Date(int(year), month+1, 0, 0, 0, 0, 0, t.Location()).Day(); d > last {
+		d = last
+	}
+	res := time.Date(int(year), month, d, t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), t.Location())
+	res = res.AddDate(0, 0, int(i.Days)).Add(i.Time)
+
+	if res.Year() < minTimestampYear || res.Year() > maxTimestampYear {
+		return t, fmt.Errorf("timestamp out of range")
+	}
+	return res, nil
+}
+
+// IntervalBetween returns the interval from timestamp from to timestamp to, in
+// days and time.
+func IntervalBetween(to, from time.Time) Interval {
+	secs := to.Unix() - from.Unix()
+	nanos := int64(to.Nanosecond() - from.Nanosecond())
+
+	days := secs / 86400
+	rest := time.Duration(secs%86400)*time.Second + time.Duration(nanos)
+	// keep days and time of the same sign
+	if days > 0 && rest < 0 {
+		days--
+		rest += 24 * time.Hour
+	} else if days < 0 && rest > 0 {
+		days++
+		rest -= 24 * time.Hour
+	}
+
+	return Interval{Days: days, Time: rest}
+}
+
+// cmp compares intervals on their length with 30 days months and 24 hours
+// days, so that '1 day' equals '24 hours'.
+func (i Interval) cmp(o Interval) int {
+	li, lo := i.nanos(), o.nanos()
+	switch {
+	case li < lo:
+		return -1
+	case li > lo:
+		return 1
+	}
+	return 0
+}
+
+func (i Interval) nanos() float64 {
+	return (float64(i.Months)*30+float64(i.Days))*float64(24*time.Hour) + float64(i.Time)
+}
+
+// String formats interval like PostgreSQL, as in "1 year 2 mons 3 days 04:05:06"
+func (i Interval) String() string {
+	var parts []string
+
+	plural := func(n int64, unit string) {
+		if n == 0 {
+			return
+		}
+		if n == 1 || n == -1 {
+			parts = append(parts, fmt.Sprintf("%d %s", n, unit))
+			return
+		}
+		parts = append(parts, fmt.Sprintf("%d %ss", n, unit))
+	}
+	plural(i.Months/12, "year")
+	plural(i.Months%12, "mon")
+	plural(i.Days, "day")
+
+	if i.Time != 0 || len(parts) == 0 {
+		d := i.Time
+		sign := ""
+		if d < 0 {
+			sign = "-"
+			d = -d
+		}
+		h := d / time.Hour
+		m := (d % time.Hour) / time.Minute
+		s := (d % time.Minute) / time.Second
+		clock := fmt.Sprintf("%s%02d:%02d:%02d", sign, h, m, s)
+		if frac := d % time.Second; frac != 0 {
+			clock += strings.TrimRight(fmt.Sprintf(".%09d", frac), "0")
+		}
+		parts = append(parts, clock)
+	}
+
+	return strings.Join(parts, " ")
+}
+
+func addInt64(a, b int64) (int64, error) {
+	s := a + b
+	if (b > 0 && s < a) || (b < 0 && s > a) {
+		return 0, errIntervalRange
+	}
+	return s, nil
+}
+
+func addDuration(a, b time.Duration) (time.Duration, error) {
+	s, err := addInt64(int64(a), int64(b))
+	return time.Duration(s), err
+}
@@ -0,0 +1,72 @@
+package agnostic
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseInterval(t *testing.T) {
+	tests := []struct {
+		literal string
+		expect  string
+	}{
+		{"1 day", "1 day"},
+		{"36 hours", "36:00:00"},
+		{"1 year 14 months", "2 years 2 mons"},
+		{"2 weeks 1.5 days", "15 days 12:00:00"},
+		{"1.5 months", "1 mon 15 days"},
+		{"1 day 02:30:00", "1 day 02:30:00"},
+		{"3 days ago", "-3 days"},
+		{"90", "00:01:30"},
+		{"10d 5m", "10 days 00:05:00"},
+		{"1 year 2 mons 3 days 04:05:06.5", "1 year 2 mons 3 days 04:05:06.5"},
+	}
+
+	for _, test := range tests {
+		i, err := ParseInterval(test.literal)
+		if err != nil {
+			t.Fatalf("cannot parse '%s': %s", test.literal, err)
+		}
+		if i.String() != test.expect {
+			t.Fatalf("expected '%s' to be '%s', got '%s'", test.literal, test.expect, i)
+		}
+	}
+
+	for _, literal := range []string{"", "1 fortnight", "one day", "1 day 25:61"} {
+		if _, err := ParseInterval(literal); err == nil {
+			t.Fatalf("expected error parsing '%s'", literal)
+		}
+	}
+
+	if _, err := ParseInterval("10000000 hours"); err == nil {
+		t.Fatalf("expected interval out of range error")
+	}
+}
+
+func TestIntervalArithmetic(t *testing.T) {
+	ts := time.Date(2024, time.January, 31, 10, 0, 0, 0, time.UTC)
+
+	i, _ := ParseInterval("1 month 1 day")
+	res, err := i.AddTo(ts)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if !res.Equal(time.Date(2024, time.March, 1, 10, 0, 0, 0, time.UTC)) {
+		t.Fatalf("unexpected timestamp %s", res)
+	}
+
+	between := IntervalBetween(ts, time.Date(2024, time.January, 29, 12, 0, 0, 0, time.UTC))
+	if between.String() != "1 day 22:00:00" {
+		t.Fatalf("unexpected interval %s", between)
+	}
+
+	day, _ := ParseInterval("1 day")
+	hours, _ := ParseInterval("24 hours")
+	if eq, _ := equal(day, hours); !eq {
+		t.Fatalf("expected '1 day' to equal '24 hours'")
+	}
+
+	if _, err := (Interval{Months: 12 * 1000000}).AddTo(ts); err == nil {
+		t.Fatalf("expected timestamp out of range error")
+	}
+}
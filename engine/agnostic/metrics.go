@@ -0,0 +1,109 @@
+package agnostic
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// PlanNode describes a node of an executed query plan
+type PlanNode struct {
+	// Depth of node in plan tree, root being 0
+	Depth int
+	// Node describes the node, as in EXPLAIN
+	Node string
+	// Index is the name of the index sourcing rows of a scan node, if any
+	Index string
+	// Estimated is the cardinal estimated by the planner
+	Estimated int64
+	// Actual is the number of rows produced, and Time the time spent in
+	// node, children included. Both are 0 if node was not executed.
+	Actual   int64
+	Time     time.Duration
+	Executed bool
+}
+
+// PlanMetrics are the metrics of the plan of a query, collected when
+// the query context is given by WithPlanMetrics.
+type PlanMetrics struct {
+	// Nodes of plan tree, depth first, root first
+	Nodes []PlanNode
+}
+
+// Estimated returns the number of rows the planner estimated query returns
+func (m *PlanMetrics) Estimated() int64 {
+	if len(m.Nodes) == 0 {
+		return 0
+	}
+	return m.Nodes[0].Estimated
+}
+
+// Actual returns the number of rows query returned
+func (m *PlanMetrics) Actual() int64 {
+	if len(m.Nodes) == 0 {
+		return 0
+	}
+	return m.Nodes[0].Actual
+}
+
+// Indexes returns the names of indexes used by the plan
+func (m *PlanMetrics) Indexes() []string {
+	var names []string
+	for _, n := range m.Nodes {
+		if n.Index != "" {
+			names = append(names, n.Index)
+		}
+	}
+	return names
+}
+
+type planMetricsKey struct{}
+
+// WithPlanMetrics returns a copy of ctx in which queries collect the metrics
+// of their plan into m. A statement made of several queries, like a UNION,
+// collects the metrics of the last one.
+func WithPlanMetrics(ctx context.Context, m *PlanMetrics) context.Context {
+	return context.WithValue(ctx, planMetricsKey{}, m)
+}
+
+// planMetrics returns the plan metrics collected in ctx, if any
+func planMetrics(ctx context.Context) *PlanMetrics {
+	if ctx == nil {
+		return nil
+	}
+	m, _ := ctx.Value(planMetricsKey{}).(*PlanMetrics)
+	return m
+}
+
+// planNodes appends to nodes the description of plan tree n, whose nodes
+// are wrapped into AnalyzeNode if executed, see recAnalyzeNode
+func planNodes(n Node, depth int, nodes []PlanNode) []PlanNode {
+	an, ok := n.(*AnalyzeNode)
+	if !ok {
+		an = NewAnalyzeNode(n)
+	}
+
+	pn := PlanNode{
+		Depth:     depth,
+		Node:      fmt.Sprintf("%s", an),
+		Estimated: an.EstimateCardinal(),
+		Executed:  an.done,
+	}
+	if an.done {
+		pn.Actual, pn.Time = an.rows, an.duration
+	}
+	if sc, ok := an.src.(*RelationScanner); ok {
+		switch src := sc.src.(type) {
+		case *IndexSrc:
+			pn.Index = src.index.Name()
+		case *IndexLookupSrc:
+			pn.Index = src.index.Name()
+		}
+	}
+	nodes = append(nodes, pn)
+
+	for _, child := range n.Children() {
+		nodes = planNodes(child, depth+1, nodes)
+	}
+	return nodes
+}
@@ -0,0 +1,373 @@
+package agnostic
+
+import (
+	"container/list"
+	"encoding/gob"
+	"fmt"
+	"io"
+	"time"
+)
+
+// persistVersion is the version of the format written by Save
+const persistVersion = 1
+
+func init() {
+	// row values are encoded as interfaces, basic types are registered by gob
+	gob.Register(time.Time{})
+	gob.Register(Interval{})
+	gob.Register(Array{})
+}
+
+type engineState struct {
+	Version int
+	Schemas []schemaState
+}
+
+type schemaState struct {
+	Name      string
+	Sequences []sequenceState
+	Enums     []enumState
+	Domains   []domainState
+	Relations []relationState
+}
+
+type enumState struct {
+	Name   string
+	Labels []string
+}
+
+type domainState struct {
+	Name     string
+	BaseType string
+	Default  any
+	NotNull  bool
+	// Check is the SQL expression of check constraint
+	Check string
+}
+
+type sequenceState struct {
+	Name      string
+	Start     int64
+	Increment int64
+	Value     int64
+	Called    bool
+}
+
+type relationState struct {
+	Name       string
+	Schema     string
+	Attributes []attributeState
+	PK         []int
+	Indexes    []indexState
+	Rows       [][]any
+}
+
+type attributeState struct {
+	Name     string
+	TypeName string
+	// DefaultExpr is the SQL expression of default value. Default is the
+	// value of constant defaults.
+	DefaultExpr   string
+	Default       any
+	AutoIncrement bool
+	NextValue     uint64
+	StartValue    uint64
+	Unique        bool
+	NotNull       bool
+	FK            *foreignKeyState
+	Collation     string
+	Enum          *enumState
+	Domain        *domainState
+}
+
+type foreignKeyState struct {
+	Schema    string
+	Relation  string
+	Attribute string
+}
+
+type indexState struct {
+	Name      string
+	BTree     bool
+	Attrs     []int
+	AttrsName []string
+	Unique    bool
+}
+
+// Save writes to w the state of every schema, sequence and relation of
+// engine, rows included, so that Load returns an identical engine. Indexes
+// definitions are saved, indexes are rebuilt by Load.
+//
+// As with Dump, each relation is read locked while saved. Save must not be
+// called from a goroutine holding an open transaction.
+func (e *Engine) Save(w io.Writer) error {
+	e.Lock()
+	schemas := make([]*Schema, 0, len(e.schemas))
+	for _, s := range e.schemas {
+		schemas = append(schemas, s)
+	}
+	e.Unlock()
+
+	state := engineState{Version: persistVersion}
+	for _, s := range schemas {
+		ss, err := s.state()
+		if err != nil {
+			return err
+		}
+		state.Schemas = append(state.Schemas, ss)
+	}
+
+	return gob.NewEncoder(w).Encode(state)
+}
+
+// Load reads an engine written by Save
+func Load(r io.Reader) (*Engine, error) {
+	var state engineState
+	if err := gob.NewDecoder(r).Decode(&state); err != nil {
+		return nil, fmt.Errorf("cannot load engine: %w", err)
+	}
+	if state.Version != persistVersion {
+		return nil, fmt.Errorf("cannot load engine: unsupported version %d", state.Version)
+	}
+
+	e := &Engine{schemas: make(map[string]*Schema)}
+	for _, ss := range state.Schemas {
+		s := NewSchema(ss.Name)
+		for _, seq := range ss.Sequences {
+			s.sequences[seq.Name] = &Sequence{
+				name:      seq.Name,
+				start:     seq.Start,
+				increment: seq.Increment,
+				value:     seq.Value,
+				called:    seq.Called,
+			}
+		}
+		for _, es := range ss.Enums {
+			enum, err := NewEnum(es.Name, es.Labels)
+			if err != nil {
+				return nil, err
+			}
+			s.enums[es.Name] = enum
+		}
+		for _, ds := range ss.Domains {
+			d, err := ds.domain()
+			if err != nil {
+				return nil, err
+			}
+			s.domains[ds.Name] = d
+		}
+		for _, rs := range ss.Relations {
+			r, err := rs.relation()
+			if err != nil {
+				return nil, err
+			}
+			s.relations[r.name] = r
+		}
+		e.schemas[s.name] = s
+	}
+
+	if _, ok := e.schemas[DefaultSchema]; !ok {
+		e.schemas[DefaultSchema] = NewSchema(DefaultSchema)
+	}
+
+	return e, nil
+}
+
+func (s *Schema) state() (schemaState, error) {
+	s.RLock()
+	relations := make([]*Relation, 0, len(s.relations))
+	for _, r := range s.relations {
+		relations = append(relations, r)
+	}
+	sequences := make([]*Sequence, 0, len(s.sequences))
+	for _, seq := range s.sequences {
+		sequences = append(sequences, seq)
+	}
+	ss := schemaState{Name: s.name}
+	for _, e := range s.enums {
+		ss.Enums = append(ss.Enums, enumState{Name: e.name, Labels: e.Labels()})
+	}
+	for _, d := range s.domains {
+		ss.Domains = append(ss.Domains, d.state())
+	}
+	s.RUnlock()
+
+	for _, seq := range sequences {
+		seq.Lock()
+		ss.Sequences = append(ss.Sequences, sequenceState{
+			Name:      seq.name,
+			Start:     seq.start,
+			Increment: seq.increment,
+			Value:     seq.value,
+			Called:    seq.called,
+		})
+		seq.Unlock()
+	}
+	for _, r := range relations {
+		r.RLock()
+		rs, err := r.state()
+		r.RUnlock()
+		if err != nil {
+			return ss, err
+		}
+		ss.Relations = append(ss.Relations, rs)
+	}
+
+	return ss, nil
+}
+
+// state returns the state of relation. Caller must hold relation lock.
+func (r *Relation) state() (relationState, error) {
+	rs := relationState{
+		Name:   r.name,
+		Schema: r.schema,
+		PK:     append([]int(nil), r.pk...),
+		Rows:   make([][]any, 0, r.rows.Len()),
+	}
+
+	for _, a := range r.attributes {
+		as := attributeState{
+			Name:          a.name,
+			TypeName:      a.typeName,
+			DefaultExpr:   a.defaultExpr,
+			AutoIncrement: a.autoIncrement,
+			NextValue:     a.nextValue,
+			StartValue:    a.startValue,
+			Unique:        a.unique,
+			NotNull:       a.notNull,
+		}
+		switch a.defaultExpr {
+		case "NOW()", "CURRENT_DATE", "RANDOM()":
+		case "":
+			if a.defaultValue != nil {
+				return rs, fmt.Errorf("cannot save default value of attribute %s.%s", r.name, a.name)
+			}
+		default:
+			as.Default = a.defaultValue()
+		}
+		if a.fk != nil {
+			as.FK = &foreignKeyState{Schema: a.fk.schema, Relation: a.fk.relation, Attribute: a.fk.attribute}
+		}
+		if a.collation != nil {
+			as.Collation = a.collation.Name()
+		}
+		if a.enum != nil {
+			as.Enum = &enumState{Name: a.enum.name, Labels: a.enum.Labels()}
+		}
+		if a.domain != nil {
+			ds := a.domain.state()
+			as.Domain = &ds
+		}
+		rs.Attributes = append(rs.Attributes, as)
+	}
+
+	for _, i := range r.indexes {
+		switch i := i.(type) {
+		case *HashIndex:
+			rs.Indexes = append(rs.Indexes, indexState{Name: i.name, Attrs: append([]int(nil), i.attrs...), AttrsName: i.attrsName, Unique: i.unique})
+		case *BTreeIndex:
+			rs.Indexes = append(rs.Indexes, indexState{Name: i.name, BTree: true, Attrs: append([]int(nil), i.attrs...), AttrsName: i.attrsName, Unique: i.unique})
+		default:
+			return rs, fmt.Errorf("cannot save index %s of relation %s", i.Name(), r.name)
+		}
+	}
+
+	for e := r.rows.Front(); e != nil; e = e.Next() {
+		values := make([]any, len(e.Value.(*Tuple).values))
+		copy(values, e.Value.(*Tuple).values)
+		rs.Rows = append(rs.Rows, values)
+	}
+
+	return rs, nil
+}
+
+// relation rebuilds relation and its indexes from saved state
+func (rs relationState) relation() (*Relation, error) {
+	attributes := make([]Attribute, len(rs.Attributes))
+	for i, as := range rs.Attributes {
+		a := NewAttribute(as.Name, as.TypeName)
+		// domain sets the type of default value
+		if as.Domain != nil {
+			d, err := as.Domain.domain()
+			if err != nil {
+				return nil, err
+			}
+			a = a.WithDomain(d)
+		}
+		switch as.DefaultExpr {
+		case "":
+		case "NOW()":
+			a = a.WithDefaultNow()
+		case "CURRENT_DATE":
+			a = a.WithDefaultCurrentDate()
+		case "RANDOM()":
+			a = a.WithDefaultRandom()
+		default:
+			a = a.WithDefaultConst(as.Default)
+		}
+		a.autoIncrement = as.AutoIncrement
+		a.nextValue = as.NextValue
+		a.startValue = as.StartValue
+		if a.autoIncrement && a.startValue == 0 {
+			// saved before start values were
+			a.startValue = 1
+		}
+		a.unique = as.Unique
+		a.notNull = as.NotNull
+		if as.FK != nil {
+			a = a.WithForeignKey(as.FK.Schema, as.FK.Relation, as.FK.Attribute)
+		}
+		if as.Collation != "" {
+			c, err := NewCollation(as.Collation)
+			if err != nil {
+				return nil, err
+			}
+			a = a.WithCollation(c)
+		}
+		if as.Enum != nil {
+			enum, err := NewEnum(as.Enum.Name, as.Enum.Labels)
+			if err != nil {
+				return nil, err
+			}
+			a = a.WithEnum(enum)
+		}
+		attributes[i] = a
+	}
+
+	r := &Relation{
+		name:       rs.Name,
+		schema:     rs.Schema,
+		attributes: attributes,
+		attrIndex:  make(map[string]int),
+		pk:         rs.PK,
+		rows:       list.New(),
+	}
+	for i, a := range attributes {
+		r.attrIndex[a.name] = i
+	}
+
+	for _, is := range rs.Indexes {
+		for _, idx := range is.Attrs {
+			if idx < 0 || idx >= len(attributes) {
+				return nil, fmt.Errorf("cannot load index %s of relation %s: invalid attribute", is.Name, rs.Name)
+			}
+		}
+		if is.BTree {
+			r.indexes = append(r.indexes, NewBTreeIndex(is.Name, rs.Name, attributes, is.AttrsName, is.Attrs, is.Unique))
+			continue
+		}
+		r.indexes = append(r.indexes, NewHashIndex(is.Name, rs.Name, attributes, is.AttrsName, is.Attrs, is.Unique))
+	}
+
+	for _, values := range rs.Rows {
+		if len(values) != len(attributes) {
+			return nil, fmt.Errorf("cannot load relation %s: row has %d values, expected %d", rs.Name, len(values), len(attributes))
+		}
+		e := r.rows.PushBack(&Tuple{values: values, version: 1})
+		for _, i := range r.indexes {
+			i.Add(e)
+		}
+	}
+
+	return r, nil
+}
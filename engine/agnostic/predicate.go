@@ -3,9 +3,9 @@ package agnostic
 import (
 	"bytes"
 	"container/list"
+	"context"
 	"errors"
 	"fmt"
-	"hash/maphash"
 	"reflect"
 	"sort"
 	"strings"
@@ -30,6 +30,11 @@ const (
 	Not
 	True
 	False
+	Exists
+	IsNull
+	Regex
+	ArrayOp
+	Any
 )
 
 var (
@@ -55,7 +60,7 @@ type Picker interface {
 //   - NowValueFunctor
 type ValueFunctor interface {
 	Picker
-	Value(columns []string, tuple *Tuple) any
+	Value(columns []string, tuple *Tuple) (any, error)
 }
 
 // Selector defines values to be returned to user
@@ -98,6 +103,85 @@ type Node interface {
 	Children() []Node
 }
 
+// AnalyzeNode wraps a Node to record the number of rows it produces and
+// the time spent in its Exec, children included.
+type AnalyzeNode struct {
+	src       Node
+	estimated int64
+	rows      int64
+	duration  time.Duration
+	done      bool
+}
+
+// NewAnalyzeNode wraps src, keeping its estimated cardinal before execution
+func NewAnalyzeNode(src Node) *AnalyzeNode {
+	return &AnalyzeNode{src: src, estimated: src.EstimateCardinal()}
+}
+
+func (an AnalyzeNode) String() string {
+	return fmt.Sprintf("%s", an.src)
+}
+
+func (an *AnalyzeNode) Exec() ([]string, []*list.Element, error) {
+	start := time.Now()
+	cols, res, err := an.src.Exec()
+	an.duration += time.Since(start)
+	an.rows += int64(len(res))
+	an.done = true
+	return cols, res, err
+}
+
+func (an *AnalyzeNode) EstimateCardinal() int64 {
+	return an.estimated
+}
+
+func (an *AnalyzeNode) Children() []Node {
+	return an.src.Children()
+}
+
+// recAnalyzeNode wraps n and all its descendants into AnalyzeNodes
+func recAnalyzeNode(n Node) *AnalyzeNode {
+	switch n := n.(type) {
+	case *SelectorNode:
+		n.child = recAnalyzeNode(n.child)
+	case Joiner:
+		c := n.Children()
+		n.SetLeft(recAnalyzeNode(c[0]))
+		n.SetRight(recAnalyzeNode(c[1]))
+	case Sorter:
+		if c := n.Children(); len(c) == 1 && c[0] != nil {
+			n.SetNode(recAnalyzeNode(c[0]))
+		}
+	}
+
+	return NewAnalyzeNode(n)
+}
+
+// ResultNode yields a single row without attribute, on which selectors of a
+// query without relation are computed, like SELECT 1.
+type ResultNode struct{}
+
+func NewResultNode() *ResultNode {
+	return &ResultNode{}
+}
+
+func (rn ResultNode) String() string {
+	return "Result"
+}
+
+func (rn *ResultNode) Exec() ([]string, []*list.Element, error) {
+	l := list.New()
+	return nil, []*list.Element{l.PushBack(&Tuple{})}, nil
+}
+
+func (rn *ResultNode) EstimateCardinal() int64 {
+	return 1
+}
+
+func (rn *ResultNode) Children() []Node {
+	return nil
+}
+
 type SubqueryNode struct {
 	src Node
 }
@@ -226,10 +310,10 @@ func (s *OffsetSorter) Exec() ([]string, []*list.Element, error) {
 		return nil, nil, err
 	}
 
-	if len(res) > s.o {
-		res = res[s.o:]
+	if len(res) <= s.o {
+		return cols, nil, nil
 	}
-	return cols, res, nil
+	return cols, res[s.o:], nil
 }
 
 func (s *OffsetSorter) EstimateCardinal() int64 {
@@ -308,16 +392,45 @@ const (
 type SortExpression struct {
 	attr      string
 	direction SortType
+	collation *Collation
 }
 
 func NewSortExpression(attr string, direction SortType) SortExpression {
 	return SortExpression{attr: attr, direction: direction}
 }
 
+// WithCollation returns sort expression ordering strings with collation c
+func (e SortExpression) WithCollation(c *Collation) SortExpression {
+	e.collation = c
+	return e
+}
+
+func (e SortExpression) String() string {
+	s := e.attr
+	if e.collation != nil {
+		s += " COLLATE " + e.collation.String()
+	}
+	if e.direction == DESC {
+		s += " DESC"
+	}
+	return s
+}
+
+// collated returns true if sort expression orders strings with a collation
+// other than byte order
+func (e SortExpression) collated() bool {
+	return e.collation != nil && !e.collation.bytewise
+}
+
 type OrderBySorter struct {
 	rel   string
 	attrs []SortExpression
 	src   Node
+	// sorted is set by planner when src already returns rows in order
+	sorted bool
+	// stable keeps rows with equal sort values in source order, see
+	// SetStableOrder
+	stable bool
 }
 
 func NewOrderBySorter(rel string, attrs []SortExpression) *OrderBySorter {
@@ -327,6 +440,9 @@ func NewOrderBySorter(rel string, attrs []SortExpression) *OrderBySorter {
 }
 
 func (s OrderBySorter) String() string {
+	if s.sorted {
+		return fmt.Sprintf("OrderBy %s.%v (index)", s.rel, s.attrs)
+	}
 	return fmt.Sprintf("OrderBy %s.%v", s.rel, s.attrs)
 }
 
@@ -335,6 +451,9 @@ func (s *OrderBySorter) Exec() ([]string, []*list.Element, error) {
 	if err != nil {
 		return nil, nil, err
 	}
+	if s.sorted {
+		return cols, res, nil
+	}
 
 	var idxs []int
 	for _, a := range s.attrs {
@@ -354,6 +473,13 @@ func (s *OrderBySorter) Exec() ([]string, []*list.Element, error) {
 			v1 := t1.Value.(*Tuple).values[idx]
 			v2 := t2.Value.(*Tuple).values[idx]
 
+			if c, ok := s.attrs[i].collation.collate(v1, v2); ok {
+				if c == 0 {
+					continue
+				}
+				return (c < 0) == (s.attrs[i].direction == ASC)
+			}
+
 			eq, err := equal(v1, v2)
 			if err != nil {
 				log.Warn("%s: %s", s, err)
@@ -374,9 +500,13 @@ func (s *OrderBySorter) Exec() ([]string, []*list.Element, error) {
 			}
 			return comp
 		}
-		return true
+		return !s.stable
 	}
 
+	if s.stable {
+		sort.SliceStable(res, closure)
+		return cols, res, nil
+	}
 	sort.Slice(res, closure)
 	return cols, res, nil
 }
@@ -456,13 +586,9 @@ func (s DistinctSorter) String() string {
 	return fmt.Sprintf("Distinct on %s.%v", s.rel, s.attrs)
 }
 
+// Exec keeps the first row of each distinct value of sorter attributes, in
+// the order of source rows. Attributes may be qualified by their relation.
 func (d *DistinctSorter) Exec() ([]string, []*list.Element, error) {
-	m := make(map[uint64]*list.Element)
-	var h maphash.Hash
-	var ok bool
-
-	h.SetSeed(maphash.MakeSeed())
-
 	cols, in, err := d.src.Exec()
 	if err != nil {
 		return nil, nil, err
@@ -470,32 +596,48 @@ func (d *DistinctSorter) Exec() ([]string, []*list.Element, error) {
 
 	var idxs []int
 	for _, a := range d.attrs {
-		for i, c := range cols {
-			if c == a || c == d.rel+"."+a {
-				idxs = append(idxs, i)
-			}
+		idx := distinctColumn(cols, d.rel, a)
+		if idx == -1 {
+			return nil, nil, NewError(UndefinedColumn, "column %s does not exist", a)
 		}
+		idxs = append(idxs, idx)
 	}
 
+	seen := make(map[string]bool)
+	var res []*list.Element
+	var b strings.Builder
 	for _, t := range in {
+		b.Reset()
 		for _, idx := range idxs {
-			h.Write([]byte(fmt.Sprintf("%v", t.Value.(*Tuple).values[idx])))
+			fmt.Fprintf(&b, "%v", t.Value.(*Tuple).values[idx])
+			b.WriteByte(0)
 		}
-		sum := h.Sum64()
-		h.Reset()
-		_, ok = m[sum]
-		if !ok {
-			m[sum] = t
+		if key := b.String(); !seen[key] {
+			seen[key] = true
+			res = append(res, t)
 		}
 	}
+	return cols, res, nil
+}
 
-	res := make([]*list.Element, len(m))
-	var i int
-	for _, t := range m {
-		res[i] = t
-		i++
+// distinctColumn returns the index in cols of attribute a of relation rel,
+// or -1 if not found. Unqualified attribute a matches any relation.
+func distinctColumn(cols []string, rel, a string) int {
+	for i, c := range cols {
+		if c == a || c == rel+"."+a {
+			return i
+		}
 	}
-	return cols, res, nil
+	if strings.Contains(a, ".") {
+		// relation columns may be unqualified
+		return distinctColumn(cols, rel, a[strings.Index(a, ".")+1:])
+	}
+	for i, c := range cols {
+		if strings.HasSuffix(c, "."+a) {
+			return i
+		}
+	}
+	return -1
 }
 
 func (d *DistinctSorter) EstimateCardinal() int64 {
@@ -563,13 +705,15 @@ func (s *AttributeSelector) Alias() string {
 	return s.alias
 }
 
+// versionIndex is the column index of VersionAttribute, which is not a column
+const versionIndex = -2
+
 func (s *AttributeSelector) Select(cols []string, in []*list.Element) (out []*Tuple, err error) {
 	idx := make([]int, len(s.attributes))
 	for attrIdx, attr := range s.attributes {
 		idx[attrIdx] = -1
-		lattr := strings.ToLower(attr)
-		for i, c := range cols {
-			lc := strings.ToLower(c)
+		lattr := attr
+		for i, lc := range cols {
 			if lc == lattr {
 				idx[attrIdx] = i
 				break
@@ -583,6 +727,9 @@ func (s *AttributeSelector) Select(cols []string, in []*list.Element) (out []*Tu
 				break
 			}
 		}
+		if idx[attrIdx] == -1 && lattr == VersionAttribute {
+			idx[attrIdx] = versionIndex
+		}
 		if idx[attrIdx] == -1 {
 			return nil, fmt.Errorf("AttributeSelector(%s) not found in %s", attr, cols)
 		}
@@ -601,8 +748,12 @@ func (s *AttributeSelector) Select(cols []string, in []*list.Element) (out []*Tu
 			return nil, fmt.Errorf("provided tuple %v does not match anounced columns %s", srct.values, cols)
 		}
 
-		t := NewTuple()
+		t := getTuple(len(idx))
 		for _, id := range idx {
+			if id == versionIndex {
+				t.Append(srct.rowVersion())
+				continue
+			}
 			v := srct.values[id]
 			t.Append(v)
 		}
@@ -648,22 +799,42 @@ func (s *CountSelector) Alias() string {
 }
 
 func (s *CountSelector) Select(cols []string, in []*list.Element) (out []*Tuple, err error) {
+	count, err := s.count(cols, in)
+	if err != nil {
+		return nil, err
+	}
+
+	s.cols = []string{"COUNT(" + s.attribute + ")"}
+	out = append(out, NewTuple(count))
+	return
+}
+
+// count returns the number of rows, or of non NULL values of attribute
+func (s *CountSelector) count(cols []string, in []*list.Element) (int64, error) {
+	if s.attribute == "*" {
+		return int64(len(in)), nil
+	}
+
 	var idx int
 	idx = -1
 	for i, c := range cols {
-		if s.attribute == "*" || c == s.attribute || c == s.relation+"."+s.attribute {
+		if c == s.attribute || c == s.relation+"."+s.attribute {
 			idx = i
 			break
 		}
 	}
 	if idx == -1 {
-		return nil, fmt.Errorf("%s.%s: columns not found in left node", s.relation, s.attribute)
+		return 0, fmt.Errorf("%s.%s: columns not found in left node", s.relation, s.attribute)
 	}
 
-	s.cols = []string{"COUNT(" + s.attribute + ")"}
-	t := NewTuple(int64(len(in)))
-	out = append(out, t)
-	return
+	// COUNT(attribute) ignores NULL values
+	var count int64
+	for _, e := range in {
+		if e.Value.(*Tuple).values[idx] != nil {
+			count++
+		}
+	}
+	return count, nil
 }
 
 type StarSelector struct {
@@ -716,9 +887,9 @@ func (s *StarSelector) Select(cols []string, in []*list.Element) (out []*Tuple,
 	// need to re-select table
 	for _, e := range in {
 		intup := e.Value.(*Tuple)
-		outtup := &Tuple{values: make([]any, len(colIdx))}
-		for i, idx := range colIdx {
-			outtup.values[i] = intup.values[idx]
+		outtup := getTuple(len(colIdx))
+		for _, idx := range colIdx {
+			outtup.values = append(outtup.values, intup.values[idx])
 		}
 		out = append(out, outtup)
 	}
@@ -729,14 +900,85 @@ func (s StarSelector) String() string {
 	return s.relation + ".*"
 }
 
-type AvgSelector struct {
+// ConstSelector returns the same value for every row, like the result of a
+// scalar subquery in a SELECT list.
+type ConstSelector struct {
+	relation string
+	name     string
+	value    any
+}
+
+func NewConstSelector(rname string, name string, v any) *ConstSelector {
+	s := &ConstSelector{
+		relation: rname,
+		name:     name,
+		value:    v,
+	}
+	return s
+}
+
+func (s *ConstSelector) Attribute() []string {
+	return []string{s.name}
+}
+
+func (s *ConstSelector) Relation() string {
+	return s.relation
+}
+
+func (s *ConstSelector) Alias() string {
+	return ""
+}
+
+func (s *ConstSelector) Select(cols []string, in []*list.Element) (out []*Tuple, err error) {
+	out = make([]*Tuple, len(in))
+	for i := range in {
+		out[i] = getTuple(1)
+		out[i].values = append(out[i].values, s.value)
+	}
+	return
+}
+
+func (s ConstSelector) String() string {
+	return fmt.Sprintf("%v AS %s", s.value, s.name)
+}
+
+// NamedSelector renames the column returned by a selector, like
+// SELECT COUNT(*) AS total.
+type NamedSelector struct {
+	Selector
+	name string
+}
+
+func NewNamedSelector(s Selector, name string) *NamedSelector {
+	return &NamedSelector{
+		Selector: s,
+		name:     name,
+	}
+}
+
+func (s *NamedSelector) Attribute() []string {
+	return []string{s.name}
 }
 
-type MaxSelector struct {
+func (s NamedSelector) String() string {
+	return fmt.Sprintf("%s AS %s", s.Selector, s.name)
 }
 
+// NewComparisonPredicate returns the predicate comparing left and right. If
+// either is collated, strings are compared with its collation.
 func NewComparisonPredicate(left ValueFunctor, t PredicateType, right ValueFunctor) (Predicate, error) {
+	c, left, right, err := comparisonCollation(left, right)
+	if err != nil {
+		return nil, err
+	}
+	p, err := newComparisonPredicate(left, t, right)
+	if err != nil || c == nil || c.bytewise {
+		return p, err
+	}
+	return NewCollatedPredicate(p, c)
+}
 
+func newComparisonPredicate(left ValueFunctor, t PredicateType, right ValueFunctor) (Predicate, error) {
 	switch t {
 	case Eq:
 		return NewEqPredicate(left, right), nil
@@ -772,14 +1014,23 @@ func (p *NotPredicate) Type() PredicateType {
 	return Not
 }
 
+// Eval follows SQL three-valued logic: NOT of an unknown predicate, like a
+// comparison with NULL, is unknown and so false.
 func (p *NotPredicate) Eval(cols []string, t *Tuple) (bool, error) {
 
 	e, err := p.src.Eval(cols, t)
 	if err != nil {
 		return false, err
 	}
+	if e {
+		return false, nil
+	}
 
-	return !e, nil
+	u, err := unknown(p.src, cols, t)
+	if err != nil {
+		return false, err
+	}
+	return !u, nil
 }
 
 func (p *NotPredicate) Left() (Predicate, bool) {
@@ -798,6 +1049,135 @@ func (p *NotPredicate) Attribute() []string {
 	return p.src.Attribute()
 }
 
+// IsNullPredicate is true when its value is NULL
+type IsNullPredicate struct {
+	v ValueFunctor
+}
+
+func NewIsNullPredicate(v ValueFunctor) *IsNullPredicate {
+	return &IsNullPredicate{v: v}
+}
+
+func (p IsNullPredicate) String() string {
+	return fmt.Sprintf("%s IS NULL", p.v)
+}
+
+func (p *IsNullPredicate) Type() PredicateType {
+	return IsNull
+}
+
+func (p *IsNullPredicate) Eval(cols []string, t *Tuple) (bool, error) {
+	v, err := p.v.Value(cols, t)
+	if err != nil {
+		return false, err
+	}
+	return v == nil, nil
+}
+
+func (p *IsNullPredicate) Left() (Predicate, bool) {
+	return nil, false
+}
+
+func (p *IsNullPredicate) Right() (Predicate, bool) {
+	return nil, false
+}
+
+func (p *IsNullPredicate) Relation() string {
+	return p.v.Relation()
+}
+
+func (p *IsNullPredicate) Attribute() []string {
+	return p.v.Attribute()
+}
+
+// unknown returns true if p evaluates to NULL on tuple t, following SQL
+// three-valued logic: a comparison with NULL is unknown, AND is unknown
+// unless a side is false, OR is unknown unless a side is true.
+func unknown(p Predicate, cols []string, t *Tuple) (bool, error) {
+	switch p := p.(type) {
+	case *NotPredicate:
+		return unknown(p.src, cols, t)
+	case *AndPredicate, *OrPredicate:
+		lp, _ := p.Left()
+		rp, _ := p.Right()
+		sides := [2]Predicate{lp, rp}
+		var isUnknown bool
+		for _, side := range sides {
+			v, err := side.Eval(cols, t)
+			if err != nil {
+				return false, err
+			}
+			u, err := unknown(side, cols, t)
+			if err != nil {
+				return false, err
+			}
+			// a known false side decides AND, a true one decides OR
+			if !u && v == (p.Type() == Or) {
+				return false, nil
+			}
+			isUnknown = isUnknown || u
+		}
+		return isUnknown, nil
+	case *RegexPredicate:
+		return p.unknown(cols, t)
+	case *ArrayPredicate:
+		return p.unknown(cols, t)
+	case *AnyPredicate:
+		return p.unknown(cols, t)
+	case *InPredicate:
+		in, err := p.Eval(cols, t)
+		if err != nil || in {
+			return false, err
+		}
+		v, err := p.v.Value(cols, t)
+		if err != nil || v == nil {
+			return v == nil, err
+		}
+		// value is not in a list holding NULL: it may be
+		for _, r := range p.res {
+			if r.values[0] == nil {
+				return true, nil
+			}
+		}
+		return false, nil
+	}
+
+	left, right, ok := operands(p)
+	if !ok {
+		return false, nil
+	}
+	vl, err := left.Value(cols, t)
+	if err != nil {
+		return false, err
+	}
+	vr, err := right.Value(cols, t)
+	if err != nil {
+		return false, err
+	}
+	return vl == nil || vr == nil, nil
+}
+
+// operands returns the values compared by comparison predicate p
+func operands(p Predicate) (left, right ValueFunctor, ok bool) {
+	switch p := p.(type) {
+	case *EqPredicate:
+		return p.left, p.right, true
+	case *NeqPredicate:
+		return p.left, p.right, true
+	case *GeqPredicate:
+		return p.left, p.right, true
+	case *GePredicate:
+		return p.left, p.right, true
+	case *LeqPredicate:
+		return p.left, p.right, true
+	case *LePredicate:
+		return p.left, p.right, true
+	case *CollatedPredicate:
+		return p.left, p.right, true
+	}
+	return nil, nil, false
+}
+
 type InPredicate struct {
 	v    ValueFunctor
 	src  Node
@@ -831,7 +1211,10 @@ func (p *InPredicate) Eval(inCols []string, in *Tuple) (bool, error) {
 		}
 	}
 
-	lv := p.v.Value(inCols, in)
+	lv, err := p.v.Value(inCols, in)
+	if err != nil {
+		return false, err
+	}
 
 	for _, t := range p.res {
 		rv := t.values[0]
@@ -863,6 +1246,51 @@ func (p *InPredicate) Attribute() []string {
 	return p.v.Attribute()
 }
 
+// ExistsPredicate is true when its subquery returns at least one row.
+//
+// Subquery is given the evaluated row, so correlated subqueries can
+// reference attributes of the outer relation.
+type ExistsPredicate struct {
+	relation string
+	subquery func([]string, *Tuple) (bool, error)
+}
+
+func NewExistsPredicate(rname string, subquery func([]string, *Tuple) (bool, error)) *ExistsPredicate {
+	p := &ExistsPredicate{
+		relation: rname,
+		subquery: subquery,
+	}
+	return p
+}
+
+func (p ExistsPredicate) String() string {
+	return "EXISTS (subquery)"
+}
+
+func (p *ExistsPredicate) Type() PredicateType {
+	return Exists
+}
+
+func (p *ExistsPredicate) Eval(cols []string, t *Tuple) (bool, error) {
+	return p.subquery(cols, t)
+}
+
+func (p *ExistsPredicate) Left() (Predicate, bool) {
+	return nil, false
+}
+
+func (p *ExistsPredicate) Right() (Predicate, bool) {
+	return nil, false
+}
+
+func (p *ExistsPredicate) Relation() string {
+	return p.relation
+}
+
+func (p *ExistsPredicate) Attribute() []string {
+	return nil
+}
+
 type TruePredicate struct {
 }
 
@@ -899,10 +1327,24 @@ func (p *TruePredicate) Attribute() []string {
 }
 
 type FalsePredicate struct {
+	relation string
+}
+
+func NewFalsePredicate(functors ...func(*FalsePredicate)) *FalsePredicate {
+	p := &FalsePredicate{}
+
+	for _, f := range functors {
+		f(p)
+	}
+
+	return p
 }
 
-func NewFalsePredicate() *FalsePredicate {
-	return &FalsePredicate{}
+// OnRelation binds predicate to given relation, so it is evaluated when scanning it
+func OnRelation(rel string) func(*FalsePredicate) {
+	return func(p *FalsePredicate) {
+		p.relation = rel
+	}
 }
 
 func (p FalsePredicate) String() string {
@@ -926,7 +1368,7 @@ func (p *FalsePredicate) Right() (Predicate, bool) {
 }
 
 func (p *FalsePredicate) Relation() string {
-	return ""
+	return p.relation
 }
 
 func (p *FalsePredicate) Attribute() []string {
@@ -1012,7 +1454,7 @@ func (p OrPredicate) String() string {
 }
 
 func (p *OrPredicate) Type() PredicateType {
-	return And
+	return Or
 }
 
 func (p *OrPredicate) Eval(cols []string, t *Tuple) (bool, error) {
@@ -1077,8 +1519,18 @@ func (p EqPredicate) String() string {
 
 func (p *EqPredicate) Eval(cols []string, t *Tuple) (bool, error) {
 
-	vl := p.left.Value(cols, t)
-	vr := p.right.Value(cols, t)
+	vl, err := p.left.Value(cols, t)
+	if err != nil {
+		return false, err
+	}
+	vr, err := p.right.Value(cols, t)
+	if err != nil {
+		return false, err
+	}
+	// comparison with NULL is unknown
+	if vl == nil || vr == nil {
+		return false, nil
+	}
 
 	return equal(vl, vr)
 }
@@ -1140,6 +1592,8 @@ type SelectorNode struct {
 	selectors []Selector
 	child     Node
 	columns   []string
+	// maximum number of goroutines computing aggregates
+	workers int
 }
 
 func NewSelectorNode(selectors []Selector, n Node) *SelectorNode {
@@ -1171,9 +1625,32 @@ func (sn *SelectorNode) Exec() ([]string, []*list.Element, error) {
 	outs := make([][]*Tuple, len(sn.selectors))
 	var resc []string
 
+	aggregate := false
+	for _, selector := range sn.selectors {
+		if isAggregate(selector) {
+			aggregate = true
+			break
+		}
+	}
+
 	var prevLen int
 	for i, selector := range sn.selectors {
-		out, err := selector.Select(cols, srcs)
+		var out []*Tuple
+		switch {
+		case aggregate && isAggregate(selector):
+			out, err = aggregateSelect(selector, cols, srcs, sn.workers)
+		case !aggregate:
+			out, err = selector.Select(cols, srcs)
+		case isConst(selector):
+			// constants are returned once alongside aggregates
+			out, err = selector.Select(cols, []*list.Element{nil})
+		default:
+			name := strings.Join(selector.Attribute(), ", ")
+			if name == "" {
+				name = fmt.Sprint(selector)
+			}
+			err = NewError(GroupingError, "column \"%s\" must appear in the GROUP BY clause or be used in an aggregate function", name).On("", name)
+		}
 		if err != nil {
 			return nil, nil, err
 		}
@@ -1206,9 +1683,26 @@ func (sn *SelectorNode) Exec() ([]string, []*list.Element, error) {
 		res[i] = e
 	}
 
+	// values are copied, selectors tuples can be reused
+	for x := range outs {
+		for _, t := range outs[x] {
+			putTuple(t)
+		}
+	}
+
 	return resc, res, nil
 }
 
+// isConst returns true if selector returns the same value for every row
+func isConst(s Selector) bool {
+	if ns, ok := s.(*NamedSelector); ok {
+		s = ns.Selector
+	}
+
+	_, ok := s.(*ConstSelector)
+	return ok
+}
+
 func (sn *SelectorNode) Columns() []string {
 	return sn.columns
 }
@@ -1229,6 +1723,17 @@ type NaturalJoin struct {
 	rightr string
 	righta string
 	right  Node
+
+	// more attributes of left and right relations joined by equality
+	more []joinAttrs
+	// filter is applied to joined rows, if any
+	filter Predicate
+
+	ctx context.Context
+}
+
+type joinAttrs struct {
+	left, right string
 }
 
 func NewNaturalJoin(leftRel, leftAttr, rightRel, rightAttr string) *NaturalJoin {
@@ -1241,8 +1746,33 @@ func NewNaturalJoin(leftRel, leftAttr, rightRel, rightAttr string) *NaturalJoin
 	return j
 }
 
+// And makes j also require leftAttr of left relation to equal rightAttr of
+// right relation
+func (j *NaturalJoin) And(leftAttr, rightAttr string) *NaturalJoin {
+	j.more = append(j.more, joinAttrs{left: leftAttr, right: rightAttr})
+	return j
+}
+
+// Filter makes j only keep joined rows matching p, like a condition
+// comparing attributes of both relations other than by equality
+func (j *NaturalJoin) Filter(p Predicate) *NaturalJoin {
+	if j.filter == nil {
+		j.filter = p
+	} else {
+		j.filter = NewAndPredicate(j.filter, p)
+	}
+	return j
+}
+
 func (j NaturalJoin) String() string {
-	return "JOIN " + j.leftr + "." + j.lefta + " >< " + j.rightr + "." + j.righta
+	s := "JOIN " + j.leftr + "." + j.lefta + " >< " + j.rightr + "." + j.righta
+	for _, m := range j.more {
+		s += " AND " + j.leftr + "." + m.left + " >< " + j.rightr + "." + m.right
+	}
+	if j.filter != nil {
+		s += fmt.Sprintf(" AND %s", j.filter)
+	}
+	return s
 }
 
 func (j *NaturalJoin) Left() string {
@@ -1261,12 +1791,23 @@ func (j *NaturalJoin) SetRight(n Node) {
 	j.right = n
 }
 
+// EstimateCardinal divides the product of both sides by the greatest number
+// of distinct values of join attributes, if both relations are analyzed.
 func (j *NaturalJoin) EstimateCardinal() int64 {
 	if j.left == nil || j.right == nil {
 		return 0
 	}
 
-	return int64((j.left.EstimateCardinal() * j.right.EstimateCardinal()) / 2)
+	card := j.left.EstimateCardinal() * j.right.EstimateCardinal()
+	dl, dr := distinct(j.left, j.lefta), distinct(j.right, j.righta)
+	if dl > 0 && dr > 0 {
+		if dr > dl {
+			dl = dr
+		}
+		return card / dl
+	}
+
+	return int64(card / 2)
 }
 
 func (j *NaturalJoin) Children() []Node {
@@ -1279,14 +1820,7 @@ func (j *NaturalJoin) Exec() ([]string, []*list.Element, error) {
 	if err != nil {
 		return nil, nil, err
 	}
-	var lidx int
-	lidx = -1
-	for i, c := range lcols {
-		if c == j.lefta || c == j.leftr+"."+j.lefta {
-			lidx = i
-			break
-		}
-	}
+	lidx := joinColumn(lcols, j.leftr, j.lefta)
 	if lidx == -1 {
 		return nil, nil, fmt.Errorf("%s: columns not found in left node", j)
 	}
@@ -1296,19 +1830,21 @@ func (j *NaturalJoin) Exec() ([]string, []*list.Element, error) {
 	if err != nil {
 		return nil, nil, err
 	}
-	var ridx int
-	ridx = -1
-	for i, c := range rcols {
-		if c == j.righta || c == j.rightr+"."+j.righta {
-			ridx = i
-			break
-		}
-	}
+	ridx := joinColumn(rcols, j.rightr, j.righta)
 	if ridx == -1 {
 		return nil, nil, fmt.Errorf("%s: columns not found in right node", j)
 	}
 	log.Debug("NaturalJoin.Exec: Found right (%s) %d in %v", j.righta, ridx, rcols)
 
+	// indexes of more joined attributes
+	lmore, rmore := make([]int, len(j.more)), make([]int, len(j.more))
+	for i, m := range j.more {
+		lmore[i], rmore[i] = joinColumn(lcols, j.leftr, m.left), joinColumn(rcols, j.rightr, m.right)
+		if lmore[i] == -1 || rmore[i] == -1 {
+			return nil, nil, fmt.Errorf("%s: columns not found", j)
+		}
+	}
+
 	cols := make([]string, len(lcols)+len(rcols))
 	var idx int
 	for _, c := range lcols {
@@ -1330,17 +1866,58 @@ func (j *NaturalJoin) Exec() ([]string, []*list.Element, error) {
 
 	log.Debug("NaturalJoin.Exec: New cols: %v", cols)
 
-	// prepare for worst case cross join
+	// look rows of a side up in its index for each row of the other side
+	if sc, lk, ok := indexLookup(j.right); ok {
+		res, err := j.lookup(cols, lefts, lidx, sc, lk, ridx, lmore, rmore, false)
+		countLookup(j.right, res)
+		return cols, res, err
+	}
+	if sc, lk, ok := indexLookup(j.left); ok {
+		res, err := j.lookup(cols, rights, ridx, sc, lk, lidx, rmore, lmore, true)
+		countLookup(j.left, res)
+		return cols, res, err
+	}
+
+	// hash right rows by the values of all joined attributes, then probe
+	// hash with each left row
+	lkeys, rkeys := append([]int{lidx}, lmore...), append([]int{ridx}, rmore...)
+	hash := make(map[string][]*list.Element)
+	for _, right := range rights {
+		if key, ok := joinKey(right.Value.(*Tuple), rkeys); ok {
+			hash[key] = append(hash[key], right)
+		}
+	}
+
+	// context is checked every ctxCheckInterval rows compared, so that a key
+	// matching many rows on both sides is interrupted too
+	var n int
 	l := list.New()
 	for _, left := range lefts {
-		for _, right := range rights {
-			ok, err := equal(left.Value.(*Tuple).values[lidx], right.Value.(*Tuple).values[ridx])
+		key, ok := joinKey(left.Value.(*Tuple), lkeys)
+		if !ok {
+			continue
+		}
+		for _, right := range hash[key] {
+			if n%ctxCheckInterval == 0 {
+				if err := ctxErr(j.ctx); err != nil {
+					return nil, nil, err
+				}
+			}
+			n++
+			// values of different types may have the same key
+			ok, err := equalAll(left.Value.(*Tuple), lkeys, right.Value.(*Tuple), rkeys)
 			if err != nil {
 				return nil, nil, err
 			}
+			if !ok {
+				continue
+			}
+			t := NewTuple(left.Value.(*Tuple).values...)
+			t.Append(right.Value.(*Tuple).values...)
+			if ok, err = j.match(cols, t); err != nil {
+				return nil, nil, err
+			}
 			if ok {
-				t := NewTuple(left.Value.(*Tuple).values...)
-				t.Append(right.Value.(*Tuple).values...)
 				l.PushBack(t)
 			}
 		}
@@ -1355,6 +1932,180 @@ func (j *NaturalJoin) Exec() ([]string, []*list.Element, error) {
 	return cols, res, nil
 }
 
+// match returns whether joined tuple t matches join filter, if any
+func (j *NaturalJoin) match(cols []string, t *Tuple) (bool, error) {
+	if j.filter == nil {
+		return true, nil
+	}
+	return j.filter.Eval(cols, t)
+}
+
+// joinKey returns the hash key of values of t at idx, or false if one of
+// them is NULL, as NULL joins nothing. Values equal as per equal have the
+// same key.
+func joinKey(t *Tuple, idx []int) (string, bool) {
+	var b strings.Builder
+	for _, i := range idx {
+		switch v := t.values[i].(type) {
+		case nil:
+			return "", false
+		case time.Time:
+			fmt.Fprintf(&b, "%d", v.Unix())
+		case Interval:
+			fmt.Fprintf(&b, "%v", v.nanos())
+		default:
+			fmt.Fprintf(&b, "%v", v)
+		}
+		b.WriteByte(0)
+	}
+	return b.String(), true
+}
+
+// joinColumn returns the index of attribute attr of relation rel in cols,
+// or -1 if not found
+func joinColumn(cols []string, rel, attr string) int {
+	for i, c := range cols {
+		if c == attr || c == rel+"."+attr {
+			return i
+		}
+	}
+	return -1
+}
+
+// equalAll returns whether values of l at lidx equal values of r at ridx
+func equalAll(l *Tuple, lidx []int, r *Tuple, ridx []int) (bool, error) {
+	for i := range lidx {
+		ok, err := equal(l.values[lidx[i]], r.values[ridx[i]])
+		if err != nil || !ok {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+// useIndex makes join look rows of a side up by the Hash index on its join
+// attribute, if side is a sequential scan of given relation. Right side is
+// preferred.
+func (j *NaturalJoin) useIndex(relations map[string]*Relation) {
+	sides := []struct {
+		n    Node
+		ref  string
+		attr string
+	}{
+		{j.right, j.rightr, j.righta},
+		{j.left, j.leftr, j.lefta},
+	}
+	for _, side := range sides {
+		sc, ok := side.n.(*RelationScanner)
+		if !ok {
+			continue
+		}
+		if _, ok := sc.src.(*SeqScanSrc); !ok {
+			continue
+		}
+		r, ok := relations[side.ref]
+		if !ok {
+			continue
+		}
+		if index := r.hashIndex(side.attr); index != nil {
+			sc.src = NewIndexLookupSource(index, side.ref, sc.src.EstimateCardinal())
+			return
+		}
+	}
+}
+
+// indexLookup returns the scanner of node n and its index lookup source, if
+// any. Scanner may be wrapped into an AnalyzeNode.
+func indexLookup(n Node) (*RelationScanner, *IndexLookupSrc, bool) {
+	if an, ok := n.(*AnalyzeNode); ok {
+		n = an.src
+	}
+	sc, ok := n.(*RelationScanner)
+	if !ok {
+		return nil, nil, false
+	}
+	lk, ok := sc.src.(*IndexLookupSrc)
+	return sc, lk, ok
+}
+
+// countLookup records rows looked up by analyzed node n, which produced no
+// row on its own
+func countLookup(n Node, res []*list.Element) {
+	if an, ok := n.(*AnalyzeNode); ok {
+		an.rows += int64(len(res))
+	}
+}
+
+// lookup joins each outer row with rows of scanner sc looked up in lk by
+// the value at outer index oidx, and matching sc predicates. Values at outer
+// indexes omore must equal values at inner indexes imore as well, and joined
+// tuples of columns jcols must match join filter. Looked up rows come first
+// in joined tuples if swapped is set.
+func (j *NaturalJoin) lookup(jcols []string, outers []*list.Element, oidx int, sc *RelationScanner, lk *IndexLookupSrc, iidx int, omore, imore []int, swapped bool) ([]*list.Element, error) {
+	cols := lk.Columns()
+	l := list.New()
+	var n int
+	for i, outer := range outers {
+		if i%ctxCheckInterval == 0 {
+			if err := ctxErr(j.ctx); err != nil {
+				return nil, err
+			}
+		}
+		ov := outer.Value.(*Tuple).values[oidx]
+		inners, err := lk.lookup(ov)
+		if err != nil {
+			return nil, err
+		}
+		for _, inner := range inners {
+			// many rows may be looked up with the same value
+			if n++; n%ctxCheckInterval == 0 {
+				if err := ctxErr(j.ctx); err != nil {
+					return nil, err
+				}
+			}
+			// index may hold rows colliding with value
+			ok, err := equal(ov, inner.Value.(*Tuple).values[iidx])
+			if err != nil {
+				return nil, err
+			}
+			if ok {
+				ok, err = equalAll(outer.Value.(*Tuple), omore, inner.Value.(*Tuple), imore)
+				if err != nil {
+					return nil, err
+				}
+			}
+			if !ok {
+				continue
+			}
+			ok, err = sc.match(cols, inner)
+			if err != nil {
+				return nil, err
+			}
+			if !ok {
+				continue
+			}
+			left, right := outer.Value.(*Tuple), inner.Value.(*Tuple)
+			if swapped {
+				left, right = right, left
+			}
+			t := NewTuple(left.values...)
+			t.Append(right.values...)
+			if ok, err = j.match(jcols, t); err != nil {
+				return nil, err
+			}
+			if ok {
+				l.PushBack(t)
+			}
+		}
+	}
+
+	res := make([]*list.Element, 0, l.Len())
+	for e := l.Front(); e != nil; e = e.Next() {
+		res = append(res, e)
+	}
+	return res, nil
+}
+
 type ConstValueFunctor struct {
 	v any
 }
@@ -1367,8 +2118,8 @@ func NewConstValueFunctor(v any) ValueFunctor {
 	return f
 }
 
-func (f *ConstValueFunctor) Value([]string, *Tuple) any {
-	return f.v
+func (f *ConstValueFunctor) Value([]string, *Tuple) (any, error) {
+	return f.v, nil
 }
 
 func (f *ConstValueFunctor) Relation() string {
@@ -1398,7 +2149,7 @@ func NewAttributeValueFunctor(rname, aname string) ValueFunctor {
 	return f
 }
 
-func (f *AttributeValueFunctor) Value(cols []string, t *Tuple) any {
+func (f *AttributeValueFunctor) Value(cols []string, t *Tuple) (any, error) {
 	var idx = -1
 	for i, c := range cols {
 		if c == f.aname || c == f.rname+"."+f.aname {
@@ -1407,9 +2158,12 @@ func (f *AttributeValueFunctor) Value(cols []string, t *Tuple) any {
 		}
 	}
 	if idx == -1 {
-		return nil
+		if f.aname == VersionAttribute {
+			return t.rowVersion(), nil
+		}
+		return nil, nil
 	}
-	return t.values[idx]
+	return t.values[idx], nil
 }
 
 func (f *AttributeValueFunctor) Relation() string {
@@ -1433,8 +2187,8 @@ func NewNowValueFunctor() ValueFunctor {
 	return f
 }
 
-func (f *NowValueFunctor) Value([]string, *Tuple) any {
-	return time.Now()
+func (f *NowValueFunctor) Value([]string, *Tuple) (any, error) {
+	return time.Now(), nil
 }
 
 func (f *NowValueFunctor) Relation() string {
@@ -1472,14 +2226,17 @@ func (p GeqPredicate) String() string {
 }
 
 func (p *GeqPredicate) Eval(cols []string, t *Tuple) (bool, error) {
-	vl := p.left.Value(cols, t)
+	vl, err := p.left.Value(cols, t)
+	if err != nil {
+		return false, err
+	}
 	l := reflect.ValueOf(vl)
-	vr := p.right.Value(cols, t)
+	vr, err := p.right.Value(cols, t)
+	if err != nil {
+		return false, err
+	}
 	r := reflect.ValueOf(vr)
 
-	if vl == nil && vr == nil {
-		return true, nil
-	}
 	if vl == nil || vr == nil {
 		return false, nil
 	}
@@ -1562,14 +2319,17 @@ func (p LeqPredicate) String() string {
 }
 
 func (p *LeqPredicate) Eval(cols []string, t *Tuple) (bool, error) {
-	vl := p.left.Value(cols, t)
+	vl, err := p.left.Value(cols, t)
+	if err != nil {
+		return false, err
+	}
 	l := reflect.ValueOf(vl)
-	vr := p.right.Value(cols, t)
+	vr, err := p.right.Value(cols, t)
+	if err != nil {
+		return false, err
+	}
 	r := reflect.ValueOf(vr)
 
-	if vl == nil && vr == nil {
-		return true, nil
-	}
 	if vl == nil || vr == nil {
 		return false, nil
 	}
@@ -1652,14 +2412,17 @@ func (p LePredicate) String() string {
 }
 
 func (p *LePredicate) Eval(cols []string, t *Tuple) (bool, error) {
-	vl := p.left.Value(cols, t)
+	vl, err := p.left.Value(cols, t)
+	if err != nil {
+		return false, err
+	}
 	l := reflect.ValueOf(vl)
-	vr := p.right.Value(cols, t)
+	vr, err := p.right.Value(cols, t)
+	if err != nil {
+		return false, err
+	}
 	r := reflect.ValueOf(vr)
 
-	if vl == nil && vr == nil {
-		return false, nil
-	}
 	if vl == nil || vr == nil {
 		return false, nil
 	}
@@ -1742,10 +2505,19 @@ func (p GePredicate) String() string {
 }
 
 func (p *GePredicate) Eval(cols []string, t *Tuple) (bool, error) {
-	vl := p.left.Value(cols, t)
+	vl, err := p.left.Value(cols, t)
+	if err != nil {
+		return false, err
+	}
 	//	l := reflect.ValueOf(vl)
-	vr := p.right.Value(cols, t)
+	vr, err := p.right.Value(cols, t)
+	if err != nil {
+		return false, err
+	}
 	//	r := reflect.ValueOf(vr)
+	if vl == nil || vr == nil {
+		return false, nil
+	}
 
 	return greater(vl, vr)
 }
@@ -1830,16 +2602,26 @@ func (p NeqPredicate) String() string {
 }
 
 func (p *NeqPredicate) Eval(cols []string, t *Tuple) (bool, error) {
-	vl := p.left.Value(cols, t)
+	vl, err := p.left.Value(cols, t)
+	if err != nil {
+		return false, err
+	}
 	l := reflect.ValueOf(vl)
-	vr := p.right.Value(cols, t)
+	vr, err := p.right.Value(cols, t)
+	if err != nil {
+		return false, err
+	}
 	r := reflect.ValueOf(vr)
 
-	if vl == nil && vr == nil {
+	if vl == nil || vr == nil {
 		return false, nil
 	}
-	if vl == nil || vr == nil {
-		return true, nil
+
+	_, larray := vl.(Array)
+	_, rarray := vr.(Array)
+	if larray || rarray {
+		eq, err := equal(vl, vr)
+		return !eq, err
 	}
 
 	if l.Kind() == r.Kind() {
@@ -1924,6 +2706,27 @@ func equal(vl, vr any) (bool, error) {
 		return false, nil
 	}
 
+	if il, ok := vl.(Interval); ok {
+		if ir, ok := vr.(Interval); ok {
+			return il.cmp(ir) == 0, nil
+		}
+	}
+
+	// arrays compare with arrays, or with array literals
+	_, larray := vl.(Array)
+	_, rarray := vr.(Array)
+	if larray || rarray {
+		al, err := arrayOperand(vl, vr)
+		if err != nil {
+			return false, err
+		}
+		ar, err := arrayOperand(vr, al)
+		if err != nil {
+			return false, err
+		}
+		return al.equal(ar)
+	}
+
 	if l.Kind() == r.Kind() {
 		return l.Equal(r), nil
 	}
@@ -2004,6 +2807,10 @@ func greater(vl, vr any) (bool, error) {
 			if ok {
 				return ltime.After(rtime), nil
 			}
+		case Interval:
+			if ir, ok := vr.(Interval); ok {
+				return vl.(Interval).cmp(ir) > 0, nil
+			}
 		}
 	}
 
@@ -2012,6 +2819,7 @@ func greater(vl, vr any) (bool, error) {
 
 type Updater struct {
 	rel        string
+	relation   *Relation
 	rows       *list.List
 	changes    *list.List
 	values     map[string]any
@@ -2019,20 +2827,27 @@ type Updater struct {
 	child      Node
 	attributes []Attribute
 	indexes    []Index
+	// generation of transaction changes, see Tuple
+	generation uint64
+	// strict type conversions, see SetStrictTypes
+	strict bool
 }
 
-func NewUpdaterNode(relation *Relation, changes *list.List, values map[string]any) *Updater {
+func NewUpdaterNode(relation *Relation, changes *list.List, generation uint64, values map[string]any) *Updater {
 	u := &Updater{
 		rel:        relation.name,
+		relation:   relation,
 		rows:       relation.rows,
 		changes:    changes,
-		values:     values,
+		generation: generation,
+		values:     make(map[string]any, len(values)),
 		attributes: relation.attributes,
 		indexes:    relation.indexes,
 	}
 
-	for k := range values {
-		u.attrs = append(u.attrs, strings.ToLower(k))
+	for k, v := range values {
+		u.values[k] = v
+		u.attrs = append(u.attrs, k)
 	}
 	return u
 }
@@ -2049,67 +2864,113 @@ func (u *Updater) EstimateCardinal() int64 {
 	return u.child.EstimateCardinal()
 }
 
+// Exec updates rows returned by child node in place. Each row keeps its list
+// element, its tuple is replaced and indexes are updated with the new key.
+// Previous tuple is recorded in a ValueChange so rollback can restore it.
 func (u *Updater) Exec() (cols []string, out []*list.Element, err error) {
 	var in []*list.Element
 
+	if err := u.validate(); err != nil {
+		return nil, nil, err
+	}
+
 	cols, in, err = u.child.Exec()
 	if err != nil {
 		return nil, nil, err
 	}
 
 	for _, e := range in {
-		t := e.Value.(*Tuple)
-
-		newt := &Tuple{
-			values: make([]any, len(t.values)),
+		if err := u.update(cols, e); err != nil {
+			return nil, nil, err
 		}
+		out = append(out, e)
+	}
 
-		for i, v := range t.values {
-			nv := v
-			attr := u.attributes[i]
-			if val, ok := u.values[cols[i]]; ok {
-				if val == nil {
-					newt.values[i] = nil
-					delete(u.values, cols[i])
-					continue
-				}
-				tof := reflect.TypeOf(val)
-				if !tof.ConvertibleTo(attr.typeInstance) {
-					return nil, nil, fmt.Errorf("cannot assign '%v' (type %s) to %s.%s (type %s)", val, tof, u.rel, attr.name, attr.typeInstance)
-				}
-				nv = reflect.ValueOf(val).Convert(attr.typeInstance).Interface()
-				log.Debug("Updating %s to %v", attr.name, nv)
-			}
+	return cols, out, nil
+}
 
-			newt.values[i] = nv
-			delete(u.values, cols[i])
+// validate returns an error if an updated attribute does not exist in relation
+func (u *Updater) validate() error {
+	for k := range u.values {
+		if _, _, err := u.relation.Attribute(k); err != nil {
+			return NewError(UndefinedColumn, "attribute %s not existing in relation %s, %s", k, u.rel, u.attributes).On(u.rel, k)
 		}
+	}
+	return nil
+}
 
-		newe := u.rows.InsertAfter(newt, e)
-		if newe == nil {
-			return nil, nil, fmt.Errorf("cannot update rows %v with %v, element not in rows", e, newe)
-		}
-		u.rows.Remove(e)
-		for _, i := range u.indexes {
-			i.Remove(e)
+// update replaces tuple of row e with updated values. Replaced tuple is kept
+// as is, so it is recorded by the first change of row in a generation only:
+// rollback restores it, and rows inserted by transaction are removed.
+func (u *Updater) update(cols []string, e *list.Element) error {
+	t := e.Value.(*Tuple)
+
+	newt := &Tuple{
+		values:  make([]any, len(t.values)),
+		version: t.version + 1,
+		written: u.generation,
+	}
+
+	for i, v := range t.values {
+		nv := v
+		attr := u.attributes[i]
+		if val, ok := u.values[cols[i]]; ok {
+			var err error
+			nv, err = attr.convert(u.rel, val, u.strict)
+			if err != nil {
+				return err
+			}
+			if nv == nil && attr.notNull {
+				return attr.nullViolation(u.rel)
+			}
+			log.Debug("Updating %s to %v", attr.name, nv)
 		}
+
+		newt.values[i] = nv
+	}
+
+	for _, i := range u.indexes {
+		i.Remove(e)
+	}
+	if err := u.check(newt); err != nil {
 		for _, i := range u.indexes {
-			i.Add(newe)
+			i.Add(e)
 		}
-		out = append(out, newe)
+		return err
+	}
+	e.Value = newt
+	for _, i := range u.indexes {
+		i.Add(e)
+	}
 
-		c := &ValueChange{
-			current: newe,
-			old:     e,
-			l:       u.rows,
-		}
-		u.changes.PushBack(c)
+	if t.written == u.generation {
+		return nil
 	}
+	c := ValueChange{
+		current:  e,
+		old:      &list.Element{Value: t},
+		l:        u.rows,
+		relation: u.relation,
+	}
+	u.changes.PushBack(c)
+	return nil
+}
 
-	if len(u.values) > 0 {
-		return nil, nil, fmt.Errorf("attribute %s not existing in relation %s, %s", u.values, u.rel, u.attributes)
+// check returns an error if updated tuple collides with another row on
+// primary key or unique indexes
+func (u *Updater) check(t *Tuple) error {
+	if err := u.relation.CheckUnique(t); err != nil {
+		return err
 	}
-	return cols, out, nil
+
+	ok, err := u.relation.CheckPrimaryKey(t)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return NewError(UniqueViolation, "primary key violation").On(u.rel, "")
+	}
+	return nil
 }
 
 func (u *Updater) Relation() string {
@@ -2122,6 +2983,7 @@ func (u *Updater) Attribute() []string {
 
 type Deleter struct {
 	rel        string
+	relation   *Relation
 	rows       *list.List
 	changes    *list.List
 	child      Node
@@ -2132,6 +2994,7 @@ type Deleter struct {
 func NewDeleterNode(relation *Relation, changes *list.List) *Deleter {
 	u := &Deleter{
 		rel:        relation.name,
+		relation:   relation,
 		rows:       relation.rows,
 		changes:    changes,
 		attributes: relation.attributes,
@@ -2162,6 +3025,7 @@ func (u *Deleter) Exec() (cols []string, out []*list.Element, err error) {
 	}
 
 	for _, t := range in {
+		prev := t.Prev()
 
 		u.rows.Remove(t)
 		for _, i := range u.indexes {
@@ -2170,10 +3034,12 @@ func (u *Deleter) Exec() (cols []string, out []*list.Element, err error) {
 
 		out = append(out, t)
 
-		c := &ValueChange{
-			current: nil,
-			old:     t,
-			l:       u.rows,
+		c := ValueChange{
+			current:  nil,
+			old:      t,
+			prev:     prev,
+			l:        u.rows,
+			relation: u.relation,
 		}
 		u.changes.PushBack(c)
 	}
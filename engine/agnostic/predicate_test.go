@@ -98,3 +98,42 @@ func TestEqPredicate(t *testing.T) {
 	p = NewEqPredicate(b1, c4)
 	checkEval(t, p, cols, tup, false)
 }
+
+func TestNullPredicate(t *testing.T) {
+	rname := "item"
+	tup := NewTuple(int64(3), nil)
+	cols := []string{"a", "b"}
+
+	a := NewAttributeValueFunctor(rname, "a")
+	b := NewAttributeValueFunctor(rname, "b")
+	three := NewConstValueFunctor(int64(3))
+	null := NewConstValueFunctor(nil)
+
+	checkEval(t, NewIsNullPredicate(b), cols, tup, true)
+	checkEval(t, NewIsNullPredicate(a), cols, tup, false)
+	checkEval(t, NewNotPredicate(NewIsNullPredicate(b)), cols, tup, false)
+
+	// comparisons with NULL are unknown, and so is their negation
+	checkEval(t, NewEqPredicate(b, three), cols, tup, false)
+	checkEval(t, NewNeqPredicate(b, three), cols, tup, false)
+	checkEval(t, NewEqPredicate(b, null), cols, tup, false)
+	checkEval(t, NewGeqPredicate(b, null), cols, tup, false)
+	checkEval(t, NewGePredicate(a, null), cols, tup, false)
+	checkEval(t, NewNotPredicate(NewEqPredicate(b, three)), cols, tup, false)
+	checkEval(t, NewNotPredicate(NewLePredicate(b, three)), cols, tup, false)
+
+	// unknown AND false is false, unknown OR true is true
+	unknown := NewEqPredicate(b, three)
+	checkEval(t, NewNotPredicate(NewAndPredicate(unknown, NewFalsePredicate())), cols, tup, true)
+	checkEval(t, NewNotPredicate(NewAndPredicate(unknown, NewTruePredicate())), cols, tup, false)
+	checkEval(t, NewNotPredicate(NewOrPredicate(unknown, NewFalsePredicate())), cols, tup, false)
+	checkEval(t, NewOrPredicate(unknown, NewEqPredicate(a, three)), cols, tup, true)
+
+	// nothing is NOT IN a list holding NULL
+	in := NewInPredicate(a, NewListNode(int64(4), nil))
+	checkEval(t, NewNotPredicate(in), cols, tup, false)
+	in = NewInPredicate(a, NewListNode(int64(4)))
+	checkEval(t, NewNotPredicate(in), cols, tup, true)
+	in = NewInPredicate(b, NewListNode(int64(4)))
+	checkEval(t, NewNotPredicate(in), cols, tup, false)
+}
@@ -0,0 +1,162 @@
+package agnostic
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"regexp/syntax"
+	"strings"
+	"sync"
+)
+
+// RegexPredicate matches strings with a regular expression, like
+// email ~ '^foo'. Operator ~ is case-sensitive, ~* is not, and !~ and !~*
+// negate them. Patterns follow the syntax of Go regexp package.
+//
+// A constant pattern is compiled once, when the predicate is created.
+type RegexPredicate struct {
+	left  ValueFunctor
+	right ValueFunctor
+	op    string
+
+	insensitive bool
+	negate      bool
+
+	// last compiled pattern, right operand being constant or not
+	mu      sync.Mutex
+	pattern string
+	re      *regexp.Regexp
+}
+
+// NewRegexPredicate returns a predicate matching left with the pattern
+// returned by right, according to operator op
+func NewRegexPredicate(left ValueFunctor, op string, right ValueFunctor) (*RegexPredicate, error) {
+	switch op {
+	case "~", "~*", "!~", "!~*":
+	default:
+		return nil, fmt.Errorf("unknown regular expression operator %s", op)
+	}
+
+	// collations do not apply to regular expressions
+	_, left, right, err := comparisonCollation(left, right)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &RegexPredicate{
+		left:        left,
+		right:       right,
+		op:          op,
+		insensitive: strings.HasSuffix(op, "*"),
+		negate:      strings.HasPrefix(op, "!"),
+	}
+
+	if c, ok := right.(*ConstValueFunctor); ok {
+		if pattern, ok := c.v.(string); ok {
+			if _, err := p.compile(pattern); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return p, nil
+}
+
+// compile returns the regular expression of pattern, compiled only if it
+// differs from the last one
+func (p *RegexPredicate) compile(pattern string) (*regexp.Regexp, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.re != nil && p.pattern == pattern {
+		return p.re, nil
+	}
+
+	expr := pattern
+	if p.insensitive {
+		expr = "(?i)" + pattern
+	}
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		var serr *syntax.Error
+		if errors.As(err, &serr) {
+			return nil, NewError(InvalidRegularExpression, "invalid regular expression: %s: `%s`", serr.Code, serr.Expr)
+		}
+		return nil, NewError(InvalidRegularExpression, "invalid regular expression: %s", err)
+	}
+
+	p.pattern, p.re = pattern, re
+	return re, nil
+}
+
+func (p *RegexPredicate) Type() PredicateType {
+	return Regex
+}
+
+func (p *RegexPredicate) String() string {
+	return fmt.Sprintf("%s %s %s", p.left, p.op, p.right)
+}
+
+func (p *RegexPredicate) Eval(cols []string, t *Tuple) (bool, error) {
+	vl, err := p.left.Value(cols, t)
+	if err != nil {
+		return false, err
+	}
+	vr, err := p.right.Value(cols, t)
+	if err != nil {
+		return false, err
+	}
+
+	// matching NULL is unknown
+	if vl == nil || vr == nil {
+		return false, nil
+	}
+
+	s, ok := vl.(string)
+	if !ok {
+		return false, NewError(DatatypeMismatch, "operator %s requires a string, not %v", p.op, vl)
+	}
+	pattern, ok := vr.(string)
+	if !ok {
+		return false, NewError(DatatypeMismatch, "operator %s requires a string pattern, not %v", p.op, vr)
+	}
+
+	re, err := p.compile(pattern)
+	if err != nil {
+		return false, err
+	}
+	return re.MatchString(s) != p.negate, nil
+}
+
+// unknown returns true if value or pattern is NULL
+func (p *RegexPredicate) unknown(cols []string, t *Tuple) (bool, error) {
+	vl, err := p.left.Value(cols, t)
+	if err != nil {
+		return false, err
+	}
+	vr, err := p.right.Value(cols, t)
+	if err != nil {
+		return false, err
+	}
+	return vl == nil || vr == nil, nil
+}
+
+func (p *RegexPredicate) Left() (Predicate, bool) {
+	return nil, false
+}
+
+func (p *RegexPredicate) Right() (Predicate, bool) {
+	return nil, false
+}
+
+func (p *RegexPredicate) Relation() string {
+	if p.left.Relation() != "" {
+		return p.left.Relation()
+	}
+
+	return p.right.Relation()
+}
+
+func (p *RegexPredicate) Attribute() []string {
+	return append(p.left.Attribute(), p.right.Attribute()...)
+}
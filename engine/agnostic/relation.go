@@ -3,8 +3,10 @@ package agnostic
 import (
 	"container/list"
 	"fmt"
+	"reflect"
 	"strings"
 	"sync"
+	"time"
 )
 
 type Relation struct {
@@ -21,6 +23,9 @@ type Relation struct {
 
 	indexes []Index
 
+	// statistics computed by last ANALYZE, if any
+	stats *Stats
+
 	sync.RWMutex
 }
 
@@ -28,7 +33,7 @@ func NewRelation(schema, name string, attributes []Attribute, pk []string) (*Rel
 	r := &Relation{
 		name:       name,
 		schema:     schema,
-		attributes: attributes,
+		attributes: append([]Attribute(nil), attributes...),
 		attrIndex:  make(map[string]int),
 		rows:       list.New(),
 	}
@@ -37,19 +42,29 @@ func NewRelation(schema, name string, attributes []Attribute, pk []string) (*Rel
 	for i, a := range r.attributes {
 		r.attrIndex[a.name] = i
 	}
+	// primary key attributes are NOT NULL
 	for _, k := range pk {
 		r.pk = append(r.pk, r.attrIndex[k])
+		r.attributes[r.attrIndex[k]].notNull = true
 	}
 
 	// if primary key is specified, create Hash index
 	if len(r.pk) != 0 {
-		r.indexes = append(r.indexes, NewHashIndex("pk_"+schema+"_"+name, name, attributes, pk, r.pk))
+		r.indexes = append(r.indexes, NewHashIndex(r.pkIndexName(), name, attributes, pk, r.pk, true))
 	}
 
 	// if unique is specified, create Hash index
 	for i, a := range r.attributes {
 		if a.unique {
-			r.indexes = append(r.indexes, NewHashIndex("unique_"+schema+"_"+name+"_"+a.name, name, attributes, []string{a.name}, []int{i}))
+			r.indexes = append(r.indexes, NewHashIndex("unique_"+schema+"_"+name+"_"+a.name, name, attributes, []string{a.name}, []int{i}, true))
+		}
+	}
+
+	// if foreign key is specified and not indexed yet, create Hash index,
+	// so that joins along it look rows up
+	for i, a := range r.attributes {
+		if a.fk != nil && r.hashIndex(a.name) == nil {
+			r.indexes = append(r.indexes, NewHashIndex("fk_"+schema+"_"+name+"_"+a.name, name, attributes, []string{a.name}, []int{i}, false))
 		}
 	}
 
@@ -61,13 +76,7 @@ func (r *Relation) CheckPrimaryKey(tuple *Tuple) (bool, error) {
 		return true, nil
 	}
 
-	var index Index
-	for i := range r.indexes {
-		if strings.HasPrefix(r.indexes[i].Name(), "pk") {
-			index = r.indexes[i]
-			break
-		}
-	}
+	_, index := r.index(r.pkIndexName())
 	if index == nil {
 		return false, fmt.Errorf("primary key index not found")
 	}
@@ -89,42 +98,566 @@ func (r *Relation) CheckPrimaryKey(tuple *Tuple) (bool, error) {
 }
 
 func (r *Relation) Attribute(name string) (int, Attribute, error) {
-	name = strings.ToLower(name)
 	index, ok := r.attrIndex[name]
 	if !ok {
-		return 0, Attribute{}, fmt.Errorf("attribute not defined: %s.%s", r.name, name)
+		return 0, Attribute{}, NewError(UndefinedColumn, "attribute not defined: %s.%s", r.name, name).On(r.name, name)
 	}
 	return index, r.attributes[index], nil
 }
 
-func (r *Relation) createIndex(name string, t IndexType, attrs []string) error {
+// CheckUnique returns an error if tuple key already exists in one of the relation
+// unique indexes. Primary key index is checked by CheckPrimaryKey.
+//
+// As in standard SQL, keys containing NULL values never collide.
+func (r *Relation) CheckUnique(tuple *Tuple) error {
+	for _, index := range r.indexes {
+		attrs, _, ok := uniqueAttrs(index)
+		if !ok || (len(r.pk) != 0 && index.Name() == r.pkIndexName()) {
+			continue
+		}
+
+		vals := make([]any, len(attrs))
+		for i, idx := range attrs {
+			vals[i] = tuple.values[idx]
+		}
+		if hasNil(vals) {
+			continue
+		}
+
+		e, err := index.Get(vals)
+		if err != nil {
+			return err
+		}
+		if e != nil {
+			return NewError(UniqueViolation, "constraint violation: %s unicity", index).On(r.name, "")
+		}
+	}
+
+	return nil
+}
+
+// buildTuple returns the tuple of relation for given values, using default
+// value of attributes not specified, or NULL if they have none. Value generated for an auto-increment
+// attribute, if any, is returned as key. Values are converted in strict mode
+// if set, see SetStrictTypes. Time of insertion is now.
+func (r *Relation) buildTuple(values map[string]any, strict bool, now time.Time) (tuple *Tuple, key any, err error) {
+	relation := r.name
+	tuple = &Tuple{values: make([]any, 0, len(r.attributes)), version: 1}
+	for i, attr := range r.attributes {
+		val, specified := values[attr.name]
+		if !specified {
+			if attr.defaultValue != nil {
+				tuple.Append(attr.defaultAt(now))
+				continue
+			}
+			if attr.autoIncrement {
+				key = reflect.ValueOf(attr.nextValue).Convert(attr.typeInstance).Interface()
+				tuple.Append(key)
+				r.attributes[i].nextValue++
+				continue
+			}
+		}
+		var v any
+		if specified {
+			v, err = attr.convert(relation, val, strict)
+			if err != nil {
+				return nil, nil, err
+			}
+			if attr.fk != nil {
+				// TODO: predicate: equal
+			}
+			delete(values, attr.name)
+		}
+		if v == nil && attr.notNull {
+			return nil, nil, attr.nullViolation(relation)
+		}
+		tuple.Append(v)
+	}
+
+	// if values map is not empty, then an non existing attribute was specified
+	for k := range values {
+		return nil, nil, NewError(UndefinedColumn, "attribute %s does not exist in relation %s", k, relation).On(relation, k)
+	}
+
+	return tuple, key, nil
+}
+
+// conflict returns the row colliding with tuple on primary key or on a unique index,
+// or nil if there is none.
+//
+// If attrs is not empty, only the constraint on exactly these attributes is
+// considered, and an error is returned if relation has no such constraint.
+func (r *Relation) conflict(tuple *Tuple, attrs []string) (*list.Element, error) {
+	found := false
+	for _, index := range r.indexes {
+		idxs, names, ok := uniqueAttrs(index)
+		if !ok {
+			continue
+		}
+		if len(attrs) > 0 && !sameAttributes(names, attrs) {
+			continue
+		}
+		found = true
+
+		vals := make([]any, len(idxs))
+		for i, idx := range idxs {
+			vals[i] = tuple.values[idx]
+		}
+		if hasNil(vals) {
+			continue
+		}
+
+		e, err := index.Get(vals)
+		if err != nil {
+			return nil, err
+		}
+		if e != nil {
+			return e, nil
+		}
+	}
+
+	if len(attrs) > 0 && !found {
+		return nil, fmt.Errorf("no unique constraint on %s.(%s) matching ON CONFLICT specification", r.name, strings.Join(attrs, ", "))
+	}
+	return nil, nil
+}
+
+// uniqueAttrs returns positions and names of attributes of a unique index.
+func uniqueAttrs(index Index) ([]int, []string, bool) {
+	switch i := index.(type) {
+	case *HashIndex:
+		return i.attrs, i.attrsName, i.unique
+	case *BTreeIndex:
+		return i.attrs, i.attrsName, i.unique
+	}
+	return nil, nil, false
+}
+
+// sameAttributes returns true if a and b contain the same attributes, in any order
+func sameAttributes(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for _, x := range a {
+		found := false
+		for _, y := range b {
+			if x == y {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+func (r *Relation) index(name string) (int, Index) {
+	for i := range r.indexes {
+		if r.indexes[i].Name() == name {
+			return i, r.indexes[i]
+		}
+	}
+	return -1, nil
+}
+
+// pkIndexName returns the name of the index created by relation primary key
+func (r *Relation) pkIndexName() string {
+	return "pk_" + r.schema + "_" + r.name
+}
+
+// implicitIndex returns true if named index has been created by relation
+// primary key, unique or foreign key constraints.
+func (r *Relation) implicitIndex(name string) bool {
+	if len(r.pk) != 0 && name == r.pkIndexName() {
+		return true
+	}
+	for _, a := range r.attributes {
+		if a.unique && name == "unique_"+r.schema+"_"+r.name+"_"+a.name {
+			return true
+		}
+		if a.fk != nil && name == "fk_"+r.schema+"_"+r.name+"_"+a.name {
+			return true
+		}
+	}
+	return false
+}
+
+// hashIndex returns the Hash index on given attribute only, or nil if there is none
+func (r *Relation) hashIndex(attr string) *HashIndex {
+	for _, index := range r.indexes {
+		if h, ok := index.(*HashIndex); ok && len(h.attrsName) == 1 && h.attrsName[0] == attr {
+			return h
+		}
+	}
+	return nil
+}
+
+func (r *Relation) dropIndex(name string) (Index, error) {
+	i, index := r.index(name)
+	if index == nil {
+		return nil, fmt.Errorf("index %s does not exist", name)
+	}
+	if r.implicitIndex(name) {
+		return nil, fmt.Errorf("cannot drop index %s, required by a constraint on relation %s", name, r)
+	}
+
+	r.indexes = append(r.indexes[:i], r.indexes[i+1:]...)
+	return index, nil
+}
+
+// createIndex builds a new index over relation rows.
+func (r *Relation) createIndex(name string, t IndexType, unique bool, attrs []string) (Index, error) {
+
+	if _, idx := r.index(name); idx != nil {
+		return nil, fmt.Errorf("index %s already exists", name)
+	}
+
+	var attrsIdx []int
+	for _, a := range attrs {
+		i, _, err := r.Attribute(a)
+		if err != nil {
+			return nil, err
+		}
+		attrsIdx = append(attrsIdx, i)
+	}
 
 	switch t {
 	case HashIndexType:
-		var attrsIdx []int
-		for _, a := range attrs {
-			for i, rela := range r.attributes {
-				if a == rela.name {
-					attrsIdx = append(attrsIdx, i)
-					break
+		i := NewHashIndex(name, r.name, r.attributes, attrs, attrsIdx, unique)
+		for e := r.rows.Front(); e != nil; e = e.Next() {
+			if unique {
+				key := i.key(e)
+				dup, err := i.Get(key)
+				if err != nil {
+					return nil, err
+				}
+				if dup != nil && !hasNil(key) {
+					return nil, fmt.Errorf("cannot create unique index %s: duplicate key %v", name, key)
 				}
 			}
+			i.Add(e)
 		}
-		i := NewHashIndex(name, r.name, r.attributes, attrs, attrsIdx)
 		r.indexes = append(r.indexes, i)
-		return nil
+		return i, nil
 	case BTreeIndexType:
-		return fmt.Errorf("BTree index are not implemented")
+		i := NewBTreeIndex(name, r.name, r.attributes, attrs, attrsIdx, unique)
+		for e := r.rows.Front(); e != nil; e = e.Next() {
+			if unique {
+				key := i.key(e)
+				dup, err := i.Get(key)
+				if err != nil {
+					return nil, err
+				}
+				if dup != nil && !hasNil(key) {
+					return nil, fmt.Errorf("cannot create unique index %s: duplicate key %v", name, key)
+				}
+			}
+			i.Add(e)
+		}
+		r.indexes = append(r.indexes, i)
+		return i, nil
+	}
+
+	return nil, fmt.Errorf("unknown index type: %d", t)
+}
+
+// addAttribute appends a to relation attributes and sets its value in every
+// row: default value if any, next value if auto-incremented, NULL otherwise.
+// A unique attribute gets its implicit index.
+func (r *Relation) addAttribute(a Attribute, now time.Time) error {
+	if _, ok := r.attrIndex[a.name]; ok {
+		return NewError(DuplicateColumn, "attribute %s already exists in relation %s", a.name, r).On(r.name, a.name)
+	}
+
+	values := make([]any, 0, r.rows.Len())
+	for e := r.rows.Front(); e != nil; e = e.Next() {
+		var v any
+		switch {
+		case a.defaultValue != nil:
+			v = a.defaultAt(now)
+		case a.autoIncrement:
+			v = reflect.ValueOf(a.nextValue).Convert(a.typeInstance).Interface()
+			a.nextValue++
+		}
+		if v == nil && a.notNull {
+			return fmt.Errorf("cannot add NOT NULL attribute %s without default to non-empty relation %s", a.name, r)
+		}
+		values = append(values, v)
+	}
+
+	r.attributes = append(r.attributes, a)
+	r.attrIndex[a.name] = len(r.attributes) - 1
+	i := 0
+	for e := r.rows.Front(); e != nil; e = e.Next() {
+		old := e.Value.(*Tuple).values
+		t := &Tuple{values: make([]any, len(old), len(old)+1), version: e.Value.(*Tuple).version}
+		copy(t.values, old)
+		t.Append(values[i])
+		e.Value = t
+		i++
+	}
+	r.updateIndexesAttributes()
+
+	if a.unique {
+		_, err := r.createIndex("unique_"+r.schema+"_"+r.name+"_"+a.name, HashIndexType, true, []string{a.name})
+		if err != nil {
+			r.removeAttribute(a.name)
+			return err
+		}
+	}
+	if a.fk != nil && r.hashIndex(a.name) == nil {
+		_, err := r.createIndex("fk_"+r.schema+"_"+r.name+"_"+a.name, HashIndexType, false, []string{a.name})
+		if err != nil {
+			r.removeAttribute(a.name)
+			return err
+		}
+	}
+
+	return nil
+}
+
+// removeAttribute removes named attribute, its value from every row and
+// every index over it. Removed attribute, its position, removed value of each
+// row and removed indexes are returned so restoreAttribute can revert the
+// removal.
+func (r *Relation) removeAttribute(name string) (Attribute, int, map[*list.Element]any, []Index) {
+	pos, ok := r.attrIndex[name]
+	if !ok {
+		return Attribute{}, -1, nil, nil
+	}
+	a := r.attributes[pos]
+
+	var removed []Index
+	indexes := r.indexes[:0:0]
+	for _, index := range r.indexes {
+		_, names, _ := uniqueAttrs(index)
+		if contains(names, name) {
+			removed = append(removed, index)
+			continue
+		}
+		indexes = append(indexes, index)
+	}
+	r.indexes = indexes
+
+	r.attributes = append(r.attributes[:pos:pos], r.attributes[pos+1:]...)
+	r.attrIndex = make(map[string]int)
+	for i, a := range r.attributes {
+		r.attrIndex[a.name] = i
+	}
+	for i, k := range r.pk {
+		if k > pos {
+			r.pk[i] = k - 1
+		}
+	}
+
+	values := make(map[*list.Element]any, r.rows.Len())
+	for e := r.rows.Front(); e != nil; e = e.Next() {
+		old := e.Value.(*Tuple)
+		t := &Tuple{values: make([]any, 0, len(old.values)-1), version: old.version}
+		t.Append(old.values[:pos]...)
+		t.Append(old.values[pos+1:]...)
+		e.Value = t
+		values[e] = old.values[pos]
+	}
+	r.updateIndexesAttributes()
+
+	return a, pos, values, removed
+}
+
+// restoreAttribute reverts removeAttribute. Removed values are inserted back
+// into the current tuple of each row, since later changes may have replaced
+// the tuple, and removed indexes are rebuilt.
+func (r *Relation) restoreAttribute(a Attribute, pos int, values map[*list.Element]any, indexes []Index) {
+	attrs := make([]Attribute, 0, len(r.attributes)+1)
+	attrs = append(attrs, r.attributes[:pos]...)
+	attrs = append(attrs, a)
+	r.attributes = append(attrs, r.attributes[pos:]...)
+	r.attrIndex = make(map[string]int)
+	for i, a := range r.attributes {
+		r.attrIndex[a.name] = i
+	}
+	for i, k := range r.pk {
+		if k >= pos {
+			r.pk[i] = k + 1
+		}
+	}
+
+	for e := r.rows.Front(); e != nil; e = e.Next() {
+		cur := e.Value.(*Tuple)
+		t := &Tuple{values: make([]any, 0, len(cur.values)+1), version: cur.version}
+		t.Append(cur.values[:pos]...)
+		t.Append(values[e])
+		t.Append(cur.values[pos:]...)
+		e.Value = t
+	}
+
+	for _, index := range indexes {
+		index.Truncate()
+		for e := r.rows.Front(); e != nil; e = e.Next() {
+			index.Add(e)
+		}
+	}
+	r.indexes = append(r.indexes, indexes...)
+	r.updateIndexesAttributes()
+}
+
+// dropAttribute removes named attribute from relation. Attributes of primary
+// key or referenced by a foreign key cannot be dropped.
+func (r *Relation) dropAttribute(name string, referenced bool) (Attribute, int, map[*list.Element]any, []Index, error) {
+	pos, ok := r.attrIndex[name]
+	if !ok {
+		return Attribute{}, 0, nil, nil, NewError(UndefinedColumn, "attribute %s does not exist in relation %s", name, r).On(r.name, name)
+	}
+	for _, k := range r.pk {
+		if k == pos {
+			return Attribute{}, 0, nil, nil, fmt.Errorf("cannot drop attribute %s, part of relation %s primary key", name, r)
+		}
+	}
+	if referenced {
+		return Attribute{}, 0, nil, nil, NewError(DependentObjectsExist, "cannot drop attribute %s, referenced by a foreign key", name).On(r.name, name)
+	}
+	if len(r.attributes) == 1 {
+		return Attribute{}, 0, nil, nil, fmt.Errorf("cannot drop attribute %s, last attribute of relation %s", name, r)
 	}
 
-	return fmt.Errorf("unknown index type: %d", t)
+	a, pos, tuples, indexes := r.removeAttribute(name)
+	return a, pos, tuples, indexes, nil
 }
 
-func (r *Relation) Truncate() int64 {
+func contains(names []string, name string) bool {
+	for _, n := range names {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
+
+// rename sets relation name, along with relation name of its indexes and
+// names of indexes implied by its constraints.
+func (r *Relation) rename(name string) {
+	implicit := make(map[Index]bool)
+	for _, index := range r.indexes {
+		implicit[index] = r.implicitIndex(index.Name())
+	}
+
+	old := r.name
+	r.name = name
+	for _, index := range r.indexes {
+		switch i := index.(type) {
+		case *HashIndex:
+			i.relName = name
+			if implicit[index] {
+				i.name = strings.Replace(i.name, "_"+r.schema+"_"+old, "_"+r.schema+"_"+name, 1)
+			}
+		case *BTreeIndex:
+			i.relName = name
+			if implicit[index] {
+				i.name = strings.Replace(i.name, "_"+r.schema+"_"+old, "_"+r.schema+"_"+name, 1)
+			}
+		}
+	}
+}
+
+// renameAttribute sets name of attribute old, along with attributes names
+// of indexes over it and name of its implicit unique or foreign key index.
+func (r *Relation) renameAttribute(old, name string) error {
+	pos, ok := r.attrIndex[old]
+	if !ok {
+		return NewError(UndefinedColumn, "attribute %s does not exist in relation %s", old, r).On(r.name, old)
+	}
+	if _, ok := r.attrIndex[name]; ok {
+		return NewError(DuplicateColumn, "attribute %s already exists in relation %s", name, r).On(r.name, name)
+	}
+
+	for _, prefix := range []string{"unique_", "fk_"} {
+		implicitName := prefix + r.schema + "_" + r.name + "_"
+		if _, index := r.index(implicitName + old); index != nil && r.implicitIndex(index.Name()) {
+			switch i := index.(type) {
+			case *HashIndex:
+				i.name = implicitName + name
+			case *BTreeIndex:
+				i.name = implicitName + name
+			}
+		}
+	}
+
+	r.attributes[pos].name = name
+	delete(r.attrIndex, old)
+	r.attrIndex[name] = pos
+
+	for _, index := range r.indexes {
+		switch i := index.(type) {
+		case *HashIndex:
+			i.attrsName = renamed(i.attrsName, old, name)
+		case *BTreeIndex:
+			i.attrsName = renamed(i.attrsName, old, name)
+		}
+	}
+	r.updateIndexesAttributes()
+
+	return nil
+}
+
+// renamed returns a copy of names where old is replaced by name
+func renamed(names []string, old, name string) []string {
+	res := make([]string, len(names))
+	for i, n := range names {
+		if n == old {
+			n = name
+		}
+		res[i] = n
+	}
+	return res
+}
+
+// updateIndexesAttributes sets relation attributes names and indexed attributes
+// positions of every index after relation attributes changed.
+func (r *Relation) updateIndexesAttributes() {
+	names := make([]string, len(r.attributes))
+	for i, a := range r.attributes {
+		names[i] = a.name
+	}
+
+	for _, index := range r.indexes {
+		switch i := index.(type) {
+		case *HashIndex:
+			i.relAttrs = names
+			for j, n := range i.attrsName {
+				i.attrs[j] = r.attrIndex[n]
+			}
+		case *BTreeIndex:
+			i.relAttrs = names
+			for j, n := range i.attrsName {
+				i.attrs[j] = r.attrIndex[n]
+			}
+		}
+	}
+}
+
+func hasNil(values []any) bool {
+	for _, v := range values {
+		if v == nil {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *Relation) Truncate(restartIdentity bool) int64 {
 	r.Lock()
 	defer r.Unlock()
 
-	l := r.rows.Len()
+	rows, _ := r.truncate(restartIdentity)
+	return int64(rows.Len())
+}
+
+// truncate removes all rows from relation and its indexes. Removed rows are
+// returned, along with auto-increment counters of attributes if they restarted.
+func (r *Relation) truncate(restartIdentity bool) (*list.List, []uint64) {
+	rows := r.rows
 
 	for _, i := range r.indexes {
 		i.Truncate()
@@ -132,7 +665,18 @@ func (r *Relation) Truncate() int64 {
 
 	r.rows = list.New()
 
-	return int64(l)
+	var nextValues []uint64
+	if restartIdentity {
+		nextValues = make([]uint64, len(r.attributes))
+		for i := range r.attributes {
+			nextValues[i] = r.attributes[i].nextValue
+			if r.attributes[i].autoIncrement {
+				r.attributes[i].nextValue = r.attributes[i].startValue
+			}
+		}
+	}
+
+	return rows, nextValues
 }
 
 func (r *Relation) String() string {
@@ -2,12 +2,30 @@ package agnostic
 
 import (
 	"container/list"
+	"context"
 	"fmt"
+	"sync"
 )
 
+// ctxCheckInterval is the number of rows processed between two checks of statement context
+const ctxCheckInterval = 1024
+
+// DefaultParallelWorkers is the default maximum number of relations scanned
+// concurrently by a query
+const DefaultParallelWorkers = 4
+
 type RelationScanner struct {
 	src        Source
 	predicates []Predicate
+	ctx        context.Context
+	// statistics of scanned relation, if analyzed
+	stats *Stats
+
+	// result computed ahead by prefetch, returned by next Exec
+	prefetched bool
+	cols       []string
+	res        []*list.Element
+	err        error
 }
 
 func NewRelationScanner(src Source, predicates []Predicate) *RelationScanner {
@@ -28,26 +46,28 @@ func (s *RelationScanner) Append(p Predicate) {
 }
 
 func (s *RelationScanner) Exec() ([]string, []*list.Element, error) {
-	var ok bool
-	var err error
+	if s.prefetched {
+		s.prefetched = false
+		cols, res, err := s.cols, s.res, s.err
+		s.cols, s.res, s.err = nil, nil, nil
+		return cols, res, err
+	}
+
 	var res []*list.Element
-	var canAppend bool
 
 	cols := s.src.Columns()
-	for s.src.HasNext() {
-		t := s.src.Next()
-		canAppend = true
-		for _, p := range s.predicates {
-			ok, err = p.Eval(cols, t.Value.(*Tuple))
-			if err != nil {
-				return nil, nil, fmt.Errorf("RelationScanner.Exec: %s(%v) : %w", p, t, err)
-			}
-			if !ok {
-				canAppend = false
-				break
+	for n := 0; s.src.HasNext(); n++ {
+		if n%ctxCheckInterval == 0 {
+			if err := ctxErr(s.ctx); err != nil {
+				return nil, nil, err
 			}
 		}
-		if canAppend {
+		t := s.src.Next()
+		ok, err := s.match(cols, t)
+		if err != nil {
+			return nil, nil, err
+		}
+		if ok {
 			res = append(res, t)
 		}
 	}
@@ -55,19 +75,134 @@ func (s *RelationScanner) Exec() ([]string, []*list.Element, error) {
 	return cols, res, nil
 }
 
-// No idea on how to estimate cardinal of scanner given predicates
+// match returns true if row e matches all scanner predicates
+func (s *RelationScanner) match(cols []string, e *list.Element) (bool, error) {
+	for _, p := range s.predicates {
+		ok, err := p.Eval(cols, e.Value.(*Tuple))
+		if err != nil {
+			return false, fmt.Errorf("RelationScanner.Exec: %s(%v) : %w", p, e, err)
+		}
+		if !ok {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// Without statistics, no idea on how to estimate cardinal of scanner given predicates
 //
 // min: 0
 // max: len(src)
 // avg: len(src)/2
+//
+// With statistics, predicates selectivity is estimated on a sequential scan.
+// Index sources already apply their predicate, so they keep the average.
 func (s *RelationScanner) EstimateCardinal() int64 {
 	if len(s.predicates) == 0 {
 		return s.src.EstimateCardinal()
 	}
 
+	if _, ok := s.src.(*SeqScanSrc); ok && s.stats != nil {
+		sel := 1.0
+		for _, p := range s.predicates {
+			sel *= s.stats.selectivity(p)
+		}
+		return int64(float64(s.src.EstimateCardinal())*sel) + 1
+	}
+
 	return int64(s.src.EstimateCardinal()/2) + 1
 }
 
 func (s *RelationScanner) Children() []Node {
 	return nil
 }
+
+// ctxErr returns ctx error if ctx is done, or the cause of its cancellation
+// if any, as a statement timeout
+func ctxErr(ctx context.Context) error {
+	if ctx == nil {
+		return nil
+	}
+	return context.Cause(ctx)
+}
+
+// SetParallelWorkers sets the maximum number of relations scanned
+// concurrently by following queries. 1 or less scans relations one by one.
+func (t *Transaction) SetParallelWorkers(n int) {
+	t.workers = n
+}
+
+// prefetch executes the scanners of tree n concurrently, at most workers at a
+// time, so that executing the tree joins their results.
+//
+// Scanned relations are locked by the transaction, which does not modify them
+// during the query, so concurrent scans only read rows. Scanners evaluating
+// subqueries call back into the transaction and are left to sequential Exec.
+func prefetch(n Node, workers int) error {
+	if workers < 2 {
+		return nil
+	}
+
+	var scanners []*RelationScanner
+	recScanners(n, &scanners)
+	if len(scanners) < 2 {
+		return nil
+	}
+
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, workers)
+	for _, sc := range scanners {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(sc *RelationScanner) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			sc.cols, sc.res, sc.err = sc.Exec()
+			sc.prefetched = true
+		}(sc)
+	}
+	wg.Wait()
+
+	for _, sc := range scanners {
+		if sc.err != nil {
+			return sc.err
+		}
+	}
+	return nil
+}
+
+// recScanners appends to scanners the scanners of tree n safe to run concurrently
+func recScanners(n Node, scanners *[]*RelationScanner) {
+	if n == nil {
+		return
+	}
+	if sc, ok := n.(*RelationScanner); ok {
+		for _, p := range sc.predicates {
+			if !concurrent(p) {
+				return
+			}
+		}
+		*scanners = append(*scanners, sc)
+		return
+	}
+	for _, c := range n.Children() {
+		recScanners(c, scanners)
+	}
+}
+
+// concurrent returns false if evaluating p may run a subquery
+func concurrent(p Predicate) bool {
+	switch p := p.(type) {
+	case *InPredicate, *ExistsPredicate:
+		return false
+	case *NotPredicate:
+		return concurrent(p.src)
+	}
+	if lp, ok := p.Left(); ok && !concurrent(lp) {
+		return false
+	}
+	if rp, ok := p.Right(); ok && !concurrent(rp) {
+		return false
+	}
+	return true
+}
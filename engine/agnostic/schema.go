@@ -8,6 +8,9 @@ import (
 type Schema struct {
 	name      string
 	relations map[string]*Relation
+	sequences map[string]*Sequence
+	enums     map[string]*Enum
+	domains   map[string]*Domain
 
 	sync.RWMutex
 }
@@ -16,6 +19,9 @@ func NewSchema(name string) *Schema {
 	s := &Schema{
 		name:      name,
 		relations: make(map[string]*Relation),
+		sequences: make(map[string]*Sequence),
+		enums:     make(map[string]*Enum),
+		domains:   make(map[string]*Domain),
 	}
 
 	return s
@@ -28,7 +34,7 @@ func (s *Schema) Relation(name string) (*Relation, error) {
 	r, ok := s.relations[name]
 	if !ok {
 		//	panic("lol")
-		return nil, fmt.Errorf("relation '%s'.'%s' does not exist", s.name, name)
+		return nil, NewError(UndefinedTable, "relation '%s'.'%s' does not exist", s.name, name).On(name, "")
 	}
 
 	return r, nil
@@ -48,9 +54,107 @@ func (s *Schema) Remove(name string) (*Relation, error) {
 	r, ok := s.relations[name]
 	if !ok {
 		//		panic("remove")
-		return nil, fmt.Errorf("relation '%s'.'%s' does not exist", s.name, name)
+		return nil, NewError(UndefinedTable, "relation '%s'.'%s' does not exist", s.name, name).On(name, "")
 	}
 
 	delete(s.relations, name)
 	return r, nil
 }
+
+func (s *Schema) Sequence(name string) (*Sequence, error) {
+	s.RLock()
+	defer s.RUnlock()
+
+	seq, ok := s.sequences[name]
+	if !ok {
+		return nil, fmt.Errorf("sequence '%s'.'%s' does not exist", s.name, name)
+	}
+
+	return seq, nil
+}
+
+func (s *Schema) AddSequence(name string, seq *Sequence) {
+	s.Lock()
+	defer s.Unlock()
+
+	s.sequences[name] = seq
+}
+
+func (s *Schema) RemoveSequence(name string) (*Sequence, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	seq, ok := s.sequences[name]
+	if !ok {
+		return nil, fmt.Errorf("sequence '%s'.'%s' does not exist", s.name, name)
+	}
+
+	delete(s.sequences, name)
+	return seq, nil
+}
+
+// Enum returns enum type called name
+func (s *Schema) Enum(name string) (*Enum, error) {
+	s.RLock()
+	defer s.RUnlock()
+
+	e, ok := s.enums[name]
+	if !ok {
+		return nil, undefinedType(name)
+	}
+
+	return e, nil
+}
+
+func (s *Schema) AddEnum(name string, e *Enum) {
+	s.Lock()
+	defer s.Unlock()
+
+	s.enums[name] = e
+}
+
+func (s *Schema) RemoveEnum(name string) (*Enum, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	e, ok := s.enums[name]
+	if !ok {
+		return nil, undefinedType(name)
+	}
+
+	delete(s.enums, name)
+	return e, nil
+}
+
+// Domain returns domain called name
+func (s *Schema) Domain(name string) (*Domain, error) {
+	s.RLock()
+	defer s.RUnlock()
+
+	d, ok := s.domains[name]
+	if !ok {
+		return nil, undefinedType(name)
+	}
+
+	return d, nil
+}
+
+func (s *Schema) AddDomain(name string, d *Domain) {
+	s.Lock()
+	defer s.Unlock()
+
+	s.domains[name] = d
+}
+
+func (s *Schema) RemoveDomain(name string) (*Domain, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	d, ok := s.domains[name]
+	if !ok {
+		return nil, undefinedType(name)
+	}
+
+	delete(s.domains, name)
+	return d, nil
+}
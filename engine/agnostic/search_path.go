@@ -0,0 +1,117 @@
+package agnostic
+
+import (
+	"strings"
+)
+
+// SetSearchPath sets the schemas unqualified relations and sequences are
+// looked up in, in order. New relations are created in the first existing
+// schema of path. An empty path restores the default schema.
+func (t *Transaction) SetSearchPath(path []string) {
+	t.searchPath = path
+}
+
+// resolve returns the schema an unqualified object name refers to: the first
+// schema of search path holding a relation or sequence called name, or else
+// the first existing one. Qualified names, and unqualified names without
+// search path, are returned as is.
+func (t *Transaction) resolve(schema, name string) string {
+	if schema != "" || len(t.searchPath) == 0 {
+		return schema
+	}
+
+	first := ""
+	for _, sn := range t.searchPath {
+		t.e.Lock()
+		s, ok := t.e.schemas[sn]
+		t.e.Unlock()
+		if !ok {
+			continue
+		}
+		if first == "" {
+			first = sn
+		}
+		if name == "" {
+			break
+		}
+
+		s.RLock()
+		_, isRel := s.relations[name]
+		_, isSeq := s.sequences[name]
+		_, isEnum := s.enums[name]
+		_, isDomain := s.domains[name]
+		s.RUnlock()
+		if isRel || isSeq || isEnum || isDomain {
+			return sn
+		}
+	}
+
+	return first
+}
+
+// searchSchema returns a schema holding relations and sequences of every
+// schema of search path, the first schema of path winning on name conflicts.
+// It is named after the first existing schema of path.
+func (t *Transaction) searchSchema() (*Schema, error) {
+	var ss *Schema
+	for i := len(t.searchPath) - 1; i >= 0; i-- {
+		t.e.Lock()
+		s, ok := t.e.schemas[t.searchPath[i]]
+		t.e.Unlock()
+		if !ok {
+			continue
+		}
+		if ss == nil {
+			ss = NewSchema(s.name)
+		}
+		ss.name = s.name
+
+		s.RLock()
+		for name, r := range s.relations {
+			ss.relations[name] = r
+		}
+		for name, seq := range s.sequences {
+			ss.sequences[name] = seq
+		}
+		s.RUnlock()
+	}
+
+	if ss == nil {
+		return t.e.schema("")
+	}
+	return ss, nil
+}
+
+// QualifiedName returns the name of relation qualified with schema, like
+// analytics.events. Queries reference relations of other schemas than
+// the one they run in with qualified names.
+func QualifiedName(schema, relation string) string {
+	if schema == "" {
+		return relation
+	}
+	return schema + "." + relation
+}
+
+// splitQualified returns the schema and relation of a qualified name, or
+// schema and name as is if name is not qualified.
+func splitQualified(schema, name string) (string, string) {
+	if i := strings.Index(name, "."); i > 0 {
+		return name[:i], name[i+1:]
+	}
+	return schema, name
+}
+
+// relation returns relation name of schema s, or of the schema name is
+// qualified with.
+func (t *Transaction) relation(s *Schema, name string) (*Relation, error) {
+	sn, rn := splitQualified("", name)
+	if sn == "" {
+		return s.Relation(name)
+	}
+
+	qs, err := t.schema(sn)
+	if err != nil {
+		return nil, err
+	}
+	return qs.Relation(rn)
+}
@@ -0,0 +1,68 @@
+package agnostic
+
+import (
+	"fmt"
+	"sync"
+)
+
+// Sequence is a named generator of integer values, stored in a Schema.
+//
+// Sequence values are not transactional: a value returned by Next is
+// consumed even if the transaction which requested it is rolled back,
+// so sequences may have gaps. Only creation and drop of a sequence are
+// reverted on rollback.
+type Sequence struct {
+	name      string
+	start     int64
+	increment int64
+
+	value  int64
+	called bool
+
+	sync.Mutex
+}
+
+func NewSequence(name string, start, increment int64) (*Sequence, error) {
+	if increment == 0 {
+		return nil, fmt.Errorf("sequence %s: INCREMENT must not be zero", name)
+	}
+
+	s := &Sequence{
+		name:      name,
+		start:     start,
+		increment: increment,
+	}
+
+	return s, nil
+}
+
+// Next advances sequence and returns its new value
+func (s *Sequence) Next() int64 {
+	s.Lock()
+	defer s.Unlock()
+
+	if !s.called {
+		s.value = s.start
+		s.called = true
+		return s.value
+	}
+
+	s.value += s.increment
+	return s.value
+}
+
+// Current returns the value most recently returned by Next
+func (s *Sequence) Current() (int64, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	if !s.called {
+		return 0, fmt.Errorf("currval of sequence %s is not yet defined", s.name)
+	}
+
+	return s.value, nil
+}
+
+func (s *Sequence) String() string {
+	return s.name
+}
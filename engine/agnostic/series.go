@@ -0,0 +1,141 @@
+package agnostic
+
+import (
+	"fmt"
+	"math"
+	"time"
+)
+
+// GenerateSeries returns the rows of generate_series(start, stop[, step]),
+// with values from start to stop included, step apart, and the type name of
+// values.
+//
+// Numbers step by 1 by default. Timestamps require an interval step. A
+// negative step counts down, and a step going away from stop yields no row,
+// as does a NULL argument. A zero step is an error.
+func GenerateSeries(args ...any) ([]*Tuple, string, error) {
+	if len(args) < 2 || len(args) > 3 {
+		return nil, "", fmt.Errorf("function generate_series does not accept %d arguments", len(args))
+	}
+
+	_, startTime := args[0].(time.Time)
+	_, stopTime := args[1].(time.Time)
+	typeName := "BIGINT"
+	if startTime || stopTime {
+		typeName = "TIMESTAMP"
+	}
+	for _, a := range args {
+		if a == nil {
+			return nil, typeName, nil
+		}
+	}
+
+	if startTime || stopTime {
+		rows, err := timeSeries(args)
+		return rows, typeName, err
+	}
+	return numberSeries(args)
+}
+
+func zeroStep() error {
+	return NewError(InvalidParameterValue, "step size cannot equal zero")
+}
+
+// numberSeries returns the rows of an integer series, or of a floating point
+// one if any argument is a float
+func numberSeries(args []any) ([]*Tuple, string, error) {
+	ints := []int64{0, 0, 1}
+	floats := []float64{0, 0, 1}
+	isFloat := false
+	for i, a := range args {
+		n, f, fl, err := number(a)
+		if err != nil {
+			return nil, "", fmt.Errorf("function generate_series: %s", err)
+		}
+		if fl {
+			isFloat = true
+			floats[i] = f
+			continue
+		}
+		ints[i], floats[i] = n, float64(n)
+	}
+
+	var rows []*Tuple
+	if !isFloat {
+		start, stop, step := ints[0], ints[1], ints[2]
+		if step == 0 {
+			return nil, "", zeroStep()
+		}
+		for v := start; (step > 0 && v <= stop) || (step < 0 && v >= stop); {
+			rows = append(rows, NewTuple(v))
+			next, err := addInt64(v, step)
+			if err != nil {
+				break
+			}
+			v = next
+		}
+		return rows, "BIGINT", nil
+	}
+
+	start, stop, step := floats[0], floats[1], floats[2]
+	switch {
+	case math.IsNaN(step):
+		return nil, "", NewError(InvalidParameterValue, "step size cannot be NaN")
+	case step == 0:
+		return nil, "", zeroStep()
+	case math.IsInf(start, 0):
+		return nil, "", NewError(InvalidParameterValue, "start value cannot be infinity")
+	case math.IsInf(stop, 0):
+		return nil, "", NewError(InvalidParameterValue, "stop value cannot be infinity")
+	}
+	// values are computed from start rather than accumulated, so that
+	// rounding errors do not add up
+	for i := 0; ; i++ {
+		v := start
+		if i > 0 {
+			v += float64(i) * step
+		}
+		if math.IsNaN(v) || (step > 0 && v > stop) || (step < 0 && v < stop) {
+			break
+		}
+		rows = append(rows, NewTuple(v))
+	}
+	return rows, "FLOAT", nil
+}
+
+// timeSeries returns the rows of a timestamp series, stepping by an interval
+func timeSeries(args []any) ([]*Tuple, error) {
+	if len(args) < 3 {
+		return nil, fmt.Errorf("function generate_series requires an interval step with timestamps")
+	}
+	start, err := timeValue(args[0])
+	if err != nil {
+		return nil, err
+	}
+	stop, err := timeValue(args[1])
+	if err != nil {
+		return nil, err
+	}
+	step, err := intervalValue(args[2])
+	if err != nil {
+		return nil, err
+	}
+
+	sign := step.cmp(Interval{})
+	if sign == 0 {
+		return nil, zeroStep()
+	}
+
+	var rows []*Tuple
+	for v := start; (sign > 0 && !v.After(stop)) || (sign < 0 && !v.Before(stop)); {
+		rows = append(rows, NewTuple(v))
+		// an interval like '1 month -29 days' may not move every timestamp
+		// the way its sign says, stop rather than loop
+		next, err := step.AddTo(v)
+		if err != nil || (sign > 0 && !next.After(v)) || (sign < 0 && !next.Before(v)) {
+			break
+		}
+		v = next
+	}
+	return rows, nil
+}
@@ -0,0 +1,275 @@
+package agnostic
+
+import (
+	"container/list"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SetOperator combines rows of two queries
+type SetOperator int
+
+const (
+	Union SetOperator = iota
+	Intersect
+	Except
+)
+
+func (op SetOperator) String() string {
+	switch op {
+	case Intersect:
+		return "INTERSECT"
+	case Except:
+		return "EXCEPT"
+	default:
+		return "UNION"
+	}
+}
+
+// SetOperationNode combines rows of left and right nodes:
+//
+//   - Union returns rows of left node followed by rows of right node
+//   - Intersect returns rows of left node also returned by right node
+//   - Except returns rows of left node not returned by right node
+//
+// Unless all is set, duplicate rows are removed like with DISTINCT. With all,
+// a row returned m times by left node and n times by right node is returned
+// m+n times by Union, min(m,n) times by Intersect and max(m-n,0) times by Except.
+//
+// Rows are compared as a whole, NULL values being equal to each other.
+// Output columns are the ones of left node.
+type SetOperationNode struct {
+	op    SetOperator
+	left  Node
+	right Node
+	all   bool
+}
+
+func NewSetOperationNode(op SetOperator, left, right Node, all bool) *SetOperationNode {
+	n := &SetOperationNode{
+		op:    op,
+		left:  left,
+		right: right,
+		all:   all,
+	}
+	return n
+}
+
+func (n SetOperationNode) String() string {
+	if n.all {
+		return n.op.String() + " ALL"
+	}
+	return n.op.String()
+}
+
+func (n *SetOperationNode) Exec() ([]string, []*list.Element, error) {
+	lcols, lres, err := n.left.Exec()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	rcols, rres, err := n.right.Exec()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if len(lcols) != len(rcols) {
+		return nil, nil, fmt.Errorf("each %s query must have the same number of columns (%d and %d)", n.op, len(lcols), len(rcols))
+	}
+	if err := compatibleColumns(lres, rres); err != nil {
+		return nil, nil, fmt.Errorf("%s %s", n.op, err)
+	}
+
+	res := make([]*list.Element, 0, len(lres))
+	seen := make(map[string]struct{})
+	distinct := func(e *list.Element, k string) {
+		if _, ok := seen[k]; ok {
+			return
+		}
+		seen[k] = struct{}{}
+		res = append(res, e)
+	}
+
+	if n.op == Union {
+		if n.all {
+			res = append(res, lres...)
+			res = append(res, rres...)
+			return lcols, res, nil
+		}
+		for _, rows := range [][]*list.Element{lres, rres} {
+			for _, e := range rows {
+				distinct(e, rowKey(e.Value.(*Tuple)))
+			}
+		}
+		return lcols, res, nil
+	}
+
+	counts := make(map[string]int, len(rres))
+	for _, e := range rres {
+		counts[rowKey(e.Value.(*Tuple))]++
+	}
+
+	for _, e := range lres {
+		k := rowKey(e.Value.(*Tuple))
+		found := counts[k] > 0
+		switch {
+		case n.op == Intersect && n.all:
+			if found {
+				counts[k]--
+				res = append(res, e)
+			}
+		case n.op == Intersect:
+			if found {
+				distinct(e, k)
+			}
+		case n.all:
+			if found {
+				counts[k]--
+				continue
+			}
+			res = append(res, e)
+		default:
+			if !found {
+				distinct(e, k)
+			}
+		}
+	}
+
+	return lcols, res, nil
+}
+
+func (n *SetOperationNode) EstimateCardinal() int64 {
+	switch n.op {
+	case Intersect:
+		l, r := n.left.EstimateCardinal(), n.right.EstimateCardinal()
+		if r < l {
+			return r
+		}
+		return l
+	case Except:
+		return n.left.EstimateCardinal()
+	default:
+		return n.left.EstimateCardinal() + n.right.EstimateCardinal()
+	}
+}
+
+func (n *SetOperationNode) Children() []Node {
+	return []Node{n.left, n.right}
+}
+
+// SetOperation combines rows of left and right query plans with op, then
+// applies sorters to the combined result.
+func (t *Transaction) SetOperation(op SetOperator, left, right Node, all bool, sorters []Sorter) ([]string, []*Tuple, error) {
+	if err := t.aborted(); err != nil {
+		return nil, nil, err
+	}
+
+	var n Node = NewSetOperationNode(op, left, right, all)
+	if len(sorters) > 0 {
+		sort.Sort(Sorters(sorters))
+		t.stabilize(sorters)
+		for _, s := range sorters {
+			s.SetNode(n)
+			n = s
+		}
+	}
+	PrintQueryPlan(n, 0, nil)
+
+	columns, eres, err := n.Exec()
+	if err != nil {
+		return nil, nil, t.abort(err)
+	}
+
+	res := make([]*Tuple, len(eres))
+	for i, e := range eres {
+		res[i] = e.Value.(*Tuple)
+	}
+
+	return columns, res, nil
+}
+
+// rowKey returns a key identifying tuple values, NULL values being equal
+func rowKey(t *Tuple) string {
+	var b strings.Builder
+
+	for _, v := range t.values {
+		if v == nil {
+			b.WriteString("N;")
+			continue
+		}
+		b.WriteString(strconv.Quote(fmt.Sprint(v)))
+		b.WriteString(";")
+	}
+
+	return b.String()
+}
+
+// compatibleColumns returns an error if a column holds values of different
+// kinds in left and right rows. NULL is compatible with every kind.
+func compatibleColumns(left, right []*list.Element) error {
+	lkinds := columnKinds(left)
+	rkinds := columnKinds(right)
+
+	for i := range lkinds {
+		if i >= len(rkinds) {
+			break
+		}
+		if lkinds[i] != "" && rkinds[i] != "" && lkinds[i] != rkinds[i] {
+			return fmt.Errorf("types %s and %s cannot be matched", lkinds[i], rkinds[i])
+		}
+	}
+
+	return nil
+}
+
+// columnKinds returns the kind of the first non NULL value of each column
+func columnKinds(rows []*list.Element) []string {
+	var kinds []string
+
+	for _, e := range rows {
+		values := e.Value.(*Tuple).values
+		if kinds == nil {
+			kinds = make([]string, len(values))
+		}
+		done := true
+		for i, v := range values {
+			if kinds[i] == "" {
+				kinds[i] = valueKind(v)
+			}
+			if kinds[i] == "" {
+				done = false
+			}
+		}
+		if done {
+			break
+		}
+	}
+
+	return kinds
+}
+
+func valueKind(v any) string {
+	if v == nil {
+		return ""
+	}
+	if _, ok := v.(time.Time); ok {
+		return "timestamp"
+	}
+
+	switch reflect.ValueOf(v).Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return "numeric"
+	case reflect.String:
+		return "text"
+	case reflect.Bool:
+		return "boolean"
+	}
+
+	return fmt.Sprintf("%T", v)
+}
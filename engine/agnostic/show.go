@@ -0,0 +1,97 @@
+package agnostic
+
+import (
+	"sort"
+	"strings"
+)
+
+// ShowTables returns the name of every relation of schema, sorted.
+//
+// Result has a single column: table_name.
+func (t *Transaction) ShowTables(schema string) ([]string, []*Tuple, error) {
+	if err := t.aborted(); err != nil {
+		return nil, nil, err
+	}
+
+	s, err := t.schema(schema)
+	if err != nil {
+		return nil, nil, t.abort(err)
+	}
+
+	s.RLock()
+	names := make([]string, 0, len(s.relations))
+	for name := range s.relations {
+		names = append(names, name)
+	}
+	s.RUnlock()
+	sort.Strings(names)
+
+	res := make([]*Tuple, len(names))
+	for i, name := range names {
+		res[i] = NewTuple(name)
+	}
+
+	return []string{"table_name"}, res, nil
+}
+
+// Describe returns one row per attribute of relation, in declaration order.
+//
+// Result columns are:
+//
+//   - field: attribute name
+//   - type: attribute type, as declared
+//   - null: YES if attribute accepts NULL, NO otherwise
+//   - key: PRI for primary key attributes, UNI for unique attributes
+//   - default: default value expression, or NULL
+//   - extra: auto_increment for auto-incremented attributes
+func (t *Transaction) Describe(schema, relation string) ([]string, []*Tuple, error) {
+	if err := t.aborted(); err != nil {
+		return nil, nil, err
+	}
+
+	s, err := t.schema(schema)
+	if err != nil {
+		return nil, nil, t.abort(err)
+	}
+
+	r, err := s.Relation(relation)
+	if err != nil {
+		return nil, nil, t.abort(err)
+	}
+
+	attrs, pk := t.relationMetadata(r)
+	primary := make(map[int]bool, len(pk))
+	for _, idx := range pk {
+		primary[idx] = true
+	}
+
+	res := make([]*Tuple, len(attrs))
+	for i, a := range attrs {
+		null := "YES"
+		if !a.Nullable() {
+			null = "NO"
+		}
+
+		var key string
+		switch {
+		case primary[i]:
+			key = "PRI"
+		case a.unique:
+			key = "UNI"
+		}
+
+		var def any
+		if a.defaultExpr != "" {
+			def = a.defaultExpr
+		}
+
+		var extra string
+		if a.autoIncrement {
+			extra = "auto_increment"
+		}
+
+		res[i] = NewTuple(a.name, strings.ToUpper(a.typeName), null, key, def, extra)
+	}
+
+	return []string{"field", "type", "null", "key", "default", "extra"}, res, nil
+}
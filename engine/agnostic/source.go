@@ -6,14 +6,15 @@ import (
 )
 
 type IndexSrc struct {
-	tuple   *list.Element
-	hasNext bool
-	rname   string
-	cols    []string
+	index  Index
+	tuples []*list.Element
+	idx    int
+	rname  string
+	cols   []string
 }
 
 func NewHashIndexSource(index Index, alias string, p Predicate) (*IndexSrc, error) {
-	s := &IndexSrc{}
+	s := &IndexSrc{index: index}
 
 	i, ok := index.(*HashIndex)
 	if !ok {
@@ -26,37 +27,98 @@ func NewHashIndexSource(index Index, alias string, p Predicate) (*IndexSrc, erro
 		s.rname = alias
 	}
 
-	eq, ok := p.(*EqPredicate)
+	key, ok := i.probe(p)
 	if !ok {
-		return nil, fmt.Errorf("predicate %s is not a Eq predicate", p)
+		return nil, fmt.Errorf("predicate %s does not match index %s", p, i)
 	}
 
-	t, err := i.Get([]any{eq.right.Value(nil, nil)})
+	t, err := i.GetAll(key)
 	if err != nil {
 		return nil, fmt.Errorf("cannot create NewHashIndexSource(%s,%s): %s", index, p, err)
 	}
 
-	s.tuple = t
-	if t != nil {
-		s.hasNext = true
+	s.tuples = t
+	return s, nil
+}
+
+// NewBTreeIndexSource creates a source returning rows of index matching all
+// range predicates on index first attribute found in p, sorted in given direction.
+func NewBTreeIndexSource(index Index, alias string, p Predicate, direction SortType) (*IndexSrc, error) {
+	s := &IndexSrc{index: index}
+
+	i, ok := index.(*BTreeIndex)
+	if !ok {
+		return nil, fmt.Errorf("index %s is not a BTreeIndex", index)
+	}
+	s.rname = i.relName
+	s.cols = i.relAttrs
+
+	if alias != "" {
+		s.rname = alias
+	}
+
+	var lo, hi *btreeBound
+	if p != nil {
+		lo, hi = recBTreeBounds(i, s.rname, p, lo, hi)
+	}
+
+	s.tuples = i.Range(lo, hi)
+	if direction == DESC {
+		for l, r := 0, len(s.tuples)-1; l < r; l, r = l+1, r-1 {
+			s.tuples[l], s.tuples[r] = s.tuples[r], s.tuples[l]
+		}
 	}
 	return s, nil
 }
 
+// recBTreeBounds narrows lo and hi with predicates on relation rname combined with AND in p
+func recBTreeBounds(i *BTreeIndex, rname string, p Predicate, lo, hi *btreeBound) (*btreeBound, *btreeBound) {
+	if p.Type() == And {
+		lp, _ := p.Left()
+		rp, _ := p.Right()
+		lo, hi = recBTreeBounds(i, rname, lp, lo, hi)
+		return recBTreeBounds(i, rname, rp, lo, hi)
+	}
+
+	if p.Relation() != rname {
+		return lo, hi
+	}
+	plo, phi, ok := i.bounds(p)
+	if !ok {
+		return lo, hi
+	}
+
+	if plo != nil && (lo == nil || tighter(plo, lo, 1)) {
+		lo = plo
+	}
+	if phi != nil && (hi == nil || tighter(phi, hi, -1)) {
+		hi = phi
+	}
+	return lo, hi
+}
+
+// tighter returns true if bound a restricts more than b. Sign is 1 for lower
+// bounds and -1 for upper bounds.
+func tighter(a, b *btreeBound, sign int) bool {
+	c := compare(a.v, b.v) * sign
+	return c > 0 || (c == 0 && !a.inclusive)
+}
+
 func (s IndexSrc) String() string {
 	return "IndexScan on " + s.rname
 }
 
 func (s *IndexSrc) HasNext() bool {
-	return s.hasNext
+	return s.idx < len(s.tuples)
 }
 
 func (s *IndexSrc) Next() *list.Element {
-	if !s.hasNext {
+	if s.idx >= len(s.tuples) {
 		return nil
 	}
-	s.hasNext = false
-	return s.tuple
+	t := s.tuples[s.idx]
+	s.idx++
+	return t
 }
 
 func (s *IndexSrc) Columns() []string {
@@ -64,10 +126,55 @@ func (s *IndexSrc) Columns() []string {
 }
 
 func (s *IndexSrc) EstimateCardinal() int64 {
-	if s.tuple != nil {
-		return 1
+	return int64(len(s.tuples))
+}
+
+// IndexLookupSrc sources rows of a relation by looking values up in a Hash
+// index, as inner side of a join, see NaturalJoin. It sources no row on its own.
+type IndexLookupSrc struct {
+	index *HashIndex
+	rname string
+	card  int64
+}
+
+func NewIndexLookupSource(index *HashIndex, alias string, card int64) *IndexLookupSrc {
+	s := &IndexLookupSrc{
+		index: index,
+		rname: index.relName,
+		card:  card,
+	}
+	if alias != "" {
+		s.rname = alias
+	}
+	return s
+}
+
+func (s IndexLookupSrc) String() string {
+	return "IndexLookup on " + s.rname + " using " + s.index.Name()
+}
+
+func (s *IndexLookupSrc) HasNext() bool {
+	return false
+}
+
+func (s *IndexLookupSrc) Next() *list.Element {
+	return nil
+}
+
+func (s *IndexLookupSrc) EstimateCardinal() int64 {
+	return s.card
+}
+
+func (s *IndexLookupSrc) Columns() []string {
+	return s.index.relAttrs
+}
+
+// lookup returns rows indexed with value v. NULL matches no row.
+func (s *IndexLookupSrc) lookup(v any) ([]*list.Element, error) {
+	if v == nil {
+		return nil, nil
 	}
-	return 0
+	return s.index.GetAll([]any{v})
 }
 
 type SeqScanSrc struct {
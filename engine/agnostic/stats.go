@@ -0,0 +1,320 @@
+package agnostic
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/proullon/ramsql/engine/log"
+)
+
+// defaultSelectivity is the fraction of rows a predicate is assumed to match
+// when no statistics apply
+const defaultSelectivity = 0.5
+
+// DefaultStatisticsTarget is the default number of histogram buckets computed
+// for each attribute by ANALYZE
+const DefaultStatisticsTarget = 100
+
+// ColumnStats are statistics on the values of an attribute
+type ColumnStats struct {
+	// Count is the number of non NULL values
+	Count    int64
+	Distinct int64
+	Min      any
+	Max      any
+	// Histogram holds the bounds of equi-depth buckets: each bucket holds
+	// about the same number of values, between two consecutive bounds.
+	Histogram []any
+}
+
+// Stats are statistics on the rows of a relation, computed by ANALYZE. They
+// are a snapshot: the planner uses them as estimates until next ANALYZE.
+type Stats struct {
+	Rows    int64
+	Columns map[string]ColumnStats
+}
+
+// AnalyzeRelation computes statistics of given relation, or of every relation of
+// every schema if relation is empty, replacing previously computed ones.
+// Histograms have at most buckets buckets. Statistics are not part of
+// transaction changes, Rollback keeps them.
+func (t *Transaction) AnalyzeRelation(schema, relation string, buckets int) error {
+	if buckets < 1 {
+		return fmt.Errorf("invalid histogram bucket count %d", buckets)
+	}
+	if err := t.aborted(); err != nil {
+		return err
+	}
+
+	var relations []*Relation
+	if relation != "" {
+		s, err := t.e.schema(t.resolve(schema, relation))
+		if err != nil {
+			return t.abort(err)
+		}
+		r, err := s.Relation(relation)
+		if err != nil {
+			return t.abort(err)
+		}
+		relations = append(relations, r)
+	} else {
+		t.e.Lock()
+		schemas := make([]*Schema, 0, len(t.e.schemas))
+		for _, s := range t.e.schemas {
+			schemas = append(schemas, s)
+		}
+		t.e.Unlock()
+		for _, s := range schemas {
+			s.RLock()
+			for _, r := range s.relations {
+				relations = append(relations, r)
+			}
+			s.RUnlock()
+		}
+	}
+
+	for _, r := range relations {
+		if err := t.lock(r); err != nil {
+			return t.abort(err)
+		}
+		r.stats = r.analyze(buckets)
+		log.Debug("Analyze(%s): %d rows", r.name, r.stats.Rows)
+	}
+
+	return nil
+}
+
+// analyze computes statistics on relation rows. Caller must hold relation lock.
+func (r *Relation) analyze(buckets int) *Stats {
+	s := &Stats{
+		Rows:    int64(r.rows.Len()),
+		Columns: make(map[string]ColumnStats, len(r.attributes)),
+	}
+
+	for i, a := range r.attributes {
+		var c ColumnStats
+		var values []any
+		seen := make(map[any]struct{})
+		for e := r.rows.Front(); e != nil; e = e.Next() {
+			v := e.Value.(*Tuple).values[i]
+			if v == nil {
+				continue
+			}
+			values = append(values, v)
+			seen[statsKey(v)] = struct{}{}
+		}
+		c.Count = int64(len(values))
+		c.Distinct = int64(len(seen))
+		if len(values) > 0 {
+			sort.Slice(values, func(i, j int) bool {
+				return compare(values[i], values[j]) < 0
+			})
+			c.Min, c.Max = values[0], values[len(values)-1]
+			c.Histogram = histogram(values, buckets)
+		}
+		s.Columns[a.name] = c
+	}
+
+	return s
+}
+
+// histogram returns the bounds of equi-depth buckets of sorted values
+func histogram(values []any, buckets int) []any {
+	if buckets > len(values)-1 {
+		buckets = len(values) - 1
+	}
+	if buckets < 1 {
+		return []any{values[0], values[0]}
+	}
+
+	bounds := make([]any, buckets+1)
+	for i := range bounds {
+		bounds[i] = values[i*(len(values)-1)/buckets]
+	}
+	return bounds
+}
+
+// below returns the estimated fraction of non NULL values lower than v,
+// using the histogram of column
+func (c ColumnStats) below(v any) float64 {
+	h := c.Histogram
+	if len(h) < 2 {
+		return 1.0 / 3
+	}
+	if compare(v, h[0]) <= 0 {
+		return 0
+	}
+	buckets := len(h) - 1
+	if compare(v, h[buckets]) > 0 {
+		return 1
+	}
+
+	// first bucket whose upper bound is not lower than v
+	i := sort.Search(buckets, func(i int) bool {
+		return compare(h[i+1], v) >= 0
+	})
+
+	// interpolate within bucket if values are ordered numbers
+	within := 0.5
+	lo, lok := statsPosition(h[i])
+	hi, hok := statsPosition(h[i+1])
+	pos, pok := statsPosition(v)
+	if lok && hok && pok && hi > lo {
+		within = (pos - lo) / (hi - lo)
+	}
+	return (float64(i) + within) / float64(buckets)
+}
+
+// statsKey returns a map key identifying value v
+func statsKey(v any) any {
+	if t, ok := v.(time.Time); ok {
+		return t.UnixNano()
+	}
+	if !reflect.TypeOf(v).Comparable() {
+		return fmt.Sprintf("%T:%v", v, v)
+	}
+	return v
+}
+
+// column returns statistics of attribute, which may be qualified by relation name
+func (s *Stats) column(attr string) (ColumnStats, bool) {
+	if s == nil {
+		return ColumnStats{}, false
+	}
+	if idx := strings.LastIndex(attr, "."); idx != -1 {
+		attr = attr[idx+1:]
+	}
+	c, ok := s.Columns[attr]
+	return c, ok
+}
+
+// selectivity returns the estimated fraction of rows matching p
+func (s *Stats) selectivity(p Predicate) float64 {
+	if s == nil || s.Rows == 0 {
+		return defaultSelectivity
+	}
+
+	switch p.Type() {
+	case And, Or:
+		lp, lok := p.Left()
+		rp, rok := p.Right()
+		if !lok || !rok {
+			return defaultSelectivity
+		}
+		l, r := s.selectivity(lp), s.selectivity(rp)
+		if p.Type() == And {
+			return l * r
+		}
+		return l + r - l*r
+	case True:
+		return 1
+	}
+
+	attr, t, v, ok := comparison(p)
+	if !ok {
+		return defaultSelectivity
+	}
+	c, ok := s.column(attr)
+	if !ok {
+		return defaultSelectivity
+	}
+	if c.Count == 0 || v == nil {
+		return 0
+	}
+	notNull := float64(c.Count) / float64(s.Rows)
+
+	switch t {
+	case Eq:
+		if compare(v, c.Min) < 0 || compare(v, c.Max) > 0 {
+			return 0
+		}
+		return notNull / float64(c.Distinct)
+	case Neq:
+		return notNull * (1 - 1/float64(c.Distinct))
+	}
+
+	// range comparison
+	frac := c.below(v)
+	if t == Ge || t == Geq {
+		frac = 1 - frac
+	}
+	return notNull * frac
+}
+
+// cost returns the cost of sourcing rows matching p from an index of given
+// base cost. Without statistics, base cost is returned as is. Otherwise cost
+// grows with estimated number of rows, base cost only breaking ties.
+func (s *Stats) cost(base int64, p Predicate) int64 {
+	if s == nil {
+		return base
+	}
+	return base + 4*int64(s.selectivity(p)*float64(s.Rows))
+}
+
+// distinct returns the number of distinct values of attr scanned by node n,
+// or 0 if unknown
+func distinct(n Node, attr string) int64 {
+	sc, ok := n.(*RelationScanner)
+	if !ok {
+		return 0
+	}
+	c, ok := sc.stats.column(attr)
+	if !ok {
+		return 0
+	}
+	return c.Distinct
+}
+
+// comparison returns the attribute, comparison type and constant value of
+// comparison predicate p, constant on left side being flipped to the right.
+func comparison(p Predicate) (string, PredicateType, any, bool) {
+	left, right, ok := operands(p)
+	if !ok {
+		return "", 0, nil, false
+	}
+
+	t := p.Type()
+	_, lattr := left.(*AttributeValueFunctor)
+	_, rattr := right.(*AttributeValueFunctor)
+	switch {
+	case lattr && len(right.Attribute()) == 0:
+	case rattr && len(left.Attribute()) == 0:
+		left, right = right, left
+		switch t {
+		case Geq:
+			t = Leq
+		case Ge:
+			t = Le
+		case Leq:
+			t = Geq
+		case Le:
+			t = Ge
+		}
+	default:
+		return "", 0, nil, false
+	}
+
+	v, err := right.Value(nil, nil)
+	if err != nil {
+		return "", 0, nil, false
+	}
+	return left.Attribute()[0], t, v, true
+}
+
+// statsPosition returns v as a float64 if it is a number or a timestamp
+func statsPosition(v any) (float64, bool) {
+	if t, ok := v.(time.Time); ok {
+		return float64(t.UnixNano()), true
+	}
+	i, f, isFloat, err := number(v)
+	if err != nil {
+		return 0, false
+	}
+	if isFloat {
+		return f, true
+	}
+	return float64(i), true
+}
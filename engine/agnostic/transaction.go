@@ -2,47 +2,116 @@ package agnostic
 
 import (
 	"container/list"
+	"context"
 	"errors"
 	"fmt"
 	"reflect"
 	"sort"
+	"strings"
+	"time"
 
 	"github.com/proullon/ramsql/engine/log"
 )
 
+// ErrLockTimeout is returned by statements waiting for a relation lock longer
+// than lock timeout, see SetLockTimeout
+var ErrLockTimeout = errors.New("canceling statement due to lock timeout")
+
+// ErrStatementTimeout is returned by statements running longer than
+// statement timeout, set by caller as the cause of statement context
+// cancellation
+var ErrStatementTimeout = errors.New("canceling statement due to statement timeout")
+
 type Transaction struct {
-	e     *Engine
+	e *Engine
+	// relations locked by transaction, by qualified name
 	locks map[string]*Relation
 
 	// list of Change
 	changes *list.List
 
 	err error
+
+	// context of current statement
+	ctx context.Context
+
+	// auto-increment value generated by last inserted row, if any
+	lastInsertID any
+
+	// relations materialized for current statement, see Materialize
+	derived map[string]*Relation
+
+	// schemas unqualified names are looked up in, see SetSearchPath
+	searchPath []string
+
+	// maximum number of relations scanned concurrently, see SetParallelWorkers
+	workers int
+
+	// maximum wait for a relation lock, see SetLockTimeout
+	lockTimeout time.Duration
+
+	// reject lossy conversions of assigned values, see SetStrictTypes
+	strictTypes bool
+
+	// return rows in a plan independent order, see SetStableOrder
+	stableOrder bool
+
+	// statement level rollback, see SetStatementRollback
+	statementRollback bool
+	// changes recorded before current statement, if started
+	savepoint *list.Element
+	started   bool
+	// rows re-inserted by rollback of a delete, see rollbackValueChange
+	restored map[*list.Element]*list.Element
+	// generation of changes, incremented by each statement started with
+	// statement level rollback, see Tuple
+	generation uint64
 }
 
 func NewTransaction(e *Engine) (*Transaction, error) {
 	t := Transaction{
-		e:       e,
-		locks:   make(map[string]*Relation),
-		changes: list.New(),
+		e:          e,
+		locks:      make(map[string]*Relation),
+		changes:    list.New(),
+		ctx:        context.Background(),
+		workers:    DefaultParallelWorkers,
+		generation: 1,
 	}
 
 	return &t, nil
 }
 
+// SetContext sets the context of following statements. Rows scans and joins
+// check ctx regularly, and statement fails with ctx error once it is done.
+func (t *Transaction) SetContext(ctx context.Context) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	t.ctx = ctx
+}
+
 func (t *Transaction) Commit() (int, error) {
 	if err := t.aborted(); err != nil {
 		return 0, err
 	}
 
 	changed := t.changes.Len()
+	t.started = false
+	t.restored = nil
+
+	if err := t.logCommit(); err != nil {
+		return 0, t.abort(fmt.Errorf("cannot write to log: %w", err))
+	}
 
-	// Remove links to be GC'd faster
+	// Remove links to be GC'd faster, rows written become committed
 	for {
 		b := t.changes.Back()
 		if b == nil {
 			break
 		}
+		if c, ok := b.Value.(ValueChange); ok && c.current != nil {
+			c.current.Value.(*Tuple).written = 0
+		}
 		t.changes.Remove(b)
 	}
 
@@ -56,47 +125,144 @@ func (t *Transaction) Rollback() {
 		return
 	}
 
+	t.rollbackTo(nil)
+	t.started = false
+	t.restored = nil
+	t.unlock()
+}
+
+// SetStatementRollback sets whether an error undoes only the changes of the
+// failing statement, leaving transaction usable, instead of rolling back and
+// aborting the whole transaction. Statements are delimited with
+// StartStatement.
+func (t *Transaction) SetStatementRollback(on bool) {
+	t.statementRollback = on
+}
+
+// StartStatement sets an implicit savepoint a failing statement is rolled
+// back to, when statement level rollback is set.
+func (t *Transaction) StartStatement() {
+	if !t.statementRollback || t.err != nil {
+		return
+	}
+
+	t.savepoint = t.changes.Back()
+	t.started = true
+	t.generation++
+}
+
+// RollbackStatement undoes changes made since StartStatement when statement
+// level rollback is set. Relations locks are kept.
+func (t *Transaction) RollbackStatement() {
+	if !t.statementRollback || !t.started || t.err != nil {
+		return
+	}
+
+	t.rollbackTo(t.savepoint)
+}
+
+// rollbackTo reverts changes recorded after element mark, or every change if
+// mark is nil
+func (t *Transaction) rollbackTo(mark *list.Element) {
+	if t.restored == nil {
+		t.restored = make(map[*list.Element]*list.Element)
+	}
 	for {
 		b := t.changes.Back()
-		if b == nil {
+		if b == nil || b == mark {
 			break
 		}
 		switch b.Value.(type) {
 		case ValueChange:
 			c := b.Value.(ValueChange)
-			t.rollbackValueChange(c)
+			t.rollbackValueChange(c, t.restored)
 		case RelationChange:
 			c := b.Value.(RelationChange)
 			t.rollbackRelationChange(c)
+		case SequenceChange:
+			c := b.Value.(SequenceChange)
+			t.rollbackSequenceChange(c)
+		case EnumChange:
+			c := b.Value.(EnumChange)
+			t.rollbackEnumChange(c)
+		case DomainChange:
+			c := b.Value.(DomainChange)
+			t.rollbackDomainChange(c)
+		case IndexChange:
+			c := b.Value.(IndexChange)
+			t.rollbackIndexChange(c)
+		case AttributeChange:
+			c := b.Value.(AttributeChange)
+			t.rollbackAttributeChange(c, t.restored)
+		case RenameChange:
+			c := b.Value.(RenameChange)
+			t.rollbackRenameChange(c)
+		case TruncateChange:
+			c := b.Value.(TruncateChange)
+			t.rollbackTruncateChange(c)
+		case ForeignKeyChange:
+			c := b.Value.(ForeignKeyChange)
+			t.rollbackForeignKeyChange(c)
 		}
 		t.changes.Remove(b)
 	}
+}
 
-	t.unlock()
+// Reset makes transaction usable again, as a new transaction on the same
+// engine. Pending changes are rolled back and the error left by Commit or by
+// a failed statement is cleared. Search path and parallel workers are kept.
+func (t *Transaction) Reset() {
+	// an aborted transaction has already been rolled back
+	t.Rollback()
+
+	t.err = nil
+	t.started = false
+	t.restored = nil
+	t.changes.Init()
+	t.locks = make(map[string]*Relation)
+	t.ctx = context.Background()
+	t.lastInsertID = nil
+	t.derived = nil
 }
 
 func (t Transaction) Error() error {
 	return t.err
 }
 
-func (t *Transaction) Truncate(schema, relation string) (int64, error) {
+// Truncate removes all rows from relation. If restartIdentity is set,
+// auto-increment attributes restart from their initial value.
+//
+// Like Delete, Truncate is reverted by Rollback.
+func (t *Transaction) Truncate(schema, relation string, restartIdentity bool) (int64, error) {
 	if err := t.aborted(); err != nil {
 		return 0, err
 	}
 
-	s, err := t.e.schema(schema)
+	s, err := t.e.schema(t.resolve(schema, relation))
 	if err != nil {
-		return 0, err
+		return 0, t.abort(err)
 	}
 
 	r, err := s.Relation(relation)
 	if err != nil {
-		return 0, err
+		return 0, t.abort(err)
 	}
 
-	c := r.Truncate()
+	if err := t.lock(r); err != nil {
+		return 0, t.abort(err)
+	}
+
+	rows, nextValues := r.truncate(restartIdentity)
+
+	c := TruncateChange{
+		relation:   r,
+		rows:       rows,
+		nextValues: nextValues,
+	}
+	t.changes.PushBack(c)
+	log.Debug("Truncate(%s, %s, %v)", schema, relation, restartIdentity)
 
-	return c, nil
+	return int64(rows.Len()), nil
 }
 
 func (t *Transaction) RelationAttribute(schName, relName, attrName string) (int, Attribute, error) {
@@ -104,7 +270,8 @@ func (t *Transaction) RelationAttribute(schName, relName, attrName string) (int,
 		return 0, Attribute{}, err
 	}
 
-	s, err := t.e.schema(schName)
+	schName, relName = splitQualified(schName, relName)
+	s, err := t.schema(schName)
 	if err != nil {
 		return 0, Attribute{}, err
 	}
@@ -117,12 +284,34 @@ func (t *Transaction) RelationAttribute(schName, relName, attrName string) (int,
 	return r.Attribute(attrName)
 }
 
+// RelationAttributes returns attributes of given relation, in declaration order
+func (t *Transaction) RelationAttributes(schName, relName string) ([]Attribute, error) {
+	if err := t.aborted(); err != nil {
+		return nil, err
+	}
+
+	schName, relName = splitQualified(schName, relName)
+	s, err := t.schema(schName)
+	if err != nil {
+		return nil, err
+	}
+
+	r, err := s.Relation(relName)
+	if err != nil {
+		return nil, err
+	}
+
+	attrs := make([]Attribute, len(r.attributes))
+	copy(attrs, r.attributes)
+	return attrs, nil
+}
+
 func (t *Transaction) CheckRelation(schemaName, relName string) bool {
 	if err := t.aborted(); err != nil {
 		return false
 	}
 
-	s, err := t.e.schema(schemaName)
+	s, err := t.schema(schemaName)
 	if err != nil {
 		return false
 	}
@@ -136,6 +325,24 @@ func (t *Transaction) CreateRelation(schemaName, relName string, attributes []At
 		return err
 	}
 
+	schemaName = t.resolve(schemaName, "")
+	sn := schemaName
+	if sn == "" {
+		sn = DefaultSchema
+	}
+	attributes = append([]Attribute(nil), attributes...)
+	for i := range attributes {
+		attributes[i] = t.withType(attributes[i])
+	}
+	for _, a := range attributes {
+		if a.fk == nil {
+			continue
+		}
+		if err := t.checkForeignKey(a.fk, sn, relName, attributes, pk); err != nil {
+			return t.abort(err)
+		}
+	}
+
 	s, r, err := t.e.createRelation(schemaName, relName, attributes, pk)
 	if err != nil {
 		return t.abort(err)
@@ -149,16 +356,41 @@ func (t *Transaction) CreateRelation(schemaName, relName string, attributes []At
 	t.changes.PushBack(c)
 	log.Debug("CreateRelation(%s,%s,%s,%s)", schemaName, relName, attributes, pk)
 
-	t.lock(r)
+	if err := t.lock(r); err != nil {
+		return t.abort(err)
+	}
 	return nil
 }
 
-func (t *Transaction) DropRelation(schemaName, relName string) error {
+// DropRelation drops relation of given schema. If foreign keys of other
+// relations reference it, drop fails unless cascade is set, in which case
+// these foreign keys are dropped too.
+func (t *Transaction) DropRelation(schemaName, relName string, cascade bool) error {
 	if err := t.aborted(); err != nil {
 		return err
 	}
 
-	s, r, err := t.e.dropRelation(schemaName, relName)
+	schemaName = t.resolve(schemaName, relName)
+	s, err := t.e.schema(schemaName)
+	if err != nil {
+		return t.abort(err)
+	}
+	r, err := s.Relation(relName)
+	if err != nil {
+		return t.abort(err)
+	}
+
+	refs := t.referencing(s, r)
+	if len(refs) > 0 && !cascade {
+		return t.abort(NewError(DependentObjectsExist, "cannot drop relation %s because %s.%s references it", relName, refs[0].relation.name, refs[0].attribute).On(relName, ""))
+	}
+	for _, ref := range refs {
+		if err := t.dropForeignKey(ref); err != nil {
+			return t.abort(err)
+		}
+	}
+
+	s, r, err = t.e.dropRelation(schemaName, relName)
 	if err != nil {
 		return t.abort(err)
 	}
@@ -173,12 +405,246 @@ func (t *Transaction) DropRelation(schemaName, relName string) error {
 	return nil
 }
 
+// AddAttribute appends attribute to relation. Existing rows get attribute
+// default value, or NULL if it has none.
+//
+// Adding a NOT NULL attribute without default to a non-empty relation fails.
+func (t *Transaction) AddAttribute(schemaName, relName string, attr Attribute) error {
+	if err := t.aborted(); err != nil {
+		return err
+	}
+
+	s, err := t.e.schema(t.resolve(schemaName, relName))
+	if err != nil {
+		return t.abort(err)
+	}
+
+	r, err := s.Relation(relName)
+	if err != nil {
+		return t.abort(err)
+	}
+
+	if err := t.lock(r); err != nil {
+		return t.abort(err)
+	}
+
+	attr = t.withType(attr)
+	if attr.fk != nil {
+		if err := t.checkForeignKey(attr.fk, "", "", nil, nil); err != nil {
+			return t.abort(err)
+		}
+	}
+
+	if err := r.addAttribute(attr, t.e.Now()); err != nil {
+		return t.abort(err)
+	}
+
+	c := AttributeChange{
+		relation: r,
+		current:  &attr,
+	}
+	t.changes.PushBack(c)
+	log.Debug("AddAttribute(%s, %s, %s)", schemaName, relName, attr.name)
+
+	return nil
+}
+
+// DropAttribute removes attribute from relation, along with its values and
+// the indexes over it.
+//
+// Primary key attributes and attributes referenced by a foreign key cannot be dropped.
+func (t *Transaction) DropAttribute(schemaName, relName, attrName string) error {
+	if err := t.aborted(); err != nil {
+		return err
+	}
+
+	s, err := t.e.schema(t.resolve(schemaName, relName))
+	if err != nil {
+		return t.abort(err)
+	}
+
+	r, err := s.Relation(relName)
+	if err != nil {
+		return t.abort(err)
+	}
+
+	if err := t.lock(r); err != nil {
+		return t.abort(err)
+	}
+
+	a, pos, values, indexes, err := r.dropAttribute(attrName, len(t.foreignKeys(s.name, r.name, attrName)) > 0)
+	if err != nil {
+		return t.abort(err)
+	}
+
+	c := AttributeChange{
+		relation: r,
+		old:      &a,
+		pos:      pos,
+		values:   values,
+		indexes:  indexes,
+	}
+	t.changes.PushBack(c)
+	log.Debug("DropAttribute(%s, %s, %s)", schemaName, relName, attrName)
+
+	return nil
+}
+
+// RenameRelation renames relation of given schema.
+//
+// Foreign keys referencing the relation follow it.
+func (t *Transaction) RenameRelation(schemaName, relName, name string) error {
+	if err := t.aborted(); err != nil {
+		return err
+	}
+
+	s, err := t.e.schema(t.resolve(schemaName, relName))
+	if err != nil {
+		return t.abort(err)
+	}
+
+	r, err := s.Relation(relName)
+	if err != nil {
+		return t.abort(err)
+	}
+
+	if _, err := s.Relation(name); err == nil {
+		return t.abort(NewError(DuplicateTable, "relation '%s'.'%s' already exists", s.name, name).On(name, ""))
+	}
+
+	if err := t.lock(r); err != nil {
+		return t.abort(err)
+	}
+	t.renameRelation(s, r, name)
+
+	c := RenameChange{
+		schema:   s,
+		relation: r,
+		current:  name,
+		old:      relName,
+	}
+	t.changes.PushBack(c)
+	log.Debug("RenameRelation(%s, %s, %s)", schemaName, relName, name)
+
+	return nil
+}
+
+// renameRelation renames r in schema s, its lock held by transaction and
+// foreign keys referencing it.
+func (t *Transaction) renameRelation(s *Schema, r *Relation, name string) {
+	old, oldKey := r.name, r.String()
+	fks := t.foreignKeys(s.name, old, "")
+
+	s.Remove(old)
+	r.rename(name)
+	s.Add(name, r)
+
+	if l, ok := t.locks[oldKey]; ok && l == r {
+		delete(t.locks, oldKey)
+		t.locks[r.String()] = r
+	}
+
+	for _, fk := range fks {
+		fk.relation = name
+	}
+}
+
+// RenameAttribute renames attribute of relation.
+//
+// Foreign keys referencing the attribute follow it.
+func (t *Transaction) RenameAttribute(schemaName, relName, attrName, name string) error {
+	if err := t.aborted(); err != nil {
+		return err
+	}
+
+	s, err := t.e.schema(t.resolve(schemaName, relName))
+	if err != nil {
+		return t.abort(err)
+	}
+
+	r, err := s.Relation(relName)
+	if err != nil {
+		return t.abort(err)
+	}
+
+	if err := t.lock(r); err != nil {
+		return t.abort(err)
+	}
+
+	if err := t.renameAttribute(s, r, attrName, name); err != nil {
+		return t.abort(err)
+	}
+
+	c := RenameChange{
+		schema:    s,
+		relation:  r,
+		attribute: true,
+		current:   name,
+		old:       attrName,
+	}
+	t.changes.PushBack(c)
+	log.Debug("RenameAttribute(%s, %s, %s, %s)", schemaName, relName, attrName, name)
+
+	return nil
+}
+
+// renameAttribute renames attribute of r and foreign keys referencing it
+func (t *Transaction) renameAttribute(s *Schema, r *Relation, old, name string) error {
+	fks := t.foreignKeys(s.name, r.name, old)
+
+	if err := r.renameAttribute(old, name); err != nil {
+		return err
+	}
+
+	for _, fk := range fks {
+		fk.attribute = name
+	}
+
+	return nil
+}
+
+// foreignKeys returns foreign keys of any relation referencing given
+// relation. If attribute is not empty, only foreign keys referencing
+// this attribute are returned.
+func (t *Transaction) foreignKeys(schema, relation, attribute string) []*ForeignKey {
+	t.e.Lock()
+	schemas := make([]*Schema, 0, len(t.e.schemas))
+	for _, s := range t.e.schemas {
+		schemas = append(schemas, s)
+	}
+	t.e.Unlock()
+
+	var fks []*ForeignKey
+	for _, s := range schemas {
+		s.RLock()
+		relations := make([]*Relation, 0, len(s.relations))
+		for _, r := range s.relations {
+			relations = append(relations, r)
+		}
+		s.RUnlock()
+
+		for _, r := range relations {
+			for _, a := range t.relationAttributes(r) {
+				if a.fk == nil || a.fk.schema != schema || a.fk.relation != relation {
+					continue
+				}
+				if attribute != "" && a.fk.attribute != attribute {
+					continue
+				}
+				fks = append(fks, a.fk)
+			}
+		}
+	}
+
+	return fks
+}
+
 func (t *Transaction) CheckSchema(schemaName string) bool {
 	if err := t.aborted(); err != nil {
 		return false
 	}
 
-	_, err := t.e.schema(schemaName)
+	_, err := t.schema(schemaName)
 	return err == nil
 }
 
@@ -213,6 +679,21 @@ func (t *Transaction) DropSchema(schemaName string) error {
 		return t.abort(err)
 	}
 
+	// foreign keys of other schemas relations cannot reference dropped relations
+	s.RLock()
+	relations := make([]*Relation, 0, len(s.relations))
+	for _, r := range s.relations {
+		relations = append(relations, r)
+	}
+	s.RUnlock()
+	for _, r := range relations {
+		for _, ref := range t.referencing(s, r) {
+			if err := t.dropForeignKey(ref); err != nil {
+				return t.abort(err)
+			}
+		}
+	}
+
 	c := SchemaChange{
 		current: nil,
 		old:     s,
@@ -223,28 +704,422 @@ func (t *Transaction) DropSchema(schemaName string) error {
 	return nil
 }
 
-func (t *Transaction) CreateIndex(schema, relation, index string, it IndexType, attrs []string) error {
+func (t *Transaction) CreateSequence(schemaName, seqName string, start, increment int64) error {
+	if err := t.aborted(); err != nil {
+		return err
+	}
+
+	s, seq, err := t.e.createSequence(t.resolve(schemaName, ""), seqName, start, increment)
+	if err != nil {
+		return t.abort(err)
+	}
+
+	c := SequenceChange{
+		schema:  s,
+		current: seq,
+		old:     nil,
+	}
+	t.changes.PushBack(c)
+	log.Debug("CreateSequence(%s,%s,%d,%d)", schemaName, seqName, start, increment)
+
+	return nil
+}
+
+func (t *Transaction) DropSequence(schemaName, seqName string) error {
+	if err := t.aborted(); err != nil {
+		return err
+	}
+
+	s, seq, err := t.e.dropSequence(t.resolve(schemaName, seqName), seqName)
+	if err != nil {
+		return t.abort(err)
+	}
+
+	c := SequenceChange{
+		schema:  s,
+		current: nil,
+		old:     seq,
+	}
+	t.changes.PushBack(c)
+
+	return nil
+}
+
+func (t *Transaction) CheckSequence(schemaName, seqName string) bool {
+	if err := t.aborted(); err != nil {
+		return false
+	}
+
+	s, err := t.e.schema(t.resolve(schemaName, seqName))
+	if err != nil {
+		return false
+	}
+
+	_, err = s.Sequence(seqName)
+	return err == nil
+}
+
+// CreateEnum creates an enum type of given schema, whose values are labels
+func (t *Transaction) CreateEnum(schemaName, name string, labels []string) error {
+	if err := t.aborted(); err != nil {
+		return err
+	}
+
+	s, enum, err := t.e.createEnum(t.resolve(schemaName, ""), name, labels)
+	if err != nil {
+		return t.abort(err)
+	}
+
+	c := EnumChange{
+		schema:  s,
+		current: enum,
+		old:     nil,
+	}
+	t.changes.PushBack(c)
+	log.Debug("CreateEnum(%s,%s,%v)", schemaName, name, labels)
+
+	return nil
+}
+
+// DropEnum drops an enum type of given schema. It fails if an attribute of
+// a relation of the schema has this type.
+func (t *Transaction) DropEnum(schemaName, name string) error {
+	if err := t.aborted(); err != nil {
+		return err
+	}
+
+	schemaName = t.resolve(schemaName, name)
+	s, err := t.e.schema(schemaName)
+	if err != nil {
+		return t.abort(err)
+	}
+	if _, err := s.Enum(name); err != nil {
+		return t.abort(err)
+	}
+
+	s.RLock()
+	relations := make([]*Relation, 0, len(s.relations))
+	for _, r := range s.relations {
+		relations = append(relations, r)
+	}
+	s.RUnlock()
+	for _, r := range relations {
+		if err := t.lock(r); err != nil {
+			return t.abort(err)
+		}
+		for _, a := range r.attributes {
+			if a.enum != nil && a.enum.name == name {
+				return t.abort(NewError(DependentObjectsExist, "cannot drop type %s because column %s of table %s depends on it", name, a.name, r.name))
+			}
+		}
+	}
+
+	s, enum, err := t.e.dropEnum(schemaName, name)
+	if err != nil {
+		return t.abort(err)
+	}
+
+	c := EnumChange{
+		schema:  s,
+		current: nil,
+		old:     enum,
+	}
+	t.changes.PushBack(c)
+
+	return nil
+}
+
+// CheckEnum returns true if enum type exists in given schema
+func (t *Transaction) CheckEnum(schemaName, name string) bool {
+	if err := t.aborted(); err != nil {
+		return false
+	}
+
+	s, err := t.e.schema(t.resolve(schemaName, name))
+	if err != nil {
+		return false
+	}
+
+	_, err = s.Enum(name)
+	return err == nil
+}
+
+// CreateDomain creates domain d in given schema
+func (t *Transaction) CreateDomain(schemaName string, d *Domain) error {
+	if err := t.aborted(); err != nil {
+		return err
+	}
+
+	if d.defaultValue != nil {
+		if err := d.validate(d.defaultValue); err != nil {
+			return t.abort(err)
+		}
+	}
+
+	s, err := t.e.createDomain(t.resolve(schemaName, ""), d)
+	if err != nil {
+		return t.abort(err)
+	}
+
+	c := DomainChange{
+		schema:  s,
+		current: d,
+		old:     nil,
+	}
+	t.changes.PushBack(c)
+	log.Debug("CreateDomain(%s,%s,%s)", schemaName, d.name, d.baseType)
+
+	return nil
+}
+
+// DropDomain drops a domain of given schema. It fails if an attribute of a
+// relation of the schema has this type.
+func (t *Transaction) DropDomain(schemaName, name string) error {
+	if err := t.aborted(); err != nil {
+		return err
+	}
+
+	schemaName = t.resolve(schemaName, name)
+	s, err := t.e.schema(schemaName)
+	if err != nil {
+		return t.abort(err)
+	}
+	if _, err := s.Domain(name); err != nil {
+		return t.abort(err)
+	}
+
+	s.RLock()
+	relations := make([]*Relation, 0, len(s.relations))
+	for _, r := range s.relations {
+		relations = append(relations, r)
+	}
+	s.RUnlock()
+	for _, r := range relations {
+		if err := t.lock(r); err != nil {
+			return t.abort(err)
+		}
+		for _, a := range r.attributes {
+			if a.domain != nil && a.domain.name == name {
+				return t.abort(NewError(DependentObjectsExist, "cannot drop type %s because column %s of table %s depends on it", name, a.name, r.name))
+			}
+		}
+	}
+
+	s, d, err := t.e.dropDomain(schemaName, name)
+	if err != nil {
+		return t.abort(err)
+	}
+
+	c := DomainChange{
+		schema:  s,
+		current: nil,
+		old:     d,
+	}
+	t.changes.PushBack(c)
+
+	return nil
+}
+
+// CheckDomain returns true if domain exists in given schema
+func (t *Transaction) CheckDomain(schemaName, name string) bool {
+	_, err := t.Domain(schemaName, name)
+	return err == nil
+}
+
+// Domain returns domain called name of given schema, looked up in search
+// path if schema is empty
+func (t *Transaction) Domain(schemaName, name string) (*Domain, error) {
+	if err := t.aborted(); err != nil {
+		return nil, err
+	}
+
+	s, err := t.e.schema(t.resolve(schemaName, name))
+	if err != nil {
+		return nil, err
+	}
+
+	return s.Domain(name)
+}
+
+// withType returns attribute a with the enum type or the domain it was
+// declared with, if its type is not a builtin one. Types are looked up in
+// search path.
+func (t *Transaction) withType(a Attribute) Attribute {
+	if _, ok := castFunc(a.typeName); ok {
+		return a
+	}
+	name := strings.ToLower(a.typeName)
+	s, err := t.e.schema(t.resolve("", name))
+	if err != nil {
+		return a
+	}
+	if enum, err := s.Enum(name); err == nil {
+		return a.WithEnum(enum)
+	}
+	if d, err := s.Domain(name); err == nil {
+		return a.WithDomain(d)
+	}
+	return a
+}
+
+// NextValue advances given sequence and returns its new value.
+//
+// Advancing a sequence is never rolled back, see Sequence.
+func (t *Transaction) NextValue(schemaName, seqName string) (int64, error) {
+	if err := t.aborted(); err != nil {
+		return 0, err
+	}
+
+	s, err := t.e.schema(t.resolve(schemaName, seqName))
+	if err != nil {
+		return 0, t.abort(err)
+	}
+
+	seq, err := s.Sequence(seqName)
+	if err != nil {
+		return 0, t.abort(err)
+	}
+
+	return seq.Next(), nil
+}
+
+// CurrentValue returns the value most recently obtained by NextValue for given sequence.
+func (t *Transaction) CurrentValue(schemaName, seqName string) (int64, error) {
+	if err := t.aborted(); err != nil {
+		return 0, err
+	}
+
+	s, err := t.e.schema(t.resolve(schemaName, seqName))
+	if err != nil {
+		return 0, t.abort(err)
+	}
+
+	seq, err := s.Sequence(seqName)
+	if err != nil {
+		return 0, t.abort(err)
+	}
+
+	v, err := seq.Current()
+	if err != nil {
+		return 0, t.abort(err)
+	}
+
+	return v, nil
+}
+
+// CheckIndex returns true if named index exists on relation. If relName is
+// empty, every relation of schema is searched.
+func (t *Transaction) CheckIndex(schemaName, relName, index string) bool {
+	if err := t.aborted(); err != nil {
+		return false
+	}
+
+	s, err := t.e.schema(t.resolve(schemaName, relName))
+	if err != nil {
+		return false
+	}
+
+	if relName == "" {
+		s.RLock()
+		defer s.RUnlock()
+		for _, r := range s.relations {
+			if _, i := r.index(index); i != nil {
+				return true
+			}
+		}
+		return false
+	}
+
+	r, err := s.Relation(relName)
+	if err != nil {
+		return false
+	}
+
+	_, i := r.index(index)
+	return i != nil
+}
+
+// CreateIndex builds a new index on given relation attributes, indexing existing rows.
+//
+// If unique is set, index creation fails if relation already contains duplicate keys,
+// and subsequent inserts violating unicity are rejected.
+func (t *Transaction) CreateIndex(schema, relation, index string, it IndexType, unique bool, attrs []string) error {
+	if err := t.aborted(); err != nil {
+		return err
+	}
+
+	s, err := t.e.schema(t.resolve(schema, relation))
+	if err != nil {
+		return t.abort(err)
+	}
+
+	r, err := s.Relation(relation)
+	if err != nil {
+		return t.abort(err)
+	}
+
+	if err := t.lock(r); err != nil {
+		return t.abort(err)
+	}
+
+	i, err := r.createIndex(index, it, unique, attrs)
+	if err != nil {
+		return t.abort(err)
+	}
+
+	c := IndexChange{
+		relation: r,
+		current:  i,
+		old:      nil,
+	}
+	t.changes.PushBack(c)
+	log.Debug("CreateIndex(%s, %s, %s, %s)", schema, relation, index, attrs)
+
+	return nil
+}
+
+// DropIndex removes named index from the relation holding it in given schema.
+//
+// Indexes backing a primary key or unique constraint cannot be dropped.
+func (t *Transaction) DropIndex(schemaName, index string) error {
 	if err := t.aborted(); err != nil {
 		return err
 	}
 
-	s, err := t.e.schema(schema)
-	if err != nil {
-		return err
+	s, err := t.e.schema(t.resolve(schemaName, ""))
+	if err != nil {
+		return t.abort(err)
+	}
+
+	var r *Relation
+	s.RLock()
+	for _, rel := range s.relations {
+		if _, i := rel.index(index); i != nil {
+			r = rel
+			break
+		}
+	}
+	s.RUnlock()
+	if r == nil {
+		return t.abort(fmt.Errorf("index %s does not exist in schema %s", index, s.name))
+	}
+
+	if err := t.lock(r); err != nil {
+		return t.abort(err)
 	}
 
-	r, err := s.Relation(relation)
+	i, err := r.dropIndex(index)
 	if err != nil {
-		return err
+		return t.abort(err)
 	}
 
-	t.lock(r)
-
-	err = r.createIndex(index, it, attrs)
-	if err != nil {
-		return err
+	c := IndexChange{
+		relation: r,
+		current:  nil,
+		old:      i,
 	}
-	log.Debug("CreateIndex(%s, %s, %s, %s)", schema, relation, index, attrs)
+	t.changes.PushBack(c)
+	log.Debug("DropIndex(%s, %s)", schemaName, index)
 
 	return nil
 }
@@ -257,7 +1132,7 @@ func (t *Transaction) Delete(schema, relation string, selectors []Selector, p Pr
 		return nil, nil, err
 	}
 
-	s, err := t.e.schema(schema)
+	s, err := t.e.schema(t.resolve(schema, relation))
 	if err != nil {
 		return nil, nil, err
 	}
@@ -267,6 +1142,11 @@ func (t *Transaction) Delete(schema, relation string, selectors []Selector, p Pr
 		return nil, nil, err
 	}
 
+	// predicate may not reference relation, i.e. DELETE without WHERE clause
+	if len(selectors) == 0 {
+		selectors = []Selector{NewStarSelector(relation)}
+	}
+
 	n, err := t.Plan(schema, selectors, p, nil, nil)
 	if err != nil {
 		return nil, nil, err
@@ -306,7 +1186,7 @@ func (t *Transaction) Update(schema, relation string, values map[string]any, sel
 		return nil, nil, err
 	}
 
-	s, err := t.e.schema(schema)
+	s, err := t.e.schema(t.resolve(schema, relation))
 	if err != nil {
 		return nil, nil, err
 	}
@@ -316,6 +1196,11 @@ func (t *Transaction) Update(schema, relation string, values map[string]any, sel
 		return nil, nil, err
 	}
 
+	// predicate may not reference relation, i.e. UPDATE without WHERE clause
+	if len(selectors) == 0 {
+		selectors = []Selector{NewStarSelector(relation)}
+	}
+
 	n, err := t.Plan(schema, selectors, p, nil, nil)
 	if err != nil {
 		return nil, nil, err
@@ -326,7 +1211,8 @@ func (t *Transaction) Update(schema, relation string, values map[string]any, sel
 		return nil, nil, fmt.Errorf("could not find selector node")
 	}
 
-	un := NewUpdaterNode(r, t.changes, values)
+	un := NewUpdaterNode(r, t.changes, t.generation, values)
+	un.strict = t.strictTypes
 
 	snode.child, un.child = un, snode.child
 
@@ -364,7 +1250,7 @@ func (t *Transaction) Insert(schema, relation string, values map[string]any) (*T
 		return nil, err
 	}
 
-	s, err := t.e.schema(schema)
+	s, err := t.e.schema(t.resolve(schema, relation))
 	if err != nil {
 		return nil, t.abort(err)
 	}
@@ -373,80 +1259,142 @@ func (t *Transaction) Insert(schema, relation string, values map[string]any) (*T
 		return nil, t.abort(err)
 	}
 
-	t.lock(r)
+	if err := t.lock(r); err != nil {
+		return nil, t.abort(err)
+	}
 
 	log.Debug("Insert into %s.%s: %v", schema, relation, values)
 
-	tuple := &Tuple{}
-	for i, attr := range r.attributes {
-		val, specified := values[attr.name]
-		if !specified {
-			if attr.defaultValue != nil {
-				tuple.Append(attr.defaultValue())
-				continue
-			}
-			if attr.autoIncrement {
-				tuple.Append(reflect.ValueOf(attr.nextValue).Convert(attr.typeInstance).Interface())
-				r.attributes[i].nextValue++
-				continue
-			}
-		}
-		if specified {
-			if val == nil {
-				tuple.Append(val)
-				delete(values, attr.name)
-				continue
-			}
-			tof := reflect.TypeOf(val)
-			if !tof.ConvertibleTo(attr.typeInstance) {
-				return nil, t.abort(fmt.Errorf("cannot assign '%v' (type %s) to %s.%s (type %s)", val, tof, relation, attr.name, attr.typeInstance))
-			}
-			if attr.unique {
-				f := NewAttributeValueFunctor(r.name, attr.name)
-				p := NewEqPredicate(f, f)
-				for _, index := range r.indexes {
-					if ok, _ := index.CanSourceWith(p); !ok {
-						continue
-					}
-					idx, ok := index.(*HashIndex)
-					if !ok {
-						return nil, t.abort(fmt.Errorf("cannot check unicity of %s", attr))
-					}
-					tuple, err := idx.Get([]any{val})
-					if err != nil {
-						return nil, t.abort(fmt.Errorf("cannot check unicity of %s", attr))
-					}
-					if tuple != nil {
-						return nil, t.abort(fmt.Errorf("constraint violation: %s unicity", attr))
-					}
-				}
-			}
-			if attr.fk != nil {
-				// TODO: predicate: equal
-			}
-			tuple.Append(reflect.ValueOf(val).Convert(attr.typeInstance).Interface())
-			delete(values, attr.name)
-			continue
+	tuple, key, err := r.buildTuple(values, t.strictTypes, t.e.Now())
+	if err != nil {
+		return nil, t.abort(err)
+	}
+
+	if err := t.insertTuple(r, tuple); err != nil {
+		return nil, t.abort(err)
+	}
+	t.lastInsertID = key
+
+	return tuple, nil
+}
+
+// LastInsertID returns the auto-increment value generated for the last row
+// inserted in transaction. ok is false if no value was generated.
+func (t *Transaction) LastInsertID() (id int64, ok bool) {
+	if t.lastInsertID == nil {
+		return 0, false
+	}
+
+	v := reflect.ValueOf(t.lastInsertID)
+	if !v.CanConvert(reflect.TypeOf(id)) {
+		return 0, false
+	}
+
+	return v.Convert(reflect.TypeOf(id)).Int(), true
+}
+
+// ConflictAction describes what Upsert does when a new row collides with an
+// existing one on primary key or on a unique index.
+type ConflictAction struct {
+	// Attributes of the unique constraint to check. If empty, all unique constraints are checked.
+	Attributes []string
+	// Update returns values to set on the existing row, given the row proposed for insertion.
+	// If Update is nil, the proposed row is skipped.
+	Update func(excluded *Tuple) (map[string]any, error)
+}
+
+// Upsert inserts values into relation like Insert, unless the new row
+// collides with an existing one. In this case the existing row is either
+// updated as described by action, or left untouched.
+//
+// Upsert returns the inserted or updated tuple, or nil if the row was skipped.
+func (t *Transaction) Upsert(schema, relation string, values map[string]any, action ConflictAction) (*Tuple, error) {
+	if err := t.aborted(); err != nil {
+		return nil, err
+	}
+
+	s, err := t.e.schema(t.resolve(schema, relation))
+	if err != nil {
+		return nil, t.abort(err)
+	}
+	r, err := s.Relation(relation)
+	if err != nil {
+		return nil, t.abort(err)
+	}
+
+	if err := t.lock(r); err != nil {
+		return nil, t.abort(err)
+	}
+
+	log.Debug("Upsert into %s.%s: %v", schema, relation, values)
+
+	t.lastInsertID = nil
+	tuple, key, err := r.buildTuple(values, t.strictTypes, t.e.Now())
+	if err != nil {
+		return nil, t.abort(err)
+	}
+
+	e, err := r.conflict(tuple, action.Attributes)
+	if err != nil {
+		return nil, t.abort(err)
+	}
+
+	if e == nil {
+		if err := t.insertTuple(r, tuple); err != nil {
+			return nil, t.abort(err)
 		}
-		return nil, t.abort(fmt.Errorf("no value for %s.%s", relation, attr.name))
+		t.lastInsertID = key
+		return tuple, nil
+	}
+
+	if action.Update == nil {
+		return nil, nil
+	}
+
+	set, err := action.Update(tuple)
+	if err != nil {
+		return nil, t.abort(err)
+	}
+
+	u := NewUpdaterNode(r, t.changes, t.generation, set)
+	u.strict = t.strictTypes
+	if err := u.validate(); err != nil {
+		return nil, t.abort(err)
+	}
+	cols := make([]string, len(r.attributes))
+	for i, a := range r.attributes {
+		cols[i] = a.name
+	}
+	if err := u.update(cols, e); err != nil {
+		return nil, t.abort(err)
 	}
 
-	// if values map is not empty, then an non existing attribute was specified
-	for k := range values {
-		return nil, t.abort(fmt.Errorf("attribute %s does not exist in relation %s", k, relation))
+	return e.Value.(*Tuple), nil
+}
+
+// insertTuple checks constraints, then adds tuple to relation rows and indexes.
+func (t *Transaction) insertTuple(r *Relation, tuple *Tuple) error {
+	if limit := t.e.MaxRows(); limit > 0 && int64(r.rows.Len()) >= limit {
+		return NewError(ProgramLimitExceeded, "relation %s cannot hold more than %d rows", r.name, limit).On(r.name, "")
+	}
+
+	// check unique indexes violation
+	if err := r.CheckUnique(tuple); err != nil {
+		return err
 	}
 
 	// check primary key violation
 	ok, err := r.CheckPrimaryKey(tuple)
 	if err != nil {
-		return nil, t.abort(err)
+		return err
 	}
 	if !ok {
-		return nil, t.abort(fmt.Errorf("primary key violation"))
+		return NewError(UniqueViolation, "primary key violation").On(r.name, "")
 	}
 
 	// insert into row list
 	log.Debug("Inserting %v", tuple.values)
+	tuple.written = t.generation
 	e := r.rows.PushBack(tuple)
 
 	// update indexes
@@ -456,13 +1404,14 @@ func (t *Transaction) Insert(schema, relation string, values map[string]any) (*T
 
 	// add change
 	c := ValueChange{
-		current: e,
-		old:     nil,
-		l:       r.rows,
+		current:  e,
+		old:      nil,
+		l:        r.rows,
+		relation: r,
 	}
 	t.changes.PushBack(c)
 
-	return tuple, nil
+	return nil
 }
 
 // Query data from relations
@@ -474,27 +1423,42 @@ func (t *Transaction) Insert(schema, relation string, values map[string]any) (*T
 // * (1) Transaction safety : list all touched relations and lock them
 // * (2) Sourcing           : evaluate which indexes query can use for each relation. HashIndex > Btree > SeqScan
 // * (3) Join ordering      : estimate the cardinality (Join selection factor) of each relation after predicates filtering, then order the join by lower cardinality
-// * (4) Selection          : build filtered relations on each leaf (parallelisation possible)
+// * (4) Selection          : build filtered relations on each leaf, concurrently, see SetParallelWorkers
 // * (5) Join               : join filtered relations on each node recursively
 // * (6) Return result      : return result to user with selectors
 //
-// TODO: foreign keys should have hashmap index
-func (t *Transaction) Query(schema string, selectors []Selector, p Predicate, joiners []Joiner, sorters []Sorter) ([]string, []*Tuple, error) {
+// Relations are referenced by name, or by alias when given, so a relation can
+// be read several times, like in a self-join.
+func (t *Transaction) Query(schema string, selectors []Selector, p Predicate, joiners []Joiner, sorters []Sorter, aliases ...Alias) ([]string, []*Tuple, error) {
 	if err := t.aborted(); err != nil {
 		return nil, nil, err
 	}
 
-	n, err := t.Plan(schema, selectors, p, joiners, sorters)
+	n, err := t.Plan(schema, selectors, p, joiners, sorters, aliases...)
 	if err != nil {
 		return nil, nil, err
 	}
 	PrintQueryPlan(n, 0, nil)
 
-	// (4), (5), (6)
+	// collect plan metrics if requested, see WithPlanMetrics
+	m := planMetrics(t.ctx)
+	if m != nil {
+		n = recAnalyzeNode(n)
+	}
+
+	// (4)
+	if err := prefetch(n, t.workers); err != nil {
+		return nil, nil, t.abort(err)
+	}
+
+	// (5), (6)
 	columns, eres, err := n.Exec()
 	if err != nil {
 		return nil, nil, t.abort(err)
 	}
+	if m != nil {
+		m.Nodes = planNodes(n, 0, nil)
+	}
 
 	res := make([]*Tuple, len(eres))
 	for i, e := range eres {
@@ -504,6 +1468,81 @@ func (t *Transaction) Query(schema string, selectors []Selector, p Predicate, jo
 	return columns, res, nil
 }
 
+// Explain plans the query like Query, but returns the plan tree instead of
+// executing it. Each returned row describes a node with its depth in the tree,
+// its description and its estimated cardinal.
+func (t *Transaction) Explain(schema string, selectors []Selector, p Predicate, joiners []Joiner, sorters []Sorter, aliases ...Alias) ([]string, []*Tuple, error) {
+	if err := t.aborted(); err != nil {
+		return nil, nil, err
+	}
+
+	n, err := t.Plan(schema, selectors, p, joiners, sorters, aliases...)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return []string{"depth", "node", "estimated_cardinal"}, recExplain(n, 0, nil), nil
+}
+
+// Analyze plans and executes the query like Query, then returns the plan tree
+// with, for each node, the estimated cardinal, the number of rows actually
+// produced and the time spent in milliseconds, children included.
+//
+// misestimate is the factor between estimated and actual cardinals, 1 meaning
+// the estimate was exact.
+func (t *Transaction) Analyze(schema string, selectors []Selector, p Predicate, joiners []Joiner, sorters []Sorter, aliases ...Alias) ([]string, []*Tuple, error) {
+	if err := t.aborted(); err != nil {
+		return nil, nil, err
+	}
+
+	n, err := t.Plan(schema, selectors, p, joiners, sorters, aliases...)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	an := recAnalyzeNode(n)
+	_, _, err = an.Exec()
+	if err != nil {
+		return nil, nil, t.abort(err)
+	}
+
+	var res []*Tuple
+	for _, pn := range planNodes(an, 0, nil) {
+		if pn.Executed {
+			ms := float64(pn.Time.Microseconds()) / 1000
+			res = append(res, NewTuple(int64(pn.Depth), pn.Node, pn.Estimated, pn.Actual, ms, misestimate(pn.Estimated, pn.Actual)))
+		} else {
+			// node was not executed
+			res = append(res, NewTuple(int64(pn.Depth), pn.Node, pn.Estimated, nil, nil, nil))
+		}
+	}
+
+	cols := []string{"depth", "node", "estimated_cardinal", "actual_cardinal", "actual_time_ms", "misestimate"}
+	return cols, res, nil
+}
+
+func misestimate(estimated, actual int64) float64 {
+	e, a := float64(estimated), float64(actual)
+	if e < 1 {
+		e = 1
+	}
+	if a < 1 {
+		a = 1
+	}
+	if e > a {
+		return e / a
+	}
+	return a / e
+}
+
+func recExplain(n Node, depth int64, res []*Tuple) []*Tuple {
+	res = append(res, NewTuple(depth, fmt.Sprintf("%s", n), n.EstimateCardinal()))
+	for _, child := range n.Children() {
+		res = recExplain(child, depth+1, res)
+	}
+	return res
+}
+
 func recAppendPredicates(rname string, sc Scanner, p Predicate) {
 	if p.Relation() == rname {
 		sc.Append(p)
@@ -518,12 +1557,30 @@ func recAppendPredicates(rname string, sc Scanner, p Predicate) {
 	}
 }
 
-func (t *Transaction) Plan(schema string, selectors []Selector, p Predicate, joiners []Joiner, sorters []Sorter) (Node, error) {
+// Alias is a name referencing a relation in a query
+type Alias struct {
+	name     string
+	relation string
+}
+
+func NewAlias(name, relation string) Alias {
+	return Alias{name: name, relation: relation}
+}
+
+func (a Alias) Name() string {
+	return a.name
+}
+
+func (a Alias) Relation() string {
+	return a.relation
+}
+
+func (t *Transaction) Plan(schema string, selectors []Selector, p Predicate, joiners []Joiner, sorters []Sorter, aliases ...Alias) (Node, error) {
 	if err := t.aborted(); err != nil {
 		return nil, err
 	}
 
-	s, err := t.e.schema(schema)
+	s, err := t.schema(schema)
 	if err != nil {
 		return nil, t.abort(err)
 	}
@@ -532,56 +1589,98 @@ func (t *Transaction) Plan(schema string, selectors []Selector, p Predicate, joi
 		return nil, t.abort(errors.New("query requires 1 predicate"))
 	}
 
-	aliases := make(map[string]string)
+	names := make(map[string]string)
+	for _, a := range aliases {
+		names[a.name] = a.relation
+	}
 
 	// (1)
+	// relations are keyed by the name referencing them in query. A relation
+	// referenced several times is locked once.
 	relations := make(map[string]*Relation)
-	err = t.recLock(schema, relations, p)
+	err = t.recLock(s, names, relations, p)
 	if err != nil {
 		return nil, t.abort(err)
 	}
 	for _, sel := range selectors {
-		rel := sel.Relation()
-		r, err := s.Relation(rel)
+		ref := sel.Alias()
+		if ref == "" {
+			ref = sel.Relation()
+		}
+		// computed on the single row of a query without relation
+		if ref == "" {
+			continue
+		}
+		r, err := t.relation(s, relationName(sel.Relation(), names))
 		if err != nil {
 			return nil, t.abort(err)
 		}
-		if a := sel.Alias(); a != "" {
-			aliases[rel] = a
+		if err := t.lock(r); err != nil {
+			return nil, t.abort(err)
+		}
+		relations[ref] = r
+	}
+	// joined relations may have no selected attribute nor predicate
+	for _, j := range joiners {
+		for _, ref := range []string{j.Left(), j.Right()} {
+			if _, ok := relations[ref]; ok {
+				continue
+			}
+			r, err := t.relation(s, relationName(ref, names))
+			if err != nil {
+				continue
+			}
+			if err := t.lock(r); err != nil {
+				return nil, t.abort(err)
+			}
+			relations[ref] = r
 		}
-		t.lock(r)
-		relations[rel] = r
 	}
 
 	// (2)
 	sources := make(map[string]Source)
-	var sourceCost int64
-	for _, r := range relations {
+	for ref, r := range relations {
+		if t.stableOrder {
+			sources[ref] = NewSeqScan(r, ref)
+			continue
+		}
+		var sourceCost int64
 		for _, index := range r.indexes {
-			cost, ok, p := recCanUseIndex(r.name, index, p)
+			cost, ok, ip := recCanUseIndex(ref, index, p, r.stats)
 			if ok && (sourceCost == 0 || cost < sourceCost) {
 				log.Debug("choosing %s as source for relation %s", index, r)
-				newsrc, err := NewHashIndexSource(index, getAlias(r.name, aliases), p)
+				var newsrc Source
+				switch index.(type) {
+				case *BTreeIndex:
+					newsrc, err = NewBTreeIndexSource(index, ref, p, ASC)
+				default:
+					newsrc, err = NewHashIndexSource(index, ref, ip)
+				}
 				if err != nil {
 					continue
 				}
-				sources[r.name] = newsrc
+				sources[ref] = newsrc
 				sourceCost = cost
 			}
 		}
-		if _, ok := sources[r.name]; !ok {
+		if _, ok := sources[ref]; !ok {
 			log.Debug("could not find suitable index for relation %s, using seq scan", r)
-			sources[r.name] = NewSeqScan(r, getAlias(r.name, aliases))
+			sources[ref] = NewSeqScan(r, ref)
+		}
+		if len(relations) == 1 && len(joiners) == 0 {
+			sources[ref] = useOrderedIndex(r, ref, p, sorters, sources[ref])
 		}
 	}
 
 	// (3)
 	// build nodes for each relations
 	scanners := make(map[string]Scanner)
-	for _, r := range relations {
-		sc := NewRelationScanner(sources[r.name], nil)
-		recAppendPredicates(r.name, sc, p)
-		scanners[r.name] = sc
+	for ref := range relations {
+		sc := NewRelationScanner(sources[ref], nil)
+		sc.ctx = t.ctx
+		sc.stats = relations[ref].stats
+		recAppendPredicates(ref, sc, p)
+		scanners[ref] = sc
 	}
 	// assign scanner nodes to joiner nodes
 	for _, j := range joiners {
@@ -596,8 +1695,15 @@ func (t *Transaction) Plan(schema string, selectors []Selector, p Predicate, joi
 		}
 		j.SetRight(sc)
 	}
-	// sort joins by estimated cardinal
-	sort.Sort(Joiners(joiners))
+	for _, j := range joiners {
+		if nj, ok := j.(*NaturalJoin); ok {
+			nj.ctx = t.ctx
+		}
+	}
+	// sort joins by estimated cardinal, unless joins must follow query order
+	if !t.stableOrder {
+		sort.Sort(Joiners(joiners))
+	}
 	// now we need to build tree by replacing gradually already joined relation in bigger join
 	seen := make(map[string]Node)
 	for _, n := range joiners {
@@ -614,6 +1720,12 @@ func (t *Transaction) Plan(schema string, selectors []Selector, p Predicate, joi
 			n.SetRight(child)
 		}
 	}
+	// join along indexed attributes by looking rows up
+	for _, j := range joiners {
+		if nj, ok := j.(*NaturalJoin); ok && !t.stableOrder {
+			nj.useIndex(relations)
+		}
+	}
 	var headJoin Node
 	if len(joiners) > 0 {
 		headJoin = joiners[len(joiners)-1]
@@ -622,17 +1734,21 @@ func (t *Transaction) Plan(schema string, selectors []Selector, p Predicate, joi
 		for _, v := range scanners {
 			headJoin = v
 		}
+	} else if len(scanners) == 0 {
+		headJoin = NewResultNode()
 	} else {
 		return nil, t.abort(fmt.Errorf("no join, but got %d scan", len(scanners)))
 	}
 
 	// append selectors
 	n := NewSelectorNode(selectors, headJoin)
+	n.workers = t.workers
 
 	// append sorters
 	// GroupBy must contains both selector node and last join to compute arithmetic on all groups
 	if len(sorters) > 0 {
 		sort.Sort(Sorters(sorters))
+		t.stabilize(sorters)
 		var src Node
 		for i, s := range sorters {
 			if i == 0 {
@@ -655,30 +1771,27 @@ func (t *Transaction) Plan(schema string, selectors []Selector, p Predicate, joi
 	return n, nil
 }
 
-func (t *Transaction) recLock(schema string, relations map[string]*Relation, p Predicate) error {
-
-	s, err := t.e.schema(schema)
-	if err != nil {
-		return err
-	}
-	if rel := p.Relation(); rel != "" {
-		r, err := s.Relation(rel)
+func (t *Transaction) recLock(s *Schema, names map[string]string, relations map[string]*Relation, p Predicate) error {
+	if ref := p.Relation(); ref != "" {
+		r, err := t.relation(s, relationName(ref, names))
 		if err != nil {
 			return err
 		}
 
-		relations[p.Relation()] = r
-		t.lock(r)
+		relations[ref] = r
+		if err := t.lock(r); err != nil {
+			return err
+		}
 	}
 
 	if lp, ok := p.Left(); ok {
-		err = t.recLock(schema, relations, lp)
+		err := t.recLock(s, names, relations, lp)
 		if err != nil {
 			return err
 		}
 	}
 	if rp, ok := p.Right(); ok {
-		err = t.recLock(schema, relations, rp)
+		err := t.recLock(s, names, relations, rp)
 		if err != nil {
 			return err
 		}
@@ -687,37 +1800,204 @@ func (t *Transaction) recLock(schema string, relations map[string]*Relation, p P
 	return nil
 }
 
-func recCanUseIndex(relName string, index Index, p Predicate) (int64, bool, Predicate) {
-	if ok, cost := index.CanSourceWith(p); ok {
-		return cost, ok, p
+// relationName returns the name of the relation referenced by ref in a query
+func relationName(ref string, names map[string]string) string {
+	if name, ok := names[ref]; ok {
+		return name
 	}
+	return ref
+}
 
-	if lp, ok := p.Left(); ok {
-		cost, ok, cp := recCanUseIndex(relName, index, lp)
-		if ok {
-			return cost, ok, cp
+// recCanUseIndex looks for the cheapest predicate index can source. Only
+// predicates combined with AND are considered, since index would miss rows
+// matching the other side of an OR. Cost is refined by relation statistics, if any.
+func recCanUseIndex(relName string, index Index, p Predicate, stats *Stats) (int64, bool, Predicate) {
+	// Hash index on several attributes is probed with equalities on all of
+	// them, wherever they are in p
+	if h, ok := index.(*HashIndex); ok && len(h.attrs) > 1 {
+		cp, ok := h.cover(conjuncts(relName, p))
+		if !ok {
+			return 0, false, nil
+		}
+		ok, cost := h.CanSourceWith(cp)
+		return stats.cost(cost, cp), ok, cp
+	}
+
+	if p.Relation() == relName {
+		if ok, cost := index.CanSourceWith(p); ok {
+			return stats.cost(cost, p), ok, p
 		}
 	}
 
+	if p.Type() != And {
+		return 0, false, nil
+	}
+
+	var cost int64
+	var found bool
+	var ip Predicate
+	if lp, ok := p.Left(); ok {
+		cost, found, ip = recCanUseIndex(relName, index, lp, stats)
+	}
+
 	if rp, ok := p.Right(); ok {
-		cost, ok, cp := recCanUseIndex(relName, index, rp)
-		if ok {
-			return cost, ok, cp
+		c, ok, cp := recCanUseIndex(relName, index, rp, stats)
+		if ok && (!found || c < cost) {
+			return c, ok, cp
+		}
+	}
+
+	return cost, found, ip
+}
+
+// conjuncts returns predicates on relation relName combined with AND in p
+func conjuncts(relName string, p Predicate) []Predicate {
+	if p.Type() == And {
+		lp, _ := p.Left()
+		rp, _ := p.Right()
+		return append(conjuncts(relName, lp), conjuncts(relName, rp)...)
+	}
+	if p.Relation() == relName {
+		return []Predicate{p}
+	}
+	return nil
+}
+
+// useOrderedIndex replaces src with a BTreeIndex scan when the query is sorted
+// on index first attribute only, so the OrderBySorter does not have to sort rows.
+func useOrderedIndex(r *Relation, alias string, p Predicate, sorters []Sorter, src Source) Source {
+	var order *OrderBySorter
+	for _, s := range sorters {
+		switch s := s.(type) {
+		case *GroupBySorter:
+			return src
+		case *OrderBySorter:
+			order = s
+		}
+	}
+	// indexes order strings byte by byte
+	if order == nil || len(order.attrs) != 1 || order.attrs[0].collated() {
+		return src
+	}
+	if order.rel != "" && order.rel != r.name && order.rel != alias {
+		return src
+	}
+
+	for _, index := range r.indexes {
+		b, ok := index.(*BTreeIndex)
+		if !ok || !b.orders(order.attrs[0].attr) {
+			continue
+		}
+		// do not drop a more selective index source
+		if s, ok := src.(*IndexSrc); ok && s.index != index {
+			continue
+		}
+		newsrc, err := NewBTreeIndexSource(index, alias, p, order.attrs[0].direction)
+		if err != nil {
+			continue
 		}
+		log.Debug("choosing %s as ordered source for relation %s", index, r)
+		order.sorted = true
+		return newsrc
 	}
 
-	return 0, false, nil
+	return src
 }
 
 // Lock relations if not already done
-func (t *Transaction) lock(r *Relation) {
-	_, done := t.locks[r.name]
+func (t *Transaction) lock(r *Relation) error {
+	// information_schema and materialized relations are built for the transaction only
+	if r.schema == InformationSchema || (r.schema == "" && t.derived[r.name] == r) {
+		return nil
+	}
+
+	// relations of different schemas may share a name
+	key := r.String()
+	_, done := t.locks[key]
 	if done {
+		return nil
+	}
+
+	if err := t.acquire(r); err != nil {
+		return err
+	}
+	t.locks[key] = r
+	return nil
+}
+
+// SetStrictTypes sets whether values inserted or updated must convert to
+// attribute type without loss nor change of domain. Otherwise any Go
+// conversion applies, as float truncated to integer.
+func (t *Transaction) SetStrictTypes(on bool) {
+	t.strictTypes = on
+}
+
+// SetStableOrder sets whether queries return rows in an order independent of
+// indexes and statistics: relations are scanned in insertion order and
+// joined in query order, the rows of the first relation leading, and rows
+// ordered by equal values keep that order. Queries then use no index.
+func (t *Transaction) SetStableOrder(on bool) {
+	t.stableOrder = on
+}
+
+// stabilize sets OrderBy sorters to keep the order of equal rows, if stable
+// order is set
+func (t *Transaction) stabilize(sorters []Sorter) {
+	if !t.stableOrder {
 		return
 	}
+	for _, s := range sorters {
+		if o, ok := s.(*OrderBySorter); ok {
+			o.stable = true
+		}
+	}
+}
+
+// SetLockTimeout sets how long following statements wait for a relation
+// locked by another transaction before failing with ErrLockTimeout. 0 waits
+// indefinitely.
+func (t *Transaction) SetLockTimeout(d time.Duration) {
+	t.lockTimeout = d
+}
+
+// acquire locks relation r, waiting at most lock timeout and until statement
+// context is done. A mutex cannot be waited on with a timer, so lock is tried
+// with an increasing interval.
+func (t *Transaction) acquire(r *Relation) error {
+	// statement context may be done while waiting
+	done := t.ctx.Done()
+	if t.lockTimeout <= 0 && done == nil {
+		r.Lock()
+		return nil
+	}
+	if r.TryLock() {
+		return nil
+	}
 
-	r.Lock()
-	t.locks[r.name] = r
+	var timeout <-chan time.Time
+	if t.lockTimeout > 0 {
+		timer := time.NewTimer(t.lockTimeout)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+	wait := 50 * time.Microsecond
+	for {
+		select {
+		case <-timeout:
+			e := NewError(LockNotAvailable, "%s on relation %s", ErrLockTimeout, r.name).On(r.name, "")
+			e.err = ErrLockTimeout
+			return e
+		case <-done:
+			return ctxErr(t.ctx)
+		case <-time.After(wait):
+		}
+		if r.TryLock() {
+			return nil
+		}
+		if wait < 5*time.Millisecond {
+			wait *= 2
+		}
+	}
 }
 
 // Unlock all touched relations
@@ -730,18 +2010,36 @@ func (t *Transaction) unlock() {
 
 func (t *Transaction) aborted() error {
 	if t.err != nil {
-		return fmt.Errorf("transaction aborted due to previous error: %w", t.err)
+		e := NewError(InFailedTransaction, "transaction aborted due to previous error: %s", t.err)
+		e.err = t.err
+		return e
 	}
 	return nil
 }
 
+// Abort reverts changes and returns err, as for an error returned by the
+// transaction: the transaction is aborted, unless statement level rollback
+// is set, in which case only changes of current statement are reverted.
+func (t *Transaction) Abort(err error) error {
+	if t.err != nil {
+		return err
+	}
+	return t.abort(err)
+}
+
 func (t *Transaction) abort(err error) error {
+	if t.statementRollback && t.started {
+		t.RollbackStatement()
+		return err
+	}
+
 	t.Rollback()
 	t.err = err
 	return err
 }
 
-// PrintQueryPlan
+// PrintQueryPlan writes the plan tree rooted at n with printer, one line per node.
+// Printer defaults to log.Debug when nil.
 func PrintQueryPlan(n Node, depth int, printer func(fmt string, varargs ...any)) {
 
 	if printer == nil {
@@ -758,11 +2056,3 @@ func PrintQueryPlan(n Node, depth int, printer func(fmt string, varargs ...any))
 		PrintQueryPlan(child, depth+1, printer)
 	}
 }
-
-func getAlias(name string, alias map[string]string) string {
-	a, ok := alias[name]
-	if ok {
-		return a
-	}
-	return ""
-}
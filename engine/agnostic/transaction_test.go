@@ -1,7 +1,15 @@
 package agnostic
 
 import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"math"
+	"path/filepath"
 	"reflect"
+	"strings"
 	"testing"
 	"time"
 
@@ -110,7 +118,7 @@ func TestDropRelation(t *testing.T) {
 		t.Fatalf("cannot create relation: %s", err)
 	}
 
-	err = tx.DropRelation("", "myrel")
+	err = tx.DropRelation("", "myrel", false)
 	if err != nil {
 		t.Fatalf("cannot drop relation: %s", err)
 	}
@@ -142,7 +150,7 @@ func TestInsertTotal(t *testing.T) {
 	}
 
 	attrs := []Attribute{
-		NewAttribute("foo", "BIGINT"),
+		NewAttribute("foo", "BIGINT").WithNotNull(),
 		NewAttribute("bar", "TEXT"),
 	}
 
@@ -473,6 +481,7 @@ func TestIndexCreation(t *testing.T) {
 	}
 	defer tx.Rollback()
 
+	values["foo"] = `{"foo":"c"}`
 	_, err = tx.Insert(schema, relation, values)
 	if err == nil {
 		t.Fatalf("expected UNIQUE violation on json")
@@ -1004,7 +1013,7 @@ func TestIndex(t *testing.T) {
 		t.Fatalf("cannot create relation: %s", err)
 	}
 
-	err = tx.CreateIndex(schema, relation, "test_index", HashIndexType, []string{"age"})
+	err = tx.CreateIndex(schema, relation, "test_index", HashIndexType, false, []string{"age"})
 	if err != nil {
 		t.Fatalf("cannot create index: %s", err)
 	}
@@ -1015,6 +1024,292 @@ func TestIndex(t *testing.T) {
 
 }
 
+func TestIndexExistingRows(t *testing.T) {
+	e := NewEngine()
+
+	tx, err := e.Begin()
+	if err != nil {
+		t.Fatalf("cannot begin tx: %s", err)
+	}
+	defer tx.Rollback()
+
+	schema := DefaultSchema
+	relation := "user"
+	attrs := []Attribute{
+		NewAttribute("id", "BIGINT").WithAutoIncrement(),
+		NewAttribute("name", "TEXT"),
+		NewAttribute("age", "INT"),
+	}
+	err = tx.CreateRelation(schema, relation, attrs, []string{"id"})
+	if err != nil {
+		t.Fatalf("cannot create relation: %s", err)
+	}
+
+	for i := 0; i < 10; i++ {
+		_, err = tx.Insert(schema, relation, map[string]any{"name": "foo", "age": int64(i % 2)})
+		if err != nil {
+			t.Fatalf("cannot insert values: %s", err)
+		}
+	}
+
+	err = tx.CreateIndex(schema, relation, "user_age_idx", HashIndexType, false, []string{"age"})
+	if err != nil {
+		t.Fatalf("cannot create index: %s", err)
+	}
+
+	r := e.schemas[DefaultSchema].relations[relation]
+	_, index := r.index("user_age_idx")
+	if index == nil {
+		t.Fatalf("expected index user_age_idx in relation")
+	}
+	rows, err := index.(*HashIndex).GetAll([]any{int64(1)})
+	if err != nil {
+		t.Fatalf("cannot get rows from index: %s", err)
+	}
+	if len(rows) != 5 {
+		t.Fatalf("expected 5 rows with age 1 in index, got %d", len(rows))
+	}
+
+	_, res, err := tx.Query(
+		schema,
+		[]Selector{NewStarSelector(relation)},
+		NewEqPredicate(NewAttributeValueFunctor(relation, "age"), NewConstValueFunctor(int64(0))),
+		nil,
+		nil,
+	)
+	if err != nil {
+		t.Fatalf("cannot query relation: %s", err)
+	}
+	if len(res) != 5 {
+		t.Fatalf("expected 5 rows with age 0, got %d", len(res))
+	}
+
+	err = tx.CreateIndex(schema, relation, "user_name_idx", HashIndexType, true, []string{"name"})
+	if err == nil {
+		t.Fatalf("expected error creating unique index on duplicate values")
+	}
+}
+
+func TestBTreeIndex(t *testing.T) {
+	e := NewEngine()
+
+	tx, err := e.Begin()
+	if err != nil {
+		t.Fatalf("cannot begin tx: %s", err)
+	}
+	defer tx.Rollback()
+
+	schema := DefaultSchema
+	relation := "user"
+	attrs := []Attribute{
+		NewAttribute("id", "BIGINT").WithAutoIncrement(),
+		NewAttribute("age", "INT"),
+	}
+	err = tx.CreateRelation(schema, relation, attrs, []string{"id"})
+	if err != nil {
+		t.Fatalf("cannot create relation: %s", err)
+	}
+
+	for i := 0; i < 1000; i++ {
+		_, err = tx.Insert(schema, relation, map[string]any{"age": int64(i * 7 % 100)})
+		if err != nil {
+			t.Fatalf("cannot insert values: %s", err)
+		}
+	}
+
+	err = tx.CreateIndex(schema, relation, "user_age_idx", BTreeIndexType, false, []string{"age"})
+	if err != nil {
+		t.Fatalf("cannot create index: %s", err)
+	}
+
+	r := e.schemas[DefaultSchema].relations[relation]
+	_, index := r.index("user_age_idx")
+	b := index.(*BTreeIndex)
+
+	rows := b.Range(nil, nil)
+	if len(rows) != 1000 {
+		t.Fatalf("expected 1000 rows in index, got %d", len(rows))
+	}
+	for i := 1; i < len(rows); i++ {
+		if rows[i-1].Value.(*Tuple).values[1].(int64) > rows[i].Value.(*Tuple).values[1].(int64) {
+			t.Fatalf("expected rows sorted by age")
+		}
+	}
+
+	// remove every other row to exercise rebalancing
+	var n int
+	for e := r.rows.Front(); e != nil; e = e.Next() {
+		if n%2 == 0 {
+			b.Remove(e)
+		}
+		n++
+	}
+	rows = b.Range(&btreeBound{v: int64(10), inclusive: true}, &btreeBound{v: int64(20)})
+	if len(rows) != 50 {
+		t.Fatalf("expected 50 rows with age in [10,20) after removal, got %d", len(rows))
+	}
+	for e := r.rows.Front(); e != nil; e = e.Next() {
+		b.Remove(e)
+	}
+	if rows = b.Range(nil, nil); len(rows) != 0 {
+		t.Fatalf("expected empty index, got %d rows", len(rows))
+	}
+	b.Truncate()
+	for e := r.rows.Front(); e != nil; e = e.Next() {
+		b.Add(e)
+	}
+
+	p := NewAndPredicate(
+		NewGePredicate(NewAttributeValueFunctor(relation, "age"), NewConstValueFunctor(int64(5))),
+		NewLePredicate(NewAttributeValueFunctor(relation, "age"), NewConstValueFunctor(int64(10))),
+	)
+	ok, _ := b.CanSourceWith(p.left)
+	if !ok {
+		t.Fatalf("expected btree index to source range predicate")
+	}
+	_, res, err := tx.Query(schema, []Selector{NewStarSelector(relation)}, p, nil, nil)
+	if err != nil {
+		t.Fatalf("cannot query relation: %s", err)
+	}
+	if len(res) != 40 {
+		t.Fatalf("expected 40 rows with age in ]5,10[, got %d", len(res))
+	}
+
+	// hash index is preferred on equality
+	err = tx.CreateIndex(schema, relation, "user_age_hash_idx", HashIndexType, false, []string{"age"})
+	if err != nil {
+		t.Fatalf("cannot create index: %s", err)
+	}
+	eq := NewEqPredicate(NewAttributeValueFunctor(relation, "age"), NewConstValueFunctor(int64(5)))
+	_, hcost := r.indexes[len(r.indexes)-1].CanSourceWith(eq)
+	_, bcost := b.CanSourceWith(eq)
+	if hcost >= bcost {
+		t.Fatalf("expected hash index to be cheaper on equality (%d >= %d)", hcost, bcost)
+	}
+
+	// OR cannot be sourced by index
+	or := NewOrPredicate(eq, NewEqPredicate(NewAttributeValueFunctor(relation, "id"), NewConstValueFunctor(int64(1))))
+	_, res, err = tx.Query(schema, []Selector{NewStarSelector(relation)}, or, nil, nil)
+	if err != nil {
+		t.Fatalf("cannot query relation: %s", err)
+	}
+	if len(res) != 11 {
+		t.Fatalf("expected 11 rows, got %d", len(res))
+	}
+
+	_, res, err = tx.Query(
+		schema,
+		[]Selector{NewStarSelector(relation)},
+		NewTruePredicate(),
+		nil,
+		[]Sorter{NewOrderBySorter(relation, []SortExpression{NewSortExpression("age", DESC)})},
+	)
+	if err != nil {
+		t.Fatalf("cannot query relation: %s", err)
+	}
+	if len(res) != 1000 {
+		t.Fatalf("expected 1000 rows, got %d", len(res))
+	}
+	if v := res[0].values[1].(int64); v != 99 {
+		t.Fatalf("expected first row age to be 99, got %d", v)
+	}
+}
+
+func TestDropIndex(t *testing.T) {
+	e := NewEngine()
+
+	tx, err := e.Begin()
+	if err != nil {
+		t.Fatalf("cannot begin tx: %s", err)
+	}
+
+	schema := DefaultSchema
+	relation := "user"
+	attrs := []Attribute{
+		NewAttribute("id", "BIGINT").WithAutoIncrement(),
+		NewAttribute("age", "INT"),
+	}
+	err = tx.CreateRelation(schema, relation, attrs, []string{"id"})
+	if err != nil {
+		t.Fatalf("cannot create relation: %s", err)
+	}
+	err = tx.CreateIndex(schema, relation, "user_age_idx", HashIndexType, false, []string{"age"})
+	if err != nil {
+		t.Fatalf("cannot create index: %s", err)
+	}
+	_, err = tx.Commit()
+	if err != nil {
+		t.Fatalf("cannot commit: %s", err)
+	}
+
+	r := e.schemas[DefaultSchema].relations[relation]
+
+	tx, err = e.Begin()
+	if err != nil {
+		t.Fatalf("cannot begin tx: %s", err)
+	}
+	err = tx.DropIndex(schema, "user_age_idx")
+	if err != nil {
+		t.Fatalf("cannot drop index: %s", err)
+	}
+	if _, i := r.index("user_age_idx"); i != nil {
+		t.Fatalf("expected index to be dropped")
+	}
+	tx.Rollback()
+	if _, i := r.index("user_age_idx"); i == nil {
+		t.Fatalf("expected index to be restored by rollback")
+	}
+
+	tx, err = e.Begin()
+	if err != nil {
+		t.Fatalf("cannot begin tx: %s", err)
+	}
+	err = tx.DropIndex(schema, "pk_public_user")
+	if err == nil {
+		t.Fatalf("expected error dropping primary key index")
+	}
+}
+
+func TestUniqueIndex(t *testing.T) {
+	e := NewEngine()
+
+	tx, err := e.Begin()
+	if err != nil {
+		t.Fatalf("cannot begin tx: %s", err)
+	}
+
+	schema := DefaultSchema
+	relation := "user"
+	attrs := []Attribute{
+		NewAttribute("id", "BIGINT").WithAutoIncrement(),
+		NewAttribute("email", "TEXT"),
+	}
+	err = tx.CreateRelation(schema, relation, attrs, []string{"id"})
+	if err != nil {
+		t.Fatalf("cannot create relation: %s", err)
+	}
+	_, err = tx.Insert(schema, relation, map[string]any{"email": "foo@bar.com"})
+	if err != nil {
+		t.Fatalf("cannot insert values: %s", err)
+	}
+	err = tx.CreateIndex(schema, relation, "user_email_idx", HashIndexType, true, []string{"email"})
+	if err != nil {
+		t.Fatalf("cannot create index: %s", err)
+	}
+	_, err = tx.Insert(schema, relation, map[string]any{"email": nil})
+	if err != nil {
+		t.Fatalf("cannot insert NULL into unique index: %s", err)
+	}
+	_, err = tx.Insert(schema, relation, map[string]any{"email": nil})
+	if err != nil {
+		t.Fatalf("cannot insert second NULL into unique index: %s", err)
+	}
+	_, err = tx.Insert(schema, relation, map[string]any{"email": "foo@bar.com"})
+	if err == nil {
+		t.Fatalf("expected unicity violation")
+	}
+}
+
 func TestUpdate(t *testing.T) {
 	e := NewEngine()
 	log.SetLevel(log.WarningLevel)
@@ -1099,6 +1394,112 @@ func TestUpdate(t *testing.T) {
 
 }
 
+func TestUpdateRollback(t *testing.T) {
+	e := NewEngine()
+
+	tx, err := e.Begin()
+	if err != nil {
+		t.Fatalf("cannot begin tx: %s", err)
+	}
+
+	schema := DefaultSchema
+	relation := "task"
+	attrs := []Attribute{
+		NewAttribute("id", "BIGINT").WithAutoIncrement(),
+		NewAttribute("val", "INT"),
+		NewAttribute("name", "TEXT").WithUnique(),
+	}
+	err = tx.CreateRelation(schema, relation, attrs, []string{"id"})
+	if err != nil {
+		t.Fatalf("cannot create relation: %s", err)
+	}
+	for i := 0; i < 10; i++ {
+		_, err = tx.Insert(schema, relation, map[string]any{"val": int64(i % 2), "name": fmt.Sprintf("task %d", i)})
+		if err != nil {
+			t.Fatalf("cannot insert values: %s", err)
+		}
+	}
+	err = tx.CreateIndex(schema, relation, "task_val_idx", HashIndexType, false, []string{"val"})
+	if err != nil {
+		t.Fatalf("cannot create index: %s", err)
+	}
+	_, err = tx.Commit()
+	if err != nil {
+		t.Fatalf("cannot commit: %s", err)
+	}
+
+	count := func(tx *Transaction, p Predicate) int {
+		_, res, err := tx.Query(schema, []Selector{NewStarSelector(relation)}, p, nil, nil)
+		if err != nil {
+			t.Fatalf("cannot query relation: %s", err)
+		}
+		return len(res)
+	}
+	valEq := func(v int64) Predicate {
+		return NewEqPredicate(NewAttributeValueFunctor(relation, "val"), NewConstValueFunctor(v))
+	}
+
+	tx, err = e.Begin()
+	if err != nil {
+		t.Fatalf("cannot begin tx: %s", err)
+	}
+	_, res, err := tx.Update(schema, relation, map[string]any{"val": int64(2)}, nil, valEq(1))
+	if err != nil {
+		t.Fatalf("cannot update: %s", err)
+	}
+	if len(res) != 5 {
+		t.Fatalf("expected 5 rows updated, got %d", len(res))
+	}
+	if n := count(tx, valEq(2)); n != 5 {
+		t.Fatalf("expected 5 rows with val 2 from index, got %d", n)
+	}
+	if n := count(tx, valEq(1)); n != 0 {
+		t.Fatalf("expected no row with val 1 from index, got %d", n)
+	}
+	tx.Rollback()
+
+	tx, err = e.Begin()
+	if err != nil {
+		t.Fatalf("cannot begin tx: %s", err)
+	}
+	defer tx.Rollback()
+	if n := count(tx, valEq(1)); n != 5 {
+		t.Fatalf("expected 5 rows with val 1 after rollback, got %d", n)
+	}
+	if n := count(tx, valEq(2)); n != 0 {
+		t.Fatalf("expected no row with val 2 after rollback, got %d", n)
+	}
+
+	// unique collision is rejected and statement is reverted
+	_, _, err = tx.Update(schema, relation, map[string]any{"name": "same"}, nil, valEq(0))
+	if err == nil {
+		t.Fatalf("expected unique violation updating 5 rows to the same name")
+	}
+
+	tx, err = e.Begin()
+	if err != nil {
+		t.Fatalf("cannot begin tx: %s", err)
+	}
+	defer tx.Rollback()
+	_, _, err = tx.Update(schema, relation, map[string]any{"id": int64(1)}, nil, NewEqPredicate(NewAttributeValueFunctor(relation, "id"), NewConstValueFunctor(int64(2))))
+	if err == nil {
+		t.Fatalf("expected primary key violation")
+	}
+
+	tx, err = e.Begin()
+	if err != nil {
+		t.Fatalf("cannot begin tx: %s", err)
+	}
+	defer tx.Rollback()
+	_, res, err = tx.Query(schema, []Selector{NewStarSelector(relation)}, NewEqPredicate(NewAttributeValueFunctor(relation, "name"), NewConstValueFunctor("task 0")), nil, nil)
+	if err != nil {
+		t.Fatalf("cannot query relation: %s", err)
+	}
+	if len(res) != 1 {
+		t.Fatalf("expected name to be restored after failed update, got %d rows", len(res))
+	}
+}
+
 // CREATE TABLE foo (id BIGSERIAL, bar_id INT, toto_id INT)
 // INSERT INTO foo (bar_id, toto_id) VALUES (2, 3)
 // INSERT INTO foo (bar_id, toto_id) VALUES (4, 32)
@@ -1222,7 +1623,155 @@ func TestDelete(t *testing.T) {
 
 }
 
-func TestAlias(t *testing.T) {
+func TestDeleteRollback(t *testing.T) {
+	e := NewEngine()
+
+	tx, err := e.Begin()
+	if err != nil {
+		t.Fatalf("cannot begin tx: %s", err)
+	}
+
+	schema := DefaultSchema
+	relation := "foo"
+	attrs := []Attribute{
+		NewAttribute("id", "BIGINT").WithAutoIncrement(),
+		NewAttribute("bar_id", "INT"),
+	}
+	err = tx.CreateRelation(schema, relation, attrs, []string{"id"})
+	if err != nil {
+		t.Fatalf("cannot create relation: %s", err)
+	}
+	for i := 0; i < 10; i++ {
+		_, err = tx.Insert(schema, relation, map[string]any{"bar_id": int64(i % 3)})
+		if err != nil {
+			t.Fatalf("cannot insert values: %s", err)
+		}
+	}
+	_, err = tx.Commit()
+	if err != nil {
+		t.Fatalf("cannot commit: %s", err)
+	}
+
+	ids := func() []int64 {
+		tx, err := e.Begin()
+		if err != nil {
+			t.Fatalf("cannot begin tx: %s", err)
+		}
+		defer tx.Rollback()
+		_, res, err := tx.Query(schema, []Selector{NewAttributeSelector(relation, []string{"id"})}, NewTruePredicate(), nil, nil)
+		if err != nil {
+			t.Fatalf("cannot query: %s", err)
+		}
+		var ids []int64
+		for _, r := range res {
+			ids = append(ids, r.values[0].(int64))
+		}
+		return ids
+	}
+	before := ids()
+
+	tx, err = e.Begin()
+	if err != nil {
+		t.Fatalf("cannot begin tx: %s", err)
+	}
+	// update then delete the same rows, and delete the first row
+	_, _, err = tx.Update(schema, relation, map[string]any{"bar_id": int64(42)}, nil, NewEqPredicate(NewAttributeValueFunctor(relation, "bar_id"), NewConstValueFunctor(int64(1))))
+	if err != nil {
+		t.Fatalf("cannot update: %s", err)
+	}
+	_, res, err := tx.Delete(schema, relation, nil, NewEqPredicate(NewAttributeValueFunctor(relation, "bar_id"), NewConstValueFunctor(int64(42))))
+	if err != nil {
+		t.Fatalf("cannot delete: %s", err)
+	}
+	if len(res) != 3 {
+		t.Fatalf("expected 3 rows deleted, got %d", len(res))
+	}
+	_, res, err = tx.Delete(schema, relation, nil, NewTruePredicate())
+	if err != nil {
+		t.Fatalf("cannot delete: %s", err)
+	}
+	if len(res) != 7 {
+		t.Fatalf("expected 7 rows deleted, got %d", len(res))
+	}
+	tx.Rollback()
+
+	after := ids()
+	if !reflect.DeepEqual(before, after) {
+		t.Fatalf("expected rows %v after rollback, got %v", before, after)
+	}
+
+	tx, err = e.Begin()
+	if err != nil {
+		t.Fatalf("cannot begin tx: %s", err)
+	}
+	defer tx.Rollback()
+	_, res, err = tx.Query(schema, []Selector{NewStarSelector(relation)}, NewEqPredicate(NewAttributeValueFunctor(relation, "id"), NewConstValueFunctor(int64(2))), nil, nil)
+	if err != nil {
+		t.Fatalf("cannot query: %s", err)
+	}
+	if len(res) != 1 || res[0].values[1].(int64) != 1 {
+		t.Fatalf("expected row 2 to be restored through primary key index with bar_id 1, got %v", res)
+	}
+}
+
+func TestQueryContext(t *testing.T) {
+	e := NewEngine()
+
+	tx, err := e.Begin()
+	if err != nil {
+		t.Fatalf("cannot begin tx: %s", err)
+	}
+
+	schema := DefaultSchema
+	relation := "foo"
+	attrs := []Attribute{
+		NewAttribute("id", "BIGINT").WithAutoIncrement(),
+		NewAttribute("bar_id", "INT"),
+	}
+	err = tx.CreateRelation(schema, relation, attrs, []string{"id"})
+	if err != nil {
+		t.Fatalf("cannot create relation: %s", err)
+	}
+	for i := 0; i < 10; i++ {
+		_, err = tx.Insert(schema, relation, map[string]any{"bar_id": int64(i)})
+		if err != nil {
+			t.Fatalf("cannot insert values: %s", err)
+		}
+	}
+	_, err = tx.Commit()
+	if err != nil {
+		t.Fatalf("cannot commit: %s", err)
+	}
+
+	tx, err = e.Begin()
+	if err != nil {
+		t.Fatalf("cannot begin tx: %s", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	tx.SetContext(ctx)
+
+	_, _, err = tx.Query(schema, []Selector{NewStarSelector(relation)}, NewTruePredicate(), nil, nil)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+
+	// relation lock is released by abort
+	tx, err = e.Begin()
+	if err != nil {
+		t.Fatalf("cannot begin tx: %s", err)
+	}
+	defer tx.Rollback()
+	_, res, err := tx.Query(schema, []Selector{NewStarSelector(relation)}, NewTruePredicate(), nil, nil)
+	if err != nil {
+		t.Fatalf("cannot query: %s", err)
+	}
+	if len(res) != 10 {
+		t.Fatalf("expected 10 rows, got %d", len(res))
+	}
+}
+
+func TestAlias(t *testing.T) {
 	e := NewEngine()
 
 	tx, err := e.Begin()
@@ -1289,3 +1838,1277 @@ func TestAlias(t *testing.T) {
 	}
 
 }
+
+func TestPrintQueryPlan(t *testing.T) {
+	e := NewEngine()
+
+	tx, err := e.Begin()
+	if err != nil {
+		t.Fatalf("cannot begin tx: %s", err)
+	}
+	defer tx.Rollback()
+
+	err = tx.CreateRelation(DefaultSchema, "user", []Attribute{NewAttribute("id", "BIGINT")}, []string{"id"})
+	if err != nil {
+		t.Fatalf("cannot create relation: %s", err)
+	}
+
+	n, err := tx.Plan(DefaultSchema, []Selector{NewStarSelector("user")}, NewTruePredicate(), nil, nil)
+	if err != nil {
+		t.Fatalf("cannot plan query: %s", err)
+	}
+
+	var lines []string
+	PrintQueryPlan(n, 0, func(format string, varargs ...any) {
+		lines = append(lines, fmt.Sprintf(format, varargs...))
+	})
+	if len(lines) != 2 {
+		t.Fatalf("expected 2 lines printed, got %d: %v", len(lines), lines)
+	}
+	if !strings.HasPrefix(lines[0], "|-> Select") || !strings.HasPrefix(lines[1], "    |-> scan") {
+		t.Fatalf("unexpected plan output: %v", lines)
+	}
+}
+
+func TestSelfJoin(t *testing.T) {
+	e := NewEngine()
+
+	tx, err := e.Begin()
+	if err != nil {
+		t.Fatalf("cannot begin tx: %s", err)
+	}
+	defer tx.Rollback()
+
+	attrs := []Attribute{
+		NewAttribute("id", "BIGINT"),
+		NewAttribute("name", "TEXT"),
+		NewAttribute("manager_id", "BIGINT"),
+	}
+	err = tx.CreateRelation(DefaultSchema, "employee", attrs, []string{"id"})
+	if err != nil {
+		t.Fatalf("cannot create relation: %s", err)
+	}
+
+	rows := [][]any{{int64(1), "boss", nil}, {int64(2), "mid", int64(1)}, {int64(3), "low", int64(2)}}
+	for _, row := range rows {
+		values := map[string]any{"id": row[0], "name": row[1], "manager_id": row[2]}
+		_, err = tx.Insert(DefaultSchema, "employee", values)
+		if err != nil {
+			t.Fatalf("cannot insert values: %s", err)
+		}
+	}
+
+	cols, res, err := tx.Query(
+		DefaultSchema,
+		[]Selector{
+			NewAttributeSelector("employee", []string{"name"}, WithAlias("e")),
+			NewAttributeSelector("employee", []string{"name"}, WithAlias("m")),
+		},
+		NewEqPredicate(NewAttributeValueFunctor("m", "id"), NewConstValueFunctor(int64(2))),
+		[]Joiner{NewNaturalJoin("e", "manager_id", "m", "id")},
+		nil,
+		NewAlias("e", "employee"),
+		NewAlias("m", "employee"),
+	)
+	if err != nil {
+		t.Fatalf("cannot query: %s", err)
+	}
+	if len(cols) != 2 || cols[0] != "e.name" || cols[1] != "m.name" {
+		t.Fatalf("unexpected columns: %v", cols)
+	}
+	if len(res) != 1 {
+		t.Fatalf("expected 1 row, got %d", len(res))
+	}
+	if v := res[0].Values(); v[0] != "low" || v[1] != "mid" {
+		t.Fatalf("unexpected row: %v", v)
+	}
+
+	if len(tx.locks) != 1 {
+		t.Fatalf("expected relation to be locked once, got %d locks", len(tx.locks))
+	}
+}
+
+func TestWindowNode(t *testing.T) {
+	e := NewEngine()
+
+	tx, err := e.Begin()
+	if err != nil {
+		t.Fatalf("cannot begin tx: %s", err)
+	}
+	defer tx.Rollback()
+
+	attrs := []Attribute{
+		NewAttribute("id", "BIGINT"),
+		NewAttribute("user_id", "BIGINT"),
+	}
+	err = tx.CreateRelation(DefaultSchema, "champion", attrs, []string{"id"})
+	if err != nil {
+		t.Fatalf("cannot create relation: %s", err)
+	}
+
+	rows := [][]any{{int64(1), int64(1)}, {int64(2), int64(2)}, {int64(3), int64(1)}}
+	for _, row := range rows {
+		_, err = tx.Insert(DefaultSchema, "champion", map[string]any{"id": row[0], "user_id": row[1]})
+		if err != nil {
+			t.Fatalf("cannot insert values: %s", err)
+		}
+	}
+
+	w := NewWindow(
+		"rn",
+		NewRowNumberFunction(),
+		[]WindowKey{NewWindowKey("champion", "user_id", ASC)},
+		[]WindowKey{NewWindowKey("champion", "id", DESC)},
+	)
+	cols, res, err := tx.Query(
+		DefaultSchema,
+		[]Selector{
+			NewAttributeSelector("champion", []string{"id"}),
+			NewAttributeSelector("champion", []string{"rn"}),
+		},
+		NewTruePredicate(),
+		nil,
+		[]Sorter{NewOrderBySorter("champion", []SortExpression{NewSortExpression("id", ASC)}), NewWindowNode(w)},
+	)
+	if err != nil {
+		t.Fatalf("cannot query: %s", err)
+	}
+	if len(cols) != 2 || cols[1] != "rn" {
+		t.Fatalf("unexpected columns: %v", cols)
+	}
+
+	expected := []int64{2, 1, 1}
+	if len(res) != len(expected) {
+		t.Fatalf("expected %d rows, got %d", len(expected), len(res))
+	}
+	for i, r := range res {
+		if v := r.Values()[1]; v != expected[i] {
+			t.Fatalf("expected row number %d for row %d, got %v", expected[i], i, v)
+		}
+	}
+}
+
+func TestParallelAggregate(t *testing.T) {
+	e := NewEngine()
+
+	tx, err := e.Begin()
+	if err != nil {
+		t.Fatalf("cannot begin tx: %s", err)
+	}
+	defer tx.Rollback()
+
+	attrs := []Attribute{
+		NewAttribute("id", "BIGINT"),
+		NewAttribute("score", "BIGINT"),
+	}
+	err = tx.CreateRelation(DefaultSchema, "game", attrs, nil)
+	if err != nil {
+		t.Fatalf("cannot create relation: %s", err)
+	}
+
+	n := parallelAggregateRows * 2
+	for i := 0; i < n; i++ {
+		var score any
+		if i%10 != 0 {
+			score = int64(i % 1000)
+		}
+		_, err = tx.Insert(DefaultSchema, "game", map[string]any{"id": int64(i), "score": score})
+		if err != nil {
+			t.Fatalf("cannot insert values: %s", err)
+		}
+	}
+
+	query := func() []any {
+		_, res, err := tx.Query(
+			DefaultSchema,
+			[]Selector{
+				NewCountSelector("game", "*"),
+				NewCountSelector("game", "score"),
+				NewSumSelector("game", "score"),
+				NewAvgSelector("game", "score"),
+				NewMinSelector("game", "score"),
+				NewMaxSelector("game", "score"),
+			},
+			NewTruePredicate(),
+			nil,
+			nil,
+		)
+		if err != nil {
+			t.Fatalf("cannot query: %s", err)
+		}
+		if len(res) != 1 {
+			t.Fatalf("expected 1 row, got %d", len(res))
+		}
+		return res[0].Values()
+	}
+
+	parallel := query()
+	tx.SetParallelWorkers(1)
+	sequential := query()
+	if !reflect.DeepEqual(parallel, sequential) {
+		t.Fatalf("parallel and sequential aggregates differ: %v, %v", parallel, sequential)
+	}
+	if parallel[0] != int64(n) || parallel[1] != int64(n-n/10) || parallel[4] != int64(1) || parallel[5] != int64(999) {
+		t.Fatalf("unexpected aggregates: %v", parallel)
+	}
+}
+
+func BenchmarkTransactionInsert(b *testing.B) {
+	e := NewEngine()
+
+	tx, err := e.Begin()
+	if err != nil {
+		b.Fatalf("cannot begin tx: %s", err)
+	}
+	defer tx.Rollback()
+
+	attrs := []Attribute{
+		NewAttribute("id", "BIGINT"),
+		NewAttribute("email", "TEXT"),
+		NewAttribute("score", "BIGINT"),
+		NewAttribute("name", "TEXT"),
+	}
+	err = tx.CreateRelation(DefaultSchema, "account", attrs, nil)
+	if err != nil {
+		b.Fatalf("cannot create relation: %s", err)
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		values := map[string]any{"id": int64(i), "email": "foo@bar.com", "score": int64(i), "name": "foo"}
+		_, err = tx.Insert(DefaultSchema, "account", values)
+		if err != nil {
+			b.Fatalf("cannot insert values: %s", err)
+		}
+	}
+}
+
+func BenchmarkTransactionQuery(b *testing.B) {
+	e := NewEngine()
+
+	tx, err := e.Begin()
+	if err != nil {
+		b.Fatalf("cannot begin tx: %s", err)
+	}
+	defer tx.Rollback()
+
+	attrs := []Attribute{
+		NewAttribute("id", "BIGINT"),
+		NewAttribute("email", "TEXT"),
+	}
+	err = tx.CreateRelation(DefaultSchema, "account", attrs, nil)
+	if err != nil {
+		b.Fatalf("cannot create relation: %s", err)
+	}
+	for i := 0; i < 1000; i++ {
+		_, err = tx.Insert(DefaultSchema, "account", map[string]any{"id": int64(i), "email": "foo@bar.com"})
+		if err != nil {
+			b.Fatalf("cannot insert values: %s", err)
+		}
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_, _, err := tx.Query(
+			DefaultSchema,
+			[]Selector{NewAttributeSelector("account", []string{"email"})},
+			NewTruePredicate(),
+			nil,
+			nil,
+		)
+		if err != nil {
+			b.Fatalf("cannot query: %s", err)
+		}
+	}
+}
+
+func TestUpdateKeepsCommittedVersion(t *testing.T) {
+	e := NewEngine()
+
+	tx, err := e.Begin()
+	if err != nil {
+		t.Fatalf("cannot begin tx: %s", err)
+	}
+	attrs := []Attribute{NewAttribute("id", "BIGINT"), NewAttribute("score", "BIGINT")}
+	if err = tx.CreateRelation(DefaultSchema, "game", attrs, []string{"id"}); err != nil {
+		t.Fatalf("cannot create relation: %s", err)
+	}
+	if _, err = tx.Insert(DefaultSchema, "game", map[string]any{"id": int64(1), "score": int64(0)}); err != nil {
+		t.Fatalf("cannot insert values: %s", err)
+	}
+	if _, err = tx.Commit(); err != nil {
+		t.Fatalf("cannot commit tx: %s", err)
+	}
+
+	score := func(tx *Transaction) any {
+		_, res, err := tx.Query(DefaultSchema, []Selector{NewAttributeSelector("game", []string{"score"})}, NewTruePredicate(), nil, nil)
+		if err != nil {
+			t.Fatalf("cannot query: %s", err)
+		}
+		if len(res) != 1 {
+			t.Fatalf("expected 1 row, got %d", len(res))
+		}
+		return res[0].Values()[0]
+	}
+
+	tx, err = e.Begin()
+	if err != nil {
+		t.Fatalf("cannot begin tx: %s", err)
+	}
+	for i := 1; i <= 3; i++ {
+		if _, _, err = tx.Update(DefaultSchema, "game", map[string]any{"score": int64(i)}, nil, NewTruePredicate()); err != nil {
+			t.Fatalf("cannot update: %s", err)
+		}
+	}
+	// only the committed version of the row is kept
+	if tx.changes.Len() != 1 {
+		t.Fatalf("expected 1 change, got %d", tx.changes.Len())
+	}
+	if v := score(tx); v != int64(3) {
+		t.Fatalf("expected score 3, got %v", v)
+	}
+	tx.Rollback()
+
+	tx, err = e.Begin()
+	if err != nil {
+		t.Fatalf("cannot begin tx: %s", err)
+	}
+	if v := score(tx); v != int64(0) {
+		t.Fatalf("expected committed score 0 after rollback, got %v", v)
+	}
+
+	// rows inserted by transaction have no committed version
+	if _, err = tx.Insert(DefaultSchema, "game", map[string]any{"id": int64(2), "score": int64(0)}); err != nil {
+		t.Fatalf("cannot insert values: %s", err)
+	}
+	pred := NewEqPredicate(NewAttributeValueFunctor("game", "id"), NewConstValueFunctor(int64(2)))
+	if _, _, err = tx.Update(DefaultSchema, "game", map[string]any{"score": int64(5)}, nil, pred); err != nil {
+		t.Fatalf("cannot update: %s", err)
+	}
+	if tx.changes.Len() != 1 {
+		t.Fatalf("expected 1 change, got %d", tx.changes.Len())
+	}
+	if _, err = tx.Commit(); err != nil {
+		t.Fatalf("cannot commit tx: %s", err)
+	}
+
+	// committed rows are recorded again by next transaction
+	tx, err = e.Begin()
+	if err != nil {
+		t.Fatalf("cannot begin tx: %s", err)
+	}
+	defer tx.Rollback()
+	if _, _, err = tx.Update(DefaultSchema, "game", map[string]any{"score": int64(7)}, nil, pred); err != nil {
+		t.Fatalf("cannot update: %s", err)
+	}
+	if tx.changes.Len() != 1 {
+		t.Fatalf("expected 1 change, got %d", tx.changes.Len())
+	}
+}
+
+func TestTransactionReset(t *testing.T) {
+	e := NewEngine()
+
+	tx, err := e.Begin()
+	if err != nil {
+		t.Fatalf("cannot begin tx: %s", err)
+	}
+	attrs := []Attribute{NewAttribute("id", "BIGINT")}
+	if err = tx.CreateRelation(DefaultSchema, "item", attrs, []string{"id"}); err != nil {
+		t.Fatalf("cannot create relation: %s", err)
+	}
+	if _, err = tx.Commit(); err != nil {
+		t.Fatalf("cannot commit tx: %s", err)
+	}
+	if _, err = tx.Insert(DefaultSchema, "item", map[string]any{"id": int64(1)}); err == nil {
+		t.Fatalf("expected committed transaction to fail")
+	}
+
+	// committed transaction is usable again
+	tx.Reset()
+	if _, err = tx.Insert(DefaultSchema, "item", map[string]any{"id": int64(1)}); err != nil {
+		t.Fatalf("cannot insert after reset: %s", err)
+	}
+	if _, err = tx.Commit(); err != nil {
+		t.Fatalf("cannot commit tx: %s", err)
+	}
+
+	// aborted transaction is usable again, its changes being rolled back
+	tx.Reset()
+	if _, err = tx.Insert(DefaultSchema, "item", map[string]any{"id": int64(2)}); err != nil {
+		t.Fatalf("cannot insert values: %s", err)
+	}
+	if _, err = tx.Insert(DefaultSchema, "item", map[string]any{"id": int64(1)}); err == nil {
+		t.Fatalf("expected duplicate primary key to fail")
+	}
+	tx.Reset()
+	if err = tx.Error(); err != nil {
+		t.Fatalf("expected no error after reset, got %s", err)
+	}
+	_, res, err := tx.Query(DefaultSchema, []Selector{NewAttributeSelector("item", []string{"id"})}, NewTruePredicate(), nil, nil)
+	if err != nil {
+		t.Fatalf("cannot query after reset: %s", err)
+	}
+	if len(res) != 1 {
+		t.Fatalf("expected 1 row, got %d", len(res))
+	}
+
+	// pending changes are rolled back and locks released
+	if _, err = tx.Insert(DefaultSchema, "item", map[string]any{"id": int64(3)}); err != nil {
+		t.Fatalf("cannot insert values: %s", err)
+	}
+	tx.Reset()
+	other, err := e.Begin()
+	if err != nil {
+		t.Fatalf("cannot begin tx: %s", err)
+	}
+	_, res, err = other.Query(DefaultSchema, []Selector{NewAttributeSelector("item", []string{"id"})}, NewTruePredicate(), nil, nil)
+	if err != nil {
+		t.Fatalf("cannot query: %s", err)
+	}
+	if len(res) != 1 {
+		t.Fatalf("expected 1 row after reset, got %d", len(res))
+	}
+	other.Rollback()
+	tx.Rollback()
+}
+
+func TestRollbackStatement(t *testing.T) {
+	e := NewEngine()
+
+	tx, err := e.Begin()
+	if err != nil {
+		t.Fatalf("cannot begin tx: %s", err)
+	}
+	attrs := []Attribute{NewAttribute("id", "BIGINT"), NewAttribute("score", "BIGINT")}
+	if err = tx.CreateRelation(DefaultSchema, "game", attrs, []string{"id"}); err != nil {
+		t.Fatalf("cannot create relation: %s", err)
+	}
+	if _, err = tx.Insert(DefaultSchema, "game", map[string]any{"id": int64(1), "score": int64(0)}); err != nil {
+		t.Fatalf("cannot insert values: %s", err)
+	}
+	if _, err = tx.Commit(); err != nil {
+		t.Fatalf("cannot commit tx: %s", err)
+	}
+
+	scores := func(tx *Transaction) []any {
+		_, res, err := tx.Query(DefaultSchema, []Selector{NewAttributeSelector("game", []string{"score"})}, NewTruePredicate(), nil, nil)
+		if err != nil {
+			t.Fatalf("cannot query: %s", err)
+		}
+		var s []any
+		for _, r := range res {
+			s = append(s, r.Values()[0])
+		}
+		return s
+	}
+
+	tx, err = e.Begin()
+	if err != nil {
+		t.Fatalf("cannot begin tx: %s", err)
+	}
+	tx.SetStatementRollback(true)
+
+	tx.StartStatement()
+	if _, _, err = tx.Update(DefaultSchema, "game", map[string]any{"score": int64(1)}, nil, NewTruePredicate()); err != nil {
+		t.Fatalf("cannot update: %s", err)
+	}
+
+	tx.StartStatement()
+	if _, _, err = tx.Update(DefaultSchema, "game", map[string]any{"score": int64(2)}, nil, NewTruePredicate()); err != nil {
+		t.Fatalf("cannot update: %s", err)
+	}
+	if _, _, err = tx.Delete(DefaultSchema, "game", nil, NewTruePredicate()); err != nil {
+		t.Fatalf("cannot delete: %s", err)
+	}
+	// failing insert rolls back the statement only
+	if _, err = tx.Insert(DefaultSchema, "game", map[string]any{"id": int64(2), "score": nil, "foo": 1}); err == nil {
+		t.Fatalf("expected insert to fail")
+	}
+	if err = tx.Error(); err != nil {
+		t.Fatalf("expected transaction to be usable, got %s", err)
+	}
+	if s := scores(tx); len(s) != 1 || s[0] != int64(1) {
+		t.Fatalf("expected score 1 after statement rollback, got %v", s)
+	}
+
+	tx.Rollback()
+	tx, err = e.Begin()
+	if err != nil {
+		t.Fatalf("cannot begin tx: %s", err)
+	}
+	if s := scores(tx); len(s) != 1 || s[0] != int64(0) {
+		t.Fatalf("expected committed score 0 after rollback, got %v", s)
+	}
+	tx.Rollback()
+}
+
+func TestEngineErr(t *testing.T) {
+	e := NewEngine()
+	if err := e.OpenWAL(filepath.Join(t.TempDir(), "ramsql.wal")); err != nil {
+		t.Fatalf("cannot open log: %s", err)
+	}
+	defer e.CloseWAL()
+
+	tx, err := e.Begin()
+	if err != nil {
+		t.Fatalf("cannot begin tx: %s", err)
+	}
+	if err = tx.CreateRelation(DefaultSchema, "item", []Attribute{NewAttribute("id", "BIGINT")}, nil); err != nil {
+		t.Fatalf("cannot create relation: %s", err)
+	}
+	if _, err = tx.Commit(); err != nil {
+		t.Fatalf("cannot commit tx: %s", err)
+	}
+	if err = e.Err(); err != nil {
+		t.Fatalf("expected no error, got %s", err)
+	}
+
+	// log file can no longer be written
+	e.wal.f.Close()
+	tx, err = e.Begin()
+	if err != nil {
+		t.Fatalf("cannot begin tx: %s", err)
+	}
+	if _, err = tx.Insert(DefaultSchema, "item", map[string]any{"id": int64(1)}); err != nil {
+		t.Fatalf("cannot insert values: %s", err)
+	}
+	if _, err = tx.Commit(); err == nil {
+		t.Fatalf("expected commit to fail")
+	}
+	if err = e.Err(); err == nil {
+		t.Fatalf("expected write-ahead log error")
+	}
+}
+
+type testLevel int
+
+func (l testLevel) Value() (driver.Value, error) {
+	if l > 2 {
+		return nil, fmt.Errorf("invalid level %d", l)
+	}
+	return []string{"low", "medium", "high"}[l], nil
+}
+
+func TestInsertValuer(t *testing.T) {
+	e := NewEngine()
+
+	tx, err := e.Begin()
+	if err != nil {
+		t.Fatalf("cannot begin tx: %s", err)
+	}
+	defer tx.Rollback()
+
+	attrs := []Attribute{NewAttribute("id", "BIGINT"), NewAttribute("level", "TEXT"), NewAttribute("note", "TEXT")}
+	if err = tx.CreateRelation(DefaultSchema, "task", attrs, nil); err != nil {
+		t.Fatalf("cannot create relation: %s", err)
+	}
+
+	tuple, err := tx.Insert(DefaultSchema, "task", map[string]any{"id": int64(1), "level": testLevel(2), "note": sql.NullString{}})
+	if err != nil {
+		t.Fatalf("cannot insert values: %s", err)
+	}
+	if v := tuple.Values(); v[1] != "high" || v[2] != nil {
+		t.Fatalf("expected Value method results, got %v", v)
+	}
+
+	_, err = tx.Insert(DefaultSchema, "task", map[string]any{"id": int64(2), "level": testLevel(3), "note": sql.NullString{}})
+	if err == nil {
+		t.Fatalf("expected Value method error")
+	}
+}
+
+func TestForeignKeyIndexJoin(t *testing.T) {
+	e := NewEngine()
+
+	tx, err := e.Begin()
+	if err != nil {
+		t.Fatalf("cannot begin tx: %s", err)
+	}
+	defer tx.Rollback()
+
+	err = tx.CreateRelation(DefaultSchema, "author", []Attribute{NewAttribute("id", "BIGINT"), NewAttribute("name", "TEXT")}, []string{"id"})
+	if err != nil {
+		t.Fatalf("cannot create relation: %s", err)
+	}
+	attrs := []Attribute{NewAttribute("title", "TEXT"), NewAttribute("author_id", "BIGINT").WithForeignKey("", "author", "id")}
+	if err = tx.CreateRelation(DefaultSchema, "book", attrs, nil); err != nil {
+		t.Fatalf("cannot create relation: %s", err)
+	}
+	book := e.schemas[DefaultSchema].relations["book"]
+	if _, index := book.index("fk_public_book_author_id"); index == nil || !book.implicitIndex(index.Name()) {
+		t.Fatalf("expected implicit foreign key index, got %v", book.indexes)
+	}
+
+	for i, name := range []string{"hugo", "zola"} {
+		if _, err = tx.Insert(DefaultSchema, "author", map[string]any{"id": int64(i + 1), "name": name}); err != nil {
+			t.Fatalf("cannot insert values: %s", err)
+		}
+	}
+	for _, title := range []string{"germinal", "nana"} {
+		if _, err = tx.Insert(DefaultSchema, "book", map[string]any{"title": title, "author_id": int64(2)}); err != nil {
+			t.Fatalf("cannot insert values: %s", err)
+		}
+	}
+
+	// index lookup on either side of the join keeps left columns first
+	joins := []*NaturalJoin{
+		NewNaturalJoin("author", "id", "book", "author_id"),
+		NewNaturalJoin("book", "author_id", "author", "id"),
+	}
+	for _, j := range joins {
+		cols, res, err := tx.Query(
+			DefaultSchema,
+			[]Selector{NewAttributeSelector("author", []string{"name"}), NewAttributeSelector("book", []string{"title"})},
+			NewTruePredicate(),
+			[]Joiner{j},
+			nil,
+		)
+		if err != nil {
+			t.Fatalf("cannot query %s: %s", j, err)
+		}
+		if len(cols) != 2 || len(res) != 2 {
+			t.Fatalf("expected 2 rows of 2 columns joining %s, got %v %v", j, cols, res)
+		}
+		for _, r := range res {
+			if r.values[0] != "zola" {
+				t.Fatalf("unexpected row %v joining %s", r.values, j)
+			}
+		}
+		if _, _, ok := indexLookup(j.right); !ok {
+			if _, _, ok := indexLookup(j.left); !ok {
+				t.Fatalf("expected index lookup joining %s", j)
+			}
+		}
+	}
+}
+
+func TestCompositeHashIndexProbe(t *testing.T) {
+	attrs := []Attribute{NewAttribute("a", "BIGINT"), NewAttribute("b", "BIGINT"), NewAttribute("c", "BIGINT")}
+	r, err := NewRelation(DefaultSchema, "rel", attrs, []string{"a", "b"})
+	if err != nil {
+		t.Fatalf("cannot create relation: %s", err)
+	}
+	index := r.indexes[0]
+
+	eq := func(attr string, v int64) Predicate {
+		return NewEqPredicate(NewAttributeValueFunctor("rel", attr), NewConstValueFunctor(v))
+	}
+
+	// one equality is not enough to probe both attributes
+	if _, ok, _ := recCanUseIndex("rel", index, eq("a", 1), nil); ok {
+		t.Fatalf("expected composite index not to source a single equality")
+	}
+
+	// equalities are gathered from the whole conjunction, in index order
+	p := NewAndPredicate(NewAndPredicate(eq("b", 2), eq("c", 3)), eq("a", 1))
+	_, ok, ip := recCanUseIndex("rel", index, p, nil)
+	if !ok {
+		t.Fatalf("expected composite index to source %s", p)
+	}
+	key, ok := index.(*HashIndex).probe(ip)
+	if !ok || !reflect.DeepEqual(key, []any{int64(1), int64(2)}) {
+		t.Fatalf("expected probe key [1 2], got %v", key)
+	}
+
+	// both equalities are more selective than one
+	stats := &Stats{Rows: 100, Columns: map[string]ColumnStats{
+		"a": {Count: 100, Distinct: 10, Min: int64(0), Max: int64(9)},
+		"b": {Count: 100, Distinct: 10, Min: int64(0), Max: int64(9)},
+	}}
+	both, _, _ := recCanUseIndex("rel", index, p, stats)
+	if one := stats.cost(1, eq("a", 1)); both >= one {
+		t.Fatalf("expected probe on both attributes to cost less than %d, got %d", one, both)
+	}
+
+	if _, ok, _ := recCanUseIndex("rel", index, NewOrPredicate(eq("a", 1), eq("b", 2)), nil); ok {
+		t.Fatalf("expected composite index not to source a disjunction")
+	}
+}
+
+func TestPlanMetrics(t *testing.T) {
+	e := NewEngine()
+
+	tx, err := e.Begin()
+	if err != nil {
+		t.Fatalf("cannot begin tx: %s", err)
+	}
+	defer tx.Rollback()
+
+	err = tx.CreateRelation(DefaultSchema, "author", []Attribute{NewAttribute("id", "BIGINT"), NewAttribute("name", "TEXT")}, []string{"id"})
+	if err != nil {
+		t.Fatalf("cannot create relation: %s", err)
+	}
+	attrs := []Attribute{NewAttribute("title", "TEXT"), NewAttribute("author_id", "BIGINT").WithForeignKey("", "author", "id")}
+	if err = tx.CreateRelation(DefaultSchema, "book", attrs, nil); err != nil {
+		t.Fatalf("cannot create relation: %s", err)
+	}
+	for i, name := range []string{"hugo", "zola"} {
+		if _, err = tx.Insert(DefaultSchema, "author", map[string]any{"id": int64(i + 1), "name": name}); err != nil {
+			t.Fatalf("cannot insert values: %s", err)
+		}
+	}
+	for _, title := range []string{"germinal", "nana", "les miserables"} {
+		id := int64(2)
+		if title == "les miserables" {
+			id = 1
+		}
+		if _, err = tx.Insert(DefaultSchema, "book", map[string]any{"title": title, "author_id": id}); err != nil {
+			t.Fatalf("cannot insert values: %s", err)
+		}
+	}
+
+	// metrics are not collected without WithPlanMetrics
+	var m PlanMetrics
+	query := func() []*Tuple {
+		_, res, err := tx.Query(
+			DefaultSchema,
+			[]Selector{NewAttributeSelector("author", []string{"name"}), NewAttributeSelector("book", []string{"title"})},
+			NewEqPredicate(NewAttributeValueFunctor("author", "name"), NewConstValueFunctor("zola")),
+			[]Joiner{NewNaturalJoin("author", "id", "book", "author_id")},
+			nil,
+		)
+		if err != nil {
+			t.Fatalf("cannot query: %s", err)
+		}
+		return res
+	}
+	query()
+	if len(m.Nodes) != 0 {
+		t.Fatalf("expected no plan metrics, got %v", m.Nodes)
+	}
+
+	tx.SetContext(WithPlanMetrics(context.Background(), &m))
+	res := query()
+	if len(res) != 2 || m.Actual() != 2 {
+		t.Fatalf("expected 2 rows in result and metrics, got %d and %d", len(res), m.Actual())
+	}
+	if !reflect.DeepEqual(m.Indexes(), []string{"fk_public_book_author_id"}) {
+		t.Fatalf("expected foreign key index lookup, got %v", m.Indexes())
+	}
+	for _, n := range m.Nodes {
+		if !n.Executed {
+			t.Fatalf("expected node %s to be executed", n.Node)
+		}
+		if n.Index != "" && n.Actual != 2 {
+			t.Fatalf("expected 2 rows looked up in %s, got %d", n.Node, n.Actual)
+		}
+	}
+}
+
+func TestNaturalJoinAnd(t *testing.T) {
+	e := NewEngine()
+
+	tx, err := e.Begin()
+	if err != nil {
+		t.Fatalf("cannot begin tx: %s", err)
+	}
+	defer tx.Rollback()
+
+	attrs := []Attribute{NewAttribute("a", "BIGINT"), NewAttribute("b", "BIGINT")}
+	for _, rel := range []string{"l", "r"} {
+		if err = tx.CreateRelation(DefaultSchema, rel, attrs, nil); err != nil {
+			t.Fatalf("cannot create relation: %s", err)
+		}
+		for i := int64(0); i < 4; i++ {
+			if _, err = tx.Insert(DefaultSchema, rel, map[string]any{"a": i % 2, "b": i}); err != nil {
+				t.Fatalf("cannot insert values: %s", err)
+			}
+		}
+	}
+
+	j := NewNaturalJoin("l", "a", "r", "a").And("b", "b")
+	if s := j.String(); s != "JOIN l.a >< r.a AND l.b >< r.b" {
+		t.Fatalf("unexpected join %s", s)
+	}
+	_, res, err := tx.Query(
+		DefaultSchema,
+		[]Selector{NewAttributeSelector("l", []string{"a", "b"}), NewAttributeSelector("r", []string{"b"})},
+		NewTruePredicate(),
+		[]Joiner{j},
+		nil,
+	)
+	if err != nil {
+		t.Fatalf("cannot query: %s", err)
+	}
+	if len(res) != 4 {
+		t.Fatalf("expected 4 rows joined on both attributes, got %d", len(res))
+	}
+	for _, r := range res {
+		if r.values[1] != r.values[2] {
+			t.Fatalf("unexpected row %v", r.values)
+		}
+	}
+}
+
+func TestNaturalJoinFilter(t *testing.T) {
+	e := NewEngine()
+
+	tx, err := e.Begin()
+	if err != nil {
+		t.Fatalf("cannot begin tx: %s", err)
+	}
+	defer tx.Rollback()
+
+	attrs := []Attribute{NewAttribute("a", "BIGINT"), NewAttribute("b", "BIGINT")}
+	for _, rel := range []string{"l", "r"} {
+		if err = tx.CreateRelation(DefaultSchema, rel, attrs, nil); err != nil {
+			t.Fatalf("cannot create relation: %s", err)
+		}
+		for i := int64(0); i < 4; i++ {
+			if _, err = tx.Insert(DefaultSchema, rel, map[string]any{"a": i % 2, "b": i}); err != nil {
+				t.Fatalf("cannot insert values: %s", err)
+			}
+		}
+		// NULL joins nothing
+		if _, err = tx.Insert(DefaultSchema, rel, map[string]any{"b": int64(4)}); err != nil {
+			t.Fatalf("cannot insert values: %s", err)
+		}
+	}
+
+	j := NewNaturalJoin("l", "a", "r", "a").Filter(NewLePredicate(NewAttributeValueFunctor("l", "b"), NewAttributeValueFunctor("r", "b")))
+	_, res, err := tx.Query(
+		DefaultSchema,
+		[]Selector{NewAttributeSelector("l", []string{"b"}), NewAttributeSelector("r", []string{"b"})},
+		NewTruePredicate(),
+		[]Joiner{j},
+		nil,
+	)
+	if err != nil {
+		t.Fatalf("cannot query: %s", err)
+	}
+	// (0, 2) and (1, 3)
+	if len(res) != 2 {
+		t.Fatalf("expected 2 rows, got %v", res)
+	}
+	for _, r := range res {
+		if r.values[0].(int64)+2 != r.values[1].(int64) {
+			t.Fatalf("unexpected row %v", r.values)
+		}
+	}
+}
+
+func TestFilterSelector(t *testing.T) {
+	e := NewEngine()
+
+	tx, err := e.Begin()
+	if err != nil {
+		t.Fatalf("cannot begin tx: %s", err)
+	}
+	defer tx.Rollback()
+
+	if err = tx.CreateRelation(DefaultSchema, "rel", []Attribute{NewAttribute("a", "BIGINT")}, nil); err != nil {
+		t.Fatalf("cannot create relation: %s", err)
+	}
+	for i := int64(0); i < 10; i++ {
+		if _, err = tx.Insert(DefaultSchema, "rel", map[string]any{"a": i}); err != nil {
+			t.Fatalf("cannot insert values: %s", err)
+		}
+	}
+
+	even := NewFilterSelector(NewSumSelector("rel", "a"), NewGeqPredicate(NewAttributeValueFunctor("rel", "a"), NewConstValueFunctor(int64(5))))
+	cols, res, err := tx.Query(DefaultSchema, []Selector{even, NewCountSelector("rel", "*")}, NewTruePredicate(), nil, nil)
+	if err != nil {
+		t.Fatalf("cannot query: %s", err)
+	}
+	if len(res) != 1 || !reflect.DeepEqual(res[0].values, []any{int64(35), int64(10)}) {
+		t.Fatalf("expected sum 35 of 10 rows, got %v %v", cols, res)
+	}
+}
+
+func TestGenerateSeries(t *testing.T) {
+	values := func(rows []*Tuple) []any {
+		var res []any
+		for _, r := range rows {
+			res = append(res, r.values[0])
+		}
+		return res
+	}
+
+	rows, typeName, err := GenerateSeries(int64(1), int64(7), int64(3))
+	if err != nil || typeName != "BIGINT" || !reflect.DeepEqual(values(rows), []any{int64(1), int64(4), int64(7)}) {
+		t.Fatalf("expected 1, 4 and 7, got %v %s %v", values(rows), typeName, err)
+	}
+
+	rows, _, err = GenerateSeries(int64(math.MaxInt64-1), int64(math.MaxInt64))
+	if err != nil || len(rows) != 2 {
+		t.Fatalf("expected 2 rows up to largest integer, got %v %v", values(rows), err)
+	}
+
+	rows, typeName, err = GenerateSeries(1.0, int64(0), -0.25)
+	if err != nil || typeName != "FLOAT" || !reflect.DeepEqual(values(rows), []any{1.0, 0.75, 0.5, 0.25, 0.0}) {
+		t.Fatalf("expected 1 to 0 by -0.25, got %v %s %v", values(rows), typeName, err)
+	}
+
+	rows, _, err = GenerateSeries(int64(1), nil)
+	if err != nil || len(rows) != 0 {
+		t.Fatalf("expected no row with NULL argument, got %v %v", values(rows), err)
+	}
+
+	start := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	rows, typeName, err = GenerateSeries(start, start.Add(-2*time.Hour), "-1 hour")
+	if err != nil || typeName != "TIMESTAMP" || len(rows) != 3 || !rows[2].values[0].(time.Time).Equal(start.Add(-2*time.Hour)) {
+		t.Fatalf("expected 3 hours counting down, got %v %s %v", values(rows), typeName, err)
+	}
+
+	for _, args := range [][]any{
+		{int64(1), int64(2), int64(0)},
+		{1.0, 2.0, 0.0},
+		{start, start, Interval{}},
+	} {
+		_, _, err = GenerateSeries(args...)
+		var e *Error
+		if !errors.As(err, &e) || e.Code != InvalidParameterValue {
+			t.Fatalf("expected invalid parameter value error with zero step %v, got %v", args, err)
+		}
+	}
+
+	if _, _, err = GenerateSeries(start, start); err == nil {
+		t.Fatalf("expected error without step for timestamps")
+	}
+}
+
+func TestQueryWithoutRelation(t *testing.T) {
+	e := NewEngine()
+
+	tx, err := e.Begin()
+	if err != nil {
+		t.Fatalf("cannot begin tx: %s", err)
+	}
+	defer tx.Rollback()
+
+	sum, err := NewArithmeticValueFunctor("+", NewConstValueFunctor(int64(1)), NewConstValueFunctor(int64(1)))
+	if err != nil {
+		t.Fatalf("cannot create functor: %s", err)
+	}
+	selectors := []Selector{NewConstSelector("", "one", int64(1)), NewExpressionSelector("", "two", sum)}
+	cols, res, err := tx.Query(DefaultSchema, selectors, NewTruePredicate(), nil, nil)
+	if err != nil {
+		t.Fatalf("cannot query: %s", err)
+	}
+	if len(res) != 1 || !reflect.DeepEqual(cols, []string{"one", "two"}) || !reflect.DeepEqual(res[0].values, []any{int64(1), int64(2)}) {
+		t.Fatalf("expected a single row of 1 and 2, got %v %v", cols, res)
+	}
+}
+
+func TestOrderedSetSelectors(t *testing.T) {
+	e := NewEngine()
+
+	tx, err := e.Begin()
+	if err != nil {
+		t.Fatalf("cannot begin tx: %s", err)
+	}
+	defer tx.Rollback()
+
+	if err = tx.CreateRelation(DefaultSchema, "rel", []Attribute{NewAttribute("a", "BIGINT"), NewAttribute("b", "TEXT")}, nil); err != nil {
+		t.Fatalf("cannot create relation: %s", err)
+	}
+	for i, b := range []any{"x", "y", "y", nil, "x"} {
+		if _, err = tx.Insert(DefaultSchema, "rel", map[string]any{"a": int64(i), "b": b}); err != nil {
+			t.Fatalf("cannot insert values: %s", err)
+		}
+	}
+
+	median, err := NewPercentileContSelector("rel", "a", 0.5, ASC)
+	if err != nil {
+		t.Fatalf("cannot create selector: %s", err)
+	}
+	p875, err := NewPercentileContSelector("rel", "a", 0.875, DESC)
+	if err != nil {
+		t.Fatalf("cannot create selector: %s", err)
+	}
+	selectors := []Selector{median, p875, NewModeSelector("rel", "b", ASC), NewModeSelector("rel", "b", DESC)}
+	cols, res, err := tx.Query(DefaultSchema, selectors, NewTruePredicate(), nil, nil)
+	if err != nil {
+		t.Fatalf("cannot query: %s", err)
+	}
+	// values 0 to 4, percentile 0.875 of descending values is half way from 1 to 0
+	if len(res) != 1 || !reflect.DeepEqual(res[0].values, []any{float64(2), 0.5, "x", "y"}) {
+		t.Fatalf("expected median 2, percentile 0.5, modes x and y, got %v %v", cols, res)
+	}
+
+	if _, err = NewPercentileContSelector("rel", "a", 1.5, ASC); err == nil {
+		t.Fatalf("expected error with percentile above 1")
+	}
+}
+
+func TestCollatedPredicate(t *testing.T) {
+	e := NewEngine()
+
+	tx, err := e.Begin()
+	if err != nil {
+		t.Fatalf("cannot begin tx: %s", err)
+	}
+	defer tx.Rollback()
+
+	nocase, err := NewCollation("nocase")
+	if err != nil {
+		t.Fatalf("cannot create collation: %s", err)
+	}
+	if _, err = NewCollation("xx_nope"); err == nil {
+		t.Fatalf("expected error with unknown collation")
+	}
+
+	if err = tx.CreateRelation(DefaultSchema, "rel", []Attribute{NewAttribute("a", "TEXT")}, []string{"a"}); err != nil {
+		t.Fatalf("cannot create relation: %s", err)
+	}
+	for _, v := range []string{"b", "A", "c"} {
+		if _, err = tx.Insert(DefaultSchema, "rel", map[string]any{"a": v}); err != nil {
+			t.Fatalf("cannot insert values: %s", err)
+		}
+	}
+
+	// primary key index orders strings byte by byte, and is not used
+	left := NewCollateValueFunctor(NewAttributeValueFunctor("rel", "a"), nocase, true)
+	p, err := NewComparisonPredicate(left, Le, NewConstValueFunctor("B"))
+	if err != nil {
+		t.Fatalf("cannot create predicate: %s", err)
+	}
+	sorter := NewOrderBySorter("rel", []SortExpression{NewSortExpression("a", DESC).WithCollation(nocase)})
+	_, res, err := tx.Query(DefaultSchema, []Selector{NewAttributeSelector("rel", []string{"a"})}, p, nil, []Sorter{sorter})
+	if err != nil {
+		t.Fatalf("cannot query: %s", err)
+	}
+	if len(res) != 1 || res[0].values[0] != "A" {
+		t.Fatalf("expected A only, got %v", res)
+	}
+
+	_, res, err = tx.Query(DefaultSchema, []Selector{NewAttributeSelector("rel", []string{"a"})}, NewTruePredicate(), nil, []Sorter{sorter})
+	if err != nil {
+		t.Fatalf("cannot query: %s", err)
+	}
+	var values []any
+	for _, r := range res {
+		values = append(values, r.values[0])
+	}
+	if !reflect.DeepEqual(values, []any{"c", "b", "A"}) {
+		t.Fatalf("expected c, b, A, got %v", values)
+	}
+}
+
+func TestRegexPredicate(t *testing.T) {
+	attr := NewAttributeValueFunctor("rel", "a")
+	cols := []string{"rel.a"}
+
+	tests := []struct {
+		op       string
+		pattern  any
+		value    any
+		expected bool
+	}{
+		{"~", "^fo+$", "foo", true},
+		{"~", "^fo+$", "Foo", false},
+		{"~*", "^fo+$", "Foo", true},
+		{"!~", "^fo+$", "Foo", true},
+		{"!~*", "^fo+$", "Foo", false},
+		{"~", "^fo+$", nil, false},
+		{"!~", "^fo+$", nil, false},
+		{"!~", nil, "foo", false},
+	}
+	for _, tt := range tests {
+		p, err := NewRegexPredicate(attr, tt.op, NewConstValueFunctor(tt.pattern))
+		if err != nil {
+			t.Fatalf("cannot create predicate: %s", err)
+		}
+		ok, err := p.Eval(cols, NewTuple(tt.value))
+		if err != nil {
+			t.Fatalf("cannot eval %s: %s", p, err)
+		}
+		if ok != tt.expected {
+			t.Fatalf("expected %v for %v %s %v, got %v", tt.expected, tt.value, tt.op, tt.pattern, ok)
+		}
+	}
+
+	// matching NULL is unknown, and so is its negation
+	p, err := NewRegexPredicate(attr, "~", NewConstValueFunctor("foo"))
+	if err != nil {
+		t.Fatalf("cannot create predicate: %s", err)
+	}
+	if ok, err := NewNotPredicate(p).Eval(cols, NewTuple(nil)); err != nil || ok {
+		t.Fatalf("expected NOT of unknown match to be false, got %v (%v)", ok, err)
+	}
+
+	var e *Error
+	_, err = NewRegexPredicate(attr, "~", NewConstValueFunctor("(foo"))
+	if !errors.As(err, &e) || e.Code != InvalidRegularExpression {
+		t.Fatalf("expected invalid regular expression error, got %v", err)
+	}
+	p, err = NewRegexPredicate(attr, "~", NewAttributeValueFunctor("rel", "a"))
+	if err != nil {
+		t.Fatalf("cannot create predicate: %s", err)
+	}
+	_, err = p.Eval(cols, NewTuple("*"))
+	if !errors.As(err, &e) || e.Code != InvalidRegularExpression {
+		t.Fatalf("expected invalid regular expression error, got %v", err)
+	}
+	if _, err = NewRegexPredicate(attr, "~~", NewConstValueFunctor("foo")); err == nil {
+		t.Fatalf("expected error with unknown operator")
+	}
+}
+
+func TestArray(t *testing.T) {
+	tests := []struct {
+		literal  string
+		elemType string
+		expected []any
+		str      string
+	}{
+		{`{a,b}`, "text", []any{"a", "b"}, `{a,b}`},
+		{`{ "a b" , "c,d", NULL, "null" }`, "text", []any{"a b", "c,d", nil, "null"}, `{"a b","c,d",NULL,"null"}`},
+		{`{"x\"y",\\}`, "text", []any{`x"y`, `\`}, `{"x\"y","\\"}`},
+		{`{1,2,3}`, "int", []any{int64(1), int64(2), int64(3)}, `{1,2,3}`},
+		{`{}`, "int", []any{}, `{}`},
+	}
+	for _, tt := range tests {
+		a, err := ParseArray(tt.literal, tt.elemType)
+		if err != nil {
+			t.Fatalf("cannot parse %s: %s", tt.literal, err)
+		}
+		if !reflect.DeepEqual(a.Values, tt.expected) {
+			t.Fatalf("expected %#v parsing %s, got %#v", tt.expected, tt.literal, a.Values)
+		}
+		if a.String() != tt.str {
+			t.Fatalf("expected %s, got %s", tt.str, a.String())
+		}
+		b, err := ParseArray(a.String(), tt.elemType)
+		if err != nil {
+			t.Fatalf("cannot parse %s: %s", a, err)
+		}
+		if ok, err := b.equal(a); err != nil || !ok {
+			t.Fatalf("expected %s to round-trip, got %s (%v)", a, b, err)
+		}
+	}
+
+	var e *Error
+	for _, literal := range []string{`a,b`, `{a`, `{a,,b}`, `{"a}`, `{a"b}`} {
+		_, err := ParseArray(literal, "text")
+		if !errors.As(err, &e) || e.Code != InvalidTextRepresentation {
+			t.Fatalf("expected malformed array literal error with %s, got %v", literal, err)
+		}
+	}
+	if _, err := ParseArray(`{{1},{2}}`, "int"); err == nil {
+		t.Fatalf("expected error with nested array")
+	}
+	if _, err := ParseArray(`{a}`, "int"); err == nil {
+		t.Fatalf("expected error with invalid element")
+	}
+
+	tags, _ := NewArray("text", "a", "b")
+	cols := []string{"rel.tags"}
+	tuple := NewTuple(tags)
+	attr := NewAttributeValueFunctor("rel", "tags")
+	for _, tt := range []struct {
+		op       string
+		right    any
+		expected bool
+	}{
+		{"@>", "{a}", true},
+		{"@>", "{a,c}", false},
+		{"<@", "{a,b,c}", true},
+		{"&&", "{c,b}", true},
+		{"&&", "{c}", false},
+	} {
+		p, err := NewArrayPredicate(attr, tt.op, NewConstValueFunctor(tt.right))
+		if err != nil {
+			t.Fatalf("cannot create predicate: %s", err)
+		}
+		ok, err := p.Eval(cols, tuple)
+		if err != nil || ok != tt.expected {
+			t.Fatalf("expected %v for %s, got %v (%v)", tt.expected, p, ok, err)
+		}
+	}
+
+	p, err := NewAnyPredicate(NewConstValueFunctor("b"), Eq, attr)
+	if err != nil {
+		t.Fatalf("cannot create predicate: %s", err)
+	}
+	if ok, err := p.Eval(cols, tuple); err != nil || !ok {
+		t.Fatalf("expected 'b' = ANY(tags), got %v (%v)", ok, err)
+	}
+}
+
+func TestEnum(t *testing.T) {
+	e := NewEngine()
+
+	tx, err := e.Begin()
+	if err != nil {
+		t.Fatalf("cannot begin tx: %s", err)
+	}
+	defer tx.Rollback()
+
+	if err = tx.CreateEnum(DefaultSchema, "mood", []string{"sad", "ok", "happy"}); err != nil {
+		t.Fatalf("cannot create enum: %s", err)
+	}
+	attrs := []Attribute{NewAttribute("id", "BIGINT"), NewAttribute("mood", "mood")}
+	if err = tx.CreateRelation(DefaultSchema, "person", attrs, nil); err != nil {
+		t.Fatalf("cannot create relation: %s", err)
+	}
+	_, a, err := tx.RelationAttribute(DefaultSchema, "person", "mood")
+	if err != nil {
+		t.Fatalf("cannot get attribute: %s", err)
+	}
+	if a.Enum() == nil || a.Enum().Name() != "mood" || a.Collation() == nil {
+		t.Fatalf("expected attribute of enum type mood, got %v", a.Enum())
+	}
+	if c := a.Collation(); c.Compare("sad", "happy") >= 0 || c.Compare("happy", "ok") <= 0 || c.Compare("ok", "ok") != 0 {
+		t.Fatalf("expected enum values ordered as declared")
+	}
+
+	if _, err = tx.Insert(DefaultSchema, "person", map[string]any{"id": int64(1), "mood": "ok"}); err != nil {
+		t.Fatalf("cannot insert value: %s", err)
+	}
+	var ee *Error
+	_, err = tx.Insert(DefaultSchema, "person", map[string]any{"id": int64(2), "mood": "angry"})
+	if !errors.As(err, &ee) || ee.Code != InvalidTextRepresentation || ee.Column != "mood" {
+		t.Fatalf("expected invalid input value error, got %v", err)
+	}
+}
+
+func TestDomain(t *testing.T) {
+	e := NewEngine()
+
+	tx, err := e.Begin()
+	if err != nil {
+		t.Fatalf("cannot begin tx: %s", err)
+	}
+	defer tx.Rollback()
+
+	d, err := NewDomain("positive_int", "INT")
+	if err != nil {
+		t.Fatalf("cannot create domain: %s", err)
+	}
+	check := NewGePredicate(NewAttributeValueFunctor("", "value"), NewConstValueFunctor(int64(0)))
+	d = d.WithDefault(int64(1)).WithCheck("VALUE > 0", check)
+	if err = tx.CreateDomain(DefaultSchema, d); err != nil {
+		t.Fatalf("cannot create domain: %s", err)
+	}
+	attrs := []Attribute{NewAttribute("id", "BIGINT"), NewAttribute("qty", "positive_int")}
+	if err = tx.CreateRelation(DefaultSchema, "item", attrs, nil); err != nil {
+		t.Fatalf("cannot create relation: %s", err)
+	}
+	_, a, err := tx.RelationAttribute(DefaultSchema, "item", "qty")
+	if err != nil {
+		t.Fatalf("cannot get attribute: %s", err)
+	}
+	if a.Domain() != d || a.ScanType().Kind() != reflect.Int64 {
+		t.Fatalf("expected attribute of domain positive_int, got %v", a.Domain())
+	}
+
+	if _, err = tx.Insert(DefaultSchema, "item", map[string]any{"id": int64(1), "qty": int64(3)}); err != nil {
+		t.Fatalf("cannot insert value: %s", err)
+	}
+	tuple, err := tx.Insert(DefaultSchema, "item", map[string]any{"id": int64(2)})
+	if err != nil {
+		t.Fatalf("cannot insert default value: %s", err)
+	}
+	if v := tuple.Values()[1]; v != int64(1) {
+		t.Fatalf("expected domain default value 1, got %v", v)
+	}
+	var ee *Error
+	_, err = tx.Insert(DefaultSchema, "item", map[string]any{"id": int64(3), "qty": int64(0)})
+	if !errors.As(err, &ee) || ee.Code != CheckViolation || ee.Column != "qty" || !strings.Contains(err.Error(), "positive_int") {
+		t.Fatalf("expected check violation naming domain, got %v", err)
+	}
+}
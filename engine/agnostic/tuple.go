@@ -1,8 +1,28 @@
 package agnostic
 
+import "sync"
+
+// VersionAttribute is the pseudo-attribute of every relation holding the
+// version of a row, 1 once inserted and incremented by each update. It is not
+// part of relation attributes, and is only returned when selected by name.
+//
+// Updating a row only if its version did not change since it was read, as in
+// UPDATE t SET ... WHERE id = 1 AND xmin = 5, updates no row on conflict.
+const VersionAttribute = "xmin"
+
 // Tuple is a row in a relation
 type Tuple struct {
 	values []any
+
+	// version of row, 0 if tuple is not a relation row
+	version int64
+
+	// pooled is true if tuple was obtained with getTuple
+	pooled bool
+	// written is the generation of the transaction holding relation lock
+	// in which tuple was inserted or updated, the previous version of the
+	// row being already recorded in that generation. Zero once committed.
+	written uint64
 }
 
 // NewTuple should check that value are for the right Attribute and match domain
@@ -18,6 +38,50 @@ func (t *Tuple) Append(values ...any) {
 	t.values = append(t.values, values...)
 }
 
+// rowVersion returns the version of row as VersionAttribute value, NULL if
+// tuple is not a relation row
+func (t *Tuple) rowVersion() any {
+	if t.version == 0 {
+		return nil
+	}
+	return t.version
+}
+
 func (t *Tuple) Values() []any {
 	return t.values
 }
+
+// tuplePool holds tuples of intermediate results, see getTuple
+var tuplePool = sync.Pool{
+	New: func() any {
+		return &Tuple{}
+	},
+}
+
+// getTuple returns an empty tuple with room for n values, reusing a tuple
+// released with putTuple if possible.
+//
+// Selectors return pooled tuples to SelectorNode, which copies their values
+// into result tuples then releases them. Pooled tuples must never be stored in
+// a relation nor returned by a query, since they are reused once released.
+func getTuple(n int) *Tuple {
+	t := tuplePool.Get().(*Tuple)
+	if cap(t.values) < n {
+		t.values = make([]any, 0, n)
+	}
+	t.pooled = true
+	return t
+}
+
+// putTuple releases t if it was obtained with getTuple. t must not be used
+// afterward.
+func putTuple(t *Tuple) {
+	if t == nil || !t.pooled {
+		return
+	}
+	for i := range t.values {
+		t.values[i] = nil
+	}
+	t.values = t.values[:0]
+	tuplePool.Put(t)
+}
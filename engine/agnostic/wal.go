@@ -0,0 +1,606 @@
+package agnostic
+
+import (
+	"bufio"
+	"bytes"
+	"container/list"
+	"encoding/binary"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"reflect"
+	"sync"
+	"time"
+)
+
+// walOpKind is the kind of a write-ahead log operation
+type walOpKind int
+
+const (
+	walReset walOpKind = iota
+	walCreateSchema
+	walDropSchema
+	walRelation
+	walDropRelation
+	walInsert
+	walDelete
+	walUpdate
+	walNextValues
+	walSequence
+	walDropSequence
+	walEnum
+	walDropEnum
+	walDomain
+	walDropDomain
+)
+
+// walOp is a write-ahead log operation. Rows are identified by their values,
+// as identical rows are interchangeable.
+type walOp struct {
+	Kind       walOpKind
+	Schema     string
+	Name       string
+	Values     []any
+	Old        []any
+	Relation   *relationState
+	Sequence   *sequenceState
+	Enum       *enumState
+	Domain     *domainState
+	NextValues []uint64
+}
+
+// wal is the write-ahead log of an engine. Each committed transaction is
+// appended as one record, so a partially written record is ignored on replay.
+//
+// Record format is the length and CRC-32 checksum of the payload, as two big
+// endian uint32, followed by the payload, a gob encoded []walOp.
+type wal struct {
+	f *os.File
+	// sequences values last logged. Sequence values are not transactional
+	// and are logged with the next commit.
+	sequences map[sequenceKey]sequenceState
+	// error of last write, if it failed
+	err error
+
+	sync.Mutex
+}
+
+// OpenWAL replays the write-ahead log at path, if it exists, then logs every
+// committed transaction to it. Engine must be empty.
+//
+// Replay stops at the first incomplete or corrupted record, which is
+// truncated: it was being written when the process stopped, so its
+// transaction was never committed.
+func (e *Engine) OpenWAL(path string) error {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return err
+	}
+
+	size, err := e.replay(f)
+	if err != nil {
+		f.Close()
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	if err := f.Truncate(size); err != nil {
+		f.Close()
+		return err
+	}
+	if _, err := f.Seek(size, io.SeekStart); err != nil {
+		f.Close()
+		return err
+	}
+
+	w := &wal{f: f, sequences: e.sequenceStates()}
+
+	e.Lock()
+	e.wal = w
+	e.Unlock()
+	return nil
+}
+
+// Err returns the error of last write to the write-ahead log if it failed.
+// Commits following a partially written record would be lost on replay.
+func (e *Engine) Err() error {
+	e.Lock()
+	w := e.wal
+	e.Unlock()
+	if w == nil {
+		return nil
+	}
+
+	w.Lock()
+	defer w.Unlock()
+	return w.err
+}
+
+// CloseWAL stops logging transactions and closes write-ahead log file
+func (e *Engine) CloseWAL() error {
+	e.Lock()
+	w := e.wal
+	e.wal = nil
+	e.Unlock()
+
+	if w == nil {
+		return nil
+	}
+
+	w.Lock()
+	defer w.Unlock()
+	return w.f.Close()
+}
+
+// replay applies every complete record of r and returns the size of them
+func (e *Engine) replay(r io.Reader) (int64, error) {
+	br := bufio.NewReader(r)
+	var size int64
+	header := make([]byte, 8)
+	for {
+		if _, err := io.ReadFull(br, header); err != nil {
+			// EOF or torn header
+			return size, nil
+		}
+		n := binary.BigEndian.Uint32(header[:4])
+		sum := binary.BigEndian.Uint32(header[4:])
+
+		payload := make([]byte, n)
+		if _, err := io.ReadFull(br, payload); err != nil || crc32.ChecksumIEEE(payload) != sum {
+			return size, nil
+		}
+
+		var ops []walOp
+		if err := gob.NewDecoder(bytes.NewReader(payload)).Decode(&ops); err != nil {
+			return size, fmt.Errorf("cannot decode record at offset %d: %w", size, err)
+		}
+		for _, op := range ops {
+			if err := e.apply(op); err != nil {
+				return size, fmt.Errorf("cannot replay record at offset %d: %w", size, err)
+			}
+		}
+
+		size += int64(len(header)) + int64(n)
+	}
+}
+
+// write appends a record holding ops to log and syncs it to disk
+func (w *wal) write(ops []walOp) (err error) {
+	defer func() {
+		w.err = err
+	}()
+
+	var buf bytes.Buffer
+	buf.Write(make([]byte, 8))
+	if err := gob.NewEncoder(&buf).Encode(ops); err != nil {
+		return err
+	}
+
+	b := buf.Bytes()
+	binary.BigEndian.PutUint32(b[:4], uint32(len(b)-8))
+	binary.BigEndian.PutUint32(b[4:8], crc32.ChecksumIEEE(b[8:]))
+
+	if _, err := w.f.Write(b); err != nil {
+		return err
+	}
+	return w.f.Sync()
+}
+
+// sequenceOps returns operations setting sequences whose value changed since
+// last logged, and remembers them as logged.
+func (w *wal) sequenceOps(states map[sequenceKey]sequenceState) []walOp {
+	var ops []walOp
+	for k, seq := range states {
+		if last, ok := w.sequences[k]; ok && last == seq {
+			continue
+		}
+		seq := seq
+		ops = append(ops, walOp{Kind: walSequence, Schema: k.schema, Sequence: &seq})
+	}
+	w.sequences = states
+	return ops
+}
+
+// log writes to engine log, if any, a record of every schema, relation and
+// sequence of engine, replacing all previous state on replay. It is used
+// when engine content is replaced outside of transactions, by schemas no
+// transaction has seen yet. Caller must hold engine lock.
+func (e *Engine) log() error {
+	if e.wal == nil {
+		return nil
+	}
+
+	ops := []walOp{{Kind: walReset}}
+	for _, s := range e.schemas {
+		ss, err := s.state()
+		if err != nil {
+			return err
+		}
+		ops = append(ops, walOp{Kind: walCreateSchema, Schema: ss.Name})
+		for i := range ss.Enums {
+			ops = append(ops, walOp{Kind: walEnum, Schema: ss.Name, Enum: &ss.Enums[i]})
+		}
+		for i := range ss.Domains {
+			ops = append(ops, walOp{Kind: walDomain, Schema: ss.Name, Domain: &ss.Domains[i]})
+		}
+		for i := range ss.Relations {
+			ops = append(ops, walOp{Kind: walRelation, Schema: ss.Name, Relation: &ss.Relations[i]})
+		}
+	}
+
+	e.wal.Lock()
+	defer e.wal.Unlock()
+	e.wal.sequences = nil
+	ops = append(ops, e.wal.sequenceOps(e.sequenceStatesLocked())...)
+	return e.wal.write(ops)
+}
+
+type sequenceKey struct {
+	schema string
+	name   string
+}
+
+// sequenceStates returns the state of every sequence of engine
+func (e *Engine) sequenceStates() map[sequenceKey]sequenceState {
+	e.Lock()
+	defer e.Unlock()
+	return e.sequenceStatesLocked()
+}
+
+func (e *Engine) sequenceStatesLocked() map[sequenceKey]sequenceState {
+	states := make(map[sequenceKey]sequenceState)
+	for _, s := range e.schemas {
+		s.RLock()
+		for name, seq := range s.sequences {
+			seq.Lock()
+			states[sequenceKey{s.name, name}] = sequenceState{
+				Name:      seq.name,
+				Start:     seq.start,
+				Increment: seq.increment,
+				Value:     seq.value,
+				Called:    seq.called,
+			}
+			seq.Unlock()
+		}
+		s.RUnlock()
+	}
+	return states
+}
+
+// logCommit writes the changes of transaction to engine log, if any. It is
+// called before relations are unlocked, so records of transactions
+// modifying the same relation are written in commit order.
+func (t *Transaction) logCommit() error {
+	t.e.Lock()
+	w := t.e.wal
+	t.e.Unlock()
+	if w == nil {
+		return nil
+	}
+
+	ops, err := t.walOps()
+	if err != nil {
+		return err
+	}
+
+	// engine is locked before log, as in Reset and Replace
+	t.e.Lock()
+	defer t.e.Unlock()
+	w.Lock()
+	defer w.Unlock()
+
+	ops = append(ops, w.sequenceOps(t.e.sequenceStatesLocked())...)
+	if len(ops) == 0 {
+		return nil
+	}
+	return w.write(ops)
+}
+
+// walRow tracks the changes of a row during a transaction
+type walRow struct {
+	e *list.Element
+	// values before transaction, nil if row was inserted
+	orig    []any
+	deleted bool
+}
+
+// relationChanges tracks the changes of a relation during a transaction
+type relationChanges struct {
+	last int
+	// relation must be logged as a whole
+	dirty   bool
+	dropped bool
+	rows    []*walRow
+	byElem  map[*list.Element]*walRow
+}
+
+// walOps returns the log operations of transaction changes. Operations are
+// ordered like changes, except that operations on a relation are grouped at
+// its last change. Relations altered are logged as a whole, others as the
+// net change of each modified row.
+func (t *Transaction) walOps() ([]walOp, error) {
+	relations := make(map[*Relation]*relationChanges)
+	rel := func(r *Relation, i int) *relationChanges {
+		wr, ok := relations[r]
+		if !ok {
+			wr = &relationChanges{byElem: make(map[*list.Element]*walRow)}
+			relations[r] = wr
+		}
+		wr.last = i
+		return wr
+	}
+
+	i := 0
+	for c := t.changes.Front(); c != nil; c, i = c.Next(), i+1 {
+		switch c := c.Value.(type) {
+		case ValueChange:
+			wr := rel(c.relation, i)
+			e := c.current
+			if e == nil {
+				e = c.old
+			}
+			row, ok := wr.byElem[e]
+			if !ok {
+				row = &walRow{e: e}
+				if c.old != nil {
+					row.orig = c.old.Value.(*Tuple).values
+				}
+				wr.byElem[e] = row
+				wr.rows = append(wr.rows, row)
+			}
+			if c.current == nil {
+				row.deleted = true
+			}
+		case RelationChange:
+			if c.current != nil {
+				rel(c.current, i).dirty = true
+			}
+			if c.old != nil {
+				rel(c.old, i).dropped = true
+			}
+		case AttributeChange:
+			rel(c.relation, i).dirty = true
+		case IndexChange:
+			rel(c.relation, i).dirty = true
+		case RenameChange:
+			rel(c.relation, i).dirty = true
+		case TruncateChange:
+			rel(c.relation, i).dirty = true
+		case ForeignKeyChange:
+			rel(c.relation, i).dirty = true
+		}
+	}
+
+	last := make(map[int][]*Relation)
+	for r, wr := range relations {
+		if !wr.dropped {
+			last[wr.last] = append(last[wr.last], r)
+		}
+	}
+
+	var ops []walOp
+	i = 0
+	for c := t.changes.Front(); c != nil; c, i = c.Next(), i+1 {
+		switch c := c.Value.(type) {
+		case SchemaChange:
+			if c.current != nil {
+				ops = append(ops, walOp{Kind: walCreateSchema, Schema: c.current.name})
+			} else {
+				ops = append(ops, walOp{Kind: walDropSchema, Schema: c.old.name})
+			}
+		case SequenceChange:
+			if c.current == nil {
+				ops = append(ops, walOp{Kind: walDropSequence, Schema: c.schema.name, Name: c.old.name})
+			}
+		case EnumChange:
+			if c.current != nil {
+				ops = append(ops, walOp{Kind: walEnum, Schema: c.schema.name, Enum: &enumState{Name: c.current.name, Labels: c.current.Labels()}})
+			} else {
+				ops = append(ops, walOp{Kind: walDropEnum, Schema: c.schema.name, Name: c.old.name})
+			}
+		case DomainChange:
+			if c.current != nil {
+				ds := c.current.state()
+				ops = append(ops, walOp{Kind: walDomain, Schema: c.schema.name, Domain: &ds})
+			} else {
+				ops = append(ops, walOp{Kind: walDropDomain, Schema: c.schema.name, Name: c.old.name})
+			}
+		case RelationChange:
+			if c.current == nil {
+				ops = append(ops, walOp{Kind: walDropRelation, Schema: c.schema.name, Name: c.old.name})
+			}
+		case RenameChange:
+			if !c.attribute {
+				ops = append(ops, walOp{Kind: walDropRelation, Schema: c.schema.name, Name: c.old})
+			}
+		}
+
+		for _, r := range last[i] {
+			rops, err := relations[r].ops(r)
+			if err != nil {
+				return nil, err
+			}
+			ops = append(ops, rops...)
+		}
+	}
+
+	return ops, nil
+}
+
+// ops returns log operations of relation r at commit
+func (wr *relationChanges) ops(r *Relation) ([]walOp, error) {
+	schema := r.schema
+	if schema == "" {
+		schema = DefaultSchema
+	}
+
+	if wr.dirty {
+		rs, err := r.state()
+		if err != nil {
+			return nil, err
+		}
+		return []walOp{{Kind: walRelation, Schema: schema, Relation: &rs}}, nil
+	}
+
+	var ops []walOp
+	for _, row := range wr.rows {
+		switch {
+		case row.orig == nil && row.deleted:
+		case row.orig == nil:
+			ops = append(ops, walOp{Kind: walInsert, Schema: schema, Name: r.name, Values: row.e.Value.(*Tuple).values})
+		case row.deleted:
+			ops = append(ops, walOp{Kind: walDelete, Schema: schema, Name: r.name, Old: row.orig})
+		default:
+			ops = append(ops, walOp{Kind: walUpdate, Schema: schema, Name: r.name, Old: row.orig, Values: row.e.Value.(*Tuple).values})
+		}
+	}
+
+	nextValues := make([]uint64, len(r.attributes))
+	for i, a := range r.attributes {
+		nextValues[i] = a.nextValue
+	}
+	ops = append(ops, walOp{Kind: walNextValues, Schema: schema, Name: r.name, NextValues: nextValues})
+
+	return ops, nil
+}
+
+// apply replays log operation op on engine
+func (e *Engine) apply(op walOp) error {
+	switch op.Kind {
+	case walReset:
+		e.schemas = make(map[string]*Schema)
+		e.schemas[DefaultSchema] = NewSchema(DefaultSchema)
+		return nil
+	case walCreateSchema:
+		if _, ok := e.schemas[op.Schema]; !ok {
+			e.schemas[op.Schema] = NewSchema(op.Schema)
+		}
+		return nil
+	case walDropSchema:
+		delete(e.schemas, op.Schema)
+		return nil
+	}
+
+	s, ok := e.schemas[op.Schema]
+	if !ok {
+		return fmt.Errorf("schema '%s' does not exist", op.Schema)
+	}
+
+	switch op.Kind {
+	case walRelation:
+		r, err := op.Relation.relation()
+		if err != nil {
+			return err
+		}
+		s.relations[r.name] = r
+		return nil
+	case walDropRelation:
+		delete(s.relations, op.Name)
+		return nil
+	case walSequence:
+		s.sequences[op.Sequence.Name] = &Sequence{
+			name:      op.Sequence.Name,
+			start:     op.Sequence.Start,
+			increment: op.Sequence.Increment,
+			value:     op.Sequence.Value,
+			called:    op.Sequence.Called,
+		}
+		return nil
+	case walDropSequence:
+		delete(s.sequences, op.Name)
+		return nil
+	case walEnum:
+		enum, err := NewEnum(op.Enum.Name, op.Enum.Labels)
+		if err != nil {
+			return err
+		}
+		s.enums[enum.name] = enum
+		return nil
+	case walDropEnum:
+		delete(s.enums, op.Name)
+		return nil
+	case walDomain:
+		d, err := op.Domain.domain()
+		if err != nil {
+			return err
+		}
+		s.domains[d.name] = d
+		return nil
+	case walDropDomain:
+		delete(s.domains, op.Name)
+		return nil
+	}
+
+	r, ok := s.relations[op.Name]
+	if !ok {
+		return fmt.Errorf("relation '%s'.'%s' does not exist", op.Schema, op.Name)
+	}
+
+	switch op.Kind {
+	case walInsert:
+		el := r.rows.PushBack(&Tuple{values: op.Values, version: 1})
+		for _, i := range r.indexes {
+			i.Add(el)
+		}
+	case walDelete, walUpdate:
+		el := r.find(op.Old)
+		if el == nil {
+			return fmt.Errorf("row %v of relation '%s'.'%s' does not exist", op.Old, op.Schema, op.Name)
+		}
+		for _, i := range r.indexes {
+			i.Remove(el)
+		}
+		if op.Kind == walDelete {
+			r.rows.Remove(el)
+			break
+		}
+		el.Value = &Tuple{values: op.Values, version: el.Value.(*Tuple).version + 1}
+		for _, i := range r.indexes {
+			i.Add(el)
+		}
+	case walNextValues:
+		if len(op.NextValues) != len(r.attributes) {
+			return fmt.Errorf("relation '%s'.'%s' has %d attributes, expected %d", op.Schema, op.Name, len(r.attributes), len(op.NextValues))
+		}
+		for i := range r.attributes {
+			r.attributes[i].nextValue = op.NextValues[i]
+		}
+	default:
+		return errors.New("unknown operation")
+	}
+
+	return nil
+}
+
+// find returns the first row of relation with given values
+func (r *Relation) find(values []any) *list.Element {
+	for el := r.rows.Front(); el != nil; el = el.Next() {
+		t := el.Value.(*Tuple)
+		if len(t.values) != len(values) {
+			continue
+		}
+		same := true
+		for i, v := range t.values {
+			if !sameValue(v, values[i]) {
+				same = false
+				break
+			}
+		}
+		if same {
+			return el
+		}
+	}
+	return nil
+}
+
+// sameValue returns true if a and b are identical values. Timestamps are
+// compared on the instant they represent, as their location is not kept
+// by log encoding.
+func sameValue(a, b any) bool {
+	if ta, ok := a.(time.Time); ok {
+		tb, ok := b.(time.Time)
+		return ok && ta.Equal(tb)
+	}
+	return reflect.DeepEqual(a, b)
+}
@@ -0,0 +1,415 @@
+package agnostic
+
+import (
+	"container/list"
+	"fmt"
+	"sort"
+)
+
+// WindowFunction computes a value for each row of a window partition, like
+// ROW_NUMBER() OVER (PARTITION BY user_id ORDER BY name).
+type WindowFunction interface {
+	Compute(p *Partition) ([]any, error)
+}
+
+// Partition holds the rows sharing the same PARTITION BY values, sorted by
+// window ORDER BY.
+type Partition struct {
+	cols  []string
+	rows  []*Tuple
+	order []int
+}
+
+// Len returns the number of rows in partition
+func (p *Partition) Len() int {
+	return len(p.rows)
+}
+
+// Columns returns the name of partition row values
+func (p *Partition) Columns() []string {
+	return p.cols
+}
+
+// Row returns the i-th row of partition, in window order
+func (p *Partition) Row(i int) *Tuple {
+	return p.rows[i]
+}
+
+// Peer returns true if rows i and j have the same window ORDER BY values.
+// Without ORDER BY, all rows of a partition are peers.
+func (p *Partition) Peer(i, j int) bool {
+	for _, idx := range p.order {
+		eq, err := equal(p.rows[i].values[idx], p.rows[j].values[idx])
+		if err != nil || !eq {
+			return false
+		}
+	}
+	return true
+}
+
+// RowNumberFunction numbers rows of each partition sequentially, starting at 1.
+type RowNumberFunction struct {
+}
+
+func NewRowNumberFunction() *RowNumberFunction {
+	return &RowNumberFunction{}
+}
+
+func (f *RowNumberFunction) Compute(p *Partition) ([]any, error) {
+	values := make([]any, p.Len())
+	for i := range values {
+		values[i] = int64(i + 1)
+	}
+	return values, nil
+}
+
+func (f RowNumberFunction) String() string {
+	return "ROW_NUMBER()"
+}
+
+// RankFunction ranks rows of each partition by window ORDER BY. Peers get
+// the same rank, and the next row skips as many ranks as there were peers.
+type RankFunction struct {
+}
+
+func NewRankFunction() *RankFunction {
+	return &RankFunction{}
+}
+
+func (f *RankFunction) Compute(p *Partition) ([]any, error) {
+	values := make([]any, p.Len())
+	for i := range values {
+		if i > 0 && p.Peer(i-1, i) {
+			values[i] = values[i-1]
+			continue
+		}
+		values[i] = int64(i + 1)
+	}
+	return values, nil
+}
+
+func (f RankFunction) String() string {
+	return "RANK()"
+}
+
+// DenseRankFunction ranks rows of each partition by window ORDER BY. Peers
+// get the same rank, without gap in ranks.
+type DenseRankFunction struct {
+}
+
+func NewDenseRankFunction() *DenseRankFunction {
+	return &DenseRankFunction{}
+}
+
+func (f *DenseRankFunction) Compute(p *Partition) ([]any, error) {
+	values := make([]any, p.Len())
+	var rank int64
+	for i := range values {
+		if i == 0 || !p.Peer(i-1, i) {
+			rank++
+		}
+		values[i] = rank
+	}
+	return values, nil
+}
+
+func (f DenseRankFunction) String() string {
+	return "DENSE_RANK()"
+}
+
+// AggregateFunction computes an aggregate selector, like SUM, over the whole
+// partition and returns the result on every row of it.
+type AggregateFunction struct {
+	selector Selector
+}
+
+func NewAggregateFunction(s Selector) *AggregateFunction {
+	return &AggregateFunction{selector: s}
+}
+
+func (f *AggregateFunction) Compute(p *Partition) ([]any, error) {
+	l := list.New()
+	in := make([]*list.Element, p.Len())
+	for i, t := range p.rows {
+		in[i] = l.PushBack(t)
+	}
+
+	res, err := f.selector.Select(p.cols, in)
+	if err != nil {
+		return nil, err
+	}
+	if len(res) != 1 || len(res[0].values) != 1 {
+		return nil, fmt.Errorf("%s is not an aggregate", f.selector)
+	}
+
+	values := make([]any, p.Len())
+	for i := range values {
+		values[i] = res[0].values[0]
+	}
+	return values, nil
+}
+
+func (f AggregateFunction) String() string {
+	return fmt.Sprint(f.selector)
+}
+
+// NeighborFunction returns the value of an attribute in the row offset rows
+// before current row in partition, like LAG, or after it, like LEAD. Default
+// value is returned when there is no such row.
+type NeighborFunction struct {
+	name   string
+	key    WindowKey
+	offset int64
+	def    any
+}
+
+func NewLagFunction(rel, attr string, offset int64, def any) *NeighborFunction {
+	return &NeighborFunction{
+		name:   "LAG",
+		key:    NewWindowKey(rel, attr, ASC),
+		offset: offset,
+		def:    def,
+	}
+}
+
+func NewLeadFunction(rel, attr string, offset int64, def any) *NeighborFunction {
+	return &NeighborFunction{
+		name:   "LEAD",
+		key:    NewWindowKey(rel, attr, ASC),
+		offset: -offset,
+		def:    def,
+	}
+}
+
+func (f *NeighborFunction) Compute(p *Partition) ([]any, error) {
+	idx, err := f.key.index(p.cols)
+	if err != nil {
+		return nil, err
+	}
+
+	values := make([]any, p.Len())
+	for i := range values {
+		j := int64(i) - f.offset
+		if j < 0 || j >= int64(p.Len()) {
+			values[i] = f.def
+			continue
+		}
+		values[i] = p.rows[j].values[idx]
+	}
+	return values, nil
+}
+
+func (f NeighborFunction) String() string {
+	offset := f.offset
+	if offset < 0 {
+		offset = -offset
+	}
+	return fmt.Sprintf("%s(%s, %d, %v)", f.name, f.key, offset, f.def)
+}
+
+// WindowKey references an attribute in PARTITION BY or ORDER BY clause of a window.
+type WindowKey struct {
+	relation  string
+	attribute string
+	direction SortType
+}
+
+func NewWindowKey(rel, attr string, direction SortType) WindowKey {
+	return WindowKey{relation: rel, attribute: attr, direction: direction}
+}
+
+func (k WindowKey) String() string {
+	if k.direction == DESC {
+		return fmt.Sprintf("%s.%s DESC", k.relation, k.attribute)
+	}
+	return fmt.Sprintf("%s.%s", k.relation, k.attribute)
+}
+
+// index returns the index of key attribute in cols
+func (k WindowKey) index(cols []string) (int, error) {
+	for i, c := range cols {
+		if c == k.attribute || c == k.relation+"."+k.attribute {
+			return i, nil
+		}
+	}
+	return -1, fmt.Errorf("%s.%s: columns not found in left node", k.relation, k.attribute)
+}
+
+// Window computes a WindowFunction over rows partitioned by partition keys
+// and sorted by order keys. Computed values are returned in column name.
+type Window struct {
+	name      string
+	function  WindowFunction
+	partition []WindowKey
+	order     []WindowKey
+}
+
+func NewWindow(name string, f WindowFunction, partition []WindowKey, order []WindowKey) *Window {
+	return &Window{
+		name:      name,
+		function:  f,
+		partition: partition,
+		order:     order,
+	}
+}
+
+// Name returns the name of the column holding window values
+func (w *Window) Name() string {
+	return w.name
+}
+
+func (w Window) String() string {
+	return fmt.Sprintf("%s OVER (PARTITION BY %v ORDER BY %v)", w.function, w.partition, w.order)
+}
+
+// compute returns window value of each row, in rows order.
+func (w *Window) compute(cols []string, rows []*list.Element) ([]any, error) {
+	partIdx := make([]int, len(w.partition))
+	for i, k := range w.partition {
+		idx, err := k.index(cols)
+		if err != nil {
+			return nil, err
+		}
+		partIdx[i] = idx
+	}
+	orderIdx := make([]int, len(w.order))
+	for i, k := range w.order {
+		idx, err := k.index(cols)
+		if err != nil {
+			return nil, err
+		}
+		orderIdx[i] = idx
+	}
+
+	// group rows by partition values, in order of first appearance
+	var keys []string
+	partitions := make(map[string][]int)
+	for i, e := range rows {
+		t := e.Value.(*Tuple)
+		key := NewTuple()
+		for _, idx := range partIdx {
+			key.Append(t.values[idx])
+		}
+		k := rowKey(key)
+		if _, ok := partitions[k]; !ok {
+			keys = append(keys, k)
+		}
+		partitions[k] = append(partitions[k], i)
+	}
+
+	values := make([]any, len(rows))
+	for _, k := range keys {
+		members := partitions[k]
+		sort.SliceStable(members, func(i, j int) bool {
+			return w.less(rows[members[i]].Value.(*Tuple), rows[members[j]].Value.(*Tuple), orderIdx)
+		})
+
+		p := &Partition{cols: cols, rows: make([]*Tuple, len(members)), order: orderIdx}
+		for i, m := range members {
+			p.rows[i] = rows[m].Value.(*Tuple)
+		}
+
+		res, err := w.function.Compute(p)
+		if err != nil {
+			return nil, err
+		}
+		for i, m := range members {
+			values[m] = res[i]
+		}
+	}
+
+	return values, nil
+}
+
+// less returns true if t1 comes before t2 in window order
+func (w *Window) less(t1, t2 *Tuple, orderIdx []int) bool {
+	for i, idx := range orderIdx {
+		v1, v2 := t1.values[idx], t2.values[idx]
+
+		eq, err := equal(v1, v2)
+		if err != nil || eq {
+			continue
+		}
+
+		var gt bool
+		if w.order[i].direction == DESC {
+			gt, err = greater(v1, v2)
+		} else {
+			gt, err = greater(v2, v1)
+		}
+		if err != nil {
+			return false
+		}
+		return gt
+	}
+	return false
+}
+
+// WindowNode appends the value of each window to its input rows.
+//
+// It is planned as a Sorter right above joins, so that ORDER BY, DISTINCT
+// and selectors can use window values.
+type WindowNode struct {
+	windows []*Window
+	src     Node
+}
+
+func NewWindowNode(windows ...*Window) *WindowNode {
+	return &WindowNode{windows: windows}
+}
+
+func (n WindowNode) String() string {
+	return fmt.Sprintf("Window %v", n.windows)
+}
+
+func (n *WindowNode) Exec() ([]string, []*list.Element, error) {
+	cols, res, err := n.src.Exec()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	values := make([][]any, len(n.windows))
+	outCols := make([]string, len(cols), len(cols)+len(n.windows))
+	copy(outCols, cols)
+	for i, w := range n.windows {
+		values[i], err = w.compute(cols, res)
+		if err != nil {
+			return nil, nil, err
+		}
+		outCols = append(outCols, w.name)
+	}
+
+	// do not alter source tuples, they may belong to a relation
+	l := list.New()
+	out := make([]*list.Element, len(res))
+	for i, e := range res {
+		t := e.Value.(*Tuple)
+		nt := &Tuple{values: make([]any, 0, len(t.values)+len(n.windows))}
+		nt.values = append(nt.values, t.values...)
+		for w := range n.windows {
+			nt.values = append(nt.values, values[w][i])
+		}
+		out[i] = l.PushBack(nt)
+	}
+
+	return outCols, out, nil
+}
+
+func (n *WindowNode) EstimateCardinal() int64 {
+	if n.src != nil {
+		return n.src.EstimateCardinal()
+	}
+	return 0
+}
+
+func (n *WindowNode) Children() []Node {
+	return []Node{n.src}
+}
+
+func (n *WindowNode) Priority() int {
+	return -1000
+}
+
+func (n *WindowNode) SetNode(src Node) {
+	n.src = src
+}
@@ -2,44 +2,49 @@ package executor
 
 import (
 	"fmt"
+	"reflect"
+	"strconv"
 	"strings"
-	"time"
 
 	"github.com/proullon/ramsql/engine/agnostic"
 	"github.com/proullon/ramsql/engine/parser"
 )
 
-func parseAttribute(decl *parser.Decl) (attr agnostic.Attribute, isPk bool, err error) {
-	var name, typeName string
+// parseAttribute returns the attribute declared by decl
+func (t *Tx) parseAttribute(decl *parser.Decl) (attr agnostic.Attribute, isPk bool, err error) {
+	var name string
 
 	// Attribute name
 	if decl.Token != parser.StringToken {
 		return agnostic.Attribute{}, false, fmt.Errorf("engine: expected attribute name, got %v", decl.Token)
 	}
-	name = strings.ToLower(decl.Lexeme)
+	name = decl.Lexeme
 
 	// Attribute type
 	if len(decl.Decl) < 1 {
 		return attr, false, fmt.Errorf("Attribute %s has no type", decl.Lexeme)
 	}
-	switch decl.Decl[0].Token {
-	case parser.DecimalToken:
-		typeName = "float"
-	case parser.NumberToken:
-		typeName = "int"
-	case parser.DateToken:
-		typeName = "date"
-	case parser.StringToken:
-		typeName = decl.Decl[0].Lexeme
-	default:
-		return agnostic.Attribute{}, false, fmt.Errorf("engine: expected attribute type, got %v:%v", decl.Decl[0].Token, decl.Decl[0].Lexeme)
+	typeName, err := parseTypeName(decl.Decl[0])
+	if err != nil {
+		return agnostic.Attribute{}, false, err
 	}
-
 	attr = agnostic.NewAttribute(name, typeName)
 
+	// a domain sets the type of default value
+	defaultType := typeName
+	if d, err := t.tx.Domain("", strings.ToLower(typeName)); err == nil {
+		attr = attr.WithDomain(d)
+		defaultType = d.BaseType()
+	}
+
 	// Maybe domain and special thing like primary key
+	var start *parser.Decl
 	typeDecl := decl.Decl[1:]
 	for i := range typeDecl {
+		if typeDecl[i].Token == parser.StartToken {
+			start = typeDecl[i]
+		}
+
 		if typeDecl[i].Token == parser.AutoincrementToken {
 			attr = attr.WithAutoIncrement()
 		}
@@ -47,9 +52,13 @@ func parseAttribute(decl *parser.Decl) (attr agnostic.Attribute, isPk bool, err
 		if typeDecl[i].Token == parser.DefaultToken {
 			switch typeDecl[i].Decl[0].Token {
 			case parser.LocalTimestampToken, parser.NowToken:
-				attr = attr.WithDefault(func() any { return time.Now() })
+				attr = attr.WithDefaultNow()
+			case parser.CurrentDateToken:
+				attr = attr.WithDefaultCurrentDate()
+			case parser.RandomToken:
+				attr = attr.WithDefaultRandom()
 			default:
-				v, err := agnostic.ToInstance(typeDecl[i].Decl[0].Lexeme, typeName)
+				v, err := agnostic.ToInstance(typeDecl[i].Decl[0].Lexeme, defaultType)
 				if err != nil {
 					return agnostic.Attribute{}, false, err
 				}
@@ -61,9 +70,36 @@ func parseAttribute(decl *parser.Decl) (attr agnostic.Attribute, isPk bool, err
 		if typeDecl[i].Token == parser.UniqueToken {
 			attr = attr.WithUnique()
 		}
+		if typeDecl[i].Token == parser.NotToken {
+			if len(typeDecl[i].Decl) > 0 && typeDecl[i].Decl[0].Token == parser.NullToken {
+				attr = attr.WithNotNull()
+			}
+		}
+		if typeDecl[i].Token == parser.ReferencesToken && len(typeDecl[i].Decl) > 0 {
+			ref := typeDecl[i].Decl[0]
+			var schema, attribute string
+			if d, ok := ref.Has(parser.SchemaToken); ok {
+				schema = d.Lexeme
+			}
+			if len(typeDecl[i].Decl) > 1 {
+				attribute = typeDecl[i].Decl[1].Lexeme
+			}
+			attr = attr.WithForeignKey(schema, ref.Lexeme, attribute)
+		}
+		if typeDecl[i].Token == parser.CollateToken && len(typeDecl[i].Decl) > 0 {
+			c, err := agnostic.NewCollation(typeDecl[i].Decl[0].Lexeme)
+			if err != nil {
+				return agnostic.Attribute{}, false, err
+			}
+			if attr.ScanType().Kind() != reflect.String {
+				return agnostic.Attribute{}, false, agnostic.NewError(agnostic.DatatypeMismatch, "collations are not supported by type %s", typeName)
+			}
+			attr = attr.WithCollation(c)
+		}
 		if typeDecl[i].Token == parser.PrimaryToken {
 			if len(typeDecl[i].Decl) > 0 && typeDecl[i].Decl[0].Token == parser.KeyToken {
 				isPk = true
+				attr = attr.WithNotNull()
 			}
 		}
 
@@ -73,5 +109,46 @@ func parseAttribute(decl *parser.Decl) (attr agnostic.Attribute, isPk bool, err
 		attr = attr.WithAutoIncrement()
 	}
 
+	if start != nil {
+		if !attr.HasAutoIncrement() {
+			return agnostic.Attribute{}, false, fmt.Errorf("START WITH requires attribute %s to be auto-incremented", name)
+		}
+		v, err := strconv.ParseUint(start.Decl[0].Lexeme, 10, 64)
+		if err != nil {
+			return agnostic.Attribute{}, false, err
+		}
+		attr = attr.WithStartValue(v)
+	}
+
 	return attr, isPk, nil
 }
+
+// parseTypeName returns the name of type declared by decl
+func parseTypeName(decl *parser.Decl) (string, error) {
+	var typeName string
+	switch decl.Token {
+	case parser.DecimalToken:
+		typeName = "float"
+	case parser.NumberToken:
+		typeName = "int"
+	case parser.DateToken:
+		typeName = "date"
+	case parser.StringToken:
+		typeName = decl.Lexeme
+		if _, ok := decl.Has(parser.WithToken); ok && strings.EqualFold(typeName, "timestamp") {
+			typeName = "timestamptz"
+		}
+	default:
+		return "", fmt.Errorf("engine: expected attribute type, got %v:%v", decl.Token, decl.Lexeme)
+	}
+	if strings.HasSuffix(decl.Lexeme, "[]") && !strings.HasSuffix(typeName, "[]") {
+		typeName += "[]"
+	}
+	if elemType, ok := agnostic.ArrayElemType(typeName); ok {
+		if _, err := agnostic.NewArray(elemType); err != nil {
+			return "", err
+		}
+	}
+
+	return typeName, nil
+}
@@ -1,13 +1,18 @@
 package executor
 
 import (
+	"bufio"
 	"context"
 	"database/sql"
-	"errors"
 	"fmt"
+	"io"
+	"os"
+	"path/filepath"
 	"reflect"
 	"strconv"
 	"strings"
+	"sync/atomic"
+	"time"
 
 	"github.com/proullon/ramsql/engine/agnostic"
 	"github.com/proullon/ramsql/engine/log"
@@ -17,6 +22,8 @@ import (
 // Engine is the root struct of RamSQL server
 type Engine struct {
 	memstore *agnostic.Engine
+	// stopped is set by Stop
+	stopped atomic.Bool
 }
 
 // New initialize a new RamSQL server
@@ -39,6 +46,116 @@ func (e *Engine) Begin() (*Tx, error) {
 }
 
 func (e *Engine) Stop() {
+	e.stopped.Store(true)
+	if err := e.memstore.CloseWAL(); err != nil {
+		log.Warn("cannot close write-ahead log: %s", err)
+	}
+}
+
+// Ping returns an error if engine was stopped, if its write-ahead log failed,
+// or if ctx is done
+func (e *Engine) Ping(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if e.stopped.Load() {
+		return fmt.Errorf("database is stopped")
+	}
+	if err := e.memstore.Err(); err != nil {
+		return fmt.Errorf("write-ahead log failed: %w", err)
+	}
+	return nil
+}
+
+// SetClock makes the database read current time from clock. A nil clock
+// restores the real clock.
+func (e *Engine) SetClock(clock func() time.Time) {
+	e.memstore.SetClock(clock)
+}
+
+// SetMaxRows limits the number of rows of each relation of the database to
+// n, 0 removing the limit
+func (e *Engine) SetMaxRows(n int64) {
+	e.memstore.SetMaxRows(n)
+}
+
+// Reset drops every schema, relation and sequence of the database
+func (e *Engine) Reset() error {
+	return e.memstore.Reset()
+}
+
+// Clone returns an independent copy of the database
+func (e *Engine) Clone() (*Engine, error) {
+	m, err := e.memstore.Clone()
+	if err != nil {
+		return nil, err
+	}
+
+	return &Engine{memstore: m}, nil
+}
+
+// Replace replaces the content of the database with a copy of src
+func (e *Engine) Replace(src *Engine) error {
+	return e.memstore.Replace(src.memstore)
+}
+
+// OpenWAL replays the write-ahead log at path, then logs every committed
+// transaction to it
+func (e *Engine) OpenWAL(path string) error {
+	if err := e.memstore.OpenWAL(path); err != nil {
+		return err
+	}
+	return e.compileDomains()
+}
+
+// SaveTo writes the state of the database to file at path, to be loaded
+// back with LoadEngine. File is replaced atomically.
+func (e *Engine) SaveTo(path string) error {
+	f, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	w := bufio.NewWriter(f)
+	if err := e.memstore.Save(w); err != nil {
+		f.Close()
+		return err
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(f.Name(), path)
+}
+
+// LoadEngine returns a database loaded from file at path, written by SaveTo
+func LoadEngine(path string) (*Engine, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	m, err := agnostic.Load(bufio.NewReader(f))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	e := &Engine{memstore: m}
+	if err := e.compileDomains(); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return e, nil
+}
+
+// Dump writes to w the SQL statements rebuilding the current state of the database
+func (e *Engine) Dump(w io.Writer) error {
+	return e.memstore.Dump(w)
 }
 
 func createExecutor(t *Tx, decl *parser.Decl, args []NamedValue) (int64, int64, []string, []*agnostic.Tuple, error) {
@@ -63,9 +180,21 @@ func dropExecutor(t *Tx, decl *parser.Decl, args []NamedValue) (int64, int64, []
 	if _, ok := decl.Has(parser.TableToken); ok {
 		return dropTable(t, decl.Decl[0], args)
 	}
+	if _, ok := decl.Has(parser.IndexToken); ok {
+		return dropIndex(t, decl.Decl[0], args)
+	}
+	if _, ok := decl.Has(parser.SequenceToken); ok {
+		return dropSequence(t, decl.Decl[0], args)
+	}
 	if _, ok := decl.Has(parser.SchemaToken); ok {
 		return dropSchema(t, decl.Decl[0], args)
 	}
+	if _, ok := decl.Has(parser.TypeToken); ok {
+		return dropType(t, decl.Decl[0], args)
+	}
+	if _, ok := decl.Has(parser.DomainToken); ok {
+		return dropDomain(t, decl.Decl[0], args)
+	}
 
 	return 0, 0, nil, nil, NotImplemented
 }
@@ -83,7 +212,7 @@ func dropTable(t *Tx, decl *parser.Decl, args []NamedValue) (int64, int64, []str
 		rDecl = decl.Decl[1]
 	}
 
-	schema := agnostic.DefaultSchema
+	schema := ""
 	if d, ok := rDecl.Has(parser.SchemaToken); ok {
 		schema = d.Lexeme
 	}
@@ -94,10 +223,18 @@ func dropTable(t *Tx, decl *parser.Decl, args []NamedValue) (int64, int64, []str
 		return 0, 0, nil, nil, nil
 	}
 	if !exists {
-		return 0, 0, nil, nil, fmt.Errorf("relation %s.%s does not exist", schema, relation)
+		if schema == "" {
+			schema = t.currentSchema()
+		}
+		return 0, 0, nil, nil, agnostic.NewError(agnostic.UndefinedTable, "relation %s.%s does not exist", schema, relation).On(relation, "")
+	}
+
+	cascade := false
+	if last := decl.Decl[len(decl.Decl)-1]; last.Token == parser.StringToken && last.Lexeme == "cascade" {
+		cascade = true
 	}
 
-	err := t.tx.DropRelation(schema, relation)
+	err := t.tx.DropRelation(schema, relation, cascade)
 	if err != nil {
 		return 0, 0, nil, nil, err
 	}
@@ -123,6 +260,17 @@ func dropSchema(t *Tx, decl *parser.Decl, args []NamedValue) (int64, int64, []st
 		return 0, 0, nil, nil, nil
 	}
 
+	// schema is dropped with all its relations unless RESTRICT is given
+	if last := decl.Decl[len(decl.Decl)-1]; last.Token == parser.StringToken && last.Lexeme == "restrict" {
+		_, res, err := t.tx.ShowTables(schema)
+		if err != nil {
+			return 0, 0, nil, nil, err
+		}
+		if len(res) > 0 {
+			return 0, 0, nil, nil, fmt.Errorf("cannot drop schema %s because other objects depend on it", schema)
+		}
+	}
+
 	err := t.tx.DropSchema(schema)
 	if err != nil {
 		return 0, 0, nil, nil, err
@@ -131,6 +279,124 @@ func dropSchema(t *Tx, decl *parser.Decl, args []NamedValue) (int64, int64, []st
 	return 0, 1, nil, nil, nil
 }
 
+func dropIndex(t *Tx, decl *parser.Decl, args []NamedValue) (int64, int64, []string, []*agnostic.Tuple, error) {
+	if len(decl.Decl) == 0 {
+		return 0, 1, nil, nil, ParsingError
+	}
+
+	// Check if 'IF EXISTS' is present
+	ifExists := hasIfExists(decl)
+
+	var schema string
+	iDecl := decl.Decl[0]
+	if ifExists {
+		iDecl = decl.Decl[1]
+	}
+	if len(iDecl.Decl) > 0 {
+		schema = iDecl.Decl[0].Lexeme
+	}
+
+	if ifExists && !t.tx.CheckIndex(schema, "", iDecl.Lexeme) {
+		return 0, 0, nil, nil, nil
+	}
+
+	err := t.tx.DropIndex(schema, iDecl.Lexeme)
+	if err != nil {
+		return 0, 0, nil, nil, err
+	}
+
+	return 0, 1, nil, nil, nil
+}
+
+func dropSequence(t *Tx, decl *parser.Decl, args []NamedValue) (int64, int64, []string, []*agnostic.Tuple, error) {
+	if len(decl.Decl) == 0 {
+		return 0, 1, nil, nil, ParsingError
+	}
+
+	// Check if 'IF EXISTS' is present
+	ifExists := hasIfExists(decl)
+
+	var schema string
+	rDecl := decl.Decl[0]
+	if ifExists {
+		rDecl = decl.Decl[1]
+	}
+	if len(rDecl.Decl) > 0 {
+		schema = rDecl.Decl[0].Lexeme
+	}
+
+	if ifExists && !t.tx.CheckSequence(schema, rDecl.Lexeme) {
+		return 0, 0, nil, nil, nil
+	}
+
+	err := t.tx.DropSequence(schema, rDecl.Lexeme)
+	if err != nil {
+		return 0, 0, nil, nil, err
+	}
+
+	return 0, 1, nil, nil, nil
+}
+
+func dropType(t *Tx, decl *parser.Decl, args []NamedValue) (int64, int64, []string, []*agnostic.Tuple, error) {
+	if len(decl.Decl) == 0 {
+		return 0, 1, nil, nil, ParsingError
+	}
+
+	// Check if 'IF EXISTS' is present
+	ifExists := hasIfExists(decl)
+
+	var schema string
+	tDecl := decl.Decl[0]
+	if ifExists {
+		tDecl = decl.Decl[1]
+	}
+	if len(tDecl.Decl) > 0 {
+		schema = tDecl.Decl[0].Lexeme
+	}
+	name := strings.ToLower(tDecl.Lexeme)
+
+	if ifExists && !t.tx.CheckEnum(schema, name) {
+		return 0, 0, nil, nil, nil
+	}
+
+	err := t.tx.DropEnum(schema, name)
+	if err != nil {
+		return 0, 0, nil, nil, err
+	}
+
+	return 0, 1, nil, nil, nil
+}
+
+func dropDomain(t *Tx, decl *parser.Decl, args []NamedValue) (int64, int64, []string, []*agnostic.Tuple, error) {
+	if len(decl.Decl) == 0 {
+		return 0, 1, nil, nil, ParsingError
+	}
+
+	// Check if 'IF EXISTS' is present
+	ifExists := hasIfExists(decl)
+
+	var schema string
+	dDecl := decl.Decl[0]
+	if ifExists {
+		dDecl = decl.Decl[1]
+	}
+	if len(dDecl.Decl) > 0 {
+		schema = dDecl.Decl[0].Lexeme
+	}
+	name := strings.ToLower(dDecl.Lexeme)
+
+	if ifExists && !t.tx.CheckDomain(schema, name) {
+		return 0, 0, nil, nil, nil
+	}
+
+	err := t.tx.DropDomain(schema, name)
+	if err != nil {
+		return 0, 0, nil, nil, err
+	}
+
+	return 0, 1, nil, nil, nil
+}
+
 func grantExecutor(*Tx, *parser.Decl, []NamedValue) (int64, int64, []string, []*agnostic.Tuple, error) {
 	return 0, 1, nil, nil, nil
 }
@@ -157,6 +423,190 @@ func createSchemaExecutor(t *Tx, tableDecl *parser.Decl, args []NamedValue) (int
 	return 0, 0, nil, nil, nil
 }
 
+func createTypeExecutor(t *Tx, typeDecl *parser.Decl, args []NamedValue) (int64, int64, []string, []*agnostic.Tuple, error) {
+	if len(typeDecl.Decl) < 2 {
+		return 0, 0, nil, nil, ParsingError
+	}
+
+	var schema string
+	nameDecl, enumDecl := typeDecl.Decl[0], typeDecl.Decl[1]
+	if len(nameDecl.Decl) > 0 {
+		schema = nameDecl.Decl[0].Lexeme
+	}
+
+	labels := make([]string, len(enumDecl.Decl))
+	for i, d := range enumDecl.Decl {
+		labels[i] = d.Lexeme
+	}
+
+	err := t.tx.CreateEnum(schema, strings.ToLower(nameDecl.Lexeme), labels)
+	if err != nil {
+		return 0, 0, nil, nil, err
+	}
+
+	return 0, 1, nil, nil, nil
+}
+
+func createDomainExecutor(t *Tx, domainDecl *parser.Decl, args []NamedValue) (int64, int64, []string, []*agnostic.Tuple, error) {
+	if len(domainDecl.Decl) < 2 {
+		return 0, 0, nil, nil, ParsingError
+	}
+
+	var schema string
+	nameDecl := domainDecl.Decl[0]
+	if len(nameDecl.Decl) > 0 {
+		schema = nameDecl.Decl[0].Lexeme
+	}
+	baseType, err := parseTypeName(domainDecl.Decl[1])
+	if err != nil {
+		return 0, 0, nil, nil, err
+	}
+
+	d, err := agnostic.NewDomain(strings.ToLower(nameDecl.Lexeme), strings.ToLower(baseType))
+	if err != nil {
+		return 0, 0, nil, nil, err
+	}
+	for _, c := range domainDecl.Decl[2:] {
+		switch c.Token {
+		case parser.DefaultToken:
+			switch c.Decl[0].Token {
+			case parser.LocalTimestampToken, parser.NowToken, parser.CurrentDateToken, parser.RandomToken:
+				return 0, 0, nil, nil, fmt.Errorf("default value of domain %s must be a constant", d)
+			}
+			v, err := agnostic.ToInstance(c.Decl[0].Lexeme, d.BaseType())
+			if err != nil {
+				return 0, 0, nil, nil, err
+			}
+			d = d.WithDefault(v)
+		case parser.NotToken:
+			d = d.WithNotNull()
+		case parser.CheckToken:
+			p, err := t.compileCheck(d, c)
+			if err != nil {
+				return 0, 0, nil, nil, err
+			}
+			d = d.WithCheck(c.Lexeme, p)
+		}
+	}
+
+	err = t.tx.CreateDomain(schema, d)
+	if err != nil {
+		return 0, 0, nil, nil, err
+	}
+
+	return 0, 1, nil, nil, nil
+}
+
+// compileCheck returns the predicate of domain check decl, evaluated with
+// the value as attribute "value" of a relation materialized until the end
+// of statement
+func (t *Tx) compileCheck(d *agnostic.Domain, checkDecl *parser.Decl) (agnostic.Predicate, error) {
+	if hasSubquery(checkDecl) {
+		return nil, fmt.Errorf("cannot use subquery in check constraint of domain %s", d)
+	}
+
+	rel := fmt.Sprintf("%s#%p", d.Name(), d)
+	attributes := []agnostic.Attribute{agnostic.NewAttribute("value", d.BaseType())}
+	if err := t.tx.Materialize(rel, attributes, nil); err != nil {
+		return nil, err
+	}
+
+	return t.getPredicates(checkDecl.Decl, "", rel, nil, nil)
+}
+
+// hasSubquery returns true if decl holds a subquery
+func hasSubquery(decl *parser.Decl) bool {
+	if decl.Token == parser.SelectToken {
+		return true
+	}
+	for _, d := range decl.Decl {
+		if hasSubquery(d) {
+			return true
+		}
+	}
+	return false
+}
+
+// compileDomains compiles the check constraints of domains loaded from file
+// or from write-ahead log, which are saved as SQL
+func (e *Engine) compileDomains() error {
+	t, err := NewTx(context.Background(), e, sql.TxOptions{})
+	if err != nil {
+		return err
+	}
+	defer t.Rollback()
+
+	for _, d := range e.memstore.Domains() {
+		if d.CheckExpr() == "" || d.Check() != nil {
+			continue
+		}
+
+		q := fmt.Sprintf("CREATE DOMAIN d AS %s CHECK (%s)", d.BaseType(), d.CheckExpr())
+		instructions, err := parser.ParseInstruction(q)
+		if err != nil {
+			return fmt.Errorf("cannot compile check constraint of domain %s: %w", d, err)
+		}
+		checkDecl, ok := instructions[0].Decls[0].Decl[0].Has(parser.CheckToken)
+		if !ok {
+			return fmt.Errorf("cannot compile check constraint of domain %s", d)
+		}
+		p, err := t.compileCheck(d, checkDecl)
+		if err != nil {
+			return fmt.Errorf("cannot compile check constraint of domain %s: %w", d, err)
+		}
+		d.WithCheck(d.CheckExpr(), p)
+	}
+
+	return nil
+}
+
+func createSequenceExecutor(t *Tx, seqDecl *parser.Decl, args []NamedValue) (int64, int64, []string, []*agnostic.Tuple, error) {
+	var schema string
+	var start, increment int64 = 1, 1
+	var err error
+
+	if len(seqDecl.Decl) == 0 {
+		return 0, 0, nil, nil, ParsingError
+	}
+
+	// Check if 'IF NOT EXISTS' is present
+	ifNotExists := hasIfNotExists(seqDecl)
+
+	for _, d := range seqDecl.Decl {
+		switch d.Token {
+		case parser.IfToken:
+			continue
+		case parser.StartToken:
+			start, err = strconv.ParseInt(d.Decl[0].Lexeme, 10, 64)
+		case parser.IncrementToken:
+			increment, err = strconv.ParseInt(d.Decl[0].Lexeme, 10, 64)
+		default:
+			if sd, ok := d.Has(parser.SchemaToken); ok {
+				schema = sd.Lexeme
+			}
+		}
+		if err != nil {
+			return 0, 0, nil, nil, err
+		}
+	}
+
+	name := seqDecl.Decl[0].Lexeme
+	if ifNotExists {
+		name = seqDecl.Decl[1].Lexeme
+	}
+
+	if ifNotExists && t.tx.CheckSequence(schema, name) {
+		return 0, 0, nil, nil, nil
+	}
+
+	err = t.tx.CreateSequence(schema, name, start, increment)
+	if err != nil {
+		return 0, 0, nil, nil, err
+	}
+
+	return 0, 1, nil, nil, nil
+}
+
 func createTableExecutor(t *Tx, tableDecl *parser.Decl, args []NamedValue) (int64, int64, []string, []*agnostic.Tuple, error) {
 	var i int
 	var schemaName string
@@ -183,7 +633,8 @@ func createTableExecutor(t *Tx, tableDecl *parser.Decl, args []NamedValue) (int6
 		i++
 	}
 
-	if d, ok := tableDecl.Has(parser.SchemaToken); ok {
+	// schema of created relation, not of a relation referenced by a foreign key
+	if d, ok := tableDecl.Decl[i].Has(parser.SchemaToken); ok {
 		schemaName = d.Lexeme
 	}
 
@@ -197,7 +648,12 @@ func createTableExecutor(t *Tx, tableDecl *parser.Decl, args []NamedValue) (int6
 		return 0, 0, nil, nil, nil
 	}
 	if exists {
-		return 0, 0, nil, nil, errors.New("relation already exists")
+		return 0, 0, nil, nil, agnostic.NewError(agnostic.DuplicateTable, "relation already exists").On(relationName, "")
+	}
+
+	// CREATE TABLE name AS SELECT ...
+	if i+1 < len(tableDecl.Decl) && tableDecl.Decl[i+1].Token == parser.AsToken {
+		return createTableAsExecutor(t, schemaName, relationName, tableDecl.Decl[i+1], args)
 	}
 
 	var pk []string
@@ -209,7 +665,7 @@ func createTableExecutor(t *Tx, tableDecl *parser.Decl, args []NamedValue) (int6
 		if tableDecl.Decl[i].Token != parser.StringToken {
 			break
 		}
-		attr, isPk, err := parseAttribute(tableDecl.Decl[i])
+		attr, isPk, err := t.parseAttribute(tableDecl.Decl[i])
 		if err != nil {
 			return 0, 0, nil, nil, err
 		}
@@ -234,10 +690,306 @@ func createTableExecutor(t *Tx, tableDecl *parser.Decl, args []NamedValue) (int6
 	return 0, 1, nil, nil, nil
 }
 
-/*
-|-> INSERT
-
-	|-> INTO
+// createTableAsExecutor creates a relation from the columns of a SELECT
+// statement, then inserts its result. Created relation has no constraint.
+func createTableAsExecutor(t *Tx, schemaName, relationName string, asDecl *parser.Decl, args []NamedValue) (int64, int64, []string, []*agnostic.Tuple, error) {
+	attributes, res, err := t.queryAs("CREATE TABLE AS", asDecl, args)
+	if err != nil {
+		return 0, 0, nil, nil, err
+	}
+
+	err = t.tx.CreateRelation(schemaName, relationName, attributes, nil)
+	if err != nil {
+		return 0, 0, nil, nil, err
+	}
+
+	for _, tuple := range res {
+		values := make(map[string]any, len(attributes))
+		for j, v := range tuple.Values() {
+			values[attributes[j].Name()] = v
+		}
+		if _, err := t.tx.Insert(schemaName, relationName, values); err != nil {
+			return 0, 0, nil, nil, err
+		}
+	}
+
+	return 0, int64(len(res)), nil, nil, nil
+}
+
+// inferAttributes returns the attributes of a relation holding given result.
+//
+// A column selecting a relation attribute gets its type, serial types being
+// replaced by their integer type. Type of computed columns is inferred from
+// their first non-NULL value, text being used if there is none.
+// queryAs executes the query of an AS clause, as in CREATE TABLE AS and WITH,
+// and returns its rows with the attributes inferred from the query. Column
+// names may be specified after the query decl.
+func (t *Tx) queryAs(clause string, asDecl *parser.Decl, args []NamedValue) ([]agnostic.Attribute, []*agnostic.Tuple, error) {
+	if len(asDecl.Decl) < 1 {
+		return nil, nil, ParsingError
+	}
+
+	_, _, cols, res, err := queryExecutor(t, asDecl.Decl[0], args)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if names := asDecl.Decl[1:]; len(names) > 0 {
+		if len(names) > len(cols) {
+			return nil, nil, fmt.Errorf("%s specifies %d column names but SELECT returns %d", clause, len(names), len(cols))
+		}
+		for j, n := range names {
+			cols[j] = n.Lexeme
+		}
+	}
+
+	attributes, err := inferAttributes(cols, t.columnAttrs, res)
+	if err != nil {
+		return nil, nil, err
+	}
+	t.columnAttrs = nil
+
+	return attributes, res, nil
+}
+
+// withExecutor materializes common table expressions in order, so each one
+// can reference the previous ones, then executes the statement. Common table
+// expressions are computed once, however many times they are referenced.
+// With RECURSIVE, an expression can reference itself in the second arm of a
+// UNION.
+func withExecutor(t *Tx, withDecl *parser.Decl, args []NamedValue) (int64, int64, []string, []*agnostic.Tuple, error) {
+	if len(withDecl.Decl) < 2 {
+		return 0, 0, nil, nil, ParsingError
+	}
+	defer t.tx.Release()
+
+	ctes, stmt := withDecl.Decl[:len(withDecl.Decl)-1], withDecl.Decl[len(withDecl.Decl)-1]
+	var recursive bool
+	if ctes[0].Token == parser.RecursiveToken {
+		recursive = true
+		ctes = ctes[1:]
+	}
+	for _, cte := range ctes {
+		asDecl, ok := cte.Has(parser.AsToken)
+		if !ok || len(asDecl.Decl) < 1 {
+			return 0, 0, nil, nil, ParsingError
+		}
+
+		if recursive && asDecl.Decl[0].Token == parser.UnionToken && references(asDecl.Decl[0], cte.Lexeme) {
+			if err := t.materializeRecursive(cte.Lexeme, asDecl, args); err != nil {
+				return 0, 0, nil, nil, err
+			}
+			continue
+		}
+
+		attributes, res, err := t.queryAs("WITH "+cte.Lexeme, asDecl, args)
+		if err != nil {
+			return 0, 0, nil, nil, err
+		}
+
+		if err := t.tx.Materialize(cte.Lexeme, attributes, res); err != nil {
+			return 0, 0, nil, nil, err
+		}
+	}
+
+	executor, ok := t.opsExecutors[stmt.Token]
+	if !ok {
+		return 0, 0, nil, nil, NotImplemented
+	}
+	return executor(t, stmt, args)
+}
+
+// materializeRecursive materializes a recursive common table expression of
+// the form seed UNION [ALL] recursive_term. Seed is executed once, then the
+// recursive term is executed against rows added by previous iteration until
+// it yields no new row.
+func (t *Tx) materializeRecursive(name string, asDecl *parser.Decl, args []NamedValue) error {
+	var arms []*parser.Decl
+	var all bool
+	for _, d := range asDecl.Decl[0].Decl {
+		switch {
+		case d.Token == parser.AllToken:
+			all = true
+		case isQuery(d):
+			arms = append(arms, d)
+		}
+	}
+	if len(arms) != 2 {
+		return ParsingError
+	}
+	if references(arms[0], name) {
+		return fmt.Errorf("recursive reference to %s must not appear within its non-recursive term", name)
+	}
+
+	seedDecl := &parser.Decl{Token: asDecl.Token, Lexeme: asDecl.Lexeme, Decl: append([]*parser.Decl{arms[0]}, asDecl.Decl[1:]...)}
+	attributes, seed, err := t.queryAs("WITH "+name, seedDecl, args)
+	if err != nil {
+		return err
+	}
+
+	return t.tx.MaterializeRecursive(name, attributes, seed, all, func() ([]*agnostic.Tuple, error) {
+		_, _, _, res, err := queryExecutor(t, arms[1], args)
+		t.columnAttrs = nil
+		return res, err
+	})
+}
+
+// references returns true if decl, or any of its subqueries, reads relation name.
+func references(decl *parser.Decl, name string) bool {
+	switch decl.Token {
+	case parser.FromToken:
+		for _, d := range decl.Decl {
+			if d.Lexeme == name {
+				return true
+			}
+		}
+	case parser.JoinToken:
+		if len(decl.Decl) > 0 && decl.Decl[0].Lexeme == name {
+			return true
+		}
+	}
+
+	for _, d := range decl.Decl {
+		if references(d, name) {
+			return true
+		}
+	}
+	return false
+}
+
+func inferAttributes(cols []string, attrs []*agnostic.Attribute, res []*agnostic.Tuple) ([]agnostic.Attribute, error) {
+	attributes := make([]agnostic.Attribute, len(cols))
+	names := make(map[string]bool, len(cols))
+
+	for j, col := range cols {
+		// computed columns like COUNT(*) are named after their function
+		name := col
+		if idx := strings.Index(name, "("); idx != -1 {
+			name = strings.ToLower(name[:idx])
+		}
+		if idx := strings.LastIndex(name, "."); idx != -1 {
+			name = name[idx+1:]
+		}
+		if names[name] {
+			return nil, fmt.Errorf("column %s specified more than once", name)
+		}
+		names[name] = true
+
+		var typeName string
+		if j < len(attrs) && attrs[j] != nil {
+			typeName = strings.ToLower(attrs[j].TypeName())
+			if d := attrs[j].Domain(); d != nil {
+				typeName = d.BaseType()
+			}
+			switch typeName {
+			case "serial":
+				typeName = "int"
+			case "bigserial":
+				typeName = "bigint"
+			}
+		} else {
+			typeName = "text"
+			for _, tuple := range res {
+				if v := tuple.Values()[j]; v != nil {
+					typeName = typeNameOf(v)
+					break
+				}
+			}
+		}
+
+		attributes[j] = agnostic.NewAttribute(name, typeName)
+	}
+
+	return attributes, nil
+}
+
+// typeNameOf returns the name of the attribute type holding v
+func typeNameOf(v any) string {
+	switch v.(type) {
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
+		return "bigint"
+	case float32, float64:
+		return "float"
+	case bool:
+		return "boolean"
+	case time.Time:
+		return "timestamp"
+	default:
+		return "text"
+	}
+}
+
+/*
+|-> ALTER
+
+	|-> TABLE
+		|-> account
+	|-> ADD
+		|-> active
+			|-> boolean
+*/
+func alterExecutor(t *Tx, alterDecl *parser.Decl, args []NamedValue) (int64, int64, []string, []*agnostic.Tuple, error) {
+	var schemaName string
+
+	if len(alterDecl.Decl) < 2 || len(alterDecl.Decl[0].Decl) < 1 {
+		return 0, 0, nil, nil, ParsingError
+	}
+
+	nameDecl := alterDecl.Decl[0].Decl[0]
+	if d, ok := nameDecl.Has(parser.SchemaToken); ok {
+		schemaName = d.Lexeme
+	}
+	relationName := nameDecl.Lexeme
+
+	actionDecl := alterDecl.Decl[1]
+	switch actionDecl.Token {
+	case parser.AddToken:
+		if len(actionDecl.Decl) < 1 {
+			return 0, 0, nil, nil, ParsingError
+		}
+		attr, isPk, err := t.parseAttribute(actionDecl.Decl[0])
+		if err != nil {
+			return 0, 0, nil, nil, err
+		}
+		if isPk {
+			return 0, 0, nil, nil, fmt.Errorf("cannot add primary key attribute %s to relation %s", attr.Name(), relationName)
+		}
+		err = t.tx.AddAttribute(schemaName, relationName, attr)
+		if err != nil {
+			return 0, 0, nil, nil, err
+		}
+	case parser.DropToken:
+		if len(actionDecl.Decl) < 1 {
+			return 0, 0, nil, nil, ParsingError
+		}
+		err := t.tx.DropAttribute(schemaName, relationName, actionDecl.Decl[0].Lexeme)
+		if err != nil {
+			return 0, 0, nil, nil, err
+		}
+	case parser.RenameToken:
+		var err error
+		switch len(actionDecl.Decl) {
+		case 1:
+			err = t.tx.RenameRelation(schemaName, relationName, actionDecl.Decl[0].Lexeme)
+		case 2:
+			err = t.tx.RenameAttribute(schemaName, relationName, actionDecl.Decl[0].Lexeme, actionDecl.Decl[1].Lexeme)
+		default:
+			return 0, 0, nil, nil, ParsingError
+		}
+		if err != nil {
+			return 0, 0, nil, nil, err
+		}
+	default:
+		return 0, 0, nil, nil, ParsingError
+	}
+
+	return 0, 1, nil, nil, nil
+}
+
+/*
+|-> INSERT
+
+	|-> INTO
 	    |-> user
 	        |-> last_name
 	        |-> first_name
@@ -254,25 +1006,8 @@ func insertIntoTableExecutor(t *Tx, insertDecl *parser.Decl, args []NamedValue)
 
 	var lastInsertedID int64
 	var schemaName string
-	var returningAttrs []string
-	var returningIdx []int
 	relationName := insertDecl.Decl[0].Decl[0].Lexeme
 
-	// Check for RETURNING clause
-	if len(insertDecl.Decl) > 2 {
-		for i := range insertDecl.Decl {
-			if insertDecl.Decl[i].Token == parser.ReturningToken {
-				returningDecl := insertDecl.Decl[i]
-				returningAttrs = append(returningAttrs, returningDecl.Decl[0].Lexeme)
-				idx, _, err := t.tx.RelationAttribute(schemaName, relationName, returningDecl.Decl[0].Lexeme)
-				if err != nil {
-					return 0, 0, nil, nil, fmt.Errorf("cannot return %s, doesn't exist in relation %s", returningDecl.Decl[0].Lexeme, relationName)
-				}
-				returningIdx = append(returningIdx, idx)
-			}
-		}
-	}
-
 	var specifiedAttrs []string
 	for _, d := range insertDecl.Decl[0].Decl[0].Decl {
 		if d.Token == parser.SchemaToken {
@@ -282,28 +1017,67 @@ func insertIntoTableExecutor(t *Tx, insertDecl *parser.Decl, args []NamedValue)
 		specifiedAttrs = append(specifiedAttrs, d.Lexeme)
 	}
 
-	var tuples []*agnostic.Tuple
-	valuesDecl := insertDecl.Decl[1]
-	for _, valueListDecl := range valuesDecl.Decl {
-		values, err := getValues(specifiedAttrs, valueListDecl, args)
+	// Check for RETURNING clause
+	returningAttrs, returningIdx, err := t.getReturning(schemaName, relationName, insertDecl)
+	if err != nil {
+		return 0, 0, nil, nil, err
+	}
+
+	// without column list, all relation attributes are targeted
+	targets, err := t.getInsertTargets(schemaName, relationName, specifiedAttrs)
+	if err != nil {
+		return 0, 0, nil, nil, err
+	}
+
+	// Values of all rows are evaluated before the first insertion. Then a row
+	// failing a constraint aborts the transaction, so no row of the statement is kept.
+	var rows []map[string]any
+	if selectDecl := insertDecl.Decl[len(insertDecl.Decl)-1]; isQuery(selectDecl) {
+		rows, err = t.getSelectValues(targets, selectDecl, args)
 		if err != nil {
 			return 0, 0, nil, nil, err
 		}
-		tuple, err := t.tx.Insert(schemaName, relationName, values)
+	} else {
+		valuesDecl := insertDecl.Decl[1]
+		for _, valueListDecl := range valuesDecl.Decl {
+			if len(valueListDecl.Decl) != len(targets) {
+				return 0, 0, nil, nil, fmt.Errorf("INSERT has %d target columns but %d values", len(targets), len(valueListDecl.Decl))
+			}
+			values, err := t.getValues(schemaName, targets, valueListDecl, args)
+			if err != nil {
+				return 0, 0, nil, nil, err
+			}
+			rows = append(rows, values)
+		}
+	}
+
+	var action *agnostic.ConflictAction
+	if conflictDecl, ok := insertDecl.Has(parser.ConflictToken); ok {
+		action, err = t.getConflictAction(schemaName, relationName, conflictDecl, args)
 		if err != nil {
 			return 0, 0, nil, nil, err
 		}
-		returningTuple := agnostic.NewTuple()
-		for _, idx := range returningIdx {
-			returningTuple.Append(tuple.Values()[idx])
+	}
+
+	var tuples []*agnostic.Tuple
+	for _, values := range rows {
+		var tuple *agnostic.Tuple
+		if action != nil {
+			tuple, err = t.tx.Upsert(schemaName, relationName, values, *action)
+		} else {
+			tuple, err = t.tx.Insert(schemaName, relationName, values)
+		}
+		if err != nil {
+			return 0, 0, nil, nil, err
 		}
-		tuples = append(tuples, returningTuple)
+		// row skipped with ON CONFLICT DO NOTHING
+		if tuple == nil {
+			continue
+		}
+		tuples = append(tuples, project(tuple, returningIdx))
 
-		// guess lastInsertedID
-		if v := tuple.Values(); len(v) > 0 {
-			if reflect.TypeOf(v[0]).ConvertibleTo(reflect.TypeOf(lastInsertedID)) {
-				lastInsertedID = reflect.ValueOf(v[0]).Convert(reflect.TypeOf(lastInsertedID)).Int()
-			}
+		if id, ok := t.tx.LastInsertID(); ok {
+			lastInsertedID = id
 		}
 	}
 
@@ -314,11 +1088,130 @@ func insertIntoTableExecutor(t *Tx, insertDecl *parser.Decl, args []NamedValue)
 	return lastInsertedID, int64(len(tuples)), returningAttrs, tuples, nil
 }
 
-func getValues(specifiedAttrs []string, valuesDecl *parser.Decl, args []NamedValue) (map[string]any, error) {
+// getConflictAction builds the action taken by an INSERT ... ON CONFLICT
+// statement when a row collides with an existing one.
+//
+// Values of DO UPDATE SET clause may reference the row proposed for insertion
+// with EXCLUDED.column.
+func (t *Tx) getConflictAction(schema, relation string, conflictDecl *parser.Decl, args []NamedValue) (*agnostic.ConflictAction, error) {
+	action := &agnostic.ConflictAction{}
+
+	for _, d := range conflictDecl.Decl {
+		switch d.Token {
+		case parser.NothingToken:
+			return action, nil
+		case parser.UpdateToken:
+		default:
+			action.Attributes = append(action.Attributes, d.Lexeme)
+			continue
+		}
+
+		set := make(map[string]any)
+		excluded := make(map[string]int)
+		for _, attrDecl := range d.Decl {
+			if len(attrDecl.Decl) < 2 {
+				return nil, ParsingError
+			}
+			valueDecl := attrDecl.Decl[1]
+			// EXCLUDED.column is parsed as an attribute with its table as child
+			if len(valueDecl.Decl) == 0 {
+				if valueDecl.Token == parser.NullToken {
+					set[attrDecl.Lexeme] = nil
+					continue
+				}
+				if _, err := getSet(nil, set, attrDecl, args); err != nil {
+					return nil, err
+				}
+				continue
+			}
+			ref := valueDecl.Decl[0]
+			if !strings.EqualFold(ref.Lexeme, "excluded") {
+				return nil, fmt.Errorf("cannot reference %s.%s in ON CONFLICT DO UPDATE, only EXCLUDED is allowed", ref.Lexeme, valueDecl.Lexeme)
+			}
+			idx, _, err := t.tx.RelationAttribute(schema, relation, valueDecl.Lexeme)
+			if err != nil {
+				return nil, err
+			}
+			excluded[attrDecl.Lexeme] = idx
+		}
+
+		action.Update = func(proposed *agnostic.Tuple) (map[string]any, error) {
+			values := make(map[string]any, len(set)+len(excluded))
+			for k, v := range set {
+				values[k] = v
+			}
+			for k, idx := range excluded {
+				values[k] = proposed.Values()[idx]
+			}
+			return values, nil
+		}
+	}
+
+	if action.Update == nil {
+		return nil, ParsingError
+	}
+	return action, nil
+}
+
+// getInsertTargets returns attributes of relation targeted by an INSERT
+// statement, in specified order. All attributes are targeted if none is specified.
+func (t *Tx) getInsertTargets(schema, relation string, specifiedAttrs []string) ([]agnostic.Attribute, error) {
+	if len(specifiedAttrs) == 0 {
+		return t.tx.RelationAttributes(schema, relation)
+	}
+
+	targets := make([]agnostic.Attribute, len(specifiedAttrs))
+	for i, name := range specifiedAttrs {
+		_, attr, err := t.tx.RelationAttribute(schema, relation, name)
+		if err != nil {
+			return nil, err
+		}
+		targets[i] = attr
+	}
+	return targets, nil
+}
+
+// getSelectValues runs the query of an INSERT INTO ... SELECT statement and
+// returns inserted values for each resulting row.
+//
+// Number of columns and type of each value are checked before any row is inserted.
+func (t *Tx) getSelectValues(targets []agnostic.Attribute, selectDecl *parser.Decl, args []NamedValue) ([]map[string]any, error) {
+	_, _, cols, res, err := queryExecutor(t, selectDecl, args)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(cols) != len(targets) {
+		return nil, fmt.Errorf("INSERT has %d target columns but SELECT returns %d", len(targets), len(cols))
+	}
+
+	rows := make([]map[string]any, len(res))
+	for i, tuple := range res {
+		values := make(map[string]any, len(targets))
+		for j, v := range tuple.Values() {
+			if !targets[j].Accepts(v) {
+				return nil, fmt.Errorf("cannot assign '%v' (type %T) from column %s to %s", v, v, cols[j], targets[j])
+			}
+			values[targets[j].Name()] = v
+		}
+		rows[i] = values
+	}
+
+	return rows, nil
+}
+
+func attributesName(attrs []agnostic.Attribute) []string {
+	names := make([]string, len(attrs))
+	for i, a := range attrs {
+		names[i] = a.Name()
+	}
+	return names
+}
+
+func (t *Tx) getValues(schema string, targets []agnostic.Attribute, valuesDecl *parser.Decl, args []NamedValue) (map[string]any, error) {
 	var typeName string
 	var err error
 	values := make(map[string]any)
-	var odbcIdx int64 = 1
 
 	for i, d := range valuesDecl.Decl {
 		if d.Lexeme == "default" || d.Lexeme == "DEFAULT" {
@@ -345,15 +1238,9 @@ func getValues(specifiedAttrs []string, valuesDecl *parser.Decl, args []NamedVal
 
 		switch d.Token {
 		case parser.ArgToken:
-			var idx int64
-			if d.Lexeme == "?" {
-				idx = odbcIdx
-				odbcIdx++
-			} else {
-				idx, err = strconv.ParseInt(d.Lexeme, 10, 64)
-				if err != nil {
-					return nil, err
-				}
+			idx, err := strconv.ParseInt(d.Lexeme, 10, 64)
+			if err != nil {
+				return nil, err
 			}
 			if len(args) <= int(idx)-1 {
 				return nil, fmt.Errorf("reference to $%s, but only %d argument provided", d.Lexeme, len(args))
@@ -365,22 +1252,66 @@ func getValues(specifiedAttrs []string, valuesDecl *parser.Decl, args []NamedVal
 					v = arg.Value
 				}
 			}
+		case parser.NowToken, parser.LocalTimestampToken, parser.CurrentDateToken:
+			v = t.currentTime(d)
+		case parser.NextvalToken, parser.CurrvalToken:
+			v, err = t.sequenceValue(schema, d)
+			if err != nil {
+				return nil, err
+			}
+		case parser.ArrayToken:
+			f, err := t.valueFunctor(d, schema, nil, args, nil)
+			if err != nil {
+				return nil, err
+			}
+			if v, err = f.Value(nil, nil); err != nil {
+				return nil, err
+			}
+		case parser.StringToken:
+			// string literal is not guessed into another type if target is
+			// textual, or an array parsing it
+			_, isArray := agnostic.ArrayElemType(targets[i].TypeName())
+			if targets[i].ScanType().Kind() == reflect.String || isArray {
+				v = d.Lexeme
+				break
+			}
+			v, err = agnostic.ToInstance(d.Lexeme, typeName)
+			if err != nil {
+				return nil, err
+			}
 		default:
 			v, err = agnostic.ToInstance(d.Lexeme, typeName)
 			if err != nil {
 				return nil, err
 			}
 		}
-		values[strings.ToLower(specifiedAttrs[i])] = v
+		values[targets[i].Name()] = v
 	}
 
 	return values, nil
 }
 
+// sequenceValue evaluates nextval('name') and currval('name') calls.
+// Sequence name may be qualified with a schema, as in nextval('schema.name').
+func (t *Tx) sequenceValue(schema string, decl *parser.Decl) (int64, error) {
+	if len(decl.Decl) == 0 {
+		return 0, ParsingError
+	}
+
+	name := decl.Decl[0].Lexeme
+	if s, n, ok := strings.Cut(name, "."); ok {
+		schema, name = s, n
+	}
+
+	if decl.Token == parser.CurrvalToken {
+		return t.tx.CurrentValue(schema, name)
+	}
+	return t.tx.NextValue(schema, name)
+}
+
 func getSet(specifiedAttrs []string, values map[string]any, valuesDecl *parser.Decl, args []NamedValue) (map[string]any, error) {
 	var typeName string
 	var err error
-	var odbcIdx int64 = 1
 
 	nameDecl := valuesDecl
 	valueDecl := nameDecl.Decl[1]
@@ -405,20 +1336,19 @@ func getSet(specifiedAttrs []string, values map[string]any, valuesDecl *parser.D
 
 	switch valueDecl.Token {
 	case parser.ArgToken:
-		var idx int64
-		if valueDecl.Lexeme == "?" {
-			idx = odbcIdx
-			odbcIdx++
-		} else {
-			idx, err = strconv.ParseInt(valueDecl.Lexeme, 10, 64)
-			if err != nil {
-				return nil, err
-			}
+		idx, err := strconv.ParseInt(valueDecl.Lexeme, 10, 64)
+		if err != nil {
+			return nil, err
 		}
 		if len(args) <= int(idx)-1 {
 			return nil, fmt.Errorf("reference to $%s, but only %d argument provided", valueDecl.Lexeme, len(args))
 		}
 		v = args[idx-1].Value
+	case parser.NamedArgToken:
+		v, err = argValue(valueDecl, args)
+		if err != nil {
+			return nil, err
+		}
 	default:
 		v, err = agnostic.ToInstance(valueDecl.Lexeme, typeName)
 		if err != nil {
@@ -469,54 +1399,434 @@ func hasIfExists(tableDecl *parser.Decl) bool {
 			|-> foo@bar.com
 */
 func selectExecutor(t *Tx, selectDecl *parser.Decl, args []NamedValue) (int64, int64, []string, []*agnostic.Tuple, error) {
+	schema, selectors, predicate, joiners, sorters, aliases, err := t.getQuery(selectDecl, args)
+	if err != nil {
+		return 0, 0, nil, nil, err
+	}
+
+	log.Debug("executing '%s' with %s, joining with %s and sorting with %s", selectors, predicate, joiners, sorters)
+	cols, res, err := t.tx.Query(schema, selectors, predicate, joiners, sorters, aliases...)
+	if err != nil {
+		return 0, 0, nil, nil, err
+	}
+
+	t.columnAttrs = t.selectorsAttributes(schema, selectors, aliases)
+	if len(t.columnAttrs) != len(cols) {
+		t.columnAttrs = nil
+	}
+
+	return 0, 0, cols, res, nil
+}
+
+// setOperationExecutor combines rows of SELECT statements with UNION, INTERSECT
+// or EXCEPT. ORDER BY, LIMIT and OFFSET apply to the combined result, whose
+// columns are named after the first SELECT.
+func setOperationExecutor(t *Tx, opDecl *parser.Decl, args []NamedValue) (int64, int64, []string, []*agnostic.Tuple, error) {
+	op, left, right, all, attrs, err := t.setOperationArms(opDecl, args)
+	if err != nil {
+		return 0, 0, nil, nil, err
+	}
+
+	var sorters []agnostic.Sorter
+	for _, d := range opDecl.Decl {
+		switch d.Token {
+		case parser.OrderToken:
+			orderDecl, err := t.resolveSetOrderBy(d, opDecl)
+			if err != nil {
+				return 0, 0, nil, nil, err
+			}
+			if len(orderDecl.Decl) == 0 {
+				continue
+			}
+			s, err := t.orderbyExecutor(orderDecl, "", []string{""}, nil)
+			if err != nil {
+				return 0, 0, nil, nil, err
+			}
+			sorters = append(sorters, s)
+		case parser.LimitToken:
+			limit, err := intValue(d.Decl[0], args)
+			if err != nil {
+				return 0, 0, nil, nil, fmt.Errorf("wrong limit value: %s", err)
+			}
+			sorters = append(sorters, agnostic.NewLimitSorter(limit))
+		case parser.OffsetToken:
+			offset, err := intValue(d.Decl[0], args)
+			if err != nil {
+				return 0, 0, nil, nil, fmt.Errorf("wrong offset value: %s", err)
+			}
+			sorters = append(sorters, agnostic.NewOffsetSorter(int(offset)))
+		}
+	}
 
+	cols, res, err := t.tx.SetOperation(op, left, right, all, sorters)
+	if err != nil {
+		return 0, 0, nil, nil, err
+	}
+
+	t.columnAttrs = attrs
+	if len(t.columnAttrs) != len(cols) {
+		t.columnAttrs = nil
+	}
+
+	return 0, 0, cols, res, nil
+}
+
+// setOperationArms returns the operator and the query plans of both sides of a
+// set operation, and the attributes of columns returned by the first SELECT.
+func (t *Tx) setOperationArms(opDecl *parser.Decl, args []NamedValue) (agnostic.SetOperator, agnostic.Node, agnostic.Node, bool, []*agnostic.Attribute, error) {
+	var arms []*parser.Decl
+	var all bool
+
+	var op agnostic.SetOperator
+	switch opDecl.Token {
+	case parser.UnionToken:
+		op = agnostic.Union
+	case parser.IntersectToken:
+		op = agnostic.Intersect
+	case parser.ExceptToken:
+		op = agnostic.Except
+	}
+
+	for _, d := range opDecl.Decl {
+		switch {
+		case d.Token == parser.AllToken:
+			all = true
+		case isQuery(d):
+			arms = append(arms, d)
+		}
+	}
+	if len(arms) != 2 {
+		return op, nil, nil, false, nil, ParsingError
+	}
+
+	left, attrs, err := t.planQuery(arms[0], args)
+	if err != nil {
+		return op, nil, nil, false, nil, err
+	}
+	right, _, err := t.planQuery(arms[1], args)
+	if err != nil {
+		return op, nil, nil, false, nil, err
+	}
+
+	return op, left, right, all, attrs, nil
+}
+
+// planQuery returns the query plan of a SELECT statement, or of a set
+// operation of SELECT statements, with the attributes of returned columns.
+func (t *Tx) planQuery(decl *parser.Decl, args []NamedValue) (agnostic.Node, []*agnostic.Attribute, error) {
+	if decl.Token != parser.SelectToken {
+		op, left, right, all, attrs, err := t.setOperationArms(decl, args)
+		if err != nil {
+			return nil, nil, err
+		}
+		return agnostic.NewSetOperationNode(op, left, right, all), attrs, nil
+	}
+
+	schema, selectors, predicate, joiners, sorters, aliases, err := t.getQuery(decl, args)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	n, err := t.tx.Plan(schema, selectors, predicate, joiners, sorters, aliases...)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return n, t.selectorsAttributes(schema, selectors, aliases), nil
+}
+
+// queryExecutor executes a SELECT statement, or a set operation of SELECT statements
+func queryExecutor(t *Tx, decl *parser.Decl, args []NamedValue) (int64, int64, []string, []*agnostic.Tuple, error) {
+	if decl.Token != parser.SelectToken {
+		return setOperationExecutor(t, decl, args)
+	}
+
+	return selectExecutor(t, decl, args)
+}
+
+// isAggregate returns true if decl is an aggregate function, like COUNT or
+// MAX, computed over all rows
+func isAggregate(decl *parser.Decl) bool {
+	switch decl.Token {
+	case parser.CountToken, parser.MaxToken, parser.MinToken, parser.SumToken, parser.AvgToken:
+		_, over := decl.Has(parser.OverToken)
+		return !over
+	case parser.FunctionToken:
+		_, ok := withinGroup(decl)
+		return ok
+	}
+	return false
+}
+
+// withinGroup returns the WITHIN GROUP clause of decl if it is an
+// ordered-set aggregate call, like percentile_cont(0.5) WITHIN GROUP (...)
+func withinGroup(decl *parser.Decl) (*parser.Decl, bool) {
+	if decl.Token != parser.FunctionToken {
+		return nil, false
+	}
+	for _, d := range decl.Decl {
+		if d.Token == parser.WithinToken {
+			return d, true
+		}
+	}
+	return nil, false
+}
+
+// isWindow returns true if decl is a window function call, like
+// ROW_NUMBER() OVER (...) or SUM(attribute) OVER (...)
+func isWindow(decl *parser.Decl) bool {
+	_, ok := decl.Has(parser.OverToken)
+	return ok
+}
+
+// hasWindow returns true if a window function is selected by selectDecl
+func hasWindow(selectDecl *parser.Decl) bool {
+	for _, d := range selectDecl.Decl {
+		if isWindow(d) {
+			return true
+		}
+	}
+	return false
+}
+
+// windowColumn returns the name of the column holding values of the n-th
+// window of a query. It cannot collide with an attribute name.
+func windowColumn(n int) string {
+	return fmt.Sprintf("window#%d", n)
+}
+
+// isSelected returns true if decl is a column selected by a SELECT statement,
+// other than a star
+func isSelected(decl *parser.Decl) bool {
+	switch {
+	case decl.Token == parser.StringToken, decl.Token == parser.NumberToken:
+		return true
+	case decl.Token == parser.CastToken, decl.Token == parser.FunctionToken, decl.Token == parser.SimpleQuoteToken:
+		return true
+	case decl.Token == parser.NowToken, decl.Token == parser.LocalTimestampToken, decl.Token == parser.CurrentDateToken:
+		return true
+	case decl.Token == parser.PlusToken, decl.Token == parser.MinusToken, decl.Token == parser.IntervalToken:
+		return true
+	case decl.Token == parser.ArrayToken, decl.Token == parser.SubscriptToken:
+		return true
+	case isAggregate(decl), isWindow(decl), isQuery(decl):
+		return true
+	}
+	return false
+}
+
+// isQuery returns true if decl is a SELECT statement, or a UNION, INTERSECT
+// or EXCEPT of SELECT statements
+func isQuery(decl *parser.Decl) bool {
+	switch decl.Token {
+	case parser.SelectToken, parser.UnionToken, parser.IntersectToken, parser.ExceptToken:
+		return true
+	}
+	return false
+}
+
+// selectorsAttributes returns the relation attribute of each column returned by selectors.
+// Columns computed by selectors, like COUNT, have no attribute.
+func (t *Tx) selectorsAttributes(schema string, selectors []agnostic.Selector, aliases []agnostic.Alias) []*agnostic.Attribute {
+	var attrs []*agnostic.Attribute
+
+	relations := make(map[string]string, len(aliases))
+	for _, a := range aliases {
+		relations[a.Name()] = a.Relation()
+	}
+
+	for _, selector := range selectors {
+		// renamed columns keep the attribute of the column they rename
+		names := selector.Attribute()
+		if ns, ok := selector.(*agnostic.NamedSelector); ok {
+			selector = ns.Selector
+			if len(selector.Attribute()) == len(names) {
+				names = selector.Attribute()
+			}
+		}
+
+		for _, name := range names {
+			switch selector.(type) {
+			case *agnostic.AttributeSelector, *agnostic.StarSelector:
+			default:
+				attrs = append(attrs, nil)
+				continue
+			}
+
+			if idx := strings.LastIndex(name, "."); idx != -1 {
+				name = name[idx+1:]
+			}
+			_, attr, err := t.tx.RelationAttribute(schema, getAlias(selector.Relation(), relations), name)
+			if err != nil {
+				attrs = append(attrs, nil)
+				continue
+			}
+			attrs = append(attrs, &attr)
+		}
+	}
+
+	return attrs
+}
+
+// explainExecutor returns the query plan of a SELECT statement, without executing it.
+// With ANALYZE, statement is executed and plan is returned with actual row counts and timings.
+func explainExecutor(t *Tx, explainDecl *parser.Decl, args []NamedValue) (int64, int64, []string, []*agnostic.Tuple, error) {
+	selectDecl, ok := explainDecl.Has(parser.SelectToken)
+	if !ok {
+		return 0, 0, nil, nil, fmt.Errorf("EXPLAIN only supports SELECT statements")
+	}
+
+	schema, selectors, predicate, joiners, sorters, aliases, err := t.getQuery(selectDecl, args)
+	if err != nil {
+		return 0, 0, nil, nil, err
+	}
+
+	explain := t.tx.Explain
+	if _, ok := explainDecl.Has(parser.AnalyzeToken); ok {
+		explain = t.tx.Analyze
+	}
+
+	cols, res, err := explain(schema, selectors, predicate, joiners, sorters, aliases...)
+	if err != nil {
+		return 0, 0, nil, nil, err
+	}
+
+	return 0, 0, cols, res, nil
+}
+
+// showExecutor lists relations of current schema, or of schema given with
+// FROM. SHOW name returns the value of a session variable.
+func showExecutor(t *Tx, showDecl *parser.Decl, args []NamedValue) (int64, int64, []string, []*agnostic.Tuple, error) {
+	var schema string
+
+	if len(showDecl.Decl) > 0 && !strings.EqualFold(showDecl.Decl[0].Lexeme, "tables") {
+		return showVariable(t, showDecl.Decl[0].Lexeme)
+	}
+
+	if d, ok := showDecl.Has(parser.FromToken); ok {
+		if len(d.Decl) < 1 {
+			return 0, 0, nil, nil, ParsingError
+		}
+		schema = d.Decl[0].Lexeme
+	}
+
+	cols, res, err := t.tx.ShowTables(schema)
+	if err != nil {
+		return 0, 0, nil, nil, err
+	}
+
+	return 0, 0, cols, res, nil
+}
+
+// describeExecutor lists attributes of a relation with their type and key information
+func describeExecutor(t *Tx, describeDecl *parser.Decl, args []NamedValue) (int64, int64, []string, []*agnostic.Tuple, error) {
 	var schema string
+
+	if len(describeDecl.Decl) < 1 {
+		return 0, 0, nil, nil, ParsingError
+	}
+
+	nameDecl := describeDecl.Decl[0]
+	if d, ok := nameDecl.Has(parser.SchemaToken); ok {
+		schema = d.Lexeme
+	}
+
+	cols, res, err := t.tx.Describe(schema, nameDecl.Lexeme)
+	if err != nil {
+		return 0, 0, nil, nil, err
+	}
+
+	return 0, 0, cols, res, nil
+}
+
+// getQuery builds selectors, predicate, joiners and sorters of a SELECT statement,
+// and the aliases of its relations
+func (t *Tx) getQuery(selectDecl *parser.Decl, args []NamedValue) (string, []agnostic.Selector, agnostic.Predicate, []agnostic.Joiner, []agnostic.Sorter, []agnostic.Alias, error) {
 	var selectors []agnostic.Selector
 	var predicate agnostic.Predicate
 	var joiners []agnostic.Joiner
 	var sorters []agnostic.Sorter
-	var tables []string
-	var err error
-	var aliases map[string]string
+
+	if err := t.materializeDerived(selectDecl, args); err != nil {
+		return "", nil, nil, nil, nil, nil, err
+	}
+	schema, tables, aliases, err := getSelectedTables(selectDecl)
+	if err != nil {
+		return "", nil, nil, nil, nil, nil, err
+	}
+	if len(tables) == 0 {
+		if err := fromless(selectDecl); err != nil {
+			return "", nil, nil, nil, nil, nil, err
+		}
+		tables = []string{""}
+	}
+	usings, err := t.getUsingJoins(selectDecl, schema, tables, aliases)
+	if err != nil {
+		return "", nil, nil, nil, nil, nil, err
+	}
+
+	sc := &scope{tables: tables, merged: make(map[string]bool)}
+	for _, uj := range usings {
+		for _, a := range uj.attrs {
+			sc.merged[a] = true
+		}
+	}
+	outer := t.scope
+	t.scope = sc
+	defer func() { t.scope = outer }()
 
 	for i := range selectDecl.Decl {
 		switch selectDecl.Decl[i].Token {
-		case parser.FromToken:
-			schema, tables, aliases = getSelectedTables(selectDecl.Decl[i])
 		case parser.WhereToken:
 			predicate, err = t.getPredicates(selectDecl.Decl[i].Decl, schema, tables[0], args, aliases)
 			if err != nil {
-				return 0, 0, nil, nil, err
+				return "", nil, nil, nil, nil, nil, err
 			}
 		case parser.JoinToken:
-			j, err := t.getJoin(selectDecl.Decl[i], tables[0])
+			if uj, ok := usings[selectDecl.Decl[i]]; ok {
+				joiners = append(joiners, uj.joiners()...)
+				continue
+			}
+			js, err := t.getJoins(selectDecl.Decl[i], tables[0])
 			if err != nil {
-				return 0, 0, nil, nil, err
+				return "", nil, nil, nil, nil, nil, err
 			}
-			joiners = append(joiners, j)
+			joiners = append(joiners, js...)
 		case parser.OffsetToken:
-			offset, err := strconv.Atoi(selectDecl.Decl[i].Decl[0].Lexeme)
+			offset, err := intValue(selectDecl.Decl[i].Decl[0], args)
 			if err != nil {
-				return 0, 0, nil, nil, fmt.Errorf("wrong offset value: %s", err)
+				return "", nil, nil, nil, nil, nil, fmt.Errorf("wrong offset value: %s", err)
 			}
-			s := agnostic.NewOffsetSorter(offset)
+			s := agnostic.NewOffsetSorter(int(offset))
 			sorters = append(sorters, s)
 		case parser.DistinctToken:
 			s, err := t.getDistinctSorter("", selectDecl.Decl[i], selectDecl.Decl[i+1].Lexeme)
 			if err != nil {
-				return 0, 0, nil, nil, err
+				return "", nil, nil, nil, nil, nil, err
 			}
 			sorters = append(sorters, s)
 		case parser.OrderToken:
-			s, err := orderbyExecutor(selectDecl.Decl[i], tables)
+			orderDecl, err := t.resolveOrderBy(selectDecl.Decl[i], selectDecl, schema, tables, aliases)
 			if err != nil {
-				return 0, 0, nil, nil, err
+				return "", nil, nil, nil, nil, nil, err
+			}
+			if d, ok := selectDecl.Has(parser.DistinctToken); ok {
+				if err := distinctOnOrder(d, orderDecl, tables[0]); err != nil {
+					return "", nil, nil, nil, nil, nil, err
+				}
+			}
+			if len(orderDecl.Decl) == 0 {
+				continue
+			}
+			s, err := t.orderbyExecutor(orderDecl, schema, tables, aliases)
+			if err != nil {
+				return "", nil, nil, nil, nil, nil, err
 			}
 			sorters = append(sorters, s)
 		case parser.LimitToken:
-			limit, err := strconv.ParseInt(selectDecl.Decl[i].Decl[0].Lexeme, 10, 64)
+			limit, err := intValue(selectDecl.Decl[i].Decl[0], args)
 			if err != nil {
-				return 0, 0, nil, nil, fmt.Errorf("wrong limit value: %s", err)
+				return "", nil, nil, nil, nil, nil, fmt.Errorf("wrong limit value: %s", err)
 			}
 			s := agnostic.NewLimitSorter(limit)
 			sorters = append(sorters, s)
@@ -527,32 +1837,368 @@ func selectExecutor(t *Tx, selectDecl *parser.Decl, args []NamedValue) (int64, i
 		predicate = agnostic.NewTruePredicate()
 	}
 
-	for i := 0; i < len(selectDecl.Decl); i++ {
-		if selectDecl.Decl[i].Token != parser.StringToken &&
-			selectDecl.Decl[i].Token != parser.StarToken &&
-			selectDecl.Decl[i].Token != parser.CountToken {
+	items := selectDecl.Decl
+	if hasWindow(selectDecl) || len(usings) > 0 {
+		// window values are appended to rows, so stars must only pick
+		// relation attributes. Attributes joined by name are picked once.
+		items, err = t.selectList(selectDecl, schema, tables, aliases)
+		if err != nil {
+			return "", nil, nil, nil, nil, nil, err
+		}
+	}
+
+	var windows []*agnostic.Window
+	for _, item := range items {
+		if item.Token != parser.StarToken && !isSelected(item) {
 			continue
 		}
 		// get attribute to select
-		selector, err := t.getSelector(selectDecl.Decl[i], schema, tables, aliases)
+		attrDecl, name := selectAlias(item)
+		if isWindow(attrDecl) {
+			w, err := t.getWindow(attrDecl, windowColumn(len(windows)), schema, tables, aliases, args)
+			if err != nil {
+				return "", nil, nil, nil, nil, nil, err
+			}
+			windows = append(windows, w)
+			if name == "" {
+				name = strings.ToLower(attrDecl.Lexeme)
+			}
+			selector := agnostic.NewAttributeSelector(tables[0], []string{w.Name()})
+			selectors = append(selectors, agnostic.NewNamedSelector(selector, name))
+			continue
+		}
+		selector, err := t.getSelector(attrDecl, schema, tables, aliases, args)
 		if err != nil {
-			return 0, 0, nil, nil, err
+			return "", nil, nil, nil, nil, nil, err
+		}
+		if name != "" {
+			selector = agnostic.NewNamedSelector(selector, name)
 		}
 		selectors = append(selectors, selector)
 	}
 
-	log.Debug("executing '%s' with %s, joining with %s and sorting with %s", selectors, predicate, joiners, sorters)
-	cols, res, err := t.tx.Query(schema, selectors, predicate, joiners, sorters)
+	if len(windows) > 0 {
+		sorters = append(sorters, agnostic.NewWindowNode(windows...))
+	}
+
+	var relations []agnostic.Alias
+	for alias, relation := range aliases {
+		relations = append(relations, agnostic.NewAlias(alias, relation))
+	}
+
+	return schema, selectors, predicate, joiners, sorters, relations, nil
+}
+
+// fromless checks selectDecl, which reads no relation, has no FROM clause.
+// Its columns are then computed once, on a single row without attribute,
+// as in SELECT 1, so they cannot reference attributes.
+func fromless(selectDecl *parser.Decl) error {
+	if _, ok := selectDecl.Has(parser.FromToken); ok {
+		return ParsingError
+	}
+	for _, d := range selectDecl.Decl {
+		if d.Token == parser.StarToken {
+			return fmt.Errorf("SELECT * with no tables specified is not valid")
+		}
+	}
+	return nil
+}
+
+// selectAlias returns a selected column decl without its AS clause, and the
+// column alias if any.
+func selectAlias(decl *parser.Decl) (*parser.Decl, string) {
+	asDecl, ok := decl.Has(parser.AsToken)
+	if !ok || len(asDecl.Decl) == 0 {
+		return decl, ""
+	}
+
+	d := &parser.Decl{Token: decl.Token, Lexeme: decl.Lexeme}
+	for _, c := range decl.Decl {
+		if c != asDecl {
+			d.Add(c)
+		}
+	}
+	return d, asDecl.Decl[0].Lexeme
+}
+
+// selectList returns the decl of each column selected by selectDecl, with
+// stars expanded to the attributes of their relation. If relations are
+// joined by NATURAL or USING clauses, an unqualified star expands to the
+// attributes of all relations, attributes joined by name first and once.
+func (t *Tx) selectList(selectDecl *parser.Decl, schema string, tables []string, aliases map[string]string) ([]*parser.Decl, error) {
+	var items []*parser.Decl
+
+	usings, err := t.getUsingJoins(selectDecl, schema, tables, aliases)
 	if err != nil {
-		return 0, 0, nil, nil, err
+		return nil, err
 	}
 
-	return 0, 0, cols, res, nil
+	for _, d := range selectDecl.Decl {
+		switch {
+		case d.Token == parser.StarToken && len(d.Decl) == 0 && len(usings) > 0:
+			cols, err := t.joinedColumns(selectDecl, schema, tables, aliases, usings)
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, cols...)
+		case d.Token == parser.StarToken:
+			ref := tables[0]
+			if len(d.Decl) > 0 {
+				ref = d.Decl[0].Lexeme
+			}
+			attrs, err := t.tx.RelationAttributes(schema, getAlias(ref, aliases))
+			if err != nil {
+				return nil, err
+			}
+			for _, a := range attrs {
+				items = append(items, attributeDecl(ref, a.Name()))
+			}
+		case isSelected(d):
+			items = append(items, d)
+		}
+	}
+
+	return items, nil
+}
+
+// attributeDecl returns the decl of attribute attr of relation ref
+func attributeDecl(ref, attr string) *parser.Decl {
+	d := &parser.Decl{Token: parser.StringToken, Lexeme: attr}
+	d.Add(&parser.Decl{Token: parser.StringToken, Lexeme: ref})
+	return d
+}
+
+// joinedColumns returns the decl of each attribute of relations of
+// selectDecl, in join order. Attributes of a NATURAL or USING join come
+// first, from the left relation, and the right relation ones are dropped.
+func (t *Tx) joinedColumns(selectDecl *parser.Decl, schema string, tables []string, aliases map[string]string, usings map[*parser.Decl]*usingJoin) ([]*parser.Decl, error) {
+	var cols []*parser.Decl
+
+	ti := 0
+	for _, d := range selectDecl.Decl {
+		var refs []string
+		switch d.Token {
+		case parser.FromToken:
+			refs = tables[ti : ti+len(d.Decl)]
+		case parser.JoinToken:
+			refs = tables[ti : ti+1]
+		default:
+			continue
+		}
+		ti += len(refs)
+
+		for _, ref := range refs {
+			attrs, err := t.tx.RelationAttributes(schema, getAlias(ref, aliases))
+			if err != nil {
+				return nil, err
+			}
+
+			uj, ok := usings[d]
+			if !ok {
+				for _, a := range attrs {
+					cols = append(cols, attributeDecl(ref, a.Name()))
+				}
+				continue
+			}
+
+			joined := make([]*parser.Decl, len(uj.attrs))
+			var rest []*parser.Decl
+			for _, c := range cols {
+				if i := indexOf(uj.attrs, c.Lexeme); i != -1 {
+					joined[i] = c
+				} else {
+					rest = append(rest, c)
+				}
+			}
+			cols = append(joined, rest...)
+			for _, a := range attrs {
+				if !contains(uj.attrs, a.Name()) {
+					cols = append(cols, attributeDecl(ref, a.Name()))
+				}
+			}
+		}
+	}
+
+	return cols, nil
+}
+
+// resolveOrderBy returns a copy of orderDecl where select list positions and
+// column aliases are replaced by the attribute they refer to. Items referring
+// to computed columns are dropped, since they cannot be sorted on before
+// projection.
+func (t *Tx) resolveOrderBy(orderDecl, selectDecl *parser.Decl, schema string, tables []string, aliases map[string]string) (*parser.Decl, error) {
+	items, err := t.selectList(selectDecl, schema, tables, aliases)
+	if err != nil {
+		return nil, err
+	}
+
+	named := make(map[string]*parser.Decl)
+	windows := make(map[*parser.Decl]string)
+	for _, item := range items {
+		if isWindow(item) {
+			windows[item] = windowColumn(len(windows))
+		}
+		if _, name := selectAlias(item); name != "" {
+			named[name] = item
+		}
+	}
+
+	resolved := &parser.Decl{Token: orderDecl.Token, Lexeme: orderDecl.Lexeme}
+	for _, d := range orderDecl.Decl {
+		var target *parser.Decl
+
+		switch d.Token {
+		case parser.NumberToken:
+			pos, err := orderByPosition(d, len(items))
+			if err != nil {
+				return nil, err
+			}
+			target = items[pos-1]
+		case parser.StringToken:
+			target = d
+			if a, ok := named[d.Lexeme]; ok && !isQualified(d) {
+				target = a
+				break
+			}
+			if isQualified(d) {
+				break
+			}
+			// an unqualified name is a selected column first, then an
+			// attribute of one of the relations
+			var selected []*parser.Decl
+			for _, item := range items {
+				if _, name := selectAlias(item); name == "" && item.Token == parser.StringToken && item.Lexeme == d.Lexeme {
+					selected = append(selected, item)
+				}
+			}
+			switch {
+			case len(selected) > 1:
+				return nil, agnostic.NewError(agnostic.AmbiguousColumn, "ORDER BY \"%s\" is ambiguous", d.Lexeme).On("", d.Lexeme)
+			case len(selected) == 1:
+				target = selected[0]
+			default:
+				if _, err := t.relationOf(schema, d.Lexeme, tables, aliases); isAmbiguous(err) {
+					return nil, err
+				}
+			}
+		default:
+			return nil, ParsingError
+		}
+
+		if name, ok := windows[target]; ok {
+			target = &parser.Decl{Token: parser.StringToken, Lexeme: name}
+		} else {
+			target, _ = selectAlias(target)
+		}
+
+		if target.Token != parser.StringToken {
+			continue
+		}
+
+		item := &parser.Decl{Token: target.Token, Lexeme: target.Lexeme}
+		for _, c := range target.Decl {
+			if c.Token == parser.StringToken {
+				item.Add(c)
+			}
+		}
+		for _, c := range d.Decl {
+			if c.Token == parser.AscToken || c.Token == parser.DescToken || c.Token == parser.CollateToken {
+				item.Add(c)
+			}
+		}
+		resolved.Add(item)
+	}
+
+	return resolved, nil
+}
+
+// resolveSetOrderBy returns a copy of orderDecl where select list positions
+// are replaced by the name of the combined result column, named after the
+// first SELECT of the set operation.
+func (t *Tx) resolveSetOrderBy(orderDecl, opDecl *parser.Decl) (*parser.Decl, error) {
+	first := opDecl
+	for first.Token != parser.SelectToken {
+		var next *parser.Decl
+		for _, d := range first.Decl {
+			if isQuery(d) {
+				next = d
+				break
+			}
+		}
+		if next == nil {
+			return nil, ParsingError
+		}
+		first = next
+	}
+
+	schema, tables, aliases, err := getSelectedTables(first)
+	if err != nil {
+		return nil, err
+	}
+	if len(tables) == 0 {
+		if err := fromless(first); err != nil {
+			return nil, err
+		}
+		tables = []string{""}
+	}
+	items, err := t.selectList(first, schema, tables, aliases)
+	if err != nil {
+		return nil, err
+	}
+
+	resolved := &parser.Decl{Token: orderDecl.Token, Lexeme: orderDecl.Lexeme}
+	for _, d := range orderDecl.Decl {
+		if d.Token != parser.NumberToken {
+			resolved.Add(d)
+			continue
+		}
+
+		pos, err := orderByPosition(d, len(items))
+		if err != nil {
+			return nil, err
+		}
+		target, name := selectAlias(items[pos-1])
+		if name == "" {
+			if target.Token != parser.StringToken {
+				continue
+			}
+			name = target.Lexeme
+		}
+
+		item := &parser.Decl{Token: parser.StringToken, Lexeme: name}
+		for _, c := range d.Decl {
+			item.Add(c)
+		}
+		resolved.Add(item)
+	}
+
+	return resolved, nil
+}
+
+// orderByPosition returns the select list position referenced by an ORDER BY
+// number, between 1 and n.
+func orderByPosition(d *parser.Decl, n int) (int, error) {
+	pos, err := strconv.Atoi(d.Lexeme)
+	if err != nil || pos < 1 || pos > n {
+		return 0, fmt.Errorf("ORDER BY position %s is not in select list", d.Lexeme)
+	}
+	return pos, nil
+}
+
+// isQualified returns true if attribute decl is prefixed with a relation name
+func isQualified(d *parser.Decl) bool {
+	for _, c := range d.Decl {
+		if c.Token == parser.StringToken {
+			return true
+		}
+	}
+	return false
 }
 
 func createIndexExecutor(t *Tx, indexDecl *parser.Decl, args []NamedValue) (int64, int64, []string, []*agnostic.Tuple, error) {
 	var i int
 	var schema, relation, index string
+	var unique bool
 
 	if len(indexDecl.Decl) == 0 {
 		return 0, 0, nil, nil, ParsingError
@@ -571,16 +2217,38 @@ func createIndexExecutor(t *Tx, indexDecl *parser.Decl, args []NamedValue) (int6
 
 	if d, ok := indexDecl.Has(parser.TableToken); ok {
 		relation = d.Lexeme
+		if sd, ok := d.Has(parser.SchemaToken); ok {
+			schema = sd.Lexeme
+		}
 		i++
 	}
 
+	it := agnostic.HashIndexType
 	var attrs []string
-	for i < len(indexDecl.Decl) {
+	for ; i < len(indexDecl.Decl); i++ {
+		if indexDecl.Decl[i].Token == parser.UniqueToken {
+			unique = true
+			continue
+		}
+		if indexDecl.Decl[i].Token == parser.UsingToken {
+			switch strings.ToLower(indexDecl.Decl[i].Decl[0].Lexeme) {
+			case "hash":
+				it = agnostic.HashIndexType
+			case "btree":
+				it = agnostic.BTreeIndexType
+			default:
+				return 0, 0, nil, nil, fmt.Errorf("unknown index method %s", indexDecl.Decl[i].Decl[0].Lexeme)
+			}
+			continue
+		}
 		attrs = append(attrs, indexDecl.Decl[i].Lexeme)
-		i++
 	}
 
-	err := t.tx.CreateIndex(schema, relation, index, agnostic.HashIndexType, attrs)
+	if ifNotExists && t.tx.CheckIndex(schema, relation, index) {
+		return 0, 0, nil, nil, nil
+	}
+
+	err := t.tx.CreateIndex(schema, relation, index, it, unique, attrs)
 	if err != nil {
 		return 0, 0, nil, nil, err
 	}
@@ -595,13 +2263,12 @@ func updateExecutor(t *Tx, updateDecl *parser.Decl, args []NamedValue) (int64, i
 	var predicate agnostic.Predicate
 	var err error
 
-	if len(updateDecl.Decl) < 3 {
+	if len(updateDecl.Decl) < 2 {
 		return 0, 0, nil, nil, ParsingError
 	}
 
 	relationDecl := updateDecl.Decl[0]
 	setDecl := updateDecl.Decl[1]
-	whereDecl := updateDecl.Decl[2]
 	relation := relationDecl.Lexeme
 
 	if d, ok := relationDecl.Has(parser.SchemaToken); ok {
@@ -609,16 +2276,9 @@ func updateExecutor(t *Tx, updateDecl *parser.Decl, args []NamedValue) (int64, i
 	}
 
 	// Check for RETURNING clause
-	if len(updateDecl.Decl) > 3 {
-		for i := range updateDecl.Decl {
-			if updateDecl.Decl[i].Token == parser.ReturningToken {
-				returningDecl := updateDecl.Decl[i]
-				_, _, err := t.tx.RelationAttribute(schema, relation, returningDecl.Decl[0].Lexeme)
-				if err != nil {
-					return 0, 0, nil, nil, fmt.Errorf("cannot return %s, doesn't exist in relation %s", returningDecl.Decl[0].Lexeme, relation)
-				}
-			}
-		}
+	returningAttrs, returningIdx, err := t.getReturning(schema, relation, updateDecl)
+	if err != nil {
+		return 0, 0, nil, nil, err
 	}
 
 	var specifiedAttrs []string
@@ -626,9 +2286,11 @@ func updateExecutor(t *Tx, updateDecl *parser.Decl, args []NamedValue) (int64, i
 		specifiedAttrs = append(specifiedAttrs, d.Lexeme)
 	}
 
-	predicate, err = t.getPredicates(whereDecl.Decl, schema, relation, args, nil)
-	if err != nil {
-		return 0, 0, nil, nil, err
+	if whereDecl, ok := updateDecl.Has(parser.WhereToken); ok {
+		predicate, err = t.getPredicates(whereDecl.Decl, schema, relation, args, nil)
+		if err != nil {
+			return 0, 0, nil, nil, err
+		}
 	}
 
 	if predicate == nil {
@@ -638,6 +2300,16 @@ func updateExecutor(t *Tx, updateDecl *parser.Decl, args []NamedValue) (int64, i
 	//	var tuples []*agnostic.Tuple
 	values := make(map[string]any)
 	for _, s := range setDecl.Decl {
+		if len(s.Decl) > 1 && s.Decl[1].Token == parser.ArrayToken {
+			f, err := t.valueFunctor(s.Decl[1], schema, nil, args, nil)
+			if err != nil {
+				return 0, 0, nil, nil, err
+			}
+			if values[s.Lexeme], err = f.Value(nil, nil); err != nil {
+				return 0, 0, nil, nil, err
+			}
+			continue
+		}
 		_, err = getSet(specifiedAttrs, values, s, args)
 		if err != nil {
 			return 0, 0, nil, nil, err
@@ -645,12 +2317,21 @@ func updateExecutor(t *Tx, updateDecl *parser.Decl, args []NamedValue) (int64, i
 	}
 
 	log.Debug("executing update '%s' with values %v and predicate %s", selectors, values, predicate)
-	cols, res, err := t.tx.Update(schema, relation, values, selectors, predicate)
+	_, res, err := t.tx.Update(schema, relation, values, selectors, predicate)
 	if err != nil {
 		return 0, 0, nil, nil, err
 	}
 
-	return 0, int64(len(res)), cols, res, nil
+	if len(returningAttrs) == 0 {
+		return 0, int64(len(res)), nil, nil, nil
+	}
+
+	tuples := make([]*agnostic.Tuple, len(res))
+	for i, tuple := range res {
+		tuples[i] = project(tuple, returningIdx)
+	}
+
+	return 0, int64(len(res)), returningAttrs, tuples, nil
 }
 
 func deleteExecutor(t *Tx, decl *parser.Decl, args []NamedValue) (int64, int64, []string, []*agnostic.Tuple, error) {
@@ -659,13 +2340,12 @@ func deleteExecutor(t *Tx, decl *parser.Decl, args []NamedValue) (int64, int64,
 	var predicate agnostic.Predicate
 	var err error
 
-	if len(decl.Decl) < 2 {
-		return truncateExecutor(t, decl, args)
+	if len(decl.Decl) < 1 || len(decl.Decl[0].Decl) < 1 {
+		return 0, 0, nil, nil, ParsingError
 	}
 
 	fromDecl := decl.Decl[0]
 	relationDecl := fromDecl.Decl[0]
-	whereDecl := decl.Decl[1]
 	relation := relationDecl.Lexeme
 
 	if d, ok := relationDecl.Has(parser.SchemaToken); ok {
@@ -673,23 +2353,20 @@ func deleteExecutor(t *Tx, decl *parser.Decl, args []NamedValue) (int64, int64,
 	}
 
 	// Check for RETURNING clause
-	if len(decl.Decl) > 3 {
-		for i := range decl.Decl {
-			if decl.Decl[i].Token == parser.ReturningToken {
-				returningDecl := decl.Decl[i]
-				_, _, err := t.tx.RelationAttribute(schema, relation, returningDecl.Decl[0].Lexeme)
-				if err != nil {
-					return 0, 0, nil, nil, fmt.Errorf("cannot return %s, doesn't exist in relation %s", returningDecl.Decl[0].Lexeme, relation)
-				}
-			}
-		}
-	}
-
-	predicate, err = t.getPredicates(whereDecl.Decl, schema, relation, args, nil)
+	returningAttrs, returningIdx, err := t.getReturning(schema, relation, decl)
 	if err != nil {
 		return 0, 0, nil, nil, err
 	}
 
+	// DELETE without WHERE clause removes all rows, but contrary to TRUNCATE
+	// each row removal is recorded so it can be rolled back
+	if whereDecl, ok := decl.Has(parser.WhereToken); ok {
+		predicate, err = t.getPredicates(whereDecl.Decl, schema, relation, args, nil)
+		if err != nil {
+			return 0, 0, nil, nil, err
+		}
+	}
+
 	if predicate == nil {
 		predicate = agnostic.NewTruePredicate()
 	}
@@ -699,7 +2376,65 @@ func deleteExecutor(t *Tx, decl *parser.Decl, args []NamedValue) (int64, int64,
 		return 0, 0, nil, nil, err
 	}
 
-	return 0, int64(len(res)), nil, nil, nil
+	if len(returningAttrs) == 0 {
+		return 0, int64(len(res)), nil, nil, nil
+	}
+
+	tuples := make([]*agnostic.Tuple, len(res))
+	for i, tuple := range res {
+		tuples[i] = project(tuple, returningIdx)
+	}
+
+	return 0, int64(len(res)), returningAttrs, tuples, nil
+}
+
+// getReturning returns names and positions in relation of attributes listed
+// in decl RETURNING clause, if any. A star returns all relation attributes.
+// Returned attributes are recorded as column attributes of the query.
+func (t *Tx) getReturning(schema, relation string, decl *parser.Decl) ([]string, []int, error) {
+	returningDecl, ok := decl.Has(parser.ReturningToken)
+	if !ok {
+		return nil, nil, nil
+	}
+
+	var names []string
+	var idxs []int
+	var columnAttrs []*agnostic.Attribute
+	for _, d := range returningDecl.Decl {
+		if d.Token == parser.StarToken {
+			attrs, err := t.tx.RelationAttributes(schema, relation)
+			if err != nil {
+				return nil, nil, err
+			}
+			for i := range attrs {
+				names = append(names, attrs[i].Name())
+				idxs = append(idxs, i)
+				columnAttrs = append(columnAttrs, &attrs[i])
+			}
+			continue
+		}
+
+		idx, attr, err := t.tx.RelationAttribute(schema, relation, d.Lexeme)
+		if err != nil {
+			return nil, nil, fmt.Errorf("cannot return %s, doesn't exist in relation %s", d.Lexeme, relation)
+		}
+		names = append(names, d.Lexeme)
+		idxs = append(idxs, idx)
+		columnAttrs = append(columnAttrs, &attr)
+	}
+
+	t.columnAttrs = columnAttrs
+	return names, idxs, nil
+}
+
+// project returns a new tuple with values of tuple at given positions
+func project(tuple *agnostic.Tuple, idxs []int) *agnostic.Tuple {
+	values := tuple.Values()
+	p := agnostic.NewTuple()
+	for _, idx := range idxs {
+		p.Append(values[idx])
+	}
+	return p
 }
 
 func truncateExecutor(t *Tx, trDecl *parser.Decl, args []NamedValue) (int64, int64, []string, []*agnostic.Tuple, error) {
@@ -709,12 +2444,19 @@ func truncateExecutor(t *Tx, trDecl *parser.Decl, args []NamedValue) (int64, int
 		return 0, 0, nil, nil, ParsingError
 	}
 
-	if d, ok := trDecl.Decl[0].Has(parser.SchemaToken); ok {
+	// TRUNCATE resets auto-increment counters unless CONTINUE IDENTITY is specified
+	restartIdentity := true
+	nameDecl := trDecl.Decl[0]
+	if _, ok := trDecl.Has(parser.ContinueToken); ok {
+		restartIdentity = false
+	}
+
+	if d, ok := nameDecl.Has(parser.SchemaToken); ok {
 		schema = d.Lexeme
 	}
-	relation := trDecl.Decl[0].Decl[0].Lexeme
+	relation := nameDecl.Lexeme
 
-	c, err := t.tx.Truncate(schema, relation)
+	c, err := t.tx.Truncate(schema, relation, restartIdentity)
 	if err != nil {
 		return 0, 0, nil, nil, err
 	}
@@ -722,45 +2464,88 @@ func truncateExecutor(t *Tx, trDecl *parser.Decl, args []NamedValue) (int64, int
 	return 0, c, nil, nil, nil
 }
 
-func orderbyExecutor(decl *parser.Decl, tables []string) (agnostic.Sorter, error) {
-	var orderingTk int
-	var valDecl *parser.Decl
-	var attrs []agnostic.SortExpression
+// analyzeExecutor computes statistics of named relation, or of every relation
+func analyzeExecutor(t *Tx, anDecl *parser.Decl, args []NamedValue) (int64, int64, []string, []*agnostic.Tuple, error) {
+	var schema, relation string
+
+	if len(anDecl.Decl) > 0 {
+		nameDecl := anDecl.Decl[0]
+		if d, ok := nameDecl.Has(parser.SchemaToken); ok {
+			schema = d.Lexeme
+		}
+		relation = nameDecl.Lexeme
+	}
+
+	err := t.tx.AnalyzeRelation(schema, relation, t.session.StatisticsTarget())
+	if err != nil {
+		return 0, 0, nil, nil, err
+	}
+
+	return 0, 0, nil, nil, nil
+}
+
+// distinctOnOrder checks that attributes of DISTINCT ON clause distinctDecl
+// are the leftmost ones of ORDER BY clause orderDecl, in any order, so that
+// the first row of each distinct value is well defined. Unqualified
+// attributes belong to relation rel.
+func distinctOnOrder(distinctDecl, orderDecl *parser.Decl, rel string) error {
+	name := func(d *parser.Decl) string {
+		for _, c := range d.Decl {
+			if c.Token == parser.StringToken {
+				return c.Lexeme + "." + d.Lexeme
+			}
+		}
+		return rel + "." + d.Lexeme
+	}
+
+	on := make(map[string]bool)
+	for _, d := range distinctDecl.Decl {
+		on[name(d)] = true
+	}
+	covered := make(map[string]bool)
+	for _, d := range orderDecl.Decl {
+		if len(covered) == len(on) {
+			break
+		}
+		n := name(d)
+		if !on[n] {
+			return agnostic.NewError(agnostic.InvalidColumnReference, "SELECT DISTINCT ON expressions must match initial ORDER BY expressions")
+		}
+		covered[n] = true
+	}
+	return nil
+}
 
-	valDecl = decl
+// orderbyExecutor returns the sorter of ORDER BY clause decl. Strings are
+// ordered with the collation of the COLLATE clause of an attribute, or else
+// with the collation of the attribute itself.
+func (t *Tx) orderbyExecutor(decl *parser.Decl, schema string, tables []string, aliases map[string]string) (agnostic.Sorter, error) {
+	var attrs []agnostic.SortExpression
 
 	relation := tables[0]
 
-	for i := 0; i < len(valDecl.Decl); i++ {
-		attr := valDecl.Decl[i].Lexeme
-		attrDecl := valDecl.Decl[i]
-		if len(attrDecl.Decl) == 2 {
-			relationDecl := attrDecl.Decl[0]
-			orderingDecl := attrDecl.Decl[1]
-			relation = relationDecl.Lexeme
-			orderingTk = orderingDecl.Token
-		} else if len(attrDecl.Decl) == 1 {
-			switch attrDecl.Decl[0].Token {
+	for _, attrDecl := range decl.Decl {
+		direction := agnostic.ASC
+		var collation *agnostic.Collation
+		for _, d := range attrDecl.Decl {
+			switch d.Token {
 			case parser.StringToken:
-				orderingTk = parser.AscToken
-				relation = attrDecl.Decl[0].Lexeme
-			case parser.AscToken, parser.DescToken:
-				orderingTk = attrDecl.Decl[0].Token
-				relation = tables[0]
+				relation = d.Lexeme
+			case parser.DescToken:
+				direction = agnostic.DESC
+			case parser.CollateToken:
+				c, err := agnostic.NewCollation(d.Decl[0].Lexeme)
+				if err != nil {
+					return nil, err
+				}
+				collation = c
 			}
-		} else {
-			orderingTk = parser.AscToken
 		}
-
-		switch orderingTk {
-		case parser.AscToken:
-			attrs = append(attrs, agnostic.NewSortExpression(attr, agnostic.ASC))
-		case parser.DescToken:
-			attrs = append(attrs, agnostic.NewSortExpression(attr, agnostic.DESC))
-		default:
-			attrs = append(attrs, agnostic.NewSortExpression(attr, agnostic.ASC))
+		if collation == nil {
+			collation = t.implicitCollation(attrDecl, schema, tables, aliases)
 		}
 
+		attrs = append(attrs, agnostic.NewSortExpression(attrDecl.Lexeme, direction).WithCollation(collation))
 	}
 
 	sorter := agnostic.NewOrderBySorter(relation, attrs)
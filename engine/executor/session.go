@@ -0,0 +1,289 @@
+package executor
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/proullon/ramsql/engine/agnostic"
+	"github.com/proullon/ramsql/engine/parser"
+)
+
+// sessionDefaults are the values of variables not set in session
+var sessionDefaults = map[string]string{
+	"search_path":                     agnostic.DefaultSchema,
+	"timezone":                        "UTC",
+	"default_statistics_target":       strconv.Itoa(agnostic.DefaultStatisticsTarget),
+	"max_parallel_workers_per_gather": strconv.Itoa(agnostic.DefaultParallelWorkers),
+	"on_error_rollback":               "off",
+	"lock_timeout":                    "0",
+	"statement_timeout":               "0",
+	"strict_types":                    "off",
+	"stable_order":                    "off",
+}
+
+// Session holds the variables of a connection, changed with SET and read
+// with SHOW. It outlives transactions.
+//
+// Known variables are:
+//
+//   - search_path: schemas unqualified relations are looked up in
+//   - timezone: location TIMESTAMPTZ values are returned in
+//   - default_statistics_target: number of histogram buckets computed by ANALYZE
+//   - max_parallel_workers_per_gather: number of relations a query scans concurrently
+//   - on_error_rollback: if on, a failing statement only undoes its own changes
+//     and the transaction stays usable
+//   - lock_timeout: maximum wait for a table locked by another transaction,
+//     in milliseconds unless a unit is given, 0 waiting indefinitely
+//   - statement_timeout: maximum duration of a statement, in milliseconds
+//     unless a unit is given, 0 for no limit
+//   - strict_types: if on, inserted and updated values must convert to
+//     column type without loss, as a float with a fraction to an integer
+//   - stable_order: if on, rows are returned in insertion order when not
+//     ordered, whatever indexes and statistics, at the cost of using no index
+//
+// Other variables are stored and returned by SHOW, but have no effect.
+type Session struct {
+	vars     map[string]string
+	location *time.Location
+}
+
+func NewSession() *Session {
+	return &Session{vars: make(map[string]string)}
+}
+
+// Get returns the value of variable name, or its default value if not set
+func (s *Session) Get(name string) (string, bool) {
+	name = strings.ToLower(name)
+	if v, ok := s.vars[name]; ok {
+		return v, true
+	}
+	v, ok := sessionDefaults[name]
+	return v, ok
+}
+
+// Set changes the value of variable name. Invalid value for a known
+// variable is an error.
+func (s *Session) Set(name, value string) error {
+	name = strings.ToLower(name)
+
+	switch name {
+	case "timezone":
+		loc, err := time.LoadLocation(value)
+		if err != nil {
+			return fmt.Errorf("invalid value for parameter \"timezone\": \"%s\"", value)
+		}
+		s.location = loc
+	case "search_path":
+		if len(parseSearchPath(value)) == 0 {
+			return fmt.Errorf("invalid value for parameter \"search_path\": \"%s\"", value)
+		}
+	case "default_statistics_target":
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 || n > 10000 {
+			return fmt.Errorf("invalid value for parameter \"default_statistics_target\": \"%s\"", value)
+		}
+	case "max_parallel_workers_per_gather":
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 0 || n > 1024 {
+			return fmt.Errorf("invalid value for parameter \"max_parallel_workers_per_gather\": \"%s\"", value)
+		}
+	case "on_error_rollback", "strict_types", "stable_order":
+		if _, ok := parseBool(value); !ok {
+			return fmt.Errorf("invalid value for parameter \"%s\": \"%s\"", name, value)
+		}
+	case "lock_timeout", "statement_timeout":
+		if _, ok := parseTimeout(value); !ok {
+			return fmt.Errorf("invalid value for parameter \"%s\": \"%s\"", name, value)
+		}
+	}
+
+	s.vars[name] = value
+	return nil
+}
+
+// Reset restores the default value of variable name
+func (s *Session) Reset(name string) {
+	name = strings.ToLower(name)
+	if name == "timezone" {
+		s.location = nil
+	}
+	delete(s.vars, name)
+}
+
+// Location returns the location set with timezone variable, or nil if
+// timezone was never set, in which case timestamps are returned as stored.
+func (s *Session) Location() *time.Location {
+	return s.location
+}
+
+// SearchPath returns schemas listed in search_path variable, in order
+func (s *Session) SearchPath() []string {
+	v, _ := s.Get("search_path")
+	return parseSearchPath(v)
+}
+
+// StatisticsTarget returns the number of histogram buckets set with
+// default_statistics_target variable
+func (s *Session) StatisticsTarget() int {
+	v, _ := s.Get("default_statistics_target")
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		return agnostic.DefaultStatisticsTarget
+	}
+	return n
+}
+
+// ParallelWorkers returns the number of relations a query scans concurrently,
+// set with max_parallel_workers_per_gather variable
+func (s *Session) ParallelWorkers() int {
+	v, _ := s.Get("max_parallel_workers_per_gather")
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		return agnostic.DefaultParallelWorkers
+	}
+	return n
+}
+
+// StatementRollback returns whether on_error_rollback variable is on
+func (s *Session) StatementRollback() bool {
+	v, _ := s.Get("on_error_rollback")
+	on, _ := parseBool(v)
+	return on
+}
+
+// StrictTypes returns whether strict_types variable is on
+func (s *Session) StrictTypes() bool {
+	v, _ := s.Get("strict_types")
+	on, _ := parseBool(v)
+	return on
+}
+
+// StableOrder returns whether stable_order variable is on
+func (s *Session) StableOrder() bool {
+	v, _ := s.Get("stable_order")
+	on, _ := parseBool(v)
+	return on
+}
+
+// LockTimeout returns the maximum wait for a relation lock set with
+// lock_timeout variable, 0 if waiting indefinitely
+func (s *Session) LockTimeout() time.Duration {
+	v, _ := s.Get("lock_timeout")
+	d, _ := parseTimeout(v)
+	return d
+}
+
+// StatementTimeout returns the maximum duration of a statement set with
+// statement_timeout variable, 0 if unlimited
+func (s *Session) StatementTimeout() time.Duration {
+	v, _ := s.Get("statement_timeout")
+	d, _ := parseTimeout(v)
+	return d
+}
+
+// apply passes session variables used by the engine to transaction
+func (t *Tx) apply() {
+	t.tx.SetSearchPath(t.session.SearchPath())
+	t.tx.SetParallelWorkers(t.session.ParallelWorkers())
+	t.tx.SetStatementRollback(t.session.StatementRollback())
+	t.tx.SetLockTimeout(t.session.LockTimeout())
+	t.tx.SetStrictTypes(t.session.StrictTypes())
+	t.tx.SetStableOrder(t.session.StableOrder())
+}
+
+// parseTimeout parses a duration variable value, in milliseconds unless a
+// unit is given as in '2s' or '1min'
+func parseTimeout(v string) (time.Duration, bool) {
+	v = strings.ToLower(strings.TrimSpace(v))
+	if n, err := strconv.ParseInt(v, 10, 64); err == nil {
+		return time.Duration(n) * time.Millisecond, n >= 0
+	}
+	v = strings.Replace(v, "min", "m", 1)
+	d, err := time.ParseDuration(strings.ReplaceAll(v, " ", ""))
+	if err != nil || d < 0 {
+		return 0, false
+	}
+	return d, true
+}
+
+// parseBool parses a boolean variable value as PostgreSQL does
+func parseBool(v string) (bool, bool) {
+	switch strings.ToLower(strings.TrimSpace(v)) {
+	case "on", "true", "yes", "1":
+		return true, true
+	case "off", "false", "no", "0":
+		return false, true
+	}
+	return false, false
+}
+
+// parseSearchPath splits a comma separated list of schema names. Names may
+// be double quoted. "$user" is ignored, as there is no user schema.
+func parseSearchPath(v string) []string {
+	var path []string
+	for _, name := range strings.Split(v, ",") {
+		name = strings.Trim(strings.TrimSpace(name), `"`)
+		if name == "" || name == "$user" {
+			continue
+		}
+		path = append(path, name)
+	}
+	return path
+}
+
+// currentSchema returns the first existing schema of search path, where
+// relations are created when not qualified.
+func (t *Tx) currentSchema() string {
+	for _, name := range t.session.SearchPath() {
+		if t.tx.CheckSchema(name) {
+			return name
+		}
+	}
+	return agnostic.DefaultSchema
+}
+
+// setExecutor changes a session variable. DEFAULT restores its default value.
+func setExecutor(t *Tx, setDecl *parser.Decl, args []NamedValue) (int64, int64, []string, []*agnostic.Tuple, error) {
+	if len(setDecl.Decl) < 1 || len(setDecl.Decl[0].Decl) < 1 {
+		return 0, 0, nil, nil, ParsingError
+	}
+	nameDecl := setDecl.Decl[0]
+
+	values := make([]string, len(nameDecl.Decl))
+	for i, d := range nameDecl.Decl {
+		if d.Token == parser.DefaultToken {
+			if len(nameDecl.Decl) > 1 {
+				return 0, 0, nil, nil, fmt.Errorf("SET %s takes only one argument when set to DEFAULT", nameDecl.Lexeme)
+			}
+			t.session.Reset(nameDecl.Lexeme)
+			t.apply()
+			return 0, 0, nil, nil, nil
+		}
+		values[i] = d.Lexeme
+	}
+
+	// only search_path is a list
+	if len(values) > 1 && nameDecl.Lexeme != "search_path" {
+		return 0, 0, nil, nil, fmt.Errorf("SET %s takes only one argument", nameDecl.Lexeme)
+	}
+
+	if err := t.session.Set(nameDecl.Lexeme, strings.Join(values, ", ")); err != nil {
+		return 0, 0, nil, nil, err
+	}
+	t.apply()
+
+	return 0, 0, nil, nil, nil
+}
+
+// showVariable returns the value of a session variable, in a column named
+// after it.
+func showVariable(t *Tx, name string) (int64, int64, []string, []*agnostic.Tuple, error) {
+	v, ok := t.session.Get(name)
+	if !ok {
+		return 0, 0, nil, nil, fmt.Errorf("unrecognized configuration parameter \"%s\"", name)
+	}
+
+	return 0, 0, []string{name}, []*agnostic.Tuple{agnostic.NewTuple(v)}, nil
+}
@@ -0,0 +1,31 @@
+package executor
+
+import (
+	"github.com/proullon/ramsql/engine/parser"
+)
+
+// Statement is a parsed query, prepared once and executed many times with
+// Tx.ExecStatement or Tx.QueryStatement with new arguments.
+//
+// Only parsing is saved: statement is planned on each execution, as planning
+// locks relations and looks up indexes with argument values. Statement holds
+// no reference to relations, so it stays valid after schema changes.
+type Statement struct {
+	query        string
+	instructions []parser.Instruction
+}
+
+// Prepare parses query into a statement
+func Prepare(query string) (*Statement, error) {
+	instructions, err := parser.ParseInstruction(query)
+	if err != nil {
+		return nil, syntaxError(query, err)
+	}
+
+	return &Statement{query: query, instructions: instructions}, nil
+}
+
+// Query returns the query statement was prepared from
+func (s *Statement) Query() string {
+	return s.query
+}
@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/proullon/ramsql/engine/agnostic"
 	"github.com/proullon/ramsql/engine/log"
@@ -30,6 +31,33 @@ type Tx struct {
 	e            *Engine
 	tx           *agnostic.Transaction
 	opsExecutors map[int]executorFunc
+	// attributes of columns returned by last query, nil for computed columns
+	columnAttrs []*agnostic.Attribute
+	// outer row of the correlated subquery being executed
+	outer *correlation
+	// start time of the statement being executed, so that NOW() returns the
+	// same value for all rows
+	now time.Time
+	// variables of the connection running the transaction
+	session *Session
+	// relations of the query being built, see getQuery
+	scope *scope
+}
+
+// scope holds the relations of a query, among which its unqualified
+// attributes are resolved. Attributes merged by its NATURAL and USING joins
+// belong to several relations without being ambiguous.
+type scope struct {
+	tables []string
+	merged map[string]bool
+}
+
+// correlation is the row of an outer query a correlated subquery is evaluated with
+type correlation struct {
+	relation   string
+	cols       []string
+	tuple      *agnostic.Tuple
+	referenced bool
 }
 
 func NewTx(ctx context.Context, e *Engine, opts sql.TxOptions) (*Tx, error) {
@@ -39,33 +67,53 @@ func NewTx(ctx context.Context, e *Engine, opts sql.TxOptions) (*Tx, error) {
 	}
 
 	t := &Tx{
-		e:  e,
-		tx: tx,
+		e:       e,
+		tx:      tx,
+		session: NewSession(),
 	}
 
 	t.opsExecutors = map[int]executorFunc{
-		parser.CreateToken:   createExecutor,
-		parser.TableToken:    createTableExecutor,
-		parser.SchemaToken:   createSchemaExecutor,
-		parser.IndexToken:    createIndexExecutor,
-		parser.SelectToken:   selectExecutor,
-		parser.InsertToken:   insertIntoTableExecutor,
-		parser.DeleteToken:   deleteExecutor,
-		parser.UpdateToken:   updateExecutor,
-		parser.TruncateToken: truncateExecutor,
-		parser.DropToken:     dropExecutor,
-		parser.GrantToken:    grantExecutor,
+		parser.CreateToken:    createExecutor,
+		parser.TableToken:     createTableExecutor,
+		parser.SchemaToken:    createSchemaExecutor,
+		parser.SequenceToken:  createSequenceExecutor,
+		parser.TypeToken:      createTypeExecutor,
+		parser.DomainToken:    createDomainExecutor,
+		parser.IndexToken:     createIndexExecutor,
+		parser.SelectToken:    selectExecutor,
+		parser.WithToken:      withExecutor,
+		parser.UnionToken:     setOperationExecutor,
+		parser.IntersectToken: setOperationExecutor,
+		parser.ExceptToken:    setOperationExecutor,
+		parser.InsertToken:    insertIntoTableExecutor,
+		parser.DeleteToken:    deleteExecutor,
+		parser.UpdateToken:    updateExecutor,
+		parser.TruncateToken:  truncateExecutor,
+		parser.AnalyzeToken:   analyzeExecutor,
+		parser.DropToken:      dropExecutor,
+		parser.GrantToken:     grantExecutor,
+		parser.ExplainToken:   explainExecutor,
+		parser.ShowToken:      showExecutor,
+		parser.SetToken:       setExecutor,
+		parser.DescribeToken:  describeExecutor,
+		parser.AlterToken:     alterExecutor,
 	}
 
 	return t, nil
 }
 
 func (t *Tx) QueryContext(ctx context.Context, query string, args []NamedValue) ([]string, []*agnostic.Tuple, error) {
-
-	instructions, err := parser.ParseInstruction(query)
+	s, err := Prepare(query)
 	if err != nil {
 		return nil, nil, err
 	}
+
+	return t.QueryStatement(ctx, s, args)
+}
+
+// QueryStatement executes prepared statement s with args, like QueryContext
+func (t *Tx) QueryStatement(ctx context.Context, s *Statement, args []NamedValue) ([]string, []*agnostic.Tuple, error) {
+	query, instructions := s.query, s.instructions
 	if len(instructions) != 1 {
 		return nil, nil, fmt.Errorf("expected 1 query, got %d", len(instructions))
 	}
@@ -75,18 +123,49 @@ func (t *Tx) QueryContext(ctx context.Context, query string, args []NamedValue)
 		return nil, nil, fmt.Errorf("expected 1 query")
 	}
 
+	if err := checkArgs(instructions, args); err != nil {
+		return nil, nil, err
+	}
+
+	if err := ctx.Err(); err != nil {
+		return nil, nil, err
+	}
+	ctx, cancel := t.statementContext(ctx)
+	defer cancel()
+	t.tx.SetContext(ctx)
+	defer t.tx.SetContext(nil)
+
 	if t.opsExecutors[inst.Decls[0].Token] == nil {
 		return nil, nil, NotImplemented
 	}
 
+	t.columnAttrs = nil
+	t.now = t.e.memstore.Now()
+
+	t.tx.StartStatement()
+	defer t.tx.Release()
 	_, _, cols, res, err := t.opsExecutors[inst.Decls[0].Token](t, inst.Decls[0], args)
 	if err != nil {
-		return nil, nil, err
+		t.tx.RollbackStatement()
+		return nil, nil, locate(query, inst.Decls[0], err)
 	}
 
 	return cols, res, nil
 }
 
+// SetSession makes transaction read and change variables of session s, which
+// is kept by the connection across transactions.
+func (t *Tx) SetSession(s *Session) {
+	t.session = s
+	t.apply()
+}
+
+// ColumnAttributes returns, for each column returned by last QueryContext call,
+// the relation attribute it was read from. Computed columns yield a nil attribute.
+func (t *Tx) ColumnAttributes() []*agnostic.Attribute {
+	return t.columnAttrs
+}
+
 // Commit the transaction on server
 func (t *Tx) Commit() error {
 	_, err := t.tx.Commit()
@@ -99,279 +178,1146 @@ func (t *Tx) Rollback() error {
 	return nil
 }
 
+// Reset rolls back pending changes and makes transaction usable again after
+// Commit or an error, keeping its session
+func (t *Tx) Reset() {
+	t.tx.Reset()
+	t.columnAttrs = nil
+	t.outer = nil
+}
+
 func (t *Tx) ExecContext(ctx context.Context, query string, args []NamedValue) (int64, int64, error) {
 	log.Info("ExecContext(%p, %s)", t.tx, query)
 
-	instructions, err := parser.ParseInstruction(query)
+	s, err := Prepare(query)
 	if err != nil {
 		return 0, 0, err
 	}
 
-	var lastInsertedID, rowsAffected, aff int64
+	return t.ExecStatement(ctx, s, args)
+}
+
+// ExecStatement executes prepared statement s with args, like ExecContext
+func (t *Tx) ExecStatement(ctx context.Context, s *Statement, args []NamedValue) (int64, int64, error) {
+	query, instructions := s.query, s.instructions
+
+	if err := checkArgs(instructions, args); err != nil {
+		return 0, 0, err
+	}
+
+	defer t.tx.SetContext(nil)
+
+	var lastInsertedID, rowsAffected int64
 	for _, instruct := range instructions {
-		lastInsertedID, aff, err = t.executeQuery(instruct, args)
-		if err != nil {
+		if err := ctx.Err(); err != nil {
 			return 0, 0, err
 		}
+		sctx, cancel := t.statementContext(ctx)
+		t.tx.SetContext(sctx)
+		id, aff, err := t.executeQuery(instruct, args)
+		cancel()
+		if err != nil {
+			return 0, 0, locate(query, instruct.Decls[0], err)
+		}
+		// keep id generated by last INSERT of the batch
+		if id != 0 {
+			lastInsertedID = id
+		}
 		rowsAffected += aff
 	}
 
 	return lastInsertedID, rowsAffected, nil
 }
 
-func (t *Tx) executeQuery(i parser.Instruction, args []NamedValue) (int64, int64, error) {
-
-	if t.opsExecutors[i.Decls[0].Token] == nil {
-		return 0, 0, NotImplemented
-	}
+// ExecBatch executes prepared statement s once for each argument set of
+// batch, as a single statement: if an execution fails, changes of the whole
+// batch are reverted, and transaction is aborted unless statement level
+// rollback is set. It returns the number of rows affected by the batch.
+func (t *Tx) ExecBatch(ctx context.Context, s *Statement, batch [][]NamedValue) (int64, error) {
+	query, instructions := s.query, s.instructions
 
-	l, r, _, _, err := t.opsExecutors[i.Decls[0].Token](t, i.Decls[0], args)
-	if err != nil {
-		return 0, 0, err
+	for i, args := range batch {
+		if err := checkArgs(instructions, args); err != nil {
+			return 0, fmt.Errorf("batch[%d]: %w", i, err)
+		}
 	}
 
-	return l, r, nil
-}
+	ctx, cancel := t.statementContext(ctx)
+	defer cancel()
+	t.tx.SetContext(ctx)
+	defer t.tx.SetContext(nil)
 
-func (t *Tx) getSelector(attr *parser.Decl, schema string, tables []string, aliases map[string]string) (agnostic.Selector, error) {
-	var err error
+	t.now = t.e.memstore.Now()
+	t.tx.StartStatement()
+	defer t.tx.Release()
 
-	switch attr.Token {
-	case parser.StarToken:
-		return agnostic.NewStarSelector(tables[0]), nil
-	case parser.CountToken:
-		for _, table := range tables {
-			if attr.Decl[0].Lexeme == "*" {
-				return agnostic.NewCountSelector(table, "*"), nil
+	var rowsAffected int64
+	for i, args := range batch {
+		for _, instruct := range instructions {
+			if err := context.Cause(ctx); err != nil {
+				return 0, t.tx.Abort(err)
 			}
-			_, _, err = t.tx.RelationAttribute(schema, getAlias(table, aliases), attr.Decl[0].Lexeme)
-			if err == nil {
-				return agnostic.NewCountSelector(table, attr.Decl[0].Lexeme), nil
+			if t.opsExecutors[instruct.Decls[0].Token] == nil {
+				return 0, t.tx.Abort(NotImplemented)
 			}
-		}
-		return nil, err
-	case parser.StringToken:
-		attribute := attr.Lexeme
-		if len(attr.Decl) > 0 {
-			a := getAlias(attr.Decl[0].Lexeme, aliases)
-			_, _, err = t.tx.RelationAttribute(schema, a, attribute)
+			_, aff, _, _, err := t.opsExecutors[instruct.Decls[0].Token](t, instruct.Decls[0], args)
+			// relations materialized by an execution are not seen by the next one
+			t.tx.Release()
 			if err != nil {
-				return nil, err
+				return 0, fmt.Errorf("batch[%d]: %w", i, t.tx.Abort(locate(query, instruct.Decls[0], err)))
 			}
-
-			if attr.Decl[0].Lexeme != a {
-				return agnostic.NewAttributeSelector(a, []string{attribute}, agnostic.WithAlias(attr.Decl[0].Lexeme)), nil
-			}
-			return agnostic.NewAttributeSelector(attr.Decl[0].Lexeme, []string{attribute}), nil
+			rowsAffected += aff
 		}
-		for _, table := range tables {
-			_, _, err = t.tx.RelationAttribute(schema, getAlias(table, aliases), attribute)
-			if err == nil {
-				return agnostic.NewAttributeSelector(table, []string{attribute}), nil
-			}
-		}
-		return nil, err
 	}
 
-	return nil, fmt.Errorf("cannot handle %s", attr.Lexeme)
+	return rowsAffected, nil
 }
 
-func getSelectedTables(fromDecl *parser.Decl) (string, []string, map[string]string) {
-	var tables []string
-	var schema string
+// statementContext returns ctx, canceled once statement_timeout elapsed if
+// set, with a QueryCanceled error as cause. Scans, joins and lock waits of
+// the statement then fail with that error. Returned function releases the
+// timer and must be called once statement is done.
+func (t *Tx) statementContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	d := t.session.StatementTimeout()
+	if d <= 0 {
+		return ctx, func() {}
+	}
 
-	aliases := make(map[string]string)
+	ctx, cancel := context.WithCancelCause(ctx)
+	timer := time.AfterFunc(d, func() {
+		cancel(agnostic.WrapError(agnostic.QueryCanceled, agnostic.ErrStatementTimeout))
+	})
+	return ctx, func() {
+		timer.Stop()
+		cancel(context.Canceled)
+	}
+}
 
-	for _, t := range fromDecl.Decl {
-		schema = ""
-		if d, ok := t.Has(parser.SchemaToken); ok {
-			schema = d.Lexeme
+// syntaxError returns lexer or parser error err as a syntax error located
+// in query
+func syntaxError(query string, err error) error {
+	e := agnostic.WrapError(agnostic.SyntaxError, err)
+	var pe *parser.PositionError
+	if errors.As(err, &pe) {
+		e.At(query, pe.Pos)
+	}
+	return e
+}
+
+// locate sets the position in query of an undefined, ambiguous or
+// ungrouped column or undefined relation error returned by executing decl,
+// at the first token naming it
+func locate(query string, decl *parser.Decl, err error) error {
+	var e *agnostic.Error
+	if !errors.As(err, &e) || e.Position != 0 {
+		return err
+	}
+
+	var name string
+	// an ambiguous column is referenced without relation, the relation
+	// being the first child of a qualified reference
+	unqualified := false
+	switch e.Code {
+	case agnostic.UndefinedColumn, agnostic.GroupingError:
+		name = e.Column
+	case agnostic.AmbiguousColumn:
+		name, unqualified = e.Column, true
+	case agnostic.UndefinedTable:
+		name = e.Table
+	default:
+		return err
+	}
+
+	pos, found := 0, false
+	var walk func(d *parser.Decl)
+	walk = func(d *parser.Decl) {
+		if unqualified && len(d.Decl) > 0 && d.Decl[0].Token == parser.StringToken {
+			for _, c := range d.Decl {
+				walk(c)
+			}
+			return
+		}
+		if d.Token == parser.StringToken && d.Pos > 0 && strings.EqualFold(d.Lexeme, name) && (!found || d.Pos < pos) {
+			pos, found = d.Pos, true
 		}
-		if d, ok := t.Has(parser.AsToken); ok {
-			aliases[d.Decl[0].Lexeme] = t.Lexeme
+		for _, c := range d.Decl {
+			walk(c)
 		}
-		tables = append(tables, t.Lexeme)
 	}
-
-	return schema, tables, aliases
+	walk(decl)
+	if found {
+		e.At(query, pos)
+	}
+	return err
 }
 
-func (t *Tx) getPredicates(decl []*parser.Decl, schema, fromTableName string, args []NamedValue, aliases map[string]string) (agnostic.Predicate, error) {
-	var odbcIdx int64 = 1
-
-	for i, cond := range decl {
+// checkArgs returns an error if instructions reference a placeholder without
+// matching argument, or if provided arguments are not all referenced.
+//
+// Positional placeholders ($1 or ?) and named placeholders (:name, @name or
+// $name) cannot be mixed in the same statement.
+func checkArgs(instructions []parser.Instruction, args []NamedValue) error {
+	max := 0
+	names := make(map[string]bool)
+
+	var walk func(d *parser.Decl) error
+	walk = func(d *parser.Decl) error {
+		switch d.Token {
+		case parser.ArgToken:
+			idx, err := strconv.Atoi(d.Lexeme)
+			if err != nil || idx < 1 {
+				return fmt.Errorf("invalid placeholder $%s", d.Lexeme)
+			}
+			if idx > max {
+				max = idx
+			}
+		case parser.NamedArgToken:
+			names[d.Lexeme] = true
+		}
+		for _, c := range d.Decl {
+			if err := walk(c); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
 
-		if cond.Token == parser.AndToken {
-			if i+1 == len(decl) {
-				return nil, fmt.Errorf("query error: AND not followed by any predicate")
+	for _, i := range instructions {
+		for _, d := range i.Decls {
+			if err := walk(d); err != nil {
+				return err
 			}
+		}
+	}
 
-			p, err := t.and(decl[:i], decl[i+1:], schema, fromTableName, args, aliases)
-			return p, err
+	if max > 0 && len(names) > 0 {
+		return fmt.Errorf("cannot mix positional and named placeholders in the same statement")
+	}
+
+	if len(names) == 0 {
+		if max > len(args) {
+			return fmt.Errorf("reference to $%d, but only %d argument provided", max, len(args))
+		}
+		if max != len(args) {
+			return fmt.Errorf("expected %d arguments, got %d", max, len(args))
 		}
+		return nil
+	}
 
-		if cond.Token == parser.OrToken {
-			if i+1 == len(decl) {
-				return nil, fmt.Errorf("query error: OR not followd by any predicate")
+	provided := make(map[string]bool, len(args))
+	for _, arg := range args {
+		if _, ok := names[arg.Name]; !ok {
+			if arg.Name == "" {
+				return fmt.Errorf("positional argument %d provided to a statement with named placeholders", arg.Ordinal)
 			}
-			p, err := t.or(decl[:i], decl[i+1:], schema, fromTableName, args, aliases)
-			return p, err
+			return fmt.Errorf("named argument %s is not referenced", arg.Name)
 		}
+		provided[arg.Name] = true
 	}
+	for name := range names {
+		if !provided[name] {
+			return fmt.Errorf("no named argument found for '%s'", name)
+		}
+	}
+	return nil
+}
 
-	var err error
-	cond := decl[0]
+func (t *Tx) executeQuery(i parser.Instruction, args []NamedValue) (int64, int64, error) {
 
-	// 1 PREDICATE
-	if cond.Lexeme == "1" {
-		log.Debug("Cond is %+v, returning TruePredicate", cond)
-		return agnostic.NewTruePredicate(), nil
+	if t.opsExecutors[i.Decls[0].Token] == nil {
+		return 0, 0, NotImplemented
 	}
 
-	switch cond.Decl[0].Token {
-	case parser.IsToken, parser.InToken, parser.EqualityToken, parser.DistinctnessToken, parser.LeftDipleToken, parser.RightDipleToken, parser.LessOrEqualToken, parser.GreaterOrEqualToken:
-		break
-	default:
-		fromTableName = cond.Decl[0].Lexeme
-		cond.Decl = cond.Decl[1:]
+	t.now = t.e.memstore.Now()
+	t.tx.StartStatement()
+	defer t.tx.Release()
+	l, r, _, _, err := t.opsExecutors[i.Decls[0].Token](t, i.Decls[0], args)
+	if err != nil {
+		t.tx.RollbackStatement()
+		return 0, 0, err
 	}
 
-	pLeftValue := strings.ToLower(cond.Lexeme)
+	return l, r, nil
+}
 
-	fromTableName = getAlias(fromTableName, aliases)
+// getAggregate returns the selector of aggregate function decl attr
+func (t *Tx) getAggregate(attr *parser.Decl, schema string, tables []string, aliases map[string]string) (agnostic.Selector, error) {
+	if attr.Token == parser.CountToken && attr.Decl[0].Lexeme == "*" {
+		return agnostic.NewCountSelector(tables[0], "*"), nil
+	}
+	rel, err := t.attributeRelation(attr.Decl[0], schema, tables, aliases)
+	if err != nil {
+		return nil, err
+	}
+	switch attr.Token {
+	case parser.CountToken:
+		return agnostic.NewCountSelector(rel, attr.Decl[0].Lexeme), nil
+	case parser.MaxToken:
+		c := t.implicitCollation(attr.Decl[0], schema, tables, aliases)
+		return agnostic.NewMaxSelector(rel, attr.Decl[0].Lexeme).WithCollation(c), nil
+	case parser.MinToken:
+		c := t.implicitCollation(attr.Decl[0], schema, tables, aliases)
+		return agnostic.NewMinSelector(rel, attr.Decl[0].Lexeme).WithCollation(c), nil
+	case parser.SumToken:
+		return agnostic.NewSumSelector(rel, attr.Decl[0].Lexeme), nil
+	default:
+		return agnostic.NewAvgSelector(rel, attr.Decl[0].Lexeme), nil
+	}
+}
 
-	_, _, err = t.tx.RelationAttribute(schema, fromTableName, pLeftValue)
+// getOrderedSetAggregate returns the selector of ordered-set aggregate call
+// decl, like percentile_cont(0.5) WITHIN GROUP (ORDER BY attribute).
+// Arguments before WITHIN GROUP must be constants.
+func (t *Tx) getOrderedSetAggregate(decl *parser.Decl, withinDecl *parser.Decl, schema string, tables []string, aliases map[string]string, args []NamedValue) (agnostic.Selector, error) {
+	if len(withinDecl.Decl) != 1 || len(withinDecl.Decl[0].Decl) != 1 {
+		return nil, fmt.Errorf("%s requires a single ORDER BY attribute", decl.Lexeme)
+	}
+	attr := withinDecl.Decl[0].Decl[0]
+	if attr.Token != parser.StringToken {
+		return nil, fmt.Errorf("%s can only order by attributes, got %s", decl.Lexeme, attr.Lexeme)
+	}
+	rel, err := t.attributeRelation(attr, schema, tables, aliases)
 	if err != nil {
 		return nil, err
 	}
+	direction := agnostic.ASC
+	if _, ok := attr.Has(parser.DescToken); ok {
+		direction = agnostic.DESC
+	}
 
-	// Handle IN keyword
-	if cond.Decl[0].Token == parser.InToken {
-		p, err := inExecutor(fromTableName, pLeftValue, cond.Decl[0])
+	var values []any
+	for _, d := range decl.Decl {
+		if d.Token == parser.WithinToken || d.Token == parser.FilterToken {
+			continue
+		}
+		f, err := t.valueFunctor(d, "", nil, args, nil)
 		if err != nil {
 			return nil, err
 		}
-		return p, nil
-	}
-
-	// Handle NOT IN keywords
-	if cond.Decl[0].Token == parser.NotToken && cond.Decl[0].Decl[0].Token == parser.InToken {
-		p, err := notInExecutor(fromTableName, pLeftValue, cond.Decl[0])
+		if len(f.Attribute()) > 0 {
+			return nil, fmt.Errorf("arguments of %s must be constants", decl.Lexeme)
+		}
+		v, err := f.Value(nil, nil)
 		if err != nil {
 			return nil, err
 		}
-		return p, nil
+		values = append(values, v)
 	}
 
-	// Handle IS NULL and IS NOT NULL
-	if cond.Decl[0].Token == parser.IsToken {
-		p, err := isExecutor(fromTableName, pLeftValue, cond.Decl[0])
-		if err != nil {
-			return nil, err
+	switch decl.Lexeme {
+	case "percentile_cont":
+		if len(values) != 1 {
+			return nil, fmt.Errorf("function percentile_cont requires a fraction argument")
 		}
-		return p, nil
+		return agnostic.NewPercentileContSelector(rel, attr.Lexeme, values[0], direction)
+	case "mode":
+		if len(values) != 0 {
+			return nil, fmt.Errorf("function mode does not accept arguments")
+		}
+		return agnostic.NewModeSelector(rel, attr.Lexeme, direction), nil
 	}
+	return nil, fmt.Errorf("ordered-set aggregate %s does not exist", decl.Lexeme)
+}
 
-	if len(cond.Decl) < 2 {
-		return nil, fmt.Errorf("Malformed predicate \"%s\"", cond.Lexeme)
+// filterAggregate returns aggregate selector s computed on rows matching the
+// FILTER clause of aggregate decl attr, if any.
+func (t *Tx) filterAggregate(s agnostic.Selector, attr *parser.Decl, schema string, tables []string, aliases map[string]string, args []NamedValue) (agnostic.Selector, error) {
+	filterDecl, ok := attr.Has(parser.FilterToken)
+	if !ok || len(filterDecl.Decl) == 0 {
+		return s, nil
 	}
+	p, err := t.getPredicates(filterDecl.Decl[0].Decl, schema, tables[0], args, aliases)
+	if err != nil {
+		return nil, err
+	}
+	return agnostic.NewFilterSelector(s, p), nil
+}
 
-	leftS := cond
-	op := cond.Decl[0]
-	rightS := cond.Decl[1]
-
-	var left, right agnostic.ValueFunctor
+func (t *Tx) getSelector(attr *parser.Decl, schema string, tables []string, aliases map[string]string, args []NamedValue) (agnostic.Selector, error) {
+	var err error
 
-	switch leftS.Token {
-	case parser.CurrentSchemaToken:
-		left = agnostic.NewConstValueFunctor(schema)
-	case parser.NamedArgToken:
-		for _, arg := range args {
-			if leftS.Lexeme == arg.Name {
-				left = agnostic.NewConstValueFunctor(arg.Value)
-				break
-			}
+	switch attr.Token {
+	case parser.StarToken:
+		if len(attr.Decl) > 0 {
+			return agnostic.NewStarSelector(attr.Decl[0].Lexeme), nil
 		}
-		if left == nil {
-			return nil, fmt.Errorf("no named argument found for '%s'", leftS.Lexeme)
+		return agnostic.NewStarSelector(tables[0]), nil
+	case parser.CountToken, parser.MaxToken, parser.MinToken, parser.SumToken, parser.AvgToken:
+		s, err := t.getAggregate(attr, schema, tables, aliases)
+		if err != nil {
+			return nil, err
 		}
-	case parser.ArgToken:
-		var idx int64
-		if rightS.Lexeme == "?" {
-			idx = odbcIdx
-			odbcIdx++
-		} else {
-			idx, err = strconv.ParseInt(rightS.Lexeme, 10, 64)
+		return t.filterAggregate(s, attr, schema, tables, aliases, args)
+	case parser.NumberToken:
+		v, err := agnostic.ToInstance(attr.Lexeme, parser.TypeNameFromToken(attr.Token))
+		if err != nil {
+			return nil, err
+		}
+		return agnostic.NewConstSelector(tables[0], "?column?", v), nil
+	case parser.SimpleQuoteToken, parser.FloatToken, parser.NullToken, parser.ArgToken, parser.NamedArgToken,
+		parser.NowToken, parser.LocalTimestampToken, parser.CurrentDateToken, parser.IntervalToken:
+		v, err := t.constantValue(attr, args)
+		if err != nil {
+			return nil, err
+		}
+		return agnostic.NewConstSelector(tables[0], "?column?", v), nil
+	case parser.FunctionToken:
+		if withinDecl, ok := withinGroup(attr); ok {
+			s, err := t.getOrderedSetAggregate(attr, withinDecl, schema, tables, aliases, args)
 			if err != nil {
 				return nil, err
 			}
+			return t.filterAggregate(s, attr, schema, tables, aliases, args)
 		}
-		if len(args) <= int(idx)-1 {
-			return nil, fmt.Errorf("reference to $%s, but only %d argument provided", leftS.Lexeme, len(args))
+		f, err := t.valueFunctor(attr, schema, tables, args, aliases)
+		if err != nil {
+			return nil, err
 		}
-		left = agnostic.NewConstValueFunctor(args[idx-1].Value)
-	default:
-		left = agnostic.NewAttributeValueFunctor(fromTableName, pLeftValue)
-	}
-
-	switch rightS.Token {
-	case parser.CurrentSchemaToken:
-		left = agnostic.NewConstValueFunctor(schema)
-	case parser.NamedArgToken:
-		for _, arg := range args {
-			if rightS.Lexeme == arg.Name {
-				right = agnostic.NewConstValueFunctor(arg.Value)
-				break
+		return agnostic.NewExpressionSelector(tables[0], attr.Lexeme, f), nil
+	case parser.PlusToken, parser.MinusToken:
+		f, err := t.valueFunctor(attr, schema, tables, args, aliases)
+		if err != nil {
+			return nil, err
+		}
+		return agnostic.NewExpressionSelector(tables[0], "?column?", f), nil
+	case parser.ArrayToken, parser.SubscriptToken:
+		f, err := t.valueFunctor(attr, schema, tables, args, aliases)
+		if err != nil {
+			return nil, err
+		}
+		// tags[1] is named after the array
+		name := "array"
+		if attr.Token == parser.SubscriptToken {
+			name = "?column?"
+			if attr.Decl[0].Token == parser.StringToken {
+				name = attr.Decl[0].Lexeme
 			}
 		}
-		if right == nil {
-			return nil, fmt.Errorf("no named argument found for '%s'", rightS.Lexeme)
+		return agnostic.NewExpressionSelector(tables[0], name, f), nil
+	case parser.CastToken:
+		if len(attr.Decl) < 2 {
+			return nil, ParsingError
 		}
-	case parser.ArgToken:
-		var idx int64
-		if rightS.Lexeme == "?" {
-			idx = odbcIdx
-			odbcIdx++
-		} else {
-			idx, err = strconv.ParseInt(rightS.Lexeme, 10, 64)
+		src, err := t.getSelector(attr.Decl[0], schema, tables, aliases, args)
+		if err != nil {
+			return nil, err
+		}
+		s, err := agnostic.NewCastSelector(src, attr.Decl[1].Lexeme)
+		if err != nil {
+			return nil, err
+		}
+		return s, nil
+	case parser.StringToken:
+		attribute := attr.Lexeme
+		if len(attr.Decl) > 0 {
+			a := getAlias(attr.Decl[0].Lexeme, aliases)
+			err = t.checkAttribute(schema, a, attribute)
 			if err != nil {
 				return nil, err
 			}
+
+			// column is named after the attribute, whether relation is
+			// referenced by its name or by an alias
+			if attr.Decl[0].Lexeme != a {
+				s := agnostic.NewAttributeSelector(a, []string{attribute}, agnostic.WithAlias(attr.Decl[0].Lexeme))
+				return agnostic.NewNamedSelector(s, attribute), nil
+			}
+			return agnostic.NewAttributeSelector(attr.Decl[0].Lexeme, []string{attribute}), nil
 		}
-		if len(args) <= int(idx)-1 {
-			return nil, fmt.Errorf("reference to $%s, but only %d argument provided", rightS.Lexeme, len(args))
+		table, err := t.relationOf(schema, attribute, tables, aliases)
+		if err != nil {
+			return nil, err
 		}
-		right = agnostic.NewConstValueFunctor(args[idx-1].Value)
-	default:
-		v, err := agnostic.ToInstance(rightS.Lexeme, parser.TypeNameFromToken(rightS.Token))
+		return agnostic.NewAttributeSelector(table, []string{attribute}), nil
+	case parser.SelectToken, parser.UnionToken, parser.IntersectToken, parser.ExceptToken:
+		name, v, err := t.scalarSubquery(attr, args)
 		if err != nil {
 			return nil, err
 		}
-		right = agnostic.NewConstValueFunctor(v)
-	}
-
-	var ptype agnostic.PredicateType
-	switch op.Token {
-	case parser.EqualityToken:
-		ptype = agnostic.Eq
-	case parser.LessOrEqualToken:
-		ptype = agnostic.Leq
-	case parser.GreaterOrEqualToken:
-		ptype = agnostic.Geq
-	case parser.DistinctnessToken:
-		ptype = agnostic.Neq
-	case parser.LeftDipleToken:
-		ptype = agnostic.Le
-	case parser.RightDipleToken:
-		ptype = agnostic.Ge
-	default:
-		return nil, fmt.Errorf("unknown comparison token %s", op.Lexeme)
+		return agnostic.NewConstSelector(tables[0], name, v), nil
 	}
 
-	return agnostic.NewComparisonPredicate(left, ptype, right)
+	return nil, fmt.Errorf("cannot handle %s", attr.Lexeme)
 }
 
-func (t *Tx) and(left []*parser.Decl, right []*parser.Decl, schema, tableName string, args []NamedValue, aliases map[string]string) (agnostic.Predicate, error) {
+// checkAttribute returns an error if attribute does not exist in relation.
+// Every relation has the row version pseudo-attribute.
+func (t *Tx) checkAttribute(schema, relation, attribute string) error {
+	// a SELECT without FROM clause reads no attribute
+	if relation == "" {
+		return agnostic.NewError(agnostic.UndefinedColumn, "column %s does not exist", attribute).On("", attribute)
+	}
+	_, _, err := t.tx.RelationAttribute(schema, relation, attribute)
+	if err != nil && strings.EqualFold(attribute, agnostic.VersionAttribute) {
+		if _, rerr := t.tx.RelationAttributes(schema, relation); rerr == nil {
+			return nil
+		}
+	}
+	// derived relations have internal names, do not leak them
+	if err != nil && strings.Contains(relation, "#") {
+		return agnostic.NewError(agnostic.UndefinedColumn, "column %s does not exist", attribute).On("", attribute)
+	}
+	return err
+}
+
+// attributeRelation returns the relation name referencing an attribute used
+// by a function, like an aggregate or a window.
+func (t *Tx) attributeRelation(attr *parser.Decl, schema string, tables []string, aliases map[string]string) (string, error) {
+	if isQualified(attr) {
+		err := t.checkAttribute(schema, getAlias(attr.Decl[0].Lexeme, aliases), attr.Lexeme)
+		if err != nil {
+			return "", err
+		}
+		return attr.Decl[0].Lexeme, nil
+	}
+
+	return t.relationOf(schema, attr.Lexeme, tables, aliases)
+}
+
+// isAmbiguous returns true if err is an ambiguous attribute error
+func isAmbiguous(err error) bool {
+	var e *agnostic.Error
+	return errors.As(err, &e) && e.Code == agnostic.AmbiguousColumn
+}
+
+// relationOf returns the relation among tables holding unqualified
+// attribute name. An attribute of several relations is ambiguous, unless
+// merged by a join of the query being built.
+func (t *Tx) relationOf(schema, name string, tables []string, aliases map[string]string) (string, error) {
+	var rel string
+	var err error
+	for _, table := range tables {
+		if err = t.checkAttribute(schema, getAlias(table, aliases), name); err != nil {
+			continue
+		}
+		if rel == "" {
+			rel = table
+			continue
+		}
+		if t.scope == nil || !t.scope.merged[name] {
+			return "", agnostic.NewError(agnostic.AmbiguousColumn, "column reference \"%s\" is ambiguous", name).On("", name)
+		}
+	}
+	if rel != "" {
+		return rel, nil
+	}
+	return "", err
+}
+
+// getWindow builds the window computing a window function call, whose values
+// are returned in column name.
+func (t *Tx) getWindow(decl *parser.Decl, name string, schema string, tables []string, aliases map[string]string, args []NamedValue) (*agnostic.Window, error) {
+	overDecl, ok := decl.Has(parser.OverToken)
+	if !ok {
+		return nil, ParsingError
+	}
+
+	var partition, order []agnostic.WindowKey
+	for _, d := range overDecl.Decl {
+		for _, attr := range d.Decl {
+			if attr.Token != parser.StringToken {
+				return nil, fmt.Errorf("window can only use attributes, got %s", attr.Lexeme)
+			}
+			rel, err := t.attributeRelation(attr, schema, tables, aliases)
+			if err != nil {
+				return nil, err
+			}
+			direction := agnostic.ASC
+			if _, ok := attr.Has(parser.DescToken); ok {
+				direction = agnostic.DESC
+			}
+
+			key := agnostic.NewWindowKey(rel, attr.Lexeme, direction)
+			switch d.Token {
+			case parser.PartitionToken:
+				partition = append(partition, key)
+			case parser.OrderToken:
+				order = append(order, key)
+			}
+		}
+	}
+
+	var f agnostic.WindowFunction
+	switch decl.Token {
+	case parser.RowNumberToken:
+		f = agnostic.NewRowNumberFunction()
+	case parser.RankToken:
+		f = agnostic.NewRankFunction()
+	case parser.DenseRankToken:
+		f = agnostic.NewDenseRankFunction()
+	case parser.CountToken, parser.MaxToken, parser.MinToken, parser.SumToken, parser.AvgToken:
+		selector, err := t.getSelector(decl, schema, tables, aliases, args)
+		if err != nil {
+			return nil, err
+		}
+		f = agnostic.NewAggregateFunction(selector)
+	case parser.LagToken, parser.LeadToken:
+		var err error
+		f, err = t.getNeighborFunction(decl, schema, tables, aliases, args)
+		if err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unknown window function %s", decl.Lexeme)
+	}
+
+	return agnostic.NewWindow(name, f, partition, order), nil
+}
+
+// getNeighborFunction builds a LAG or LEAD window function, reading attribute
+// offset rows before or after current row, 1 by default. Default value is
+// returned when there is no such row, NULL by default.
+func (t *Tx) getNeighborFunction(decl *parser.Decl, schema string, tables []string, aliases map[string]string, args []NamedValue) (agnostic.WindowFunction, error) {
+	var params []*parser.Decl
+	for _, d := range decl.Decl {
+		if d.Token != parser.OverToken {
+			params = append(params, d)
+		}
+	}
+	if len(params) == 0 {
+		return nil, ParsingError
+	}
+
+	rel, err := t.attributeRelation(params[0], schema, tables, aliases)
+	if err != nil {
+		return nil, err
+	}
+
+	offset := int64(1)
+	if len(params) > 1 {
+		offset, err = intValue(params[1], args)
+		if err != nil {
+			return nil, fmt.Errorf("wrong %s offset: %s", decl.Lexeme, err)
+		}
+	}
+
+	var def any
+	if len(params) > 2 {
+		switch d := params[2]; d.Token {
+		case parser.NullToken:
+		case parser.ArgToken, parser.NamedArgToken:
+			def, err = argValue(d, args)
+		default:
+			def, err = agnostic.ToInstance(d.Lexeme, parser.TypeNameFromToken(d.Token))
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if decl.Token == parser.LeadToken {
+		return agnostic.NewLeadFunction(rel, params[0].Lexeme, offset, def), nil
+	}
+	return agnostic.NewLagFunction(rel, params[0].Lexeme, offset, def), nil
+}
+
+// scalarSubquery executes a subquery used as an expression and returns its
+// column name and its single value. A subquery returning no row yields NULL.
+func (t *Tx) scalarSubquery(selectDecl *parser.Decl, args []NamedValue) (string, any, error) {
+	_, _, cols, res, err := queryExecutor(t, selectDecl, args)
+	if err != nil {
+		return "", nil, err
+	}
+
+	if len(cols) != 1 {
+		return "", nil, fmt.Errorf("subquery must return only one column, got %d", len(cols))
+	}
+	if len(res) > 1 {
+		return "", nil, fmt.Errorf("more than one row returned by a subquery used as an expression")
+	}
+
+	name := cols[0]
+	if idx := strings.LastIndex(name, "."); idx != -1 {
+		name = name[idx+1:]
+	}
+
+	if len(res) == 0 {
+		return name, nil, nil
+	}
+	return name, res[0].Values()[0], nil
+}
+
+// getSelectedTables returns the schema of a SELECT statement, the names
+// referencing its relations, from its FROM clause then its JOIN clauses, and
+// the relation of each alias.
+//
+// Relations are referenced by their alias if any, by their name otherwise, and
+// names must be distinct, so a relation read twice needs an alias.
+//
+// When relations belong to different schemas, statement schema is empty and
+// qualified relations are referenced with their qualified name, see
+// agnostic.QualifiedName.
+func getSelectedTables(selectDecl *parser.Decl) (string, []string, map[string]string, error) {
+	var tables []string
+	var schemas []string
+
+	aliases := make(map[string]string)
+	names := make(map[string]bool)
+	relations := make(map[string]string)
+
+	add := func(t *parser.Decl) error {
+		name := t.Lexeme
+		if alias, ok := fromAlias(t); ok {
+			name = alias
+			aliases[name] = t.Lexeme
+		}
+		if names[name] {
+			return fmt.Errorf("table name %s specified more than once", name)
+		}
+		names[name] = true
+		tables = append(tables, name)
+		relations[name] = t.Lexeme
+		if isDerived(t) {
+			relations[name] = derivedRelation(t)
+			aliases[name] = relations[name]
+		}
+
+		schema := ""
+		if d, ok := t.Has(parser.SchemaToken); ok && !isDerived(t) {
+			schema = d.Lexeme
+		}
+		schemas = append(schemas, schema)
+		return nil
+	}
+
+	for _, d := range selectDecl.Decl {
+		switch d.Token {
+		case parser.FromToken:
+			for _, t := range d.Decl {
+				if err := add(t); err != nil {
+					return "", nil, nil, err
+				}
+			}
+		case parser.JoinToken:
+			if len(d.Decl) == 0 {
+				return "", nil, nil, ParsingError
+			}
+			if err := add(d.Decl[0]); err != nil {
+				return "", nil, nil, err
+			}
+		}
+	}
+
+	for _, s := range schemas {
+		if s != schemas[0] {
+			for i, name := range tables {
+				if schemas[i] != "" {
+					aliases[name] = agnostic.QualifiedName(schemas[i], relations[name])
+				}
+			}
+			return "", tables, aliases, nil
+		}
+	}
+
+	schema := ""
+	if len(schemas) > 0 {
+		schema = schemas[0]
+	}
+	return schema, tables, aliases, nil
+}
+
+// derivedRelation returns the name of the relation materializing the rows of
+// a function call or of a subquery in a FROM or JOIN clause, unique to decl.
+func derivedRelation(decl *parser.Decl) string {
+	return fmt.Sprintf("%s#%p", decl.Lexeme, decl)
+}
+
+// isDerived returns true if decl, in a FROM or JOIN clause, is a function
+// call or a subquery rather than a relation name
+func isDerived(decl *parser.Decl) bool {
+	return decl.Token == parser.FunctionToken || isQuery(decl)
+}
+
+// fromAlias returns the alias of relation decl of a FROM or JOIN clause, if
+// any. The alias of a subquery is its last child, other AS clauses it holds
+// belong to the subquery itself.
+func fromAlias(decl *parser.Decl) (string, bool) {
+	if isQuery(decl) {
+		if n := len(decl.Decl); n > 0 && decl.Decl[n-1].Token == parser.AsToken && len(decl.Decl[n-1].Decl) > 0 {
+			return decl.Decl[n-1].Decl[0].Lexeme, true
+		}
+		return "", false
+	}
+	if d, ok := decl.Has(parser.AsToken); ok && len(d.Decl) > 0 {
+		return d.Decl[0].Lexeme, true
+	}
+	return "", false
+}
+
+// materializeDerived materializes the rows of function calls and subqueries
+// in FROM and JOIN clauses of selectDecl as relations read by the statement.
+// Rows are computed once per statement.
+func (t *Tx) materializeDerived(selectDecl *parser.Decl, args []NamedValue) error {
+	var items []*parser.Decl
+	for _, d := range selectDecl.Decl {
+		switch d.Token {
+		case parser.FromToken:
+			items = append(items, d.Decl...)
+		case parser.JoinToken:
+			if len(d.Decl) > 0 {
+				items = append(items, d.Decl[0])
+			}
+		}
+	}
+
+	for _, item := range items {
+		if !isDerived(item) || t.tx.Materialized(derivedRelation(item)) {
+			continue
+		}
+
+		var attributes []agnostic.Attribute
+		var rows []*agnostic.Tuple
+		var err error
+		if item.Token == parser.FunctionToken {
+			attributes, rows, err = t.callFunction(item, args)
+		} else {
+			attributes, rows, err = t.querySubquery(item, args)
+		}
+		if err != nil {
+			return err
+		}
+		if err := t.tx.Materialize(derivedRelation(item), attributes, rows); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// callFunction returns the rows of a function called in a FROM clause, like
+// generate_series(1, 10), in a single column named after the function or
+// its alias.
+func (t *Tx) callFunction(call *parser.Decl, args []NamedValue) ([]agnostic.Attribute, []*agnostic.Tuple, error) {
+	if call.Lexeme != "generate_series" {
+		return nil, nil, fmt.Errorf("function %s does not exist", call.Lexeme)
+	}
+
+	name := call.Lexeme
+	if alias, ok := fromAlias(call); ok {
+		name = alias
+	}
+	var values []any
+	for _, d := range call.Decl {
+		if d.Token == parser.AsToken {
+			continue
+		}
+		f, err := t.valueFunctor(d, "", nil, args, nil)
+		if err != nil {
+			return nil, nil, err
+		}
+		if len(f.Attribute()) > 0 {
+			return nil, nil, fmt.Errorf("arguments of function %s must be constants", call.Lexeme)
+		}
+		v, err := f.Value(nil, nil)
+		if err != nil {
+			return nil, nil, err
+		}
+		values = append(values, v)
+	}
+
+	rows, typeName, err := agnostic.GenerateSeries(values...)
+	if err != nil {
+		return nil, nil, err
+	}
+	return []agnostic.Attribute{agnostic.NewAttribute(name, typeName)}, rows, nil
+}
+
+// querySubquery returns the rows of a subquery in a FROM clause, with the
+// attributes inferred from its columns. Subquery decl holds its alias.
+func (t *Tx) querySubquery(subqueryDecl *parser.Decl, args []NamedValue) ([]agnostic.Attribute, []*agnostic.Tuple, error) {
+	queryDecl := &parser.Decl{Token: subqueryDecl.Token, Lexeme: subqueryDecl.Lexeme, Pos: subqueryDecl.Pos}
+	if n := len(subqueryDecl.Decl); n > 0 {
+		queryDecl.Decl = subqueryDecl.Decl[:n-1]
+	}
+
+	asDecl := &parser.Decl{Token: parser.AsToken, Lexeme: "as"}
+	asDecl.Add(queryDecl)
+	return t.queryAs("subquery in FROM", asDecl, args)
+}
+
+func (t *Tx) getPredicates(decl []*parser.Decl, schema, fromTableName string, args []NamedValue, aliases map[string]string) (agnostic.Predicate, error) {
+
+	for i, cond := range decl {
+
+		if cond.Token == parser.AndToken {
+			if i+1 == len(decl) {
+				return nil, fmt.Errorf("query error: AND not followed by any predicate")
+			}
+
+			p, err := t.and(decl[:i], decl[i+1:], schema, fromTableName, args, aliases)
+			return p, err
+		}
+
+		if cond.Token == parser.OrToken {
+			if i+1 == len(decl) {
+				return nil, fmt.Errorf("query error: OR not followd by any predicate")
+			}
+			p, err := t.or(decl[:i], decl[i+1:], schema, fromTableName, args, aliases)
+			return p, err
+		}
+	}
+
+	var err error
+	cond := decl[0]
+
+	// 1 PREDICATE
+	if cond.Lexeme == "1" {
+		log.Debug("Cond is %+v, returning TruePredicate", cond)
+		return agnostic.NewTruePredicate(), nil
+	}
+
+	// Handle EXISTS and NOT EXISTS
+	if cond.Token == parser.ExistsToken {
+		return t.existsExecutor(fromTableName, aliases, cond, args)
+	}
+	if cond.Token == parser.NotToken && len(cond.Decl) > 0 && cond.Decl[0].Token == parser.ExistsToken {
+		p, err := t.existsExecutor(fromTableName, aliases, cond.Decl[0], args)
+		if err != nil {
+			return nil, err
+		}
+		return agnostic.NewNotPredicate(p), nil
+	}
+
+	// expression op value, like CAST(attribute AS type) = value or ABS(attribute) > value
+	switch cond.Token {
+	case parser.CastToken, parser.FunctionToken, parser.PlusToken, parser.MinusToken, parser.CollateToken,
+		parser.ArrayToken, parser.SubscriptToken:
+		return t.expressionPredicate(cond, schema, fromTableName, args, aliases)
+	case parser.SimpleQuoteToken, parser.NumberToken, parser.FloatToken:
+		// parser only keeps a literal on the left of ANY(array), literal op
+		// attribute is flipped
+		if len(cond.Decl) != 2 || cond.Decl[1].Token != parser.AnyToken {
+			return nil, ParsingError
+		}
+		return t.expressionPredicate(cond, schema, fromTableName, args, aliases)
+	}
+
+	localTableName := fromTableName
+	qualified := false
+	switch cond.Decl[0].Token {
+	case parser.IsToken, parser.InToken, parser.NotToken, parser.EqualityToken, parser.DistinctnessToken, parser.RegexMatchToken, parser.ArrayOpToken, parser.LeftDipleToken, parser.RightDipleToken, parser.LessOrEqualToken, parser.GreaterOrEqualToken:
+		break
+	default:
+		fromTableName = cond.Decl[0].Lexeme
+		qualified = true
+		// copy condition, correlated subqueries evaluate it for each outer row
+		c := *cond
+		c.Decl = cond.Decl[1:]
+		cond = &c
+	}
+
+	pLeftValue := cond.Lexeme
+
+	// an unqualified attribute may belong to any relation of the query
+	if !qualified && cond.Token == parser.StringToken && t.scope != nil && len(t.scope.tables) > 1 && t.scope.tables[0] == fromTableName {
+		rname, err := t.relationOf(schema, pLeftValue, t.scope.tables, aliases)
+		if isAmbiguous(err) {
+			return nil, err
+		}
+		if err == nil {
+			fromTableName = rname
+		}
+	}
+
+	// left attribute may belong to the outer row of a correlated subquery
+	outerLeft, isOuterLeft := t.outerValue(fromTableName, pLeftValue, localTableName, aliases)
+
+	if !isOuterLeft {
+		err = t.checkAttribute(schema, getAlias(fromTableName, aliases), pLeftValue)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Handle IN keyword
+	if cond.Decl[0].Token == parser.InToken {
+		p, err := t.inExecutor(fromTableName, pLeftValue, cond.Decl[0], args)
+		if err != nil {
+			return nil, err
+		}
+		return p, nil
+	}
+
+	// Handle NOT IN keywords
+	if cond.Decl[0].Token == parser.NotToken && cond.Decl[0].Decl[0].Token == parser.InToken {
+		p, err := t.notInExecutor(fromTableName, pLeftValue, cond.Decl[0], args)
+		if err != nil {
+			return nil, err
+		}
+		return p, nil
+	}
+
+	// Handle IS NULL and IS NOT NULL
+	if cond.Decl[0].Token == parser.IsToken {
+		p, err := isExecutor(fromTableName, pLeftValue, cond.Decl[0])
+		if err != nil {
+			return nil, err
+		}
+		return p, nil
+	}
+
+	if len(cond.Decl) < 2 {
+		return nil, fmt.Errorf("Malformed predicate \"%s\"", cond.Lexeme)
+	}
+
+	leftS := cond
+	op := cond.Decl[0]
+	rightS := cond.Decl[1]
+
+	var left, right agnostic.ValueFunctor
+
+	switch leftS.Token {
+	case parser.CurrentSchemaToken:
+		left = agnostic.NewConstValueFunctor(t.currentSchema())
+	case parser.NamedArgToken:
+		for _, arg := range args {
+			if leftS.Lexeme == arg.Name {
+				left = agnostic.NewConstValueFunctor(arg.Value)
+				break
+			}
+		}
+		if left == nil {
+			return nil, fmt.Errorf("no named argument found for '%s'", leftS.Lexeme)
+		}
+	case parser.ArgToken:
+		idx, err := strconv.ParseInt(leftS.Lexeme, 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		if len(args) <= int(idx)-1 {
+			return nil, fmt.Errorf("reference to $%s, but only %d argument provided", leftS.Lexeme, len(args))
+		}
+		left = agnostic.NewConstValueFunctor(args[idx-1].Value)
+	default:
+		if isOuterLeft {
+			left = agnostic.NewConstValueFunctor(outerLeft)
+			break
+		}
+		left = t.collateAttribute(agnostic.NewAttributeValueFunctor(fromTableName, pLeftValue), schema, aliases)
+	}
+
+	// value op ANY(array)
+	if rightS.Token == parser.AnyToken {
+		return t.anyPredicate(left, op, rightS, schema, fromTableName, args, aliases)
+	}
+
+	switch rightS.Token {
+	case parser.CurrentSchemaToken:
+		right = agnostic.NewConstValueFunctor(t.currentSchema())
+	case parser.NamedArgToken:
+		for _, arg := range args {
+			if rightS.Lexeme == arg.Name {
+				right = agnostic.NewConstValueFunctor(arg.Value)
+				break
+			}
+		}
+		if right == nil {
+			return nil, fmt.Errorf("no named argument found for '%s'", rightS.Lexeme)
+		}
+	case parser.ArgToken:
+		idx, err := strconv.ParseInt(rightS.Lexeme, 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		if len(args) <= int(idx)-1 {
+			return nil, fmt.Errorf("reference to $%s, but only %d argument provided", rightS.Lexeme, len(args))
+		}
+		right = agnostic.NewConstValueFunctor(args[idx-1].Value)
+	case parser.NowToken, parser.LocalTimestampToken, parser.CurrentDateToken:
+		right = agnostic.NewConstValueFunctor(t.currentTime(rightS))
+	case parser.CastToken, parser.FunctionToken, parser.PlusToken, parser.MinusToken, parser.IntervalToken, parser.CollateToken,
+		parser.ArrayToken, parser.SubscriptToken:
+		right, err = t.valueFunctor(rightS, schema, []string{fromTableName}, args, aliases)
+		if err != nil {
+			return nil, err
+		}
+	case parser.SelectToken, parser.UnionToken, parser.IntersectToken, parser.ExceptToken:
+		_, v, err := t.scalarSubquery(rightS, args)
+		if err != nil {
+			return nil, err
+		}
+		// comparison with NULL is never true
+		if v == nil {
+			return agnostic.NewFalsePredicate(agnostic.OnRelation(fromTableName)), nil
+		}
+		right = agnostic.NewConstValueFunctor(v)
+	case parser.StringToken:
+		if len(rightS.Decl) == 0 {
+			v, err := agnostic.ToInstance(rightS.Lexeme, parser.TypeNameFromToken(rightS.Token))
+			if err != nil {
+				return nil, err
+			}
+			right = agnostic.NewConstValueFunctor(v)
+			break
+		}
+
+		// table.attribute, either of the outer row or of compared relation
+		rname, aname := rightS.Decl[0].Lexeme, rightS.Lexeme
+		if v, ok := t.outerValue(rname, aname, localTableName, aliases); ok {
+			if v == nil {
+				return agnostic.NewFalsePredicate(agnostic.OnRelation(fromTableName)), nil
+			}
+			right = agnostic.NewConstValueFunctor(v)
+			break
+		}
+		if !isOuterLeft && rname != fromTableName {
+			return nil, fmt.Errorf("cannot compare %s.%s with attribute of another relation", fromTableName, pLeftValue)
+		}
+		if err := t.checkAttribute(schema, getAlias(rname, aliases), aname); err != nil {
+			return nil, err
+		}
+		right = t.collateAttribute(agnostic.NewAttributeValueFunctor(rname, aname), schema, aliases)
+	default:
+		v, err := agnostic.ToInstance(rightS.Lexeme, parser.TypeNameFromToken(rightS.Token))
+		if err != nil {
+			return nil, err
+		}
+		right = agnostic.NewConstValueFunctor(v)
+	}
+
+	switch op.Token {
+	case parser.RegexMatchToken:
+		// a literal pattern is a string, even if it looks like a number
+		if rightS.Token == parser.StringToken && len(rightS.Decl) == 0 {
+			right = agnostic.NewConstValueFunctor(rightS.Lexeme)
+		}
+		return agnostic.NewRegexPredicate(left, op.Lexeme, right)
+	case parser.ArrayOpToken:
+		// a literal array is parsed with the type of the other array
+		if rightS.Token == parser.StringToken && len(rightS.Decl) == 0 {
+			right = agnostic.NewConstValueFunctor(rightS.Lexeme)
+		}
+		return agnostic.NewArrayPredicate(left, op.Lexeme, right)
+	}
+
+	ptype, err := comparisonType(op)
+	if err != nil {
+		return nil, err
+	}
+
+	// outer.attribute op attribute is evaluated as attribute op' value, so
+	// indexes can still be used to source rows
+	if isOuterLeft {
+		if outerLeft == nil {
+			// comparison with NULL is never true
+			return agnostic.NewFalsePredicate(agnostic.OnRelation(right.Relation())), nil
+		}
+		left, right = right, left
+		switch ptype {
+		case agnostic.Le:
+			ptype = agnostic.Ge
+		case agnostic.Ge:
+			ptype = agnostic.Le
+		case agnostic.Leq:
+			ptype = agnostic.Geq
+		case agnostic.Geq:
+			ptype = agnostic.Leq
+		}
+	}
+
+	return agnostic.NewComparisonPredicate(left, ptype, right)
+}
+
+func (t *Tx) and(left []*parser.Decl, right []*parser.Decl, schema, tableName string, args []NamedValue, aliases map[string]string) (agnostic.Predicate, error) {
 
 	if len(left) == 0 {
 		return nil, fmt.Errorf("no predicate before AND")
@@ -415,44 +1361,233 @@ func (t *Tx) or(left []*parser.Decl, right []*parser.Decl, schema, tableName str
 	return agnostic.NewOrPredicate(lp, rp), nil
 }
 
-func (t *Tx) getJoin(decl *parser.Decl, leftR string) (agnostic.Joiner, error) {
-	var leftA, rightA, rightR string
-
-	if decl.Decl[0].Token != parser.StringToken {
+// getJoins returns the joins of JOIN ON clause decl. Equalities between
+// joined relation and another relation join them, one join per other
+// relation, and other comparisons filter joined rows. An unqualified
+// attribute belongs to relation leftR on left side of a comparison, and to
+// joined relation on right side.
+func (t *Tx) getJoins(decl *parser.Decl, leftR string) ([]agnostic.Joiner, error) {
+	if decl.Decl[0].Token != parser.StringToken && !isDerived(decl.Decl[0]) {
 		return nil, fmt.Errorf("expected joined relation name, got %v", decl.Decl[0])
 	}
-	rightR = decl.Decl[0].Lexeme
+	joinedR := decl.Decl[0].Lexeme
+	if alias, ok := fromAlias(decl.Decl[0]); ok {
+		joinedR = alias
+	}
 
 	if decl.Decl[1].Token != parser.OnToken {
 		return nil, fmt.Errorf("expected join ON information, got %v", decl.Decl[1])
 	}
 	on := decl.Decl[1]
 
-	if len(on.Decl) != 3 {
+	if len(on.Decl)%4 != 3 {
 		return nil, fmt.Errorf("expected JOIN ON to have pivot")
 	}
 
-	if on.Decl[0].Decl[0].Lexeme == leftR {
-		leftA = on.Decl[0].Lexeme
-		if len(on.Decl[0].Decl) > 0 {
-			leftR = on.Decl[0].Decl[0].Lexeme
+	relation := func(d *parser.Decl, def string) string {
+		if len(d.Decl) > 0 {
+			return d.Decl[0].Lexeme
 		}
-		rightA = on.Decl[2].Lexeme
-		if len(on.Decl[2].Decl) > 0 {
-			rightR = on.Decl[2].Decl[0].Lexeme
+		return def
+	}
+
+	var joiners []agnostic.Joiner
+	joins := make(map[string]*agnostic.NaturalJoin)
+	var filters []*parser.Decl
+	for i := 0; i < len(on.Decl); i += 4 {
+		left, op, right := on.Decl[i], on.Decl[i+1], on.Decl[i+2]
+		leftR, rightR := relation(left, leftR), relation(right, joinedR)
+		// joined relation is on the right side
+		if leftR == joinedR {
+			left, right, leftR, rightR = right, left, rightR, leftR
 		}
-	} else {
-		leftA = on.Decl[2].Lexeme
-		if len(on.Decl[2].Decl) > 0 {
-			leftR = on.Decl[2].Decl[0].Lexeme
+		if op.Token != parser.EqualityToken || rightR != joinedR || leftR == joinedR {
+			filters = append(filters, on.Decl[i:i+3]...)
+			continue
+		}
+
+		if j, ok := joins[leftR]; ok {
+			j.And(left.Lexeme, right.Lexeme)
+			continue
+		}
+		j := agnostic.NewNaturalJoin(leftR, left.Lexeme, rightR, right.Lexeme)
+		joins[leftR] = j
+		joiners = append(joiners, j)
+	}
+	if len(joiners) == 0 {
+		return nil, fmt.Errorf("JOIN ON %s requires an equality with another relation", joinedR)
+	}
+
+	for i := 0; i < len(filters); i += 3 {
+		left, op, right := filters[i], filters[i+1], filters[i+2]
+		leftR, rightR := relation(left, leftR), relation(right, joinedR)
+		// filter joined rows of the join of both relations
+		other := leftR
+		if other == joinedR {
+			other = rightR
+		}
+		j, ok := joins[other]
+		if other == joinedR {
+			j, ok = joiners[0].(*agnostic.NaturalJoin), true
+		}
+		if !ok {
+			return nil, fmt.Errorf("JOIN ON %s cannot compare %s.%s and %s.%s", joinedR, leftR, left.Lexeme, rightR, right.Lexeme)
+		}
+		pt, err := comparisonType(op)
+		if err != nil {
+			return nil, err
+		}
+		p, err := agnostic.NewComparisonPredicate(agnostic.NewAttributeValueFunctor(leftR, left.Lexeme), pt, agnostic.NewAttributeValueFunctor(rightR, right.Lexeme))
+		if err != nil {
+			return nil, err
+		}
+		j.Filter(p)
+	}
+
+	return joiners, nil
+}
+
+// usingJoin holds the attributes joined by a NATURAL or USING join clause,
+// present in both the joined relation and one relation joined before.
+type usingJoin struct {
+	right string
+	attrs []string
+	// lefts holds the relation of each attribute on left side
+	lefts []string
+}
+
+// joiners returns the joins on attributes of uj, one per relation on left
+// side
+func (uj *usingJoin) joiners() []agnostic.Joiner {
+	var joiners []agnostic.Joiner
+	joins := make(map[string]*agnostic.NaturalJoin)
+	for i, a := range uj.attrs {
+		if j, ok := joins[uj.lefts[i]]; ok {
+			j.And(a, a)
+			continue
+		}
+		j := agnostic.NewNaturalJoin(uj.lefts[i], a, uj.right, a)
+		joins[uj.lefts[i]] = j
+		joiners = append(joiners, j)
+	}
+	return joiners
+}
+
+// getUsingJoins resolves the attributes of NATURAL and USING join clauses of
+// selectDecl, keyed by clause. A NATURAL join is on every attribute of the
+// joined relation with the name of an attribute of relations joined before.
+// Each attribute must belong to exactly one of them, attributes already
+// joined by name counting once.
+func (t *Tx) getUsingJoins(selectDecl *parser.Decl, schema string, tables []string, aliases map[string]string) (map[*parser.Decl]*usingJoin, error) {
+	joins := make(map[*parser.Decl]*usingJoin)
+
+	// relation of each attribute name visible on left side of next join
+	visible := make(map[string]string)
+	ambiguous := make(map[string]bool)
+	add := func(ref string, joined []string) ([]string, error) {
+		attrs, err := t.tx.RelationAttributes(schema, getAlias(ref, aliases))
+		if err != nil {
+			return nil, err
+		}
+		var names []string
+		for _, a := range attrs {
+			names = append(names, a.Name())
 		}
-		rightA = on.Decl[0].Lexeme
-		if len(on.Decl[0].Decl) > 0 {
-			rightR = on.Decl[0].Decl[0].Lexeme
+		for _, name := range names {
+			if contains(joined, name) {
+				continue
+			}
+			if _, ok := visible[name]; ok {
+				delete(visible, name)
+				ambiguous[name] = true
+			} else if !ambiguous[name] {
+				visible[name] = ref
+			}
+		}
+		return names, nil
+	}
+
+	ti := 0
+	for _, d := range selectDecl.Decl {
+		switch d.Token {
+		case parser.FromToken:
+			for range d.Decl {
+				if _, err := add(tables[ti], nil); err != nil {
+					return nil, err
+				}
+				ti++
+			}
+		case parser.JoinToken:
+			right := tables[ti]
+			ti++
+			if len(d.Decl) < 2 || (d.Decl[1].Token != parser.NaturalToken && d.Decl[1].Token != parser.UsingToken) {
+				if _, err := add(right, nil); err != nil {
+					return nil, err
+				}
+				continue
+			}
+
+			attrs, err := t.tx.RelationAttributes(schema, getAlias(right, aliases))
+			if err != nil {
+				return nil, err
+			}
+			uj := &usingJoin{right: right}
+			if d.Decl[1].Token == parser.NaturalToken {
+				for _, a := range attrs {
+					if _, ok := visible[a.Name()]; ok || ambiguous[a.Name()] {
+						uj.attrs = append(uj.attrs, a.Name())
+					}
+				}
+				if len(uj.attrs) == 0 {
+					return nil, fmt.Errorf("NATURAL JOIN of %s has no common column", right)
+				}
+			} else {
+				for _, c := range d.Decl[1].Decl {
+					if contains(uj.attrs, c.Lexeme) {
+						return nil, agnostic.NewError(agnostic.DuplicateColumn, "column name %s appears more than once in USING clause", c.Lexeme)
+					}
+					uj.attrs = append(uj.attrs, c.Lexeme)
+				}
+			}
+			for _, name := range uj.attrs {
+				found := false
+				for _, a := range attrs {
+					found = found || a.Name() == name
+				}
+				if !found {
+					return nil, agnostic.NewError(agnostic.UndefinedColumn, "column %s specified in USING clause does not exist in right table", name).On(right, name)
+				}
+				if ambiguous[name] {
+					return nil, agnostic.NewError(agnostic.AmbiguousColumn, "common column name %s appears more than once in left table", name).On("", name)
+				}
+				left, ok := visible[name]
+				if !ok {
+					return nil, agnostic.NewError(agnostic.UndefinedColumn, "column %s specified in USING clause does not exist in left table", name).On("", name)
+				}
+				uj.lefts = append(uj.lefts, left)
+			}
+			if _, err := add(right, uj.attrs); err != nil {
+				return nil, err
+			}
+			joins[d] = uj
 		}
 	}
 
-	return agnostic.NewNaturalJoin(leftR, leftA, rightR, rightA), nil
+	return joins, nil
+}
+
+func contains(names []string, name string) bool {
+	return indexOf(names, name) != -1
+}
+
+// indexOf returns the index of name in names, or -1 if not found
+func indexOf(names []string, name string) int {
+	for i, n := range names {
+		if n == name {
+			return i
+		}
+	}
+	return -1
 }
 
 func (t *Tx) getDistinctSorter(rel string, decl *parser.Decl, nextAttr string) (agnostic.Sorter, error) {
@@ -461,6 +1596,10 @@ func (t *Tx) getDistinctSorter(rel string, decl *parser.Decl, nextAttr string) (
 	// if we have ON specified
 	if len(decl.Decl) > 0 {
 		for _, d := range decl.Decl {
+			if len(d.Decl) > 0 {
+				dattrs = append(dattrs, d.Decl[0].Lexeme+"."+d.Lexeme)
+				continue
+			}
 			dattrs = append(dattrs, d.Lexeme)
 		}
 	} else {
@@ -471,16 +1610,41 @@ func (t *Tx) getDistinctSorter(rel string, decl *parser.Decl, nextAttr string) (
 	return agnostic.NewDistinctSorter(rel, dattrs), nil
 }
 
-func notInExecutor(rname string, aname string, inDecl *parser.Decl) (agnostic.Predicate, error) {
-	in, err := inExecutor(rname, aname, inDecl.Decl[0])
+func (t *Tx) notInExecutor(rname string, aname string, notDecl *parser.Decl, args []NamedValue) (agnostic.Predicate, error) {
+	inDecl := notDecl.Decl[0]
+	if len(inDecl.Decl) == 0 {
+		return nil, ParsingError
+	}
+
+	if !isQuery(inDecl.Decl[0]) {
+		in, err := t.inExecutor(rname, aname, inDecl, args)
+		if err != nil {
+			return nil, err
+		}
+		return agnostic.NewNotPredicate(in), nil
+	}
+
+	// NOT IN (subquery) follows SQL three-valued logic:
+	//   - nothing is NOT IN a set containing NULL
+	//   - everything, even NULL, is NOT IN an empty set
+	//   - NULL is not NOT IN a non empty set
+	values, hasNull, err := t.subqueryValues(inDecl.Decl[0], args)
 	if err != nil {
 		return nil, err
 	}
+	if hasNull {
+		return agnostic.NewFalsePredicate(agnostic.OnRelation(rname)), nil
+	}
+	if len(values) == 0 {
+		return agnostic.NewTruePredicate(), nil
+	}
 
+	v := agnostic.NewAttributeValueFunctor(rname, aname)
+	in := agnostic.NewInPredicate(v, agnostic.NewListNode(values...))
 	return agnostic.NewNotPredicate(in), nil
 }
 
-func inExecutor(rname string, aname string, inDecl *parser.Decl) (agnostic.Predicate, error) {
+func (t *Tx) inExecutor(rname string, aname string, inDecl *parser.Decl, args []NamedValue) (agnostic.Predicate, error) {
 
 	if len(inDecl.Decl) == 0 {
 		return nil, ParsingError
@@ -490,11 +1654,32 @@ func inExecutor(rname string, aname string, inDecl *parser.Decl) (agnostic.Predi
 
 	var n agnostic.Node
 	switch inDecl.Decl[0].Token {
-	case parser.SelectToken:
-		return nil, fmt.Errorf("IN subquery not implemented")
+	case parser.SelectToken, parser.UnionToken, parser.IntersectToken, parser.ExceptToken:
+		// NULL never matches, so it is left out of the set
+		values, _, err := t.subqueryValues(inDecl.Decl[0], args)
+		if err != nil {
+			return nil, err
+		}
+		n = agnostic.NewListNode(values...)
 	default:
 		var values []any
 		for _, d := range inDecl.Decl {
+			if d.Token == parser.ArgToken || d.Token == parser.NamedArgToken {
+				v, err := argValue(d, args)
+				if err != nil {
+					return nil, err
+				}
+				values = append(values, v)
+				continue
+			}
+			if d.Token == parser.NumberToken {
+				v, err := agnostic.ToInstance(d.Lexeme, parser.TypeNameFromToken(d.Token))
+				if err != nil {
+					return nil, err
+				}
+				values = append(values, v)
+				continue
+			}
 			values = append(values, d.Lexeme)
 		}
 		n = agnostic.NewListNode(values...)
@@ -504,15 +1689,403 @@ func inExecutor(rname string, aname string, inDecl *parser.Decl) (agnostic.Predi
 	return p, nil
 }
 
+// subqueryValues executes a subquery returning a single column and returns
+// its non NULL values, and whether a NULL value was returned.
+func (t *Tx) subqueryValues(selectDecl *parser.Decl, args []NamedValue) ([]any, bool, error) {
+	_, _, cols, res, err := queryExecutor(t, selectDecl, args)
+	if err != nil {
+		return nil, false, err
+	}
+
+	if len(cols) != 1 {
+		return nil, false, fmt.Errorf("subquery has too many columns")
+	}
+
+	var values []any
+	var hasNull bool
+	for _, r := range res {
+		v := r.Values()[0]
+		if v == nil {
+			hasNull = true
+			continue
+		}
+		values = append(values, v)
+	}
+
+	return values, hasNull, nil
+}
+
+// existsExecutor returns a predicate executing subquery for each row of relation.
+// Subquery can reference attributes of the row, making it a correlated subquery.
+// Result of a subquery not referencing the row is computed only once.
+func (t *Tx) existsExecutor(rname string, aliases map[string]string, existsDecl *parser.Decl, args []NamedValue) (agnostic.Predicate, error) {
+	if len(existsDecl.Decl) == 0 || !isQuery(existsDecl.Decl[0]) {
+		return nil, ParsingError
+	}
+	selectDecl := existsDecl.Decl[0]
+
+	var cached *bool
+	subquery := func(cols []string, tuple *agnostic.Tuple) (bool, error) {
+		if cached != nil {
+			return *cached, nil
+		}
+
+		c := &correlation{relation: rname, cols: cols, tuple: tuple}
+		outer := t.outer
+		t.outer = c
+		_, _, _, res, err := queryExecutor(t, selectDecl, args)
+		t.outer = outer
+		if err != nil {
+			return false, err
+		}
+
+		exists := len(res) > 0
+		if !c.referenced {
+			cached = &exists
+		}
+		return exists, nil
+	}
+
+	return agnostic.NewExistsPredicate(rname, subquery), nil
+}
+
+// outerValue returns the value of attribute aname in the outer row, if rname
+// references the outer relation of the correlated subquery being executed.
+// Relations of the subquery itself take precedence over the outer one.
+func (t *Tx) outerValue(rname, aname, local string, aliases map[string]string) (any, bool) {
+	if t.outer == nil || rname == local {
+		return nil, false
+	}
+	if _, ok := aliases[rname]; ok {
+		return nil, false
+	}
+	if rname != t.outer.relation {
+		return nil, false
+	}
+
+	for i, c := range t.outer.cols {
+		if c == aname {
+			t.outer.referenced = true
+			return t.outer.tuple.Values()[i], true
+		}
+	}
+
+	return nil, false
+}
+
+// expressionPredicate returns the comparison of an expression, like a cast
+// or a function call, with a value.
+func (t *Tx) expressionPredicate(cond *parser.Decl, schema, rname string, args []NamedValue, aliases map[string]string) (agnostic.Predicate, error) {
+	n := len(cond.Decl)
+	if n < 2 {
+		return nil, ParsingError
+	}
+
+	op, valueDecl := cond.Decl[n-2], cond.Decl[n-1]
+	ptype, err := comparisonType(op)
+	if err != nil && op.Token != parser.RegexMatchToken && op.Token != parser.ArrayOpToken {
+		return nil, fmt.Errorf("%s is only supported in comparisons", strings.ToUpper(cond.Lexeme))
+	}
+
+	expr := *cond
+	expr.Decl = cond.Decl[:n-2]
+	left, err := t.valueFunctor(&expr, schema, []string{rname}, args, aliases)
+	if err != nil {
+		return nil, err
+	}
+
+	if valueDecl.Token == parser.AnyToken {
+		return t.anyPredicate(left, op, valueDecl, schema, rname, args, aliases)
+	}
+
+	var right agnostic.ValueFunctor
+	switch {
+	case isQuery(valueDecl):
+		_, v, err := t.scalarSubquery(valueDecl, args)
+		if err != nil {
+			return nil, err
+		}
+		// comparison with NULL is never true
+		if v == nil {
+			return agnostic.NewFalsePredicate(agnostic.OnRelation(rname)), nil
+		}
+		right = agnostic.NewConstValueFunctor(v)
+	case valueDecl.Token == parser.StringToken && len(valueDecl.Decl) == 0:
+		// untyped literal compared with a cast takes the type of the cast, a
+		// pattern or an array literal is a string
+		if op.Token == parser.RegexMatchToken || op.Token == parser.ArrayOpToken {
+			right = agnostic.NewConstValueFunctor(valueDecl.Lexeme)
+			break
+		}
+		if cond.Token == parser.CastToken {
+			right, err = agnostic.NewCastValueFunctor(agnostic.NewConstValueFunctor(valueDecl.Lexeme), cond.Decl[1].Lexeme)
+			if err != nil {
+				return nil, err
+			}
+			break
+		}
+		v, err := agnostic.ToInstance(valueDecl.Lexeme, parser.TypeNameFromToken(valueDecl.Token))
+		if err != nil {
+			return nil, err
+		}
+		right = agnostic.NewConstValueFunctor(v)
+	default:
+		right, err = t.valueFunctor(valueDecl, schema, []string{rname}, args, aliases)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	switch op.Token {
+	case parser.RegexMatchToken:
+		return agnostic.NewRegexPredicate(left, op.Lexeme, right)
+	case parser.ArrayOpToken:
+		return agnostic.NewArrayPredicate(left, op.Lexeme, right)
+	}
+	return agnostic.NewComparisonPredicate(left, ptype, right)
+}
+
+// anyPredicate returns the comparison of left with the elements of the array
+// of ANY(array) decl anyDecl
+func (t *Tx) anyPredicate(left agnostic.ValueFunctor, op *parser.Decl, anyDecl *parser.Decl, schema, rname string, args []NamedValue, aliases map[string]string) (agnostic.Predicate, error) {
+	if len(anyDecl.Decl) == 0 {
+		return nil, ParsingError
+	}
+	ptype, err := comparisonType(op)
+	if err != nil {
+		return nil, fmt.Errorf("ANY is only supported in comparisons")
+	}
+
+	array, err := t.valueFunctor(anyDecl.Decl[0], schema, []string{rname}, args, aliases)
+	if err != nil {
+		return nil, err
+	}
+	return agnostic.NewAnyPredicate(left, ptype, array)
+}
+
+// valueFunctor returns a ValueFunctor computing an expression operand: a
+// cast, a function call, an attribute of one of tables, an attribute of the
+// outer row or a constant.
+func (t *Tx) valueFunctor(decl *parser.Decl, schema string, tables []string, args []NamedValue, aliases map[string]string) (agnostic.ValueFunctor, error) {
+	switch decl.Token {
+	case parser.CastToken:
+		if len(decl.Decl) < 2 {
+			return nil, ParsingError
+		}
+		src, err := t.valueFunctor(decl.Decl[0], schema, tables, args, aliases)
+		if err != nil {
+			return nil, err
+		}
+		return agnostic.NewCastValueFunctor(src, decl.Decl[1].Lexeme)
+	case parser.FunctionToken:
+		fargs := make([]agnostic.ValueFunctor, len(decl.Decl))
+		for i, d := range decl.Decl {
+			f, err := t.valueFunctor(d, schema, tables, args, aliases)
+			if err != nil {
+				return nil, err
+			}
+			fargs[i] = f
+		}
+		f, err := agnostic.NewFunctionValueFunctor(decl.Lexeme, fargs...)
+		if err != nil {
+			return nil, err
+		}
+		return f, nil
+	case parser.PlusToken, parser.MinusToken:
+		if len(decl.Decl) != 2 {
+			return nil, ParsingError
+		}
+		left, err := t.valueFunctor(decl.Decl[0], schema, tables, args, aliases)
+		if err != nil {
+			return nil, err
+		}
+		right, err := t.valueFunctor(decl.Decl[1], schema, tables, args, aliases)
+		if err != nil {
+			return nil, err
+		}
+		f, err := agnostic.NewArithmeticValueFunctor(decl.Lexeme, left, right)
+		if err != nil {
+			return nil, err
+		}
+		return f, nil
+	case parser.StringToken:
+		aname := decl.Lexeme
+		if isQualified(decl) {
+			if v, ok := t.outerValue(decl.Decl[0].Lexeme, aname, tables[0], aliases); ok {
+				return agnostic.NewConstValueFunctor(v), nil
+			}
+		}
+		rname, err := t.attributeRelation(decl, schema, tables, aliases)
+		if err != nil {
+			return nil, err
+		}
+		return t.collateAttribute(agnostic.NewAttributeValueFunctor(rname, aname), schema, aliases), nil
+	case parser.ArrayToken:
+		elems := make([]agnostic.ValueFunctor, len(decl.Decl))
+		for i, d := range decl.Decl {
+			f, err := t.valueFunctor(d, schema, tables, args, aliases)
+			if err != nil {
+				return nil, err
+			}
+			elems[i] = f
+		}
+		return agnostic.NewArrayValueFunctor(elems...), nil
+	case parser.SubscriptToken:
+		if len(decl.Decl) != 2 {
+			return nil, ParsingError
+		}
+		src, err := t.valueFunctor(decl.Decl[0], schema, tables, args, aliases)
+		if err != nil {
+			return nil, err
+		}
+		index, err := t.valueFunctor(decl.Decl[1], schema, tables, args, aliases)
+		if err != nil {
+			return nil, err
+		}
+		return agnostic.NewSubscriptValueFunctor(src, index), nil
+	case parser.CollateToken:
+		if len(decl.Decl) < 2 {
+			return nil, ParsingError
+		}
+		src, err := t.valueFunctor(decl.Decl[0], schema, tables, args, aliases)
+		if err != nil {
+			return nil, err
+		}
+		c, err := agnostic.NewCollation(decl.Decl[1].Lexeme)
+		if err != nil {
+			return nil, err
+		}
+		return agnostic.NewCollateValueFunctor(src, c, true), nil
+	}
+
+	v, err := t.constantValue(decl, args)
+	if err != nil {
+		return nil, err
+	}
+	return agnostic.NewConstValueFunctor(v), nil
+}
+
+// collateAttribute returns functor f of an attribute with the collation of
+// the attribute, if it has one
+func (t *Tx) collateAttribute(f agnostic.ValueFunctor, schema string, aliases map[string]string) agnostic.ValueFunctor {
+	_, a, err := t.tx.RelationAttribute(schema, getAlias(f.Relation(), aliases), f.Attribute()[0])
+	if err != nil || a.Collation() == nil {
+		return f
+	}
+	return agnostic.NewCollateValueFunctor(f, a.Collation(), false)
+}
+
+// implicitCollation returns the collation of attribute decl of one of tables,
+// or nil if it has none
+func (t *Tx) implicitCollation(decl *parser.Decl, schema string, tables []string, aliases map[string]string) *agnostic.Collation {
+	if len(tables) == 0 || tables[0] == "" {
+		return nil
+	}
+	rname, err := t.attributeRelation(decl, schema, tables, aliases)
+	if err != nil {
+		return nil
+	}
+	_, a, err := t.tx.RelationAttribute(schema, getAlias(rname, aliases), decl.Lexeme)
+	if err != nil {
+		return nil
+	}
+	return a.Collation()
+}
+
+// comparisonType returns the type of comparison predicate of operator op
+func comparisonType(op *parser.Decl) (agnostic.PredicateType, error) {
+	switch op.Token {
+	case parser.EqualityToken:
+		return agnostic.Eq, nil
+	case parser.LessOrEqualToken:
+		return agnostic.Leq, nil
+	case parser.GreaterOrEqualToken:
+		return agnostic.Geq, nil
+	case parser.DistinctnessToken:
+		return agnostic.Neq, nil
+	case parser.LeftDipleToken:
+		return agnostic.Le, nil
+	case parser.RightDipleToken:
+		return agnostic.Ge, nil
+	}
+	return 0, fmt.Errorf("unknown comparison token %s", op.Lexeme)
+}
+
+// constantValue returns the value of a literal, of a placeholder or of the
+// current time. String literals are returned as is, without guessing their type.
+func (t *Tx) constantValue(d *parser.Decl, args []NamedValue) (any, error) {
+	switch d.Token {
+	case parser.NowToken, parser.LocalTimestampToken, parser.CurrentDateToken:
+		return t.currentTime(d), nil
+	case parser.IntervalToken:
+		return agnostic.ParseInterval(d.Lexeme)
+	case parser.NullToken:
+		return nil, nil
+	case parser.StringToken, parser.SimpleQuoteToken:
+		return d.Lexeme, nil
+	case parser.ArgToken, parser.NamedArgToken:
+		return argValue(d, args)
+	default:
+		return agnostic.ToInstance(d.Lexeme, parser.TypeNameFromToken(d.Token))
+	}
+}
+
+// currentTime returns the start time of current statement for NOW() and
+// CURRENT_TIMESTAMP, or its date for CURRENT_DATE.
+func (t *Tx) currentTime(d *parser.Decl) time.Time {
+	now := t.now
+	if now.IsZero() {
+		now = t.e.memstore.Now()
+	}
+	if d.Token == parser.CurrentDateToken {
+		return time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	}
+	return now
+}
+
+// argValue returns the value of the argument referenced by a placeholder ($1, ? or :name)
+func argValue(d *parser.Decl, args []NamedValue) (any, error) {
+	if d.Token == parser.NamedArgToken {
+		for _, arg := range args {
+			if arg.Name == d.Lexeme {
+				return arg.Value, nil
+			}
+		}
+		return nil, fmt.Errorf("no named argument found for '%s'", d.Lexeme)
+	}
+
+	idx, err := strconv.ParseInt(d.Lexeme, 10, 64)
+	if err != nil {
+		return nil, err
+	}
+	if idx < 1 || len(args) < int(idx) {
+		return nil, fmt.Errorf("reference to $%s, but only %d argument provided", d.Lexeme, len(args))
+	}
+	return args[idx-1].Value, nil
+}
+
+// intValue returns the integer value of a number or of a placeholder
+func intValue(d *parser.Decl, args []NamedValue) (int64, error) {
+	if d.Token != parser.ArgToken && d.Token != parser.NamedArgToken {
+		return strconv.ParseInt(d.Lexeme, 10, 64)
+	}
+
+	v, err := argValue(d, args)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseInt(fmt.Sprint(v), 10, 64)
+}
+
 func isExecutor(rname string, aname string, isDecl *parser.Decl) (agnostic.Predicate, error) {
 
 	if isDecl.Decl[0].Token == parser.NullToken {
-		p := agnostic.NewEqPredicate(agnostic.NewAttributeValueFunctor(rname, aname), agnostic.NewConstValueFunctor(nil))
+		p := agnostic.NewIsNullPredicate(agnostic.NewAttributeValueFunctor(rname, aname))
 		return p, nil
 	}
 
 	if isDecl.Decl[0].Token == parser.NotToken && isDecl.Decl[1].Token == parser.NullToken {
-		p := agnostic.NewEqPredicate(agnostic.NewAttributeValueFunctor(rname, aname), agnostic.NewConstValueFunctor(nil))
+		p := agnostic.NewIsNullPredicate(agnostic.NewAttributeValueFunctor(rname, aname))
 		return agnostic.NewNotPredicate(p), nil
 	}
 
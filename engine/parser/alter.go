@@ -0,0 +1,142 @@
+package parser
+
+import (
+	"strings"
+)
+
+// parseAlter parses an ALTER TABLE statement of the form
+// ALTER TABLE [schema.]table ADD [COLUMN] column_definition
+// ALTER TABLE [schema.]table DROP [COLUMN] column
+// ALTER TABLE [schema.]table RENAME TO new_table
+// ALTER TABLE [schema.]table RENAME [COLUMN] column TO new_column
+func (p *parser) parseAlter() (*Instruction, error) {
+	i := &Instruction{}
+
+	// Column definitions and identifiers end with a comma, a bracket or a
+	// semicolon, so make sure statement is terminated.
+	p.terminate()
+
+	alterDecl, err := p.consumeToken(AlterToken)
+	if err != nil {
+		return nil, err
+	}
+	i.Decls = append(i.Decls, alterDecl)
+
+	tableDecl, err := p.consumeToken(TableToken)
+	if err != nil {
+		return nil, err
+	}
+	alterDecl.Add(tableDecl)
+
+	nameDecl, err := p.parseTableName()
+	if err != nil {
+		return nil, err
+	}
+	tableDecl.Add(nameDecl)
+
+	switch p.cur().Token {
+	case AddToken:
+		addDecl, err := p.consumeToken(AddToken)
+		if err != nil {
+			return nil, err
+		}
+		// COLUMN is not a keyword, so it may also be the name of the column
+		start := p.index
+		if p.isWord("column") {
+			p.index++
+		}
+		columnDecl, err := p.parseColumnDefinition()
+		if err != nil && p.index != start {
+			p.index = start
+			columnDecl, err = p.parseColumnDefinition()
+		}
+		if err != nil {
+			return nil, err
+		}
+		addDecl.Add(columnDecl)
+		alterDecl.Add(addDecl)
+	case DropToken:
+		dropDecl, err := p.consumeToken(DropToken)
+		if err != nil {
+			return nil, err
+		}
+		if p.isWord("column") && p.tokens[p.index+1].Token != SemicolonToken {
+			p.index++
+		}
+		columnDecl, err := p.parseQuotedToken()
+		if err != nil {
+			return nil, err
+		}
+		dropDecl.Add(columnDecl)
+		alterDecl.Add(dropDecl)
+	case StringToken:
+		// RENAME and COLUMN are not keywords, so attributes can still be named after them
+		renameDecl, err := p.consumeWord("rename", RenameToken)
+		if err != nil {
+			return nil, err
+		}
+		alterDecl.Add(renameDecl)
+
+		// RENAME TO new_table
+		if p.isTo() {
+			p.index++
+			nameDecl, err := p.parseQuotedToken()
+			if err != nil {
+				return nil, err
+			}
+			renameDecl.Add(nameDecl)
+			break
+		}
+
+		// RENAME [COLUMN] column TO new_column
+		if p.isWord("column") && !p.isNextTo() {
+			p.index++
+		}
+		columnDecl, err := p.parseQuotedToken()
+		if err != nil {
+			return nil, err
+		}
+		renameDecl.Add(columnDecl)
+		if !p.isTo() {
+			return nil, p.syntaxError()
+		}
+		p.index++
+		nameDecl, err := p.parseQuotedToken()
+		if err != nil {
+			return nil, err
+		}
+		renameDecl.Add(nameDecl)
+	default:
+		return nil, p.syntaxError()
+	}
+
+	if !p.is(SemicolonToken) {
+		return nil, p.syntaxError()
+	}
+
+	return i, nil
+}
+
+// isTo returns true if current token is TO. TO is not a keyword, so
+// relations and attributes can still be named to.
+func (p *parser) isTo() bool {
+	return p.is(StringToken) && strings.EqualFold(p.cur().Lexeme, "to")
+}
+
+// isNextTo returns true if next token is TO
+func (p *parser) isNextTo() bool {
+	return p.hasNext() && p.tokens[p.index+1].Token == StringToken && strings.EqualFold(p.tokens[p.index+1].Lexeme, "to")
+}
+
+// terminate appends a semicolon to tokens if current statement is the last
+// one and is not terminated.
+func (p *parser) terminate() {
+	for j := p.index; j < len(p.tokens); j++ {
+		if p.tokens[j].Token == SemicolonToken {
+			return
+		}
+	}
+
+	p.tokens = append(p.tokens, Token{Token: SemicolonToken, Lexeme: ";"})
+	p.tokenLen = len(p.tokens)
+}
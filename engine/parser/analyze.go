@@ -0,0 +1,26 @@
+package parser
+
+// parseAnalyze parses an ANALYZE statement of the form
+// ANALYZE [name]
+func (p *parser) parseAnalyze() (*Instruction, error) {
+	i := &Instruction{}
+
+	analyzeDecl, err := p.consumeToken(AnalyzeToken)
+	if err != nil {
+		return nil, err
+	}
+	i.Decls = append(i.Decls, analyzeDecl)
+
+	// without a table name, every relation is analyzed
+	if !p.hasNext() || p.is(SemicolonToken) {
+		return i, nil
+	}
+
+	nameDecl, err := p.parseTableName()
+	if err != nil {
+		return nil, err
+	}
+	analyzeDecl.Add(nameDecl)
+
+	return i, nil
+}
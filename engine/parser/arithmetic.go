@@ -0,0 +1,79 @@
+package parser
+
+import (
+	"strings"
+)
+
+// parseExpression parses an operand, followed by additions and subtractions
+func (p *parser) parseExpression() (*Decl, error) {
+	decl, err := p.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+
+	return p.parseArithmetic(decl)
+}
+
+// parseArithmetic parses the additions and subtractions following operand
+// left, of the form
+// left {+|-} operand [{+|-} operand...]
+//
+// Operators are left associative. Operator decl holds left and right
+// operand decls.
+func (p *parser) parseArithmetic(left *Decl) (*Decl, error) {
+	for {
+		var opDecl *Decl
+		switch {
+		case p.is(PlusToken, MinusToken):
+			opDecl = NewDecl(p.cur())
+			if err := p.next(); err != nil {
+				return nil, err
+			}
+		case p.is(NumberToken, FloatToken) && strings.HasPrefix(p.cur().Lexeme, "-"):
+			// a -1 is lexed as a followed by number -1
+			opDecl = &Decl{Token: MinusToken, Lexeme: "-"}
+			p.tokens[p.index].Lexeme = strings.TrimPrefix(p.cur().Lexeme, "-")
+		default:
+			return left, nil
+		}
+
+		right, err := p.parseOperand()
+		if err != nil {
+			return nil, err
+		}
+		opDecl.Add(left)
+		opDecl.Add(right)
+		left = opDecl
+	}
+}
+
+// isInterval returns true if current token starts an interval literal
+func (p *parser) isInterval() bool {
+	if !p.isWord("interval") {
+		return false
+	}
+	_, err := p.isNext(SimpleQuoteToken)
+	return err == nil
+}
+
+// parseInterval parses an interval literal of the form
+// INTERVAL 'quantity unit [quantity unit...]'
+//
+// Interval decl holds the literal as lexeme.
+func (p *parser) parseInterval() (*Decl, error) {
+	intervalDecl, err := p.consumeWord("interval", IntervalToken)
+	if err != nil {
+		return nil, err
+	}
+	if !p.is(SimpleQuoteToken) {
+		return nil, p.syntaxError()
+	}
+
+	valueDecl, err := p.parseValue()
+	if err != nil {
+		return nil, err
+	}
+	intervalDecl.Lexeme = valueDecl.Lexeme
+
+	return intervalDecl, nil
+}
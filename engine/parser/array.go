@@ -0,0 +1,103 @@
+package parser
+
+// isArray returns true if current token starts an array constructor
+func (p *parser) isArray() bool {
+	if !p.isWord("array") {
+		return false
+	}
+	_, err := p.isNext(SquareBracketOpeningToken)
+	return err == nil
+}
+
+// parseArray parses an array constructor of the form
+// ARRAY[expression[, expression...]]
+//
+// Array decl holds element decls.
+func (p *parser) parseArray() (*Decl, error) {
+	arrayDecl, err := p.consumeWord("array", ArrayToken)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := p.consumeToken(SquareBracketOpeningToken); err != nil {
+		return nil, err
+	}
+
+	for !p.is(SquareBracketClosingToken) {
+		elemDecl, err := p.parseExpression()
+		if err != nil {
+			return nil, err
+		}
+		arrayDecl.Add(elemDecl)
+
+		if p.is(CommaToken) {
+			if err := p.next(); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if !p.is(SquareBracketClosingToken) {
+			return nil, p.syntaxError()
+		}
+	}
+
+	if _, err := p.consumeToken(SquareBracketClosingToken); err != nil {
+		return nil, err
+	}
+
+	return arrayDecl, nil
+}
+
+// parseAny parses the right side of a comparison with the elements of an
+// array, of the form
+// ANY(expression)
+//
+// Any decl holds the array expression decl.
+func (p *parser) parseAny() (*Decl, error) {
+	anyDecl, err := p.consumeToken(AnyToken)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := p.consumeToken(BracketOpeningToken); err != nil {
+		return nil, err
+	}
+
+	exprDecl, err := p.parseExpression()
+	if err != nil {
+		return nil, err
+	}
+	anyDecl.Add(exprDecl)
+
+	if _, err := p.consumeToken(BracketClosingToken); err != nil {
+		return nil, err
+	}
+
+	return anyDecl, nil
+}
+
+// parseSubscript parses the optional subscripts following an expression, of
+// the form
+// expression[index][[index]...]
+//
+// and returns decl wrapped in subscript decls, holding the array decl, then
+// the index decl.
+func (p *parser) parseSubscript(decl *Decl) (*Decl, error) {
+	for p.is(SquareBracketOpeningToken) {
+		if _, err := p.consumeToken(SquareBracketOpeningToken); err != nil {
+			return nil, err
+		}
+		indexDecl, err := p.parseExpression()
+		if err != nil {
+			return nil, err
+		}
+		if _, err := p.consumeToken(SquareBracketClosingToken); err != nil {
+			return nil, err
+		}
+
+		subscriptDecl := &Decl{Token: SubscriptToken, Lexeme: decl.Lexeme}
+		subscriptDecl.Add(decl)
+		subscriptDecl.Add(indexDecl)
+		decl = subscriptDecl
+	}
+
+	return decl, nil
+}
@@ -0,0 +1,106 @@
+package parser
+
+// parseCast parses an explicit cast of the form
+// CAST(expression AS type)
+//
+// Cast decl holds the expression decl, then the type decl.
+func (p *parser) parseCast() (*Decl, error) {
+	castDecl, err := p.consumeWord("cast", CastToken)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := p.consumeToken(BracketOpeningToken); err != nil {
+		return nil, err
+	}
+
+	exprDecl, err := p.parseExpression()
+	if err != nil {
+		return nil, err
+	}
+	castDecl.Add(exprDecl)
+
+	if _, err := p.consumeToken(AsToken); err != nil {
+		return nil, err
+	}
+	typeDecl, err := p.parseType()
+	if err != nil {
+		return nil, err
+	}
+	castDecl.Add(typeDecl)
+
+	if _, err := p.consumeToken(BracketClosingToken); err != nil {
+		return nil, err
+	}
+
+	return castDecl, nil
+}
+
+// parseOperand parses an operand of an expression, like the expression of a
+// cast or a function argument: a cast, a function call, an array, a literal,
+// a placeholder or an attribute, optionally subscripted. Quoted string
+// literals are returned as SimpleQuoteToken decls, so they cannot be mistaken
+// for an attribute.
+func (p *parser) parseOperand() (*Decl, error) {
+	var decl *Decl
+	var err error
+
+	// CAST, EXTRACT, INTERVAL and ARRAY are not keywords, so attributes can
+	// still be named after them
+	switch {
+	case p.isWord("cast") && p.isFunctionCall():
+		decl, err = p.parseCast()
+	case p.isWord("extract") && p.isFunctionCall():
+		decl, err = p.parseExtract()
+	case p.isFunctionCall():
+		decl, err = p.parseFunctionCall()
+	case p.isInterval():
+		decl, err = p.parseInterval()
+	case p.isArray():
+		decl, err = p.parseArray()
+	case p.is(NowToken, LocalTimestampToken, CurrentDateToken):
+		decl, err = p.consumeToken(NowToken, LocalTimestampToken, CurrentDateToken)
+	case p.is(NullToken):
+		decl, err = p.consumeToken(NullToken)
+	case p.is(SimpleQuoteToken):
+		decl, err = p.parseValue()
+		if err == nil {
+			decl.Token = SimpleQuoteToken
+		}
+	case p.is(NumberToken, FloatToken, ArgToken, NamedArgToken):
+		decl, err = p.parseValue()
+	default:
+		decl, err = p.parseAttribute()
+	}
+	if err != nil {
+		return nil, err
+	}
+	decl, err = p.parseSubscript(decl)
+	if err != nil {
+		return nil, err
+	}
+
+	return p.parseCastShorthand(decl)
+}
+
+// parseCastShorthand parses the optional casts following an expression, of
+// the form
+// expression::type[::type...]
+// and returns decl wrapped in the matching cast decls.
+func (p *parser) parseCastShorthand(decl *Decl) (*Decl, error) {
+	for p.is(DoubleColonToken) {
+		if _, err := p.consumeToken(DoubleColonToken); err != nil {
+			return nil, err
+		}
+		typeDecl, err := p.parseType()
+		if err != nil {
+			return nil, err
+		}
+
+		castDecl := &Decl{Token: CastToken, Lexeme: "cast"}
+		castDecl.Add(decl)
+		castDecl.Add(typeDecl)
+		decl = castDecl
+	}
+
+	return decl, nil
+}
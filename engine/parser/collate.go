@@ -0,0 +1,50 @@
+package parser
+
+// parseCollateClause parses a collation clause of the form
+// COLLATE name
+// COLLATE "name"
+//
+// Collate decl holds the name decl, unquoted names are lowercased.
+func (p *parser) parseCollateClause() (*Decl, error) {
+	collateDecl, err := p.consumeToken(CollateToken)
+	if err != nil {
+		return nil, err
+	}
+	var nameDecl *Decl
+	if p.is(NocaseToken) {
+		nameDecl, err = p.consumeToken(NocaseToken)
+		if err == nil {
+			nameDecl.Lexeme = "nocase"
+		}
+	} else {
+		nameDecl, err = p.parseQuotedToken()
+	}
+	if err != nil {
+		return nil, err
+	}
+	collateDecl.Add(nameDecl)
+
+	return collateDecl, nil
+}
+
+// parseCollate parses the optional collation clause following an operand of
+// a comparison, as in
+// name COLLATE nocase = 'zed'
+//
+// Operand decl is then wrapped in a collate decl holding the operand decl,
+// then the name decl.
+func (p *parser) parseCollate(decl *Decl) (*Decl, error) {
+	if !p.is(CollateToken) {
+		return decl, nil
+	}
+	collateDecl, err := p.parseCollateClause()
+	if err != nil {
+		return nil, err
+	}
+	nameDecl := collateDecl.Decl[0]
+	collateDecl.Decl = nil
+	collateDecl.Add(decl)
+	collateDecl.Add(nameDecl)
+
+	return collateDecl, nil
+}
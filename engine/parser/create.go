@@ -55,6 +55,24 @@ func (p *parser) parseCreate(tokens []Token) (*Instruction, error) {
 		}
 		d.Add(u)
 		createDecl.Add(d)
+	case StringToken:
+		// TYPE, DOMAIN and SEQUENCE are not keywords, so attributes can still be named after them
+		var d *Decl
+		var err error
+		switch strings.ToLower(tokens[p.index].Lexeme) {
+		case "type":
+			d, err = p.parseEnumType()
+		case "domain":
+			d, err = p.parseDomain()
+		case "sequence":
+			d, err = p.parseSequence()
+		default:
+			return nil, fmt.Errorf("Parsing error near <%s>", tokens[p.index].Lexeme)
+		}
+		if err != nil {
+			return nil, err
+		}
+		createDecl.Add(d)
 
 	default:
 		return nil, fmt.Errorf("Parsing error near <%s>", tokens[p.index].Lexeme)
@@ -63,7 +81,7 @@ func (p *parser) parseCreate(tokens []Token) (*Instruction, error) {
 	return i, nil
 }
 
-// INDEX index_name ON table_name (col1, col2)
+// INDEX index_name ON table_name [USING method] (col1, col2)
 func (p *parser) parseIndex(tokens []Token) (*Decl, error) {
 	var err error
 	indexDecl := NewDecl(tokens[p.index])
@@ -115,6 +133,20 @@ func (p *parser) parseIndex(tokens []Token) (*Decl, error) {
 	nameTable.Token = TableToken
 	indexDecl.Add(nameTable)
 
+	// Maybe have "USING method" here
+	if p.isWord("using") {
+		usingDecl, err := p.consumeWord("using", UsingToken)
+		if err != nil {
+			return nil, err
+		}
+		methodDecl, err := p.consumeToken(StringToken)
+		if err != nil {
+			return nil, p.syntaxError()
+		}
+		usingDecl.Add(methodDecl)
+		indexDecl.Add(usingDecl)
+	}
+
 	// Now we should found brackets
 	if !p.hasNext() || tokens[p.index].Token != BracketOpeningToken {
 		return nil, fmt.Errorf("Table name token must be followed by table definition")
@@ -212,6 +244,16 @@ func (p *parser) parseTable(tokens []Token) (*Decl, error) {
 	}
 	tableDecl.Add(nameTable)
 
+	// CREATE TABLE name [(column, ...)] AS SELECT ...
+	asDecl, err := p.parseTableAs(tokens)
+	if err != nil {
+		return nil, err
+	}
+	if asDecl != nil {
+		tableDecl.Add(asDecl)
+		return tableDecl, nil
+	}
+
 	// Now we should found brackets
 	if !p.hasNext() || tokens[p.index].Token != BracketOpeningToken {
 		return nil, fmt.Errorf("Table name token must be followed by table definition")
@@ -240,112 +282,240 @@ func (p *parser) parseTable(tokens []Token) (*Decl, error) {
 			break
 		}
 
-		// New attribute name
-		newAttribute, err := p.parseQuotedToken()
+		newAttribute, err := p.parseColumnDefinition()
 		if err != nil {
 			return nil, err
 		}
 		tableDecl.Add(newAttribute)
 
-		newAttributeType, err := p.parseType()
-		if err != nil {
-			return nil, err
+		// The current token is either closing bracked or comma.
+
+		// Closing bracket means table parsing stops.
+		if tokens[p.index].Token == BracketClosingToken {
+			p.index++
+			break
 		}
-		newAttribute.Add(newAttributeType)
 
-		// All the following tokens until bracket or comma are column constraints.
-		// Column constraints can be listed in any order.
-		for p.isNot(BracketClosingToken, CommaToken) {
-			switch p.cur().Token {
-			case UnsignedToken:
-				_, err = p.consumeToken(UnsignedToken)
+		// Comma means continue on next table column.
+		p.index++
+	}
+
+	return tableDecl, nil
+}
+
+// parseTableAs parses the AS SELECT clause of a CREATE TABLE statement, with
+// optional column names:
+// [(column, ...)] AS SELECT ...
+//
+// If statement defines table attributes instead, nil is returned and parser
+// position is unchanged.
+func (p *parser) parseTableAs(tokens []Token) (*Decl, error) {
+	var names []*Decl
+
+	start := p.index
+	if p.is(BracketOpeningToken) {
+		p.index++
+		for p.index < len(tokens) && p.is(StringToken, DoubleQuoteToken, BacktickToken) {
+			nameDecl, err := p.parseQuotedToken()
+			if err != nil {
+				p.index = start
+				return nil, nil
+			}
+			names = append(names, nameDecl)
+			if !p.is(CommaToken) {
+				break
+			}
+			p.index++
+		}
+		if !p.is(BracketClosingToken) || p.index+1 >= len(tokens) {
+			p.index = start
+			return nil, nil
+		}
+		p.index++
+	}
+
+	if !p.is(AsToken) {
+		p.index = start
+		return nil, nil
+	}
+
+	asDecl, err := p.consumeToken(AsToken)
+	if err != nil {
+		return nil, err
+	}
+	if !p.is(SelectToken) {
+		return nil, p.syntaxError()
+	}
+	selectInst, err := p.parseSelect(tokens)
+	if err != nil {
+		return nil, err
+	}
+	asDecl.Add(selectInst.Decls[0])
+	for _, n := range names {
+		asDecl.Add(n)
+	}
+
+	return asDecl, nil
+}
+
+// parseColumnDefinition parses a column name, type and constraints, as in
+// CREATE TABLE and ALTER TABLE ADD COLUMN statements
+func (p *parser) parseColumnDefinition() (*Decl, error) {
+	// New attribute name
+	newAttribute, err := p.parseQuotedToken()
+	if err != nil {
+		return nil, err
+	}
+
+	newAttributeType, err := p.parseType()
+	if err != nil {
+		return nil, err
+	}
+	newAttribute.Add(newAttributeType)
+
+	// All the following tokens until bracket, comma or end of statement are
+	// column constraints.
+	// Column constraints can be listed in any order.
+	for p.isNot(BracketClosingToken, CommaToken, SemicolonToken) {
+		switch p.cur().Token {
+		case UnsignedToken:
+			_, err = p.consumeToken(UnsignedToken)
+			if err != nil {
+				return nil, err
+			}
+		case UniqueToken: // UNIQUE
+			uniqueDecl, err := p.consumeToken(UniqueToken)
+			if err != nil {
+				return nil, err
+			}
+			newAttribute.Add(uniqueDecl)
+		case NotToken: // NOT NULL
+			if _, err = p.isNext(NullToken); err == nil {
+				notDecl, err := p.consumeToken(NotToken)
 				if err != nil {
 					return nil, err
 				}
-			case UniqueToken: // UNIQUE
-				uniqueDecl, err := p.consumeToken(UniqueToken)
+				newAttribute.Add(notDecl)
+				nullDecl, err := p.consumeToken(NullToken)
 				if err != nil {
 					return nil, err
 				}
-				newAttribute.Add(uniqueDecl)
-			case NotToken: // NOT NULL
-				if _, err = p.isNext(NullToken); err == nil {
-					notDecl, err := p.consumeToken(NotToken)
-					if err != nil {
-						return nil, err
-					}
-					newAttribute.Add(notDecl)
-					nullDecl, err := p.consumeToken(NullToken)
-					if err != nil {
-						return nil, err
-					}
-					notDecl.Add(nullDecl)
-				}
-			case PrimaryToken: // PRIMARY KEY
-				if _, err = p.isNext(KeyToken); err == nil {
-					newPrimary := NewDecl(tokens[p.index])
-					newAttribute.Add(newPrimary)
+				notDecl.Add(nullDecl)
+			}
+		case PrimaryToken: // PRIMARY KEY
+			if _, err = p.isNext(KeyToken); err == nil {
+				newPrimary := NewDecl(p.tokens[p.index])
+				newAttribute.Add(newPrimary)
 
-					if err = p.next(); err != nil {
-						return nil, fmt.Errorf("Unexpected end")
-					}
+				if err = p.next(); err != nil {
+					return nil, fmt.Errorf("Unexpected end")
+				}
 
-					newKey := NewDecl(tokens[p.index])
-					newPrimary.Add(newKey)
+				newKey := NewDecl(p.tokens[p.index])
+				newPrimary.Add(newKey)
 
-					if err = p.next(); err != nil {
-						return nil, fmt.Errorf("Unexpected end")
-					}
+				if err = p.next(); err != nil {
+					return nil, fmt.Errorf("Unexpected end")
 				}
-			case AutoincrementToken:
-				autoincDecl, err := p.consumeToken(AutoincrementToken)
+			}
+		case AutoincrementToken:
+			autoincDecl, err := p.consumeToken(AutoincrementToken)
+			if err != nil {
+				return nil, err
+			}
+			newAttribute.Add(autoincDecl)
+		case StringToken: // START WITH n, first value of auto-increment attribute
+			startDecl, err := p.consumeWord("start", StartToken)
+			if err != nil {
+				return nil, err
+			}
+			if _, err := p.consumeToken(WithToken); err != nil {
+				return nil, err
+			}
+			valueDecl, err := p.consumeToken(NumberToken)
+			if err != nil {
+				return nil, err
+			}
+			startDecl.Add(valueDecl)
+			newAttribute.Add(startDecl)
+		case WithToken: // WITH TIME ZONE
+			if strings.ToLower(newAttributeType.Lexeme) == "timestamp" {
+				withDecl, err := p.consumeToken(WithToken)
 				if err != nil {
 					return nil, err
 				}
-				newAttribute.Add(autoincDecl)
-			case WithToken: // WITH TIME ZONE
-				if strings.ToLower(newAttributeType.Lexeme) == "timestamp" {
-					withDecl, err := p.consumeToken(WithToken)
-					if err != nil {
-						return nil, err
-					}
-					timeDecl, err := p.consumeToken(TimeToken)
-					if err != nil {
-						return nil, err
-					}
-					zoneDecl, err := p.consumeToken(ZoneToken)
-					if err != nil {
-						return nil, err
-					}
-					newAttributeType.Add(withDecl)
-					withDecl.Add(timeDecl)
-					timeDecl.Add(zoneDecl)
+				timeDecl, err := p.consumeToken(TimeToken)
+				if err != nil {
+					return nil, err
 				}
-			case DefaultToken: // DEFAULT
-				dDecl, err := p.parseDefaultClause()
+				zoneDecl, err := p.consumeToken(ZoneToken)
 				if err != nil {
 					return nil, err
 				}
-				newAttribute.Add(dDecl)
-			default:
-				// Unknown column constraint
-				return nil, p.syntaxError()
+				newAttributeType.Add(withDecl)
+				withDecl.Add(timeDecl)
+				timeDecl.Add(zoneDecl)
+			}
+		case DefaultToken: // DEFAULT
+			dDecl, err := p.parseDefaultClause()
+			if err != nil {
+				return nil, err
+			}
+			newAttribute.Add(dDecl)
+		case CollateToken: // COLLATE name
+			collateDecl, err := p.parseCollateClause()
+			if err != nil {
+				return nil, err
+			}
+			newAttribute.Add(collateDecl)
+		case ReferencesToken: // REFERENCES [schema.]relation [(attribute)]
+			refDecl, err := p.parseReferences()
+			if err != nil {
+				return nil, err
 			}
+			newAttribute.Add(refDecl)
+		default:
+			// Unknown column constraint
+			return nil, p.syntaxError()
 		}
+	}
 
-		// The current token is either closing bracked or comma.
+	return newAttribute, nil
+}
 
-		// Closing bracket means table parsing stops.
-		if tokens[p.index].Token == BracketClosingToken {
-			p.index++
-			break
-		}
+// parseReferences parses a foreign key column constraint. Without
+// attribute, the primary key of referenced relation is referenced.
+//
+//	|-> "REFERENCES" (ReferencesToken)
+//	    |-> relation name, with schema if any
+//	    |-> attribute name (optional)
+func (p *parser) parseReferences() (*Decl, error) {
+	refDecl, err := p.consumeToken(ReferencesToken)
+	if err != nil {
+		return nil, err
+	}
 
-		// Comma means continue on next table column.
-		p.index++
+	tableDecl, err := p.parseTableName()
+	if err != nil {
+		return nil, err
 	}
+	refDecl.Add(tableDecl)
 
-	return tableDecl, nil
+	if p.is(BracketOpeningToken) {
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+		attrDecl, err := p.parseQuotedToken()
+		if err != nil {
+			return nil, err
+		}
+		refDecl.Add(attrDecl)
+		if _, err := p.consumeToken(BracketClosingToken); err != nil {
+			return nil, err
+		}
+	}
+
+	return refDecl, nil
 }
 
 func (p *parser) parseDefaultClause() (*Decl, error) {
@@ -358,8 +528,11 @@ func (p *parser) parseDefaultClause() (*Decl, error) {
 
 	if p.is(SimpleQuoteToken) || p.is(DoubleQuoteToken) {
 		vDecl, err = p.parseStringLiteral()
+	} else if p.is(StringToken) && strings.EqualFold(p.cur().Lexeme, "true") {
+		// there is no token for true, unlike false
+		vDecl, err = p.consumeToken(StringToken)
 	} else {
-		vDecl, err = p.consumeToken(NullToken, FloatToken, FalseToken, NumberToken, LocalTimestampToken, NowToken, ArgToken, NamedArgToken)
+		vDecl, err = p.consumeToken(NullToken, FloatToken, FalseToken, NumberToken, LocalTimestampToken, NowToken, CurrentDateToken, RandomToken, ArgToken, NamedArgToken)
 	}
 
 	if err != nil {
@@ -420,3 +593,221 @@ func (p *parser) parseSchema(tokens []Token) (*Decl, error) {
 
 	return schemaDecl, nil
 }
+
+// SEQUENCE [IF NOT EXISTS] sequence_name [START [WITH] n] [INCREMENT [BY] n]
+func (p *parser) parseSequence() (*Decl, error) {
+	seqDecl, err := p.consumeWord("sequence", SequenceToken)
+	if err != nil {
+		return nil, err
+	}
+
+	// Maybe have "IF NOT EXISTS" here
+	if p.is(IfToken) {
+		ifDecl, err := p.consumeToken(IfToken)
+		if err != nil {
+			return nil, err
+		}
+		seqDecl.Add(ifDecl)
+
+		notDecl, err := p.consumeToken(NotToken)
+		if err != nil {
+			return nil, err
+		}
+		ifDecl.Add(notDecl)
+
+		existsDecl, err := p.consumeToken(ExistsToken)
+		if err != nil {
+			return nil, err
+		}
+		notDecl.Add(existsDecl)
+	}
+
+	// Now we should found sequence name
+	nameDecl, err := p.parseTableName()
+	if err != nil {
+		return nil, p.syntaxError()
+	}
+	seqDecl.Add(nameDecl)
+
+	// Options can be listed in any order
+	for p.isWord("start") || p.isWord("increment") {
+		var optDecl *Decl
+		if p.isWord("start") {
+			optDecl, err = p.consumeWord("start", StartToken)
+		} else {
+			optDecl, err = p.consumeWord("increment", IncrementToken)
+		}
+		if err != nil {
+			return nil, err
+		}
+		seqDecl.Add(optDecl)
+
+		if p.is(WithToken, ByToken) {
+			if _, err := p.consumeToken(WithToken, ByToken); err != nil {
+				return nil, err
+			}
+		}
+
+		valueDecl, err := p.consumeToken(NumberToken)
+		if err != nil {
+			return nil, err
+		}
+		optDecl.Add(valueDecl)
+	}
+
+	return seqDecl, nil
+}
+
+// TYPE type_name AS ENUM ('label' [, 'label'...])
+func (p *parser) parseEnumType() (*Decl, error) {
+	typeDecl, err := p.consumeToken(StringToken)
+	if err != nil {
+		return nil, err
+	}
+	typeDecl.Token = TypeToken
+
+	nameDecl, err := p.parseAttribute()
+	if err != nil {
+		return nil, err
+	}
+	typeDecl.Add(nameDecl)
+
+	if _, err := p.consumeToken(AsToken); err != nil {
+		return nil, err
+	}
+	if !p.is(StringToken) || !strings.EqualFold(p.cur().Lexeme, "enum") {
+		return nil, p.syntaxError()
+	}
+	enumDecl, err := p.consumeToken(StringToken)
+	if err != nil {
+		return nil, err
+	}
+	enumDecl.Token = EnumToken
+	typeDecl.Add(enumDecl)
+
+	if _, err := p.consumeToken(BracketOpeningToken); err != nil {
+		return nil, err
+	}
+	for !p.is(BracketClosingToken) {
+		if len(enumDecl.Decl) > 0 {
+			if _, err := p.consumeToken(CommaToken); err != nil {
+				return nil, err
+			}
+		}
+		labelDecl, err := p.parseStringLiteral()
+		if err != nil {
+			return nil, err
+		}
+		enumDecl.Add(labelDecl)
+	}
+	if _, err := p.consumeToken(BracketClosingToken); err != nil {
+		return nil, err
+	}
+
+	return typeDecl, nil
+}
+
+// DOMAIN domain_name [AS] type [DEFAULT value] [NOT NULL | NULL] [CHECK (condition)]
+//
+// Check decl holds the conditions, its lexeme is their SQL source.
+func (p *parser) parseDomain() (*Decl, error) {
+	domainDecl, err := p.consumeToken(StringToken)
+	if err != nil {
+		return nil, err
+	}
+	domainDecl.Token = DomainToken
+
+	nameDecl, err := p.parseAttribute()
+	if err != nil {
+		return nil, err
+	}
+	domainDecl.Add(nameDecl)
+
+	if p.is(AsToken) {
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+	}
+	typeDecl, err := p.parseType()
+	if err != nil {
+		return nil, err
+	}
+	domainDecl.Add(typeDecl)
+
+	// Constraints can be listed in any order
+	for p.hasNext() && !p.is(SemicolonToken) {
+		switch {
+		case p.is(DefaultToken):
+			dDecl, err := p.parseDefaultClause()
+			if err != nil {
+				return nil, err
+			}
+			domainDecl.Add(dDecl)
+		case p.is(NotToken):
+			notDecl, err := p.consumeToken(NotToken)
+			if err != nil {
+				return nil, err
+			}
+			nullDecl, err := p.consumeToken(NullToken)
+			if err != nil {
+				return nil, err
+			}
+			notDecl.Add(nullDecl)
+			domainDecl.Add(notDecl)
+		case p.is(NullToken):
+			if err := p.next(); err != nil {
+				return nil, err
+			}
+		case p.is(StringToken) && strings.EqualFold(p.cur().Lexeme, "check"):
+			checkDecl, err := p.parseCheck()
+			if err != nil {
+				return nil, err
+			}
+			domainDecl.Add(checkDecl)
+		default:
+			return nil, p.syntaxError()
+		}
+	}
+
+	return domainDecl, nil
+}
+
+// CHECK (condition)
+func (p *parser) parseCheck() (*Decl, error) {
+	checkDecl, err := p.consumeToken(StringToken)
+	if err != nil {
+		return nil, err
+	}
+	checkDecl.Token = CheckToken
+
+	if _, err := p.consumeToken(BracketOpeningToken); err != nil {
+		return nil, err
+	}
+	start := p.index
+	if p.is(BracketClosingToken) {
+		return nil, p.syntaxError()
+	}
+	if err := p.parseConditions(checkDecl); err != nil {
+		return nil, err
+	}
+	end := p.index
+	if _, err := p.consumeToken(BracketClosingToken); err != nil {
+		return nil, err
+	}
+
+	checkDecl.Lexeme = p.source(start, end)
+	return checkDecl, nil
+}
+
+// source returns the SQL source of tokens from start to end excluded
+func (p *parser) source(start, end int) string {
+	if p.query != "" {
+		return strings.TrimSpace(p.query[p.tokens[start].Pos:p.tokens[end].Pos])
+	}
+
+	lexemes := make([]string, 0, end-start)
+	for _, t := range p.tokens[start:end] {
+		lexemes = append(lexemes, t.Lexeme)
+	}
+	return strings.Join(lexemes, " ")
+}
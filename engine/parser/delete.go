@@ -33,8 +33,14 @@ func (p *parser) parseDelete() (*Instruction, error) {
 		return i, nil
 	}
 
-	err = p.parseWhere(deleteDecl)
-	if err != nil {
+	if p.is(WhereToken) {
+		err = p.parseWhere(deleteDecl)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if err = p.parseReturning(deleteDecl); err != nil {
 		return nil, err
 	}
 
@@ -1,5 +1,9 @@
 package parser
 
+import (
+	"strings"
+)
+
 func (p *parser) parseDrop(tokens []Token) (*Instruction, error) {
 	var err error
 	i := &Instruction{}
@@ -18,7 +22,7 @@ func (p *parser) parseDrop(tokens []Token) (*Instruction, error) {
 			return nil, err
 		}
 	case IndexToken:
-		d, err = p.consumeToken(SchemaToken)
+		d, err = p.consumeToken(IndexToken)
 		if err != nil {
 			return nil, err
 		}
@@ -27,15 +31,67 @@ func (p *parser) parseDrop(tokens []Token) (*Instruction, error) {
 		if err != nil {
 			return nil, err
 		}
+	case StringToken:
+		// TYPE, DOMAIN and SEQUENCE are not keywords, so attributes can still be named after them
+		var token int
+		switch strings.ToLower(tokens[p.index].Lexeme) {
+		case "type":
+			token = TypeToken
+		case "domain":
+			token = DomainToken
+		case "sequence":
+			token = SequenceToken
+		default:
+			return nil, p.syntaxError()
+		}
+		d, err = p.consumeToken(StringToken)
+		if err != nil {
+			return nil, err
+		}
+		d.Token = token
+	default:
+		return nil, p.syntaxError()
 	}
 	trDecl.Add(d)
 
-	// Should be a name attribute
-	nameDecl, err := p.parseAttribute()
+	// Maybe have "IF EXISTS" here
+	if p.is(IfToken) {
+		ifDecl, err := p.consumeToken(IfToken)
+		if err != nil {
+			return nil, err
+		}
+		existsDecl, err := p.consumeToken(ExistsToken)
+		if err != nil {
+			return nil, err
+		}
+		ifDecl.Add(existsDecl)
+		d.Add(ifDecl)
+	}
+
+	// Should be a name attribute, or a table name
+	var nameDecl *Decl
+	if d.Token == TableToken {
+		nameDecl, err = p.parseTableName()
+	} else {
+		nameDecl, err = p.parseAttribute()
+	}
 	if err != nil {
 		return nil, err
 	}
 	d.Add(nameDecl)
 
+	// CASCADE and RESTRICT are not keywords, so relations can still be named after them
+	if (d.Token == SchemaToken || d.Token == TableToken) && p.is(StringToken) {
+		switch l := strings.ToLower(p.cur().Lexeme); l {
+		case "cascade", "restrict":
+			behaviorDecl, err := p.consumeToken(StringToken)
+			if err != nil {
+				return nil, err
+			}
+			behaviorDecl.Lexeme = l
+			d.Add(behaviorDecl)
+		}
+	}
+
 	return i, nil
 }
@@ -0,0 +1,33 @@
+package parser
+
+// parseExplain parses an EXPLAIN statement of the form
+// EXPLAIN [ANALYZE] SELECT ...
+func (p *parser) parseExplain(tokens []Token) (*Instruction, error) {
+	i := &Instruction{}
+
+	// Set EXPLAIN decl
+	explainDecl, err := p.consumeToken(ExplainToken)
+	if err != nil {
+		return nil, err
+	}
+	i.Decls = append(i.Decls, explainDecl)
+
+	if p.is(AnalyzeToken) {
+		analyzeDecl, err := p.consumeToken(AnalyzeToken)
+		if err != nil {
+			return nil, err
+		}
+		explainDecl.Add(analyzeDecl)
+	}
+
+	if !p.is(SelectToken) {
+		return nil, p.syntaxError()
+	}
+	selectInst, err := p.parseSelect(tokens)
+	if err != nil {
+		return nil, err
+	}
+	explainDecl.Add(selectInst.Decls[0])
+
+	return i, nil
+}
@@ -0,0 +1,125 @@
+package parser
+
+import (
+	"fmt"
+	"strings"
+)
+
+// isExpression returns true if current token starts an expression which is
+// not a plain attribute, like a cast or a function call
+func (p *parser) isExpression() bool {
+	return p.isInterval() || p.isArray() || p.isFunctionCall()
+}
+
+// isFunctionCall returns true if current token is a name followed by an
+// opening bracket, like ABS(
+func (p *parser) isFunctionCall() bool {
+	if !p.is(StringToken) {
+		return false
+	}
+	_, err := p.isNext(BracketOpeningToken)
+	return err == nil
+}
+
+// parseFunctionCall parses a scalar function call of the form
+// name(argument[, argument...])
+//
+// Function decl is a FunctionToken decl with lowercased name as lexeme,
+// holding argument decls. Function names are resolved at execution.
+func (p *parser) parseFunctionCall() (*Decl, error) {
+	nameDecl, err := p.consumeToken(StringToken)
+	if err != nil {
+		return nil, err
+	}
+	funcDecl := &Decl{Token: FunctionToken, Lexeme: strings.ToLower(nameDecl.Lexeme)}
+
+	if _, err := p.consumeToken(BracketOpeningToken); err != nil {
+		return nil, err
+	}
+
+	for !p.is(BracketClosingToken) {
+		argDecl, err := p.parseExpression()
+		if err != nil {
+			return nil, err
+		}
+		funcDecl.Add(argDecl)
+
+		if p.is(CommaToken) {
+			if err := p.next(); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if !p.is(BracketClosingToken) {
+			return nil, p.syntaxError()
+		}
+	}
+
+	if _, err := p.consumeToken(BracketClosingToken); err != nil {
+		return nil, err
+	}
+
+	return funcDecl, nil
+}
+
+// parseFromItem parses a relation of a FROM or JOIN clause, either a table
+// name, a set returning function call like generate_series(1, 10), or a
+// subquery, which must have an alias.
+func (p *parser) parseFromItem() (*Decl, error) {
+	if p.isFunctionCall() {
+		return p.parseFunctionCall()
+	}
+	if !p.isSubquery() {
+		return p.parseTableName()
+	}
+
+	queryDecl, err := p.parseSubquery()
+	if err != nil {
+		return nil, err
+	}
+	if !p.is(AsToken, StringToken) {
+		return nil, fmt.Errorf("subquery in FROM must have an alias")
+	}
+	if err := p.parseAlias(queryDecl); err != nil {
+		return nil, err
+	}
+	return queryDecl, nil
+}
+
+// parseExtract parses a date field extraction of the form
+// EXTRACT(field FROM expression)
+//
+// It is returned as a call to date_part function, with field as a string
+// literal argument.
+func (p *parser) parseExtract() (*Decl, error) {
+	if _, err := p.consumeWord("extract", ExtractToken); err != nil {
+		return nil, err
+	}
+	if _, err := p.consumeToken(BracketOpeningToken); err != nil {
+		return nil, err
+	}
+	funcDecl := &Decl{Token: FunctionToken, Lexeme: "date_part"}
+
+	if p.is(FromToken, BracketClosingToken) {
+		return nil, p.syntaxError()
+	}
+	funcDecl.Add(&Decl{Token: SimpleQuoteToken, Lexeme: strings.ToLower(p.cur().Lexeme)})
+	if err := p.next(); err != nil {
+		return nil, err
+	}
+
+	if _, err := p.consumeToken(FromToken); err != nil {
+		return nil, err
+	}
+	exprDecl, err := p.parseExpression()
+	if err != nil {
+		return nil, err
+	}
+	funcDecl.Add(exprDecl)
+
+	if _, err := p.consumeToken(BracketClosingToken); err != nil {
+		return nil, err
+	}
+
+	return funcDecl, nil
+}
@@ -7,15 +7,25 @@ package parser
 //	|-> "INSERT" (InsertToken)
 //	    |-> "INTO" (IntoToken)
 //	        |-> table name
-//	            |-> column name
+//	            |-> column name (optional)
 //	            |-> (...)
+//	    |-> "SELECT" (SelectToken), for INSERT INTO ... SELECT
 //	    |-> "VALUES" (ValuesToken)
 //	        |-> "(" (BracketOpeningToken)
 //	            |-> value
 //	            |-> (...)
 //	        |-> (...)
+//	    |-> "CONFLICT" (ConflictToken) (optional)
+//	        |-> column name (optional)
+//	        |-> (...)
+//	        |-> "NOTHING" (NothingToken) or "UPDATE" (UpdateToken)
+//	            |-> column name
+//	                |-> "=" (EqualityToken)
+//	                |-> value or EXCLUDED.column name
+//	            |-> (...)
 //	    |-> "RETURNING" (ReturningToken) (optional)
-//	        |-> column name
+//	        |-> column name or "*" (StarToken)
+//	        |-> (...)
 func (p *parser) parseInsert() (*Instruction, error) {
 	i := &Instruction{}
 
@@ -40,31 +50,44 @@ func (p *parser) parseInsert() (*Instruction, error) {
 	}
 	intoDecl.Add(tableDecl)
 
-	_, err = p.consumeToken(BracketOpeningToken)
-	if err != nil {
-		return nil, err
-	}
-
-	// concerned attribute
-	for {
-		decl, err := p.parseListElement()
-		if err != nil {
+	// concerned attribute, if not specified all relation attributes are
+	if p.is(BracketOpeningToken) {
+		if _, err = p.consumeToken(BracketOpeningToken); err != nil {
 			return nil, err
 		}
-		tableDecl.Add(decl)
 
-		if p.is(BracketClosingToken) {
-			if _, err = p.consumeToken(BracketClosingToken); err != nil {
+		for {
+			quoted := p.is(DoubleQuoteToken)
+			decl, err := p.parseListElement()
+			if err != nil {
 				return nil, err
 			}
+			foldIdentifier(decl, quoted)
+			tableDecl.Add(decl)
+
+			if p.is(BracketClosingToken) {
+				if _, err = p.consumeToken(BracketClosingToken); err != nil {
+					return nil, err
+				}
+
+				break
+			}
 
-			break
+			_, err = p.consumeToken(CommaToken)
+			if err != nil {
+				return nil, err
+			}
 		}
+	}
 
-		_, err = p.consumeToken(CommaToken)
+	// may be INSERT INTO ... SELECT
+	if p.is(SelectToken) {
+		selectInst, err := p.parseSelect(p.tokens)
 		if err != nil {
 			return nil, err
 		}
+		insertDecl.Add(selectInst.Decls[0])
+		return i, nil
 	}
 
 	// should be VALUES
@@ -108,19 +131,118 @@ func (p *parser) parseInsert() (*Instruction, error) {
 		break
 	}
 
+	// we may have `ON CONFLICT` here
+	if p.is(OnToken) {
+		if err = p.parseOnConflict(insertDecl); err != nil {
+			return nil, err
+		}
+	}
+
 	// we may have `returning "something"` here
-	if retDecl, err := p.consumeToken(ReturningToken); err == nil {
-		insertDecl.Add(retDecl)
+	if err = p.parseReturning(insertDecl); err != nil {
+		return nil, err
+	}
 
-		// returned attribute
-		attrDecl, err := p.parseAttribute()
+	return i, nil
+}
+
+// parseOnConflict parses the conflict clause of an INSERT statement
+// ON CONFLICT [(column, ...)] DO NOTHING
+// ON CONFLICT [(column, ...)] DO UPDATE SET column = value, column = EXCLUDED.column
+func (p *parser) parseOnConflict(insertDecl *Decl) error {
+	if _, err := p.consumeToken(OnToken); err != nil {
+		return err
+	}
+
+	// CONFLICT and NOTHING are not keywords, so attributes can still be named after them
+	conflictDecl, err := p.consumeWord("conflict", ConflictToken)
+	if err != nil {
+		return err
+	}
+	insertDecl.Add(conflictDecl)
+
+	// conflict target
+	if p.is(BracketOpeningToken) {
+		if _, err = p.consumeToken(BracketOpeningToken); err != nil {
+			return err
+		}
+		for {
+			attrDecl, err := p.parseAttribute()
+			if err != nil {
+				return err
+			}
+			conflictDecl.Add(attrDecl)
+
+			if !p.is(CommaToken) {
+				break
+			}
+			if _, err = p.consumeToken(CommaToken); err != nil {
+				return err
+			}
+		}
+		if _, err = p.consumeToken(BracketClosingToken); err != nil {
+			return err
+		}
+	}
+
+	if _, err = p.consumeToken(DoToken); err != nil {
+		return err
+	}
+
+	if p.isWord("nothing") {
+		nothingDecl, err := p.consumeWord("nothing", NothingToken)
 		if err != nil {
-			return nil, err
+			return err
 		}
-		retDecl.Add(attrDecl)
+		conflictDecl.Add(nothingDecl)
+		return nil
 	}
 
-	return i, nil
+	updateDecl, err := p.consumeToken(UpdateToken)
+	if err != nil {
+		return err
+	}
+	conflictDecl.Add(updateDecl)
+
+	if _, err = p.consumeToken(SetToken); err != nil {
+		return err
+	}
+
+	for {
+		attrDecl, err := p.parseAttribute()
+		if err != nil {
+			return err
+		}
+		updateDecl.Add(attrDecl)
+
+		eqDecl, err := p.consumeToken(EqualityToken)
+		if err != nil {
+			return err
+		}
+		attrDecl.Add(eqDecl)
+
+		var valueDecl *Decl
+		switch {
+		case p.is(NullToken):
+			valueDecl, err = p.consumeToken(NullToken)
+		case p.is(StringToken) && p.hasNext() && p.tokens[p.index+1].Token == PeriodToken:
+			// EXCLUDED.column
+			valueDecl, err = p.parseAttribute()
+		default:
+			valueDecl, err = p.parseValue()
+		}
+		if err != nil {
+			return err
+		}
+		attrDecl.Add(valueDecl)
+
+		if !p.is(CommaToken) {
+			return nil
+		}
+		if _, err = p.consumeToken(CommaToken); err != nil {
+			return err
+		}
+	}
 }
 
 func (p *parser) parseListElement() (*Decl, error) {
@@ -135,13 +257,23 @@ func (p *parser) parseListElement() (*Decl, error) {
 		return v, nil
 	}
 
+	// nextval('sequence') or currval('sequence')
+	if (p.isWord("nextval") || p.isWord("currval")) && p.isFunctionCall() {
+		return p.parseSequenceFunc()
+	}
+
+	// ARRAY[value, ...]
+	if p.isArray() {
+		return p.parseArray()
+	}
+
 	if p.is(SimpleQuoteToken) || p.is(DoubleQuoteToken) {
 		quoted = true
 		p.next()
 	}
 
 	var valueDecl *Decl
-	valueDecl, err := p.consumeToken(FloatToken, StringToken, NumberToken, NullToken, DateToken, NowToken, ArgToken, NamedArgToken, FalseToken)
+	valueDecl, err := p.consumeToken(FloatToken, StringToken, NumberToken, NullToken, DateToken, NowToken, LocalTimestampToken, CurrentDateToken, ArgToken, NamedArgToken, FalseToken)
 	if err != nil {
 		return nil, err
 	}
@@ -154,3 +286,35 @@ func (p *parser) parseListElement() (*Decl, error) {
 
 	return valueDecl, nil
 }
+
+// parseSequenceFunc parses sequence manipulation functions
+// nextval('sequence_name')
+// currval('sequence_name')
+func (p *parser) parseSequenceFunc() (*Decl, error) {
+	var funcDecl *Decl
+	var err error
+	if p.isWord("nextval") {
+		funcDecl, err = p.consumeWord("nextval", NextvalToken)
+	} else {
+		funcDecl, err = p.consumeWord("currval", CurrvalToken)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err = p.consumeToken(BracketOpeningToken); err != nil {
+		return nil, err
+	}
+
+	nameDecl, err := p.parseStringLiteral()
+	if err != nil {
+		return nil, err
+	}
+	funcDecl.Add(nameDecl)
+
+	if _, err = p.consumeToken(BracketClosingToken); err != nil {
+		return nil, err
+	}
+
+	return funcDecl, nil
+}
@@ -4,19 +4,39 @@ import (
 	"errors"
 )
 
+// PositionError is an error of lexer or parser, located at the token it
+// occurred on
+type PositionError struct {
+	// Pos is the byte offset of token in instruction
+	Pos int
+	err error
+}
+
+func (e *PositionError) Error() string {
+	return e.err.Error()
+}
+
+func (e *PositionError) Unwrap() error {
+	return e.err
+}
+
 // ParseInstruction calls lexer and parser, then return Decl tree for each instruction
 func ParseInstruction(instruction string) ([]Instruction, error) {
 
 	l := lexer{}
 	tokens, err := l.lex([]byte(instruction))
 	if err != nil {
-		return nil, err
+		return nil, &PositionError{Pos: l.pos, err: err}
 	}
 
-	p := parser{}
+	p := parser{query: instruction}
 	instructions, err := p.parse(tokens)
 	if err != nil {
-		return nil, err
+		pos := len(instruction)
+		if p.index < len(p.tokens) {
+			pos = p.tokens[p.index].Pos
+		}
+		return nil, &PositionError{Pos: pos, err: err}
 	}
 
 	if len(instructions) == 0 {
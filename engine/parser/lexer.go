@@ -2,6 +2,8 @@ package parser
 
 import (
 	"fmt"
+	"strconv"
+	"strings"
 	"unicode"
 
 	"github.com/proullon/ramsql/engine/log"
@@ -29,6 +31,10 @@ const (
 	StarToken
 	EqualityToken
 	DistinctnessToken
+	RegexMatchToken
+	ArrayOpToken
+	SquareBracketOpeningToken
+	SquareBracketClosingToken
 	PeriodToken
 
 	// First order Token
@@ -43,6 +49,9 @@ const (
 	DropToken
 	GrantToken
 	DistinctToken
+	ShowToken
+	DescribeToken
+	AlterToken
 
 	// Second order Token
 
@@ -87,6 +96,58 @@ const (
 	IndexToken
 	CollateToken
 	NocaseToken
+	RestartToken
+	ContinueToken
+	IdentityToken
+	CurrentDateToken
+	RandomToken
+	SequenceToken
+	StartToken
+	IncrementToken
+	NextvalToken
+	CurrvalToken
+	UsingToken
+	AnalyzeToken
+	ConflictToken
+	DoToken
+	NothingToken
+	AddToken
+	ColumnToken
+	RenameToken
+	UnionToken
+	AllToken
+	IntersectToken
+	ExceptToken
+	RecursiveToken
+	MaxToken
+	MinToken
+	SumToken
+	AvgToken
+	RowNumberToken
+	OverToken
+	PartitionToken
+	RankToken
+	DenseRankToken
+	LagToken
+	LeadToken
+	CastToken
+	DoubleColonToken
+	FunctionToken
+	ExtractToken
+	IntervalToken
+	PlusToken
+	MinusToken
+	ReferencesToken
+	NaturalToken
+	FilterToken
+	WithinToken
+	ArrayToken
+	AnyToken
+	SubscriptToken
+	TypeToken
+	EnumToken
+	DomainToken
+	CheckToken
 
 	// Type Token
 
@@ -108,6 +169,8 @@ const (
 type Token struct {
 	Token  int
 	Lexeme string
+	// Pos is the byte offset of token in lexed instruction
+	Pos int
 }
 
 type lexer struct {
@@ -115,6 +178,8 @@ type lexer struct {
 	instruction    []byte
 	instructionLen int
 	pos            int
+	// number of ODBC (?) placeholders matched so far
+	odbcIdx int
 }
 
 // Matcher tries to match given string to an SQL token
@@ -125,22 +190,30 @@ func (l *lexer) lex(instruction []byte) ([]Token, error) {
 	l.tokens = nil
 	l.instruction = instruction
 	l.pos = 0
+	l.odbcIdx = 0
 	securityPos := 0
 
 	var matchers []Matcher
 	matchers = append(matchers, l.MatchArgTokenODBC)
 	matchers = append(matchers, l.MatchNamedArgToken)
 	matchers = append(matchers, l.MatchArgToken)
+	matchers = append(matchers, l.MatchMinusToken)
 	matchers = append(matchers, l.MatchFloatToken)
 	// Punctuation Matcher
 	matchers = append(matchers, l.MatchSpaceToken)
+	matchers = append(matchers, l.MatchDoubleColonToken)
 	matchers = append(matchers, l.genericByteMatcher(';', SemicolonToken))
 	matchers = append(matchers, l.genericByteMatcher(',', CommaToken))
 	matchers = append(matchers, l.genericByteMatcher('(', BracketOpeningToken))
 	matchers = append(matchers, l.genericByteMatcher(')', BracketClosingToken))
 	matchers = append(matchers, l.genericByteMatcher('*', StarToken))
+	matchers = append(matchers, l.genericByteMatcher('+', PlusToken))
 	matchers = append(matchers, l.MatchSimpleQuoteToken)
 	matchers = append(matchers, l.genericByteMatcher('=', EqualityToken))
+	matchers = append(matchers, l.genericSymbolMatcher(RegexMatchToken, "!~*", "!~", "~*", "~"))
+	matchers = append(matchers, l.genericSymbolMatcher(ArrayOpToken, "@>", "<@", "&&"))
+	matchers = append(matchers, l.genericByteMatcher('[', SquareBracketOpeningToken))
+	matchers = append(matchers, l.genericByteMatcher(']', SquareBracketClosingToken))
 	matchers = append(matchers, l.genericStringMatcher("<>", DistinctnessToken))
 	matchers = append(matchers, l.genericStringMatcher("!=", DistinctnessToken))
 	matchers = append(matchers, l.genericByteMatcher('.', PeriodToken))
@@ -157,9 +230,11 @@ func (l *lexer) lex(instruction []byte) ([]Token, error) {
 	matchers = append(matchers, l.genericStringMatcher("update", UpdateToken))
 	matchers = append(matchers, l.genericStringMatcher("delete", DeleteToken))
 	matchers = append(matchers, l.genericStringMatcher("truncate", TruncateToken))
+	matchers = append(matchers, l.genericStringMatcher("explain", ExplainToken))
 	matchers = append(matchers, l.genericStringMatcher("drop", DropToken))
 	matchers = append(matchers, l.genericStringMatcher("grant", GrantToken))
 	matchers = append(matchers, l.genericStringMatcher("distinct", DistinctToken))
+	matchers = append(matchers, l.genericStringMatcher("alter", AlterToken))
 	// Second order Matcher
 	matchers = append(matchers, l.genericStringMatcher("table", TableToken))
 	matchers = append(matchers, l.genericStringMatcher("current_schema()", CurrentSchemaToken))
@@ -196,6 +271,9 @@ func (l *lexer) lex(instruction []byte) ([]Token, error) {
 	matchers = append(matchers, l.genericStringMatcher("for", ForToken))
 	matchers = append(matchers, l.genericStringMatcher("default", DefaultToken))
 	matchers = append(matchers, l.genericStringMatcher("localtimestamp", LocalTimestampToken))
+	matchers = append(matchers, l.genericStringMatcher("current_timestamp", LocalTimestampToken))
+	matchers = append(matchers, l.genericStringMatcher("current_date", CurrentDateToken))
+	matchers = append(matchers, l.genericStringMatcher("random()", RandomToken))
 	matchers = append(matchers, l.genericStringMatcher("false", FalseToken))
 	matchers = append(matchers, l.genericStringMatcher("unique", UniqueToken))
 	matchers = append(matchers, l.genericStringMatcher("now()", NowToken))
@@ -204,6 +282,17 @@ func (l *lexer) lex(instruction []byte) ([]Token, error) {
 	matchers = append(matchers, l.genericStringMatcher("on", OnToken))
 	matchers = append(matchers, l.genericStringMatcher("collate", CollateToken))
 	matchers = append(matchers, l.genericStringMatcher("nocase", NocaseToken))
+	matchers = append(matchers, l.genericStringMatcher("continue", ContinueToken))
+	matchers = append(matchers, l.genericStringMatcher("analyze", AnalyzeToken))
+	matchers = append(matchers, l.genericStringMatcher("do", DoToken))
+	matchers = append(matchers, l.genericStringMatcher("add", AddToken))
+	matchers = append(matchers, l.genericStringMatcher("union", UnionToken))
+	matchers = append(matchers, l.genericStringMatcher("all", AllToken))
+	matchers = append(matchers, l.genericStringMatcher("intersect", IntersectToken))
+	matchers = append(matchers, l.genericStringMatcher("except", ExceptToken))
+	matchers = append(matchers, l.genericStringMatcher("recursive", RecursiveToken))
+	matchers = append(matchers, l.genericStringMatcher("references", ReferencesToken))
+	matchers = append(matchers, l.genericStringMatcher("any", AnyToken))
 	// Type Matcher
 	matchers = append(matchers, l.genericStringMatcher("decimal", DecimalToken))
 	matchers = append(matchers, l.genericStringMatcher("primary", PrimaryToken))
@@ -216,12 +305,16 @@ func (l *lexer) lex(instruction []byte) ([]Token, error) {
 	var r bool
 	for l.pos < l.instructionLen {
 		r = false
+		start, n := l.pos, len(l.tokens)
 		for _, m := range matchers {
 			if r = m(); r {
 				securityPos = l.pos
 				break
 			}
 		}
+		if r && len(l.tokens) > n {
+			l.tokens[n].Pos = start
+		}
 
 		if r {
 			continue
@@ -250,36 +343,45 @@ func (l *lexer) MatchArgTokenODBC() bool {
 		return false
 	}
 	i++
+	// ODBC placeholders are numbered in order of appearance, so they are
+	// handled like Postgres ones: first ? is $1, second ? is $2, ...
+	l.odbcIdx++
 	t := Token{
 		Token:  ArgToken,
-		Lexeme: "?",
+		Lexeme: strconv.Itoa(l.odbcIdx),
 	}
 	l.tokens = append(l.tokens, t)
 	l.pos = i
 	return true
 }
 
+// MatchNamedArgToken matches named placeholders :name, @name and $name
 func (l *lexer) MatchNamedArgToken() bool {
 
 	i := l.pos
-	if l.instruction[i] != ':' {
+	switch l.instruction[i] {
+	case ':', '@', '$':
+	default:
 		return false
 	}
 	i++
-	for i < l.instructionLen && unicode.IsLetter(rune(l.instruction[i])) {
-		i++
+	if i >= l.instructionLen || !unicode.IsLetter(rune(l.instruction[i])) {
+		return false
 	}
-	if i > l.pos+1 {
-		t := Token{
-			Token:  NamedArgToken,
-			Lexeme: string(l.instruction[l.pos+1 : i]),
-		}
-		l.tokens = append(l.tokens, t)
-		l.pos = i
-		return true
+	for i < l.instructionLen &&
+		(unicode.IsLetter(rune(l.instruction[i])) ||
+			unicode.IsDigit(rune(l.instruction[i])) ||
+			l.instruction[i] == '_') {
+		i++
 	}
 
-	return false
+	t := Token{
+		Token:  NamedArgToken,
+		Lexeme: string(l.instruction[l.pos+1 : i]),
+	}
+	l.tokens = append(l.tokens, t)
+	l.pos = i
+	return true
 }
 
 func (l *lexer) MatchArgToken() bool {
@@ -567,15 +669,27 @@ func (l *lexer) MatchSimpleQuoteToken() bool {
 	return false
 }
 
+// MatchSingleQuotedStringToken matches a string up to closing quote.
+// A quote inside the string is escaped by doubling it.
 func (l *lexer) MatchSingleQuotedStringToken() bool {
+	var sb strings.Builder
 	i := l.pos
-	for i < l.instructionLen && l.instruction[i] != '\'' {
+	for i < l.instructionLen {
+		if l.instruction[i] == '\'' {
+			if i+1 < l.instructionLen && l.instruction[i+1] == '\'' {
+				sb.WriteByte('\'')
+				i += 2
+				continue
+			}
+			break
+		}
+		sb.WriteByte(l.instruction[i])
 		i++
 	}
 
 	t := Token{
 		Token:  StringToken,
-		Lexeme: string(l.instruction[l.pos:i]),
+		Lexeme: sb.String(),
 	}
 	l.tokens = append(l.tokens, t)
 	l.pos = i
@@ -583,6 +697,48 @@ func (l *lexer) MatchSingleQuotedStringToken() bool {
 	return true
 }
 
+// MatchDoubleColonToken matches the :: cast operator
+func (l *lexer) MatchDoubleColonToken() bool {
+	if l.pos+1 >= l.instructionLen || l.instruction[l.pos] != ':' || l.instruction[l.pos+1] != ':' {
+		return false
+	}
+
+	l.tokens = append(l.tokens, Token{Token: DoubleColonToken, Lexeme: "::"})
+	l.pos += 2
+	return true
+}
+
+// genericSymbolMatcher matches the first of symbols found, so longer symbols
+// must come first, like !~* before !~. Unlike keywords, symbols may be
+// followed by a letter.
+func (l *lexer) genericSymbolMatcher(token int, symbols ...string) Matcher {
+	return func() bool {
+		for _, sym := range symbols {
+			if l.pos+len(sym) <= l.instructionLen && string(l.instruction[l.pos:l.pos+len(sym)]) == sym {
+				l.tokens = append(l.tokens, Token{Token: token, Lexeme: sym})
+				l.pos += len(sym)
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// MatchMinusToken matches the subtraction operator. A minus followed by a
+// digit is left to number matchers, as the sign of a number.
+func (l *lexer) MatchMinusToken() bool {
+	if l.instruction[l.pos] != '-' {
+		return false
+	}
+	if l.pos+1 < l.instructionLen && (unicode.IsDigit(rune(l.instruction[l.pos+1])) || l.instruction[l.pos+1] == '.') {
+		return false
+	}
+
+	l.tokens = append(l.tokens, Token{Token: MinusToken, Lexeme: "-"})
+	l.pos++
+	return true
+}
+
 func (l *lexer) MatchSingle(char byte, token int) bool {
 
 	if l.pos > l.instructionLen {
@@ -605,7 +761,7 @@ func (l *lexer) MatchSingle(char byte, token int) bool {
 
 func (l *lexer) Match(str []byte, token int) bool {
 
-	if l.pos+len(str)-1 > l.instructionLen {
+	if l.pos+len(str) > l.instructionLen {
 		return false
 	}
 
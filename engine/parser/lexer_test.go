@@ -71,6 +71,76 @@ func TestLexerWithInsertScientificNotation(t *testing.T) {
 	}
 }
 
+func TestLexerODBCPlaceholders(t *testing.T) {
+	query := `SELECT * FROM foo WHERE a = ? AND b IN (?, ?) LIMIT ?`
+
+	lexer := lexer{}
+	tokens, err := lexer.lex([]byte(query))
+	if err != nil {
+		t.Fatalf("Cannot lex <%s> string", query)
+	}
+
+	var got []string
+	for _, tok := range tokens {
+		if tok.Token == ArgToken {
+			got = append(got, tok.Lexeme)
+		}
+	}
+	if len(got) != 4 || got[0] != "1" || got[1] != "2" || got[2] != "3" || got[3] != "4" {
+		t.Fatalf("expected placeholders to be numbered 1 to 4, got %v", got)
+	}
+}
+
+func TestLexerNamedPlaceholders(t *testing.T) {
+	query := `SELECT * FROM foo WHERE a = :id AND b = @user_id AND c = $name2 AND d = $1 AND e = 'x@y.z'`
+
+	lexer := lexer{}
+	tokens, err := lexer.lex([]byte(query))
+	if err != nil {
+		t.Fatalf("Cannot lex <%s> string", query)
+	}
+
+	var named []string
+	for _, tok := range tokens {
+		if tok.Token == NamedArgToken {
+			named = append(named, tok.Lexeme)
+		}
+	}
+	if len(named) != 3 || named[0] != "id" || named[1] != "user_id" || named[2] != "name2" {
+		t.Fatalf("expected named placeholders [id user_id name2], got %v", named)
+	}
+}
+
+func TestLexerKeywordPrefixAtEnd(t *testing.T) {
+	query := `SELECT id FROM a`
+
+	lexer := lexer{}
+	_, err := lexer.lex([]byte(query))
+	if err != nil {
+		t.Fatalf("Cannot lex <%s> string: %s", query, err)
+	}
+}
+
+func TestLexerEscapedQuote(t *testing.T) {
+	query := `INSERT INTO foo (a, b) VALUES ('it''s', '''')`
+
+	lexer := lexer{}
+	tokens, err := lexer.lex([]byte(query))
+	if err != nil {
+		t.Fatalf("Cannot lex <%s> string", query)
+	}
+
+	var strs []string
+	for i, tok := range tokens {
+		if tok.Token == StringToken && i > 0 && tokens[i-1].Token == SimpleQuoteToken {
+			strs = append(strs, tok.Lexeme)
+		}
+	}
+	if len(strs) != 2 || strs[0] != "it's" || strs[1] != "'" {
+		t.Fatalf("expected strings [it's '], got %v", strs)
+	}
+}
+
 func Test_lexer_MatchNumberToken(t *testing.T) {
 	tests := []struct {
 		name string
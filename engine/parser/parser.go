@@ -5,6 +5,7 @@ package parser
 
 import (
 	"fmt"
+	"strings"
 
 	"github.com/proullon/ramsql/engine/log"
 )
@@ -15,6 +16,8 @@ type parser struct {
 	index    int
 	tokenLen int
 	tokens   []Token
+	// query is the instruction tokens were lexed from, if known
+	query string
 }
 
 // Decl structure is the node to statement declaration tree
@@ -22,6 +25,8 @@ type Decl struct {
 	Token  int
 	Lexeme string
 	Decl   []*Decl
+	// Pos is the byte offset of declaration token in parsed instruction
+	Pos int
 }
 
 // Stringy prints the declaration tree in console
@@ -71,6 +76,7 @@ func NewDecl(t Token) *Decl {
 	return &Decl{
 		Token:  t.Token,
 		Lexeme: t.Lexeme,
+		Pos:    t.Pos,
 	}
 }
 
@@ -81,6 +87,11 @@ func (d *Decl) Add(subDecl *Decl) {
 
 func (p *parser) parse(tokens []Token) ([]Instruction, error) {
 	tokens = stripSpaces(tokens)
+	// make sure last statement is terminated, so optional trailing clauses
+	// like aliases can be told apart from the end of input
+	if n := len(tokens); n > 0 && tokens[n-1].Token != SemicolonToken {
+		tokens = append(tokens, Token{Token: SemicolonToken, Lexeme: ";", Pos: tokens[n-1].Pos + len(tokens[n-1].Lexeme)})
+	}
 	p.tokens = tokens
 	log.Debug("parser.parse: %v\n", p.tokens)
 
@@ -102,7 +113,7 @@ func (p *parser) parse(tokens []Token) ([]Instruction, error) {
 		// Now,
 		// Create a logical tree of all tokens
 		// We start with first order query
-		// CREATE, SELECT, INSERT, UPDATE, DELETE, TRUNCATE, DROP, EXPLAIN
+		// CREATE, SELECT, INSERT, UPDATE, DELETE, TRUNCATE, DROP, EXPLAIN, SHOW, DESCRIBE, ALTER, WITH
 		switch tokens[p.index].Token {
 		case CreateToken:
 			i, err := p.parseCreate(tokens)
@@ -146,8 +157,52 @@ func (p *parser) parse(tokens []Token) ([]Instruction, error) {
 				return nil, err
 			}
 			p.i = append(p.i, *i)
+		case AnalyzeToken:
+			i, err := p.parseAnalyze()
+			if err != nil {
+				return nil, err
+			}
+			p.i = append(p.i, *i)
 		case ExplainToken:
-			break
+			i, err := p.parseExplain(tokens)
+			if err != nil {
+				return nil, err
+			}
+			p.i = append(p.i, *i)
+		case SetToken:
+			i, err := p.parseSet()
+			if err != nil {
+				return nil, err
+			}
+			p.i = append(p.i, *i)
+		case StringToken:
+			// SHOW and DESCRIBE are not keywords, so attributes can still be named after them
+			var i *Instruction
+			var err error
+			switch strings.ToLower(tokens[p.index].Lexeme) {
+			case "show":
+				i, err = p.parseShow()
+			case "describe":
+				i, err = p.parseDescribe()
+			default:
+				return nil, fmt.Errorf("Parsing error near <%s>", tokens[p.index].Lexeme)
+			}
+			if err != nil {
+				return nil, err
+			}
+			p.i = append(p.i, *i)
+		case AlterToken:
+			i, err := p.parseAlter()
+			if err != nil {
+				return nil, err
+			}
+			p.i = append(p.i, *i)
+		case WithToken:
+			i, err := p.parseWith()
+			if err != nil {
+				return nil, err
+			}
+			p.i = append(p.i, *i)
 		case GrantToken:
 			i := &Instruction{}
 			i.Decls = append(i.Decls, NewDecl(Token{Token: GrantToken}))
@@ -187,7 +242,7 @@ func (p *parser) parseUpdate() (*Instruction, error) {
 
 	// should be a list of equality
 	gotClause := false
-	for p.tokens[p.index].Token != WhereToken {
+	for !p.is(WhereToken, ReturningToken) {
 
 		if !p.hasNext() && gotClause {
 			break
@@ -204,14 +259,52 @@ func (p *parser) parseUpdate() (*Instruction, error) {
 		gotClause = true
 	}
 
-	err = p.parseWhere(updateDecl)
-	if err != nil {
+	if p.is(WhereToken) {
+		err = p.parseWhere(updateDecl)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if err = p.parseReturning(updateDecl); err != nil {
 		return nil, err
 	}
 
 	return i, nil
 }
 
+// parseReturning parses an optional RETURNING clause and adds it to decl.
+//
+//	|-> "RETURNING" (ReturningToken)
+//	    |-> column name or "*" (StarToken)
+//	    |-> (...)
+func (p *parser) parseReturning(decl *Decl) error {
+	if !p.is(ReturningToken) {
+		return nil
+	}
+
+	retDecl, err := p.consumeToken(ReturningToken)
+	if err != nil {
+		return err
+	}
+	decl.Add(retDecl)
+
+	for {
+		attrDecl, err := p.parseAttribute()
+		if err != nil {
+			return err
+		}
+		retDecl.Add(attrDecl)
+
+		if !p.is(CommaToken) {
+			return nil
+		}
+		if _, err = p.consumeToken(CommaToken); err != nil {
+			return err
+		}
+	}
+}
+
 func (p *parser) parseType() (*Decl, error) {
 	typeDecl, err := p.consumeToken(FloatToken, DateToken, DecimalToken, NumberToken, StringToken)
 	if err != nil {
@@ -235,6 +328,20 @@ func (p *parser) parseType() (*Decl, error) {
 		}
 	}
 
+	// Maybe an array type, like TEXT[]
+	if p.is(SquareBracketOpeningToken) {
+		if _, err := p.consumeToken(SquareBracketOpeningToken); err != nil {
+			return nil, err
+		}
+		if _, err := p.consumeToken(SquareBracketClosingToken); err != nil {
+			return nil, err
+		}
+		if p.is(SquareBracketOpeningToken) {
+			return nil, fmt.Errorf("multidimensional arrays are not supported")
+		}
+		typeDecl.Lexeme += "[]"
+	}
+
 	return typeDecl, nil
 }
 
@@ -251,13 +358,26 @@ func (p *parser) parseOrderBy(selectDecl *Decl) error {
 	}
 
 	for {
-		// parse attribute now
-		attrDecl, err := p.parseAttribute()
+		// parse attribute, or select list position, now
+		var attrDecl *Decl
+		if p.is(NumberToken) {
+			attrDecl, err = p.consumeToken(NumberToken)
+		} else {
+			attrDecl, err = p.parseAttribute()
+		}
 		if err != nil {
 			return err
 		}
 		orderDecl.Add(attrDecl)
 
+		if p.is(CollateToken) {
+			collateDecl, err := p.parseCollateClause()
+			if err != nil {
+				return err
+			}
+			attrDecl.Add(collateDecl)
+		}
+
 		if p.is(AscToken, DescToken) {
 			decl, err := p.consumeToken(AscToken, DescToken)
 			if err != nil {
@@ -278,14 +398,38 @@ func (p *parser) parseOrderBy(selectDecl *Decl) error {
 	return nil
 }
 
-// parseBuiltinFunc looks for COUNT,MAX,MIN
+// aggregates maps names of aggregate functions which are not keywords, so
+// attributes can still be named after them, to their token
+var aggregates = map[string]int{
+	"max": MaxToken,
+	"min": MinToken,
+	"sum": SumToken,
+	"avg": AvgToken,
+}
+
+// isAggregate returns true if current token starts a call of COUNT, MAX, MIN,
+// SUM or AVG
+func (p *parser) isAggregate() bool {
+	if p.is(CountToken) {
+		return true
+	}
+	_, ok := aggregates[strings.ToLower(p.cur().Lexeme)]
+	return ok && p.isFunctionCall()
+}
+
+// parseBuiltinFunc looks for COUNT,MAX,MIN,SUM,AVG
 func (p *parser) parseBuiltinFunc() (*Decl, error) {
 	var d *Decl
 	var err error
 
-	// COUNT(attribute)
-	if p.is(CountToken) {
-		d, err = p.consumeToken(CountToken)
+	// COUNT(attribute), MAX(attribute), ...
+	if p.isAggregate() {
+		if p.is(CountToken) {
+			d, err = p.consumeToken(CountToken)
+		} else {
+			name := strings.ToLower(p.cur().Lexeme)
+			d, err = p.consumeWord(name, aggregates[name])
+		}
 		if err != nil {
 			return nil, err
 		}
@@ -299,6 +443,10 @@ func (p *parser) parseBuiltinFunc() (*Decl, error) {
 		if err != nil {
 			return nil, err
 		}
+		// only COUNT accepts a star
+		if attr.Token == StarToken && d.Token != CountToken {
+			return nil, p.syntaxError()
+		}
 		d.Add(attr)
 		// Bracket
 		_, err = p.consumeToken(BracketClosingToken)
@@ -310,6 +458,78 @@ func (p *parser) parseBuiltinFunc() (*Decl, error) {
 	return d, nil
 }
 
+// isFilter returns true if current token starts the FILTER clause of an
+// aggregate function. FILTER is not a keyword, so attributes can still be
+// named filter.
+func (p *parser) isFilter() bool {
+	return p.isWord("filter") && p.isFunctionCall()
+}
+
+// parseFilter parses the FILTER clause of an aggregate function, of the form
+// FILTER (WHERE condition)
+// and adds it to aggregate decl as a FilterToken decl holding a WhereToken decl.
+func (p *parser) parseFilter(aggregateDecl *Decl) error {
+	filterDecl, err := p.consumeWord("filter", FilterToken)
+	if err != nil {
+		return err
+	}
+	if _, err = p.consumeToken(BracketOpeningToken); err != nil {
+		return err
+	}
+	if err = p.parseWhere(filterDecl); err != nil {
+		return err
+	}
+	if _, err = p.consumeToken(BracketClosingToken); err != nil {
+		return err
+	}
+
+	aggregateDecl.Add(filterDecl)
+	return nil
+}
+
+// isWithinGroup returns true if current token starts the ordering of an
+// ordered-set aggregate, WITHIN GROUP
+func (p *parser) isWithinGroup() bool {
+	if !p.isWord("within") || !p.hasNext() {
+		return false
+	}
+	next := p.tokens[p.index+1]
+	return next.Token == StringToken && strings.EqualFold(next.Lexeme, "group")
+}
+
+// parseWithinGroup parses the ordering of an ordered-set aggregate, of the
+// form
+// WITHIN GROUP (ORDER BY attribute [ASC|DESC])
+// and adds it to function decl as a WithinToken decl holding an OrderToken
+// decl. GROUP is not a keyword, as it names relations.
+func (p *parser) parseWithinGroup(funcDecl *Decl) error {
+	withinDecl, err := p.consumeWord("within", WithinToken)
+	if err != nil {
+		return err
+	}
+	if !p.is(StringToken) || !strings.EqualFold(p.cur().Lexeme, "group") {
+		return p.syntaxError()
+	}
+	if err = p.next(); err != nil {
+		return err
+	}
+	if _, err = p.consumeToken(BracketOpeningToken); err != nil {
+		return err
+	}
+	if !p.is(OrderToken) {
+		return p.syntaxError()
+	}
+	if err = p.parseOrderBy(withinDecl); err != nil {
+		return err
+	}
+	if _, err = p.consumeToken(BracketClosingToken); err != nil {
+		return err
+	}
+
+	funcDecl.Add(withinDecl)
+	return nil
+}
+
 // parseTableName parse a table of the form
 // schema.table
 // "schema".table
@@ -334,6 +554,7 @@ func (p *parser) parseTableName() (*Decl, error) {
 		return nil, p.syntaxError()
 	}
 	decl := NewDecl(p.cur())
+	foldIdentifier(decl, quoted)
 
 	if quoted {
 		// Check there is a closing quote
@@ -368,6 +589,7 @@ func (p *parser) parseTableName() (*Decl, error) {
 		if err != nil {
 			return nil, err
 		}
+		foldIdentifier(attributeDecl, quoted)
 		decl.Token = SchemaToken
 		attributeDecl.Add(decl)
 
@@ -380,8 +602,8 @@ func (p *parser) parseTableName() (*Decl, error) {
 		return attributeDecl, nil
 	}
 
-	// AS SOMETHING ?
-	if p.is(AsToken) {
+	// AS SOMETHING ? (and not CREATE TABLE ... AS SELECT)
+	if _, err := p.isNext(StringToken); p.is(AsToken) && err == nil {
 		asDecl, err := p.consumeToken(AsToken)
 		if err != nil {
 			return nil, err
@@ -391,6 +613,7 @@ func (p *parser) parseTableName() (*Decl, error) {
 		if err != nil {
 			return nil, err
 		}
+		foldIdentifier(aliasDecl, false)
 		asDecl.Add(aliasDecl)
 	}
 
@@ -423,6 +646,8 @@ func (p *parser) parseAttribute() (*Decl, error) {
 		return nil, p.syntaxError()
 	}
 	decl := NewDecl(p.cur())
+	// table or attribute name, both folded the same way
+	foldIdentifier(decl, quoted)
 
 	if quoted {
 		// Check there is a closing quote
@@ -457,6 +682,7 @@ func (p *parser) parseAttribute() (*Decl, error) {
 		if err != nil {
 			return nil, err
 		}
+		foldIdentifier(attributeDecl, quoted)
 		attributeDecl.Add(decl)
 
 		if quoted {
@@ -472,6 +698,14 @@ func (p *parser) parseAttribute() (*Decl, error) {
 	return decl, nil
 }
 
+// foldIdentifier folds an unquoted identifier to lower case, like PostgreSQL.
+// Quoted identifiers keep their case, so "User" and user are distinct.
+func foldIdentifier(decl *Decl, quoted bool) {
+	if !quoted {
+		decl.Lexeme = strings.ToLower(decl.Lexeme)
+	}
+}
+
 // parseQuotedToken parse a token of the form
 // table
 // "table"
@@ -492,6 +726,7 @@ func (p *parser) parseQuotedToken() (*Decl, error) {
 		return nil, p.syntaxError()
 	}
 	decl := NewDecl(p.cur())
+	foldIdentifier(decl, quoted)
 
 	if quoted {
 
@@ -532,6 +767,12 @@ func (p *parser) parseAttribution() (*Decl, error) {
 			return nil, err
 		}
 		attributeDecl.Add(nullDecl)
+	} else if p.isArray() {
+		arrayDecl, err := p.parseArray()
+		if err != nil {
+			return nil, err
+		}
+		attributeDecl.Add(arrayDecl)
 	} else {
 		valueDecl, err := p.parseValue()
 		if err != nil {
@@ -549,6 +790,16 @@ func (p *parser) parseIn() (*Decl, error) {
 		return nil, err
 	}
 
+	// IN (subquery)
+	if p.isSubquery() {
+		subqueryDecl, err := p.parseSubquery()
+		if err != nil {
+			return nil, err
+		}
+		inDecl.Add(subqueryDecl)
+		return inDecl, nil
+	}
+
 	// bracket opening
 	_, err = p.consumeToken(BracketOpeningToken)
 	if err != nil {
@@ -596,7 +847,7 @@ func (p *parser) parseValue() (*Decl, error) {
 		}
 	}
 
-	valueDecl, err := p.consumeToken(FloatToken, StringToken, NumberToken, DateToken, NowToken, CurrentSchemaToken, ArgToken, NamedArgToken)
+	valueDecl, err := p.consumeToken(FloatToken, StringToken, NumberToken, DateToken, NowToken, LocalTimestampToken, CurrentDateToken, CurrentSchemaToken, ArgToken, NamedArgToken)
 	if err != nil {
 		return nil, err
 	}
@@ -631,32 +882,107 @@ func (p *parser) parseStringLiteral() (*Decl, error) {
 	return valueDecl, nil
 }
 
+// parseAlias parses the optional alias of a relation or of a selected column,
+// of the form
+// [AS] alias
+// and adds it to decl as an AsToken decl holding the alias.
+func (p *parser) parseAlias(decl *Decl) error {
+	if !p.is(AsToken) && (!p.is(StringToken) || p.isClause()) {
+		return nil
+	}
+
+	asDecl := &Decl{Token: AsToken, Lexeme: "as"}
+	if p.is(AsToken) {
+		d, err := p.consumeToken(AsToken)
+		if err != nil {
+			return err
+		}
+		asDecl = d
+	}
+
+	aliasDecl, err := p.parseQuotedToken()
+	if err != nil {
+		return err
+	}
+	asDecl.Add(aliasDecl)
+	decl.Add(asDecl)
+	return nil
+}
+
+// isClause returns true if current identifier starts a clause following a
+// relation or a function call rather than an alias, as words of these clauses
+// are not keywords:
+// NATURAL JOIN, USING (...), FILTER (...), OVER (...), WITHIN GROUP
+func (p *parser) isClause() bool {
+	switch {
+	case p.isWord("natural"):
+		return p.isNaturalJoin()
+	case p.isWord("using"), p.isWord("filter"), p.isWord("over"):
+		return p.isFunctionCall()
+	case p.isWord("within"):
+		return p.isWithinGroup()
+	}
+	return false
+}
+
+// isNaturalJoin returns true if current token starts a NATURAL JOIN
+func (p *parser) isNaturalJoin() bool {
+	if !p.isWord("natural") {
+		return false
+	}
+	_, err := p.isNext(JoinToken)
+	return err == nil
+}
+
 // parseJoin parses the JOIN keywords and all its condition
 // JOIN user_addresses ON address.id=user_addresses.address_id
+// JOIN user_addresses ON address.id=user_addresses.address_id AND address.since < user_addresses.until
+// JOIN user_addresses USING (address_id)
+// NATURAL JOIN user_addresses
+//
+// Join condition is the second child of returned decl, either an OnToken
+// holding comparisons of attributes separated by AndToken, a UsingToken
+// holding the joined attributes or a NaturalToken.
 func (p *parser) parseJoin() (*Decl, error) {
+	var naturalDecl *Decl
+	if p.isNaturalJoin() {
+		d, err := p.consumeWord("natural", NaturalToken)
+		if err != nil {
+			return nil, err
+		}
+		naturalDecl = d
+	}
+
 	joinDecl, err := p.consumeToken(JoinToken)
 	if err != nil {
 		return nil, err
 	}
 
 	// TABLE NAME
-	tableDecl, err := p.parseAttribute()
+	tableDecl, err := p.parseFromItem()
 	if err != nil {
 		return nil, err
 	}
 	joinDecl.Add(tableDecl)
 
 	// AS SOMETHING ?
-	if p.is(AsToken) {
-		_, err = p.consumeToken(AsToken)
-		if err != nil {
-			return nil, err
-		}
-		aliasDecl, err := p.consumeToken(StringToken)
+	if err := p.parseAlias(tableDecl); err != nil {
+		return nil, err
+	}
+
+	if naturalDecl != nil {
+		joinDecl.Add(naturalDecl)
+		return joinDecl, nil
+	}
+
+	// USING
+	if p.isWord("using") {
+		usingDecl, err := p.parseJoinUsing()
 		if err != nil {
 			return nil, err
 		}
-		tableDecl.Add(aliasDecl)
+		joinDecl.Add(usingDecl)
+		return joinDecl, nil
 	}
 
 	// ON
@@ -667,28 +993,72 @@ func (p *parser) parseJoin() (*Decl, error) {
 	// onDecl := NewDecl(t)
 	joinDecl.Add(onDecl)
 
-	// ATTRIBUTE
-	leftAttributeDecl, err := p.parseAttribute()
-	if err != nil {
-		return nil, err
+	for {
+		// ATTRIBUTE
+		leftAttributeDecl, err := p.parseAttribute()
+		if err != nil {
+			return nil, err
+		}
+		onDecl.Add(leftAttributeDecl)
+
+		// OPERATOR
+		opDecl, err := p.consumeToken(EqualityToken, DistinctnessToken, LeftDipleToken, RightDipleToken, LessOrEqualToken, GreaterOrEqualToken)
+		if err != nil {
+			return nil, err
+		}
+		onDecl.Add(opDecl)
+
+		//ATTRIBUTE
+		rightAttributeDecl, err := p.parseAttribute()
+		if err != nil {
+			return nil, err
+		}
+		onDecl.Add(rightAttributeDecl)
+
+		// AND another condition
+		if !p.is(AndToken) || !p.hasNext() {
+			break
+		}
+		andDecl, err := p.consumeToken(AndToken)
+		if err != nil {
+			return nil, err
+		}
+		onDecl.Add(andDecl)
 	}
-	onDecl.Add(leftAttributeDecl)
 
-	// EQUAL
-	equalAttr, err := p.consumeToken(EqualityToken)
+	return joinDecl, nil
+}
+
+// parseJoinUsing parses the attributes list of a join
+// USING (attr1, attr2)
+func (p *parser) parseJoinUsing() (*Decl, error) {
+	usingDecl, err := p.consumeWord("using", UsingToken)
 	if err != nil {
 		return nil, err
 	}
-	onDecl.Add(equalAttr)
-
-	//ATTRIBUTE
-	rightAttributeDecl, err := p.parseAttribute()
-	if err != nil {
+	if _, err = p.consumeToken(BracketOpeningToken); err != nil {
 		return nil, err
 	}
-	onDecl.Add(rightAttributeDecl)
 
-	return joinDecl, nil
+	for {
+		attrDecl, err := p.parseQuotedToken()
+		if err != nil {
+			return nil, err
+		}
+		usingDecl.Add(attrDecl)
+
+		if p.is(BracketClosingToken) {
+			break
+		}
+		if _, err = p.consumeToken(CommaToken); err != nil {
+			return nil, err
+		}
+	}
+
+	if _, err = p.consumeToken(BracketClosingToken); err != nil {
+		return nil, err
+	}
+	return usingDecl, nil
 }
 
 func (p *parser) next() error {
@@ -714,6 +1084,28 @@ func (p *parser) is(tokenTypes ...int) bool {
 	return false
 }
 
+// isWord returns true if current token is an identifier spelled as word.
+// Words of the grammar which are not keywords, like TYPE or START, are
+// matched where grammar expects them, so attributes can still be named after
+// them.
+func (p *parser) isWord(word string) bool {
+	return p.is(StringToken) && strings.EqualFold(p.cur().Lexeme, word)
+}
+
+// consumeWord consumes current identifier spelled as word, as a decl of
+// given token
+func (p *parser) consumeWord(word string, token int) (*Decl, error) {
+	if !p.isWord(word) {
+		return nil, p.syntaxError()
+	}
+
+	decl := NewDecl(p.tokens[p.index])
+	decl.Token = token
+	decl.Lexeme = word
+	p.next()
+	return decl, nil
+}
+
 func (p *parser) isNot(tokenTypes ...int) bool {
 	return !p.is(tokenTypes...)
 }
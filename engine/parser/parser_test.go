@@ -185,6 +185,415 @@ func TestParseDelete(t *testing.T) {
 	parse(query, 1, t)
 }
 
+func TestParseTruncate(t *testing.T) {
+	queries := []string{
+		`TRUNCATE account`,
+		`TRUNCATE TABLE account`,
+		`TRUNCATE TABLE foo.account RESTART IDENTITY`,
+		`TRUNCATE "account" CONTINUE IDENTITY;`,
+	}
+
+	for _, q := range queries {
+		parse(q, 1, t)
+	}
+}
+
+func TestParseAnalyze(t *testing.T) {
+	queries := []string{
+		`ANALYZE`,
+		`ANALYZE champion`,
+		`ANALYZE foo.champion;`,
+	}
+
+	for _, q := range queries {
+		parse(q, 1, t)
+	}
+}
+
+func TestParseSequence(t *testing.T) {
+	queries := []string{
+		`CREATE SEQUENCE account_seq`,
+		`CREATE SEQUENCE IF NOT EXISTS foo.account_seq START WITH 100 INCREMENT BY 2`,
+		`CREATE SEQUENCE account_seq INCREMENT 2 START 100;`,
+		`DROP SEQUENCE account_seq`,
+		`INSERT INTO account (id, email) VALUES (nextval('account_seq'), 'foo@bar.com')`,
+		`INSERT INTO account (id, email) VALUES (currval('account_seq'), 'foo@bar.com')`,
+	}
+
+	for _, q := range queries {
+		parse(q, 1, t)
+	}
+}
+
+func TestParseExplain(t *testing.T) {
+	queries := []string{
+		`EXPLAIN SELECT * FROM account`,
+		`EXPLAIN SELECT name FROM account WHERE id = 2 ORDER BY name DESC LIMIT 2`,
+		`explain SELECT a.name FROM account AS a JOIN address ON address.account_id = a.id`,
+		`EXPLAIN ANALYZE SELECT * FROM account WHERE id > 2`,
+	}
+
+	for _, q := range queries {
+		parse(q, 1, t)
+	}
+}
+
+func TestParseShowDescribe(t *testing.T) {
+	queries := []string{
+		`SHOW TABLES`,
+		`show tables FROM app`,
+		`DESCRIBE champion`,
+		`DESCRIBE app.team`,
+	}
+
+	for _, q := range queries {
+		parse(q, 1, t)
+	}
+
+	if _, err := ParseInstruction(`SHOW 'tables'`); err == nil {
+		t.Fatalf("expected error parsing SHOW of a string")
+	}
+}
+
+func TestParseSet(t *testing.T) {
+	queries := []string{
+		`SET timezone = 'UTC'`,
+		`SET search_path TO myschema, public`,
+		`SET SESSION search_path = "my schema"`,
+		`SET statement_timeout = 0`,
+		`SET standard_conforming_strings = on`,
+		`SET search_path TO DEFAULT`,
+		`SET TIME ZONE 'Europe/Paris'`,
+		`SHOW timezone`,
+		`SHOW TIME ZONE`,
+		`show search_path`,
+	}
+
+	for _, q := range queries {
+		parse(q, 1, t)
+	}
+
+	i := parse(`SET search_path TO myschema, 'public'`, 1, t)
+	nameDecl := i[0].Decls[0].Decl[0]
+	if nameDecl.Lexeme != "search_path" || len(nameDecl.Decl) != 2 || nameDecl.Decl[1].Lexeme != "public" {
+		t.Fatalf("unexpected SET decl: %v", i[0].Decls[0])
+	}
+
+	for _, q := range []string{`SET timezone`, `SET timezone =`, `SET timezone = 'UTC' 'GMT'`} {
+		if _, err := ParseInstruction(q); err == nil {
+			t.Fatalf("expected error parsing %s", q)
+		}
+	}
+}
+
+func TestParseAlterTable(t *testing.T) {
+	queries := []string{
+		`ALTER TABLE account ADD COLUMN active BOOLEAN DEFAULT FALSE`,
+		`ALTER TABLE app.account ADD email VARCHAR(255) NOT NULL UNIQUE`,
+		`ALTER TABLE account ADD COLUMN age INT;`,
+		`ALTER TABLE account DROP COLUMN email`,
+		`ALTER TABLE app.account DROP "age"`,
+		`ALTER TABLE account RENAME TO users`,
+		`ALTER TABLE users RENAME COLUMN email TO mail`,
+		`alter table users rename "mail" to email`,
+	}
+
+	for _, q := range queries {
+		parse(q, 1, t)
+	}
+
+	if _, err := ParseInstruction(`ALTER TABLE account ADD COLUMN age INT; SELECT * FROM account`); err != nil {
+		t.Fatalf("cannot parse ALTER TABLE followed by another statement: %s", err)
+	}
+}
+
+func TestParseCreateTableAs(t *testing.T) {
+	queries := []string{
+		`CREATE TABLE top_users AS SELECT user_id FROM champion`,
+		`CREATE TABLE app.top_users (id, n) AS SELECT user_id, COUNT(*) FROM champion WHERE power > 2`,
+		`CREATE TABLE IF NOT EXISTS copy AS SELECT * FROM champion AS c`,
+		`CREATE TABLE account (id INT, email TEXT)`,
+	}
+
+	for _, q := range queries {
+		parse(q, 1, t)
+	}
+}
+
+func TestParseScalarSubquery(t *testing.T) {
+	queries := []string{
+		`SELECT * FROM champion WHERE user_id = (SELECT id FROM account WHERE email = 'foo@bar.com')`,
+		`SELECT * FROM champion WHERE user_id = (SELECT id FROM account WHERE email = 'foo@bar.com') AND name = 'foo'`,
+		`SELECT * FROM champion WHERE power > (SELECT power FROM champion WHERE id = $1) ORDER BY power`,
+		`SELECT name, (SELECT COUNT(*) FROM account) FROM champion`,
+		`DELETE FROM champion WHERE user_id = (SELECT id FROM account)`,
+	}
+
+	for _, q := range queries {
+		parse(q, 1, t)
+	}
+}
+
+func TestParseInExistsSubquery(t *testing.T) {
+	queries := []string{
+		`SELECT * FROM champion WHERE user_id IN (SELECT id FROM account WHERE email = 'foo@bar.com')`,
+		`SELECT * FROM champion WHERE user_id NOT IN (SELECT id FROM account) AND name = 'foo'`,
+		`SELECT * FROM account WHERE EXISTS (SELECT 1 FROM champion WHERE champion.user_id = account.id)`,
+		`SELECT * FROM account AS a WHERE NOT EXISTS (SELECT * FROM champion WHERE a.id = champion.user_id) ORDER BY email`,
+		`DELETE FROM account WHERE NOT EXISTS (SELECT 1 FROM champion WHERE champion.user_id = account.id)`,
+	}
+
+	for _, q := range queries {
+		parse(q, 1, t)
+	}
+}
+
+func TestParseUnion(t *testing.T) {
+	queries := []string{
+		`SELECT id FROM account UNION SELECT user_id FROM champion`,
+		`SELECT id FROM account WHERE id = 1 UNION ALL SELECT user_id FROM champion ORDER BY id LIMIT 2`,
+		`SELECT id FROM account UNION SELECT user_id FROM champion UNION ALL SELECT id FROM champion OFFSET 1`,
+		`SELECT * FROM champion WHERE user_id IN (SELECT id FROM account UNION SELECT 3 FROM account)`,
+		`INSERT INTO ids (id) SELECT id FROM account UNION SELECT user_id FROM champion`,
+		`SELECT id FROM account INTERSECT SELECT user_id FROM champion`,
+		`SELECT id FROM account EXCEPT ALL SELECT user_id FROM champion ORDER BY id`,
+		`SELECT id FROM account UNION SELECT id FROM users INTERSECT ALL SELECT user_id FROM champion LIMIT 1`,
+	}
+
+	for _, q := range queries {
+		parse(q, 1, t)
+	}
+
+	if _, err := ParseInstruction(`SELECT id FROM account LIMIT 1 UNION SELECT user_id FROM champion`); err == nil {
+		t.Fatalf("expected error with LIMIT before UNION")
+	}
+}
+
+func TestParseWith(t *testing.T) {
+	queries := []string{
+		`WITH active AS (SELECT * FROM account WHERE id > 0) SELECT * FROM active`,
+		`WITH a AS (SELECT id FROM account), b (uid) AS (SELECT user_id FROM champion UNION SELECT id FROM a) SELECT * FROM b ORDER BY uid`,
+		`WITH gone AS (SELECT id FROM account) DELETE FROM account WHERE id IN (SELECT id FROM gone)`,
+		`WITH gone AS (SELECT id FROM account) UPDATE account SET email = 'foo' WHERE id IN (SELECT id FROM gone)`,
+		`WITH src AS (SELECT id FROM account) INSERT INTO ids (id) SELECT id FROM src`,
+	}
+
+	for _, q := range queries {
+		parse(q, 1, t)
+	}
+}
+
+func TestParseWithRecursive(t *testing.T) {
+	queries := []string{
+		`WITH RECURSIVE chain (id, depth) AS (SELECT id, 0 FROM employee WHERE manager_id IS NULL UNION ALL SELECT employee.id, chain.depth FROM employee JOIN chain ON employee.manager_id = chain.id) SELECT * FROM chain`,
+		`WITH RECURSIVE reach AS (SELECT dst FROM edge WHERE src = 1 UNION SELECT edge.dst FROM edge JOIN reach ON edge.src = reach.dst), other AS (SELECT id FROM account) SELECT * FROM reach`,
+	}
+
+	for _, q := range queries {
+		parse(q, 1, t)
+	}
+}
+
+func TestParseAliases(t *testing.T) {
+	queries := []string{
+		`SELECT a.id AS account_id FROM account AS a`,
+		`SELECT a.id account_id, COUNT(*) AS total FROM account a`,
+		`SELECT a.id, c.name AS "Champion" FROM account a JOIN champion c ON c.user_id = a.id WHERE a.id = 1`,
+		`SELECT (SELECT COUNT(*) FROM champion) AS total, 1 AS one FROM public.account acc`,
+	}
+
+	for _, q := range queries {
+		parse(q, 1, t)
+	}
+}
+
+func TestParseOrderByPosition(t *testing.T) {
+	queries := []string{
+		`SELECT id, email FROM account ORDER BY 2`,
+		`SELECT id, email AS mail FROM account ORDER BY 2 DESC, mail ASC, 1`,
+		`SELECT id FROM account UNION SELECT id FROM champion ORDER BY 1 DESC LIMIT 2`,
+	}
+
+	for _, q := range queries {
+		parse(q, 1, t)
+	}
+}
+
+func TestParseAggregates(t *testing.T) {
+	queries := []string{
+		`SELECT COUNT(*), MAX(user_id) FROM champion`,
+		`SELECT MIN(c.user_id) AS lowest, SUM(c.score), AVG(score) FROM champion c`,
+	}
+
+	for _, q := range queries {
+		parse(q, 1, t)
+	}
+
+	if _, err := ParseInstruction(`SELECT MAX(*) FROM champion`); err == nil {
+		t.Fatalf("expected error with MAX(*)")
+	}
+}
+
+func TestParseWindowFunction(t *testing.T) {
+	queries := []string{
+		`SELECT name, ROW_NUMBER() OVER (PARTITION BY user_id ORDER BY name) FROM champion`,
+		`SELECT ROW_NUMBER() OVER (PARTITION BY c.user_id, c.name ORDER BY c.id DESC, name) AS rn FROM champion c`,
+		`SELECT *, ROW_NUMBER() OVER () FROM champion`,
+		`SELECT RANK() OVER (ORDER BY score DESC), DENSE_RANK() OVER (PARTITION BY user_id ORDER BY score) FROM champion`,
+		`SELECT id, SUM(score) OVER (PARTITION BY user_id) AS total, COUNT(*) OVER () FROM champion`,
+		`SELECT LAG(score) OVER (ORDER BY id), LEAD(c.score, 2, 0) OVER (PARTITION BY c.user_id ORDER BY c.id) FROM champion c`,
+		`SELECT LAG(name, $1, 'none') OVER (ORDER BY id), LEAD(name, 1, NULL) OVER (ORDER BY id) FROM champion`,
+		`SELECT lead, RANK() OVER (PARTITION BY partition ORDER BY rank) AS over FROM champion`,
+	}
+
+	for _, q := range queries {
+		parse(q, 1, t)
+	}
+
+	if _, err := ParseInstruction(`SELECT ROW_NUMBER() FROM champion`); err == nil {
+		t.Fatalf("expected error without OVER clause")
+	}
+}
+
+func TestParseCast(t *testing.T) {
+	queries := []string{
+		`SELECT CAST(user_id AS TEXT), CAST('123' AS INT), '5'::int FROM event`,
+		`SELECT CAST(e.ts AS DATE) AS day, e.user_id::text::bigint FROM event e`,
+		`SELECT id FROM event WHERE CAST(user_id AS TEXT) = '1'`,
+		`SELECT id FROM event WHERE user_id::text = CAST($1 AS TEXT) AND id > '2'::int`,
+	}
+
+	for _, q := range queries {
+		parse(q, 1, t)
+	}
+
+	if _, err := ParseInstruction(`SELECT CAST(user_id TEXT) FROM event`); err == nil {
+		t.Fatalf("expected error without AS in CAST")
+	}
+}
+
+func TestParseFunctionCall(t *testing.T) {
+	queries := []string{
+		`SELECT ABS(value), ROUND(ratio, 2), MOD(m.value, 4) AS rem, SQRT(ABS(value)) FROM measure m`,
+		`SELECT POWER(value, $1), CEIL(ratio)::int FROM measure`,
+		`SELECT id FROM measure WHERE ABS(value) > 8 AND value = MOD($1, 10)`,
+		`SELECT GREATEST(a, b, 0), LEAST(a, NULL, 'x', $1) FROM measure WHERE GREATEST(a, b) > 10`,
+	}
+
+	for _, q := range queries {
+		parse(q, 1, t)
+	}
+
+	if _, err := ParseInstruction(`SELECT ABS(value FROM measure`); err == nil {
+		t.Fatalf("expected error without closing bracket")
+	}
+}
+
+func TestParseDateFunctions(t *testing.T) {
+	queries := []string{
+		`SELECT NOW(), CURRENT_DATE, CURRENT_TIMESTAMP AS ts FROM event`,
+		`SELECT EXTRACT(YEAR FROM ts), EXTRACT(epoch FROM e.ts) AS epoch, DATE_TRUNC('month', ts) FROM event e`,
+		`SELECT id FROM event WHERE EXTRACT(DOW FROM ts) = 1 AND ts > CURRENT_DATE`,
+	}
+
+	for _, q := range queries {
+		parse(q, 1, t)
+	}
+
+	if _, err := ParseInstruction(`SELECT EXTRACT(YEAR ts) FROM event`); err == nil {
+		t.Fatalf("expected error without FROM in EXTRACT")
+	}
+}
+
+func TestParseArithmetic(t *testing.T) {
+	queries := []string{
+		`SELECT created + INTERVAL '1 day', done - created AS elapsed, cost + 2 - 1, cost -1 FROM task`,
+		`SELECT id FROM task WHERE created > now() - INTERVAL '7 days'`,
+		`SELECT id FROM task WHERE done - created > INTERVAL '48 hours' AND created + '1 year'::interval > $1`,
+		`SELECT CAST(cost + 1 AS TEXT), ABS(cost - 10) FROM task`,
+	}
+
+	for _, q := range queries {
+		parse(q, 1, t)
+	}
+
+	if _, err := ParseInstruction(`SELECT created + FROM task`); err == nil {
+		t.Fatalf("expected error without right operand")
+	}
+}
+
+func TestParseReferences(t *testing.T) {
+	queries := []string{
+		`CREATE TABLE champion (id BIGSERIAL PRIMARY KEY, account_id BIGINT REFERENCES account)`,
+		`CREATE TABLE champion (id BIGSERIAL PRIMARY KEY, account_id BIGINT NOT NULL REFERENCES account(id))`,
+		`CREATE TABLE champion (account_id BIGINT REFERENCES app.account (id) UNIQUE)`,
+		`ALTER TABLE champion ADD COLUMN team_id BIGINT REFERENCES team(id)`,
+		`DROP TABLE account CASCADE`,
+		`DROP TABLE IF EXISTS public.account RESTRICT`,
+	}
+
+	for _, q := range queries {
+		parse(q, 1, t)
+	}
+
+	if _, err := ParseInstruction(`CREATE TABLE champion (account_id BIGINT REFERENCES)`); err == nil {
+		t.Fatalf("expected error parsing REFERENCES without relation")
+	}
+}
+
+func TestParseIdentifierCase(t *testing.T) {
+	lexemes := func(d *Decl) []string {
+		var res []string
+		var walk func(d *Decl)
+		walk = func(d *Decl) {
+			res = append(res, d.Lexeme)
+			for _, c := range d.Decl {
+				walk(c)
+			}
+		}
+		walk(d)
+		return res
+	}
+
+	has := func(q string, want string) bool {
+		i := parse(q, 1, t)
+		for _, l := range lexemes(i[0].Decls[0]) {
+			if l == want {
+				return true
+			}
+		}
+		return false
+	}
+
+	if !has(`SELECT * FROM "User"`, "User") {
+		t.Fatalf("expected quoted relation name to keep its case")
+	}
+	if has(`SELECT * FROM User`, "User") || !has(`SELECT * FROM User`, "user") {
+		t.Fatalf("expected unquoted relation name to be folded to lower case")
+	}
+	if !has(`SELECT U.id FROM App.User AS U`, "app") || !has(`SELECT U.id FROM App.User AS U`, "u") {
+		t.Fatalf("expected unquoted schema and alias to be folded to lower case")
+	}
+	if !has(`CREATE TABLE "App"."User" (id INT)`, "App") {
+		t.Fatalf("expected quoted schema name to keep its case")
+	}
+	if !has(`INSERT INTO user (name) VALUES (Foo)`, "Foo") {
+		t.Fatalf("expected unquoted value not to be folded")
+	}
+	if !has(`SELECT "Email", u."Name" FROM user u`, "Email") || !has(`SELECT "Email", u."Name" FROM user u`, "Name") {
+		t.Fatalf("expected quoted attribute names to keep their case")
+	}
+	if has(`SELECT Email FROM user WHERE U.Name = 'Foo' ORDER BY Age`, "Email") || !has(`SELECT Email FROM user WHERE U.Name = 'Foo' ORDER BY Age`, "name") || !has(`SELECT Email FROM user WHERE U.Name = 'Foo' ORDER BY Age`, "age") {
+		t.Fatalf("expected unquoted attribute names to be folded to lower case")
+	}
+	if !has(`CREATE TABLE user ("Email" TEXT, Name TEXT)`, "Email") || !has(`CREATE TABLE user ("Email" TEXT, Name TEXT)`, "name") {
+		t.Fatalf("expected column definitions to fold unquoted names only")
+	}
+	if !has(`INSERT INTO user ("Email", Name) VALUES ('a', 'b')`, "Email") || !has(`INSERT INTO user ("Email", Name) VALUES ('a', 'b')`, "name") {
+		t.Fatalf("expected inserted columns to fold unquoted names only")
+	}
+}
+
 func TestParseUpdate(t *testing.T) {
 	query := `UPDATE account SET email = 'roger@gmail.com' WHERE id = 2`
 	parse(query, 1, t)
@@ -217,6 +626,351 @@ func TestUpdateWithQuotedColumns(t *testing.T) {
 	parse(query, 1, t)
 }
 
+func TestCompareNull(t *testing.T) {
+	query := `SELECT * FROM user WHERE user.age = NULL OR user.name <> NULL`
+
+	parse(query, 1, t)
+}
+
+func TestAggregateFilter(t *testing.T) {
+	queries := []string{
+		`SELECT COUNT(*) FILTER (WHERE user_id = 1), COUNT(*) FROM champion`,
+		`SELECT SUM(level) FILTER (WHERE user_id = 1 AND (level > 2) OR name = 'zed') AS total FROM champion`,
+	}
+
+	for _, q := range queries {
+		i := parse(q, 1, t)
+		filter, ok := i[0].Decls[0].Decl[0].Has(FilterToken)
+		if !ok || len(filter.Decl) != 1 || filter.Decl[0].Token != WhereToken {
+			t.Fatalf("expected FILTER clause in %s", q)
+		}
+	}
+}
+
+func TestSelectWithoutFrom(t *testing.T) {
+	queries := []string{
+		`SELECT 1`,
+		`SELECT 1 + 1 AS two, 'hello', now()`,
+		`SELECT 1 UNION SELECT 2 ORDER BY 1`,
+		`SELECT 1 LIMIT 1`,
+	}
+
+	for _, q := range queries {
+		parse(q, 1, t)
+	}
+
+	i := parse(`SELECT 1`, 1, t)
+	if _, ok := i[0].Decls[0].Has(FromToken); ok {
+		t.Fatalf("expected no FROM clause")
+	}
+
+	if _, err := ParseInstruction(`SELECT 1 WHERE 1 = 1`); err == nil {
+		t.Fatalf("expected error with WHERE clause without FROM clause")
+	}
+}
+
+func TestFromFunction(t *testing.T) {
+	queries := []string{
+		`SELECT * FROM generate_series(1, 10)`,
+		`SELECT d FROM generate_series('2024-01-01'::date, '2024-01-31'::date, '1 day') AS d WHERE d > $1`,
+		`SELECT * FROM account a JOIN generate_series(1, 3) n ON n.n = a.id`,
+	}
+
+	for _, q := range queries {
+		i := parse(q, 1, t)
+		from, ok := i[0].Decls[0].Has(FromToken)
+		if !ok || len(from.Decl) != 1 {
+			t.Fatalf("expected one relation in FROM clause of %s", q)
+		}
+	}
+
+	i := parse(`SELECT * FROM generate_series(1, 10, 2) s`, 1, t)
+	from, _ := i[0].Decls[0].Has(FromToken)
+	call := from.Decl[0]
+	if call.Token != FunctionToken || call.Lexeme != "generate_series" || len(call.Decl) != 4 {
+		t.Fatalf("expected generate_series call with 3 arguments and an alias")
+	}
+	if _, ok := call.Has(AsToken); !ok {
+		t.Fatalf("expected alias of generate_series call")
+	}
+}
+
+func TestFromSubquery(t *testing.T) {
+	queries := []string{
+		`SELECT x.n FROM (SELECT id AS n FROM account) AS x`,
+		`SELECT * FROM (SELECT id FROM account WHERE id > $1) x WHERE x.id < 10`,
+		`SELECT * FROM (SELECT 1 AS n UNION SELECT 2) u ORDER BY n`,
+		`SELECT * FROM account a JOIN (SELECT id FROM account) b ON b.id = a.id`,
+	}
+
+	for _, q := range queries {
+		parse(q, 1, t)
+	}
+
+	i := parse(`SELECT * FROM (SELECT id AS n FROM account) x`, 1, t)
+	from, _ := i[0].Decls[0].Has(FromToken)
+	if len(from.Decl) != 1 || from.Decl[0].Token != SelectToken {
+		t.Fatalf("expected a subquery in FROM clause")
+	}
+	sub := from.Decl[0]
+	alias := sub.Decl[len(sub.Decl)-1]
+	if alias.Token != AsToken || len(alias.Decl) != 1 || alias.Decl[0].Lexeme != "x" {
+		t.Fatalf("expected alias of subquery as its last child")
+	}
+
+	if _, err := ParseInstruction(`SELECT * FROM (SELECT id FROM account)`); err == nil {
+		t.Fatalf("expected error with subquery in FROM without alias")
+	}
+}
+
+func TestWithinGroup(t *testing.T) {
+	queries := []string{
+		`SELECT percentile_cont(0.5) WITHIN GROUP (ORDER BY level) FROM champion`,
+		`SELECT percentile_cont($1) WITHIN GROUP (ORDER BY champion.level DESC) AS p90, COUNT(*) FROM champion`,
+		`SELECT mode() WITHIN GROUP (ORDER BY name) FILTER (WHERE user_id = 1) FROM champion`,
+	}
+
+	for _, q := range queries {
+		i := parse(q, 1, t)
+		within, ok := i[0].Decls[0].Decl[0].Has(WithinToken)
+		if !ok || len(within.Decl) != 1 || within.Decl[0].Token != OrderToken {
+			t.Fatalf("expected WITHIN GROUP clause in %s", q)
+		}
+	}
+
+	for _, q := range []string{
+		`SELECT mode() WITHIN (ORDER BY name) FROM champion`,
+		`SELECT mode() WITHIN GROUP (name) FROM champion`,
+		`SELECT mode() WITHIN GROUP (ORDER BY name) OVER () FROM champion`,
+	} {
+		if _, err := ParseInstruction(q); err == nil {
+			t.Fatalf("expected error with %s", q)
+		}
+	}
+}
+
+func TestCollate(t *testing.T) {
+	queries := []string{
+		`CREATE TABLE account (id INT, email TEXT COLLATE nocase NOT NULL, name TEXT COLLATE "en_US")`,
+		`SELECT * FROM account WHERE email COLLATE "C" = 'a@b.c'`,
+		`SELECT * FROM account WHERE email = $1 COLLATE nocase AND id > 1`,
+		`SELECT * FROM account ORDER BY name COLLATE "fr_FR" DESC, account.email COLLATE nocase`,
+	}
+
+	for _, q := range queries {
+		parse(q, 1, t)
+	}
+
+	i := parse(`SELECT * FROM account WHERE email COLLATE nocase = 'a@b.c'`, 1, t)
+	where, _ := i[0].Decls[0].Has(WhereToken)
+	cond := where.Decl[0]
+	if cond.Token != CollateToken || len(cond.Decl) != 4 || cond.Decl[0].Lexeme != "email" || cond.Decl[1].Lexeme != "nocase" {
+		t.Fatalf("expected collated attribute compared in WHERE clause")
+	}
+
+	i = parse(`SELECT * FROM account ORDER BY name COLLATE "en_US" DESC`, 1, t)
+	order, _ := i[0].Decls[0].Has(OrderToken)
+	collate, ok := order.Decl[0].Has(CollateToken)
+	if !ok || len(collate.Decl) != 1 || collate.Decl[0].Lexeme != "en_US" {
+		t.Fatalf("expected collation of ORDER BY attribute")
+	}
+
+	if _, err := ParseInstruction(`SELECT * FROM account ORDER BY name COLLATE`); err == nil {
+		t.Fatalf("expected error with COLLATE without collation name")
+	}
+}
+
+func TestRegexMatch(t *testing.T) {
+	queries := []string{
+		`SELECT * FROM account WHERE email ~ '^foo'`,
+		`SELECT * FROM account WHERE email ~* '^foo' AND id > 1`,
+		`SELECT * FROM account WHERE account.email !~ $1`,
+		`SELECT * FROM account WHERE CAST(id AS TEXT) !~* '^1'`,
+		`DELETE FROM account WHERE email~'bar'`,
+	}
+
+	for _, q := range queries {
+		parse(q, 1, t)
+	}
+
+	for _, op := range []string{"~", "~*", "!~", "!~*"} {
+		i := parse(`SELECT * FROM account WHERE email `+op+` 'x'`, 1, t)
+		where, _ := i[0].Decls[0].Has(WhereToken)
+		cond := where.Decl[0]
+		if len(cond.Decl) != 2 || cond.Decl[0].Token != RegexMatchToken || cond.Decl[0].Lexeme != op {
+			t.Fatalf("expected %s operator in WHERE clause", op)
+		}
+	}
+}
+
+func TestArray(t *testing.T) {
+	queries := []string{
+		`CREATE TABLE post (id INT, tags TEXT[], scores INT[])`,
+		`INSERT INTO post (id, tags) VALUES (1, ARRAY['a', 'b'])`,
+		`INSERT INTO post (id, tags) VALUES (1, '{a,b}')`,
+		`UPDATE post SET tags = ARRAY['c'] WHERE id = 1`,
+		`SELECT tags[1], ARRAY[1, 2] FROM post`,
+		`SELECT * FROM post WHERE tags @> ARRAY['a'] AND tags <@ '{a,b,c}'`,
+		`SELECT * FROM post WHERE tags && $1`,
+		`SELECT * FROM post WHERE 'a' = ANY(tags)`,
+		`SELECT * FROM post WHERE tags[id + 1] = 'b'`,
+		`SELECT CAST('{1,2}' AS INT[])`,
+	}
+
+	for _, q := range queries {
+		parse(q, 1, t)
+	}
+
+	i := parse(`SELECT * FROM post WHERE 'a' = ANY(tags)`, 1, t)
+	where, _ := i[0].Decls[0].Has(WhereToken)
+	if _, ok := where.Decl[0].Has(AnyToken); !ok {
+		t.Fatalf("expected ANY in WHERE clause")
+	}
+
+	// literal op attribute is flipped into attribute op literal
+	i = parse(`SELECT * FROM post WHERE 3 <= id`, 1, t)
+	where, _ = i[0].Decls[0].Has(WhereToken)
+	if cond := where.Decl[0]; cond.Token != StringToken || cond.Lexeme != "id" || cond.Decl[0].Token != GreaterOrEqualToken || cond.Decl[1].Lexeme != "3" {
+		t.Fatalf("expected id >= 3, got %v", cond)
+	}
+
+	for _, q := range []string{
+		`CREATE TABLE post (cells INT[][])`,
+		`SELECT ARRAY['a' FROM post`,
+		`SELECT tags[1 FROM post`,
+		`SELECT * FROM post WHERE 'a' = 'b'`,
+		`SELECT * FROM post WHERE 2 IN (1, 2)`,
+	} {
+		if _, err := ParseInstruction(q); err == nil {
+			t.Fatalf("expected error parsing %s", q)
+		}
+	}
+}
+
+func TestEnumType(t *testing.T) {
+	queries := []string{
+		`CREATE TYPE mood AS ENUM ('sad', 'ok', 'happy')`,
+		`CREATE TYPE app.empty AS ENUM ()`,
+		`DROP TYPE mood`,
+		`DROP TYPE IF EXISTS app.mood`,
+		`CREATE TABLE person (id INT, type TEXT, current_mood mood)`,
+		`SELECT type FROM person WHERE type = 'a'`,
+	}
+
+	for _, q := range queries {
+		parse(q, 1, t)
+	}
+
+	i := parse(`CREATE TYPE mood AS ENUM ('sad', 'ok', 'happy')`, 1, t)
+	typeDecl := i[0].Decls[0].Decl[0]
+	if typeDecl.Token != TypeToken || len(typeDecl.Decl) != 2 || typeDecl.Decl[1].Token != EnumToken || len(typeDecl.Decl[1].Decl) != 3 {
+		t.Fatalf("expected enum type with 3 labels, got %v", typeDecl)
+	}
+
+	for _, q := range []string{
+		`CREATE TYPE mood AS ('sad')`,
+		`CREATE TYPE mood AS ENUM ('sad',)`,
+		`CREATE TYPE mood AS ENUM (sad)`,
+		`CREATE TYPE mood ENUM ('sad')`,
+	} {
+		if _, err := ParseInstruction(q); err == nil {
+			t.Fatalf("expected error parsing %s", q)
+		}
+	}
+}
+
+func TestDomain(t *testing.T) {
+	queries := []string{
+		`CREATE DOMAIN positive_int AS INT CHECK (VALUE > 0) DEFAULT 1`,
+		`CREATE DOMAIN app.code TEXT NOT NULL CHECK (VALUE ~ '^[A-Z]+$' OR VALUE IS NULL)`,
+		`CREATE DOMAIN amount AS DECIMAL NULL`,
+		`DROP DOMAIN positive_int`,
+		`DROP DOMAIN IF EXISTS app.code`,
+		`CREATE TABLE item (id INT, domain TEXT, qty positive_int DEFAULT 2)`,
+		`SELECT domain FROM item WHERE domain = 'a'`,
+	}
+
+	for _, q := range queries {
+		parse(q, 1, t)
+	}
+
+	i, err := ParseInstruction(`CREATE DOMAIN positive_int AS INT CHECK (VALUE  >  0) DEFAULT 1`)
+	if err != nil {
+		t.Fatalf("cannot parse domain: %s", err)
+	}
+	domainDecl := i[0].Decls[0].Decl[0]
+	if domainDecl.Token != DomainToken || len(domainDecl.Decl) != 4 {
+		t.Fatalf("expected domain with type, check and default, got %v", domainDecl)
+	}
+	checkDecl, ok := domainDecl.Has(CheckToken)
+	if !ok || checkDecl.Lexeme != "VALUE  >  0" || len(checkDecl.Decl) != 1 {
+		t.Fatalf("expected check holding its source, got %v", checkDecl)
+	}
+
+	for _, q := range []string{
+		`CREATE DOMAIN positive_int`,
+		`CREATE DOMAIN positive_int AS INT CHECK ()`,
+		`CREATE DOMAIN positive_int AS INT CHECK (VALUE > 0`,
+		`CREATE DOMAIN positive_int AS INT UNIQUE`,
+		`DROP DOMAINS positive_int`,
+	} {
+		if _, err := ParseInstruction(q); err == nil {
+			t.Fatalf("expected error parsing %s", q)
+		}
+	}
+}
+
+func TestJoinConditions(t *testing.T) {
+	queries := []string{
+		`SELECT * FROM game JOIN season ON season.year = game.year AND season.league = game.league`,
+		`SELECT * FROM game g JOIN season s ON s.year = g.year AND g.day >= s.starts AND g.day <> s.ends WHERE g.id = 1`,
+	}
+
+	for _, q := range queries {
+		i := parse(q, 1, t)
+		join, ok := i[0].Decls[0].Has(JoinToken)
+		if !ok || len(join.Decl) != 2 || len(join.Decl[1].Decl)%4 != 3 {
+			t.Fatalf("expected ON conditions separated by AND in %s", q)
+		}
+	}
+}
+
+func TestJoinUsing(t *testing.T) {
+	queries := []string{
+		`SELECT * FROM account NATURAL JOIN champion`,
+		`SELECT * FROM account AS a NATURAL JOIN champion AS c WHERE a.id = 1`,
+		`SELECT * FROM account JOIN champion USING (user_id)`,
+		`SELECT * FROM account a JOIN champion c USING (user_id, "name") ORDER BY user_id`,
+		`SELECT * FROM account JOIN champion USING (user_id) NATURAL JOIN score JOIN game ON game.id = score.game_id`,
+	}
+
+	for _, q := range queries {
+		i := parse(q, 1, t)
+		join, ok := i[0].Decls[0].Has(JoinToken)
+		if !ok || len(join.Decl) != 2 {
+			t.Fatalf("expected join with 2 children in %s", q)
+		}
+		if join.Decl[1].Token != NaturalToken && join.Decl[1].Token != UsingToken {
+			t.Fatalf("expected NATURAL or USING join in %s, got %v", q, join.Decl[1])
+		}
+	}
+
+	for _, q := range []string{
+		`SELECT * FROM account JOIN champion USING ()`,
+		`SELECT * FROM account JOIN champion USING (user_id`,
+		`SELECT * FROM account NATURAL champion`,
+	} {
+		lexer := lexer{}
+		decls, err := lexer.lex([]byte(q))
+		if err != nil {
+			continue
+		}
+		if _, err := (&parser{}).parse(decls); err == nil {
+			t.Fatalf("expected error parsing %s", q)
+		}
+	}
+}
+
 func TestCreateDefault(t *testing.T) {
 	query := `CREATE TABLE foo (bar BIGINT, riri TEXT, fifi BOOLEAN NOT NULL DEFAULT false)`
 
@@ -296,6 +1050,33 @@ func TestIndex(t *testing.T) {
 		`CREATE UNIQUE INDEX IF NOT EXISTS index_name ON table_name (col1, col2)`,
 		`CREATE UNIQUE INDEX IF NOT EXISTS index_name ON table_name (col1, col2 COLLATE NOCASE)`,
 		`CREATE INDEX IF NOT EXISTS "idx_products_deleted_at" ON "products" ("deleted_at")`,
+		`CREATE INDEX index_name ON table_name USING btree (col1)`,
+		`CREATE UNIQUE INDEX index_name ON foo.table_name USING HASH (col1, col2)`,
+	}
+
+	for _, q := range queries {
+		parse(q, 1, t)
+	}
+}
+
+func TestInsertSelect(t *testing.T) {
+	queries := []string{
+		`INSERT INTO archive SELECT * FROM champion WHERE user_id = 1`,
+		`INSERT INTO archive (id, name) SELECT id, name FROM champion`,
+		`INSERT INTO archive VALUES (1, 'foo')`,
+	}
+
+	for _, q := range queries {
+		parse(q, 1, t)
+	}
+}
+
+func TestInsertOnConflict(t *testing.T) {
+	queries := []string{
+		`INSERT INTO account (id, email) VALUES (1, 'x') ON CONFLICT (id) DO UPDATE SET email = excluded.email`,
+		`INSERT INTO account (id, email) VALUES (1, 'x') ON CONFLICT (id) DO UPDATE SET email = 'y', age = NULL`,
+		`INSERT INTO account (id, email) VALUES (1, 'x'), (2, 'y') ON CONFLICT DO NOTHING`,
+		`INSERT INTO account (id, email) VALUES (1, 'x') ON CONFLICT (id, email) DO NOTHING RETURNING id`,
 	}
 
 	for _, q := range queries {
@@ -307,6 +1088,12 @@ func TestReturning(t *testing.T) {
 	queries := []string{
 		`INSERT INTO test (foo, bar) VALUES ('foo', 'bar') RETURNING id`,
 		`INSERT INTO test (foo, bar) VALUES ('foo', 'bar') RETURNING "id"`,
+		`INSERT INTO test (foo, bar) VALUES ('foo', 'bar') RETURNING id, foo`,
+		`INSERT INTO test (foo, bar) VALUES ('foo', 'bar') RETURNING *`,
+		`UPDATE test SET foo = 'bar' WHERE id = 1 RETURNING id, foo`,
+		`UPDATE test SET foo = 'bar' RETURNING *`,
+		`DELETE FROM test WHERE foo = 'bar' RETURNING id`,
+		`DELETE FROM test RETURNING id, foo`,
 	}
 
 	for _, q := range queries {
@@ -353,6 +1140,12 @@ func TestSchema(t *testing.T) {
 	queries = []string{
 		`DROP TABLE public.bar`,
 		`DROP SCHEMA foo.bar`,
+		`DROP TABLE IF EXISTS public.bar`,
+		`DROP SCHEMA IF EXISTS foo`,
+		`DROP SCHEMA analytics CASCADE`,
+		`DROP SCHEMA IF EXISTS analytics RESTRICT`,
+		`DROP INDEX IF EXISTS foo.bar_idx`,
+		`DROP SEQUENCE IF EXISTS bar_seq`,
 	}
 
 	for _, q := range queries {
@@ -361,6 +1154,13 @@ func TestSchema(t *testing.T) {
 		if d.Token != DropToken {
 			t.Errorf("expected DropToken (%d), got (%d)", DropToken, d.Token)
 		}
+		if tableD, ok := d.Has(TableToken); ok {
+			nameD := tableD.Decl[len(tableD.Decl)-1]
+			if _, ok := nameD.Has(SchemaToken); !ok {
+				t.Errorf("expected TableToken to have Schema (%d) child", SchemaToken)
+				tableD.Stringy(0, t.Logf)
+			}
+		}
 	}
 }
 
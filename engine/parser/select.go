@@ -2,9 +2,102 @@ package parser
 
 import (
 	"fmt"
+	"strings"
 )
 
 func (p *parser) parseSelect(tokens []Token) (*Instruction, error) {
+	i, err := p.parseIntersect(tokens)
+	if err != nil {
+		return nil, err
+	}
+
+	for p.is(UnionToken, ExceptToken) {
+		i, err = p.parseSetOperation(i, p.parseIntersect)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return i, nil
+}
+
+// parseIntersect parses SELECT statements combined with INTERSECT, which
+// binds tighter than UNION and EXCEPT.
+func (p *parser) parseIntersect(tokens []Token) (*Instruction, error) {
+	i, err := p.parseSimpleSelect(tokens)
+	if err != nil {
+		return nil, err
+	}
+
+	for p.is(IntersectToken) {
+		i, err = p.parseSetOperation(i, p.parseSimpleSelect)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return i, nil
+}
+
+// parseSetOperation parses a UNION, INTERSECT or EXCEPT [ALL] and its right
+// side, and combines it with the left side, so that set operations are left
+// associative.
+//
+// ORDER BY, LIMIT and OFFSET of the last SELECT apply to the combined result,
+// so they are moved to the set operation decl.
+func (p *parser) parseSetOperation(left *Instruction, parseRight func([]Token) (*Instruction, error)) (*Instruction, error) {
+	i := &Instruction{}
+
+	opDecl, err := p.consumeToken(UnionToken, IntersectToken, ExceptToken)
+	if err != nil {
+		return nil, err
+	}
+	i.Decls = append(i.Decls, opDecl)
+
+	for _, d := range left.Decls[0].Decl {
+		switch d.Token {
+		case OrderToken, LimitToken, OffsetToken:
+			return nil, fmt.Errorf("ORDER BY, LIMIT and OFFSET must follow the last SELECT of a %s", strings.ToUpper(opDecl.Lexeme))
+		}
+	}
+
+	if p.is(AllToken) {
+		allDecl, err := p.consumeToken(AllToken)
+		if err != nil {
+			return nil, err
+		}
+		opDecl.Add(allDecl)
+	}
+
+	if !p.is(SelectToken) {
+		return nil, p.syntaxError()
+	}
+	right, err := parseRight(p.tokens)
+	if err != nil {
+		return nil, err
+	}
+
+	opDecl.Add(left.Decls[0])
+	rightDecl := right.Decls[0]
+	var clauses []*Decl
+	for j := 0; j < len(rightDecl.Decl); j++ {
+		switch rightDecl.Decl[j].Token {
+		case OrderToken, LimitToken, OffsetToken:
+			clauses = append(clauses, rightDecl.Decl[j])
+			rightDecl.Decl = append(rightDecl.Decl[:j], rightDecl.Decl[j+1:]...)
+			j--
+		}
+	}
+	opDecl.Add(rightDecl)
+	for _, c := range clauses {
+		opDecl.Add(c)
+	}
+
+	return i, nil
+}
+
+// parseSimpleSelect parses a single SELECT statement
+func (p *parser) parseSimpleSelect(tokens []Token) (*Instruction, error) {
 	i := &Instruction{}
 	var err error
 
@@ -48,12 +141,85 @@ func (p *parser) parseSelect(tokens []Token) (*Instruction, error) {
 
 	for {
 		switch {
-		case p.is(CountToken):
+		case p.isAggregate():
 			attrDecl, err := p.parseBuiltinFunc()
 			if err != nil {
 				return nil, err
 			}
+			if p.isFilter() {
+				if err := p.parseFilter(attrDecl); err != nil {
+					return nil, err
+				}
+				if p.isOver() {
+					return nil, fmt.Errorf("FILTER is not supported with window functions")
+				}
+			}
+			if p.isOver() {
+				if err := p.parseOver(attrDecl); err != nil {
+					return nil, err
+				}
+			}
+			if err := p.parseAlias(attrDecl); err != nil {
+				return nil, err
+			}
 			selectDecl.Add(attrDecl)
+		case p.isWindowFunction():
+			windowDecl, err := p.parseWindowFunction()
+			if err != nil {
+				return nil, err
+			}
+			if err := p.parseAlias(windowDecl); err != nil {
+				return nil, err
+			}
+			selectDecl.Add(windowDecl)
+		case p.isExpression(), p.is(SimpleQuoteToken, NowToken, LocalTimestampToken, CurrentDateToken):
+			exprDecl, err := p.parseExpression()
+			if err != nil {
+				return nil, err
+			}
+			if exprDecl.Token == FunctionToken && p.isWithinGroup() {
+				if err := p.parseWithinGroup(exprDecl); err != nil {
+					return nil, err
+				}
+				if p.isFilter() {
+					if err := p.parseFilter(exprDecl); err != nil {
+						return nil, err
+					}
+				}
+				if p.isOver() {
+					return nil, fmt.Errorf("OVER is not supported for ordered-set aggregate %s", exprDecl.Lexeme)
+				}
+			}
+			if err := p.parseAlias(exprDecl); err != nil {
+				return nil, err
+			}
+			selectDecl.Add(exprDecl)
+		case p.is(NumberToken):
+			numberDecl, err := p.consumeToken(NumberToken)
+			if err != nil {
+				return nil, err
+			}
+			numberDecl, err = p.parseCastShorthand(numberDecl)
+			if err != nil {
+				return nil, err
+			}
+			numberDecl, err = p.parseArithmetic(numberDecl)
+			if err != nil {
+				return nil, err
+			}
+			if err := p.parseAlias(numberDecl); err != nil {
+				return nil, err
+			}
+			selectDecl.Add(numberDecl)
+		case p.isSubquery():
+			subqueryDecl, err := p.parseSubquery()
+			if err != nil {
+				return nil, err
+			}
+			if err := p.parseAlias(subqueryDecl); err != nil {
+				return nil, err
+			}
+			selectDecl.Add(subqueryDecl)
 		default:
 			attrDecl, err := p.parseAttribute()
 			if err != nil {
@@ -61,9 +227,26 @@ func (p *parser) parseSelect(tokens []Token) (*Instruction, error) {
 			}
 			if distinctOpen {
 				distinctDecl.Add(attrDecl)
-			} else {
-				selectDecl.Add(attrDecl)
+				break
+			}
+			if attrDecl.Token != StarToken {
+				attrDecl, err = p.parseSubscript(attrDecl)
+				if err != nil {
+					return nil, err
+				}
+				attrDecl, err = p.parseCastShorthand(attrDecl)
+				if err != nil {
+					return nil, err
+				}
+				attrDecl, err = p.parseArithmetic(attrDecl)
+				if err != nil {
+					return nil, err
+				}
+				if err := p.parseAlias(attrDecl); err != nil {
+					return nil, err
+				}
 			}
+			selectDecl.Add(attrDecl)
 		}
 
 		switch {
@@ -83,9 +266,9 @@ func (p *parser) parseSelect(tokens []Token) (*Instruction, error) {
 		break
 	}
 
-	// Must be from now
-	if tokens[p.index].Token != FromToken {
-		return nil, fmt.Errorf("Syntax error near %v\n", tokens[p.index])
+	// Without FROM clause, columns are computed once, as in SELECT 1
+	if !p.is(FromToken) {
+		return p.parseSelectClauses(i, selectDecl, false)
 	}
 	fromDecl := NewDecl(tokens[p.index])
 	selectDecl.Add(fromDecl)
@@ -96,10 +279,15 @@ func (p *parser) parseSelect(tokens []Token) (*Instruction, error) {
 		if err = p.next(); err != nil {
 			return nil, fmt.Errorf("Unexpected end. Syntax error near %v\n", tokens[p.index])
 		}
-		tableNameDecl, err := p.parseTableName()
+		tableNameDecl, err := p.parseFromItem()
 		if err != nil {
 			return nil, err
 		}
+		if _, ok := tableNameDecl.Has(AsToken); !ok {
+			if err := p.parseAlias(tableNameDecl); err != nil {
+				return nil, err
+			}
+		}
 		fromDecl.Add(tableNameDecl)
 
 		// If no next, then it's implicit where
@@ -114,7 +302,7 @@ func (p *parser) parseSelect(tokens []Token) (*Instruction, error) {
 	}
 
 	// JOIN OR ...?
-	for p.is(JoinToken) {
+	for p.is(JoinToken) || p.isNaturalJoin() {
 		joinDecl, err := p.parseJoin()
 		if err != nil {
 			return nil, err
@@ -122,10 +310,19 @@ func (p *parser) parseSelect(tokens []Token) (*Instruction, error) {
 		selectDecl.Add(joinDecl)
 	}
 
-	hazWhereClause := false
+	return p.parseSelectClauses(i, selectDecl, true)
+}
+
+// parseSelectClauses parses WHERE, ORDER BY, LIMIT, OFFSET and FOR UPDATE
+// clauses of a SELECT statement. Without FROM clause, WHERE is not allowed.
+func (p *parser) parseSelectClauses(i *Instruction, selectDecl *Decl, from bool) (*Instruction, error) {
+	hazWhereClause := !from
 	for {
 		switch p.cur().Token {
 		case WhereToken:
+			if !from {
+				return nil, p.syntaxError()
+			}
 			err := p.parseWhere(selectDecl)
 			if err != nil {
 				return nil, err
@@ -146,7 +343,7 @@ func (p *parser) parseSelect(tokens []Token) (*Instruction, error) {
 				return nil, err
 			}
 			selectDecl.Add(limitDecl)
-			numDecl, err := p.consumeToken(NumberToken)
+			numDecl, err := p.consumeToken(NumberToken, ArgToken, NamedArgToken)
 			if err != nil {
 				return nil, err
 			}
@@ -157,7 +354,7 @@ func (p *parser) parseSelect(tokens []Token) (*Instruction, error) {
 				return nil, err
 			}
 			selectDecl.Add(offsetDecl)
-			offsetValue, err := p.consumeToken(NumberToken)
+			offsetValue, err := p.consumeToken(NumberToken, ArgToken, NamedArgToken)
 			if err != nil {
 				return nil, err
 			}
@@ -207,3 +404,34 @@ func (p *parser) parseForUpdate(decl *Decl) error {
 	decl.Add(d)
 	return nil
 }
+
+// parseSubquery parses a bracketed SELECT statement, as used for scalar
+// subqueries. Returned decl is the SELECT decl of the subquery.
+func (p *parser) parseSubquery() (*Decl, error) {
+	if _, err := p.consumeToken(BracketOpeningToken); err != nil {
+		return nil, err
+	}
+
+	if !p.is(SelectToken) {
+		return nil, p.syntaxError()
+	}
+	selectInst, err := p.parseSelect(p.tokens)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := p.consumeToken(BracketClosingToken); err != nil {
+		return nil, err
+	}
+
+	return selectInst.Decls[0], nil
+}
+
+// isSubquery returns true if current token opens a bracketed SELECT statement
+func (p *parser) isSubquery() bool {
+	if !p.is(BracketOpeningToken) {
+		return false
+	}
+	_, err := p.isNext(SelectToken)
+	return err == nil
+}
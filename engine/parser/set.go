@@ -0,0 +1,101 @@
+package parser
+
+import (
+	"strings"
+)
+
+// parseSet parses a SET statement changing a session variable, of the form
+// SET [SESSION] name {= | TO} {value [, ...] | DEFAULT}
+// or SET TIME ZONE value, which sets timezone.
+//
+//	|-> "SET" (SetToken)
+//	    |-> variable name (StringToken)
+//	        |-> value (StringToken, NumberToken, DefaultToken...)
+//	        |-> (...)
+func (p *parser) parseSet() (*Instruction, error) {
+	i := &Instruction{}
+
+	setDecl, err := p.consumeToken(SetToken)
+	if err != nil {
+		return nil, err
+	}
+	i.Decls = append(i.Decls, setDecl)
+
+	if p.is(StringToken) && strings.EqualFold(p.cur().Lexeme, "session") {
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+	}
+
+	var nameDecl *Decl
+	if p.is(TimeToken) {
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+		if _, err := p.consumeToken(ZoneToken); err != nil {
+			return nil, err
+		}
+		nameDecl = NewDecl(Token{Token: StringToken, Lexeme: "timezone"})
+	} else {
+		nameDecl, err = p.parseQuotedToken()
+		if err != nil {
+			return nil, err
+		}
+		nameDecl.Lexeme = strings.ToLower(nameDecl.Lexeme)
+
+		if p.is(EqualityToken) || (p.is(StringToken) && strings.EqualFold(p.cur().Lexeme, "to")) {
+			if err := p.next(); err != nil {
+				return nil, err
+			}
+		} else {
+			return nil, p.syntaxError()
+		}
+	}
+	setDecl.Add(nameDecl)
+
+	for {
+		valueDecl, err := p.parseSetValue()
+		if err != nil {
+			return nil, err
+		}
+		nameDecl.Add(valueDecl)
+
+		if !p.is(CommaToken) {
+			break
+		}
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+	}
+
+	if !p.is(SemicolonToken) {
+		return nil, p.syntaxError()
+	}
+
+	return i, nil
+}
+
+// parseSetValue parses a value of SET statement, which is a quoted string,
+// an identifier, a number, or any keyword like ON or DEFAULT.
+func (p *parser) parseSetValue() (*Decl, error) {
+	switch {
+	case p.is(SimpleQuoteToken):
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+		valueDecl, err := p.consumeToken(StringToken)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := p.consumeToken(SimpleQuoteToken); err != nil {
+			return nil, err
+		}
+		return valueDecl, nil
+	case p.is(DoubleQuoteToken, BacktickToken):
+		return p.parseQuotedToken()
+	case p.is(CommaToken, SemicolonToken):
+		return nil, p.syntaxError()
+	}
+
+	return p.consumeToken(p.cur().Token)
+}
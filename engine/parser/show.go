@@ -0,0 +1,85 @@
+package parser
+
+import (
+	"strings"
+)
+
+// parseShow parses a SHOW statement of the form
+// SHOW TABLES [FROM schema]
+// or SHOW name, reading a session variable. SHOW TIME ZONE reads timezone.
+func (p *parser) parseShow() (*Instruction, error) {
+	i := &Instruction{}
+
+	// Set SHOW decl
+	showDecl, err := p.consumeWord("show", ShowToken)
+	if err != nil {
+		return nil, err
+	}
+	i.Decls = append(i.Decls, showDecl)
+
+	if p.is(TimeToken) {
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+		if _, err := p.consumeToken(ZoneToken); err != nil {
+			return nil, err
+		}
+		showDecl.Add(NewDecl(Token{Token: StringToken, Lexeme: "timezone"}))
+		return i, nil
+	}
+
+	// TABLES is not a keyword, so relations can still be named tables
+	if !p.is(StringToken) {
+		return nil, p.syntaxError()
+	}
+	if !strings.EqualFold(p.cur().Lexeme, "tables") {
+		nameDecl, err := p.consumeToken(StringToken)
+		if err != nil {
+			return nil, err
+		}
+		nameDecl.Lexeme = strings.ToLower(nameDecl.Lexeme)
+		showDecl.Add(nameDecl)
+		return i, nil
+	}
+	tablesDecl, err := p.consumeToken(StringToken)
+	if err != nil {
+		return nil, err
+	}
+	showDecl.Add(tablesDecl)
+
+	if p.is(FromToken) {
+		fromDecl, err := p.consumeToken(FromToken)
+		if err != nil {
+			return nil, err
+		}
+		schemaDecl, err := p.consumeToken(StringToken)
+		if err != nil {
+			return nil, err
+		}
+		fromDecl.Add(schemaDecl)
+		showDecl.Add(fromDecl)
+	}
+
+	return i, nil
+}
+
+// parseDescribe parses a DESCRIBE statement of the form
+// DESCRIBE [schema.]table
+func (p *parser) parseDescribe() (*Instruction, error) {
+	i := &Instruction{}
+
+	// Set DESCRIBE decl
+	describeDecl, err := p.consumeWord("describe", DescribeToken)
+	if err != nil {
+		return nil, err
+	}
+	i.Decls = append(i.Decls, describeDecl)
+
+	nameDecl, err := p.parseTableName()
+	if err != nil {
+		return nil, err
+	}
+	describeDecl.Add(nameDecl)
+
+	return i, nil
+}
@@ -1,5 +1,7 @@
 package parser
 
+// parseTruncate parses a TRUNCATE statement of the form
+// TRUNCATE [TABLE] name [RESTART IDENTITY | CONTINUE IDENTITY]
 func (p *parser) parseTruncate() (*Instruction, error) {
 	i := &Instruction{}
 
@@ -10,12 +12,38 @@ func (p *parser) parseTruncate() (*Instruction, error) {
 	}
 	i.Decls = append(i.Decls, trDecl)
 
+	// TABLE keyword is optional
+	if p.is(TableToken) {
+		if _, err := p.consumeToken(TableToken); err != nil {
+			return nil, err
+		}
+	}
+
 	// Should be a table name
-	nameDecl, err := p.parseQuotedToken()
+	nameDecl, err := p.parseTableName()
 	if err != nil {
 		return nil, err
 	}
 	trDecl.Add(nameDecl)
 
+	// RESTART IDENTITY or CONTINUE IDENTITY ?
+	// RESTART and IDENTITY are not keywords, so attributes can still be named after them
+	if p.isWord("restart") || p.is(ContinueToken) {
+		var idDecl *Decl
+		if p.is(ContinueToken) {
+			idDecl, err = p.consumeToken(ContinueToken)
+		} else {
+			idDecl, err = p.consumeWord("restart", RestartToken)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if !p.isWord("identity") {
+			return nil, p.syntaxError()
+		}
+		p.index++
+		trDecl.Add(idDecl)
+	}
+
 	return i, nil
 }
@@ -14,6 +14,12 @@ func (p *parser) parseWhere(selectDecl *Decl) error {
 	}
 	selectDecl.Add(whereDecl)
 
+	return p.parseConditions(whereDecl)
+}
+
+// parseConditions adds to decl a list of conditions linked by AND and OR,
+// ending with the instruction, a clause or a closing bracket
+func (p *parser) parseConditions(decl *Decl) error {
 	// Now should be a list of: Attribute and Operator and Value
 	gotClause := false
 	for {
@@ -21,7 +27,12 @@ func (p *parser) parseWhere(selectDecl *Decl) error {
 			break
 		}
 
-		if p.is(OrderToken, LimitToken, ForToken) {
+		if p.is(OrderToken, LimitToken, OffsetToken, ForToken, ReturningToken, UnionToken, IntersectToken, ExceptToken) {
+			break
+		}
+
+		// End of a subquery
+		if p.is(BracketClosingToken) && gotClause {
 			break
 		}
 
@@ -29,14 +40,14 @@ func (p *parser) parseWhere(selectDecl *Decl) error {
 		if err != nil {
 			return err
 		}
-		whereDecl.Add(attributeDecl)
+		decl.Add(attributeDecl)
 
 		if p.is(AndToken, OrToken) {
 			linkDecl, err := p.consumeToken(p.cur().Token)
 			if err != nil {
 				return err
 			}
-			whereDecl.Add(linkDecl)
+			decl.Add(linkDecl)
 		}
 
 		// Got at least one clause
@@ -50,7 +61,8 @@ func (p *parser) parseCondition() (*Decl, error) {
 	// Optionnaly, brackets
 
 	// We may have the WHERE 1 condition
-	if t := p.cur(); t.Token == NumberToken && t.Lexeme == "1" {
+	if p.isTrueCondition() {
+		t := p.cur()
 		attributeDecl := NewDecl(t)
 
 		// WHERE 1
@@ -79,6 +91,25 @@ func (p *parser) parseCondition() (*Decl, error) {
 		return attributeDecl, nil
 	}
 
+	// [NOT] EXISTS (subquery)
+	if p.is(ExistsToken) {
+		return p.parseExists()
+	}
+	if p.is(NotToken) {
+		if _, err := p.isNext(ExistsToken); err == nil {
+			notDecl, err := p.consumeToken(NotToken)
+			if err != nil {
+				return nil, err
+			}
+			existsDecl, err := p.parseExists()
+			if err != nil {
+				return nil, err
+			}
+			notDecl.Add(existsDecl)
+			return notDecl, nil
+		}
+	}
+
 	// do we have brackets ?
 	hasBracket := false
 	if p.is(BracketOpeningToken) {
@@ -89,14 +120,41 @@ func (p *parser) parseCondition() (*Decl, error) {
 		hasBracket = true
 	}
 
-	// Attribute
-	attributeDecl, err := p.parseAttribute()
+	// Attribute, or expression like a cast, a function call or an addition
+	var attributeDecl *Decl
+	var err error
+	literal := p.is(SimpleQuoteToken, NumberToken, FloatToken)
+	if p.isExpression() || literal {
+		attributeDecl, err = p.parseOperand()
+	} else {
+		attributeDecl, err = p.parseAttribute()
+	}
+	if err != nil {
+		return nil, err
+	}
+	attributeDecl, err = p.parseSubscript(attributeDecl)
+	if err != nil {
+		return nil, err
+	}
+	attributeDecl, err = p.parseCastShorthand(attributeDecl)
+	if err != nil {
+		return nil, err
+	}
+	attributeDecl, err = p.parseCollate(attributeDecl)
+	if err != nil {
+		return nil, err
+	}
+	attributeDecl, err = p.parseArithmetic(attributeDecl)
 	if err != nil {
 		return nil, err
 	}
 
+	if literal {
+		return p.parseLiteralComparison(attributeDecl, hasBracket)
+	}
+
 	switch p.cur().Token {
-	case EqualityToken, DistinctnessToken, LeftDipleToken, RightDipleToken, LessOrEqualToken, GreaterOrEqualToken:
+	case EqualityToken, DistinctnessToken, RegexMatchToken, ArrayOpToken, LeftDipleToken, RightDipleToken, LessOrEqualToken, GreaterOrEqualToken:
 		decl, err := p.consumeToken(p.cur().Token)
 		if err != nil {
 			return nil, err
@@ -150,8 +208,41 @@ func (p *parser) parseCondition() (*Decl, error) {
 		return attributeDecl, nil
 	}
 
-	// Value
-	valueDecl, err := p.parseValue()
+	// Value, scalar subquery or attribute of the form table.attribute
+	var valueDecl *Decl
+	quoted := p.is(SimpleQuoteToken)
+	if p.isSubquery() {
+		valueDecl, err = p.parseSubquery()
+	} else if p.is(AnyToken) {
+		valueDecl, err = p.parseAny()
+	} else if p.isExpression() {
+		valueDecl, err = p.parseOperand()
+	} else if _, perr := p.isNext(PeriodToken); perr == nil && p.is(StringToken) {
+		valueDecl, err = p.parseAttribute()
+		if err == nil {
+			valueDecl, err = p.parseSubscript(valueDecl)
+		}
+	} else if p.is(NullToken) {
+		valueDecl, err = p.consumeToken(NullToken)
+	} else {
+		valueDecl, err = p.parseValue()
+	}
+	if err != nil {
+		return nil, err
+	}
+	// a literal value is cast or computed as such, not as an attribute
+	if valueDecl.Token == StringToken && len(valueDecl.Decl) == 0 && (quoted || p.is(DoubleColonToken)) && p.is(DoubleColonToken, PlusToken, MinusToken, CollateToken) {
+		valueDecl.Token = SimpleQuoteToken
+	}
+	valueDecl, err = p.parseCastShorthand(valueDecl)
+	if err != nil {
+		return nil, err
+	}
+	valueDecl, err = p.parseCollate(valueDecl)
+	if err != nil {
+		return nil, err
+	}
+	valueDecl, err = p.parseArithmetic(valueDecl)
 	if err != nil {
 		return nil, err
 	}
@@ -165,3 +256,103 @@ func (p *parser) parseCondition() (*Decl, error) {
 
 	return attributeDecl, nil
 }
+
+// isTrueCondition returns true if current token starts the WHERE 1 or
+// WHERE 1 = 1 condition, and not a comparison of 1 with an attribute
+func (p *parser) isTrueCondition() bool {
+	if t := p.cur(); t.Token != NumberToken || t.Lexeme != "1" {
+		return false
+	}
+	if _, err := p.isNext(EqualityToken, DistinctnessToken, LeftDipleToken, RightDipleToken, LessOrEqualToken, GreaterOrEqualToken); err != nil {
+		return true
+	}
+	if p.tokens[p.index+1].Token != EqualityToken || p.index+2 >= len(p.tokens) {
+		return false
+	}
+	t := p.tokens[p.index+2]
+	return t.Token == NumberToken && t.Lexeme == "1"
+}
+
+// parseLiteralComparison parses the rest of a condition whose left operand is
+// a literal, of the form
+// literal op ANY(array)
+// literal op attribute
+// The second form is returned flipped, as attribute op literal, so it is
+// executed like any other comparison of an attribute with a value.
+func (p *parser) parseLiteralComparison(literalDecl *Decl, hasBracket bool) (*Decl, error) {
+	if !p.is(EqualityToken, DistinctnessToken, LeftDipleToken, RightDipleToken, LessOrEqualToken, GreaterOrEqualToken) {
+		return nil, p.syntaxError()
+	}
+	opDecl, err := p.consumeToken(p.cur().Token)
+	if err != nil {
+		return nil, err
+	}
+
+	var decl *Decl
+	switch {
+	case p.is(AnyToken):
+		anyDecl, err := p.parseAny()
+		if err != nil {
+			return nil, err
+		}
+		literalDecl.Add(opDecl)
+		literalDecl.Add(anyDecl)
+		decl = literalDecl
+	case len(literalDecl.Decl) == 0 && (p.is(DoubleQuoteToken, BacktickToken) || (p.is(StringToken) && !p.isExpression())):
+		decl, err = p.parseAttribute()
+		if err != nil {
+			return nil, err
+		}
+		flipComparison(opDecl)
+		// the literal is now a value, quoted or not
+		if literalDecl.Token == SimpleQuoteToken {
+			literalDecl.Token = StringToken
+		}
+		decl.Add(opDecl)
+		decl.Add(literalDecl)
+	default:
+		return nil, p.syntaxError()
+	}
+
+	if hasBracket {
+		if _, err = p.consumeToken(BracketClosingToken); err != nil {
+			return nil, err
+		}
+	}
+
+	return decl, nil
+}
+
+// flipComparison turns comparison decl op into the comparison with swapped
+// operands, like < into >
+func flipComparison(op *Decl) {
+	switch op.Token {
+	case LeftDipleToken:
+		op.Token, op.Lexeme = RightDipleToken, ">"
+	case RightDipleToken:
+		op.Token, op.Lexeme = LeftDipleToken, "<"
+	case LessOrEqualToken:
+		op.Token, op.Lexeme = GreaterOrEqualToken, ">="
+	case GreaterOrEqualToken:
+		op.Token, op.Lexeme = LessOrEqualToken, "<="
+	}
+}
+
+// parseExists parses an EXISTS (subquery) condition
+func (p *parser) parseExists() (*Decl, error) {
+	existsDecl, err := p.consumeToken(ExistsToken)
+	if err != nil {
+		return nil, err
+	}
+
+	if !p.isSubquery() {
+		return nil, p.syntaxError()
+	}
+	subqueryDecl, err := p.parseSubquery()
+	if err != nil {
+		return nil, err
+	}
+	existsDecl.Add(subqueryDecl)
+
+	return existsDecl, nil
+}
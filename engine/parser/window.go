@@ -0,0 +1,145 @@
+package parser
+
+import (
+	"strings"
+)
+
+// windowFunctions maps names of window functions to their token. Names are
+// not keywords, so attributes can still be named after them.
+var windowFunctions = map[string]int{
+	"row_number": RowNumberToken,
+	"rank":       RankToken,
+	"dense_rank": DenseRankToken,
+	"lag":        LagToken,
+	"lead":       LeadToken,
+}
+
+// isWindowFunction returns true if current token starts a call of a window
+// function, which must be followed by OVER
+func (p *parser) isWindowFunction() bool {
+	_, ok := windowFunctions[strings.ToLower(p.cur().Lexeme)]
+	return ok && p.isFunctionCall()
+}
+
+// isOver returns true if current token starts the window of a function call
+func (p *parser) isOver() bool {
+	return p.isWord("over") && p.isFunctionCall()
+}
+
+// parseWindowFunction parses a window function call of the form
+// ROW_NUMBER() OVER (...), RANK() OVER (...), DENSE_RANK() OVER (...)
+// LAG(attribute [, offset [, default]]) OVER (...)
+// LEAD(attribute [, offset [, default]]) OVER (...)
+//
+// LAG and LEAD decls hold the attribute, then offset and default decls if any.
+func (p *parser) parseWindowFunction() (*Decl, error) {
+	name := strings.ToLower(p.cur().Lexeme)
+	funcDecl, err := p.consumeWord(name, windowFunctions[name])
+	if err != nil {
+		return nil, err
+	}
+	if _, err := p.consumeToken(BracketOpeningToken); err != nil {
+		return nil, err
+	}
+
+	if funcDecl.Token == LagToken || funcDecl.Token == LeadToken {
+		attrDecl, err := p.parseAttribute()
+		if err != nil {
+			return nil, err
+		}
+		funcDecl.Add(attrDecl)
+
+		if p.is(CommaToken) {
+			if _, err := p.consumeToken(CommaToken); err != nil {
+				return nil, err
+			}
+			offsetDecl, err := p.consumeToken(NumberToken, ArgToken, NamedArgToken)
+			if err != nil {
+				return nil, err
+			}
+			funcDecl.Add(offsetDecl)
+		}
+
+		if p.is(CommaToken) {
+			if _, err := p.consumeToken(CommaToken); err != nil {
+				return nil, err
+			}
+			var defaultDecl *Decl
+			if p.is(NullToken) {
+				defaultDecl, err = p.consumeToken(NullToken)
+			} else {
+				defaultDecl, err = p.parseValue()
+			}
+			if err != nil {
+				return nil, err
+			}
+			funcDecl.Add(defaultDecl)
+		}
+	}
+
+	if _, err := p.consumeToken(BracketClosingToken); err != nil {
+		return nil, err
+	}
+
+	if err := p.parseOver(funcDecl); err != nil {
+		return nil, err
+	}
+
+	return funcDecl, nil
+}
+
+// parseOver parses the window of a function call, of the form
+// OVER ([PARTITION BY attribute, ...] [ORDER BY attribute [ASC|DESC], ...])
+//
+// Function decl gets an OverToken child, holding an optional PartitionToken
+// decl with partition attributes, then an optional OrderToken decl with
+// order attributes.
+func (p *parser) parseOver(funcDecl *Decl) error {
+	overDecl, err := p.consumeWord("over", OverToken)
+	if err != nil {
+		return err
+	}
+	funcDecl.Add(overDecl)
+
+	if _, err := p.consumeToken(BracketOpeningToken); err != nil {
+		return err
+	}
+
+	if p.isWord("partition") {
+		partitionDecl, err := p.consumeWord("partition", PartitionToken)
+		if err != nil {
+			return err
+		}
+		overDecl.Add(partitionDecl)
+
+		if _, err := p.consumeToken(ByToken); err != nil {
+			return err
+		}
+		for {
+			attrDecl, err := p.parseAttribute()
+			if err != nil {
+				return err
+			}
+			partitionDecl.Add(attrDecl)
+
+			if !p.is(CommaToken) {
+				break
+			}
+			if _, err := p.consumeToken(CommaToken); err != nil {
+				return err
+			}
+		}
+	}
+
+	if p.is(OrderToken) {
+		if err := p.parseOrderBy(overDecl); err != nil {
+			return err
+		}
+	}
+
+	if _, err := p.consumeToken(BracketClosingToken); err != nil {
+		return err
+	}
+
+	return nil
+}
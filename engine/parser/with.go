@@ -0,0 +1,100 @@
+package parser
+
+// parseWith parses a statement preceded by common table expressions, of the form
+// WITH [RECURSIVE] name [(column, ...)] AS (SELECT ...) [, ...] statement
+//
+// Each common table expression is a StringToken decl with an AsToken child
+// holding the query decl first, then the column name decls. Last child of
+// the WITH decl is the statement. RECURSIVE, if any, is the first child.
+func (p *parser) parseWith() (*Instruction, error) {
+	i := &Instruction{}
+
+	withDecl, err := p.consumeToken(WithToken)
+	if err != nil {
+		return nil, err
+	}
+	i.Decls = append(i.Decls, withDecl)
+
+	if p.is(RecursiveToken) {
+		recursiveDecl, err := p.consumeToken(RecursiveToken)
+		if err != nil {
+			return nil, err
+		}
+		withDecl.Add(recursiveDecl)
+	}
+
+	for {
+		nameDecl, err := p.parseQuotedToken()
+		if err != nil {
+			return nil, err
+		}
+
+		var names []*Decl
+		if p.is(BracketOpeningToken) {
+			if _, err := p.consumeToken(BracketOpeningToken); err != nil {
+				return nil, err
+			}
+			for {
+				n, err := p.parseQuotedToken()
+				if err != nil {
+					return nil, err
+				}
+				names = append(names, n)
+				if !p.is(CommaToken) {
+					break
+				}
+				if _, err := p.consumeToken(CommaToken); err != nil {
+					return nil, err
+				}
+			}
+			if _, err := p.consumeToken(BracketClosingToken); err != nil {
+				return nil, err
+			}
+		}
+
+		asDecl, err := p.consumeToken(AsToken)
+		if err != nil {
+			return nil, err
+		}
+		if !p.isSubquery() {
+			return nil, p.syntaxError()
+		}
+		queryDecl, err := p.parseSubquery()
+		if err != nil {
+			return nil, err
+		}
+		asDecl.Add(queryDecl)
+		for _, n := range names {
+			asDecl.Add(n)
+		}
+		nameDecl.Add(asDecl)
+		withDecl.Add(nameDecl)
+
+		if !p.is(CommaToken) {
+			break
+		}
+		if _, err := p.consumeToken(CommaToken); err != nil {
+			return nil, err
+		}
+	}
+
+	var stmt *Instruction
+	switch p.cur().Token {
+	case SelectToken:
+		stmt, err = p.parseSelect(p.tokens)
+	case InsertToken:
+		stmt, err = p.parseInsert()
+	case UpdateToken:
+		stmt, err = p.parseUpdate()
+	case DeleteToken:
+		stmt, err = p.parseDelete()
+	default:
+		return nil, p.syntaxError()
+	}
+	if err != nil {
+		return nil, err
+	}
+	withDecl.Add(stmt.Decls[0])
+
+	return i, nil
+}